@@ -0,0 +1,277 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAsyncCapacity is the default number of measures buffered by
+// asynchronous handlers.
+const DefaultAsyncCapacity = 8192
+
+// asyncBatchSize is the maximum number of measures passed to the handler of an
+// AsyncHandler in a single call.
+const asyncBatchSize = 256
+
+// Async returns a copy of the engine which enqueues measures in a lock-free
+// ring buffer of the given capacity, consumed by a background goroutine that
+// hands them to the handler of e. Producing measures then only costs a copy
+// into the buffer, the serialization done by handlers happens off the hot
+// path. A capacity of zero or less means DefaultAsyncCapacity.
+//
+// When the buffer is full the measures are discarded, and counted by the
+// stats.discarded counter reported to the handler. Flushing the returned
+// engine waits for the buffered measures to be handed to the handler, and
+// closing it stops the background goroutine (see Engine.Close).
+func (e *Engine) Async(capacity int) *Engine {
+	sub := &Engine{
+		Handler:            NewAsyncHandler(e.Handler, capacity),
+		Prefix:             e.Prefix,
+		Tags:               e.Tags,
+		AllowDuplicateTags: e.AllowDuplicateTags,
+		SampleRate:         e.SampleRate,
+		Sequenced:          e.Sequenced,
+		TrackMetrics:       e.TrackMetrics,
+		HandleTTL:          e.HandleTTL,
+	}
+	sub.flushes.ptr.Store(e.flushes.load())
+	sub.gauges.ptr.Store(e.gauges.load())
+	sub.sequence.ptr.Store(e.sequence.load())
+	sub.metrics.ptr.Store(e.metrics.load())
+	return sub
+}
+
+// AsyncHandler is a handler which buffers measures and hands them to another
+// handler from a background goroutine, see Engine.Async.
+type AsyncHandler struct {
+	handler   Handler
+	ring      asyncRing
+	discarded atomic.Int64
+
+	// Producers hold a read lock while pushing measures, Close takes the
+	// write lock to set closed, so no measure is pushed after the final
+	// drain of the background goroutine.
+	mutex  sync.RWMutex
+	closed bool
+
+	wake    chan struct{}
+	flushes chan chan struct{}
+	done    chan struct{}
+	join    chan struct{}
+	once    sync.Once
+
+	// only accessed by the background goroutine
+	batch []Measure
+	times []time.Time
+}
+
+// NewAsyncHandler returns a handler buffering up to capacity measures, which
+// are handed to h by a background goroutine. The handler must be closed to
+// release the goroutine.
+func NewAsyncHandler(h Handler, capacity int) *AsyncHandler {
+	if capacity <= 0 {
+		capacity = DefaultAsyncCapacity
+	}
+
+	a := &AsyncHandler{
+		handler: h,
+		wake:    make(chan struct{}, 1),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+		join:    make(chan struct{}),
+		batch:   make([]Measure, 0, asyncBatchSize),
+		times:   make([]time.Time, 0, asyncBatchSize),
+	}
+
+	a.ring.init(capacity)
+	go a.run()
+	return a
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (a *AsyncHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	if a.closed {
+		return
+	}
+
+	discarded := 0
+
+	for i := range measures {
+		if !a.ring.push(t, &measures[i]) {
+			discarded++
+		}
+	}
+
+	if discarded != 0 {
+		a.discarded.Add(int64(discarded))
+	}
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush satisfies the Flusher interface, it waits for the buffered measures to
+// be handed to the handler, then flushes it.
+func (a *AsyncHandler) Flush() {
+	ack := make(chan struct{})
+
+	select {
+	case a.flushes <- ack:
+		<-ack
+	case <-a.join:
+		flush(a.handler)
+	}
+}
+
+// Close hands the buffered measures to the handler and stops the background
+// goroutine. Measures produced after Close returns are discarded.
+func (a *AsyncHandler) Close() error {
+	a.once.Do(func() {
+		a.mutex.Lock()
+		a.closed = true
+		a.mutex.Unlock()
+		close(a.done)
+	})
+	<-a.join
+	return nil
+}
+
+// Handlers returns the handler that a hands measures to.
+func (a *AsyncHandler) Handlers() []Handler {
+	return []Handler{a.handler}
+}
+
+func (a *AsyncHandler) run() {
+	defer close(a.join)
+
+	for {
+		select {
+		case <-a.wake:
+			a.drain()
+		case ack := <-a.flushes:
+			a.drain()
+			flush(a.handler)
+			close(ack)
+		case <-a.done:
+			a.drain()
+			flush(a.handler)
+			return
+		}
+	}
+}
+
+// drain hands the measures in the ring buffer to the handler, in batches of
+// measures taken at the same time.
+func (a *AsyncHandler) drain() {
+	for {
+		a.batch, a.times = a.batch[:0], a.times[:0]
+
+		for len(a.batch) < asyncBatchSize {
+			a.batch = a.batch[:len(a.batch)+1]
+			a.times = a.times[:len(a.times)+1]
+
+			if !a.ring.pop(&a.times[len(a.times)-1], &a.batch[len(a.batch)-1]) {
+				a.batch = a.batch[:len(a.batch)-1]
+				a.times = a.times[:len(a.times)-1]
+				break
+			}
+		}
+
+		for i, j := 0, 0; i < len(a.batch); i = j {
+			for j = i + 1; j < len(a.batch) && a.times[j].Equal(a.times[i]); j++ {
+			}
+			a.handler.HandleMeasures(a.times[i], a.batch[i:j]...)
+		}
+
+		if len(a.batch) < asyncBatchSize {
+			break
+		}
+	}
+
+	if n := a.discarded.Swap(0); n != 0 {
+		a.handler.HandleMeasures(time.Now(), Measure{
+			Name:   "stats",
+			Fields: []Field{MakeField("discarded", n, Counter)},
+		})
+	}
+}
+
+// asyncRing is a bounded multi-producer single-consumer queue of measures, it
+// uses the sequence numbers of slots to synchronize producers and the consumer
+// without locks (see Dmitry Vyukov's bounded MPMC queue).
+type asyncRing struct {
+	mask  uint64
+	slots []asyncSlot
+	head  atomic.Uint64
+	_     [56]byte // keeps head and tail on different cache lines
+	tail  uint64
+}
+
+type asyncSlot struct {
+	seq     atomic.Uint64
+	time    time.Time
+	measure Measure
+}
+
+func (r *asyncRing) init(capacity int) {
+	size := 1
+	for size < capacity {
+		size <<= 1
+	}
+	r.mask = uint64(size - 1)
+	r.slots = make([]asyncSlot, size)
+	for i := range r.slots {
+		r.slots[i].seq.Store(uint64(i))
+	}
+}
+
+// push copies m to the ring, it returns false if the ring is full.
+func (r *asyncRing) push(t time.Time, m *Measure) bool {
+	for {
+		pos := r.head.Load()
+		s := &r.slots[pos&r.mask]
+
+		switch diff := int64(s.seq.Load() - pos); {
+		case diff == 0:
+			if r.head.CompareAndSwap(pos, pos+1) {
+				// The slices of the slot are reused, measures handed to
+				// handlers are copied out of the ring by pop.
+				s.time = t
+				s.measure.Name = m.Name
+				s.measure.Fields = append(s.measure.Fields[:0], m.Fields...)
+				s.measure.Tags = append(s.measure.Tags[:0], m.Tags...)
+				s.measure.SampleRate = m.SampleRate
+				s.seq.Store(pos + 1)
+				return true
+			}
+		case diff < 0:
+			return false
+		}
+	}
+}
+
+// pop copies the oldest measure of the ring to m, reusing its slices. It must
+// only be called by the consumer, and returns false if the ring is empty.
+func (r *asyncRing) pop(t *time.Time, m *Measure) bool {
+	s := &r.slots[r.tail&r.mask]
+
+	if s.seq.Load() != r.tail+1 {
+		return false
+	}
+
+	*t = s.time
+	m.Name = s.measure.Name
+	m.Fields = append(m.Fields[:0], s.measure.Fields...)
+	m.Tags = append(m.Tags[:0], s.measure.Tags...)
+	m.SampleRate = s.measure.SampleRate
+
+	s.seq.Store(r.tail + r.mask + 1)
+	r.tail++
+	return true
+}
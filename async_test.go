@@ -0,0 +1,116 @@
+package stats_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineAsync(t *testing.T) {
+	h := &statstest.Handler{}
+	eng := stats.NewEngine("test", h, stats.T("service", "api")).Async(0)
+	defer eng.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j != 100; j++ {
+				eng.Incr("requests", stats.T("status", "200"))
+			}
+		}()
+	}
+	wg.Wait()
+	eng.Flush()
+
+	count := 0
+	for _, m := range h.Measures() {
+		if m.Name == "test" {
+			count += int(m.Fields[0].Value.Int())
+			assert.Equal(t, []stats.Tag{stats.T("service", "api"), stats.T("status", "200")}, m.Tags)
+		}
+	}
+	assert.Equal(t, 1000, count)
+	assert.EqualValues(t, 1, h.FlushCalls())
+}
+
+func TestAsyncHandlerDiscard(t *testing.T) {
+	h := &statstest.Handler{}
+	blocked := make(chan struct{})
+	unblock := make(chan struct{})
+	once := sync.Once{}
+
+	a := stats.NewAsyncHandler(stats.HandlerFunc(func(t time.Time, measures ...stats.Measure) {
+		once.Do(func() {
+			close(blocked)
+			<-unblock
+		})
+		h.HandleMeasures(t, measures...)
+	}), 4)
+	defer a.Close()
+
+	m := stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}}
+	a.HandleMeasures(time.Now(), m)
+	<-blocked
+
+	for i := 0; i != 10; i++ {
+		a.HandleMeasures(time.Now(), m)
+	}
+	close(unblock)
+	a.Flush()
+
+	handled, discarded := 0, 0
+	for _, m := range h.Measures() {
+		switch m.Name {
+		case "a":
+			handled++
+		case "stats":
+			discarded += int(m.Fields[0].Value.Int())
+		}
+	}
+	assert.Equal(t, 5, handled)
+	assert.Equal(t, 6, discarded)
+}
+
+func TestAsyncHandlerClose(t *testing.T) {
+	h := &statstest.Handler{}
+	a := stats.NewAsyncHandler(h, 0)
+
+	m := stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}}
+	a.HandleMeasures(time.Now(), m)
+	a.Close()
+
+	assert.Len(t, h.Measures(), 1)
+
+	a.HandleMeasures(time.Now(), m)
+	a.Flush()
+
+	assert.Len(t, h.Measures(), 1, "measures handled after Close must be discarded")
+}
+
+func TestEngineAsyncClose(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	base := stats.NewEngine("test", h)
+	base.Sequenced = true
+
+	eng := base.Async(0)
+	assert.True(t, eng.Sequenced, "the async engine must be sequenced like its parent")
+
+	eng.Incr("requests")
+	assert.NoError(t, eng.Close())
+	assert.Len(t, h.Measures(), 1, "measures buffered before Close must be handed to the handler")
+
+	eng.Incr("requests")
+	eng.Flush()
+	assert.Len(t, h.Measures(), 1, "measures produced after Close must be discarded")
+}
@@ -0,0 +1,329 @@
+package awscloudwatch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultBatchSize is the default number of metrics sent in each
+	// PutMetricData request.
+	DefaultBatchSize = 20
+
+	// DefaultFlushInterval is the default interval at which the client sends
+	// the metrics it buffered to CloudWatch.
+	DefaultFlushInterval = time.Minute
+
+	// DefaultMaxBufferedMetrics is the default number of buffered metrics
+	// which triggers sending them to CloudWatch before the next flush.
+	DefaultMaxBufferedMetrics = 1000
+
+	// DefaultTimeout is the default timeout of requests to CloudWatch.
+	DefaultTimeout = 10 * time.Second
+)
+
+// The ClientConfig type is used to configure CloudWatch clients.
+type ClientConfig struct {
+	// Namespace of the metrics in CloudWatch. The default is
+	// DefaultNamespace.
+	Namespace string
+
+	// Region of the CloudWatch endpoint, the default is the value of the
+	// AWS_REGION or AWS_DEFAULT_REGION environment variables.
+	Region string
+
+	// Endpoint is the URL of the CloudWatch API, the default is the endpoint
+	// of the region.
+	Endpoint string
+
+	// Credentials used to sign requests, the default is EnvCredentials().
+	Credentials *Credentials
+
+	// Dimensions maps the names of the tags to report as dimensions to the
+	// names of the dimensions. When nil, all tags are reported as dimensions
+	// under their own names. CloudWatch bills each combination of dimension
+	// values as a separate metric, high cardinality tags should be left out.
+	Dimensions map[string]string
+
+	// BatchSize is the maximum number of metrics sent in each PutMetricData
+	// request. The default is DefaultBatchSize.
+	BatchSize int
+
+	// FlushInterval is the interval at which buffered metrics are sent to
+	// CloudWatch. The default is DefaultFlushInterval.
+	FlushInterval time.Duration
+
+	// MaxBufferedMetrics is the number of buffered metrics which triggers
+	// sending them before the next flush. The default is
+	// DefaultMaxBufferedMetrics.
+	MaxBufferedMetrics int
+
+	// Maximum amount of time that requests to CloudWatch may take. The
+	// default is DefaultTimeout.
+	Timeout time.Duration
+
+	// Transport configures the HTTP transport used by the client to send
+	// requests to CloudWatch. By default http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// Client is a stats handler sending measures to CloudWatch with PutMetricData
+// requests. Each field of the measures is sent as a separate metric, named
+// after the measure and the field, with the tags as dimensions.
+//
+// Metrics are buffered and sent in batches, at regular intervals or when
+// enough of them were buffered.
+type Client struct {
+	namespace  string
+	region     string
+	endpoint   string
+	creds      Credentials
+	dimensions dimensionMapper
+	batchSize  int
+	maxMetrics int
+	http       http.Client
+
+	mutex   sync.Mutex
+	pending []datum
+
+	// serializes sending batches, so Flush returns once the metrics buffered
+	// when it was called have been sent
+	sending sync.Mutex
+
+	once sync.Once
+	wake chan struct{}
+	stop chan struct{}
+	join chan struct{}
+}
+
+type datum struct {
+	name       string
+	unit       string
+	value      float64
+	time       time.Time
+	dimensions []dimension
+}
+
+// NewClient creates and returns a new CloudWatch client publishing metrics of
+// the given namespace.
+func NewClient(namespace string) *Client {
+	return NewClientWith(ClientConfig{
+		Namespace: namespace,
+	})
+}
+
+// NewClientWith creates and returns a new CloudWatch client configured with
+// the given config.
+func NewClientWith(config ClientConfig) *Client {
+	if len(config.Namespace) == 0 {
+		config.Namespace = DefaultNamespace
+	}
+
+	if len(config.Region) == 0 {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+
+	if len(config.Region) == 0 {
+		config.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if len(config.Endpoint) == 0 {
+		if len(config.Region) == 0 {
+			log.Print("stats/awscloudwatch: no region configured, set ClientConfig.Region or AWS_REGION")
+		}
+		config.Endpoint = "https://monitoring." + config.Region + ".amazonaws.com/"
+	}
+
+	if config.Credentials == nil {
+		creds := EnvCredentials()
+		config.Credentials = &creds
+	}
+
+	if config.BatchSize == 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+
+	if config.FlushInterval == 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+
+	if config.MaxBufferedMetrics == 0 {
+		config.MaxBufferedMetrics = DefaultMaxBufferedMetrics
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	c := &Client{
+		namespace:  config.Namespace,
+		region:     config.Region,
+		endpoint:   config.Endpoint,
+		creds:      *config.Credentials,
+		dimensions: dimensionMapper(config.Dimensions),
+		batchSize:  config.BatchSize,
+		maxMetrics: config.MaxBufferedMetrics,
+		http: http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	go c.run(config.FlushInterval)
+	return c
+}
+
+func (c *Client) run(interval time.Duration) {
+	defer close(c.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.wake:
+			c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (c *Client) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	c.mutex.Lock()
+
+	for _, m := range measures {
+		var dims []dimension
+
+		for _, f := range m.Fields {
+			v, ok := valueOf(f.Value)
+			if !ok {
+				continue
+			}
+
+			// The dimensions are shared by all fields of the measure.
+			if dims == nil {
+				dims = c.dimensions.appendDimensions(make([]dimension, 0, len(m.Tags)), m.Tags)
+			}
+
+			c.pending = append(c.pending, datum{
+				name:       metricName(m.Name, f.Name),
+				unit:       unitOf(f),
+				value:      v,
+				time:       time,
+				dimensions: dims,
+			})
+		}
+	}
+
+	full := len(c.pending) >= c.maxMetrics
+	c.mutex.Unlock()
+
+	if full {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush sends the buffered metrics to CloudWatch, satisfies the stats.Flusher
+// interface.
+func (c *Client) Flush() {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.mutex.Unlock()
+
+	for len(pending) != 0 {
+		n := min(len(pending), c.batchSize)
+
+		if err := c.putMetricData(pending[:n]); err != nil {
+			log.Printf("stats/awscloudwatch: %s", err)
+		}
+
+		pending = pending[n:]
+	}
+}
+
+// Close flushes and closes the client, satisfies the io.Closer interface.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.join
+	})
+	c.Flush()
+	return nil
+}
+
+func (c *Client) putMetricData(data []datum) error {
+	body := []byte(encodePutMetricData(c.namespace, data).Encode())
+
+	req, err := http.NewRequest("POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signRequest(req, body, c.creds, c.region, "monitoring", time.Now())
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("PutMetricData: %s: %s", res.Status, bytes.TrimSpace(b))
+	}
+
+	return nil
+}
+
+// encodePutMetricData returns the parameters of a PutMetricData request of the
+// CloudWatch query API sending data.
+//
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_PutMetricData.html
+func encodePutMetricData(namespace string, data []datum) url.Values {
+	q := url.Values{
+		"Action":    {"PutMetricData"},
+		"Version":   {"2010-08-01"},
+		"Namespace": {namespace},
+	}
+
+	for i, d := range data {
+		member := "MetricData.member." + strconv.Itoa(i+1) + "."
+		q.Set(member+"MetricName", d.name)
+		q.Set(member+"Unit", d.unit)
+		q.Set(member+"Value", strconv.FormatFloat(d.value, 'g', -1, 64))
+		q.Set(member+"Timestamp", d.time.UTC().Format(time.RFC3339Nano))
+
+		for j, dim := range d.dimensions {
+			prefix := member + "Dimensions.member." + strconv.Itoa(j+1) + "."
+			q.Set(prefix+"Name", dim.name)
+			q.Set(prefix+"Value", dim.value)
+		}
+	}
+
+	return q
+}
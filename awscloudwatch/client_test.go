@@ -0,0 +1,86 @@
+package awscloudwatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestClient(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if auth := req.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-west-2/monitoring/aws4_request") {
+			t.Error("bad authorization:", auth)
+		}
+		if token := req.Header.Get("X-Amz-Security-Token"); token != "token" {
+			t.Error("bad security token:", token)
+		}
+		if err := req.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		mutex.Lock()
+		requests = append(requests, req.PostForm)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	client := NewClientWith(ClientConfig{
+		Namespace: "test",
+		Region:    "us-west-2",
+		Endpoint:  server.URL,
+		Credentials: &Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+		},
+	})
+
+	for i := 0; i != 45; i++ {
+		client.HandleMeasures(timestamp, stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("count", i, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "GET")},
+		})
+	}
+	client.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(requests) != 3 {
+		t.Fatal("expected 3 requests, got", len(requests))
+	}
+
+	for i, n := range []int{20, 20, 5} {
+		q := requests[i]
+		if q.Get("Action") != "PutMetricData" || q.Get("Namespace") != "test" {
+			t.Errorf("request %d: bad action or namespace: %v", i, q)
+		}
+		if q.Get("MetricData.member."+strconv.Itoa(n)+".MetricName") == "" || q.Get("MetricData.member."+strconv.Itoa(n+1)+".MetricName") != "" {
+			t.Errorf("request %d: expected %d metrics", i, n)
+		}
+	}
+
+	expect := url.Values{
+		"MetricData.member.1.MetricName":                {"request.count"},
+		"MetricData.member.1.Unit":                      {"Count"},
+		"MetricData.member.1.Value":                     {"0"},
+		"MetricData.member.1.Timestamp":                 {"2017-07-23T03:36:00.123456789Z"},
+		"MetricData.member.1.Dimensions.member.1.Name":  {"method"},
+		"MetricData.member.1.Dimensions.member.1.Value": {"GET"},
+	}
+
+	for name, value := range expect {
+		if found := requests[0].Get(name); found != value[0] {
+			t.Errorf("bad %s: expected %q, got %q", name, value[0], found)
+		}
+	}
+}
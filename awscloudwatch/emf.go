@@ -0,0 +1,219 @@
+package awscloudwatch
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultNamespace is the default CloudWatch namespace of metrics.
+	DefaultNamespace = "stats"
+
+	// DefaultEMFBufferSize is the default size of the batches of Embedded
+	// Metric Format documents written to the output.
+	DefaultEMFBufferSize = 64 * 1024
+
+	// maxEMFMetrics is the maximum number of metrics in an Embedded Metric
+	// Format document, larger measures are split in several documents.
+	maxEMFMetrics = 100
+)
+
+// The EMFConfig type is used to configure EMF handlers.
+type EMFConfig struct {
+	// Namespace of the metrics in CloudWatch. The default is
+	// DefaultNamespace.
+	Namespace string
+
+	// Output is where the documents are written, the default is os.Stdout
+	// which the Lambda runtime forwards to CloudWatch Logs.
+	Output io.Writer
+
+	// Dimensions maps the names of the tags to report as dimensions to the
+	// names of the dimensions. When nil, all tags are reported as dimensions
+	// under their own names. CloudWatch bills each combination of dimension
+	// values as a separate metric, high cardinality tags should be left out.
+	Dimensions map[string]string
+
+	// Maximum size of the batches of documents written to the output. The
+	// default is DefaultEMFBufferSize.
+	BufferSize int
+}
+
+// EMFHandler is a stats handler writing measures as CloudWatch Embedded Metric
+// Format documents, one JSON document per line. CloudWatch extracts metrics
+// from the documents it finds in logs, which makes this handler usable in
+// environments where no agent runs next to the program, like Lambda.
+//
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+//
+// Documents are buffered, programs running in Lambda must call Flush before
+// the end of each invocation.
+type EMFHandler struct {
+	serializer emfSerializer
+	buffer     stats.Buffer
+}
+
+// NewEMFHandler creates and returns a new EMF handler writing metrics of the
+// given namespace to os.Stdout.
+func NewEMFHandler(namespace string) *EMFHandler {
+	return NewEMFHandlerWith(EMFConfig{
+		Namespace: namespace,
+	})
+}
+
+// NewEMFHandlerWith creates and returns a new EMF handler configured with the
+// given config.
+func NewEMFHandlerWith(config EMFConfig) *EMFHandler {
+	if len(config.Namespace) == 0 {
+		config.Namespace = DefaultNamespace
+	}
+
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultEMFBufferSize
+	}
+
+	h := &EMFHandler{
+		serializer: emfSerializer{
+			namespace:  config.Namespace,
+			dimensions: dimensionMapper(config.Dimensions),
+			output:     config.Output,
+		},
+	}
+
+	h.buffer.BufferSize = config.BufferSize
+	h.buffer.Serializer = &h.serializer
+	return h
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *EMFHandler) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	h.buffer.HandleMeasures(time, measures...)
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (h *EMFHandler) Flush() {
+	h.buffer.Flush()
+}
+
+type emfSerializer struct {
+	namespace  string
+	dimensions dimensionMapper
+
+	mutex  sync.Mutex
+	output io.Writer
+}
+
+func (s *emfSerializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
+	var dims [maxDimensions]dimension
+
+	for _, m := range measures {
+		fields := m.Fields
+		for len(fields) != 0 {
+			n := min(len(fields), maxEMFMetrics)
+			b = s.appendDocument(b, time, m.Name, fields[:n], s.dimensions.appendDimensions(dims[:0], m.Tags))
+			fields = fields[n:]
+		}
+	}
+
+	return b
+}
+
+func (s *emfSerializer) appendDocument(b []byte, t time.Time, name string, fields []stats.Field, dims []dimension) []byte {
+	start := len(b)
+
+	b = append(b, `{"_aws":{"Timestamp":`...)
+	b = strconv.AppendInt(b, t.UnixMilli(), 10)
+	b = append(b, `,"CloudWatchMetrics":[{"Namespace":`...)
+	b = appendJSONString(b, s.namespace)
+	b = append(b, `,"Dimensions":[[`...)
+	for i, d := range dims {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, d.name)
+	}
+	b = append(b, `]],"Metrics":[`...)
+
+	count := 0
+	for _, f := range fields {
+		if _, ok := valueOf(f.Value); !ok {
+			continue
+		}
+		if count != 0 {
+			b = append(b, ',')
+		}
+		b = append(b, `{"Name":`...)
+		b = appendJSONString(b, metricName(name, f.Name))
+		b = append(b, `,"Unit":`...)
+		b = appendJSONString(b, unitOf(f))
+		b = append(b, '}')
+		count++
+	}
+
+	// Measures without any value that CloudWatch accepts produce no document.
+	if count == 0 {
+		return b[:start]
+	}
+
+	b = append(b, `]}]}`...)
+
+	for _, d := range dims {
+		b = append(b, ',')
+		b = appendJSONString(b, d.name)
+		b = append(b, ':')
+		b = appendJSONString(b, d.value)
+	}
+
+	for _, f := range fields {
+		if v, ok := valueOf(f.Value); ok {
+			b = append(b, ',')
+			b = appendJSONString(b, metricName(name, f.Name))
+			b = append(b, ':')
+			b = strconv.AppendFloat(b, v, 'g', -1, 64)
+		}
+	}
+
+	return append(b, '}', '\n')
+}
+
+func (s *emfSerializer) Write(b []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.output.Write(b)
+}
+
+// appendJSONString appends s to b as a JSON string. Invalid UTF-8 sequences are
+// replaced with the unicode replacement character.
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b = append(b, '\\', byte(r))
+		case r == '\n':
+			b = append(b, '\\', 'n')
+		case r == '\r':
+			b = append(b, '\\', 'r')
+		case r == '\t':
+			b = append(b, '\\', 't')
+		case r < 0x20:
+			b = append(b, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		default:
+			b = utf8.AppendRune(b, r)
+		}
+	}
+
+	return append(b, '"')
+}
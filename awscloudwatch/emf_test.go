@@ -0,0 +1,131 @@
+package awscloudwatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+var timestamp = time.Date(2017, 7, 23, 3, 36, 0, 123456789, time.UTC)
+
+func TestEMFHandler(t *testing.T) {
+	output := &bytes.Buffer{}
+	handler := NewEMFHandlerWith(EMFConfig{
+		Namespace: "test",
+		Output:    output,
+	})
+
+	handler.HandleMeasures(timestamp,
+		stats.Measure{
+			Name: "request",
+			Fields: []stats.Field{
+				stats.MakeField("count", 5, stats.Counter),
+				stats.MakeField("rtt", 100*time.Millisecond, stats.Histogram),
+				stats.MakeField("nan", math.NaN(), stats.Gauge),
+			},
+			Tags: []stats.Tag{
+				stats.T("empty", ""),
+				stats.T("method", "GET"),
+				stats.T("path", `/"quoted"`),
+			},
+		},
+		stats.Measure{
+			Name:   "skipped",
+			Fields: []stats.Field{stats.MakeField("nan", math.NaN(), stats.Gauge)},
+		},
+	)
+	handler.Flush()
+
+	const expect = `{"_aws":{"Timestamp":1500780960123,"CloudWatchMetrics":[{"Namespace":"test","Dimensions":[["method","path"]],` +
+		`"Metrics":[{"Name":"request.count","Unit":"Count"},{"Name":"request.rtt","Unit":"Seconds"}]}]},` +
+		`"method":"GET","path":"/\"quoted\"","request.count":5,"request.rtt":0.1}` + "\n"
+
+	if s := output.String(); s != expect {
+		t.Errorf("bad output:\n- expected: %s\n- found:    %s", expect, s)
+	}
+
+	if !json.Valid(output.Bytes()) {
+		t.Error("the output is not valid JSON")
+	}
+}
+
+func TestEMFHandlerDimensions(t *testing.T) {
+	output := &bytes.Buffer{}
+	handler := NewEMFHandlerWith(EMFConfig{
+		Output:     output,
+		Dimensions: map[string]string{"service": "Service"},
+	})
+
+	handler.HandleMeasures(timestamp, stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		Tags:   []stats.Tag{stats.T("request_id", "1234"), stats.T("service", "api")},
+	})
+	handler.Flush()
+
+	var doc struct {
+		AWS struct {
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+			}
+		} `json:"_aws"`
+		Service   string
+		RequestID string `json:"request_id"`
+	}
+
+	if err := json.Unmarshal(output.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	directive := doc.AWS.CloudWatchMetrics[0]
+	if directive.Namespace != DefaultNamespace {
+		t.Error("bad namespace:", directive.Namespace)
+	}
+	if len(directive.Dimensions[0]) != 1 || directive.Dimensions[0][0] != "Service" {
+		t.Error("bad dimensions:", directive.Dimensions)
+	}
+	if doc.Service != "api" || len(doc.RequestID) != 0 {
+		t.Errorf("bad dimension values: %+v", doc)
+	}
+}
+
+func TestEMFHandlerSplitsLargeMeasures(t *testing.T) {
+	output := &bytes.Buffer{}
+	handler := NewEMFHandlerWith(EMFConfig{Output: output})
+
+	fields := make([]stats.Field, 150)
+	for i := range fields {
+		fields[i] = stats.MakeField("f"+strconv.Itoa(i), i, stats.Gauge)
+	}
+
+	handler.HandleMeasures(timestamp, stats.Measure{Name: "large", Fields: fields})
+	handler.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatal("expected 2 documents, got", len(lines))
+	}
+
+	for i, n := range []int{100, 50} {
+		var doc struct {
+			AWS struct {
+				CloudWatchMetrics []struct {
+					Metrics []struct{ Name string }
+				}
+			} `json:"_aws"`
+		}
+		if err := json.Unmarshal([]byte(lines[i]), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if found := len(doc.AWS.CloudWatchMetrics[0].Metrics); found != n {
+			t.Errorf("document %d: expected %d metrics, got %d", i, n, found)
+		}
+	}
+}
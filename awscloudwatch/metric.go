@@ -0,0 +1,100 @@
+// Package awscloudwatch implements stats handlers sending metrics to Amazon
+// CloudWatch, either as Embedded Metric Format logs or with PutMetricData
+// calls.
+package awscloudwatch
+
+import (
+	"math"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// maxDimensions is the maximum number of dimensions that CloudWatch accepts
+// on a metric, extra tags are dropped.
+const maxDimensions = 30
+
+// dimension is a CloudWatch dimension, made from a tag.
+type dimension struct {
+	name  string
+	value string
+}
+
+// dimensionMapper maps the tags of measures to CloudWatch dimensions.
+type dimensionMapper map[string]string
+
+// appendDimensions appends the dimensions made from tags to dims. When the
+// mapper is not nil only tags that it contains are kept, under the name they
+// are mapped to. CloudWatch rejects empty dimension values, tags with empty
+// values are skipped.
+func (m dimensionMapper) appendDimensions(dims []dimension, tags []stats.Tag) []dimension {
+	for _, tag := range tags {
+		if len(dims) == maxDimensions {
+			break
+		}
+
+		if len(tag.Value) == 0 {
+			continue
+		}
+
+		name := tag.Name
+		if m != nil {
+			var ok bool
+			if name, ok = m[tag.Name]; !ok {
+				continue
+			}
+		}
+
+		dims = append(dims, dimension{name: name, value: tag.Value})
+	}
+	return dims
+}
+
+// metricName returns the name of the CloudWatch metric of a field.
+func metricName(measure, field string) string {
+	switch {
+	case len(measure) == 0:
+		return field
+	case len(field) == 0:
+		return measure
+	default:
+		return measure + "." + field
+	}
+}
+
+// unitOf returns the CloudWatch unit of a field, durations are reported in
+// seconds.
+func unitOf(f stats.Field) string {
+	switch {
+	case f.Value.Type() == stats.Duration:
+		return "Seconds"
+	case f.Type() == stats.Counter:
+		return "Count"
+	default:
+		return "None"
+	}
+}
+
+// valueOf returns the value of a field as a float, and false if it cannot be
+// sent to CloudWatch, which rejects null, NaN, and infinite values.
+func valueOf(v stats.Value) (float64, bool) {
+	var f float64
+
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			f = 1
+		}
+	case stats.Int:
+		f = float64(v.Int())
+	case stats.Uint:
+		f = float64(v.Uint())
+	case stats.Float:
+		f = v.Float()
+	case stats.Duration:
+		f = v.Duration().Seconds()
+	default:
+		return 0, false
+	}
+
+	return f, !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,120 @@
+package awscloudwatch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials are the AWS credentials used to sign PutMetricData requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// SessionToken is set when using temporary credentials, for example the
+	// credentials of Lambda functions or of assumed roles.
+	SessionToken string
+}
+
+// EnvCredentials returns the credentials set in the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN environment variables, which
+// is where the Lambda runtime exposes the credentials of functions.
+func EnvCredentials() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+const sigv4Algorithm = "AWS4-HMAC-SHA256"
+
+// signRequest signs req with the AWS Signature Version 4 scheme, body must be
+// the payload of the request. All headers set on req when it is signed are
+// part of the signature.
+//
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func signRequest(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(creds.SessionToken) != 0 {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if len(host) == 0 {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	names := []string{"host"}
+
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if _, ok := headers[name]; !ok {
+			names = append(names, name)
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+
+	sort.Strings(names)
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method)
+	canonical.WriteByte('\n')
+	canonical.WriteString(path)
+	canonical.WriteByte('\n')
+	canonical.WriteString(strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"))
+	canonical.WriteByte('\n')
+	for _, name := range names {
+		canonical.WriteString(name)
+		canonical.WriteByte(':')
+		canonical.WriteString(headers[name])
+		canonical.WriteByte('\n')
+	}
+	canonical.WriteByte('\n')
+	canonical.WriteString(signedHeaders)
+	canonical.WriteByte('\n')
+	canonical.WriteString(hashHex(body))
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := sigv4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonical.String()))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", sigv4Algorithm+
+		" Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
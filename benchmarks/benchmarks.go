@@ -0,0 +1,397 @@
+// Package benchmarks runs end-to-end scenarios measuring the cost of producing
+// metrics in a realistic program, so users can size flush intervals, buffers,
+// and sampling rates on their own hardware.
+//
+// The scenario is an HTTP service instrumented by httpstats, which also
+// reports a few application metrics for every request, publishing its metrics
+// to a datadog agent and exposing them to a prometheus scraper. The agent is
+// simulated by a local UDP socket counting the datagrams it receives, and the
+// scraper by periodic calls to the prometheus handler. Requests are served in
+// process, without going through the network, so the report reflects the cost
+// of the instrumentation rather than the cost of the HTTP stack.
+//
+// The cmd/statsbench program runs the scenario from the command line.
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/datadog"
+	"github.com/segmentio/stats/v5/httpstats"
+	"github.com/segmentio/stats/v5/prometheus"
+)
+
+// Scenario is the configuration of a benchmark run, the zero value runs the
+// default scenario.
+type Scenario struct {
+	// Number of requests served per second, defaults to 1000. The report
+	// tells how many requests could not be served at that rate, because they
+	// were delayed by more than 100ms.
+	RPS int
+
+	// Duration of the run, defaults to 10 seconds.
+	Duration time.Duration
+
+	// Number of goroutines serving requests, defaults to GOMAXPROCS.
+	Concurrency int
+
+	// Number of application metrics reported by each request in addition to
+	// the httpstats metrics, defaults to 4.
+	MetricsPerRequest int
+
+	// Number of distinct values of the tag set on application metrics, which
+	// controls the number of series, defaults to 10.
+	Cardinality int
+
+	// Interval at which the engine is flushed, defaults to 1 second.
+	FlushInterval time.Duration
+
+	// Interval at which the prometheus handler is scraped, defaults to 15
+	// seconds.
+	ScrapeInterval time.Duration
+
+	// Sample rate of the engine, see stats.Engine.SampleRate.
+	SampleRate float64
+
+	// Size of the datadog client buffer, see datadog.ClientConfig.BufferSize.
+	BufferSize int
+
+	// DisableDatadog and DisablePrometheus remove the handlers from the
+	// scenario, to measure their cost separately.
+	DisableDatadog    bool
+	DisablePrometheus bool
+}
+
+func (s *Scenario) setDefaults() {
+	if s.RPS <= 0 {
+		s.RPS = 1000
+	}
+	if s.Duration <= 0 {
+		s.Duration = 10 * time.Second
+	}
+	if s.Concurrency <= 0 {
+		s.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if s.MetricsPerRequest <= 0 {
+		s.MetricsPerRequest = 4
+	}
+	if s.Cardinality <= 0 {
+		s.Cardinality = 10
+	}
+	if s.FlushInterval <= 0 {
+		s.FlushInterval = 1 * time.Second
+	}
+	if s.ScrapeInterval <= 0 {
+		s.ScrapeInterval = 15 * time.Second
+	}
+}
+
+// Report carries the results of a benchmark run.
+type Report struct {
+	// The scenario that was run, with defaults applied.
+	Scenario Scenario
+
+	// Wall-clock duration of the run.
+	Elapsed time.Duration
+
+	// Number of requests served, and the number of requests that could not
+	// be served at the configured rate.
+	Requests int64
+	Missed   int64
+
+	// CPU time used by the process during the run, and the utilization that
+	// it represents, where 1 is one core fully used. The CPU time is zero on
+	// platforms where it cannot be measured.
+	CPUTime time.Duration
+	CPU     float64
+
+	// Heap allocations made during the run, per request.
+	AllocsPerRequest float64
+	BytesPerRequest  float64
+
+	// Datagrams and bytes received by the simulated datadog agent.
+	Packets int64
+	Bytes   int64
+
+	// Number of scrapes of the prometheus handler, and the size of the last
+	// response.
+	Scrapes     int
+	ScrapeBytes int
+}
+
+// PacketsPerSecond returns the rate of datagrams sent to the datadog agent.
+func (r *Report) PacketsPerSecond() float64 {
+	return float64(r.Packets) / r.Elapsed.Seconds()
+}
+
+// RequestsPerSecond returns the rate of requests served.
+func (r *Report) RequestsPerSecond() float64 {
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// WriteTo writes a human readable version of the report to w.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	s := &r.Scenario
+	n, err := fmt.Fprintf(w, `scenario:
+  rps:                 %d
+  duration:            %s
+  concurrency:         %d
+  metrics per request: %d
+  cardinality:         %d
+  flush interval:      %s
+  scrape interval:     %s
+  sample rate:         %g
+  buffer size:         %d
+  datadog:             %t
+  prometheus:          %t
+
+results:
+  requests:            %d (%.1f/s, %d missed)
+  cpu:                 %.1f%% (%s)
+  allocs/request:      %.1f (%.0f B)
+  packets:             %d (%.1f/s, %d B)
+  scrapes:             %d (%d B)
+`,
+		s.RPS, s.Duration, s.Concurrency, s.MetricsPerRequest, s.Cardinality,
+		s.FlushInterval, s.ScrapeInterval, s.SampleRate, s.BufferSize,
+		!s.DisableDatadog, !s.DisablePrometheus,
+		r.Requests, r.RequestsPerSecond(), r.Missed,
+		100*r.CPU, r.CPUTime,
+		r.AllocsPerRequest, r.BytesPerRequest,
+		r.Packets, r.PacketsPerSecond(), r.Bytes,
+		r.Scrapes, r.ScrapeBytes,
+	)
+	return int64(n), err
+}
+
+// Run runs the scenario until its duration elapsed or ctx is canceled, and
+// returns the report of the run.
+func Run(ctx context.Context, s Scenario) (*Report, error) {
+	s.setDefaults()
+
+	ctx, cancel := context.WithTimeout(ctx, s.Duration)
+	defer cancel()
+
+	r := &Report{Scenario: s}
+
+	agent, err := listenAgent()
+	if err != nil {
+		return nil, err
+	}
+	defer agent.Close()
+
+	var handlers []stats.Handler
+	var client *datadog.Client
+	var prom *prometheus.Handler
+
+	if !s.DisableDatadog {
+		client = datadog.NewClientWith(datadog.ClientConfig{
+			Address:    agent.addr(),
+			BufferSize: s.BufferSize,
+		})
+		handlers = append(handlers, client)
+	}
+
+	if !s.DisablePrometheus {
+		prom = &prometheus.Handler{}
+		handlers = append(handlers, prom)
+	}
+
+	eng := stats.NewEngine("bench", stats.MultiHandler(handlers...))
+	eng.SampleRate = s.SampleRate
+
+	service := httpstats.NewHandlerWith(eng, newService(eng, s))
+
+	var wg sync.WaitGroup
+	// Requests are considered missed when they are delayed by more than
+	// 100ms, the buffer absorbs the bursts of the pacing ticks.
+	tokens := make(chan struct{}, s.Concurrency+s.RPS/10)
+
+	for i := 0; i < s.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range tokens {
+				serve(service)
+				atomic.AddInt64(&r.Requests, 1)
+			}
+		}()
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	cpuBefore, cpuOK := cpuTime()
+	start := time.Now()
+
+	flushes := eng.StartFlusher(ctx, s.FlushInterval)
+	pace(ctx, s.RPS, tokens, &r.Missed, func() {
+		if prom != nil {
+			r.Scrapes++
+			r.ScrapeBytes = scrape(prom)
+		}
+	}, s.ScrapeInterval)
+
+	close(tokens)
+	wg.Wait()
+	<-flushes
+
+	if client != nil {
+		client.Close()
+	}
+
+	r.Elapsed = time.Since(start)
+	cpuAfter, _ := cpuTime()
+	runtime.ReadMemStats(&after)
+
+	if cpuOK {
+		r.CPUTime = cpuAfter - cpuBefore
+		r.CPU = r.CPUTime.Seconds() / r.Elapsed.Seconds()
+	}
+
+	if r.Requests != 0 {
+		r.AllocsPerRequest = float64(after.Mallocs-before.Mallocs) / float64(r.Requests)
+		r.BytesPerRequest = float64(after.TotalAlloc-before.TotalAlloc) / float64(r.Requests)
+	}
+
+	// Leave time for the last datagrams to reach the agent.
+	time.Sleep(10 * time.Millisecond)
+	r.Packets, r.Bytes = agent.counts()
+	return r, nil
+}
+
+// pace hands tokens to the serving goroutines at the given rate until ctx is
+// canceled, counting the tokens which could not be handed because all the
+// goroutines were busy. The scrape function is called at each interval.
+func pace(ctx context.Context, rps int, tokens chan<- struct{}, missed *int64, scrape func(), interval time.Duration) {
+	const tick = 10 * time.Millisecond
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	scrapes := time.NewTicker(interval)
+	defer scrapes.Stop()
+
+	start := time.Now()
+	sent := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-scrapes.C:
+			scrape()
+		case now := <-ticker.C:
+			due := int(now.Sub(start).Seconds() * float64(rps))
+			for ; sent < due; sent++ {
+				select {
+				case tokens <- struct{}{}:
+				default:
+					*missed++
+				}
+			}
+		}
+	}
+}
+
+// newService returns the handler of the simulated service, which reports the
+// application metrics of the scenario for every request.
+func newService(eng *stats.Engine, s Scenario) http.Handler {
+	tags := make([]stats.Tag, s.Cardinality)
+	for i := range tags {
+		// The values are sliced from a longer string so they don't end at
+		// the end of their allocation, the hash functions used by handlers
+		// would otherwise fail the pointer checks of the race detector.
+		v := fmt.Sprintf("customer-%d ", i)
+		tags[i] = stats.T("customer", v[:len(v)-1])
+	}
+
+	names := make([]string, s.MetricsPerRequest)
+	for i := range names {
+		names[i] = fmt.Sprintf("app.metric_%d", i)
+	}
+
+	var n uint64
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		tag := tags[atomic.AddUint64(&n, 1)%uint64(len(tags))]
+
+		for i, name := range names {
+			if i%2 == 0 {
+				eng.IncrContext(req.Context(), name, tag)
+			} else {
+				eng.ObserveContext(req.Context(), name, time.Since(start), tag)
+			}
+		}
+
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte(`{"status":"ok"}`))
+	})
+}
+
+func serve(h http.Handler) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func scrape(h http.Handler) int {
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return res.Body.Len()
+}
+
+// agent is a UDP socket counting the datagrams it receives.
+type agent struct {
+	conn    net.PacketConn
+	packets int64
+	bytes   int64
+	join    chan struct{}
+}
+
+func listenAgent() (*agent, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	a := &agent{conn: conn, join: make(chan struct{})}
+	go a.run()
+	return a, nil
+}
+
+func (a *agent) addr() string {
+	return a.conn.LocalAddr().String()
+}
+
+func (a *agent) run() {
+	defer close(a.join)
+	b := make([]byte, 65536)
+	for {
+		n, _, err := a.conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		atomic.AddInt64(&a.packets, 1)
+		atomic.AddInt64(&a.bytes, int64(n))
+	}
+}
+
+func (a *agent) counts() (packets, bytes int64) {
+	return atomic.LoadInt64(&a.packets), atomic.LoadInt64(&a.bytes)
+}
+
+func (a *agent) Close() error {
+	err := a.conn.Close()
+	<-a.join
+	return err
+}
@@ -0,0 +1,41 @@
+package benchmarks
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	r, err := Run(context.Background(), Scenario{
+		RPS:            500,
+		Duration:       200 * time.Millisecond,
+		FlushInterval:  50 * time.Millisecond,
+		ScrapeInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Requests == 0 {
+		t.Error("no requests were served")
+	}
+	if r.Packets == 0 || r.Bytes == 0 {
+		t.Errorf("no datagrams were received by the agent: %d packets, %d bytes", r.Packets, r.Bytes)
+	}
+	if r.Scrapes == 0 || r.ScrapeBytes == 0 {
+		t.Errorf("the prometheus handler was not scraped: %d scrapes, %d bytes", r.Scrapes, r.ScrapeBytes)
+	}
+	if r.AllocsPerRequest == 0 {
+		t.Error("no allocations were measured")
+	}
+
+	b := &bytes.Buffer{}
+	r.WriteTo(b)
+
+	if s := b.String(); !strings.Contains(s, "allocs/request:") {
+		t.Errorf("bad report:\n%s", s)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package benchmarks
+
+import "time"
+
+// cpuTime is not supported on this platform.
+func cpuTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,187 @@
+package stats
+
+import (
+	"log"
+	"sync"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+// DefaultMaxSeriesPerMetric is the default limit of series per metric applied
+// by LimitCardinality.
+const DefaultMaxSeriesPerMetric = 1000
+
+// OverflowPolicy defines what LimitCardinality does with the series created
+// after a metric reached its limit.
+type OverflowPolicy int
+
+const (
+	// DropSeries drops the measures of new series. This is the default
+	// policy.
+	DropSeries OverflowPolicy = iota
+
+	// AggregateSeries replaces the tags of new series with a single
+	// overflow="true" tag, so their values are still accounted for in a
+	// single series per metric.
+	AggregateSeries
+
+	// LogSeries forwards the measures of new series, logging a warning the
+	// first time a metric exceeds its limit.
+	LogSeries
+)
+
+// CardinalityLimit carries the configuration of the middleware returned by
+// LimitCardinality.
+type CardinalityLimit struct {
+	// Maximum number of distinct tag combinations per metric, defaults to
+	// DefaultMaxSeriesPerMetric.
+	MaxSeries int
+
+	// Policy applied to the series created after the limit was reached.
+	Policy OverflowPolicy
+}
+
+// OverflowTag is the tag set on series aggregated by the AggregateSeries
+// policy.
+var OverflowTag = T("overflow", "true")
+
+// LimitCardinality returns a middleware tracking the distinct combinations of
+// tags of each metric, and applying the policy of limit to series created past
+// the maximum. A single unbounded tag, like a user ID, otherwise grows the
+// memory of handlers that keep series around, like the prometheus handler.
+//
+// Series are identified by metric name (the measure and field names) and tags,
+// the middleware keeps a hash per series, up to MaxSeries hashes per metric.
+func LimitCardinality(limit CardinalityLimit) HandlerMiddleware {
+	if limit.MaxSeries <= 0 {
+		limit.MaxSeries = DefaultMaxSeriesPerMetric
+	}
+
+	return func(h Handler) Handler {
+		l := &cardinalityLimiter{
+			limit:  limit,
+			series: make(map[string]*seriesSet),
+		}
+		return FilteredHandler(h, l.filter)
+	}
+}
+
+type cardinalityLimiter struct {
+	limit  CardinalityLimit
+	mutex  sync.Mutex
+	series map[string]*seriesSet
+}
+
+type seriesSet struct {
+	hashes   map[uint64]struct{}
+	overflow bool
+}
+
+func (l *cardinalityLimiter) filter(measures []Measure) []Measure {
+	var limited []Measure
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i, m := range measures {
+		kept, overflow, ok := l.limitMeasure(m)
+		if ok {
+			if limited != nil {
+				limited = append(limited, m)
+			}
+			continue
+		}
+
+		if limited == nil {
+			limited = append(make([]Measure, 0, len(measures)), measures[:i]...)
+		}
+
+		if len(kept) != 0 {
+			m.Fields = kept
+			limited = append(limited, m)
+		}
+
+		if len(overflow) != 0 {
+			limited = append(limited, Measure{
+				Name:       m.Name,
+				Fields:     overflow,
+				Tags:       []Tag{OverflowTag},
+				SampleRate: m.SampleRate,
+			})
+		}
+	}
+
+	if limited == nil {
+		return measures
+	}
+	return limited
+}
+
+// limitMeasure returns the fields of m which are forwarded with the tags of m,
+// and the ones aggregated under the overflow tag. The boolean is true when all
+// fields are within their limit and m can be forwarded unchanged.
+func (l *cardinalityLimiter) limitMeasure(m Measure) (kept, overflow []Field, ok bool) {
+	hash := tagsHash(m.Tags)
+	ok = true
+
+	for i, f := range m.Fields {
+		if l.track(m.Name, f.Name, hash) {
+			if !ok {
+				kept = append(kept, f)
+			}
+			continue
+		}
+
+		if ok {
+			kept, ok = append(make([]Field, 0, len(m.Fields)), m.Fields[:i]...), false
+		}
+
+		if l.limit.Policy == AggregateSeries {
+			overflow = append(overflow, f)
+		}
+	}
+
+	return kept, overflow, ok
+}
+
+// track records the series of the metric identified by measure, field, and the
+// tags hash, and reports whether its measures are forwarded unchanged.
+func (l *cardinalityLimiter) track(measure, field string, hash uint64) bool {
+	name := measure + "." + field
+
+	set := l.series[name]
+	if set == nil {
+		set = &seriesSet{hashes: make(map[uint64]struct{})}
+		l.series[Intern(name)] = set
+	}
+
+	if _, ok := set.hashes[hash]; ok {
+		return true
+	}
+
+	if len(set.hashes) < l.limit.MaxSeries {
+		set.hashes[hash] = struct{}{}
+		return true
+	}
+
+	if l.limit.Policy == LogSeries {
+		if !set.overflow {
+			set.overflow = true
+			log.Printf("stats: metric %s exceeded the limit of %d series", name, l.limit.MaxSeries)
+		}
+		return true
+	}
+
+	return false
+}
+
+func tagsHash(tags []Tag) uint64 {
+	h := jody.Init64
+	for _, t := range tags {
+		h = jody.AddString64(h, t.Name)
+		h = jody.AddString64(h, "=")
+		h = jody.AddString64(h, t.Value)
+		h = jody.AddString64(h, ",")
+	}
+	return h
+}
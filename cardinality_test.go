@@ -0,0 +1,72 @@
+package stats_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitCardinality(t *testing.T) {
+	measure := func(user int) stats.Measure {
+		return stats.Measure{
+			Name: "request",
+			Fields: []stats.Field{
+				stats.MakeField("count", 1, stats.Counter),
+			},
+			Tags: []stats.Tag{stats.T("user", fmt.Sprint(user))},
+		}
+	}
+
+	for _, test := range []struct {
+		policy stats.OverflowPolicy
+		tags   [][]stats.Tag
+	}{
+		{
+			policy: stats.DropSeries,
+			tags: [][]stats.Tag{
+				{stats.T("user", "0")},
+				{stats.T("user", "1")},
+				{stats.T("user", "0")},
+			},
+		},
+		{
+			policy: stats.AggregateSeries,
+			tags: [][]stats.Tag{
+				{stats.T("user", "0")},
+				{stats.T("user", "1")},
+				{stats.OverflowTag},
+				{stats.T("user", "0")},
+				{stats.OverflowTag},
+			},
+		},
+		{
+			policy: stats.LogSeries,
+			tags: [][]stats.Tag{
+				{stats.T("user", "0")},
+				{stats.T("user", "1")},
+				{stats.T("user", "2")},
+				{stats.T("user", "0")},
+				{stats.T("user", "3")},
+			},
+		},
+	} {
+		t.Run(fmt.Sprint(test.policy), func(t *testing.T) {
+			h := &statstest.Handler{}
+			l := stats.LimitCardinality(stats.CardinalityLimit{MaxSeries: 2, Policy: test.policy})(h)
+
+			l.HandleMeasures(time.Now(), measure(0), measure(1), measure(2))
+			l.HandleMeasures(time.Now(), measure(0), measure(3))
+
+			var tags [][]stats.Tag
+			for _, m := range h.Measures() {
+				tags = append(tags, m.Tags)
+			}
+			assert.Equal(t, test.tags, tags)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package stats
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // The Clock type can be used to report statistics on durations.
 //
@@ -53,3 +56,36 @@ func (c *Clock) observe(stamp string, d time.Duration) {
 	tags := append(c.tags, Tag{"stamp", stamp})
 	c.eng.Observe(c.name, d, tags...)
 }
+
+// A Span reports the duration of a block of code, tagged with the tags of the
+// context it was started with, see Engine.StartSpan.
+//
+// Like clocks, spans aren't safe to be used concurrently by multiple
+// goroutines.
+type Span struct {
+	ctx   context.Context
+	name  string
+	start time.Time
+	tags  []Tag
+	eng   *Engine
+	done  bool
+}
+
+// Finish reports the time difference between now and the time the span was
+// started at. The tags are added to the ones given to StartSpan.
+//
+// Only the first call to Finish or FinishAt reports a measure, so spans can be
+// finished early on some code paths and by a deferred call on the others.
+func (s *Span) Finish(tags ...Tag) {
+	s.FinishAt(time.Now(), tags...)
+}
+
+// FinishAt reports the time difference between now and the time the span was
+// started at. The tags are added to the ones given to StartSpan.
+func (s *Span) FinishAt(now time.Time, tags ...Tag) {
+	if noop || s.done {
+		return
+	}
+	s.done = true
+	s.eng.measureContext(s.ctx, now, s.name, durationValue(now.Sub(s.start)), Histogram, append(s.tags, tags...)...)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/segmentio/stats/v5/benchmarks"
+)
+
+func main() {
+	var s benchmarks.Scenario
+
+	flag.IntVar(&s.RPS, "rps", 1000, "The number of requests served per second")
+	flag.DurationVar(&s.Duration, "duration", 0, "The duration of the benchmark (default 10s)")
+	flag.IntVar(&s.Concurrency, "concurrency", 0, "The number of goroutines serving requests (default GOMAXPROCS)")
+	flag.IntVar(&s.MetricsPerRequest, "metrics", 0, "The number of application metrics reported by each request (default 4)")
+	flag.IntVar(&s.Cardinality, "cardinality", 0, "The number of distinct values of the tag of application metrics (default 10)")
+	flag.DurationVar(&s.FlushInterval, "flush-interval", 0, "The interval at which the engine is flushed (default 1s)")
+	flag.DurationVar(&s.ScrapeInterval, "scrape-interval", 0, "The interval at which the prometheus handler is scraped (default 15s)")
+	flag.Float64Var(&s.SampleRate, "sample-rate", 0, "The sample rate of the engine (default no sampling)")
+	flag.IntVar(&s.BufferSize, "buffer-size", 0, "The size of the datadog client buffer")
+	flag.BoolVar(&s.DisableDatadog, "no-datadog", false, "Do not publish metrics to datadog")
+	flag.BoolVar(&s.DisablePrometheus, "no-prometheus", false, "Do not expose metrics to prometheus")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	r, err := benchmarks.Run(ctx, s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, _ = r.WriteTo(os.Stdout)
+}
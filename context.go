@@ -8,6 +8,10 @@ import (
 // ContextWithTags returns a new child context with the given tags.  If the
 // parent context already has tags set on it, they are _not_ propagated into
 // the context children.
+//
+// The tags are added to the metrics produced by the methods of Engine which
+// accept a context, like IncrContext or ReportContext, so request-scoped
+// attributes are reported without being passed at every call site.
 func ContextWithTags(ctx context.Context, tags ...Tag) context.Context {
 	// initialize the context reference and return a new context
 	return context.WithValue(ctx, contextKeyReqTags, &tagSlice{
@@ -57,6 +61,13 @@ type tagSlice struct {
 	lock sync.Mutex
 }
 
+func (x *tagSlice) appendTo(tags []Tag) []Tag {
+	x.lock.Lock()
+	tags = append(tags, x.tags...)
+	x.lock.Unlock()
+	return tags
+}
+
 // tagsKey is a value for use with context.WithValue. It's used as
 // a pointer so it fits in an interface{} without allocation. This technique
 // for defining context keys was copied from Go 1.7's new use of context in net/http.
@@ -0,0 +1,217 @@
+package stats
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ControlsConfig carries the configuration of controls created by
+// NewControls.
+type ControlsConfig struct {
+	// VerboseMetrics lists the names of the measures which are only reported
+	// while verbose mode is enabled, with the prefix of the engine producing
+	// them. A trailing '*' matches all the measures with the given prefix,
+	// for example "http.*".
+	VerboseMetrics []string
+
+	// Debug receives a copy of all the measures, including those of verbose
+	// metrics, while debug mode is enabled. For example a handler printing the
+	// measures, or the handler of the debugstats package.
+	Debug Handler
+}
+
+// Controls are settings of the measures reported to a handler which can be
+// changed while the program runs, so operators can turn on verbose metrics or
+// inspect the measures during an incident without a deploy. Controls apply to
+// the handlers wrapped by their middleware:
+//
+//	ctrl := stats.NewControls(stats.ControlsConfig{
+//		VerboseMetrics: []string{"sql.*"},
+//		Debug:          &debugstats.Client{Dst: os.Stderr},
+//	})
+//	stats.Register(stats.Chain(dd, ctrl.Middleware()))
+//	ctrl.ToggleOnSignal(ctx, syscall.SIGUSR2)
+//
+// The debugstats package exposes an endpoint changing the controls over HTTP.
+//
+// Controls are safe to use concurrently from multiple goroutines.
+type Controls struct {
+	verboseNames []string
+	debugHandler Handler
+
+	verbose    atomic.Bool
+	debug      atomic.Bool
+	sampleRate atomic.Uint64 // bits of the float64 rate
+}
+
+// NewControls returns controls configured by config, with verbose and debug
+// modes disabled and no sampling.
+func NewControls(config ControlsConfig) *Controls {
+	return &Controls{
+		verboseNames: append([]string(nil), config.VerboseMetrics...),
+		debugHandler: config.Debug,
+	}
+}
+
+// Verbose returns true if verbose mode is enabled.
+func (c *Controls) Verbose() bool { return c.verbose.Load() }
+
+// SetVerbose enables or disables verbose mode, reporting the measures listed
+// in ControlsConfig.VerboseMetrics.
+func (c *Controls) SetVerbose(enabled bool) { c.verbose.Store(enabled) }
+
+// Debug returns true if debug mode is enabled.
+func (c *Controls) Debug() bool { return c.debug.Load() }
+
+// SetDebug enables or disables debug mode, copying the measures to the handler
+// set in ControlsConfig.Debug.
+func (c *Controls) SetDebug(enabled bool) { c.debug.Store(enabled) }
+
+// SampleRate returns the sample rate set by SetSampleRate, zero means that
+// measures are not sampled by the controls.
+func (c *Controls) SampleRate() float64 {
+	return math.Float64frombits(c.sampleRate.Load())
+}
+
+// SetSampleRate sets the fraction of measures passed to the handler, values
+// outside of the (0, 1) range disable sampling, which is the default.
+//
+// The sampling applies on top of the sampling of engines, so it can shed the
+// load of a handler overwhelmed by measures, but not report more measures
+// than engines do. The values of sampled counters are divided by the rate,
+// like engines do.
+func (c *Controls) SetSampleRate(rate float64) {
+	if !sampling(rate) {
+		rate = 0
+	}
+	c.sampleRate.Store(math.Float64bits(rate))
+}
+
+// ToggleOnSignal starts a goroutine which toggles verbose and debug modes each
+// time the program receives one of the given signals, until ctx is canceled.
+// The modes are toggled together, from the state of the verbose mode.
+func (c *Controls) ToggleOnSignal(ctx context.Context, sig ...os.Signal) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig...)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-signals:
+				enabled := !c.Verbose()
+				c.SetVerbose(enabled)
+				c.SetDebug(enabled)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Middleware returns a middleware applying the controls to the measures of
+// the handler it wraps.
+func (c *Controls) Middleware() HandlerMiddleware {
+	return func(h Handler) Handler {
+		return &controlledHandler{handler: h, controls: c}
+	}
+}
+
+type controlledHandler struct {
+	handler  Handler
+	controls *Controls
+}
+
+func (h *controlledHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	c := h.controls
+
+	if c.debugHandler != nil && c.Debug() {
+		c.debugHandler.HandleMeasures(t, measures...)
+	}
+
+	if measures = c.filter(measures); len(measures) != 0 {
+		h.handler.HandleMeasures(t, measures...)
+	}
+}
+
+func (h *controlledHandler) Flush() {
+	if c := h.controls; c.debugHandler != nil && c.Debug() {
+		flush(c.debugHandler)
+	}
+	flush(h.handler)
+}
+
+// filter drops the measures of verbose metrics unless verbose mode is enabled,
+// and samples the others. The measures are copied when some are dropped or
+// modified, since they are owned by the caller.
+func (c *Controls) filter(measures []Measure) []Measure {
+	verbose := len(c.verboseNames) == 0 || c.Verbose()
+	rate := c.SampleRate()
+
+	if verbose && !sampling(rate) {
+		return measures
+	}
+
+	var filtered []Measure
+
+	for i, m := range measures {
+		keep := verbose || !c.isVerbose(m.Name)
+		if keep && sampling(rate) {
+			keep = rand.Float64() < rate
+		}
+
+		if keep {
+			if sampling(rate) {
+				m = sampleMeasure(m, rate)
+				if filtered == nil {
+					filtered = make([]Measure, 0, len(measures))
+				}
+			}
+			if filtered != nil {
+				filtered = append(filtered, m)
+			}
+		} else if filtered == nil {
+			filtered = append(make([]Measure, 0, len(measures)), measures[:i]...)
+		}
+	}
+
+	if filtered == nil {
+		return measures
+	}
+	return filtered
+}
+
+func (c *Controls) isVerbose(name string) bool {
+	for _, pattern := range c.verboseNames {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleMeasure returns a copy of m sampled at rate, in addition to the
+// sampling of the engine which produced it.
+func sampleMeasure(m Measure, rate float64) Measure {
+	s := m
+	s.Fields = copyFields(m.Fields)
+	scaleCounters([]Measure{s}, rate)
+
+	if sampling(m.SampleRate) {
+		s.SampleRate = m.SampleRate * rate
+	} else {
+		s.SampleRate = rate
+	}
+	return s
+}
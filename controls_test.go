@@ -0,0 +1,81 @@
+package stats_test
+
+import (
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestControls(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	d := &statstest.Handler{}
+	c := stats.NewControls(stats.ControlsConfig{
+		VerboseMetrics: []string{"sql.*", "cache"},
+		Debug:          d,
+	})
+	e := stats.NewEngine("", stats.Chain(h, c.Middleware()))
+
+	report := func() {
+		e.Incr("requests.count")
+		e.Incr("sql.queries.count")
+		e.Incr("cache.hits")
+	}
+
+	report()
+	if n := len(h.Measures()); n != 1 {
+		t.Errorf("verbose metrics were reported while verbose mode was disabled: %d measures", n)
+	}
+	if n := len(d.Measures()); n != 0 {
+		t.Errorf("measures were copied while debug mode was disabled: %d measures", n)
+	}
+
+	h.Clear()
+	c.SetVerbose(true)
+	c.SetDebug(true)
+	report()
+	if n := len(h.Measures()); n != 3 {
+		t.Errorf("bad number of measures in verbose mode: %d", n)
+	}
+	if n := len(d.Measures()); n != 3 {
+		t.Errorf("bad number of measures copied in debug mode: %d", n)
+	}
+}
+
+func TestControlsSampleRate(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	c := stats.NewControls(stats.ControlsConfig{})
+	e := stats.NewEngine("", stats.Chain(h, c.Middleware()))
+
+	c.SetSampleRate(0.25)
+	if rate := c.SampleRate(); rate != 0.25 {
+		t.Fatal("bad sample rate:", rate)
+	}
+
+	for i := 0; i != 1000; i++ {
+		e.Incr("calls")
+	}
+
+	measures := h.Measures()
+	if len(measures) == 0 || len(measures) > 500 {
+		t.Fatalf("bad number of sampled measures: %d", len(measures))
+	}
+	for _, m := range measures {
+		if m.SampleRate != 0.25 || m.Fields[0].Value.Float() != 4 {
+			t.Fatalf("bad sampled measure: %v", m)
+		}
+	}
+
+	c.SetSampleRate(1)
+	if rate := c.SampleRate(); rate != 0 {
+		t.Error("sampling was not disabled:", rate)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package stats_test
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestControlsToggleOnSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := stats.NewControls(stats.ControlsConfig{})
+	c.ToggleOnSignal(ctx, syscall.SIGUSR2)
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); !c.Verbose() || !c.Debug(); {
+		if time.Now().After(deadline) {
+			t.Fatal("the controls were not toggled by the signal")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
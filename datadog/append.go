@@ -29,6 +29,11 @@ func appendMetric(b []byte, m Metric) []byte {
 		b = appendTags(b, m.Tags)
 	}
 
+	if !m.Time.IsZero() {
+		b = append(b, '|', 'T')
+		b = strconv.AppendInt(b, m.Time.Unix(), 10)
+	}
+
 	return append(b, '\n')
 }
 
@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/sys/unix"
@@ -22,6 +23,11 @@ const (
 	// datadog.
 	DefaultBufferSize = 1024
 
+	// DefaultUDSBufferSize is the default size for batches of metrics sent to
+	// datadog over unix sockets, which are not subject to the MTU of network
+	// interfaces. It matches the default max payload size of the agent.
+	DefaultUDSBufferSize = 8192
+
 	// MaxBufferSize is a hard-limit on the max size of the datagram buffer.
 	MaxBufferSize = 65507
 )
@@ -43,12 +49,46 @@ var (
 type ClientConfig struct {
 	// Address of the datadog database to send metrics to.
 	// UDP: host:port (default)
-	// UDS: unixgram://dir/file.ext
+	// UDS: unix:///dir/file.ext or unixgram:///dir/file.ext
+	// UDS in stream mode: unixstream:///dir/file.ext
 	Address string
 
-	// Maximum size of batch of events sent to datadog.
+	// Addresses lists multiple dogstatsd endpoints to spread the metrics
+	// across, for programs producing more metrics than a single agent can
+	// handle. When set, Address is ignored. Metrics are spread according to
+	// Balancing.
+	Addresses []string
+
+	// Balancing is the strategy used to spread metrics across Addresses, the
+	// default is BalanceByName.
+	Balancing Balancing
+
+	// Maximum size of batch of events sent to datadog, which is the maximum
+	// size of the datagrams. The default is DefaultBufferSize, or
+	// DefaultUDSBufferSize when sending to a unix socket.
 	BufferSize int
 
+	// FlushInterval is the interval at which the client flushes batches of
+	// metrics that were not filled yet. By default batches are only sent
+	// when they are full or when the client is flushed, which may delay
+	// metrics for a long time in programs that produce few of them.
+	FlushInterval time.Duration
+
+	// UDSWriteTimeout is how long writes to a unix socket wait for the agent
+	// to make room in the socket buffer before the datagram is dropped. The
+	// default is 1ms, it is ignored when UDSBlocking is true.
+	UDSWriteTimeout time.Duration
+
+	// UDSBlocking makes writes to a unix socket wait until the agent makes
+	// room in the socket buffer instead of dropping datagrams, trading the
+	// latency of the program for the delivery of all metrics.
+	UDSBlocking bool
+
+	// UDSReconnectBufferSize is the maximum size of the metrics buffered while
+	// reconnecting to an agent listening on a unix stream socket, metrics are
+	// dropped when it is full. The default is 1 MiB.
+	UDSReconnectBufferSize int
+
 	// List of tags to filter. If left nil is set to DefaultFilters.
 	Filters []string
 
@@ -59,6 +99,49 @@ type ClientConfig struct {
 	// UseDistributions True indicates to send histograms with `d` type instead of `h` type
 	// https://docs.datadoghq.com/developers/dogstatsd/datagram_shell?tab=metrics#the-dogstatsd-protocol
 	UseDistributions bool
+
+	// TagTemplate enables a compatibility mode for StatsD servers which do not
+	// support tags, like plain statsd or Graphite bridges. When set, the tags
+	// are folded into the metric names according to the template (see
+	// DefaultTagTemplate) and the tag section of the datagrams is omitted.
+	// Placeholders are {name}, {tags} and {<tag>} for the value of a specific
+	// tag, for example "{env}.{name}.{tags}".
+	TagTemplate string
+
+	// ContainerID is sent with the metrics so the agent attaches the tags
+	// of the container that produced them. By default it is read from the
+	// cgroup of the process, unless DisableOriginDetection is set or the
+	// DD_ORIGIN_DETECTION_ENABLED environment variable is false.
+	//
+	// The DD_ENTITY_ID and DD_EXTERNAL_ENV environment variables, injected
+	// by the admission controller of the agent, are also sent with the
+	// metrics when they are set.
+	ContainerID string
+
+	// DisableOriginDetection disables reading the container ID from the
+	// cgroup of the process.
+	DisableOriginDetection bool
+
+	// TimestampThreshold enables the timestamp extension of the protocol,
+	// supported by agents 7.40 and above. Counters and gauges reported with
+	// a time older than the threshold, like those backfilled with the AddAt
+	// and SetAt methods of stats.Engine, are sent with their time instead of
+	// being stamped by the agent when it receives them. Timestamped metrics
+	// are not aggregated by the agent. Timestamps are never sent when it is
+	// zero.
+	TimestampThreshold time.Duration
+
+	// Debug receives a copy of every datagram sent by the client, to
+	// troubleshoot metrics which do not show up in datadog without capturing
+	// the network traffic. The lines of the datagrams are parsed back, and
+	// those which the agent would drop are reported in "# invalid:" comments
+	// following the datagram, as are the errors of writes.
+	Debug io.Writer
+
+	// DebugPackets is the number of datagrams retained by the client and
+	// returned by LastPackets, for example to expose them on a debug endpoint.
+	// No datagrams are retained when it is zero.
+	DebugPackets int
 }
 
 // Client represents an datadog client that implements the stats.Handler
@@ -67,6 +150,11 @@ type Client struct {
 	serializer
 	err    error
 	buffer stats.Buffer
+	debug  *debugWriter
+
+	once sync.Once
+	stop chan struct{}
+	join chan struct{}
 }
 
 // NewClient creates and returns a new datadog client publishing metrics to the
@@ -85,7 +173,19 @@ func NewClientWith(config ClientConfig) *Client {
 	}
 
 	if config.BufferSize == 0 {
-		config.BufferSize = DefaultBufferSize
+		if allUDSAddresses(config) {
+			config.BufferSize = DefaultUDSBufferSize
+		} else {
+			config.BufferSize = DefaultBufferSize
+		}
+	}
+
+	if config.UDSWriteTimeout == 0 {
+		config.UDSWriteTimeout = defaultUDSTimeout
+	}
+
+	if config.UDSBlocking {
+		config.UDSWriteTimeout = 0
 	}
 
 	if config.Filters == nil {
@@ -107,16 +207,39 @@ func NewClientWith(config ClientConfig) *Client {
 			filters:          filterMap,
 			distPrefixes:     config.DistributionPrefixes,
 			useDistributions: config.UseDistributions,
+			origin:           detectOrigin(config.ContainerID, config.DisableOriginDetection),
+
+			timestampThreshold: config.TimestampThreshold,
 		},
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	if len(config.TagTemplate) != 0 {
+		c.serializer.tagTemplate = parseTagTemplate(config.TagTemplate)
 	}
 
-	w, err := newWriter(config.Address)
+	var w ddWriter
+	var err error
+
+	if len(config.Addresses) != 0 {
+		w, err = newMultiWriter(config.Addresses, config.Balancing, func(addr string) (ddWriter, error) {
+			return newWriter(addr, config)
+		})
+	} else {
+		w, err = newWriter(config.Address, config)
+	}
 	if err != nil {
 		log.Printf("stats/datadog: %s", err)
 		c.err = err
 		w = &noopWriter{}
 	}
 
+	if config.Debug != nil || config.DebugPackets > 0 {
+		c.debug = newDebugWriter(w, config.Debug, config.DebugPackets)
+		w = c.debug
+	}
+
 	newBufSize, err := w.CalcBufferSize(config.BufferSize)
 	if err != nil {
 		log.Printf("stats/datadog: unable to calc writer's buffer size. Defaulting to a buffer of size %d - %v\n", DefaultBufferSize, err)
@@ -128,9 +251,32 @@ func NewClientWith(config ClientConfig) *Client {
 	c.buffer.BufferSize = newBufSize
 	c.serializer.conn = w
 	log.Printf("stats/datadog: sending metrics with a buffer of size %d B", newBufSize)
+
+	if config.FlushInterval > 0 {
+		go c.run(config.FlushInterval)
+	} else {
+		close(c.join)
+	}
+
 	return c
 }
 
+func (c *Client) run(interval time.Duration) {
+	defer close(c.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
 // HandleMeasures satisfies the stats.Handler interface.
 func (c *Client) HandleMeasures(time time.Time, measures ...stats.Measure) {
 	c.buffer.HandleMeasures(time, measures...)
@@ -141,6 +287,25 @@ func (c *Client) Flush() {
 	c.buffer.Flush()
 }
 
+// SendEvent sends e to datadog, bypassing the buffer of metrics. The priority
+// and alert type of the event default to normal and info.
+func (c *Client) SendEvent(e Event) error {
+	if len(e.Priority) == 0 {
+		e.Priority = EventPriorityNormal
+	}
+	if len(e.AlertType) == 0 {
+		e.AlertType = EventAlertTypeInfo
+	}
+	_, err := c.Write(appendEvent(nil, e))
+	return err
+}
+
+// SendServiceCheck sends sc to datadog, bypassing the buffer of metrics.
+func (c *Client) SendServiceCheck(sc ServiceCheck) error {
+	_, err := c.Write(appendServiceCheck(nil, sc))
+	return err
+}
+
 // Write satisfies the io.Writer interface.
 func (c *Client) Write(b []byte) (int, error) {
 	return c.serializer.Write(b)
@@ -148,6 +313,10 @@ func (c *Client) Write(b []byte) (int, error) {
 
 // Close flushes and closes the client, satisfies the io.Closer interface.
 func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.join
+	})
 	c.Flush()
 	c.close()
 	return c.err
@@ -205,16 +374,39 @@ type ddWriter interface {
 	CalcBufferSize(desiredBufSize int) (int, error)
 }
 
-func newWriter(addr string) (ddWriter, error) {
-	if strings.HasPrefix(addr, "unixgram://") ||
+// isUDSAddress returns true if addr is the address of a unix socket.
+func isUDSAddress(addr string) bool {
+	return strings.HasPrefix(addr, "unixgram://") ||
+		strings.HasPrefix(addr, "unixstream://") ||
+		strings.HasPrefix(addr, "unix://")
+}
+
+func allUDSAddresses(config ClientConfig) bool {
+	if len(config.Addresses) == 0 {
+		return isUDSAddress(config.Address)
+	}
+	for _, addr := range config.Addresses {
+		if !isUDSAddress(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func newWriter(addr string, config ClientConfig) (ddWriter, error) {
+	if isUDSAddress(addr) ||
 		strings.HasPrefix(addr, "udp://") {
 		u, err := url.Parse(addr)
 		if err != nil {
 			return nil, err
 		}
 		switch u.Scheme {
-		case "unixgram":
-			return newUDSWriter(u.Path)
+		case "unixgram", "unix":
+			// The agent only listens for datagrams, both schemes are
+			// accepted since unix:// is what DD_DOGSTATSD_URL uses.
+			return newUDSWriter(u.Path, config.UDSWriteTimeout)
+		case "unixstream":
+			return newUDSStreamWriter(u.Path, config.UDSWriteTimeout, config.UDSReconnectBufferSize)
 		case "udp":
 			return newUDPWriter(u.Path)
 		}
@@ -0,0 +1,158 @@
+package datadog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Packet is a datagram sent by a client, retained when it was configured
+// with DebugPackets.
+type Packet struct {
+	// Time at which the datagram was sent.
+	Time time.Time
+
+	// Data is the content of the datagram.
+	Data []byte
+
+	// Invalid lists the errors of the lines of the datagram which could not
+	// be parsed back, those are the lines that the agent drops.
+	Invalid []error
+
+	// Err is the error returned when writing the datagram, if any.
+	Err error
+}
+
+// LastPackets returns the datagrams retained by the client, from the oldest to
+// the newest. It returns nil if the client was not configured with
+// DebugPackets.
+func (c *Client) LastPackets() []Packet {
+	if c.debug == nil {
+		return nil
+	}
+	return c.debug.packets()
+}
+
+// debugWriter is a ddWriter decorator which copies the datagrams it writes to
+// an io.Writer and retains the last ones, after validating them.
+type debugWriter struct {
+	ddWriter
+	out io.Writer
+
+	mutex sync.Mutex
+	ring  []Packet
+	next  int
+	full  bool
+}
+
+func newDebugWriter(w ddWriter, out io.Writer, packets int) *debugWriter {
+	d := &debugWriter{ddWriter: w, out: out}
+	if packets > 0 {
+		d.ring = make([]Packet, packets)
+	}
+	return d
+}
+
+func (d *debugWriter) Write(b []byte) (int, error) {
+	n, err := d.ddWriter.Write(b)
+	if len(b) == 0 {
+		return n, err
+	}
+
+	p := Packet{
+		Time:    time.Now(),
+		Data:    append([]byte(nil), b...),
+		Invalid: validatePacket(b),
+		Err:     err,
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.out != nil {
+		_, _ = d.out.Write(appendDebugPacket(nil, p))
+	}
+
+	if len(d.ring) != 0 {
+		d.ring[d.next] = p
+		d.next = (d.next + 1) % len(d.ring)
+		d.full = d.full || d.next == 0
+	}
+
+	return n, err
+}
+
+func (d *debugWriter) packets() []Packet {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.full {
+		return append([]Packet(nil), d.ring[:d.next]...)
+	}
+	packets := make([]Packet, 0, len(d.ring))
+	packets = append(packets, d.ring[d.next:]...)
+	return append(packets, d.ring[:d.next]...)
+}
+
+// appendDebugPacket appends the content of p, followed by comment lines
+// describing its errors, which are not valid in the dogstatsd protocol so they
+// stand out in the output.
+func appendDebugPacket(b []byte, p Packet) []byte {
+	b = append(b, p.Data...)
+	if len(p.Data) != 0 && p.Data[len(p.Data)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	for _, err := range p.Invalid {
+		b = fmt.Appendf(b, "# invalid: %s\n", err)
+	}
+	if p.Err != nil {
+		b = fmt.Appendf(b, "# write error: %s\n", p.Err)
+	}
+	return b
+}
+
+// validatePacket parses back the lines of a datagram and returns the errors
+// of those which are not valid metrics or events.
+func validatePacket(b []byte) []error {
+	var errs []error
+
+	for len(b) != 0 {
+		var ln []byte
+
+		if i := bytes.IndexByte(b, '\n'); i < 0 {
+			ln, b = b, nil
+		} else {
+			ln, b = b[:i], b[i+1:]
+		}
+
+		var err error
+
+		switch {
+		case len(ln) == 0, bytes.HasPrefix(ln, []byte("_sc|")):
+			// Service checks are not parsed by this package.
+		case bytes.HasPrefix(ln, []byte("_e")):
+			_, err = parseEvent(string(ln))
+		default:
+			var m Metric
+			if m, err = parseMetric(string(ln)); err == nil {
+				err = validateMetricType(string(ln), m.Type)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func validateMetricType(s string, t MetricType) error {
+	switch t {
+	case Counter, Gauge, Histogram, Distribution, "s", "ms":
+		return nil
+	}
+	return fmt.Errorf("datadog: %#v has an unknown metric type", s)
+}
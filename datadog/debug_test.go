@@ -0,0 +1,73 @@
+package datadog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestClientDebug(t *testing.T) {
+	packets := make(chan []byte, 10)
+	addr, closer := startUDPListener(t, packets)
+	defer closer.Close()
+
+	out := &bytes.Buffer{}
+	client := NewClientWith(ClientConfig{
+		Address:                addr,
+		Debug:                  out,
+		DebugPackets:           2,
+		DisableOriginDetection: true,
+	})
+
+	for i := 0; i != 3; i++ {
+		client.HandleMeasures(time.Time{}, stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("count", i, stats.Counter)},
+		})
+		client.Flush()
+	}
+
+	if _, err := client.Write([]byte("request.count:abc|c\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Error(err)
+	}
+
+	last := client.LastPackets()
+	if len(last) != 2 {
+		t.Fatalf("bad number of packets: %d", len(last))
+	}
+	if s := string(last[0].Data); s != "request.count:2|c\n" {
+		t.Errorf("bad packet data: %q", s)
+	}
+	if len(last[0].Invalid) != 0 {
+		t.Errorf("unexpected invalid lines: %v", last[0].Invalid)
+	}
+	if len(last[1].Invalid) != 1 {
+		t.Errorf("bad number of invalid lines: %v", last[1].Invalid)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expect := []string{
+		"request.count:0|c",
+		"request.count:1|c",
+		"request.count:2|c",
+		"request.count:abc|c",
+		`# invalid: datadog: "request.count:abc|c" has a malformed value`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("bad debug output:\n%s", out.String())
+	}
+}
+
+func TestValidatePacket(t *testing.T) {
+	errs := validatePacket([]byte("a:1|c\n_e{1,1}:a|b\n_sc|check|0\nb:1|x\nc|c\n"))
+	if len(errs) != 2 {
+		t.Errorf("bad errors: %v", errs)
+	}
+}
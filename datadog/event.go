@@ -54,3 +54,47 @@ func (e Event) Format(f fmt.State, _ rune) {
 	_, _ = f.Write(buf.b)
 	bufferPool.Put(buf)
 }
+
+// SendEvent sends e to the datadog clients set as handlers of the default
+// engine.
+func SendEvent(e Event) error {
+	return SendEventWith(stats.DefaultEngine, e)
+}
+
+// SendEventWith sends e to the datadog clients set as handlers of eng, so
+// events like deploy markers are sent over the same connections as the
+// metrics. The tags of eng are added to those of the event.
+func SendEventWith(eng *stats.Engine, e Event) error {
+	e.Tags = engineTags(eng, e.Tags)
+	return sendWith(eng, func(c *Client) error { return c.SendEvent(e) })
+}
+
+// sendWith calls send with each datadog client set as handler of eng, and
+// returns the first error.
+func sendWith(eng *stats.Engine, send func(*Client) error) error {
+	var err error
+	forEachClient(eng.Handler, func(c *Client) {
+		if e := send(c); e != nil && err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+func forEachClient(h stats.Handler, f func(*Client)) {
+	switch x := h.(type) {
+	case *Client:
+		f(x)
+	case interface{ Handlers() []stats.Handler }:
+		for _, h := range x.Handlers() {
+			forEachClient(h, f)
+		}
+	}
+}
+
+func engineTags(eng *stats.Engine, tags []stats.Tag) []stats.Tag {
+	if len(eng.Tags) == 0 {
+		return tags
+	}
+	return append(append(make([]stats.Tag, 0, len(eng.Tags)+len(tags)), eng.Tags...), tags...)
+}
@@ -0,0 +1,137 @@
+package datadog
+
+import (
+	"strings"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// DefaultTagTemplate is a tag template folding all tags after the metric name,
+// for example "http.requests.count.method.GET.status.200".
+const DefaultTagTemplate = "{name}.{tags}"
+
+// tagTemplate is the parsed form of the TagTemplate option of ClientConfig.
+//
+// Templates are made of literal text and placeholders enclosed in braces:
+//
+//	{name}   the metric name
+//	{tags}   the remaining tags, as "<tag>.<value>" segments separated by '.'
+//	{<tag>}  the value of the tag named <tag>, or "none" if the measure does
+//	         not carry it; tags referenced this way are excluded from {tags}
+//
+// For example "{env}.{name}.{tags}" produces "prod.http.requests.count.method.GET"
+// for a measure tagged with env=prod and method=GET.
+type tagTemplate struct {
+	segments []templateSegment
+	named    map[string]struct{}
+}
+
+type templateSegment struct {
+	text        string
+	placeholder bool
+}
+
+func parseTagTemplate(s string) *tagTemplate {
+	t := &tagTemplate{named: make(map[string]struct{})}
+
+	for len(s) != 0 {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			t.segments = append(t.segments, templateSegment{text: s})
+			break
+		}
+
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			t.segments = append(t.segments, templateSegment{text: s})
+			break
+		}
+
+		if i != 0 {
+			t.segments = append(t.segments, templateSegment{text: s[:i]})
+		}
+
+		name := s[i+1 : i+j]
+		t.segments = append(t.segments, templateSegment{text: name, placeholder: true})
+
+		if name != "name" && name != "tags" {
+			t.named[name] = struct{}{}
+		}
+
+		s = s[i+j+1:]
+	}
+
+	return t
+}
+
+// appendName appends to b the name of field in m with the measure tags folded
+// in, tags listed in filters are ignored.
+func (t *tagTemplate) appendName(b []byte, m stats.Measure, field stats.Field, filters map[string]struct{}) []byte {
+	start := len(b)
+
+	for _, seg := range t.segments {
+		if !seg.placeholder {
+			b = append(b, seg.text...)
+			continue
+		}
+
+		switch seg.text {
+		case "name":
+			b = appendSanitizedLineName(b, start, m.Name)
+			if len(field.Name) != 0 {
+				b = append(b, '.')
+				b = appendSanitizedLineName(b, start, field.Name)
+			}
+
+		case "tags":
+			n := 0
+			for _, tag := range m.Tags {
+				if _, skip := filters[tag.Name]; skip {
+					continue
+				}
+				if _, skip := t.named[tag.Name]; skip {
+					continue
+				}
+				if n != 0 {
+					b = append(b, '.')
+				}
+				b = appendSanitizedLineName(b, start, tag.Name)
+				b = append(b, '.')
+				b = appendSanitizedLineName(b, start, tag.Value)
+				n++
+			}
+
+		default:
+			value := "none"
+			for _, tag := range m.Tags {
+				if tag.Name == seg.text {
+					value = tag.Value
+					break
+				}
+			}
+			b = appendSanitizedLineName(b, start, value)
+		}
+	}
+
+	return compactDots(b, start)
+}
+
+// compactDots removes the empty segments of the dot-separated name starting at
+// b[start:], which appear when placeholders expand to nothing.
+func compactDots(b []byte, start int) []byte {
+	n := start
+
+	for i := start; i < len(b); i++ {
+		if b[i] == '.' && (n == start || b[n-1] == '.') {
+			continue
+		}
+		b[n] = b[i]
+		n++
+	}
+
+	if n > start && b[n-1] == '.' {
+		n--
+	}
+
+	return b[:n]
+}
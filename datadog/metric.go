@@ -3,6 +3,7 @@ package datadog
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	stats "github.com/segmentio/stats/v5"
 )
@@ -28,6 +29,7 @@ type Metric struct {
 	Value     float64     // the metric value
 	Rate      float64     // sample rate, a value between 0 and 1
 	Tags      []stats.Tag // the list of tags set on the metric
+	Time      time.Time   // the timestamp sent with the metric, if any
 }
 
 // String satisfies the fmt.Stringer interface.
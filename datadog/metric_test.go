@@ -2,6 +2,7 @@ package datadog
 
 import (
 	"testing"
+	"time"
 
 	stats "github.com/segmentio/stats/v5"
 )
@@ -35,6 +36,18 @@ var testMetrics = []struct {
 		},
 	},
 
+	{
+		s: "test.metric.backfill:3|g|#hello:world|T1700000000\n",
+		m: Metric{
+			Type:  Gauge,
+			Name:  "test.metric.backfill",
+			Tags:  []stats.Tag{stats.T("hello", "world")},
+			Value: 3,
+			Rate:  1,
+			Time:  time.Unix(1700000000, 0),
+		},
+	},
+
 	{
 		s: "test.metric.large:1.234|c|@0.1|#hello:world,hello:world,hello:world,hello:world,hello:world,hello:world,hello:world,hello:world,hello:world,hello:world\n",
 		m: Metric{
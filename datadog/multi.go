@@ -0,0 +1,143 @@
+package datadog
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+// Balancing is an enumeration of the strategies used by clients configured
+// with multiple addresses to spread metrics across dogstatsd endpoints.
+type Balancing int
+
+const (
+	// BalanceByName sends all metrics with the same name to the same
+	// endpoint, using a consistent hash of the names so only a fraction of
+	// the metrics move when endpoints are added or removed. Agents aggregate
+	// the metrics they receive, which stays accurate with this strategy.
+	BalanceByName Balancing = iota
+
+	// BalanceRoundRobin sends each batch of metrics to the next endpoint,
+	// which spreads the load evenly but splits the series of a metric across
+	// agents.
+	BalanceRoundRobin
+)
+
+// multiWriter spreads the datagrams of a client across multiple writers.
+type multiWriter struct {
+	writers   []ddWriter
+	balancing Balancing
+	next      uint64
+	batches   sync.Pool
+}
+
+func newMultiWriter(addrs []string, balancing Balancing, newWriter func(string) (ddWriter, error)) (*multiWriter, error) {
+	w := &multiWriter{
+		writers:   make([]ddWriter, 0, len(addrs)),
+		balancing: balancing,
+	}
+
+	for _, addr := range addrs {
+		ww, err := newWriter(addr)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		w.writers = append(w.writers, ww)
+	}
+
+	n := len(w.writers)
+	w.batches.New = func() interface{} { return make([][]byte, n) }
+	return w, nil
+}
+
+func (w *multiWriter) Write(data []byte) (int, error) {
+	if w.balancing == BalanceRoundRobin {
+		i := atomic.AddUint64(&w.next, 1) % uint64(len(w.writers))
+		return w.writers[i].Write(data)
+	}
+
+	// Datagrams contain multiple lines, each of them is routed according to
+	// the hash of the metric name.
+	batches := w.batches.Get().([][]byte)
+
+	for s := data; len(s) != 0; {
+		i := bytes.IndexByte(s, '\n')
+		if i < 0 {
+			i = len(s)
+		} else {
+			i++
+		}
+		line := s[:i]
+		s = s[i:]
+
+		j := jumpHash(jody.HashBytes64(metricNameOf(line)), len(w.writers))
+		batches[j] = append(batches[j], line...)
+	}
+
+	var err error
+	for i, b := range batches {
+		if len(b) != 0 {
+			if _, e := w.writers[i].Write(b); e != nil && err == nil {
+				err = e
+			}
+			batches[i] = b[:0]
+		}
+	}
+
+	w.batches.Put(batches)
+
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *multiWriter) Close() error {
+	var err error
+	for _, ww := range w.writers {
+		if e := ww.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// CalcBufferSize returns the smallest buffer size of all writers, so batches
+// fit in the datagrams of any endpoint.
+func (w *multiWriter) CalcBufferSize(sizehint int) (int, error) {
+	size := sizehint
+	for _, ww := range w.writers {
+		n, err := ww.CalcBufferSize(sizehint)
+		if err != nil {
+			return 0, err
+		}
+		if n < size {
+			size = n
+		}
+	}
+	return size, nil
+}
+
+// metricNameOf returns the name of the metric in a line of the dogstatsd
+// protocol, or the line itself for events and service checks.
+func metricNameOf(line []byte) []byte {
+	if i := bytes.IndexByte(line, ':'); i >= 0 && !bytes.HasPrefix(line, []byte("_e{")) {
+		return line[:i]
+	}
+	return line
+}
+
+// jumpHash maps key to one of n buckets using the jump consistent hash from
+// "A Fast, Minimal Memory, Consistent Hash Algorithm" by Lamping and Veach.
+func jumpHash(key uint64, n int) int {
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,101 @@
+package datadog
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestJumpHash(t *testing.T) {
+	// Growing the number of buckets only moves keys to the new bucket.
+	for key := uint64(0); key < 1000; key++ {
+		k := key * 0x9E3779B97F4A7C15
+		for n := 1; n < 10; n++ {
+			a, b := jumpHash(k, n), jumpHash(k, n+1)
+			if a < 0 || a >= n {
+				t.Fatalf("bucket %d out of range [0,%d)", a, n)
+			}
+			if a != b && b != n {
+				t.Fatalf("key %d moved from bucket %d to %d when growing to %d buckets", k, a, b, n+1)
+			}
+		}
+	}
+}
+
+func TestClientMultipleAddresses(t *testing.T) {
+	for _, balancing := range []Balancing{BalanceByName, BalanceRoundRobin} {
+		var conns []net.PacketConn
+		var addrs []string
+
+		for i := 0; i < 3; i++ {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conns = append(conns, conn)
+			addrs = append(addrs, conn.LocalAddr().String())
+		}
+
+		client := NewClientWith(ClientConfig{
+			Addresses:  addrs,
+			Balancing:  balancing,
+			BufferSize: 64,
+		})
+
+		// The small buffer size splits the metrics in many datagrams, which
+		// gives the round-robin balancing a chance to use all agents. Each
+		// metric is sent twice, the agent receiving the first copy must
+		// receive the second one when balancing by name.
+		for r := 0; r < 2; r++ {
+			for i := 0; i < 30; i++ {
+				client.HandleMeasures(time.Now(), stats.Measure{
+					Name:   "metric" + string(rune('A'+i)),
+					Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+				})
+			}
+		}
+		client.Close()
+
+		received := make(map[string][]int)
+		total := 0
+
+		for i, conn := range conns {
+			b := make([]byte, 65536)
+			for {
+				_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				n, _, err := conn.ReadFrom(b)
+				if err != nil {
+					break
+				}
+				for _, line := range strings.Split(strings.TrimSpace(string(b[:n])), "\n") {
+					name, _, _ := strings.Cut(line, ":")
+					received[name] = append(received[name], i)
+					total++
+				}
+			}
+		}
+
+		if total != 60 {
+			t.Errorf("expected 60 metrics, got %d", total)
+		}
+
+		agents := make(map[int]bool)
+		for name, conns := range received {
+			sort.Ints(conns)
+			agents[conns[0]] = true
+			agents[conns[len(conns)-1]] = true
+			if balancing == BalanceByName && conns[0] != conns[len(conns)-1] {
+				t.Errorf("metric %s was sent to multiple agents: %v", name, conns)
+			}
+		}
+
+		if len(agents) != len(conns) {
+			t.Errorf("metrics were only sent to %d agents out of %d", len(agents), len(conns))
+		}
+	}
+}
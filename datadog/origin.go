@@ -0,0 +1,132 @@
+package datadog
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Environment variables used by the Datadog agent and its admission controller
+// to identify the origin of metrics, which lets the agent attach the tags of
+// the pod, container, or task that produced them.
+const (
+	// entityIDEnv carries the UID of the Kubernetes pod, it is sent as the
+	// dd.internal.entity_id tag.
+	entityIDEnv = "DD_ENTITY_ID"
+
+	// externalEnv carries the external data injected by the admission
+	// controller, it is sent in the "e:" field of datagrams.
+	externalEnv = "DD_EXTERNAL_ENV"
+
+	// originDetectionEnv disables the detection of the container ID when set
+	// to a false value.
+	originDetectionEnv = "DD_ORIGIN_DETECTION_ENABLED"
+
+	entityIDTag = "dd.internal.entity_id"
+
+	cgroupPath = "/proc/self/cgroup"
+)
+
+var (
+	cgroupLine = regexp.MustCompile(`^\d+:[^:]*:(.+)$`)
+
+	// Container IDs are either docker/containerd IDs, UUIDs used by some
+	// runtimes, or ECS Fargate task IDs.
+	cgroupContainerID = regexp.MustCompile(`([0-9a-f]{64}|[0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12}|[0-9a-f]{32}-\d+)(?:\.scope)?$`)
+)
+
+// origin identifies the entity producing the metrics in the datagrams sent to
+// the agent.
+type origin struct {
+	entityID    string
+	containerID string
+	external    string
+}
+
+// detectOrigin returns the origin of the metrics of the program from the
+// environment. When containerID is empty and origin detection is enabled, the
+// container ID is read from the cgroup of the process.
+func detectOrigin(containerID string, disableDetection bool) origin {
+	o := origin{
+		entityID:    os.Getenv(entityIDEnv),
+		containerID: containerID,
+		external:    sanitizeExternalData(os.Getenv(externalEnv)),
+	}
+
+	if s := os.Getenv(originDetectionEnv); s != "" {
+		if enabled, err := strconv.ParseBool(s); err == nil && !enabled {
+			disableDetection = true
+		}
+	}
+
+	if o.containerID == "" && !disableDetection {
+		o.containerID = readContainerID(cgroupPath)
+	}
+
+	return o
+}
+
+// appendTag appends the entity ID tag to b, if any. The tag list of the
+// datagram must already be opened.
+func (o *origin) appendTag(b []byte) []byte {
+	if o.entityID == "" {
+		return b
+	}
+	if b[len(b)-1] != '#' {
+		b = append(b, ',')
+	}
+	b = append(b, entityIDTag...)
+	b = append(b, ':')
+	return append(b, o.entityID...)
+}
+
+// appendFields appends the container ID and external data fields to b.
+func (o *origin) appendFields(b []byte) []byte {
+	if o.containerID != "" {
+		b = append(b, '|', 'c', ':')
+		b = append(b, o.containerID...)
+	}
+	if o.external != "" {
+		b = append(b, '|', 'e', ':')
+		b = append(b, o.external...)
+	}
+	return b
+}
+
+// sanitizeExternalData removes the characters which would break the datagram
+// format from s, the value is opaque to clients.
+func sanitizeExternalData(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', '\n', ' ':
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// readContainerID returns the ID of the container the process runs in, parsed
+// from the cgroup file at path. It returns an empty string if the file does
+// not exist or does not contain a container ID, which is the case outside of
+// containers and on hosts using cgroup v2 namespaces.
+func readContainerID(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		m := cgroupLine.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		if id := cgroupContainerID.FindStringSubmatch(m[1]); id != nil {
+			return id[1]
+		}
+	}
+	return ""
+}
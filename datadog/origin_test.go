@@ -0,0 +1,101 @@
+package datadog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestMain(m *testing.M) {
+	// The tests compare datagrams produced by clients, which must not carry
+	// the container ID of the environment running them.
+	os.Setenv(originDetectionEnv, "false")
+	os.Exit(m.Run())
+}
+
+func TestReadContainerID(t *testing.T) {
+	const id = "3726184226f5d3147c25fdeab5b60097e378e8a720503a5e19ecfdf29f869860"
+
+	tests := []struct {
+		cgroup string
+		id     string
+	}{
+		{
+			cgroup: "12:memory:/docker/" + id + "\n1:cpu:/docker/" + id + "\n",
+			id:     id,
+		},
+		{
+			cgroup: "1:name=systemd:/kubepods.slice/kubepods-pod1.slice/cri-containerd-" + id + ".scope\n",
+			id:     id,
+		},
+		{
+			cgroup: "1:cpu:/ecs/5a081c13b4b145e7a4eba8ed2d3f0efa/5a081c13b4b145e7a4eba8ed2d3f0efa-2154958760\n",
+			id:     "5a081c13b4b145e7a4eba8ed2d3f0efa-2154958760",
+		},
+		{
+			cgroup: "0::/\n",
+			id:     "",
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "cgroup")
+		if err := os.WriteFile(path, []byte(test.cgroup), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if id := readContainerID(path); id != test.id {
+			t.Errorf("%q: want %q, got %q", test.cgroup, test.id, id)
+		}
+	}
+
+	if id := readContainerID(filepath.Join(t.TempDir(), "missing")); id != "" {
+		t.Errorf("unexpected container ID for a missing file: %q", id)
+	}
+}
+
+func TestDetectOrigin(t *testing.T) {
+	t.Setenv(entityIDEnv, "pod-uid")
+	t.Setenv(externalEnv, "it-false,cn-app|x")
+	t.Setenv(originDetectionEnv, "false")
+
+	o := detectOrigin("", false)
+
+	if o != (origin{entityID: "pod-uid", external: "it-false,cn-appx"}) {
+		t.Errorf("unexpected origin: %+v", o)
+	}
+}
+
+func TestSerializerOrigin(t *testing.T) {
+	s := &serializer{origin: origin{entityID: "pod-uid", containerID: "abc", external: "cn-app"}}
+
+	b := s.AppendMeasures(nil, time.Time{},
+		stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "api")},
+		},
+		stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("size", 2, stats.Gauge)},
+		},
+	)
+
+	const want = "request.count:1|c|#service:api,dd.internal.entity_id:pod-uid|c:abc|e:cn-app\n" +
+		"request.size:2|g|#dd.internal.entity_id:pod-uid|c:abc|e:cn-app\n"
+
+	if string(b) != want {
+		t.Errorf("bad datagrams:\nwant %q\ngot  %q", want, b)
+	}
+
+	for _, line := range []string{
+		"request.count:1|c|#service:api,dd.internal.entity_id:pod-uid|c:abc|e:cn-app",
+		"request.count:1|c|@0.5|c:abc",
+	} {
+		if _, err := parseMetric(line); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	stats "github.com/segmentio/stats/v5"
 )
@@ -117,10 +118,10 @@ func parseMetric(s string) (m Metric, err error) {
 	var typ string
 	var rate string
 	var tags string
+	var timestamp string
 
 	val, next = nextToken(next, '|')
 	typ, next = nextToken(next, '|')
-	rate, tags = nextToken(next, '|')
 	name, val = split(val, ':')
 
 	if len(name) == 0 {
@@ -138,22 +139,22 @@ func parseMetric(s string) (m Metric, err error) {
 		return
 	}
 
-	if len(rate) != 0 {
-		switch rate[0] {
-		case '#': // no sample rate, just tags
-			rate, tags = "", rate
-		case '@':
-			rate = rate[1:]
-		default:
+	for len(next) != 0 {
+		var field string
+		field, next = nextToken(next, '|')
+
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate = field[1:]
+		case strings.HasPrefix(field, "#"):
+			tags = field[1:]
+		case strings.HasPrefix(field, "T"):
+			timestamp = field[1:]
+		case strings.HasPrefix(field, "c:"), strings.HasPrefix(field, "e:"):
+			// The container ID and external data fields are not retained.
+		case len(rate) == 0 && len(tags) == 0:
 			err = fmt.Errorf("datadog: %#v has a malformed sample rate", s)
 			return
-		}
-	}
-
-	if len(tags) != 0 {
-		switch tags[0] {
-		case '#':
-			tags = tags[1:]
 		default:
 			err = fmt.Errorf("datadog: %#v has malformed tags", s)
 			return
@@ -179,11 +180,23 @@ func parseMetric(s string) (m Metric, err error) {
 		sampleRate = 1
 	}
 
+	var mtime time.Time
+
+	if len(timestamp) != 0 {
+		var unix int64
+		if unix, err = strconv.ParseInt(timestamp, 10, 64); err != nil {
+			err = fmt.Errorf("datadog: %#v has a malformed timestamp", s)
+			return
+		}
+		mtime = time.Unix(unix, 0)
+	}
+
 	m = Metric{
 		Type:  MetricType(typ),
 		Name:  name,
 		Value: value,
 		Rate:  sampleRate,
+		Time:  mtime,
 	}
 
 	if len(tags) != 0 {
@@ -28,6 +28,7 @@ func TestParseMetricFailure(t *testing.T) {
 		"name:1|c|???",      // malformed sample rate
 		"name:1|c|@abc",     // malformed sample rate
 		"name:1|c|@0.5|???", // malformed tags
+		"name:1|c|Tnow",     // malformed timestamp
 	}
 
 	for _, test := range tests {
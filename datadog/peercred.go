@@ -0,0 +1,145 @@
+package datadog
+
+import (
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// PeerAddr is the address passed to handlers by ServeUnix, it carries the
+// credentials of the process which sent the metrics.
+type PeerAddr struct {
+	net.Addr
+
+	// Credentials of the sending process.
+	PID int
+	UID int
+	GID int
+
+	// Process is the name of the sending process, it is empty if it could
+	// not be determined, for example because the process already exited.
+	Process string
+}
+
+// ServeUnix is like Serve but for unix datagram sockets, it is intended for
+// dogstatsd servers and relays receiving metrics from multiple processes on
+// the same host.
+//
+// The kernel attaches the credentials of the sending process to each
+// datagram, metrics and events are tagged with the name of this process in a
+// "source_process" tag, and handlers receive the credentials in a *PeerAddr.
+//
+// Credentials are only available on Linux, on other platforms ServeUnix
+// behaves like Serve.
+func ServeUnix(conn *net.UnixConn, handler Handler) error {
+	defer conn.Close()
+
+	if err := enablePeerCredentials(conn); err != nil {
+		return err
+	}
+
+	concurrency := runtime.GOMAXPROCS(-1)
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var errgrp errgroup.Group
+	processes := &processNameCache{}
+
+	for i := 0; i < concurrency; i++ {
+		errgrp.Go(func() error {
+			return serveUnix(conn, handler, processes)
+		})
+	}
+
+	return serveError(errgrp.Wait())
+}
+
+func serveUnix(conn *net.UnixConn, handler Handler, processes *processNameCache) error {
+	b := make([]byte, 65536)
+	oob := make([]byte, peerCredentialsSize)
+
+	for {
+		n, oobn, _, a, err := conn.ReadMsgUnix(b, oob)
+		if err != nil {
+			return err
+		}
+
+		// The address is nil when the sender's socket is not bound, it must
+		// not be stored as a typed nil pointer in the net.Addr interface.
+		var addr net.Addr
+		if a != nil {
+			addr = a
+		}
+
+		pid, uid, gid, ok := parsePeerCredentials(oob[:oobn])
+		if !ok {
+			handlePacket(b[:n], addr, handler, nil)
+			continue
+		}
+
+		peer := &PeerAddr{Addr: addr, PID: pid, UID: uid, GID: gid, Process: processes.lookup(pid)}
+
+		var tags []stats.Tag
+		if len(peer.Process) != 0 {
+			tags = []stats.Tag{stats.T("source_process", peer.Process)}
+		}
+
+		handlePacket(b[:n], peer, handler, tags)
+	}
+}
+
+// processNameCacheTTL is how long process names are cached, bounding how long
+// metrics may be attributed to the wrong process after a pid was reused.
+const processNameCacheTTL = time.Minute
+
+// processNameCache caches the names of processes sending metrics, which would
+// otherwise have to be read from the file system for each datagram.
+type processNameCache struct {
+	mutex   sync.Mutex
+	names   map[int]string
+	expires time.Time
+}
+
+func (c *processNameCache) lookup(pid int) string {
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.names == nil || now.After(c.expires) {
+		c.names = make(map[int]string)
+		c.expires = now.Add(processNameCacheTTL)
+	}
+
+	name, ok := c.names[pid]
+	if !ok {
+		name = processName(pid)
+		c.names[pid] = name
+	}
+	return name
+}
+
+// Network returns the network of the sender's address, or "unixgram" if the
+// sender's socket was not bound to an address.
+func (a *PeerAddr) Network() string {
+	if a.Addr == nil {
+		return "unixgram"
+	}
+	return a.Addr.Network()
+}
+
+// String returns a representation of the sender's credentials.
+func (a *PeerAddr) String() string {
+	s := "pid=" + strconv.Itoa(a.PID)
+	if len(a.Process) != 0 {
+		s += " (" + a.Process + ")"
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package datadog
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+var peerCredentialsSize = unix.CmsgSpace(unix.SizeofUcred)
+
+func enablePeerCredentials(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
+
+func parsePeerCredentials(oob []byte) (pid, uid, gid int, ok bool) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return
+	}
+
+	for i := range msgs {
+		// The pid is zero when the sender lives in a pid namespace that is
+		// not visible from the one of the server.
+		if cred, err := unix.ParseUnixCredentials(&msgs[i]); err == nil && cred.Pid != 0 {
+			return int(cred.Pid), int(cred.Uid), int(cred.Gid), true
+		}
+	}
+
+	return
+}
+
+func processName(pid int) string {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
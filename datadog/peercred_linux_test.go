@@ -0,0 +1,90 @@
+package datadog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestServeUnixPeerCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dsd.socket")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type received struct {
+		metric Metric
+		addr   net.Addr
+	}
+	metrics := make(chan received, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeUnix(conn, HandlerFunc(func(m Metric, a net.Addr) {
+			metrics <- received{metric: m, addr: a}
+		}))
+	}()
+
+	client, err := net.Dial("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("foo:1|c|#a:b")); err != nil {
+		t.Fatal(err)
+	}
+
+	var r received
+	select {
+	case r = <-metrics:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the metric")
+	}
+
+	peer, ok := r.addr.(*PeerAddr)
+	if !ok {
+		conn.Close()
+		<-done
+		t.Skipf("peer credentials are not available in this environment (got %T)", r.addr)
+	}
+	if peer.PID != os.Getpid() {
+		t.Errorf("bad pid: expected %d, got %d", os.Getpid(), peer.PID)
+	}
+	if peer.UID != os.Getuid() {
+		t.Errorf("bad uid: expected %d, got %d", os.Getuid(), peer.UID)
+	}
+
+	comm, err := os.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := strings.TrimSpace(string(comm))
+
+	if peer.Process != name {
+		t.Errorf("bad process name: expected %q, got %q", name, peer.Process)
+	}
+
+	expect := []stats.Tag{stats.T("a", "b"), stats.T("source_process", name)}
+	if len(r.metric.Tags) != len(expect) || r.metric.Tags[0] != expect[0] || r.metric.Tags[1] != expect[1] {
+		t.Errorf("bad tags: expected %v, got %v", expect, r.metric.Tags)
+	}
+
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the server to stop")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package datadog
+
+import "net"
+
+const peerCredentialsSize = 0
+
+func enablePeerCredentials(conn *net.UnixConn) error {
+	return nil
+}
+
+func parsePeerCredentials(oob []byte) (pid, uid, gid int, ok bool) {
+	return
+}
+
+func processName(pid int) string {
+	return ""
+}
@@ -20,6 +20,10 @@ type serializer struct {
 	filters          map[string]struct{}
 	distPrefixes     []string
 	useDistributions bool
+	tagTemplate      *tagTemplate
+	origin           origin
+
+	timestampThreshold time.Duration
 }
 
 func (s *serializer) Write(b []byte) (int, error) {
@@ -74,9 +78,13 @@ func (s *serializer) close() {
 	}
 }
 
-func (s *serializer) AppendMeasures(b []byte, _ time.Time, measures ...stats.Measure) []byte {
+func (s *serializer) AppendMeasures(b []byte, t time.Time, measures ...stats.Measure) []byte {
+	var timestamp int64
+	if s.timestampThreshold > 0 && time.Since(t) >= s.timestampThreshold {
+		timestamp = t.Unix()
+	}
 	for _, m := range measures {
-		b = s.AppendMeasure(b, m)
+		b = s.appendMeasure(b, m, timestamp)
 	}
 	return b
 }
@@ -288,17 +296,44 @@ func appendSanitizedMetricName(dst []byte, raw string) []byte {
 	return dst
 }
 
+// appendSanitizedLineName is like appendSanitizedMetricName but applies the
+// length limit to b[start:], the metric line being formatted, rather than to
+// the whole buffer which may already hold other metrics.
+func appendSanitizedLineName(b []byte, start int, raw string) []byte {
+	if raw == "" && len(b) != start {
+		return b
+	}
+	return append(b[:start], appendSanitizedMetricName(b[start:], raw)...)
+}
+
 // AppendMeasure is a formatting routine to append the dogstatsd protocol
 // representation of a measure to a memory buffer.
 // Tags listed in the s.filters are removed. (some tags may not be suitable for submission to DataDog)
-// Histogram metrics will be sent as distribution type if the metric name matches s.distPrefixes
+// Distribution metrics are always sent as distribution type, histogram metrics
+// will be sent as distribution type if the metric name matches s.distPrefixes
+// Tags are folded into the metric name instead of being sent if s.tagTemplate is set
+// The entity ID, container ID, and external data of s.origin are added to let the
+// agent attach the tags of the pod or container that produced the metrics
 // DogStatsd Protocol Docs: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell?tab=metrics#the-dogstatsd-protocol
 func (s *serializer) AppendMeasure(b []byte, m stats.Measure) []byte {
+	return s.appendMeasure(b, m, 0)
+}
+
+// appendMeasure appends the lines of the fields of m, counters and gauges are
+// stamped with timestamp when it is not zero. The agent does not support
+// timestamps on other metric types.
+func (s *serializer) appendMeasure(b []byte, m stats.Measure, timestamp int64) []byte {
 	for _, field := range m.Fields {
-		b = appendSanitizedMetricName(b, m.Name)
-		if len(field.Name) > 0 {
-			b = append(b, '.')
-			b = appendSanitizedMetricName(b, field.Name)
+		start := len(b)
+
+		if s.tagTemplate != nil {
+			b = s.tagTemplate.appendName(b, m, field, s.filters)
+		} else {
+			b = appendSanitizedLineName(b, start, m.Name)
+			if len(field.Name) > 0 {
+				b = append(b, '.')
+				b = appendSanitizedLineName(b, start, field.Name)
+			}
 		}
 
 		b = append(b, ':')
@@ -326,6 +361,8 @@ func (s *serializer) AppendMeasure(b []byte, m stats.Measure) []byte {
 			b = append(b, '|', 'c')
 		case stats.Gauge:
 			b = append(b, '|', 'g')
+		case stats.Distribution:
+			b = append(b, '|', 'd')
 		default:
 			if s.sendDist(field.Name) {
 				b = append(b, '|', 'd')
@@ -333,7 +370,14 @@ func (s *serializer) AppendMeasure(b []byte, m stats.Measure) []byte {
 				b = append(b, '|', 'h')
 			}
 		}
-		if len(m.Tags) > 0 {
+		// The values of counters were already scaled by the engine, the agent
+		// needs the rate to extrapolate the number of values of histograms and
+		// distributions.
+		if t := field.Type(); t != stats.Counter && t != stats.Gauge && m.SampleRate > 0 && m.SampleRate < 1 {
+			b = append(b, '|', '@')
+			b = strconv.AppendFloat(b, m.SampleRate, 'g', -1, 64)
+		}
+		if (len(m.Tags) > 0 || s.origin.entityID != "") && s.tagTemplate == nil {
 			b = append(b, '|', '#')
 			for i, t := range m.Tags {
 				if _, skip := s.filters[t.Name]; skip {
@@ -342,10 +386,16 @@ func (s *serializer) AppendMeasure(b []byte, m stats.Measure) []byte {
 				if i != 0 {
 					b = append(b, ',')
 				}
-				b = appendSanitizedMetricName(b, t.Name)
+				b = appendSanitizedLineName(b, start, t.Name)
 				b = append(b, ':')
-				b = appendSanitizedMetricName(b, t.Value)
+				b = appendSanitizedLineName(b, start, t.Value)
 			}
+			b = s.origin.appendTag(b)
+		}
+		b = s.origin.appendFields(b)
+		if t := field.Type(); timestamp != 0 && (t == stats.Counter || t == stats.Gauge) {
+			b = append(b, '|', 'T')
+			b = strconv.AppendInt(b, timestamp, 10)
 		}
 		b = append(b, '\n')
 	}
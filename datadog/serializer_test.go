@@ -72,6 +72,21 @@ request.rtt:0.1|h|#answer:42,hello:world
 		dp: []string{},
 	},
 
+	{
+		m: stats.Measure{
+			Name: "request",
+			Fields: []stats.Field{
+				stats.MakeField("count", 4, stats.Counter),
+				stats.MakeField("rtt", 100*time.Millisecond, stats.Histogram),
+			},
+			SampleRate: 0.25,
+		},
+		s: `request.count:4|c
+request.rtt:0.1|h|@0.25
+`,
+		dp: []string{},
+	},
+
 	{
 		m: stats.Measure{
 			Name: "request",
@@ -87,6 +102,18 @@ request.rtt:0.1|h|#answer:42,hello:world
 `,
 		dp: []string{"dist_"},
 	},
+
+	{
+		m: stats.Measure{
+			Name: "request",
+			Fields: []stats.Field{
+				stats.MakeField("rtt", 100*time.Millisecond, stats.Distribution),
+			},
+		},
+		s: `request.rtt:0.1|d
+`,
+		dp: []string{},
+	},
 }
 
 func TestAppendMeasure(t *testing.T) {
@@ -103,6 +130,35 @@ func TestAppendMeasure(t *testing.T) {
 	}
 }
 
+func TestAppendMeasuresTimestamp(t *testing.T) {
+	client := NewClientWith(ClientConfig{TimestampThreshold: time.Minute})
+	defer client.Close()
+
+	measures := []stats.Measure{{
+		Name: "jobs",
+		Fields: []stats.Field{
+			stats.MakeField("done", 1, stats.Counter),
+			stats.MakeField("queue", 2, stats.Gauge),
+			stats.MakeField("rtt", time.Second, stats.Histogram),
+		},
+	}}
+
+	backfill := time.Unix(1700000000, 0)
+	if s := string(client.AppendMeasures(nil, backfill, measures...)); s != `jobs.done:1|c|T1700000000
+jobs.queue:2|g|T1700000000
+jobs.rtt:1|h
+` {
+		t.Errorf("bad backfilled measures:\n%s", s)
+	}
+
+	if s := string(client.AppendMeasures(nil, time.Now(), measures...)); s != `jobs.done:1|c
+jobs.queue:2|g
+jobs.rtt:1|h
+` {
+		t.Errorf("bad recent measures:\n%s", s)
+	}
+}
+
 var (
 	testDistNames = []struct {
 		n string
@@ -356,3 +412,75 @@ func TestAppendSanitizedMetricName(t *testing.T) {
 		}
 	})
 }
+
+func TestAppendMeasureTagTemplate(t *testing.T) {
+	measure := stats.Measure{
+		Name: "request",
+		Fields: []stats.Field{
+			stats.MakeField("count", 5, stats.Counter),
+		},
+		Tags: []stats.Tag{
+			stats.T("env", "prod"),
+			stats.T("http_req_path", "/users/42"),
+			stats.T("method", "GET"),
+		},
+	}
+
+	tests := []struct {
+		template string
+		measure  stats.Measure
+		s        string
+	}{
+		{
+			template: DefaultTagTemplate,
+			measure:  measure,
+			s:        "request.count.env.prod.method.GET:5|c\n",
+		},
+		{
+			template: "{env}.{name}.{tags}",
+			measure:  measure,
+			s:        "prod.request.count.method.GET:5|c\n",
+		},
+		{
+			template: "{region}.{name}",
+			measure:  measure,
+			s:        "none.request.count:5|c\n",
+		},
+		{
+			template: "app.{name}.{tags}",
+			measure:  stats.Measure{Name: "request", Fields: measure.Fields},
+			s:        "app.request.count:5|c\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			client := NewClientWith(ClientConfig{TagTemplate: test.template})
+			if s := string(client.AppendMeasure(nil, test.measure)); s != test.s {
+				t.Error("bad metric representation:")
+				t.Log("expected:", test.s)
+				t.Log("found:   ", s)
+			}
+		})
+	}
+}
+
+func TestAppendMeasureAfterLongMetric(t *testing.T) {
+	client := NewClient(DefaultAddress)
+
+	b := client.AppendMeasure(nil, stats.Measure{
+		Name:   strings.Repeat("A", 300),
+		Fields: []stats.Field{stats.MakeField("", 1, stats.Counter)},
+	})
+	n := len(b)
+
+	b = client.AppendMeasure(b, stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		Tags:   []stats.Tag{stats.T("method", "GET")},
+	})
+
+	if s, want := string(b[n:]), "request.count:1|c|#method:GET\n"; s != want {
+		t.Errorf("bad metric representation: want %q, got %q", want, s)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"golang.org/x/sync/errgroup"
+
+	stats "github.com/segmentio/stats/v5"
 )
 
 // Handler defines the interface that types must satisfy to process metrics
@@ -71,7 +73,12 @@ func Serve(conn net.PacketConn, handler Handler) error {
 		})
 	}
 
-	err = errgrp.Wait()
+	return serveError(errgrp.Wait())
+}
+
+// serveError filters out the errors returned when the server's socket gets
+// closed, which is how servers are expected to be stopped.
+func serveError(err error) error {
 	switch {
 	default:
 		return err
@@ -79,6 +86,7 @@ func Serve(conn net.PacketConn, handler Handler) error {
 	case errors.Is(err, io.EOF):
 	case errors.Is(err, io.ErrClosedPipe):
 	case errors.Is(err, io.ErrUnexpectedEOF):
+	case errors.Is(err, net.ErrClosed):
 	}
 
 	return nil
@@ -92,34 +100,45 @@ func serve(conn net.PacketConn, handler Handler) error {
 		if err != nil {
 			return err
 		}
+		handlePacket(b[:n], a, handler, nil)
+	}
+}
 
-		for s := b[:n]; len(s) != 0; {
-			off := bytes.IndexByte(s, '\n')
-			if off < 0 {
-				off = len(s)
-			} else {
-				off++
-			}
-
-			ln := s[:off]
-			s = s[off:]
+// handlePacket parses the metrics and events of a datagram and passes them to
+// handler, tags are appended to those of every metric and event.
+func handlePacket(s []byte, a net.Addr, handler Handler, tags []stats.Tag) {
+	for len(s) != 0 {
+		off := bytes.IndexByte(s, '\n')
+		if off < 0 {
+			off = len(s)
+		} else {
+			off++
+		}
 
-			if bytes.HasPrefix(ln, []byte("_e")) {
-				e, err := parseEvent(string(ln))
-				if err != nil {
-					continue
-				}
+		ln := s[:off]
+		s = s[off:]
 
-				handler.HandleEvent(e, a)
+		if bytes.HasPrefix(ln, []byte("_e")) {
+			e, err := parseEvent(string(ln))
+			if err != nil {
 				continue
 			}
 
-			m, err := parseMetric(string(ln))
-			if err != nil {
-				continue
+			if len(tags) != 0 {
+				e.Tags = append(e.Tags, tags...)
 			}
+			handler.HandleEvent(e, a)
+			continue
+		}
+
+		m, err := parseMetric(string(ln))
+		if err != nil {
+			continue
+		}
 
-			handler.HandleMetric(m, a)
+		if len(tags) != 0 {
+			m.Tags = append(m.Tags, tags...)
 		}
+		handler.HandleMetric(m, a)
 	}
 }
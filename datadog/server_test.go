@@ -180,3 +180,36 @@ func (ts *testUnixgramServer) Close() error {
 	os.RemoveAll(ts.pathToDelete) // clean up
 	return ts.UnixConn.Close()
 }
+
+func TestHandlePacketTags(t *testing.T) {
+	var metrics []Metric
+	var events []Event
+
+	handler := &testHandler{
+		metric: func(m Metric, _ net.Addr) { metrics = append(metrics, m) },
+		event:  func(e Event, _ net.Addr) { events = append(events, e) },
+	}
+
+	handlePacket([]byte("foo:1|c|#a:b\n_e{1,1}:A|B\n"), nil, handler, []stats.Tag{stats.T("source_process", "test")})
+
+	if len(metrics) != 1 || len(events) != 1 {
+		t.Fatalf("expected 1 metric and 1 event, got %d and %d", len(metrics), len(events))
+	}
+
+	if tags := metrics[0].Tags; len(tags) != 2 || tags[1] != stats.T("source_process", "test") {
+		t.Error("bad metric tags:", tags)
+	}
+
+	if tags := events[0].Tags; len(tags) != 1 || tags[0] != stats.T("source_process", "test") {
+		t.Error("bad event tags:", tags)
+	}
+}
+
+type testHandler struct {
+	metric func(Metric, net.Addr)
+	event  func(Event, net.Addr)
+}
+
+func (h *testHandler) HandleMetric(m Metric, a net.Addr) { h.metric(m, a) }
+
+func (h *testHandler) HandleEvent(e Event, a net.Addr) { h.event(e, a) }
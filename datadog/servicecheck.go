@@ -0,0 +1,89 @@
+package datadog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// ServiceCheckStatus is an enumeration providing the available datadog service
+// check statuses.
+type ServiceCheckStatus int
+
+// Service Check Statuses.
+const (
+	ServiceCheckOK       ServiceCheckStatus = 0
+	ServiceCheckWarning  ServiceCheckStatus = 1
+	ServiceCheckCritical ServiceCheckStatus = 2
+	ServiceCheckUnknown  ServiceCheckStatus = 3
+)
+
+// ServiceCheck is a representation of a datadog service check, which reports
+// the health of a service.
+type ServiceCheck struct {
+	Name    string
+	Status  ServiceCheckStatus
+	Ts      int64
+	Host    string
+	Tags    []stats.Tag
+	Message string
+}
+
+// String satisfies the fmt.Stringer interface.
+func (sc ServiceCheck) String() string {
+	return fmt.Sprint(sc)
+}
+
+// Format satisfies the fmt.Formatter interface.
+func (sc ServiceCheck) Format(f fmt.State, _ rune) {
+	buf := bufferPool.Get().(*buffer)
+	buf.b = appendServiceCheck(buf.b[:0], sc)
+	_, _ = f.Write(buf.b)
+	bufferPool.Put(buf)
+}
+
+// SendServiceCheck sends sc to the datadog clients set as handlers of the
+// default engine.
+func SendServiceCheck(sc ServiceCheck) error {
+	return SendServiceCheckWith(stats.DefaultEngine, sc)
+}
+
+// SendServiceCheckWith sends sc to the datadog clients set as handlers of eng,
+// so service checks are sent over the same connections as the metrics. The
+// tags of eng are added to those of the service check.
+func SendServiceCheckWith(eng *stats.Engine, sc ServiceCheck) error {
+	sc.Tags = engineTags(eng, sc.Tags)
+	return sendWith(eng, func(c *Client) error { return c.SendServiceCheck(sc) })
+}
+
+func appendServiceCheck(b []byte, sc ServiceCheck) []byte {
+	b = append(b, "_sc|"...)
+	b = append(b, sc.Name...)
+	b = append(b, '|')
+	b = strconv.AppendInt(b, int64(sc.Status), 10)
+
+	if sc.Ts != 0 {
+		b = append(b, '|', 'd', ':')
+		b = strconv.AppendInt(b, sc.Ts, 10)
+	}
+
+	if len(sc.Host) > 0 {
+		b = append(b, '|', 'h', ':')
+		b = append(b, sc.Host...)
+	}
+
+	if n := len(sc.Tags); n != 0 {
+		b = append(b, '|', '#')
+		b = appendTags(b, sc.Tags)
+	}
+
+	// The message must be the last field of service checks.
+	if len(sc.Message) > 0 {
+		b = append(b, '|', 'm', ':')
+		b = append(b, strings.ReplaceAll(sc.Message, "\n", "\\n")...)
+	}
+
+	return append(b, '\n')
+}
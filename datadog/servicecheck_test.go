@@ -0,0 +1,75 @@
+package datadog
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestAppendServiceCheck(t *testing.T) {
+	tests := []struct {
+		sc ServiceCheck
+		s  string
+	}{
+		{
+			sc: ServiceCheck{Name: "app.health", Status: ServiceCheckOK},
+			s:  "_sc|app.health|0\n",
+		},
+		{
+			sc: ServiceCheck{
+				Name:    "app.health",
+				Status:  ServiceCheckCritical,
+				Ts:      21,
+				Host:    "localhost",
+				Tags:    []stats.Tag{stats.T("env", "prod"), stats.T("az", "a")},
+				Message: "database\nunreachable",
+			},
+			s: "_sc|app.health|2|d:21|h:localhost|#env:prod,az:a|m:database\\nunreachable\n",
+		},
+	}
+
+	for _, test := range tests {
+		if s := string(appendServiceCheck(nil, test.sc)); s != test.s {
+			t.Errorf("bad service check:\n- expected: %q\n- found:    %q", test.s, s)
+		}
+	}
+}
+
+func TestSendWithEngine(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewClient(conn.LocalAddr().String())
+	defer client.Close()
+
+	// The client is found among the handlers of the engine.
+	eng := stats.NewEngine("app", stats.MultiHandler(&statstest.Handler{}, client), stats.T("env", "prod"))
+
+	if err := SendEventWith(eng, Event{Title: "deploy", Text: "v1.2.3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendServiceCheckWith(eng, ServiceCheck{Name: "app.health", Status: ServiceCheckWarning}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		"_e{6,6}:deploy|v1.2.3|#env:prod\n",
+		"_sc|app.health|1|#env:prod\n",
+	} {
+		b := make([]byte, 1024)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(b[:n]); s != expect {
+			t.Errorf("bad datagram:\n- expected: %q\n- found:    %q", expect, s)
+		}
+	}
+}
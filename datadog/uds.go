@@ -21,18 +21,18 @@ type udsWriter struct {
 	conn   net.Conn
 	connMu sync.RWMutex // so that we can replace the failing conn on error
 
-	// write timeout
+	// write timeout, writes block until they complete when zero
 	writeTimeout time.Duration
 }
 
 // newUDSWriter returns a pointer to a new udsWriter given a socket file path as addr.
-func newUDSWriter(addr string) (*udsWriter, error) {
+func newUDSWriter(addr string, writeTimeout time.Duration) (*udsWriter, error) {
 	udsAddr, err := net.ResolveUnixAddr("unixgram", addr)
 	if err != nil {
 		return nil, err
 	}
 	// Defer connection to first read/write
-	writer := &udsWriter{addr: udsAddr, conn: nil, writeTimeout: defaultUDSTimeout}
+	writer := &udsWriter{addr: udsAddr, conn: nil, writeTimeout: writeTimeout}
 	return writer, nil
 }
 
@@ -44,8 +44,10 @@ func (w *udsWriter) Write(data []byte) (int, error) {
 		return 0, err
 	}
 
-	if err = conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
-		return 0, err
+	if w.writeTimeout > 0 {
+		if err = conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+			return 0, err
+		}
 	}
 
 	n, err := conn.Write(data)
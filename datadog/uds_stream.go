@@ -0,0 +1,185 @@
+package datadog
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultReconnectBufferSize is the default amount of metrics buffered by
+	// stream writers while they are disconnected from the agent.
+	defaultReconnectBufferSize = 1 << 20
+
+	// defaultReconnectInterval is the minimum delay between two attempts of
+	// stream writers to connect to the agent, so writes do not try to connect
+	// when the agent is known to be unavailable.
+	defaultReconnectInterval = 100 * time.Millisecond
+)
+
+// errReconnectBufferFull is returned by stream writers when metrics were
+// dropped because the agent could not be reached and the reconnect buffer was
+// full.
+var errReconnectBufferFull = errors.New("stats/datadog: metrics dropped while reconnecting to the agent, the reconnect buffer is full")
+
+// errWaitingToReconnect is returned by stream writers when the last attempt to
+// connect to the agent was too recent to try again.
+var errWaitingToReconnect = errors.New("stats/datadog: waiting to reconnect to the agent")
+
+// udsStreamWriter sends metrics to a dogstatsd agent listening on a unix stream
+// socket, which is the mode used by agent deployments where datagram sockets
+// are disabled.
+//
+// Streams have no message boundaries, the agent expects each payload to be
+// prefixed with its length as a 32 bits little-endian integer. When the
+// connection is lost, the writer buffers the payloads that were not fully
+// written until it reconnects, resending them first once connected, so metrics
+// are not lost when the agent restarts.
+type udsStreamWriter struct {
+	addr string
+
+	// write timeout, writes block until they complete when zero
+	writeTimeout time.Duration
+
+	// maximum size of pending payloads, and minimum delay between attempts
+	// to connect to the agent
+	maxPending        int
+	reconnectInterval time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	lastDial time.Time
+	// length-prefixed payloads waiting to be written
+	pending []byte
+}
+
+// newUDSStreamWriter returns a pointer to a new udsStreamWriter given a socket
+// file path as addr.
+func newUDSStreamWriter(addr string, writeTimeout time.Duration, maxPending int) (*udsStreamWriter, error) {
+	if _, err := net.ResolveUnixAddr("unix", addr); err != nil {
+		return nil, err
+	}
+	if maxPending <= 0 {
+		maxPending = defaultReconnectBufferSize
+	}
+	// Defer connection to first write
+	return &udsStreamWriter{
+		addr:              addr,
+		writeTimeout:      writeTimeout,
+		maxPending:        maxPending,
+		reconnectInterval: defaultReconnectInterval,
+	}, nil
+}
+
+// Write frames data and sends it to the agent after the payloads that are
+// pending from previous writes. Payloads are buffered when the agent cannot be
+// reached, in which case Write only fails if the reconnect buffer is full.
+func (w *udsStreamWriter) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		// Empty frames are valid but carry no metrics.
+		return 0, nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending)+4+len(data) > w.maxPending {
+		if err := w.flush(); err != nil || len(w.pending)+4+len(data) > w.maxPending {
+			return 0, errReconnectBufferFull
+		}
+	}
+
+	w.pending = binary.LittleEndian.AppendUint32(w.pending, uint32(len(data)))
+	w.pending = append(w.pending, data...)
+
+	// The payload is buffered, it will be sent after reconnecting if the
+	// agent cannot be reached now.
+	_ = w.flush()
+	return len(data), nil
+}
+
+// flush writes the pending payloads to the agent, connecting first if needed.
+// Payloads which were not fully written remain pending, the connection is
+// closed on errors since partial writes break the framing of the stream.
+func (w *udsStreamWriter) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	if w.conn == nil {
+		now := time.Now()
+		if now.Sub(w.lastDial) < w.reconnectInterval {
+			return errWaitingToReconnect
+		}
+		w.lastDial = now
+		conn, err := net.Dial("unix", w.addr)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+
+	if w.writeTimeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout)); err != nil {
+			w.disconnect()
+			return err
+		}
+	}
+
+	n, err := w.conn.Write(w.pending)
+	if err != nil {
+		w.discard(n)
+		w.disconnect()
+		return err
+	}
+
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// discard removes the payloads that were fully written within the first n
+// bytes of the pending buffer.
+func (w *udsStreamWriter) discard(n int) {
+	i := 0
+	for i+4 <= len(w.pending) {
+		end := i + 4 + int(binary.LittleEndian.Uint32(w.pending[i:]))
+		if end > n {
+			break
+		}
+		i = end
+	}
+	w.pending = w.pending[:copy(w.pending, w.pending[i:])]
+}
+
+func (w *udsStreamWriter) disconnect() {
+	w.conn.Close()
+	w.conn = nil
+}
+
+// Close writes the pending payloads if the agent can be reached, and closes
+// the connection.
+func (w *udsStreamWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Give a last chance to pending payloads regardless of the last attempt
+	// to connect.
+	w.lastDial = time.Time{}
+	err := w.flush()
+
+	if w.conn != nil {
+		w.disconnect()
+	}
+	return err
+}
+
+// CalcBufferSize returns sizehint, payloads sent over streams are not limited
+// by the size of the socket buffer.
+func (w *udsStreamWriter) CalcBufferSize(sizehint int) (int, error) {
+	if sizehint > MaxBufferSize {
+		sizehint = MaxBufferSize
+	}
+	return sizehint, nil
+}
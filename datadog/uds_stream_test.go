@@ -0,0 +1,170 @@
+package datadog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// startUDSStreamTestServer listens on a unix stream socket at socketPath and
+// sends the payloads received on the returned channel.
+func startUDSStreamTestServer(t *testing.T, socketPath string) (net.Listener, <-chan string) {
+	t.Helper()
+
+	lstn, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := make(chan string, 100)
+
+	go func() {
+		for {
+			conn, err := lstn.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var size [4]byte
+				for {
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					b := make([]byte, binary.LittleEndian.Uint32(size[:]))
+					if _, err := io.ReadFull(conn, b); err != nil {
+						return
+					}
+					payloads <- string(b)
+				}
+			}()
+		}
+	}()
+
+	return lstn, payloads
+}
+
+func receivePayload(t *testing.T, payloads <-chan string) string {
+	t.Helper()
+	select {
+	case p := <-payloads:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a payload")
+		return ""
+	}
+}
+
+func TestUDSStreamClient(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+	lstn, payloads := startUDSStreamTestServer(t, socketPath)
+	defer lstn.Close()
+
+	client := NewClientWith(ClientConfig{Address: "unixstream://" + socketPath})
+
+	if client.bufferSize != DefaultUDSBufferSize {
+		t.Errorf("bad buffer size: expected %d, got %d", DefaultUDSBufferSize, client.bufferSize)
+	}
+
+	client.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	})
+	client.Close()
+
+	if p := receivePayload(t, payloads); p != "request.count:1|c\n" {
+		t.Errorf("bad payload: %q", p)
+	}
+}
+
+func TestUDSStreamReconnect(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+	lstn, payloads := startUDSStreamTestServer(t, socketPath)
+
+	w, err := newUDSStreamWriter(socketPath, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.reconnectInterval = 0
+
+	if _, err := w.Write([]byte("a:1|c\n")); err != nil {
+		t.Fatal(err)
+	}
+	if p := receivePayload(t, payloads); p != "a:1|c\n" {
+		t.Errorf("bad payload: %q", p)
+	}
+
+	// Stop the agent, the payloads are buffered until it comes back.
+	lstn.Close()
+	w.mu.Lock()
+	w.conn.Close()
+	w.mu.Unlock()
+
+	for _, p := range []string{"b:1|c\n", "c:1|c\n"} {
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lstn, payloads = startUDSStreamTestServer(t, socketPath)
+	defer lstn.Close()
+
+	if _, err := w.Write([]byte("d:1|c\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"b:1|c\n", "c:1|c\n", "d:1|c\n"} {
+		if p := receivePayload(t, payloads); p != want {
+			t.Errorf("bad payload: %q != %q", p, want)
+		}
+	}
+}
+
+func TestUDSStreamReconnectBufferFull(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+
+	// Nothing listens on the socket, payloads accumulate in the buffer.
+	w, err := newUDSStreamWriter(socketPath, 0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("a:1|c\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("b:1|c\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("c:1|c\n")); !errors.Is(err, errReconnectBufferFull) {
+		t.Fatal("expected the reconnect buffer to be full, got", err)
+	}
+}
+
+func TestUDSStreamDiscard(t *testing.T) {
+	w := &udsStreamWriter{}
+	for _, p := range []string{"aa", "bbb", "c"} {
+		w.pending = binary.LittleEndian.AppendUint32(w.pending, uint32(len(p)))
+		w.pending = append(w.pending, p...)
+	}
+
+	// The first payload was written, the second one only partially.
+	w.discard(8)
+
+	expected := binary.LittleEndian.AppendUint32(nil, 3)
+	expected = append(expected, "bbb"...)
+	expected = binary.LittleEndian.AppendUint32(expected, 1)
+	expected = append(expected, "c"...)
+
+	if !bytes.Equal(w.pending, expected) {
+		t.Errorf("bad pending payloads: %q != %q", w.pending, expected)
+	}
+}
@@ -1,10 +1,14 @@
 package datadog
 
 import (
+	"errors"
 	"net"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
 )
 
 func TestUDSReconnectsWhenConnRefused(t *testing.T) {
@@ -47,3 +51,108 @@ func TestUDSReconnectsWhenConnRefused(t *testing.T) {
 		t.Errorf("unable to write data but should be able to as the client should reconnect %v", err)
 	}
 }
+
+func TestUDSFlushInterval(t *testing.T) {
+	metrics := make(chan Metric, 1)
+
+	socketPath, closer := startUDSTestServer(t, HandlerFunc(func(m Metric, _ net.Addr) {
+		metrics <- m
+	}))
+	defer closer.Close()
+
+	client := NewClientWith(ClientConfig{
+		Address:       "unix://" + socketPath,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	defer client.Close()
+
+	if client.bufferSize != DefaultUDSBufferSize {
+		t.Errorf("bad buffer size: expected %d, got %d", DefaultUDSBufferSize, client.bufferSize)
+	}
+
+	client.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+	})
+
+	// The batch is far from full, it is only sent by the periodic flush.
+	select {
+	case m := <-metrics:
+		if m.Name != "request.count" {
+			t.Error("unexpected metric:", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the metric to be flushed")
+	}
+}
+
+func TestUDSWriteModes(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "dsd.socket")
+
+	// The server never reads, so the socket buffer eventually fills up.
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	datagram := make([]byte, 1024)
+
+	drop, err := newUDSWriter(socketPath, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drop.Close()
+
+	for i := 0; ; i++ {
+		if i == 100000 {
+			t.Fatal("the socket buffer never filled up")
+		}
+		_, err := drop.Write(datagram)
+		if err == nil {
+			continue
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatal("expected a timeout error, got", err)
+		}
+		break
+	}
+
+	block, err := newUDSWriter(socketPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer block.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := block.Write(datagram)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatal("the write did not block:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Draining the socket buffer unblocks the write.
+	go func() {
+		b := make([]byte, len(datagram))
+		for {
+			if _, err := conn.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write never completed")
+	}
+}
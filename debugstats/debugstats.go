@@ -3,6 +3,9 @@
 //
 // By default, metrics will be printed to os.Stdout. Use the Dst and Grep fields
 // to customize the output as appropriate.
+//
+// The package also provides Mux, an HTTP handler exposing the recent measures
+// and state of an engine under /debug/stats/ in production programs.
 package debugstats
 
 import (
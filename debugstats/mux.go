@@ -0,0 +1,441 @@
+package debugstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/fasthash/jody"
+
+	"github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultRecentMeasures is the default number of measures kept by the
+	// handlers returned by Mux.
+	DefaultRecentMeasures = 1000
+
+	// DefaultMaxSeries is the default number of series tracked by the
+	// handlers returned by Mux to compute the cardinality of metrics.
+	DefaultMaxSeries = 100000
+
+	// DefaultTopN is the default number of metrics listed by the cardinality
+	// endpoint.
+	DefaultTopN = 20
+)
+
+// MuxConfig carries the configuration of handlers created by MuxWith.
+type MuxConfig struct {
+	// Engine whose state is exposed, defaults to stats.DefaultEngine.
+	Engine *stats.Engine
+
+	// Number of recent measures kept in memory, defaults to
+	// DefaultRecentMeasures.
+	RecentMeasures int
+
+	// Maximum number of series tracked to compute the cardinality of metrics,
+	// defaults to DefaultMaxSeries. Series seen after the limit was reached
+	// are not counted.
+	MaxSeries int
+
+	// Controls exposed on the /debug/stats/controls endpoint, which is only
+	// served when they are set.
+	Controls *stats.Controls
+}
+
+// Mux returns a handler exposing the state of the default engine, see MuxWith.
+func Mux() *Handler {
+	return MuxWith(MuxConfig{})
+}
+
+// MuxWith returns a handler exposing debug endpoints about the metrics of the
+// program, meant to be mounted next to net/http/pprof:
+//
+//	h := debugstats.Mux()
+//	stats.Register(h)
+//	http.Handle("/debug/stats/", h)
+//
+// The handler must also be registered on the engine, it records the measures
+// it receives to serve them on the endpoints:
+//
+//	/debug/stats/engine       JSON description of the engine prefix, tags, and handler
+//	/debug/stats/health       JSON counters of the measures and flushes received
+//	/debug/stats/measures     most recent measures, filtered by the "grep" regexp parameter
+//	/debug/stats/cardinality  metrics with the most series, the "n" parameter sets how many
+//	/debug/stats/snapshot     JSON list of the metrics produced by the engine, see stats.Engine.Snapshot
+//	/debug/stats/controls     JSON state of the controls set in MuxConfig.Controls
+//
+// The controls are changed by POST requests to /debug/stats/controls, with the
+// "verbose", "debug", and "sample_rate" form values, for example:
+//
+//	curl -d verbose=true -d debug=true localhost:6060/debug/stats/controls
+//
+// The mux has no access control, it must only be served on a private address.
+func MuxWith(config MuxConfig) *Handler {
+	if config.Engine == nil {
+		config.Engine = stats.DefaultEngine
+	}
+
+	if config.RecentMeasures <= 0 {
+		config.RecentMeasures = DefaultRecentMeasures
+	}
+
+	if config.MaxSeries <= 0 {
+		config.MaxSeries = DefaultMaxSeries
+	}
+
+	h := &Handler{
+		eng:       config.Engine,
+		recent:    make([]string, config.RecentMeasures),
+		maxSeries: config.MaxSeries,
+		series:    make(map[string]map[uint64]struct{}),
+		mux:       http.NewServeMux(),
+		controls:  config.Controls,
+	}
+
+	h.mux.HandleFunc("/debug/stats/engine", h.serveEngine)
+	h.mux.HandleFunc("/debug/stats/health", h.serveHealth)
+	h.mux.HandleFunc("/debug/stats/measures", h.serveMeasures)
+	h.mux.HandleFunc("/debug/stats/cardinality", h.serveCardinality)
+	h.mux.HandleFunc("/debug/stats/snapshot", h.serveSnapshot)
+	if h.controls != nil {
+		h.mux.HandleFunc("/debug/stats/controls", h.serveControls)
+	}
+	h.mux.HandleFunc("/debug/stats/", h.serveIndex)
+	return h
+}
+
+// Handler is both a stats.Handler recording the measures it receives and an
+// http.Handler serving them under /debug/stats/.
+type Handler struct {
+	eng      *stats.Engine
+	mux      *http.ServeMux
+	controls *stats.Controls
+
+	mutex       sync.Mutex
+	recent      []string
+	next        int
+	measures    uint64
+	flushes     uint64
+	lastMeasure time.Time
+	lastFlush   time.Time
+	maxSeries   int
+	numSeries   int
+	truncated   bool
+	series      map[string]map[uint64]struct{}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(t time.Time, measures ...stats.Measure) {
+	var b []byte
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, m := range measures {
+		b = append(b[:0], t.Format(time.RFC3339Nano)...)
+		b = append(b, ' ')
+		b = appendMeasure(b, m)
+
+		h.recent[h.next] = string(b)
+		h.next = (h.next + 1) % len(h.recent)
+		h.measures++
+
+		tags := seriesHash(m.Tags)
+
+		for _, f := range m.Fields {
+			h.trackSeries(m.Name+"."+f.Name, tags)
+		}
+	}
+
+	h.lastMeasure = time.Now()
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (h *Handler) Flush() {
+	h.mutex.Lock()
+	h.flushes++
+	h.lastFlush = time.Now()
+	h.mutex.Unlock()
+}
+
+func (h *Handler) trackSeries(name string, tags uint64) {
+	set := h.series[name]
+	if _, ok := set[tags]; ok {
+		return
+	}
+
+	if h.numSeries >= h.maxSeries {
+		h.truncated = true
+		return
+	}
+
+	if set == nil {
+		set = make(map[uint64]struct{})
+		h.series[name] = set
+	}
+
+	set[tags] = struct{}{}
+	h.numSeries++
+}
+
+func seriesHash(tags []stats.Tag) uint64 {
+	h := jody.Init64
+	for _, t := range tags {
+		h = jody.AddString64(h, t.Name)
+		h = jody.AddString64(h, "=")
+		h = jody.AddString64(h, t.Value)
+		h = jody.AddString64(h, ",")
+	}
+	return h
+}
+
+// ServeHTTP satisfies the http.Handler interface.
+func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == "GET", req.Method == "HEAD":
+		h.mux.ServeHTTP(res, req)
+	case req.Method == "POST" && h.controls != nil && req.URL.Path == "/debug/stats/controls":
+		h.mux.ServeHTTP(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveIndex(res http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/debug/stats/" {
+		http.NotFound(res, req)
+		return
+	}
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(res, "/debug/stats/engine\n/debug/stats/health\n/debug/stats/measures\n/debug/stats/cardinality\n/debug/stats/snapshot\n")
+	if h.controls != nil {
+		fmt.Fprint(res, "/debug/stats/controls\n")
+	}
+}
+
+type engineState struct {
+	Prefix     string            `json:"prefix"`
+	Tags       map[string]string `json:"tags"`
+	SampleRate float64           `json:"sample_rate,omitempty"`
+	Handler    string            `json:"handler"`
+}
+
+func (h *Handler) serveEngine(res http.ResponseWriter, _ *http.Request) {
+	state := engineState{
+		Prefix:     h.eng.Prefix,
+		Tags:       make(map[string]string, len(h.eng.Tags)),
+		SampleRate: h.eng.SampleRate,
+		Handler:    fmt.Sprintf("%T", h.eng.Handler),
+	}
+
+	for _, t := range h.eng.Tags {
+		state.Tags[t.Name] = t.Value
+	}
+
+	writeJSON(res, state)
+}
+
+type healthState struct {
+	Measures    uint64    `json:"measures"`
+	LastMeasure time.Time `json:"last_measure"`
+	Flushes     uint64    `json:"flushes"`
+	LastFlush   time.Time `json:"last_flush"`
+}
+
+func (h *Handler) serveHealth(res http.ResponseWriter, _ *http.Request) {
+	h.mutex.Lock()
+	state := healthState{
+		Measures:    h.measures,
+		LastMeasure: h.lastMeasure,
+		Flushes:     h.flushes,
+		LastFlush:   h.lastFlush,
+	}
+	h.mutex.Unlock()
+
+	writeJSON(res, state)
+}
+
+func (h *Handler) serveMeasures(res http.ResponseWriter, req *http.Request) {
+	var grep *regexp.Regexp
+
+	if s := req.URL.Query().Get("grep"); len(s) != 0 {
+		var err error
+		if grep, err = regexp.Compile(s); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.mutex.Lock()
+	lines := make([]string, 0, len(h.recent))
+	for i := range h.recent {
+		if s := h.recent[(h.next+i)%len(h.recent)]; len(s) != 0 {
+			lines = append(lines, s)
+		}
+	}
+	h.mutex.Unlock()
+
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	for _, s := range lines {
+		if grep == nil || grep.MatchString(s) {
+			_, _ = res.Write([]byte(s))
+		}
+	}
+}
+
+type metricCardinality struct {
+	Name   string `json:"name"`
+	Series int    `json:"series"`
+}
+
+type cardinalityState struct {
+	Series    int                 `json:"series"`
+	Truncated bool                `json:"truncated"`
+	Metrics   []metricCardinality `json:"metrics"`
+}
+
+func (h *Handler) serveCardinality(res http.ResponseWriter, req *http.Request) {
+	n := DefaultTopN
+
+	if s := req.URL.Query().Get("n"); len(s) != 0 {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil || n < 0 {
+			http.Error(res, "malformed n parameter, expected a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.mutex.Lock()
+	state := cardinalityState{
+		Series:    h.numSeries,
+		Truncated: h.truncated,
+		Metrics:   make([]metricCardinality, 0, len(h.series)),
+	}
+	for name, set := range h.series {
+		state.Metrics = append(state.Metrics, metricCardinality{Name: name, Series: len(set)})
+	}
+	h.mutex.Unlock()
+
+	sort.Slice(state.Metrics, func(i, j int) bool {
+		m1, m2 := state.Metrics[i], state.Metrics[j]
+		if m1.Series != m2.Series {
+			return m1.Series > m2.Series
+		}
+		return strings.Compare(m1.Name, m2.Name) < 0
+	})
+
+	if len(state.Metrics) > n {
+		state.Metrics = state.Metrics[:n]
+	}
+
+	writeJSON(res, state)
+}
+
+type metricSnapshot struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Tags       []string  `json:"tags"`
+	Count      uint64    `json:"count"`
+	LastReport time.Time `json:"last_report"`
+}
+
+type snapshotState struct {
+	Tracking bool             `json:"tracking"`
+	Metrics  []metricSnapshot `json:"metrics"`
+}
+
+// serveSnapshot renders the snapshot of the engine, which is empty unless
+// the TrackMetrics field of the engine is set.
+func (h *Handler) serveSnapshot(res http.ResponseWriter, _ *http.Request) {
+	snapshot := h.eng.Snapshot()
+	state := snapshotState{
+		Tracking: h.eng.TrackMetrics,
+		Metrics:  make([]metricSnapshot, 0, len(snapshot)),
+	}
+
+	for _, m := range snapshot {
+		name := m.Key.Measure
+		if len(m.Key.Field) != 0 {
+			name += "." + m.Key.Field
+		}
+		state.Metrics = append(state.Metrics, metricSnapshot{
+			Name:       name,
+			Type:       m.Type.String(),
+			Tags:       m.Tags,
+			Count:      m.Count,
+			LastReport: m.LastReport,
+		})
+	}
+
+	writeJSON(res, state)
+}
+
+type controlsState struct {
+	Verbose    bool    `json:"verbose"`
+	Debug      bool    `json:"debug"`
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+func (h *Handler) serveControls(res http.ResponseWriter, req *http.Request) {
+	if req.Method == "POST" {
+		if err := req.ParseForm(); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var verbose, debug bool
+		var rate float64
+		var err error
+
+		if s := req.PostForm.Get("verbose"); len(s) != 0 {
+			if verbose, err = strconv.ParseBool(s); err != nil {
+				http.Error(res, "malformed verbose value, expected a boolean", http.StatusBadRequest)
+				return
+			}
+		}
+		if s := req.PostForm.Get("debug"); len(s) != 0 {
+			if debug, err = strconv.ParseBool(s); err != nil {
+				http.Error(res, "malformed debug value, expected a boolean", http.StatusBadRequest)
+				return
+			}
+		}
+		if s := req.PostForm.Get("sample_rate"); len(s) != 0 {
+			if rate, err = strconv.ParseFloat(s, 64); err != nil {
+				http.Error(res, "malformed sample_rate value, expected a number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// The controls are only changed once all the values are valid.
+		if req.PostForm.Has("verbose") {
+			h.controls.SetVerbose(verbose)
+		}
+		if req.PostForm.Has("debug") {
+			h.controls.SetDebug(debug)
+		}
+		if req.PostForm.Has("sample_rate") {
+			h.controls.SetSampleRate(rate)
+		}
+	}
+
+	writeJSON(res, controlsState{
+		Verbose:    h.controls.Verbose(),
+		Debug:      h.controls.Debug(),
+		SampleRate: h.controls.SampleRate(),
+	})
+}
+
+func writeJSON(res http.ResponseWriter, v interface{}) {
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,195 @@
+package debugstats
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestMux(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := MuxWith(MuxConfig{RecentMeasures: 2, MaxSeries: 3})
+	h.eng = stats.NewEngine("app", h, stats.T("region", "us-west-2"))
+
+	h.eng.Incr("requests.count", stats.T("tenant", "a"))
+	h.eng.Incr("requests.count", stats.T("tenant", "b"))
+	h.eng.Incr("requests.count", stats.T("tenant", "b"))
+	h.eng.Set("queue.size", 42)
+	h.eng.Incr("requests.count", stats.T("tenant", "c"))
+	h.eng.Flush()
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	t.Run("engine", func(t *testing.T) {
+		var state engineState
+		getJSON(t, server.URL+"/debug/stats/engine", &state)
+
+		if state.Prefix != "app" {
+			t.Error("bad prefix:", state.Prefix)
+		}
+		if state.Tags["region"] != "us-west-2" {
+			t.Error("bad tags:", state.Tags)
+		}
+		if state.Handler != "*debugstats.Handler" {
+			t.Error("bad handler:", state.Handler)
+		}
+	})
+
+	t.Run("health", func(t *testing.T) {
+		var state healthState
+		getJSON(t, server.URL+"/debug/stats/health", &state)
+
+		if state.Measures != 5 || state.Flushes != 1 {
+			t.Errorf("bad health: %+v", state)
+		}
+		if state.LastMeasure.IsZero() || state.LastFlush.IsZero() {
+			t.Errorf("missing times: %+v", state)
+		}
+	})
+
+	t.Run("measures", func(t *testing.T) {
+		lines := strings.Split(strings.TrimSpace(get(t, server.URL+"/debug/stats/measures")), "\n")
+
+		if len(lines) != 2 {
+			t.Fatal("expected the 2 most recent measures, got", lines)
+		}
+		if !strings.HasSuffix(lines[0], " app.queue.size:42|g|#region:us-west-2") {
+			t.Error("bad first measure:", lines[0])
+		}
+		if !strings.HasSuffix(lines[1], "app.requests.count:1|c|#region:us-west-2,tenant:c") {
+			t.Error("bad second measure:", lines[1])
+		}
+
+		if s := get(t, server.URL+"/debug/stats/measures?grep=queue"); strings.Count(s, "\n") != 1 || !strings.Contains(s, "queue") {
+			t.Error("bad filtered measures:", s)
+		}
+	})
+
+	t.Run("cardinality", func(t *testing.T) {
+		var state cardinalityState
+		getJSON(t, server.URL+"/debug/stats/cardinality?n=1", &state)
+
+		if state.Series != 3 || !state.Truncated {
+			t.Errorf("bad series count: %+v", state)
+		}
+		if len(state.Metrics) != 1 || state.Metrics[0] != (metricCardinality{Name: "app.requests.count", Series: 2}) {
+			t.Errorf("bad top metrics: %+v", state.Metrics)
+		}
+	})
+}
+
+func get(t *testing.T, url string) string {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("bad status:", res.Status)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func getJSON(t *testing.T, url string, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal([]byte(get(t, url)), v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMuxControls(t *testing.T) {
+	c := stats.NewControls(stats.ControlsConfig{})
+	h := MuxWith(MuxConfig{Controls: c})
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	if s := get(t, server.URL+"/debug/stats/"); !strings.Contains(s, "/debug/stats/controls\n") {
+		t.Error("the controls endpoint is missing from the index:", s)
+	}
+
+	res, err := http.PostForm(server.URL+"/debug/stats/controls", map[string][]string{
+		"verbose":     {"true"},
+		"sample_rate": {"0.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state controlsState
+	err = json.NewDecoder(res.Body).Decode(&state)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != (controlsState{Verbose: true, SampleRate: 0.5}) {
+		t.Errorf("bad state: %+v", state)
+	}
+	if !c.Verbose() || c.Debug() || c.SampleRate() != 0.5 {
+		t.Error("the controls were not changed")
+	}
+
+	res, err = http.PostForm(server.URL+"/debug/stats/controls", map[string][]string{
+		"verbose": {"false"},
+		"debug":   {"maybe"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Error("bad status for a malformed value:", res.Status)
+	}
+	if !c.Verbose() {
+		t.Error("the controls were changed by a malformed request")
+	}
+
+	getJSON(t, server.URL+"/debug/stats/controls", &state)
+	if !state.Verbose {
+		t.Errorf("bad state: %+v", state)
+	}
+}
+
+func TestMuxSnapshot(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	eng := stats.NewEngine("app", stats.Discard)
+	eng.TrackMetrics = true
+	eng.Set("queue.size", 42, stats.T("queue", "jobs"))
+
+	server := httptest.NewServer(MuxWith(MuxConfig{Engine: eng}))
+	defer server.Close()
+
+	var state snapshotState
+	getJSON(t, server.URL+"/debug/stats/snapshot", &state)
+
+	if !state.Tracking || len(state.Metrics) != 1 {
+		t.Fatalf("bad snapshot: %+v", state)
+	}
+
+	m := state.Metrics[0]
+	if m.Name != "app.queue.size" || m.Type != "gauge" || m.Count != 1 || len(m.Tags) != 1 || m.Tags[0] != "queue" || m.LastReport.IsZero() {
+		t.Errorf("bad metric: %+v", m)
+	}
+}
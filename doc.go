@@ -1,3 +1,12 @@
 // Package stats exposes tools for producing application performance metrics
 // to various metric collection backends.
+//
+// Services that want baseline telemetry (Go runtime, process, and build
+// information metrics) can start it with a single call to
+// procstats.DefaultInstrumentation.
+//
+// Programs that need to strip instrumentation entirely, for example latency
+// critical binaries, can be compiled with the stats_noop build tag. Under this
+// tag the Engine methods producing measures do nothing, and the compiler is
+// able to eliminate the calls.
 package stats
@@ -1,6 +1,8 @@
 package stats
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -37,6 +39,38 @@ type Engine struct {
 	// which is a special use case.
 	AllowDuplicateTags bool
 
+	// SampleRate is the fraction of measures reported by the engine, values
+	// outside of the (0, 1) range disable sampling.
+	//
+	// Measures produced by the methods accepting a context are sampled from
+	// the sampling key of the context (see ContextWithSamplingKey), so all the
+	// measures of a request are reported or dropped together and the ratios
+	// between related metrics remain consistent. Other measures are sampled
+	// independently, at random.
+	//
+	// The values of sampled counters are divided by the rate, so that their
+	// sums remain unbiased estimates of the actual sums.
+	SampleRate float64
+
+	// Sequenced enables numbering the batches of measures passed to the
+	// handler, see SequencedHandler for the guarantees that the engine offers
+	// when it is set. Calls to the handler are serialized, which limits the
+	// throughput of programs producing measures from many goroutines.
+	Sequenced bool
+
+	// TrackMetrics enables recording the metrics produced by the engine, with
+	// the names of their tags and the time they were last reported, which are
+	// returned by Snapshot. Tracking takes a lock for each batch of measures,
+	// it is meant for debugging rather than for programs producing measures
+	// from many goroutines on hot paths.
+	TrackMetrics bool
+
+	// HandleTTL is how long the handles created by Engine.Counter,
+	// Engine.Gauge and Engine.Histogram remain cached after they were last
+	// reported, they are dropped on the first flush after it elapsed. Zero
+	// keeps handles cached until all their references are released.
+	HandleTTL time.Duration
+
 	// This cache keeps track of the generated measure structures to avoid
 	// rebuilding them every time a same measure type is seen by the engine.
 	//
@@ -44,6 +78,26 @@ type Engine struct {
 	// is why the cache must be local to the engine.
 	cache measureCache
 
+	// Caches the handles created by the engine, which include the engine
+	// prefix in their names, so it is local to the engine as well.
+	handles lazyHandleCache
+
+	// Notifies goroutines blocked in WaitForFlush, it is shared with the
+	// engines created by WithPrefix and WithTags.
+	flushes lazyFlushNotifier
+
+	// Tracks the gauges configured in GaugeTTLs to expire them on flushes, it
+	// is shared with the engines created by WithPrefix and WithTags.
+	gauges lazyGaugeTracker
+
+	// Numbers the batches of measures when Sequenced is set, it is shared
+	// with the engines created by WithPrefix and WithTags.
+	sequence lazySequencer
+
+	// Records the metrics returned by Snapshot when TrackMetrics is set, it
+	// is shared with the engines created by WithPrefix and WithTags.
+	metrics lazyMetricTracker
+
 	once sync.Once
 }
 
@@ -68,19 +122,107 @@ func (e *Engine) Register(handler Handler) {
 }
 
 // Flush flushes eng's handler (if it implements the Flusher interface).
+//
+// The gauges configured in GaugeTTLs which were not set within their TTL are
+// expired before the handler is flushed, and the handles which were released
+// or not reported within HandleTTL are dropped from the engine cache.
 func (e *Engine) Flush() {
-	flush(e.Handler)
+	done := e.flushes.load().begin()
+	now := time.Now()
+	e.gauges.load().expire(now, e.handleWith)
+	e.handles.load().release(now, e.HandleTTL)
+	if e.Sequenced {
+		e.sequence.load().flush(e.Handler)
+	} else {
+		flush(e.Handler)
+	}
+	done()
+}
+
+// WaitForFlush blocks until the next call to Flush on eng, or one of the
+// engines derived from it, completes, or until ctx is canceled. Flushes which
+// were already in progress when WaitForFlush was called are not waited on.
+//
+// Programs which exit shortly after producing metrics, like command line tools
+// and batch jobs, can use it to make sure that the metrics were handed to the
+// handlers by a background flushing goroutine before exiting.
+func (e *Engine) WaitForFlush(ctx context.Context) error {
+	select {
+	case <-e.flushes.load().wait():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartFlusher starts a goroutine which flushes eng every interval, until ctx
+// is canceled. The engine is flushed one last time when ctx is canceled, and
+// the returned channel is closed after that final flush completes.
+//
+// Programs typically cancel ctx on termination signals and wait on the channel
+// before exiting, so the metrics buffered by the handlers are not lost:
+//
+//	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+//	defer cancel()
+//
+//	done := stats.DefaultEngine.StartFlusher(ctx, time.Second)
+//	...
+//	<-ctx.Done()
+//	<-done
+//
+// The interval must be greater than zero.
+func (e *Engine) StartFlusher(ctx context.Context, interval time.Duration) <-chan struct{} {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.Flush()
+			case <-ctx.Done():
+				e.Flush()
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+// Close flushes the engine, then closes its handler if it implements
+// io.Closer, like the handler of the engines returned by Async. The handler is
+// shared with the engines created by WithPrefix and WithTags, they must not be
+// used after the engine was closed.
+func (e *Engine) Close() error {
+	e.Flush()
+	if c, ok := e.Handler.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
 }
 
 // WithPrefix returns a copy of the engine with prefix appended to eng's current
 // prefix and tags set to the merge of eng's current tags and those passed as
 // argument. Both eng and the returned engine share the same handler.
 func (e *Engine) WithPrefix(prefix string, tags ...Tag) *Engine {
-	return &Engine{
-		Handler: e.Handler,
-		Prefix:  e.makeName(prefix),
-		Tags:    mergeTags(e.Tags, tags),
+	sub := &Engine{
+		Handler:      e.Handler,
+		Prefix:       e.makeName(prefix),
+		Tags:         mergeTags(e.Tags, tags),
+		SampleRate:   e.SampleRate,
+		Sequenced:    e.Sequenced,
+		TrackMetrics: e.TrackMetrics,
+		HandleTTL:    e.HandleTTL,
 	}
+	sub.flushes.ptr.Store(e.flushes.load())
+	sub.gauges.ptr.Store(e.gauges.load())
+	sub.sequence.ptr.Store(e.sequence.load())
+	sub.metrics.ptr.Store(e.metrics.load())
+	return sub
 }
 
 // WithTags returns a copy of the engine with tags set to the merge of eng's
@@ -102,32 +244,101 @@ func (e *Engine) IncrAt(time time.Time, name string, tags ...Tag) {
 
 // Add increments by value the counter identified by name and tags.
 func (e *Engine) Add(name string, value interface{}, tags ...Tag) {
-	e.measure(time.Now(), name, value, Counter, tags...)
+	if noop {
+		return
+	}
+	e.measure(time.Now(), name, ValueOf(value), Counter, tags...)
 }
 
 // AddAt increments by value the counter identified by name and tags.
 func (e *Engine) AddAt(t time.Time, name string, value interface{}, tags ...Tag) {
-	e.measure(t, name, value, Counter, tags...)
+	e.measure(t, name, ValueOf(value), Counter, tags...)
 }
 
 // Set sets to value the gauge identified by name and tags.
 func (e *Engine) Set(name string, value interface{}, tags ...Tag) {
-	e.measure(time.Now(), name, value, Gauge, tags...)
+	if noop {
+		return
+	}
+	e.measure(time.Now(), name, ValueOf(value), Gauge, tags...)
 }
 
 // SetAt sets to value the gauge identified by name and tags.
 func (e *Engine) SetAt(t time.Time, name string, value interface{}, tags ...Tag) {
-	e.measure(t, name, value, Gauge, tags...)
+	e.measure(t, name, ValueOf(value), Gauge, tags...)
 }
 
 // Observe reports value for the histogram identified by name and tags.
 func (e *Engine) Observe(name string, value interface{}, tags ...Tag) {
-	e.measure(time.Now(), name, value, Histogram, tags...)
+	if noop {
+		return
+	}
+	e.measure(time.Now(), name, ValueOf(value), Histogram, tags...)
 }
 
 // ObserveAt reports value for the histogram identified by name and tags.
 func (e *Engine) ObserveAt(t time.Time, name string, value interface{}, tags ...Tag) {
-	e.measure(t, name, value, Histogram, tags...)
+	e.measure(t, name, ValueOf(value), Histogram, tags...)
+}
+
+// Distribute reports value for the distribution identified by name and tags.
+func (e *Engine) Distribute(name string, value interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.measure(time.Now(), name, ValueOf(value), Distribution, tags...)
+}
+
+// DistributeAt reports value for the distribution identified by name and tags.
+func (e *Engine) DistributeAt(t time.Time, name string, value interface{}, tags ...Tag) {
+	e.measure(t, name, ValueOf(value), Distribution, tags...)
+}
+
+// IncrContext increments by one the counter identified by name and tags,
+// sampling it with the sampling key of ctx. The tags set on ctx by
+// ContextWithTags are added to the counter.
+func (e *Engine) IncrContext(ctx context.Context, name string, tags ...Tag) {
+	e.AddContext(ctx, name, 1, tags...)
+}
+
+// AddContext increments by value the counter identified by name and tags,
+// sampling it with the sampling key of ctx. The tags set on ctx by
+// ContextWithTags are added to the counter.
+func (e *Engine) AddContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.measureContext(ctx, time.Now(), name, ValueOf(value), Counter, tags...)
+}
+
+// SetContext sets to value the gauge identified by name and tags, sampling it
+// with the sampling key of ctx. The tags set on ctx by ContextWithTags are added
+// to the gauge.
+func (e *Engine) SetContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.measureContext(ctx, time.Now(), name, ValueOf(value), Gauge, tags...)
+}
+
+// ObserveContext reports value for the histogram identified by name and tags,
+// sampling it with the sampling key of ctx. The tags set on ctx by
+// ContextWithTags are added to the histogram.
+func (e *Engine) ObserveContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.measureContext(ctx, time.Now(), name, ValueOf(value), Histogram, tags...)
+}
+
+// DistributeContext reports value for the distribution identified by name and
+// tags, sampling it with the sampling key of ctx. The tags set on ctx by
+// ContextWithTags are added to the distribution.
+func (e *Engine) DistributeContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.measureContext(ctx, time.Now(), name, ValueOf(value), Distribution, tags...)
 }
 
 // Clock returns a new clock identified by name and tags.
@@ -149,6 +360,26 @@ func (e *Engine) ClockAt(name string, start time.Time, tags ...Tag) *Clock {
 	}
 }
 
+// StartSpan returns a new span identified by name and tags, which reports the
+// duration of a block of code with the tags of ctx when finished:
+//
+//	defer eng.StartSpan(ctx, "db.query", stats.T("table", "users")).Finish()
+func (e *Engine) StartSpan(ctx context.Context, name string, tags ...Tag) *Span {
+	return e.StartSpanAt(ctx, name, time.Now(), tags...)
+}
+
+// StartSpanAt returns a new span identified by name and tags with a specified
+// start time.
+func (e *Engine) StartSpanAt(ctx context.Context, name string, start time.Time, tags ...Tag) *Span {
+	return &Span{
+		ctx:   ctx,
+		name:  name,
+		start: start,
+		tags:  copyTags(tags),
+		eng:   e,
+	}
+}
+
 var truthyValues = map[string]bool{
 	"true": true,
 	"TRUE": true,
@@ -194,45 +425,83 @@ func (e *Engine) reportVersionOnce(t time.Time) {
 				},
 			})
 		}
-		e.Handler.HandleMeasures(t, measures...)
+		e.handle(t, measures)
 	})
 }
 
-func (e *Engine) measure(t time.Time, name string, value interface{}, ftype FieldType, tags ...Tag) {
+func (e *Engine) measure(t time.Time, name string, value Value, ftype FieldType, tags ...Tag) {
+	e.measureContext(context.Background(), t, name, value, ftype, tags...)
+}
+
+func (e *Engine) measureContext(ctx context.Context, t time.Time, name string, value Value, ftype FieldType, tags ...Tag) {
+	if noop {
+		return
+	}
 	e.reportVersionOnce(t)
-	e.measureOne(t, name, value, ftype, tags...)
+	rate := e.sampleRate(name)
+	if sampling(rate) {
+		if !sample(ctx, rate) {
+			return
+		}
+		if ftype == Counter {
+			value = scaleValue(value, rate)
+		}
+	} else {
+		rate = 0
+	}
+	if x := getTagSlice(ctx); x != nil {
+		// Tags passed by the caller are appended last so they take precedence
+		// over the tags of the context when both have the same name.
+		tb := tagsPool.Get().(*tagsBuffer)
+		tb.tags = x.appendTo(tb.tags)
+		tb.append(tags...)
+		if !e.AllowDuplicateTags {
+			tb.sort()
+		}
+		e.measureOne(t, name, value, ftype, rate, tb.tags...)
+		tb.reset()
+		tagsPool.Put(tb)
+		return
+	}
+	e.measureOne(t, name, value, ftype, rate, tags...)
 }
 
-func (e *Engine) measureOne(t time.Time, name string, value interface{}, ftype FieldType, tags ...Tag) {
+func (e *Engine) measureOne(t time.Time, name string, value Value, ftype FieldType, rate float64, tags ...Tag) {
 	name, field := splitMeasureField(name)
 	mp := measureArrayPool.Get().(*[1]Measure)
 
 	m := &(*mp)[0]
-	m.Name = e.makeName(name) // TODO: figure out how to optimize this
-	m.Fields = append(m.Fields[:0], MakeField(field, value, ftype))
+	m.Name = e.makeName(name)
+	m.Fields = append(m.Fields[:0], makeField(field, value, ftype))
+	m.SampleRate = rate
 	m.Tags = append(m.Tags[:0], e.Tags...)
 	m.Tags = append(m.Tags, tags...)
 
 	if len(tags) != 0 && !e.AllowDuplicateTags && !TagsAreSorted(m.Tags) {
-		SortTags(m.Tags)
+		m.Tags = SortTags(m.Tags)
 	}
 
-	e.Handler.HandleMeasures(t, (*mp)[:]...)
-
-	for i := range m.Fields {
-		m.Fields[i] = Field{}
+	if ftype == Gauge {
+		e.trackGauges((*mp)[:])
 	}
 
-	for i := range m.Tags {
-		m.Tags[i] = Tag{}
-	}
+	e.handle(t, (*mp)[:])
 
-	m.Name = ""
+	m.reset()
 	measureArrayPool.Put(mp)
 }
 
 func (e *Engine) makeName(name string) string {
-	return concat(e.Prefix, name)
+	if len(e.Prefix) == 0 || len(name) == 0 {
+		return concat(e.Prefix, name)
+	}
+	// The name is assembled on the stack and only allocated the first time it
+	// is seen, all measures of the engine then share the interned string.
+	var a [128]byte
+	b := append(a[:0], e.Prefix...)
+	b = append(b, '.')
+	b = append(b, name...)
+	return internBytes(b)
 }
 
 var measureArrayPool = sync.Pool{
@@ -241,21 +510,51 @@ var measureArrayPool = sync.Pool{
 
 // Report calls ReportAt with time.Now() as first argument.
 func (e *Engine) Report(metrics interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
 	e.ReportAt(time.Now(), metrics, tags...)
 }
 
+// ReportContext reports a set of metrics like Report, sampling them with the
+// sampling key of ctx. The tags set on ctx by ContextWithTags are added to the
+// metrics.
+func (e *Engine) ReportContext(ctx context.Context, metrics interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.reportAt(ctx, time.Now(), metrics, tags...)
+}
+
 // ReportAt reports a set of metrics for a given time. The metrics must be of
 // type struct, pointer to struct, or a slice or array to one of those. See
 // MakeMeasures for details about how to make struct types exposing metrics.
+//
+// When the program is compiled with the stats_noop build tag, ReportAt and all
+// the other methods producing measures do nothing.
 func (e *Engine) ReportAt(t time.Time, metrics interface{}, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.reportAt(context.Background(), t, metrics, tags...)
+}
+
+func (e *Engine) reportAt(ctx context.Context, t time.Time, metrics interface{}, tags ...Tag) {
 	e.reportVersionOnce(t)
+	if !e.sample(ctx) {
+		return
+	}
 	var tb *tagsBuffer
+	x := getTagSlice(ctx)
 
-	if len(tags) == 0 {
+	if len(tags) == 0 && x == nil {
 		// fast path for the common case where there are no dynamic tags
 		tags = e.Tags
 	} else {
 		tb = tagsPool.Get().(*tagsBuffer)
+		if x != nil {
+			tb.tags = x.appendTo(tb.tags)
+		}
 		tb.append(tags...)
 		tb.append(e.Tags...)
 		if !e.AllowDuplicateTags {
@@ -268,18 +567,21 @@ func (e *Engine) ReportAt(t time.Time, metrics interface{}, tags ...Tag) {
 	mb.measures = appendMeasures(mb.measures[:0], &e.cache, e.Prefix, reflect.ValueOf(metrics), tags...)
 
 	ms := mb.measures
-	e.Handler.HandleMeasures(t, ms...)
-
-	for i := range ms {
-		ms[i].reset()
+	if e.sampling() {
+		scaleCounters(ms, e.SampleRate)
+		for i := range ms {
+			ms[i].SampleRate = e.SampleRate
+		}
 	}
+	e.trackGauges(ms)
+	e.handle(t, ms)
 
 	if tb != nil {
 		tb.reset()
 		tagsPool.Put(tb)
 	}
 
-	measurePool.Put(mb)
+	releaseMeasures(mb)
 }
 
 // DefaultEngine is the engine used by global helper functions.
@@ -295,6 +597,18 @@ func Flush() {
 	DefaultEngine.Flush()
 }
 
+// WaitForFlush blocks until the next flush of the default engine completes, or
+// until ctx is canceled.
+func WaitForFlush(ctx context.Context) error {
+	return DefaultEngine.WaitForFlush(ctx)
+}
+
+// StartFlusher starts a goroutine which flushes the default engine every
+// interval until ctx is canceled, see Engine.StartFlusher.
+func StartFlusher(ctx context.Context, interval time.Duration) <-chan struct{} {
+	return DefaultEngine.StartFlusher(ctx, interval)
+}
+
 // WithPrefix returns a copy of the engine with prefix appended to default
 // engine's current prefix and tags set to the merge of engine's current tags
 // and those passed as argument. Both the default engine and the returned engine
@@ -350,6 +664,51 @@ func ObserveAt(time time.Time, name string, value interface{}, tags ...Tag) {
 	DefaultEngine.ObserveAt(time, name, value, tags...)
 }
 
+// Distribute reports value for the distribution identified by name and tags.
+func Distribute(name string, value interface{}, tags ...Tag) {
+	DefaultEngine.Distribute(name, value, tags...)
+}
+
+// DistributeAt reports value for the distribution identified by name and tags.
+func DistributeAt(time time.Time, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.DistributeAt(time, name, value, tags...)
+}
+
+// IncrContext is a helper function that delegates to DefaultEngine.
+func IncrContext(ctx context.Context, name string, tags ...Tag) {
+	DefaultEngine.IncrContext(ctx, name, tags...)
+}
+
+// AddContext is a helper function that delegates to DefaultEngine.
+func AddContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.AddContext(ctx, name, value, tags...)
+}
+
+// SetContext is a helper function that delegates to DefaultEngine.
+func SetContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.SetContext(ctx, name, value, tags...)
+}
+
+// ObserveContext is a helper function that delegates to DefaultEngine.
+func ObserveContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.ObserveContext(ctx, name, value, tags...)
+}
+
+// DistributeContext is a helper function that delegates to DefaultEngine.
+func DistributeContext(ctx context.Context, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.DistributeContext(ctx, name, value, tags...)
+}
+
+// StartSpan is a helper function that delegates to DefaultEngine.
+func StartSpan(ctx context.Context, name string, tags ...Tag) *Span {
+	return DefaultEngine.StartSpan(ctx, name, tags...)
+}
+
+// ReportContext is a helper function that delegates to DefaultEngine.
+func ReportContext(ctx context.Context, metrics interface{}, tags ...Tag) {
+	DefaultEngine.ReportContext(ctx, metrics, tags...)
+}
+
 // Report is a helper function that delegates to DefaultEngine.
 func Report(metrics interface{}, tags ...Tag) {
 	DefaultEngine.Report(metrics, tags...)
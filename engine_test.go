@@ -1,9 +1,11 @@
 package stats_test
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -32,6 +34,14 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Flush calls Flush the handler's Flush method",
 			function: testEngineFlush,
 		},
+		{
+			scenario: "calling Engine.WaitForFlush returns after the next flush of the engine or a derived engine completes",
+			function: testEngineWaitForFlush,
+		},
+		{
+			scenario: "calling Engine.StartFlusher flushes the engine periodically and once more when the context is canceled",
+			function: testEngineStartFlusher,
+		},
 		{
 			scenario: "calling Engine.Incr produces a counter increment of one",
 			function: testEngineIncr,
@@ -48,6 +58,18 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Observe produces the expected histogram value",
 			function: testEngineObserve,
 		},
+		{
+			scenario: "calling Engine.Distribute produces the expected distribution value",
+			function: testEngineDistribute,
+		},
+		{
+			scenario: "calling Engine methods on metrics registered in stats.SampleRates samples them at their rate",
+			function: testEngineSampleRates,
+		},
+		{
+			scenario: "calling the context variants of Engine methods adds the tags of the context",
+			function: testEngineContextTags,
+		},
 		{
 			scenario: "calling Engine.Report produces the expected measures",
 			function: testEngineReport,
@@ -64,6 +86,10 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Clock produces expected metrics",
 			function: testEngineClock,
 		},
+		{
+			scenario: "calling Engine.StartSpan produces a duration tagged with the tags of the context",
+			function: testEngineStartSpan,
+		},
 		{
 			scenario: "calling Engine.WithTags produces expected tags",
 			function: testEngineWithTags,
@@ -72,6 +98,14 @@ func TestEngine(t *testing.T) {
 			scenario: "calling Engine.Incr produces expected tags when AllowDuplicateTags is set",
 			function: testEngineAllowDuplicateTags,
 		},
+		{
+			scenario: "calling Engine.IncrContext with a sampling rate samples all measures of a context together",
+			function: testEngineSampleContext,
+		},
+		{
+			scenario: "calling Engine.ReportContext with a sampling rate scales counters",
+			function: testEngineReportContextSampled,
+		},
 	}
 
 	initValue := stats.GoVersionReportingEnabled
@@ -91,6 +125,30 @@ func TestEngine(t *testing.T) {
 	})
 }
 
+func TestSampleRatesConcurrentUpdates(t *testing.T) {
+	e := stats.NewEngine("test", stats.Discard)
+	defer stats.SampleRates.Delete("test.updated.count")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i != 1000; i++ {
+			stats.SampleRates.Set("test.updated.count", 0.5)
+			stats.SampleRates.Delete("test.updated.count")
+		}
+	}()
+
+	for i := 0; i != 1000; i++ {
+		e.Incr("updated.count")
+	}
+	<-done
+
+	stats.SampleRates.Set("test.updated.count", 0.25)
+	if rate, ok := stats.SampleRates.Get("test.updated.count"); !ok || rate != 0.25 {
+		t.Errorf("bad sample rate: %g, %t", rate, ok)
+	}
+}
+
 func testEngineWithPrefix(t *testing.T, eng *stats.Engine) {
 	e2 := eng.WithPrefix("subtest", stats.T("command", "hello world"))
 
@@ -137,6 +195,149 @@ func testEngineFlush(t *testing.T, eng *stats.Engine) {
 	}
 }
 
+func testEngineStartFlusher(t *testing.T, eng *stats.Engine) {
+	h := eng.Handler.(*statstest.Handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := eng.StartFlusher(ctx, time.Millisecond)
+
+	for deadline := time.Now().Add(time.Second); h.FlushCalls() < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the engine to be flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	before := h.FlushCalls()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the flusher to stop")
+	}
+
+	n := h.FlushCalls()
+	if n <= before {
+		t.Error("the engine was not flushed when the context was canceled")
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if h.FlushCalls() != n {
+		t.Error("the engine was flushed after the flusher stopped")
+	}
+}
+
+func testEngineWaitForFlush(t *testing.T, eng *stats.Engine) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Flushes completed before the call are not waited on.
+	eng.Flush()
+
+	if err := eng.WaitForFlush(ctx); err != context.DeadlineExceeded {
+		t.Error("expected the wait to time out, got", err)
+	}
+
+	for _, flusher := range []*stats.Engine{eng, eng.WithPrefix("sub")} {
+		errc := make(chan error, 1)
+		go func() { errc <- eng.WaitForFlush(context.Background()) }()
+
+		// The goroutine may not be waiting yet when the first flushes happen,
+		// so the engine is flushed until it returns.
+		ticker := time.NewTicker(time.Millisecond)
+		timeout := time.After(time.Second)
+
+	wait:
+		for {
+			select {
+			case err := <-errc:
+				if err != nil {
+					t.Error(err)
+				}
+				break wait
+			case <-ticker.C:
+				flusher.Flush()
+			case <-timeout:
+				t.Fatal("WaitForFlush did not return")
+			}
+		}
+
+		ticker.Stop()
+	}
+}
+
+func testEngineSampleContext(t *testing.T, eng *stats.Engine) {
+	eng.SampleRate = 0.5
+
+	const requests = 1000
+	sampled := 0
+
+	for i := 0; i != requests; i++ {
+		h := eng.Handler.(*statstest.Handler)
+		h.Clear()
+
+		ctx := stats.ContextWithSamplingKey(context.Background(), strconv.Itoa(i))
+		eng.IncrContext(ctx, "requests")
+		eng.AddContext(ctx, "bytes", 10)
+		eng.ObserveContext(ctx, "size", 10)
+
+		switch measures := h.Measures(); len(measures) {
+		case 0:
+		case 3:
+			sampled++
+			if v := measures[0].Fields[0].Value.Float(); v != 2 {
+				t.Errorf("counter values must be scaled by the sampling rate: %v", measures[0])
+			}
+			if v := measures[1].Fields[0].Value.Float(); v != 20 {
+				t.Errorf("counter values must be scaled by the sampling rate: %v", measures[1])
+			}
+			if v := measures[2].Fields[0].Value.Int(); v != 10 {
+				t.Errorf("histogram values must not be scaled: %v", measures[2])
+			}
+		default:
+			t.Fatalf("measures of a same context must be sampled together: %v", measures)
+		}
+	}
+
+	if sampled < requests/4 || sampled > 3*requests/4 {
+		t.Errorf("bad number of sampled requests: %d/%d", sampled, requests)
+	}
+}
+
+func testEngineReportContextSampled(t *testing.T, eng *stats.Engine) {
+	eng.SampleRate = 0.25
+
+	// With a rate of 0.25, the odds of sampling none of the contexts are
+	// (3/4)^1000, the test fails rather than looping forever if sampling is
+	// broken.
+	const attempts = 1000
+
+	for i := 0; i != attempts && len(eng.Handler.(*statstest.Handler).Measures()) == 0; i++ {
+		ctx := stats.ContextWithSamplingKey(context.Background(), strconv.Itoa(i))
+		eng.ReportContext(ctx, &struct {
+			Count int           `metric:"count" type:"counter"`
+			Time  time.Duration `metric:"time" type:"counter"`
+			Size  int           `metric:"size" type:"gauge"`
+		}{Count: 1, Time: time.Second, Size: 3})
+	}
+
+	measures := eng.Handler.(*statstest.Handler).Measures()
+	if len(measures) == 0 {
+		t.Fatalf("no measures were sampled after %d attempts", attempts)
+	}
+	m := measures[0]
+
+	if v := m.Fields[0].Value.Float(); v != 4 {
+		t.Errorf("bad count: %v", m)
+	}
+	if v := m.Fields[1].Value.Duration(); v != 4*time.Second {
+		t.Errorf("bad time: %v", m)
+	}
+	if v := m.Fields[2].Value.Int(); v != 3 {
+		t.Errorf("bad size: %v", m)
+	}
+}
+
 func testEngineAllowDuplicateTags(t *testing.T, eng *stats.Engine) {
 	e2 := eng.WithTags()
 	e2.AllowDuplicateTags = true
@@ -232,6 +433,90 @@ func testEngineObserve(t *testing.T, eng *stats.Engine) {
 	)
 }
 
+func testEngineDistribute(t *testing.T, eng *stats.Engine) {
+	eng.Distribute("measure.size", 42)
+	eng.Distribute("measure.size", 10, stats.T("type", "testing"))
+
+	checkMeasuresEqual(t, eng,
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("size", 42, stats.Distribution)},
+			Tags:   []stats.Tag{stats.T("service", "test-service")},
+		},
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("size", 10, stats.Distribution)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("type", "testing")},
+		},
+	)
+}
+
+func testEngineSampleRates(t *testing.T, eng *stats.Engine) {
+	stats.SampleRates.Set("test.sampled.count", 0.5)
+	defer stats.SampleRates.Delete("test.sampled.count")
+
+	h := eng.Handler.(*statstest.Handler)
+	sampled := 0
+
+	for i := 0; i != 1000; i++ {
+		h.Clear()
+		eng.Incr("sampled.count")
+		eng.Incr("other.count")
+
+		switch measures := h.Measures(); len(measures) {
+		case 1:
+			if m := measures[0]; m.Name != "test.other" || m.SampleRate != 0 {
+				t.Fatalf("metrics not registered in stats.SampleRates must not be sampled: %v", m)
+			}
+		case 2:
+			sampled++
+			m := measures[0]
+			if m.SampleRate != 0.5 {
+				t.Fatalf("bad sample rate: %v", m)
+			}
+			if v := m.Fields[0].Value.Float(); v != 2 {
+				t.Fatalf("counter values must be scaled by the sampling rate: %v", m)
+			}
+		default:
+			t.Fatalf("bad measures: %v", measures)
+		}
+	}
+
+	if sampled < 250 || sampled > 750 {
+		t.Errorf("bad number of sampled measures: %d/1000", sampled)
+	}
+}
+
+func testEngineContextTags(t *testing.T, eng *stats.Engine) {
+	ctx := stats.ContextWithTags(context.Background(), stats.T("tenant", "acme"), stats.T("type", "context"))
+
+	m := struct {
+		Count int `metric:"count" type:"counter"`
+	}{42}
+
+	eng.IncrContext(ctx, "measure.count")
+	eng.ObserveContext(ctx, "measure.size", 1, stats.T("type", "testing"))
+	eng.ReportContext(ctx, m)
+
+	checkMeasuresEqual(t, eng,
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("tenant", "acme"), stats.T("type", "context")},
+		},
+		stats.Measure{
+			Name:   "test.measure",
+			Fields: []stats.Field{stats.MakeField("size", 1, stats.Histogram)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("tenant", "acme"), stats.T("type", "testing")},
+		},
+		stats.Measure{
+			Name:   "test",
+			Fields: []stats.Field{stats.MakeField("count", 42, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "test-service"), stats.T("tenant", "acme"), stats.T("type", "context")},
+		},
+	)
+}
+
 func testEngineReport(t *testing.T, eng *stats.Engine) {
 	m := struct {
 		Count int `metric:"count" type:"counter"`
@@ -335,6 +620,28 @@ func testEngineClock(t *testing.T, eng *stats.Engine) {
 	}
 }
 
+func testEngineStartSpan(t *testing.T, eng *stats.Engine) {
+	ctx := stats.ContextWithTags(context.Background(), stats.T("tenant", "acme"))
+	start := time.Now()
+
+	s := eng.StartSpanAt(ctx, "db.query", start, stats.T("table", "users"))
+	s.FinishAt(start.Add(time.Second), stats.T("result", "ok"))
+	s.FinishAt(start.Add(2 * time.Second)) // already finished, nothing is reported
+
+	checkMeasuresEqual(t, eng,
+		stats.Measure{
+			Name:   "test.db",
+			Fields: []stats.Field{stats.MakeField("query", time.Second, stats.Histogram)},
+			Tags: []stats.Tag{
+				stats.T("result", "ok"),
+				stats.T("service", "test-service"),
+				stats.T("table", "users"),
+				stats.T("tenant", "acme"),
+			},
+		},
+	)
+}
+
 func checkMeasuresEqual(t *testing.T, eng *stats.Engine, expected ...stats.Measure) {
 	found := measures(t, eng)
 	if !reflect.DeepEqual(found, expected) {
@@ -395,6 +702,18 @@ func BenchmarkEngine(b *testing.B) {
 					scenario: "Engine.Observe.1x",
 					function: benchmarkEngineObserve1x,
 				},
+				{
+					scenario: "CounterHandle.Add.1x",
+					function: benchmarkCounterHandleAdd1x,
+				},
+				{
+					scenario: "GaugeHandle.Set.1x",
+					function: benchmarkGaugeHandleSet1x,
+				},
+				{
+					scenario: "HistogramHandle.Observe.1x",
+					function: benchmarkHistogramHandleObserve1x,
+				},
 				{
 					scenario: "Engine.Add.10x",
 					function: benchmarkEngineAdd10x,
@@ -452,6 +771,27 @@ func benchmarkEngineObserve1x(pb *testing.PB, e *stats.Engine) {
 	}
 }
 
+func benchmarkCounterHandleAdd1x(pb *testing.PB, e *stats.Engine) {
+	c := e.Counter("calls")
+	for pb.Next() {
+		c.Add(1)
+	}
+}
+
+func benchmarkGaugeHandleSet1x(pb *testing.PB, e *stats.Engine) {
+	g := e.Gauge("calls")
+	for pb.Next() {
+		g.Set(1)
+	}
+}
+
+func benchmarkHistogramHandleObserve1x(pb *testing.PB, e *stats.Engine) {
+	h := e.Histogram("calls")
+	for pb.Next() {
+		h.Observe(1)
+	}
+}
+
 func benchmarkEngineAdd10x(pb *testing.PB, e *stats.Engine) {
 	for pb.Next() {
 		e.Add("calls", 1)
@@ -0,0 +1,138 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrorClassTag is the name of the tag set by CountError to the class of the
+// error it reports.
+const ErrorClassTag = "error_class"
+
+// ErrorCountName is the name of the counter incremented by CountError.
+const ErrorCountName = "errors.count"
+
+// Classes of errors recognized by ClassifyError.
+const (
+	ErrorClassCanceled   = "canceled"
+	ErrorClassTimeout    = "timeout"
+	ErrorClassEOF        = "eof"
+	ErrorClassNotExist   = "not_exist"
+	ErrorClassPermission = "permission"
+	ErrorClassNetwork    = "network"
+	ErrorClassOther      = "other"
+)
+
+// ErrorClassifier is the signature of functions classifying errors, they
+// return the class of err, or an empty string if they do not recognize it.
+//
+// Classes are used as tag values, classifiers must return one of a small set
+// of constant strings, never a string derived from the error message.
+type ErrorClassifier func(err error) string
+
+// ErrorClassOf returns an ErrorClassifier which classifies the errors matching
+// one of targets, as reported by errors.Is, in class.
+func ErrorClassOf(class string, targets ...error) ErrorClassifier {
+	return func(err error) string {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return class
+			}
+		}
+		return ""
+	}
+}
+
+var errorClassifiers struct {
+	mutex sync.Mutex
+	list  atomic.Pointer[[]ErrorClassifier]
+}
+
+// RegisterErrorClassifier adds c to the classifiers used by ClassifyError.
+//
+// Registered classifiers are tried in the order they were registered, before
+// the classification of standard errors, so programs can classify the errors
+// of their own packages, or refine the default classes. It is safe to call
+// concurrently with ClassifyError, usually from init functions.
+func RegisterErrorClassifier(c ErrorClassifier) {
+	errorClassifiers.mutex.Lock()
+	defer errorClassifiers.mutex.Unlock()
+
+	var list []ErrorClassifier
+	if p := errorClassifiers.list.Load(); p != nil {
+		list = append(list, *p...)
+	}
+	list = append(list, c)
+	errorClassifiers.list.Store(&list)
+}
+
+// ClassifyError returns the class of err, or an empty string if err is nil.
+//
+// The registered classifiers are tried first, errors which none of them
+// recognize are classified as:
+//
+//   - canceled, for context.Canceled,
+//   - timeout, for context.DeadlineExceeded, os.ErrDeadlineExceeded and
+//     network errors reporting a timeout,
+//   - eof, for io.EOF and io.ErrUnexpectedEOF,
+//   - not_exist and permission, for fs.ErrNotExist and fs.ErrPermission,
+//   - network, for other errors of the net package,
+//   - other, for all other errors.
+//
+// Wrapped errors are classified like the errors they wrap.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if p := errorClassifiers.list.Load(); p != nil {
+		for _, classify := range *p {
+			if class := classify(err); len(class) != 0 {
+				return class
+			}
+		}
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassEOF
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorClassNotExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorClassPermission
+	case netErr != nil:
+		return ErrorClassNetwork
+	default:
+		return ErrorClassOther
+	}
+}
+
+// CountError increments the errors.count counter, tagged with the class of
+// err returned by ClassifyError, and the tags of ctx. It does nothing if err
+// is nil, so it can be called unconditionally with the error returned by an
+// operation.
+func (e *Engine) CountError(ctx context.Context, err error, tags ...Tag) {
+	if noop || err == nil {
+		return
+	}
+	tags = append(tags[:len(tags):len(tags)], T(ErrorClassTag, ClassifyError(err)))
+	e.AddContext(ctx, ErrorCountName, 1, tags...)
+}
+
+// CountError is a helper function that delegates to DefaultEngine.
+func CountError(ctx context.Context, err error, tags ...Tag) {
+	DefaultEngine.CountError(ctx, err, tags...)
+}
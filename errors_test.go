@@ -0,0 +1,77 @@
+package stats_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+func init() {
+	stats.RegisterErrorClassifier(stats.ErrorClassOf("quota", errQuotaExceeded))
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{err: nil, class: ""},
+		{err: context.Canceled, class: stats.ErrorClassCanceled},
+		{err: fmt.Errorf("query: %w", context.DeadlineExceeded), class: stats.ErrorClassTimeout},
+		{err: os.ErrDeadlineExceeded, class: stats.ErrorClassTimeout},
+		{err: &net.DNSError{Err: "timeout", IsTimeout: true}, class: stats.ErrorClassTimeout},
+		{err: &net.DNSError{Err: "no such host", IsNotFound: true}, class: stats.ErrorClassNetwork},
+		{err: io.ErrUnexpectedEOF, class: stats.ErrorClassEOF},
+		{err: &os.PathError{Op: "open", Path: "/x", Err: os.ErrNotExist}, class: stats.ErrorClassNotExist},
+		{err: fmt.Errorf("write: %w", os.ErrPermission), class: stats.ErrorClassPermission},
+		{err: fmt.Errorf("request: %w", errQuotaExceeded), class: "quota"},
+		{err: errors.New("oops"), class: stats.ErrorClassOther},
+	}
+
+	for _, test := range tests {
+		if class := stats.ClassifyError(test.err); class != test.class {
+			t.Errorf("%v: bad class: %q != %q", test.err, class, test.class)
+		}
+	}
+}
+
+func TestEngineCountError(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+
+	ctx := stats.ContextWithTags(context.Background(), stats.T("route", "/api"))
+	e.CountError(ctx, nil)
+	e.CountError(ctx, context.Canceled, stats.T("op", "read"))
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatalf("bad number of measures: %d", len(measures))
+	}
+
+	m := measures[0]
+	if m.Name != "test.errors" || m.Fields[0].Name != "count" || m.Fields[0].Value.Int() != 1 {
+		t.Errorf("bad measure: %v", m)
+	}
+
+	if !reflect.DeepEqual(m.Tags, []stats.Tag{
+		stats.T("error_class", "canceled"),
+		stats.T("op", "read"),
+		stats.T("route", "/api"),
+	}) {
+		t.Errorf("bad tags: %v", m.Tags)
+	}
+}
@@ -0,0 +1,170 @@
+package stats
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExemplarHandler is implemented by handlers which attach the values of some
+// tags to individual observations as exemplars, instead of using them as
+// labels of the series, like the prometheus handler.
+type ExemplarHandler interface {
+	Handler
+
+	// ExemplarTag returns true if the handler turns the tags named name into
+	// exemplars.
+	ExemplarTag(name string) bool
+}
+
+// TagNames is a registry storing a set of tag names. It is safe to use
+// concurrently from multiple goroutines. The zero value is an empty set.
+type TagNames struct {
+	mutex sync.Mutex // serializes updates
+	names atomic.Pointer[map[string]struct{}]
+}
+
+// Add adds name to the set.
+func (r *TagNames) Add(name string) {
+	r.update(func(names map[string]struct{}) { names[name] = struct{}{} })
+}
+
+// Delete removes name from the set.
+func (r *TagNames) Delete(name string) {
+	r.update(func(names map[string]struct{}) { delete(names, name) })
+}
+
+// Has returns true if name is in the set.
+func (r *TagNames) Has(name string) bool {
+	_, ok := r.load()[name]
+	return ok
+}
+
+// load returns the current names, the map must not be modified.
+func (r *TagNames) load() map[string]struct{} {
+	if names := r.names.Load(); names != nil {
+		return *names
+	}
+	return nil
+}
+
+// update applies f to a copy of the names and publishes it, readers never see
+// the map being modified.
+func (r *TagNames) update(f func(map[string]struct{})) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	names := maps.Clone(r.load())
+	if names == nil {
+		names = make(map[string]struct{})
+	}
+	f(names)
+	r.names.Store(&names)
+}
+
+// ExemplarTags is the registry of the names of tags which only carry exemplar
+// data, like trace IDs. Each observation has its own value for those tags, so
+// using them as labels would create a series per observation.
+//
+// Engines remove those tags from the measures passed to handlers which do not
+// implement ExemplarHandler, or do not turn the tags into exemplars. Handlers
+// combined by MultiHandler are considered individually, handlers wrapping
+// other handlers receive the measures without the tags.
+var ExemplarTags TagNames
+
+// exemplarDispatcher is the handler that engines pass measures carrying
+// exemplar tags to, it removes the tags for the handlers which do not turn
+// them into exemplars.
+type exemplarDispatcher struct {
+	handler Handler
+	names   map[string]struct{}
+}
+
+func (d *exemplarDispatcher) HandleMeasures(t time.Time, measures ...Measure) {
+	d.dispatch(d.handler, 0, t, measures)
+}
+
+func (d *exemplarDispatcher) HandleSequencedMeasures(seq uint64, t time.Time, measures ...Measure) {
+	d.dispatch(d.handler, seq, t, measures)
+}
+
+func (d *exemplarDispatcher) dispatch(h Handler, seq uint64, t time.Time, measures []Measure) {
+	var keep func(string) bool
+
+	switch x := h.(type) {
+	case *multiHandler:
+		for _, h := range x.handlers {
+			d.dispatch(h, seq, t, measures)
+		}
+		return
+	case ExemplarHandler:
+		keep = x.ExemplarTag
+	}
+
+	measures = removeTags(measures, d.names, keep)
+
+	if seq != 0 {
+		handleSequenced(h, seq, t, measures)
+	} else {
+		h.HandleMeasures(t, measures...)
+	}
+}
+
+// hasTagNames returns true if one of the measures has a tag named by names.
+func hasTagNames(measures []Measure, names map[string]struct{}) bool {
+	for i := range measures {
+		for _, tag := range measures[i].Tags {
+			if _, ok := names[tag.Name]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeTags returns measures without the tags named by names, except those
+// for which keep returns true. The measures are copied if tags are removed.
+func removeTags(measures []Measure, names map[string]struct{}, keep func(string) bool) []Measure {
+	remove := func(name string) bool {
+		_, ok := names[name]
+		return ok && (keep == nil || !keep(name))
+	}
+
+	var removed []Measure
+
+	for i, m := range measures {
+		n := 0
+		for _, tag := range m.Tags {
+			if remove(tag.Name) {
+				n++
+			}
+		}
+
+		if n == 0 {
+			if removed != nil {
+				removed = append(removed, m)
+			}
+			continue
+		}
+
+		if removed == nil {
+			removed = append(make([]Measure, 0, len(measures)), measures[:i]...)
+		}
+
+		tags := make([]Tag, 0, len(m.Tags)-n)
+		for _, tag := range m.Tags {
+			if !remove(tag.Name) {
+				tags = append(tags, tag)
+			}
+		}
+
+		m.Tags = tags
+		removed = append(removed, m)
+	}
+
+	if removed == nil {
+		return measures
+	}
+	return removed
+}
@@ -0,0 +1,55 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+type exemplarHandler struct {
+	statstest.Handler
+}
+
+func (h *exemplarHandler) ExemplarTag(name string) bool {
+	return name == "trace_id"
+}
+
+type sequencedExemplarHandler struct {
+	exemplarHandler
+	seqs []uint64
+}
+
+func (h *sequencedExemplarHandler) HandleSequencedMeasures(seq uint64, t time.Time, measures ...stats.Measure) {
+	h.seqs = append(h.seqs, seq)
+	h.HandleMeasures(t, measures...)
+}
+
+func TestExemplarTags(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	stats.ExemplarTags.Add("trace_id")
+	defer stats.ExemplarTags.Delete("trace_id")
+
+	for _, sequenced := range []bool{false, true} {
+		exemplars := &sequencedExemplarHandler{}
+		plain := &statstest.Handler{}
+		e := stats.NewEngine("test", stats.MultiHandler(exemplars, plain))
+		e.Sequenced = sequenced
+
+		e.Incr("calls", stats.T("route", "/"), stats.T("trace_id", "abc"))
+
+		if m := exemplars.Measures(); len(m) != 1 || len(m[0].Tags) != 2 {
+			t.Errorf("sequenced=%t: exemplar tags must be passed to exemplar handlers: %v", sequenced, m)
+		}
+		if m := plain.Measures(); len(m) != 1 || len(m[0].Tags) != 1 || m[0].Tags[0] != stats.T("route", "/") {
+			t.Errorf("sequenced=%t: exemplar tags must be removed for other handlers: %v", sequenced, m)
+		}
+		if n := len(exemplars.seqs); sequenced != (n == 1) {
+			t.Errorf("sequenced=%t: bad sequence numbers: %v", sequenced, exemplars.seqs)
+		}
+	}
+}
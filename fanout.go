@@ -0,0 +1,242 @@
+package stats
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultFanOutQueueSize is the default number of batches of measures
+	// queued for each handler of a FanOutHandler.
+	DefaultFanOutQueueSize = 1024
+
+	// DefaultFanOutFlushTimeout is the default maximum amount of time that
+	// flushing a FanOutHandler waits for each handler.
+	DefaultFanOutFlushTimeout = 5 * time.Second
+)
+
+// FanOutConfig carries the configuration of handlers created by FanOutWith.
+type FanOutConfig struct {
+	// Number of batches of measures queued for each handler, defaults to
+	// DefaultFanOutQueueSize.
+	QueueSize int
+
+	// Maximum amount of time HandleMeasures waits for room in the queue of a
+	// handler before dropping the measures. By default measures are dropped
+	// immediately when a queue is full, so a slow handler never stalls the
+	// program.
+	EnqueueTimeout time.Duration
+
+	// Maximum amount of time Flush waits for each handler to process its
+	// queue and flush, defaults to DefaultFanOutFlushTimeout.
+	FlushTimeout time.Duration
+
+	// Engine the number of dropped measures is reported to when the handler
+	// is flushed, defaults to DefaultEngine.
+	Engine *Engine
+}
+
+// FanOut returns a handler dispatching measures to all given handlers
+// concurrently, see FanOutWith.
+func FanOut(handlers ...Handler) *FanOutHandler {
+	return FanOutWith(FanOutConfig{}, handlers...)
+}
+
+// FanOutWith returns a handler dispatching measures to all given handlers
+// concurrently. Unlike MultiHandler, each handler receives the measures from
+// its own goroutine and bounded queue, so a slow or blocked backend does not
+// delay the program or the other backends; its measures are dropped when its
+// queue is full.
+//
+// The number of measures dropped for each handler is reported to the engine
+// of config when the handler is flushed, as the stats.fanout.dropped.count
+// metric tagged with the type of the handler.
+//
+// The handler must be closed to release its goroutines.
+func FanOutWith(config FanOutConfig, handlers ...Handler) *FanOutHandler {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultFanOutQueueSize
+	}
+
+	if config.FlushTimeout <= 0 {
+		config.FlushTimeout = DefaultFanOutFlushTimeout
+	}
+
+	if config.Engine == nil {
+		config.Engine = DefaultEngine
+	}
+
+	f := &FanOutHandler{
+		config:  config,
+		outputs: make([]*fanOutput, 0, len(handlers)),
+	}
+
+	for _, h := range handlers {
+		if h == nil {
+			continue
+		}
+
+		o := &fanOutput{
+			handler: h,
+			queue:   make(chan fanOutBatch, config.QueueSize),
+			done:    make(chan struct{}),
+		}
+
+		f.outputs = append(f.outputs, o)
+		go o.run()
+	}
+
+	return f
+}
+
+// FanOutHandler is a handler dispatching measures to several handlers
+// concurrently, see FanOutWith.
+type FanOutHandler struct {
+	config  FanOutConfig
+	outputs []*fanOutput
+	mutex   sync.RWMutex
+	closed  bool
+}
+
+type fanOutBatch struct {
+	time     time.Time
+	measures []Measure
+	flushed  chan<- struct{} // set on flush requests
+}
+
+type fanOutput struct {
+	handler Handler
+	queue   chan fanOutBatch
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+func (o *fanOutput) run() {
+	defer close(o.done)
+
+	for b := range o.queue {
+		if b.flushed != nil {
+			flush(o.handler)
+			close(b.flushed)
+		} else {
+			o.handler.HandleMeasures(b.time, b.measures...)
+		}
+	}
+}
+
+func (o *fanOutput) enqueue(b fanOutBatch, timeout time.Duration) bool {
+	select {
+	case o.queue <- b:
+		return true
+	default:
+	}
+
+	if timeout <= 0 {
+		return false
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case o.queue <- b:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// HandleMeasures satisfies the Handler interface. The measures are copied
+// since the handlers receive them after the method returned.
+func (f *FanOutHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	if len(measures) == 0 {
+		return
+	}
+
+	// The handlers must treat measures as read-only, a single copy is shared
+	// by all of them.
+	b := fanOutBatch{time: t, measures: CloneMeasures(measures)}
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.closed {
+		return
+	}
+
+	for _, o := range f.outputs {
+		if !o.enqueue(b, f.config.EnqueueTimeout) {
+			o.dropped.Add(int64(len(measures)))
+		}
+	}
+}
+
+// Flush satisfies the Flusher interface. It waits for the handlers to process
+// the measures queued before the call and to flush, up to FlushTimeout per
+// handler, then reports the number of dropped measures.
+func (f *FanOutHandler) Flush() {
+	acks := make([]chan struct{}, len(f.outputs))
+
+	f.mutex.RLock()
+	if !f.closed {
+		for i, o := range f.outputs {
+			ack := make(chan struct{})
+			if o.enqueue(fanOutBatch{flushed: ack}, f.config.FlushTimeout) {
+				acks[i] = ack
+			}
+		}
+	}
+	f.mutex.RUnlock()
+
+	deadline := time.NewTimer(f.config.FlushTimeout)
+	defer deadline.Stop()
+	expired := false
+
+	for _, ack := range acks {
+		if ack == nil || expired {
+			continue
+		}
+		select {
+		case <-ack:
+		case <-deadline.C:
+			expired = true
+		}
+	}
+
+	for _, o := range f.outputs {
+		if n := o.dropped.Swap(0); n != 0 {
+			f.config.Engine.Add("stats.fanout.dropped.count", n,
+				T("handler", fmt.Sprintf("%T", o.handler)),
+			)
+		}
+	}
+}
+
+// Close stops dispatching measures, and waits for the handlers to process
+// the measures that were already queued.
+func (f *FanOutHandler) Close() error {
+	f.mutex.Lock()
+	if !f.closed {
+		f.closed = true
+		for _, o := range f.outputs {
+			close(o.queue)
+		}
+	}
+	f.mutex.Unlock()
+
+	for _, o := range f.outputs {
+		<-o.done
+	}
+	return nil
+}
+
+// Handlers returns the handlers that f dispatches measures to.
+func (f *FanOutHandler) Handlers() []Handler {
+	handlers := make([]Handler, len(f.outputs))
+	for i, o := range f.outputs {
+		handlers[i] = o.handler
+	}
+	return handlers
+}
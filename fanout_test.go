@@ -0,0 +1,64 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOut(t *testing.T) {
+	t.Run("measures are dispatched to all handlers", func(t *testing.T) {
+		h1 := &statstest.Handler{}
+		h2 := &statstest.Handler{}
+		f := stats.FanOutWith(stats.FanOutConfig{Engine: stats.NewEngine("", stats.Discard)}, h1, h2)
+		defer f.Close()
+
+		m := stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}}
+		f.HandleMeasures(time.Now(), m)
+		f.Flush()
+
+		for _, h := range []*statstest.Handler{h1, h2} {
+			assert.Equal(t, []stats.Measure{m}, h.Measures())
+			assert.EqualValues(t, 1, h.FlushCalls())
+		}
+	})
+
+	t.Run("a blocked handler does not stall the others and its measures are dropped", func(t *testing.T) {
+		unblock := make(chan struct{})
+		blocked := stats.HandlerFunc(func(time.Time, ...stats.Measure) { <-unblock })
+		h := &statstest.Handler{}
+		e := &statstest.Handler{}
+
+		f := stats.FanOutWith(stats.FanOutConfig{
+			QueueSize:    1,
+			FlushTimeout: 50 * time.Millisecond,
+			Engine:       stats.NewEngine("", e),
+		}, h, blocked)
+
+		m := stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}}
+		for i := 0; i != 5; i++ {
+			f.HandleMeasures(time.Now(), m)
+			f.Flush()
+		}
+
+		assert.Len(t, h.Measures(), 5)
+
+		dropped := int64(0)
+		for _, m := range e.Measures() {
+			if m.Name == "stats.fanout.dropped" {
+				dropped += m.Fields[0].Value.Int()
+				assert.Equal(t, []stats.Tag{stats.T("handler", "stats.HandlerFunc")}, m.Tags)
+			}
+		}
+		// The blocked handler holds the first measure and the flush request
+		// sits in its queue, the next measures are dropped.
+		assert.EqualValues(t, 4, dropped)
+
+		close(unblock)
+		f.Close()
+	})
+}
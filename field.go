@@ -10,7 +10,11 @@ type Field struct {
 
 // MakeField constructs and returns a new Field from name, value, and ftype.
 func MakeField(name string, value interface{}, ftype FieldType) Field {
-	f := Field{Name: name, Value: MustValueOf(ValueOf(value))}
+	return makeField(name, ValueOf(value), ftype)
+}
+
+func makeField(name string, value Value, ftype FieldType) Field {
+	f := Field{Name: name, Value: MustValueOf(value)}
 	f.setType(ftype)
 	return f
 }
@@ -53,6 +57,11 @@ const (
 
 	// Histogram represents metrics to observe the distribution of values.
 	Histogram
+
+	// Distribution represents histograms which are aggregated by the metrics
+	// backend across all hosts, instead of by each program. Handlers which
+	// have no such concept treat them as histograms.
+	Distribution
 )
 
 func (t FieldType) String() string {
@@ -63,6 +72,8 @@ func (t FieldType) String() string {
 		return "gauge"
 	case Histogram:
 		return "histogram"
+	case Distribution:
+		return "distribution"
 	}
 	return ""
 }
@@ -76,6 +87,8 @@ func (t FieldType) GoString() string {
 		return "stats.Gauge"
 	case Histogram:
 		return "stats.Histogram"
+	case Distribution:
+		return "stats.Distribution"
 	default:
 		return "stats.FieldType(" + strconv.Itoa(int(t)) + ")"
 	}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flushNotifier lets goroutines wait for the completion of the next flush of
+// an engine.
+//
+// Each flush takes ownership of the channel that waiters are blocked on when
+// it starts, and closes it when it completes, so waiters are only released by
+// flushes which started after they began waiting.
+type flushNotifier struct {
+	mutex sync.Mutex
+	next  chan struct{}
+}
+
+func (n *flushNotifier) wait() <-chan struct{} {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.next == nil {
+		n.next = make(chan struct{})
+	}
+	return n.next
+}
+
+func (n *flushNotifier) begin() (done func()) {
+	n.mutex.Lock()
+	next := n.next
+	n.next = nil
+	n.mutex.Unlock()
+
+	if next == nil {
+		return func() {}
+	}
+	return func() { close(next) }
+}
+
+// lazyFlushNotifier is embedded in engines, which may be constructed as
+// struct literals, to create their notifier on first use.
+type lazyFlushNotifier struct {
+	ptr atomic.Pointer[flushNotifier]
+}
+
+func (l *lazyFlushNotifier) load() *flushNotifier {
+	if n := l.ptr.Load(); n != nil {
+		return n
+	}
+	l.ptr.CompareAndSwap(nil, new(flushNotifier))
+	return l.ptr.Load()
+}
@@ -0,0 +1,130 @@
+package grafana
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// HandlerConfig is used to configure the access control of handlers
+// implementing the simple-json-datasource API, when they are exposed to Grafana
+// instances outside of the network of the service.
+type HandlerConfig struct {
+	// Tokens is the list of tokens that requests must present in their
+	// Authorization header, as "Bearer <token>". Requests are not
+	// authenticated when the list is empty.
+	Tokens []string
+
+	// AllowedNetworks is the list of networks that requests are accepted from,
+	// matched against the remote address of the connection (forwarding headers
+	// like X-Forwarded-For are not trusted). Requests are accepted from any
+	// address when the list is empty.
+	AllowedNetworks []netip.Prefix
+
+	// AllowedOrigins is the list of origins, like "https://grafana.local",
+	// that browsers are allowed to send requests from. Requests with an Origin
+	// header which is not in the list are rejected, "*" allows any origin.
+	// The default is to allow any origin.
+	AllowedOrigins []string
+}
+
+// accessHandler is an http.Handler decorator applying the access control of a
+// HandlerConfig to the requests it receives.
+type accessHandler struct {
+	config  HandlerConfig
+	handler http.Handler
+}
+
+func newAccessHandler(config HandlerConfig, handler http.Handler) http.Handler {
+	if len(config.AllowedOrigins) == 0 {
+		config.AllowedOrigins = []string{"*"}
+	}
+	return &accessHandler{config: config, handler: handler}
+}
+
+func (a *accessHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if !a.allowAddr(req.RemoteAddr) {
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	origin := req.Header.Get("Origin")
+	if len(origin) != 0 && !a.allowOrigin(origin) {
+		res.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	allowHeaders := "Accept, Content-Type"
+	if len(a.config.Tokens) != 0 {
+		allowHeaders += ", Authorization"
+	}
+
+	// The handlers only set the default CORS headers when they were not
+	// already set here.
+	h := res.Header()
+	h.Set("Access-Control-Allow-Headers", allowHeaders)
+	h.Set("Access-Control-Allow-Methods", "POST")
+	h.Add("Vary", "Origin")
+	if len(origin) != 0 {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	// Browsers do not send credentials in preflight requests, they must be
+	// answered for the actual requests to be made.
+	if req.Method != http.MethodOptions && !a.allowToken(req.Header.Get("Authorization")) {
+		h.Set("WWW-Authenticate", `Bearer realm="stats/grafana"`)
+		res.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	a.handler.ServeHTTP(res, req)
+}
+
+func (a *accessHandler) allowAddr(remoteAddr string) bool {
+	if len(a.config.AllowedNetworks) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := addr.Addr().Unmap()
+
+	for _, network := range a.config.AllowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *accessHandler) allowOrigin(origin string) bool {
+	for _, allowed := range a.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *accessHandler) allowToken(authorization string) bool {
+	if len(a.config.Tokens) == 0 {
+		return true
+	}
+
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "Bearer") || len(token) == 0 {
+		return false
+	}
+
+	// All tokens are compared so the time taken does not reveal which one
+	// matched.
+	match := 0
+	for _, t := range a.config.Tokens {
+		match |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+	}
+	return match == 1
+}
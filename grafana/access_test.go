@@ -0,0 +1,160 @@
+package grafana
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestAccessHandler(t *testing.T) {
+	search := SearchHandlerFunc(func(_ context.Context, res SearchResponse, _ *SearchRequest) error {
+		res.WriteTarget("A")
+		return nil
+	})
+
+	handler := newAccessHandler(HandlerConfig{
+		Tokens:          []string{"secret", "other"},
+		AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		AllowedOrigins:  []string{"https://grafana.local"},
+	}, NewSearchHandler(search))
+
+	tests := []struct {
+		scenario   string
+		method     string
+		remoteAddr string
+		origin     string
+		token      string
+		status     int
+		allowed    string
+	}{
+		{
+			scenario:   "authenticated requests from allowed networks are served",
+			method:     http.MethodPost,
+			remoteAddr: "10.1.2.3:4567",
+			token:      "secret",
+			status:     http.StatusOK,
+		},
+		{
+			scenario:   "all tokens are accepted",
+			method:     http.MethodPost,
+			remoteAddr: "10.1.2.3:4567",
+			token:      "other",
+			status:     http.StatusOK,
+		},
+		{
+			scenario:   "requests with an invalid token are rejected",
+			method:     http.MethodPost,
+			remoteAddr: "10.1.2.3:4567",
+			token:      "wrong",
+			status:     http.StatusUnauthorized,
+		},
+		{
+			scenario:   "requests without a token are rejected",
+			method:     http.MethodPost,
+			remoteAddr: "10.1.2.3:4567",
+			status:     http.StatusUnauthorized,
+		},
+		{
+			scenario:   "requests from other networks are rejected",
+			method:     http.MethodPost,
+			remoteAddr: "192.168.0.1:4567",
+			token:      "secret",
+			status:     http.StatusForbidden,
+		},
+		{
+			scenario:   "IPv4-mapped IPv6 addresses are matched",
+			method:     http.MethodPost,
+			remoteAddr: "[::ffff:10.1.2.3]:4567",
+			token:      "secret",
+			status:     http.StatusOK,
+		},
+		{
+			scenario:   "requests from allowed origins are served",
+			method:     http.MethodPost,
+			remoteAddr: "10.1.2.3:4567",
+			origin:     "https://grafana.local",
+			token:      "secret",
+			status:     http.StatusOK,
+			allowed:    "https://grafana.local",
+		},
+		{
+			scenario:   "requests from other origins are rejected",
+			method:     http.MethodPost,
+			remoteAddr: "10.1.2.3:4567",
+			origin:     "https://evil.local",
+			token:      "secret",
+			status:     http.StatusForbidden,
+		},
+		{
+			scenario:   "preflight requests are not authenticated",
+			method:     http.MethodOptions,
+			remoteAddr: "10.1.2.3:4567",
+			origin:     "https://grafana.local",
+			status:     http.StatusOK,
+			allowed:    "https://grafana.local",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/search", strings.NewReader(`{"target":""}`))
+			req.RemoteAddr = test.remoteAddr
+			if len(test.origin) != 0 {
+				req.Header.Set("Origin", test.origin)
+			}
+			if len(test.token) != 0 {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			if res.Code != test.status {
+				t.Errorf("bad status: %d != %d", res.Code, test.status)
+			}
+
+			if allowed := res.Header().Get("Access-Control-Allow-Origin"); allowed != test.allowed {
+				t.Errorf("bad allowed origin: %q != %q", allowed, test.allowed)
+			}
+
+			if test.status == http.StatusUnauthorized && len(res.Header().Get("WWW-Authenticate")) == 0 {
+				t.Error("missing WWW-Authenticate header")
+			}
+
+			if test.status == http.StatusOK && test.method == http.MethodPost {
+				if body := res.Body.String(); body != `["A"]` {
+					t.Errorf("bad body: %s", body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerDefaultAccess(t *testing.T) {
+	server := httptest.NewServer(NewHandlerWith("grafana", nil, HandlerConfig{}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodOptions, server.URL+"/grafana/query", nil)
+	req.Header.Set("Origin", "https://grafana.local")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("bad status: %d", res.StatusCode)
+	}
+
+	if allowed := res.Header.Get("Access-Control-Allow-Origin"); allowed != "https://grafana.local" {
+		t.Errorf("bad allowed origin: %q", allowed)
+	}
+
+	if allowHeaders := res.Header.Get("Access-Control-Allow-Headers"); allowHeaders != "Accept, Content-Type" {
+		t.Errorf("bad allowed headers: %q", allowHeaders)
+	}
+}
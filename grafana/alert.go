@@ -0,0 +1,161 @@
+package grafana
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertState is the state of an alert, as named by Grafana.
+type AlertState string
+
+const (
+	// AlertFiring is the state of alerts whose rule is violated.
+	AlertFiring AlertState = "firing"
+
+	// AlertResolved is the state of alerts whose rule stopped being violated.
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert represents a threshold rule which started or stopped being violated.
+type Alert struct {
+	// Name of the rule that produced the alert.
+	Rule string
+
+	// State of the alert, firing or resolved.
+	State AlertState
+
+	// Time at which the alert changed state.
+	Time time.Time
+
+	// Value which was compared to the threshold of the rule.
+	Value float64
+
+	// Threshold of the rule.
+	Threshold float64
+
+	// Message is a human readable description of the alert.
+	Message string
+
+	// Labels identify the series that the alert was produced for, for
+	// example the tags of the measures that the rule evaluated.
+	Labels map[string]string
+}
+
+// AlertNotifier is an interface implemented by types which publish alerts, so
+// the code evaluating threshold rules does not need to know where they go.
+type AlertNotifier interface {
+	// NotifyAlert publishes alert, the method is called each time the state
+	// of an alert changes.
+	NotifyAlert(ctx context.Context, alert Alert) error
+}
+
+// AlertNotifierFunc makes it possible to use regular function types as alert
+// notifiers.
+type AlertNotifierFunc func(context.Context, Alert) error
+
+// NotifyAlert calls f, satisfies the AlertNotifier interface.
+func (f AlertNotifierFunc) NotifyAlert(ctx context.Context, alert Alert) error {
+	return f(ctx, alert)
+}
+
+// DefaultMaxAlerts is the default number of alerts retained by
+// AlertAnnotations.
+const DefaultMaxAlerts = 1000
+
+// AlertAnnotations is an alert notifier which retains the most recent alerts
+// and serves them as annotations, it can be installed on the /annotations
+// route of a data source to show alerts on dashboards.
+//
+// The query of annotation requests selects the alerts by rule name, an empty
+// query or "*" selects all alerts.
+type AlertAnnotations struct {
+	// MaxAlerts is the number of alerts retained, older alerts are dropped.
+	// The default is DefaultMaxAlerts.
+	MaxAlerts int
+
+	mutex  sync.Mutex
+	alerts []Alert
+}
+
+// NotifyAlert satisfies the AlertNotifier interface.
+func (a *AlertAnnotations) NotifyAlert(ctx context.Context, alert Alert) error {
+	maxAlerts := a.MaxAlerts
+	if maxAlerts <= 0 {
+		maxAlerts = DefaultMaxAlerts
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.alerts) >= maxAlerts {
+		n := copy(a.alerts, a.alerts[len(a.alerts)-maxAlerts+1:])
+		a.alerts = a.alerts[:n]
+	}
+
+	a.alerts = append(a.alerts, alert)
+	return nil
+}
+
+// ServeAnnotations satisfies the AnnotationsHandler interface.
+func (a *AlertAnnotations) ServeAnnotations(ctx context.Context, res AnnotationsResponse, req *AnnotationsRequest) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for _, alert := range a.alerts {
+		if alert.Time.Before(req.From) || alert.Time.After(req.To) {
+			continue
+		}
+		if q := req.Query; q != "" && q != "*" && q != alert.Rule {
+			continue
+		}
+		res.WriteAnnotation(alertAnnotation(alert))
+	}
+
+	return nil
+}
+
+func alertAnnotation(alert Alert) Annotation {
+	return Annotation{
+		Time:     alert.Time,
+		Title:    alertTitle(alert),
+		Text:     alertText(alert),
+		Enabled:  true,
+		ShowLine: true,
+		Tags:     alertTags(alert),
+	}
+}
+
+func alertTitle(alert Alert) string {
+	return "[" + strings.ToUpper(string(alert.State)) + "] " + alert.Rule
+}
+
+func alertText(alert Alert) string {
+	text := "value " + formatFloat(alert.Value) + ", threshold " + formatFloat(alert.Threshold)
+	if len(alert.Message) != 0 {
+		text = alert.Message + " (" + text + ")"
+	}
+	return text
+}
+
+// alertTags returns the tags of annotations made from alert: its state, rule,
+// and labels formatted as "name:value", sorted by name.
+func alertTags(alert Alert) []string {
+	tags := make([]string, 0, 2+len(alert.Labels))
+	tags = append(tags, string(alert.State), alert.Rule)
+
+	labels := make([]string, 0, len(alert.Labels))
+	for name, value := range alert.Labels {
+		labels = append(labels, name+":"+value)
+	}
+	sort.Strings(labels)
+
+	return append(tags, labels...)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,67 @@
+package grafana
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type annotationsRecorder []Annotation
+
+func (r *annotationsRecorder) WriteAnnotation(a Annotation) {
+	*r = append(*r, a)
+}
+
+func TestAlertAnnotations(t *testing.T) {
+	t0 := time.Date(2017, 8, 16, 12, 34, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	alerts := &AlertAnnotations{MaxAlerts: 2}
+
+	for i, alert := range []Alert{
+		{Rule: "dropped", State: AlertFiring, Time: t0},
+		{Rule: "latency", State: AlertFiring, Time: t0.Add(time.Minute), Value: 1.5, Threshold: 1, Message: "slow requests", Labels: map[string]string{"service": "api", "env": "prod"}},
+		{Rule: "errors", State: AlertResolved, Time: t0.Add(2 * time.Minute), Value: 0, Threshold: 10},
+	} {
+		if err := alerts.NotifyAlert(ctx, alert); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+
+	var res annotationsRecorder
+	if err := alerts.ServeAnnotations(ctx, &res, &AnnotationsRequest{From: t0, To: t0.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := annotationsRecorder{
+		{
+			Time:     t0.Add(time.Minute),
+			Title:    "[FIRING] latency",
+			Text:     "slow requests (value 1.5, threshold 1)",
+			Enabled:  true,
+			ShowLine: true,
+			Tags:     []string{"firing", "latency", "env:prod", "service:api"},
+		},
+		{
+			Time:     t0.Add(2 * time.Minute),
+			Title:    "[RESOLVED] errors",
+			Text:     "value 0, threshold 10",
+			Enabled:  true,
+			ShowLine: true,
+			Tags:     []string{"resolved", "errors"},
+		},
+	}
+
+	if !reflect.DeepEqual(res, expect) {
+		t.Errorf("bad annotations:\n- expected: %+v\n- found:    %+v", expect, res)
+	}
+
+	res = nil
+	if err := alerts.ServeAnnotations(ctx, &res, &AnnotationsRequest{From: t0, To: t0.Add(90 * time.Second), Query: "errors"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Error("annotations outside of the requested range or query were returned:", res)
+	}
+}
@@ -31,6 +31,14 @@ func NewHandler(prefix string, handler Handler) http.Handler {
 	return mux
 }
 
+// NewHandlerWith is like NewHandler but applies the access control of config
+// to the requests.
+func NewHandlerWith(prefix string, handler Handler, config HandlerConfig) http.Handler {
+	mux := http.NewServeMux()
+	HandleWith(mux, prefix, handler, config)
+	return mux
+}
+
 // Handle installs a handler implementing the simple-json-datasource API on mux.
 //
 // The function adds three routes to mux, for /annotations, /query, and /search.
@@ -38,7 +46,20 @@ func Handle(mux *http.ServeMux, prefix string, handler Handler) {
 	HandleAnnotations(mux, prefix, handler)
 	HandleQuery(mux, prefix, handler)
 	HandleSearch(mux, prefix, handler)
+	handleRoot(mux, prefix, nil)
+}
 
+// HandleWith is like Handle but applies the access control of config to the
+// requests received on the routes it adds to mux.
+func HandleWith(mux *http.ServeMux, prefix string, handler Handler, config HandlerConfig) {
+	wrap := func(h http.Handler) http.Handler { return newAccessHandler(config, h) }
+	mux.Handle(path.Join("/", prefix, "annotations"), wrap(NewAnnotationsHandler(handler)))
+	mux.Handle(path.Join("/", prefix, "query"), wrap(NewQueryHandler(handler)))
+	mux.Handle(path.Join("/", prefix, "search"), wrap(NewSearchHandler(handler)))
+	handleRoot(mux, prefix, wrap)
+}
+
+func handleRoot(mux *http.ServeMux, prefix string, wrap func(http.Handler) http.Handler) {
 	// Registering a global handler is a common thing that applications do, to
 	// avoid overriding one that may already exist we first check that none were
 	// previously registered.
@@ -47,9 +68,13 @@ func Handle(mux *http.ServeMux, prefix string, handler Handler) {
 	if _, pattern := mux.Handler(&http.Request{
 		URL: &url.URL{Path: root},
 	}); len(pattern) == 0 {
-		mux.HandleFunc(root, func(res http.ResponseWriter, _ *http.Request) {
+		var h http.Handler = http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
 			setResponseHeaders(res)
 		})
+		if wrap != nil {
+			h = wrap(h)
+		}
+		mux.Handle(root, h)
 	}
 }
 
@@ -101,9 +126,13 @@ func newDecoder(r io.Reader) *objconv.Decoder {
 
 func setResponseHeaders(res http.ResponseWriter) {
 	h := res.Header()
-	h.Set("Access-Control-Allow-Headers", "Accept, Content-Type")
-	h.Set("Access-Control-Allow-Methods", "POST")
-	h.Set("Access-Control-Allow-Origin", "*")
+	// The CORS headers were already set when the handler was wrapped by an
+	// access handler.
+	if _, ok := h["Access-Control-Allow-Methods"]; !ok {
+		h.Set("Access-Control-Allow-Headers", "Accept, Content-Type")
+		h.Set("Access-Control-Allow-Methods", "POST")
+		h.Set("Access-Control-Allow-Origin", "*")
+	}
 	h.Set("Content-Type", "application/json; charset=utf-8")
 	h.Set("Server", "stats/grafana (simple-json-datasource)")
 }
@@ -0,0 +1,271 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/segmentio/objconv/json"
+)
+
+// DefaultNotifyTimeout is the default timeout of the requests sent by alert
+// notifiers.
+const DefaultNotifyTimeout = 10 * time.Second
+
+// AnnotationClientConfig is used to configure annotation clients.
+type AnnotationClientConfig struct {
+	// Address of the Grafana server, for example "https://grafana.local".
+	Address string
+
+	// Token is a Grafana service account token authorized to create
+	// annotations.
+	Token string
+
+	// DashboardUID and PanelID scope the annotations to a dashboard or a
+	// panel, annotations are global to the organization when they are unset.
+	DashboardUID string
+	PanelID      int
+
+	// Tags added to all annotations.
+	Tags []string
+
+	// Maximum amount of time that requests to Grafana may take. The default
+	// is DefaultNotifyTimeout.
+	Timeout time.Duration
+
+	// Transport configures the HTTP transport used by the client to send
+	// requests to Grafana. By default http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// AnnotationClient is an alert notifier which creates annotations with the
+// Grafana HTTP API.
+//
+// https://grafana.com/docs/grafana/latest/developers/http_api/annotations/
+type AnnotationClient struct {
+	url          string
+	token        string
+	dashboardUID string
+	panelID      int
+	tags         []string
+	http         http.Client
+}
+
+// NewAnnotationClient creates and returns a new annotation client creating
+// annotations on the Grafana server at addr, authenticated with token.
+func NewAnnotationClient(addr, token string) *AnnotationClient {
+	return NewAnnotationClientWith(AnnotationClientConfig{
+		Address: addr,
+		Token:   token,
+	})
+}
+
+// NewAnnotationClientWith creates and returns a new annotation client
+// configured with the given config.
+func NewAnnotationClientWith(config AnnotationClientConfig) *AnnotationClient {
+	if config.Timeout == 0 {
+		config.Timeout = DefaultNotifyTimeout
+	}
+
+	return &AnnotationClient{
+		url:          strings.TrimSuffix(config.Address, "/") + "/api/annotations",
+		token:        config.Token,
+		dashboardUID: config.DashboardUID,
+		panelID:      config.PanelID,
+		tags:         config.Tags,
+		http: http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+	}
+}
+
+// NotifyAlert creates an annotation for alert, satisfies the AlertNotifier
+// interface.
+func (c *AnnotationClient) NotifyAlert(ctx context.Context, alert Alert) error {
+	tags := make([]string, 0, len(c.tags)+2+len(alert.Labels))
+	tags = append(tags, c.tags...)
+	tags = append(tags, alertTags(alert)...)
+
+	return postJSON(ctx, &c.http, c.url, c.token, grafanaAnnotation{
+		DashboardUID: c.dashboardUID,
+		PanelID:      c.panelID,
+		Time:         timestamp(alert.Time),
+		Tags:         tags,
+		Text:         alertTitle(alert) + ": " + alertText(alert),
+	})
+}
+
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// WebhookConfig is used to configure webhook notifiers.
+type WebhookConfig struct {
+	// URL that the notifications are posted to.
+	URL string
+
+	// Token is sent as a bearer token in the Authorization header of the
+	// requests when it is set.
+	Token string
+
+	// Receiver is the name of the contact point reported in notifications.
+	Receiver string
+
+	// Maximum amount of time that requests may take. The default is
+	// DefaultNotifyTimeout.
+	Timeout time.Duration
+
+	// Transport configures the HTTP transport used to send requests. By
+	// default http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// WebhookNotifier is an alert notifier which posts alerts in the payload
+// format of the Grafana webhook contact point, so they can be handled by the
+// receivers of Grafana alert notifications.
+//
+// https://grafana.com/docs/grafana/latest/alerting/configure-notifications/manage-contact-points/integrations/webhook-notifier/
+type WebhookNotifier struct {
+	url      string
+	token    string
+	receiver string
+	http     http.Client
+}
+
+// NewWebhookNotifier creates and returns a new webhook notifier posting
+// alerts to url.
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return NewWebhookNotifierWith(WebhookConfig{
+		URL: url,
+	})
+}
+
+// NewWebhookNotifierWith creates and returns a new webhook notifier
+// configured with the given config.
+func NewWebhookNotifierWith(config WebhookConfig) *WebhookNotifier {
+	if config.Timeout == 0 {
+		config.Timeout = DefaultNotifyTimeout
+	}
+
+	return &WebhookNotifier{
+		url:      config.URL,
+		token:    config.Token,
+		receiver: config.Receiver,
+		http: http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+	}
+}
+
+// NotifyAlert posts alert to the webhook, satisfies the AlertNotifier
+// interface.
+func (n *WebhookNotifier) NotifyAlert(ctx context.Context, alert Alert) error {
+	labels := make(map[string]string, len(alert.Labels)+1)
+	for name, value := range alert.Labels {
+		labels[name] = value
+	}
+	labels["alertname"] = alert.Rule
+
+	annotations := map[string]string{}
+	if len(alert.Message) != 0 {
+		annotations["summary"] = alert.Message
+	}
+
+	info := webhookAlert{
+		Status:      string(alert.State),
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    alert.Time.UTC().Format(time.RFC3339Nano),
+		EndsAt:      time.Time{}.Format(time.RFC3339),
+		// Grafana reports the values of the queries and expressions of rules
+		// by their ref ID, A and B are conventionally the query and the
+		// threshold.
+		Values: map[string]float64{"A": alert.Value, "B": alert.Threshold},
+	}
+
+	if alert.State == AlertResolved {
+		info.EndsAt = info.StartsAt
+	}
+
+	state := "alerting"
+	if alert.State == AlertResolved {
+		state = "ok"
+	}
+
+	title := fmt.Sprintf("[%s:1] %s", strings.ToUpper(string(alert.State)), alert.Rule)
+
+	return postJSON(ctx, &n.http, n.url, n.token, webhookPayload{
+		Receiver:          n.receiver,
+		Status:            string(alert.State),
+		Alerts:            []webhookAlert{info},
+		GroupLabels:       map[string]string{"alertname": alert.Rule},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		Version:           "1",
+		Title:             title,
+		State:             state,
+		Message:           title + "\n" + alertText(alert),
+	})
+}
+
+type webhookPayload struct {
+	Receiver          string            `json:"receiver"`
+	Status            string            `json:"status"`
+	Alerts            []webhookAlert    `json:"alerts"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	Version           string            `json:"version"`
+	Title             string            `json:"title"`
+	State             string            `json:"state"`
+	Message           string            `json:"message"`
+}
+
+type webhookAlert struct {
+	Status      string             `json:"status"`
+	Labels      map[string]string  `json:"labels"`
+	Annotations map[string]string  `json:"annotations"`
+	StartsAt    string             `json:"startsAt"`
+	EndsAt      string             `json:"endsAt"`
+	Values      map[string]float64 `json:"values"`
+}
+
+func postJSON(ctx context.Context, client *http.Client, url, token string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("grafana: POST %s: %s: %s", url, res.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
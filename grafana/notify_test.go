@@ -0,0 +1,124 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnnotationClient(t *testing.T) {
+	t0 := time.Date(2017, 8, 16, 12, 34, 0, 0, time.UTC)
+	var found grafanaAnnotation
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/annotations" {
+			t.Error("bad path:", req.URL.Path)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Error("bad authorization:", auth)
+		}
+		if err := json.NewDecoder(req.Body).Decode(&found); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	client := NewAnnotationClientWith(AnnotationClientConfig{
+		Address:      server.URL,
+		Token:        "secret",
+		DashboardUID: "abc",
+		Tags:         []string{"stats"},
+	})
+
+	if err := client.NotifyAlert(context.Background(), Alert{
+		Rule:      "latency",
+		State:     AlertFiring,
+		Time:      t0,
+		Value:     1.5,
+		Threshold: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := grafanaAnnotation{
+		DashboardUID: "abc",
+		Time:         timestamp(t0),
+		Tags:         []string{"stats", "firing", "latency"},
+		Text:         "[FIRING] latency: value 1.5, threshold 1",
+	}
+
+	if !reflect.DeepEqual(found, expect) {
+		t.Errorf("bad annotation:\n- expected: %+v\n- found:    %+v", expect, found)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	t0 := time.Date(2017, 8, 16, 12, 34, 0, 0, time.UTC)
+	var found webhookPayload
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if err := json.NewDecoder(req.Body).Decode(&found); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifierWith(WebhookConfig{
+		URL:      server.URL,
+		Receiver: "stats",
+	})
+
+	if err := notifier.NotifyAlert(context.Background(), Alert{
+		Rule:      "errors",
+		State:     AlertResolved,
+		Time:      t0,
+		Value:     2,
+		Threshold: 10,
+		Message:   "error rate is back to normal",
+		Labels:    map[string]string{"service": "api"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]string{"alertname": "errors", "service": "api"}
+	annotations := map[string]string{"summary": "error rate is back to normal"}
+
+	expect := webhookPayload{
+		Receiver: "stats",
+		Status:   "resolved",
+		Alerts: []webhookAlert{{
+			Status:      "resolved",
+			Labels:      labels,
+			Annotations: annotations,
+			StartsAt:    "2017-08-16T12:34:00Z",
+			EndsAt:      "2017-08-16T12:34:00Z",
+			Values:      map[string]float64{"A": 2, "B": 10},
+		}},
+		GroupLabels:       map[string]string{"alertname": "errors"},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		Version:           "1",
+		Title:             "[RESOLVED:1] errors",
+		State:             "ok",
+		Message:           "[RESOLVED:1] errors\nerror rate is back to normal (value 2, threshold 10)",
+	}
+
+	if !reflect.DeepEqual(found, expect) {
+		t.Errorf("bad payload:\n- expected: %+v\n- found:    %+v", expect, found)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "nope", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier(server.URL).NotifyAlert(context.Background(), Alert{Rule: "test"}); err == nil {
+		t.Error("expected an error when the webhook rejects the notification")
+	}
+}
@@ -0,0 +1,306 @@
+// Package graphite implements a stats handler sending metrics to Graphite,
+// over the Carbon plaintext or pickle protocols.
+package graphite
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultAddress is the default address to which the graphite client
+	// tries to connect to, the port of the Carbon plaintext receiver.
+	DefaultAddress = "localhost:2003"
+
+	// DefaultPickleAddress is the default address to which the graphite
+	// client tries to connect to when using the pickle protocol.
+	DefaultPickleAddress = "localhost:2004"
+
+	// DefaultBufferSize is the default size for batches of metrics sent to
+	// Carbon.
+	DefaultBufferSize = 64 * 1024
+
+	// DefaultTimeout is the default timeout of the connections and writes to
+	// Carbon.
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultReconnectInterval is the default minimum amount of time between
+	// two attempts to connect to Carbon.
+	DefaultReconnectInterval = time.Second
+)
+
+// Protocol is an enumeration of the protocols supported by the graphite
+// client.
+type Protocol int
+
+const (
+	// Plaintext is the line based protocol of the Carbon plaintext receiver,
+	// where each metric is written as "path value timestamp".
+	Plaintext Protocol = iota
+
+	// Pickle is the protocol of the Carbon pickle receiver, where batches of
+	// metrics are written as pickled lists of tuples. It is more efficient
+	// than the plaintext protocol for large volumes of metrics.
+	Pickle
+)
+
+// The ClientConfig type is used to configure graphite clients.
+type ClientConfig struct {
+	// Address of the Carbon receiver to send metrics to. The default is
+	// DefaultAddress, or DefaultPickleAddress when Protocol is Pickle.
+	Address string
+
+	// Protocol used to send metrics, the default is Plaintext.
+	Protocol Protocol
+
+	// Maximum size of batch of metrics sent to Carbon. The default is
+	// DefaultBufferSize.
+	BufferSize int
+
+	// FlushInterval is the interval at which the client flushes batches of
+	// metrics that were not filled yet. By default batches are only sent
+	// when they are full or when the client is flushed.
+	FlushInterval time.Duration
+
+	// Maximum amount of time that connecting and writing to Carbon may take.
+	// The default is DefaultTimeout.
+	Timeout time.Duration
+
+	// ReconnectInterval is the minimum amount of time between two attempts to
+	// connect to Carbon, batches written while the client is disconnected are
+	// dropped. The default is DefaultReconnectInterval.
+	ReconnectInterval time.Duration
+
+	// DisableTags omits tags from the metric names, for Graphite versions
+	// older than 1.1 which do not support tags. Measures which differ only
+	// by their tags are then written to the same series.
+	DisableTags bool
+}
+
+// Client represents a graphite client that implements the stats.Handler
+// interface.
+//
+// Carbon keeps the last value written to a series in each interval of its
+// retention, counters should be aggregated with carbon-aggregator to avoid
+// losing increments reported more often than that.
+type Client struct {
+	serializer
+	buffer stats.Buffer
+
+	once sync.Once
+	stop chan struct{}
+	join chan struct{}
+}
+
+// NewClient creates and returns a new graphite client publishing metrics to
+// the Carbon plaintext receiver running at addr.
+func NewClient(addr string) *Client {
+	return NewClientWith(ClientConfig{
+		Address: addr,
+	})
+}
+
+// NewClientWith creates and returns a new graphite client configured with the
+// given config.
+func NewClientWith(config ClientConfig) *Client {
+	if len(config.Address) == 0 {
+		if config.Protocol == Pickle {
+			config.Address = DefaultPickleAddress
+		} else {
+			config.Address = DefaultAddress
+		}
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	if config.ReconnectInterval == 0 {
+		config.ReconnectInterval = DefaultReconnectInterval
+	}
+
+	c := &Client{
+		serializer: serializer{
+			pickle: config.Protocol == Pickle,
+			tags:   !config.DisableTags,
+			conn: conn{
+				address:           strings.TrimPrefix(config.Address, "tcp://"),
+				timeout:           config.Timeout,
+				reconnectInterval: config.ReconnectInterval,
+			},
+		},
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	c.buffer.BufferSize = config.BufferSize
+	c.buffer.Serializer = &c.serializer
+
+	if config.FlushInterval > 0 {
+		go c.run(config.FlushInterval)
+	} else {
+		close(c.join)
+	}
+
+	return c
+}
+
+func (c *Client) run(interval time.Duration) {
+	defer close(c.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (c *Client) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	c.buffer.HandleMeasures(time, measures...)
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (c *Client) Flush() {
+	c.buffer.Flush()
+}
+
+// Close flushes and closes the client, satisfies the io.Closer interface.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.join
+	})
+	c.Flush()
+	return c.conn.close()
+}
+
+type serializer struct {
+	pickle bool
+	tags   bool
+	conn   conn
+}
+
+func (s *serializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
+	for _, m := range measures {
+		if s.pickle {
+			b = appendPickleMeasure(b, time, m, s.tags)
+		} else {
+			b = appendMeasure(b, time, m, s.tags)
+		}
+	}
+	return b
+}
+
+// Write satisfies the io.Writer interface. Errors are logged rather than
+// returned, batches which could not be written are dropped.
+func (s *serializer) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	bufs := net.Buffers{b}
+	if s.pickle {
+		bufs = net.Buffers{pickleHeader(len(b)), b, pickleTrailer}
+	}
+
+	if err := s.conn.write(bufs); err != nil && !errors.Is(err, errReconnecting) {
+		log.Printf("stats/graphite: %s", err)
+	}
+
+	return len(b), nil
+}
+
+// conn is a TCP connection to Carbon, established on first use and
+// re-established when writes fail.
+type conn struct {
+	address           string
+	timeout           time.Duration
+	reconnectInterval time.Duration
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	retryAt time.Time
+}
+
+func (c *conn) write(bufs net.Buffers) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var err error
+
+	// A write to a connection closed by the server may succeed, the error is
+	// only reported by the next one, so the batch is retried once on a new
+	// connection.
+	for attempt := 0; attempt != 2; attempt++ {
+		if c.conn == nil {
+			if err = c.dial(); err != nil {
+				return err
+			}
+		}
+
+		// WriteTo consumes the buffers, a copy is kept to retry.
+		b := bufs
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+
+		if _, err = b.WriteTo(c.conn); err == nil {
+			return nil
+		}
+
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	return err
+}
+
+// dial connects to Carbon, unless the last attempt failed less than
+// reconnectInterval ago so the program does not wait for the timeout on each
+// batch while Carbon is unavailable.
+func (c *conn) dial() error {
+	now := time.Now()
+
+	if now.Before(c.retryAt) {
+		return errReconnecting
+	}
+
+	conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+	if err != nil {
+		c.retryAt = now.Add(c.reconnectInterval)
+		return err
+	}
+
+	c.conn = conn
+	return nil
+}
+
+func (c *conn) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+var errReconnecting = errors.New("waiting to reconnect to carbon, dropping metrics")
@@ -0,0 +1,164 @@
+package graphite
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientPlaintext(t *testing.T) {
+	lines := make(chan string, 10)
+
+	addr := listen(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	})
+
+	client := NewClient(addr)
+	client.HandleMeasures(timestamp, testMetrics[1].m)
+	client.Close()
+
+	for _, expect := range strings.SplitAfter(testMetrics[1].s, "\n")[:2] {
+		if line := receive(t, lines); line != expect {
+			t.Errorf("bad line:\n- expected: %q\n- found:    %q", expect, line)
+		}
+	}
+}
+
+func TestClientPickle(t *testing.T) {
+	messages := make(chan []byte, 10)
+
+	addr := listen(t, func(conn net.Conn) {
+		for {
+			var size [4]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				return
+			}
+			b := make([]byte, 4+binary.BigEndian.Uint32(size[:]))
+			copy(b, size[:])
+			if _, err := io.ReadFull(conn, b[4:]); err != nil {
+				return
+			}
+			messages <- b
+		}
+	})
+
+	client := NewClientWith(ClientConfig{
+		Address:  addr,
+		Protocol: Pickle,
+	})
+	client.HandleMeasures(timestamp, testMetrics[0].m, testMetrics[1].m)
+	client.Close()
+
+	expect := []pickledMetric{
+		{path: "request.count", timestamp: 1500780960, value: 5},
+		{path: "request.count;answer=42;hello=world", timestamp: 1500780960, value: 5},
+		{path: "request.rtt;answer=42;hello=world", timestamp: 1500780960, value: 0.1},
+	}
+
+	if metrics := unpickle(t, receive(t, messages)); !reflect.DeepEqual(metrics, expect) {
+		t.Errorf("bad pickled metrics:\n- expected: %v\n- found:    %v", expect, metrics)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	lines := make(chan string, 100)
+	conns := make(chan net.Conn, 10)
+
+	addr := listen(t, func(conn net.Conn) {
+		conns <- conn
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	})
+
+	client := NewClientWith(ClientConfig{
+		Address:           addr,
+		ReconnectInterval: time.Millisecond,
+	})
+	defer client.Close()
+
+	m := testMetrics[0].m
+	client.HandleMeasures(timestamp, m)
+	client.Flush()
+
+	receive(t, lines)
+	receive(t, conns).Close()
+
+	// The first writes after the server closed the connection may be lost,
+	// the client must eventually reconnect and deliver the metrics.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		client.HandleMeasures(timestamp, m)
+		client.Flush()
+
+		select {
+		case line := <-lines:
+			if line != testMetrics[0].s {
+				t.Errorf("bad line: %q", line)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the client did not reconnect")
+		}
+	}
+}
+
+// listen starts a TCP server calling serve for each connection it accepts,
+// and returns its address.
+func listen(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func receive[T any](t *testing.T, ch <-chan T) (v T) {
+	t.Helper()
+
+	select {
+	case v = <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for data from the client")
+	}
+
+	return v
+}
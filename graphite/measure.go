@@ -0,0 +1,106 @@
+package graphite
+
+import (
+	"strconv"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// AppendMeasure is a formatting routine to append the Carbon plaintext
+// representation of a measure to a memory buffer.
+//
+// Each field of the measure is written on its own line, named after the
+// measure and the field, for example "http.requests.count". Tags are added to
+// the names with the Graphite 1.1 syntax, "http.requests.count;env=prod".
+func AppendMeasure(b []byte, t time.Time, m stats.Measure) []byte {
+	return appendMeasure(b, t, m, true)
+}
+
+func appendMeasure(b []byte, t time.Time, m stats.Measure, tags bool) []byte {
+	for _, field := range m.Fields {
+		if field.Value.Type() == stats.Null {
+			continue
+		}
+		b = appendMetricName(b, m, field, tags)
+		b = append(b, ' ')
+		b = appendValue(b, field.Value)
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, t.Unix(), 10)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+func appendMetricName(b []byte, m stats.Measure, field stats.Field, tags bool) []byte {
+	b = appendSanitized(b, m.Name, isPathChar)
+
+	if len(field.Name) != 0 {
+		if len(m.Name) != 0 {
+			b = append(b, '.')
+		}
+		b = appendSanitized(b, field.Name, isPathChar)
+	}
+
+	if tags {
+		for _, tag := range m.Tags {
+			// Graphite rejects tags with empty names or values.
+			if len(tag.Name) == 0 || len(tag.Value) == 0 {
+				continue
+			}
+			b = append(b, ';')
+			b = appendSanitized(b, tag.Name, isTagNameChar)
+			b = append(b, '=')
+			// Values may contain '~', but not as their first character.
+			if tag.Value[0] == '~' {
+				b = append(b, '_')
+				b = appendSanitized(b, tag.Value[1:], isPathChar)
+			} else {
+				b = appendSanitized(b, tag.Value, isPathChar)
+			}
+		}
+	}
+
+	return b
+}
+
+// appendSanitized appends s to b, replacing the bytes which are not valid in
+// the context given by valid with underscores.
+func appendSanitized(b []byte, s string, valid func(byte) bool) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; valid(c) {
+			b = append(b, c)
+		} else {
+			b = append(b, '_')
+		}
+	}
+	return b
+}
+
+func isPathChar(c byte) bool {
+	return c > ' ' && c != ';' && c != 0x7f
+}
+
+func isTagNameChar(c byte) bool {
+	return isPathChar(c) && c != '=' && c != '!' && c != '^'
+}
+
+func appendValue(b []byte, v stats.Value) []byte {
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return append(b, '1')
+		}
+		return append(b, '0')
+	case stats.Int:
+		return strconv.AppendInt(b, v.Int(), 10)
+	case stats.Uint:
+		return strconv.AppendUint(b, v.Uint(), 10)
+	case stats.Float:
+		return strconv.AppendFloat(b, v.Float(), 'g', -1, 64)
+	case stats.Duration:
+		return strconv.AppendFloat(b, v.Duration().Seconds(), 'g', -1, 64)
+	default:
+		return append(b, '0')
+	}
+}
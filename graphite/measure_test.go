@@ -0,0 +1,83 @@
+package graphite
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+var (
+	timestamp   = time.Date(2017, 7, 23, 3, 36, 0, 123456789, time.UTC)
+	testMetrics = []struct {
+		m stats.Measure
+		s string
+	}{
+		{
+			m: stats.Measure{
+				Name:   "request",
+				Fields: []stats.Field{stats.MakeField("count", 5, stats.Counter)},
+			},
+			s: "request.count 5 1500780960\n",
+		},
+
+		{
+			m: stats.Measure{
+				Name: "request",
+				Fields: []stats.Field{
+					stats.MakeField("count", 5, stats.Counter),
+					stats.MakeField("rtt", 100*time.Millisecond, stats.Histogram),
+				},
+				Tags: []stats.Tag{
+					stats.T("answer", "42"),
+					stats.T("hello", "world"),
+				},
+			},
+			s: "request.count;answer=42;hello=world 5 1500780960\n" +
+				"request.rtt;answer=42;hello=world 0.1 1500780960\n",
+		},
+
+		{
+			m: stats.Measure{
+				Name:   "my request",
+				Fields: []stats.Field{stats.MakeField("ok", true, stats.Gauge), {Name: "none"}},
+				Tags: []stats.Tag{
+					stats.T("a=b", "c;d"),
+					stats.T("empty", ""),
+					stats.T("tilde", "~x~y"),
+				},
+			},
+			s: "my_request.ok;a_b=c_d;tilde=_x~y 1 1500780960\n",
+		},
+
+		{
+			m: stats.Measure{
+				Name:   "",
+				Fields: []stats.Field{stats.MakeField("value", 0.5, stats.Gauge)},
+			},
+			s: "value 0.5 1500780960\n",
+		},
+	}
+)
+
+func TestAppendMeasure(t *testing.T) {
+	for _, test := range testMetrics {
+		t.Run(test.s, func(t *testing.T) {
+			if s := string(AppendMeasure(nil, timestamp, test.m)); s != test.s {
+				t.Error("bad metric representation:")
+				t.Log("expected:", test.s)
+				t.Log("found:   ", s)
+			}
+		})
+	}
+}
+
+func TestAppendMeasureWithoutTags(t *testing.T) {
+	const expect = "request.count 5 1500780960\nrequest.rtt 0.1 1500780960\n"
+
+	if s := string(appendMeasure(nil, timestamp, testMetrics[1].m, false)); s != expect {
+		t.Error("bad metric representation:")
+		t.Log("expected:", expect)
+		t.Log("found:   ", s)
+	}
+}
@@ -0,0 +1,79 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Opcodes of the pickle protocol used to encode messages sent to the Carbon
+// pickle receiver, which expects a list of (path, (timestamp, value)) tuples.
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleBinUnicode = 'X'
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleAppends    = 'e'
+	pickleStop       = '.'
+)
+
+// appendPickleMeasure appends the pickled (path, (timestamp, value)) tuples of
+// the fields of m to b. The tuples of consecutive measures can be concatenated,
+// they are framed into a message by pickleHeader and pickleTrailer.
+func appendPickleMeasure(b []byte, t time.Time, m stats.Measure, tags bool) []byte {
+	for _, field := range m.Fields {
+		if field.Value.Type() == stats.Null {
+			continue
+		}
+
+		b = append(b, pickleBinUnicode, 0, 0, 0, 0)
+		start := len(b)
+		b = appendMetricName(b, m, field, tags)
+		binary.LittleEndian.PutUint32(b[start-4:], uint32(len(b)-start))
+
+		b = appendPickleFloat(b, float64(t.Unix()))
+		b = appendPickleFloat(b, floatValue(field.Value))
+		b = append(b, pickleTuple2, pickleTuple2)
+	}
+	return b
+}
+
+func appendPickleFloat(b []byte, f float64) []byte {
+	b = append(b, pickleBinFloat)
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+}
+
+// pickleHeader returns the bytes written in front of a sequence of pickled
+// tuples of size n: the length of the message, as a 4 bytes big-endian integer
+// as expected by Carbon, and the opening of the pickled list.
+func pickleHeader(n int) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(n+len(pickleTrailer)+4))
+	return append(b, pickleProto, 2, pickleEmptyList, pickleMark)
+}
+
+// pickleTrailer closes the list opened by pickleHeader.
+var pickleTrailer = []byte{pickleAppends, pickleStop}
+
+func floatValue(v stats.Value) float64 {
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case stats.Int:
+		return float64(v.Int())
+	case stats.Uint:
+		return float64(v.Uint())
+	case stats.Float:
+		return v.Float()
+	case stats.Duration:
+		return v.Duration().Seconds()
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,88 @@
+package graphite
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type pickledMetric struct {
+	path      string
+	timestamp float64
+	value     float64
+}
+
+func TestAppendPickleMeasure(t *testing.T) {
+	var b []byte
+	for _, test := range testMetrics[:2] {
+		b = appendPickleMeasure(b, timestamp, test.m, true)
+	}
+
+	msg := append(append(pickleHeader(len(b)), b...), pickleTrailer...)
+	metrics := unpickle(t, msg)
+
+	expect := []pickledMetric{
+		{path: "request.count", timestamp: 1500780960, value: 5},
+		{path: "request.count;answer=42;hello=world", timestamp: 1500780960, value: 5},
+		{path: "request.rtt;answer=42;hello=world", timestamp: 1500780960, value: 0.1},
+	}
+
+	if !reflect.DeepEqual(metrics, expect) {
+		t.Errorf("bad pickled metrics:\n- expected: %v\n- found:    %v", expect, metrics)
+	}
+}
+
+// unpickle decodes a message framed and pickled like the Carbon pickle
+// receiver expects, supporting only the opcodes used by the client.
+func unpickle(t *testing.T, b []byte) []pickledMetric {
+	t.Helper()
+
+	if size := binary.BigEndian.Uint32(b); int(size) != len(b)-4 {
+		t.Fatalf("bad message size: %d != %d", size, len(b)-4)
+	}
+	b = b[4:]
+
+	var stack []interface{}
+	var metrics []pickledMetric
+
+	for len(b) != 0 {
+		op := b[0]
+		b = b[1:]
+
+		switch op {
+		case pickleProto:
+			b = b[1:]
+		case pickleEmptyList, pickleMark:
+		case pickleBinUnicode:
+			n := binary.LittleEndian.Uint32(b)
+			stack = append(stack, string(b[4:4+n]))
+			b = b[4+n:]
+		case pickleBinFloat:
+			stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(b)))
+			b = b[8:]
+		case pickleTuple2:
+			n := len(stack)
+			stack = append(stack[:n-2], [2]interface{}{stack[n-2], stack[n-1]})
+		case pickleAppends:
+			for _, item := range stack {
+				tuple := item.([2]interface{})
+				point := tuple[1].([2]interface{})
+				metrics = append(metrics, pickledMetric{
+					path:      tuple[0].(string),
+					timestamp: point[0].(float64),
+					value:     point[1].(float64),
+				})
+			}
+			stack = stack[:0]
+		case pickleStop:
+			if len(b) != 0 {
+				t.Fatal("trailing bytes after the end of the message:", b)
+			}
+		default:
+			t.Fatalf("unexpected opcode: %#x", op)
+		}
+	}
+
+	return metrics
+}
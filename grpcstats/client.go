@@ -0,0 +1,101 @@
+package grpcstats
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	stats "github.com/segmentio/stats/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// UnaryClientInterceptor returns a gRPC interceptor producing metrics on the
+// default engine for every unary RPC sent.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return UnaryClientInterceptorWith(stats.DefaultEngine)
+}
+
+// UnaryClientInterceptorWith returns a gRPC interceptor producing metrics on
+// eng for every unary RPC sent.
+func UnaryClientInterceptorWith(eng *stats.Engine) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		rpc := startRPCSide(eng, clientSide, method)
+		rpc.sent(req)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			rpc.received(reply)
+		}
+		rpc.completeWith(outcomeOf(ctx, err))
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a gRPC interceptor producing metrics on the
+// default engine for every streaming RPC sent.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return StreamClientInterceptorWith(stats.DefaultEngine)
+}
+
+// StreamClientInterceptorWith returns a gRPC interceptor producing metrics on
+// eng for every streaming RPC sent.
+//
+// Streaming RPCs complete when receiving a message returns an error, or after
+// receiving the response of streams where the server sends a single message.
+// The metrics of streams abandoned before completion are not reported.
+func StreamClientInterceptorWith(eng *stats.Engine) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		rpc := startRPCSide(eng, clientSide, method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			rpc.completeWith(outcomeOf(ctx, err))
+			return nil, err
+		}
+		return &statsClientStream{
+			ClientStream:  cs,
+			rpc:           rpc,
+			ctx:           ctx,
+			serverStreams: desc.ServerStreams,
+		}, nil
+	}
+}
+
+// statsClientStream observes the size of the messages of a streaming RPC, and
+// reports its completion.
+type statsClientStream struct {
+	grpc.ClientStream
+	rpc           rpc
+	ctx           context.Context
+	serverStreams bool
+	once          sync.Once
+}
+
+func (s *statsClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.rpc.sent(m)
+	}
+	return err
+}
+
+func (s *statsClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	switch {
+	case err == nil:
+		s.rpc.received(m)
+		if !s.serverStreams {
+			s.complete(codes.OK)
+		}
+	case err == io.EOF:
+		s.complete(codes.OK)
+	default:
+		s.complete(outcomeOf(s.ctx, err))
+	}
+
+	return err
+}
+
+func (s *statsClientStream) complete(code codes.Code) {
+	s.once.Do(func() { s.rpc.completeWith(code) })
+}
@@ -0,0 +1,119 @@
+package grpcstats
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	intercept := UnaryClientInterceptorWith(e)
+	err := intercept(context.Background(), "/test.Service/Method", wrapperspb.String("hello"), wrapperspb.String(""), nil,
+		func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return status.Error(codes.Unavailable, "")
+		},
+	)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatal("the error of the invoker was not returned:", err)
+	}
+
+	var names []string
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			names = append(names, m.Name+"."+f.Name)
+		}
+		if m.Name == "grpc.client.rpc" {
+			if !hasTag(m.Tags, stats.T("grpc_code", "Unavailable")) || !hasTag(m.Tags, stats.T("grpc_code_bucket", "server_error")) {
+				t.Errorf("bad tags: %v", m.Tags)
+			}
+		}
+	}
+
+	expected := []string{
+		"grpc.client.message.sent.bytes",
+		"grpc.client.rpc.count",
+		"grpc.client.rpc.seconds",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Errorf("expected %s, got %s", expected[i], names[i])
+		}
+	}
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	intercept := StreamClientInterceptorWith(e)
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	cs, err := intercept(context.Background(), desc, nil, "/test.Service/Stream",
+		func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &clientStream{messages: 2}, nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		if err := cs.RecvMsg(wrapperspb.String("")); err != nil {
+			break
+		}
+	}
+	cs.RecvMsg(wrapperspb.String("")) // the completion is only reported once
+
+	received, completed := 0, 0
+	for _, m := range h.Measures() {
+		switch m.Name + "." + m.Fields[0].Name {
+		case "grpc.client.message.received.bytes":
+			received++
+		case "grpc.client.rpc.count":
+			completed++
+			if !hasTag(m.Tags, stats.T("grpc_code", "OK")) {
+				t.Errorf("bad tags: %v", m.Tags)
+			}
+		}
+	}
+
+	if received != 2 {
+		t.Errorf("expected 2 messages received, got %d", received)
+	}
+	if completed != 1 {
+		t.Errorf("expected the rpc to complete once, got %d", completed)
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	messages int
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	if s.messages == 0 {
+		return io.EOF
+	}
+	s.messages--
+	return nil
+}
@@ -0,0 +1,6 @@
+// Package grpcstats provides gRPC interceptors producing metrics on the RPCs
+// served and sent by a program, mirroring the httpstats package.
+//
+// The package is a separate module so that programs which do not use gRPC do
+// not inherit its dependencies.
+package grpcstats
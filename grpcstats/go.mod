@@ -0,0 +1,22 @@
+module github.com/segmentio/stats/v5/grpcstats
+
+go 1.23.0
+
+require (
+	github.com/segmentio/stats/v5 v5.5.0
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	github.com/segmentio/fasthash v1.0.3 // indirect
+	golang.org/x/exp v0.0.0-20250506013437-ce4c2cf36ca6 // indirect
+	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240513163218-0867130af1f8 // indirect
+)
+
+// The module is developed with the version of the stats package in the
+// parent directory, which is required by the version above once released.
+replace github.com/segmentio/stats/v5 => ../
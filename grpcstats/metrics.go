@@ -0,0 +1,138 @@
+package grpcstats
+
+import (
+	"math"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+func init() {
+	for _, side := range []*rpcSide{serverSide, clientSide} {
+		stats.Buckets.Set(side.seconds,
+			1*time.Millisecond,
+			10*time.Millisecond,
+			100*time.Millisecond,
+			1*time.Second,
+			10*time.Second,
+			math.Inf(+1),
+		)
+
+		for _, key := range []string{side.sentBytes, side.receivedBytes} {
+			stats.Buckets.Set(key,
+				1e2, // 100 B
+				1e3, // 1 KB
+				1e4, // 10 KB
+				1e5, // 100 KB
+				1e6, // 1 MB
+				1e7, // 10 MB
+				math.Inf(+1),
+			)
+		}
+	}
+}
+
+// rpcSide holds the names of the metrics reported for RPCs on the server or
+// client side, so they are not recomputed for every RPC.
+//
+// Each completed RPC is counted in grpc.<side>.rpc.count and its latency is
+// observed in grpc.<side>.rpc.seconds, both tagged with the status code of
+// the RPC and its bucket. The size of every message is observed in the
+// grpc.<side>.message.sent.bytes and grpc.<side>.message.received.bytes
+// histograms.
+type rpcSide struct {
+	count         string
+	seconds       string
+	sentBytes     string
+	receivedBytes string
+}
+
+func newRPCSide(prefix string) *rpcSide {
+	return &rpcSide{
+		count:         prefix + ".rpc.count",
+		seconds:       prefix + ".rpc.seconds",
+		sentBytes:     prefix + ".message.sent.bytes",
+		receivedBytes: prefix + ".message.received.bytes",
+	}
+}
+
+var (
+	serverSide = newRPCSide("grpc.server")
+	clientSide = newRPCSide("grpc.client")
+)
+
+// rpc carries the state of an RPC between the time it starts and the time it
+// completes.
+type rpc struct {
+	eng   *stats.Engine
+	side  *rpcSide
+	tags  []stats.Tag
+	start time.Time
+}
+
+func startRPCSide(eng *stats.Engine, side *rpcSide, fullMethod string) rpc {
+	service, method := splitMethodName(fullMethod)
+	return rpc{
+		eng:  eng,
+		side: side,
+		tags: []stats.Tag{
+			stats.T("grpc_method", method),
+			stats.T("grpc_service", service),
+		},
+		start: time.Now(),
+	}
+}
+
+func (rpc rpc) sent(msg interface{}) {
+	if size, ok := messageSize(msg); ok {
+		rpc.eng.Observe(rpc.side.sentBytes, size, rpc.tags...)
+	}
+}
+
+func (rpc rpc) received(msg interface{}) {
+	if size, ok := messageSize(msg); ok {
+		rpc.eng.Observe(rpc.side.receivedBytes, size, rpc.tags...)
+	}
+}
+
+func (rpc rpc) completeWith(code codes.Code) {
+	tags := append(rpc.tags[:len(rpc.tags):len(rpc.tags)],
+		stats.T("grpc_code", code.String()),
+		stats.T("grpc_code_bucket", codeBucket(code)),
+	)
+	rpc.eng.Incr(rpc.side.count, tags...)
+	rpc.eng.Observe(rpc.side.seconds, time.Since(rpc.start), tags...)
+}
+
+// codeBucket groups status codes by the party responsible for the failure of
+// RPCs, like the status code classes of HTTP responses.
+func codeBucket(code codes.Code) string {
+	switch code {
+	case codes.OK:
+		return "ok"
+	case codes.Canceled,
+		codes.InvalidArgument,
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.PermissionDenied,
+		codes.ResourceExhausted,
+		codes.FailedPrecondition,
+		codes.Aborted,
+		codes.OutOfRange,
+		codes.Unauthenticated:
+		return "client_error"
+	default:
+		return "server_error"
+	}
+}
+
+// messageSize returns the size of the wire encoding of msg, which is only known
+// for protobuf messages.
+func messageSize(msg interface{}) (int, bool) {
+	if m, ok := msg.(proto.Message); ok {
+		return proto.Size(m), true
+	}
+	return 0, false
+}
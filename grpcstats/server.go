@@ -0,0 +1,169 @@
+package grpcstats
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	stats.Buckets.Set("grpc.server.deadline.remaining.seconds",
+		10*time.Millisecond,
+		50*time.Millisecond,
+		100*time.Millisecond,
+		500*time.Millisecond,
+		1*time.Second,
+		5*time.Second,
+		10*time.Second,
+		30*time.Second,
+		60*time.Second,
+		math.Inf(+1),
+	)
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor producing metrics on the
+// default engine for every unary RPC served.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return UnaryServerInterceptorWith(stats.DefaultEngine)
+}
+
+// UnaryServerInterceptorWith returns a gRPC interceptor producing metrics on
+// eng for every unary RPC served.
+func UnaryServerInterceptorWith(eng *stats.Engine) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		rpc := startRPC(ctx, eng, info.FullMethod)
+		rpc.received(req)
+		res, err := handler(ctx, req)
+		if err == nil {
+			rpc.sent(res)
+		}
+		rpc.complete(ctx, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor producing metrics on the
+// default engine for every streaming RPC served.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return StreamServerInterceptorWith(stats.DefaultEngine)
+}
+
+// StreamServerInterceptorWith returns a gRPC interceptor producing metrics on
+// eng for every streaming RPC served.
+func StreamServerInterceptorWith(eng *stats.Engine) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		rpc := startRPC(ctx, eng, info.FullMethod)
+		err := handler(srv, &statsServerStream{ServerStream: ss, rpc: rpc.rpc})
+		rpc.complete(ctx, err)
+		return err
+	}
+}
+
+// statsServerStream observes the size of the messages of a streaming RPC.
+type statsServerStream struct {
+	grpc.ServerStream
+	rpc rpc
+}
+
+func (s *statsServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.rpc.sent(m)
+	}
+	return err
+}
+
+func (s *statsServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.rpc.received(m)
+	}
+	return err
+}
+
+// serverRPC carries the state of an RPC between the time the handler starts
+// and the time it completes, it reports the metrics of rpcSide for the server
+// side.
+//
+// When the RPC starts, the time remaining until the deadline set by the
+// client is observed in the grpc.server.deadline.remaining.seconds histogram,
+// or grpc.server.deadline.missing.count is incremented if the client did not
+// set a deadline.
+//
+// When the RPC completes, it is counted in grpc.server.deadline_exceeded.count
+// if the deadline expired, or in grpc.server.canceled.count if the client
+// canceled it, so those outcomes can be told apart from other errors.
+type serverRPC struct {
+	rpc
+}
+
+func startRPC(ctx context.Context, eng *stats.Engine, fullMethod string) serverRPC {
+	rpc := serverRPC{startRPCSide(eng, serverSide, fullMethod)}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining < 0 {
+			remaining = 0
+		}
+		eng.Observe("grpc.server.deadline.remaining.seconds", remaining, rpc.tags...)
+	} else {
+		eng.Incr("grpc.server.deadline.missing.count", rpc.tags...)
+	}
+
+	return rpc
+}
+
+func (rpc serverRPC) complete(ctx context.Context, err error) {
+	code := outcomeOf(ctx, err)
+
+	switch code {
+	case codes.DeadlineExceeded:
+		rpc.eng.Incr("grpc.server.deadline_exceeded.count", rpc.tags...)
+	case codes.Canceled:
+		rpc.eng.Incr("grpc.server.canceled.count", rpc.tags...)
+	}
+
+	rpc.completeWith(code)
+}
+
+// outcomeOf classifies the completion of an RPC. The context error takes
+// precedence over the error returned by the handler, because handlers often
+// wrap context errors in statuses with unrelated codes (or return no error at
+// all) once the client gave up.
+func outcomeOf(ctx context.Context, err error) codes.Code {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case context.Canceled:
+		return codes.Canceled
+	}
+
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	default:
+		return status.Code(err)
+	}
+}
+
+// splitMethodName splits a full gRPC method name of the form
+// "/package.Service/Method" into its service and method parts.
+func splitMethodName(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(fullMethod, '/'); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
@@ -0,0 +1,226 @@
+package grpcstats
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnaryServerInterceptorDeadline(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	tests := []struct {
+		scenario string
+		ctx      func() (context.Context, context.CancelFunc)
+		handler  grpc.UnaryHandler
+		metrics  []string
+	}{
+		{
+			scenario: "rpc without deadline",
+			ctx:      func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			handler:  func(context.Context, interface{}) (interface{}, error) { return nil, nil },
+			metrics:  []string{"grpc.server.deadline.missing.count"},
+		},
+		{
+			scenario: "rpc completing before its deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Minute)
+			},
+			handler: func(context.Context, interface{}) (interface{}, error) { return nil, status.Error(codes.NotFound, "") },
+			metrics: []string{"grpc.server.deadline.remaining.seconds"},
+		},
+		{
+			scenario: "rpc exceeding its deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond)
+			},
+			handler: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				<-ctx.Done()
+				// Handlers commonly report unrelated codes once the deadline
+				// expired, the context error must take precedence.
+				return nil, status.Error(codes.Unavailable, "")
+			},
+			metrics: []string{"grpc.server.deadline.remaining.seconds", "grpc.server.deadline_exceeded.count"},
+		},
+		{
+			scenario: "rpc canceled by the client",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				return ctx, cancel
+			},
+			handler: func(ctx context.Context, _ interface{}) (interface{}, error) {
+				return nil, status.Error(codes.Canceled, "")
+			},
+			metrics: []string{"grpc.server.deadline.missing.count", "grpc.server.canceled.count"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := &statstest.Handler{}
+			e := stats.NewEngine("", h)
+
+			ctx, cancel := test.ctx()
+			defer cancel()
+
+			intercept := UnaryServerInterceptorWith(e)
+			info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+			intercept(ctx, nil, info, test.handler)
+
+			measures := deadlineMeasures(h.Measures())
+			if len(measures) != len(test.metrics) {
+				t.Fatalf("expected %d measures, got %d: %v", len(test.metrics), len(measures), measures)
+			}
+
+			for i, m := range measures {
+				if name := m.Name + "." + m.Fields[0].Name; name != test.metrics[i] {
+					t.Errorf("expected %s, got %s", test.metrics[i], name)
+				}
+				expected := []stats.Tag{stats.T("grpc_method", "Method"), stats.T("grpc_service", "test.Service")}
+				if len(m.Tags) != 2 || m.Tags[0] != expected[0] || m.Tags[1] != expected[1] {
+					t.Errorf("bad tags: %v", m.Tags)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptorDeadline(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	intercept := StreamServerInterceptorWith(e)
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+	intercept(nil, &serverStream{ctx: ctx}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		<-ss.Context().Done()
+		return ss.Context().Err()
+	})
+
+	n := 0
+	for _, m := range h.Measures() {
+		if m.Name+"."+m.Fields[0].Name == "grpc.server.deadline_exceeded.count" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected the deadline to be reported as exceeded: %v", h.Measures())
+	}
+}
+
+// deadlineMeasures returns the measures of deadlines and cancellations, leaving
+// out the metrics reported for every RPC.
+func deadlineMeasures(measures []stats.Measure) []stats.Measure {
+	var filtered []stats.Measure
+	for _, m := range measures {
+		if !strings.HasPrefix(m.Name, "grpc.server.rpc") && !strings.HasPrefix(m.Name, "grpc.server.message") {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+func TestSplitMethodName(t *testing.T) {
+	tests := []struct {
+		fullMethod string
+		service    string
+		method     string
+	}{
+		{fullMethod: "/pkg.Service/Method", service: "pkg.Service", method: "Method"},
+		{fullMethod: "Method", service: "unknown", method: "Method"},
+	}
+
+	for _, test := range tests {
+		service, method := splitMethodName(test.fullMethod)
+		if service != test.service || method != test.method {
+			t.Errorf("%s: expected (%s, %s), got (%s, %s)", test.fullMethod, test.service, test.method, service, method)
+		}
+	}
+}
+
+func TestUnaryServerInterceptorMetrics(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	intercept := UnaryServerInterceptorWith(e)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	intercept(context.Background(), wrapperspb.String("hello"), info, func(context.Context, interface{}) (interface{}, error) {
+		return wrapperspb.String("hello world"), nil
+	})
+
+	metrics := map[string]stats.Value{}
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			metrics[m.Name+"."+f.Name] = f.Value
+		}
+		if m.Name == "grpc.server.rpc" {
+			if !hasTag(m.Tags, stats.T("grpc_code", "OK")) || !hasTag(m.Tags, stats.T("grpc_code_bucket", "ok")) {
+				t.Errorf("bad tags: %v", m.Tags)
+			}
+		}
+	}
+
+	if v := metrics["grpc.server.rpc.count"]; v.Int() != 1 {
+		t.Errorf("bad rpc count: %v", v)
+	}
+	if _, ok := metrics["grpc.server.rpc.seconds"]; !ok {
+		t.Error("missing rpc latency")
+	}
+	if v := metrics["grpc.server.message.received.bytes"]; v.Int() != 7 {
+		t.Errorf("bad received message size: %v", v)
+	}
+	if v := metrics["grpc.server.message.sent.bytes"]; v.Int() != 13 {
+		t.Errorf("bad sent message size: %v", v)
+	}
+}
+
+func hasTag(tags []stats.Tag, tag stats.Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCodeBucket(t *testing.T) {
+	tests := []struct {
+		code   codes.Code
+		bucket string
+	}{
+		{code: codes.OK, bucket: "ok"},
+		{code: codes.NotFound, bucket: "client_error"},
+		{code: codes.Unauthenticated, bucket: "client_error"},
+		{code: codes.Internal, bucket: "server_error"},
+		{code: codes.Unavailable, bucket: "server_error"},
+	}
+
+	for _, test := range tests {
+		if bucket := codeBucket(test.code); bucket != test.bucket {
+			t.Errorf("%s: expected %s, got %s", test.code, test.bucket, bucket)
+		}
+	}
+}
@@ -11,7 +11,10 @@ type Handler interface {
 	//
 	// The method must treat the list of measures as read-only values, and
 	// must not retain pointers to any of the measures or their sub-fields
-	// after returning.
+	// after returning: the engine recycles the measures, fields, and tags it
+	// passes to handlers for the next measures it produces. Handlers that
+	// need to keep measures around must copy them first, with Measure.Clone
+	// or CloneMeasures.
 	HandleMeasures(time time.Time, measures ...Measure)
 }
 
@@ -37,7 +40,8 @@ func (f HandlerFunc) HandleMeasures(time time.Time, measures ...Measure) {
 }
 
 // MultiHandler constructs a handler which dispatches measures to all given
-// handlers.
+// handlers. The handlers are called sequentially by the goroutine producing
+// the measures, use FanOut to isolate the program from slow handlers.
 func MultiHandler(handlers ...Handler) Handler {
 	multi := make([]Handler, 0, len(handlers))
 
@@ -74,6 +78,12 @@ func (m *multiHandler) Flush() {
 	}
 }
 
+// Handlers returns the handlers that m dispatches measures to, which lets
+// packages find their own handlers among those set on an engine.
+func (m *multiHandler) Handlers() []Handler {
+	return m.handlers
+}
+
 // FilteredHandler constructs a Handler that processes Measures with `filter` before forwarding to `h`.
 func FilteredHandler(h Handler, filter func([]Measure) []Measure) Handler {
 	return &filteredHandler{handler: h, filter: filter}
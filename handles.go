@@ -0,0 +1,266 @@
+package stats
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CounterHandle is a counter of an engine, whose name and tags are resolved
+// when it is created, so reporting it does not repeat the work done by each
+// call to Engine.Add. The sample rate is looked up on each report, so changes
+// to SampleRates and Engine.SampleRate apply to existing handles. Handles are created with Engine.Counter,
+// usually once, outside of the loops which report them.
+//
+// Engines cache the handles they create, calls to Engine.Counter with the
+// same name and tags return the same handle, and each call acquires a
+// reference to it. Programs which stop using a handle call Release, so the
+// engine can drop it from its cache on the next flush; handles that were not
+// reported for longer than Engine.HandleTTL are dropped as well, even if they
+// were not released, so services with churning tag values do not accumulate
+// handles. Dropped handles remain usable, they are only not shared anymore.
+//
+// Handles are safe to use concurrently from multiple goroutines.
+type CounterHandle struct{ handle }
+
+// GaugeHandle is a gauge of an engine, created by Engine.Gauge, see
+// CounterHandle for details.
+type GaugeHandle struct{ handle }
+
+// HistogramHandle is a histogram of an engine, created by Engine.Histogram, see
+// CounterHandle for details.
+type HistogramHandle struct{ handle }
+
+// Counter returns a handle to the counter identified by name and tags.
+func (e *Engine) Counter(name string, tags ...Tag) *CounterHandle {
+	return e.handles.load().acquire(Counter, name, tags, func() cachedHandle {
+		c := &CounterHandle{}
+		e.initHandle(&c.handle, name, tags)
+		return c
+	}).(*CounterHandle)
+}
+
+// Gauge returns a handle to the gauge identified by name and tags.
+func (e *Engine) Gauge(name string, tags ...Tag) *GaugeHandle {
+	return e.handles.load().acquire(Gauge, name, tags, func() cachedHandle {
+		g := &GaugeHandle{}
+		e.initHandle(&g.handle, name, tags)
+		return g
+	}).(*GaugeHandle)
+}
+
+// Histogram returns a handle to the histogram identified by name and tags.
+func (e *Engine) Histogram(name string, tags ...Tag) *HistogramHandle {
+	return e.handles.load().acquire(Histogram, name, tags, func() cachedHandle {
+		h := &HistogramHandle{}
+		e.initHandle(&h.handle, name, tags)
+		return h
+	}).(*HistogramHandle)
+}
+
+// Release gives back the reference acquired by the call to Engine.Counter,
+// Engine.Gauge or Engine.Histogram which returned the handle. Once all the
+// references were released, the engine drops the handle from its cache on
+// the next flush.
+func (h *handle) Release() {
+	h.refs.Add(-1)
+}
+
+// Incr increments the counter by one.
+func (c *CounterHandle) Incr() {
+	c.report(int64Value(1), Counter)
+}
+
+// Add increments the counter by value.
+func (c *CounterHandle) Add(value int64) {
+	c.report(int64Value(value), Counter)
+}
+
+// AddValue increments the counter by value, which may be of any numeric type.
+func (c *CounterHandle) AddValue(value Value) {
+	c.report(value, Counter)
+}
+
+// Set sets the gauge to value.
+func (g *GaugeHandle) Set(value float64) {
+	g.report(float64Value(value), Gauge)
+}
+
+// SetValue sets the gauge to value, which may be of any numeric type.
+func (g *GaugeHandle) SetValue(value Value) {
+	g.report(value, Gauge)
+}
+
+// Observe reports value for the histogram.
+func (h *HistogramHandle) Observe(value float64) {
+	h.report(float64Value(value), Histogram)
+}
+
+// ObserveDuration reports the duration d for the histogram.
+func (h *HistogramHandle) ObserveDuration(d time.Duration) {
+	h.report(durationValue(d), Histogram)
+}
+
+// ObserveValue reports value for the histogram, which may be of any numeric
+// type.
+func (h *HistogramHandle) ObserveValue(value Value) {
+	h.report(value, Histogram)
+}
+
+type handle struct {
+	eng   *Engine
+	name  string
+	field string
+	tags  []Tag
+
+	refs    atomic.Int64 // references acquired and not released
+	updated atomic.Int64 // unix time in nanoseconds of the last report
+}
+
+func (e *Engine) initHandle(h *handle, name string, tags []Tag) {
+	measure, field := splitMeasureField(name)
+
+	t := make([]Tag, 0, len(e.Tags)+len(tags))
+	t = append(t, e.Tags...)
+	t = append(t, tags...)
+
+	if len(tags) != 0 && !e.AllowDuplicateTags && !TagsAreSorted(t) {
+		t = SortTags(t)
+	}
+
+	h.eng = e
+	h.name = e.makeName(measure)
+	h.field = field
+	h.tags = t[:len(t):len(t)]
+	h.updated.Store(time.Now().UnixNano())
+}
+
+func (h *handle) state() *handle { return h }
+
+// sampleRate is like Engine.sampleRate, with the name of the handle already
+// resolved.
+func (h *handle) sampleRate() float64 {
+	if rates := SampleRates.load(); len(rates) != 0 {
+		if rate, ok := rates[Key{Measure: h.name, Field: h.field}]; ok {
+			return rate
+		}
+	}
+	return h.eng.SampleRate
+}
+
+func (h *handle) report(value Value, ftype FieldType) {
+	if noop {
+		return
+	}
+
+	t := time.Now()
+	e := h.eng
+
+	// Handles reported from many goroutines would contend on the cache line
+	// of the update time if it was written on every report, the precision
+	// needed to expire handles is much coarser than a millisecond.
+	if now := t.UnixNano(); now-h.updated.Load() > int64(time.Millisecond) {
+		h.updated.Store(now)
+	}
+	e.reportVersionOnce(t)
+
+	rate := h.sampleRate()
+	if sampling(rate) {
+		if !sample(context.Background(), rate) {
+			return
+		}
+		if ftype == Counter {
+			value = scaleValue(value, rate)
+		}
+	} else {
+		rate = 0
+	}
+
+	mp := measureArrayPool.Get().(*[1]Measure)
+	m := &(*mp)[0]
+
+	// The tags of the handle are shared by all the measures it produces, the
+	// tags of the pooled measure are put back before it is reset, since
+	// resetting clears them.
+	tags := m.Tags
+	m.Name = h.name
+	m.Fields = append(m.Fields[:0], makeField(h.field, value, ftype))
+	m.SampleRate = rate
+	m.Tags = h.tags
+
+	if ftype == Gauge {
+		e.trackGauges((*mp)[:])
+	}
+
+	e.handle(t, (*mp)[:])
+
+	m.Tags = tags
+	m.reset()
+	measureArrayPool.Put(mp)
+}
+
+// cachedHandle is implemented by the typed handles, which embed a handle.
+type cachedHandle interface {
+	state() *handle
+}
+
+// handleCache holds the handles created by an engine. The handles include the
+// engine prefix in their names, which is why the cache is local to the engine.
+type handleCache struct {
+	mutex   sync.Mutex
+	handles map[string]cachedHandle
+}
+
+func (c *handleCache) acquire(ftype FieldType, name string, tags []Tag, create func() cachedHandle) cachedHandle {
+	// The same series may be requested with tags in different orders, the
+	// key is built from sorted tags so they share a handle.
+	if !TagsAreSorted(tags) {
+		tags = SortTags(copyTags(tags))
+	}
+	key := seriesKey(ftype.String(), name, tags)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.handles == nil {
+		c.handles = make(map[string]cachedHandle)
+	}
+
+	h := c.handles[key]
+	if h == nil {
+		h = create()
+		c.handles[key] = h
+	}
+
+	h.state().refs.Add(1)
+	return h
+}
+
+// release drops the handles which have no references, or were not reported
+// since ttl before now, if ttl is positive.
+func (c *handleCache) release(now time.Time, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, h := range c.handles {
+		s := h.state()
+		if s.refs.Load() <= 0 || (ttl > 0 && now.UnixNano()-s.updated.Load() >= int64(ttl)) {
+			delete(c.handles, key)
+		}
+	}
+}
+
+// lazyHandleCache is embedded in engines, which may be constructed as struct
+// literals, to create their cache on first use.
+type lazyHandleCache struct {
+	ptr atomic.Pointer[handleCache]
+}
+
+func (l *lazyHandleCache) load() *handleCache {
+	if c := l.ptr.Load(); c != nil {
+		return c
+	}
+	l.ptr.CompareAndSwap(nil, new(handleCache))
+	return l.ptr.Load()
+}
@@ -0,0 +1,176 @@
+package stats_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestHandles(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h, stats.T("service", "api"))
+
+	c := e.Counter("requests.count", stats.T("method", "GET"))
+	g := e.Gauge("queue.size")
+	o := e.Histogram("requests.rtt", stats.T("method", "GET"))
+
+	c.Incr()
+	c.Add(2)
+	g.Set(3.5)
+	o.Observe(0.25)
+	o.ObserveDuration(time.Second)
+
+	// Handles produce the same measures as the engine methods.
+	e.Incr("requests.count", stats.T("method", "GET"))
+	e.Add("requests.count", int64(2), stats.T("method", "GET"))
+	e.Set("queue.size", 3.5)
+	e.Observe("requests.rtt", 0.25, stats.T("method", "GET"))
+	e.Observe("requests.rtt", time.Second, stats.T("method", "GET"))
+
+	measures := h.Measures()
+	if len(measures) != 10 {
+		t.Fatalf("bad number of measures: %d", len(measures))
+	}
+
+	for i := 0; i != 5; i++ {
+		if !reflect.DeepEqual(measures[i], measures[i+5]) {
+			t.Errorf("measure %d differs from the engine method:\n- %v\n- %v", i, measures[i], measures[i+5])
+		}
+	}
+
+	if m := measures[0]; m.Name != "test.requests" || len(m.Tags) != 2 || m.Tags[0].Name != "method" {
+		t.Errorf("bad measure: %v", m)
+	}
+}
+
+func TestHandlesSampling(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+	e.SampleRate = 0.5
+
+	c := e.Counter("calls")
+	for i := 0; i != 1000; i++ {
+		c.Incr()
+	}
+
+	for _, m := range h.Measures() {
+		if m.SampleRate != 0.5 || m.Fields[0].Value.Float() != 2 {
+			t.Fatalf("bad sampled measure: %v", m)
+		}
+	}
+}
+
+func TestHandlesAllocs(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	e := stats.NewEngine("test", stats.Discard, stats.T("a", "b"))
+	c := e.Counter("calls", stats.T("c", "d"))
+	c.Incr() // warm up the measure pool
+
+	if allocs := testing.AllocsPerRun(100, c.Incr); allocs != 0 {
+		t.Errorf("CounterHandle.Incr allocated %g times", allocs)
+	}
+}
+
+func TestHandlesRelease(t *testing.T) {
+	e := stats.NewEngine("test", stats.Discard)
+
+	c1 := e.Counter("calls", stats.T("a", "b"))
+	c2 := e.Counter("calls", stats.T("a", "b"))
+	if c1 != c2 {
+		t.Fatal("handles of the same series must be shared")
+	}
+
+	if g := e.Gauge("calls", stats.T("a", "b")); g == nil {
+		t.Fatal("handles of different types must not conflict")
+	}
+
+	c1.Release()
+	e.Flush()
+
+	if c := e.Counter("calls", stats.T("a", "b")); c != c1 {
+		t.Error("handles with references must not be dropped")
+	}
+
+	c1.Release()
+	c2.Release()
+	e.Flush()
+
+	if c := e.Counter("calls", stats.T("a", "b")); c == c1 {
+		t.Error("released handles must be dropped on flush")
+	}
+
+	// Dropped handles remain usable.
+	c1.Incr()
+}
+
+func TestHandlesTTL(t *testing.T) {
+	e := stats.NewEngine("test", stats.Discard)
+	e.HandleTTL = 10 * time.Millisecond
+
+	c := e.Counter("calls")
+	c.Incr()
+	e.Flush()
+
+	if e.Counter("calls") != c {
+		t.Fatal("handles reported within their TTL must not be dropped")
+	}
+
+	time.Sleep(2 * e.HandleTTL)
+	e.Flush()
+
+	if e.Counter("calls") == c {
+		t.Error("handles not reported within their TTL must be dropped on flush")
+	}
+}
+
+func TestHandlesTagOrder(t *testing.T) {
+	e := stats.NewEngine("test", stats.Discard)
+
+	c1 := e.Counter("calls", stats.T("a", "1"), stats.T("b", "2"))
+	c2 := e.Counter("calls", stats.T("b", "2"), stats.T("a", "1"))
+
+	if c1 != c2 {
+		t.Error("handles of the same series must be shared regardless of the order of tags")
+	}
+}
+
+func TestHandlesSampleRatesUpdate(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+	c := e.Counter("calls.count")
+
+	stats.SampleRates.Set("test.calls.count", 0.5)
+	defer stats.SampleRates.Delete("test.calls.count")
+
+	for i := 0; i != 100; i++ {
+		c.Incr()
+	}
+
+	measures := h.Measures()
+	if len(measures) == 0 {
+		t.Fatal("no measures were reported")
+	}
+	for _, m := range measures {
+		if m.SampleRate != 0.5 {
+			t.Fatalf("the sample rate set after the handle was created was not applied: %v", m)
+		}
+	}
+}
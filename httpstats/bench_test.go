@@ -0,0 +1,182 @@
+package httpstats
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Allocation budgets of the handler and transport wrappers, per request.
+//
+// Middleware overhead is the main concern of programs adopting httpstats, these
+// budgets document what instrumenting a request costs, and the tests below
+// fail when a change makes the wrappers allocate more. When a change reduces
+// the number of allocations, the budgets should be lowered accordingly.
+//
+// The budgets cover the allocations of the wrappers only, the allocations of
+// the wrapped handler or transport are measured separately and subtracted.
+// Reading the body of requests or responses must not cost extra allocations.
+const (
+	handlerAllocBudget   = 8
+	transportAllocBudget = 3
+)
+
+// nopResponseWriter is a http.ResponseWriter which discards everything written
+// to it, reusing the same header map.
+type nopResponseWriter struct {
+	header http.Header
+}
+
+func (w *nopResponseWriter) Header() http.Header         { return w.header }
+func (w *nopResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *nopResponseWriter) WriteHeader(int)             {}
+
+// nopRoundTripper is a http.RoundTripper which returns the same response to
+// every request, without performing any network I/O.
+type nopRoundTripper struct {
+	body string
+}
+
+func (t *nopRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(t.body)),
+		ContentLength: int64(len(t.body)),
+		Request:       req,
+	}, nil
+}
+
+var (
+	helloHandler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		res.WriteHeader(http.StatusOK)
+		res.Write([]byte("Hello World!"))
+	})
+
+	discardEngine = stats.NewEngine("", stats.Discard)
+)
+
+func serveRequest(h http.Handler, body string) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	if body != "" {
+		req.Body = io.NopCloser(strings.NewReader(body))
+	}
+	h.ServeHTTP(&nopResponseWriter{header: http.Header{}}, req)
+}
+
+func sendRequest(t http.RoundTripper, body string) {
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/", nil)
+	if body != "" {
+		req.Body = io.NopCloser(strings.NewReader(body))
+	}
+	res, err := t.RoundTrip(req)
+	if err != nil {
+		panic(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
+
+func TestHandlerAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation budgets are not enforced with the race detector")
+	}
+
+	tests := []struct {
+		scenario string
+		body     string
+		budget   float64
+	}{
+		{scenario: "without body", body: "", budget: handlerAllocBudget},
+		{scenario: "with body", body: "Hi!", budget: handlerAllocBudget},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := NewHandlerWith(discardEngine, helloHandler)
+			base := testing.AllocsPerRun(100, func() { serveRequest(helloHandler, test.body) })
+			allocs := testing.AllocsPerRun(100, func() { serveRequest(h, test.body) }) - base
+
+			if allocs > test.budget {
+				t.Errorf("the handler exceeds its allocation budget: %g > %g allocs per request", allocs, test.budget)
+			}
+		})
+	}
+}
+
+func TestTransportAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation budgets are not enforced with the race detector")
+	}
+
+	tests := []struct {
+		scenario string
+		body     string
+		budget   float64
+	}{
+		{scenario: "without body", body: "", budget: transportAllocBudget},
+		{scenario: "with body", body: "Hi!", budget: transportAllocBudget},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			rt := &nopRoundTripper{body: "Hello World!"}
+			tr := NewTransportWith(discardEngine, rt)
+			base := testing.AllocsPerRun(100, func() { sendRequest(rt, test.body) })
+			allocs := testing.AllocsPerRun(100, func() { sendRequest(tr, test.body) }) - base
+
+			if allocs > test.budget {
+				t.Errorf("the transport exceeds its allocation budget: %g > %g allocs per request", allocs, test.budget)
+			}
+		})
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	for _, body := range []string{"", "Hi!"} {
+		name := "without body"
+		if body != "" {
+			name = "with body"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			h := NewHandlerWith(discardEngine, helloHandler)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					serveRequest(h, body)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkTransport(b *testing.B) {
+	for _, body := range []string{"", "Hi!"} {
+		name := "without body"
+		if body != "" {
+			name = "with body"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			t := NewTransportWith(discardEngine, &nopRoundTripper{body: "Hello World!"})
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					sendRequest(t, body)
+				}
+			})
+		})
+	}
+}
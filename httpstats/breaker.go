@@ -0,0 +1,99 @@
+package httpstats
+
+import (
+	"net/http"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// BreakerState represents the state of a circuit breaker, the values match the
+// states of github.com/sony/gobreaker so they can be converted directly.
+type BreakerState int
+
+const (
+	// BreakerClosed is the state of circuit breakers letting requests through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerHalfOpen is the state of circuit breakers letting a limited
+	// number of requests through, to probe whether the server recovered.
+	BreakerHalfOpen
+
+	// BreakerOpen is the state of circuit breakers rejecting all requests.
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker exposes hooks for circuit breaker libraries wrapped around a
+// transport created by NewTransport, reporting the activity of the circuit
+// breaker in the same "http" namespace as the requests.
+//
+// The hooks are meant to be called from the callbacks of the library, for
+// example with github.com/sony/gobreaker:
+//
+//	b := httpstats.NewBreaker("payments")
+//
+//	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+//		Name: "payments",
+//		OnStateChange: func(_ string, from, to gobreaker.State) {
+//			b.StateChange(httpstats.BreakerState(from), httpstats.BreakerState(to))
+//		},
+//	})
+//
+// The metrics reported by a breaker are:
+//
+//	http.breaker.transition.count     counter, tagged with the previous and new state
+//	http.breaker.state                gauge, 0 when closed, 1 when half-open, 2 when open
+//	http.breaker.short_circuit.count  counter, tagged with the method and host of requests
+//
+// All metrics are tagged with the name of the breaker in "http_breaker".
+type Breaker struct {
+	eng  *stats.Engine
+	name string
+}
+
+// NewBreaker returns a Breaker reporting metrics on the default engine for the
+// circuit breaker identified by name.
+func NewBreaker(name string) *Breaker {
+	return NewBreakerWith(stats.DefaultEngine, name)
+}
+
+// NewBreakerWith returns a Breaker reporting metrics on eng for the circuit
+// breaker identified by name.
+func NewBreakerWith(eng *stats.Engine, name string) *Breaker {
+	return &Breaker{eng: eng, name: name}
+}
+
+// StateChange reports the transition of the circuit breaker from a state to
+// another.
+func (b *Breaker) StateChange(from, to BreakerState) {
+	b.eng.Incr("http.breaker.transition.count",
+		stats.T("http_breaker", b.name),
+		stats.T("http_breaker_from", from.String()),
+		stats.T("http_breaker_to", to.String()),
+	)
+	b.eng.Set("http.breaker.state", int(to), stats.T("http_breaker", b.name))
+}
+
+// ShortCircuit reports that req was rejected by the circuit breaker without
+// being sent, because the breaker was open or had too many requests in flight
+// while half-open.
+func (b *Breaker) ShortCircuit(req *http.Request) {
+	tags := append(RequestTags(req),
+		stats.T("http_breaker", b.name),
+		stats.T("http_req_method", req.Method),
+		stats.T("http_req_host", requestHost(req)),
+	)
+	b.eng.Incr("http.breaker.short_circuit.count", tags...)
+}
@@ -0,0 +1,70 @@
+package httpstats
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestBreaker(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+	b := NewBreakerWith(e, "payments")
+
+	req, _ := http.NewRequest("POST", "http://payments.local/charge", nil)
+
+	b.StateChange(BreakerClosed, BreakerOpen)
+	b.ShortCircuit(req)
+	b.StateChange(BreakerOpen, BreakerHalfOpen)
+
+	expect := []stats.Measure{
+		{
+			Name:   "http.breaker.transition",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags: []stats.Tag{
+				stats.T("http_breaker", "payments"),
+				stats.T("http_breaker_from", "closed"),
+				stats.T("http_breaker_to", "open"),
+			},
+		},
+		{
+			Name:   "http.breaker",
+			Fields: []stats.Field{stats.MakeField("state", 2, stats.Gauge)},
+			Tags:   []stats.Tag{stats.T("http_breaker", "payments")},
+		},
+		{
+			Name:   "http.breaker.short_circuit",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags: []stats.Tag{
+				stats.T("http_breaker", "payments"),
+				stats.T("http_req_host", "payments.local"),
+				stats.T("http_req_method", "POST"),
+			},
+		},
+		{
+			Name:   "http.breaker.transition",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags: []stats.Tag{
+				stats.T("http_breaker", "payments"),
+				stats.T("http_breaker_from", "open"),
+				stats.T("http_breaker_to", "half-open"),
+			},
+		},
+		{
+			Name:   "http.breaker",
+			Fields: []stats.Field{stats.MakeField("state", 1, stats.Gauge)},
+			Tags:   []stats.Tag{stats.T("http_breaker", "payments")},
+		},
+	}
+
+	if measures := h.Measures(); !reflect.DeepEqual(measures, expect) {
+		t.Errorf("bad measures:\n- expected: %v\n- found:    %v", expect, measures)
+	}
+}
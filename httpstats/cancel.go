@@ -0,0 +1,53 @@
+package httpstats
+
+import (
+	"context"
+	"errors"
+)
+
+// CancelReasonTag is the name of the tag set on the metrics of requests whose
+// context was canceled before the handler returned, its value describes why
+// the request was aborted:
+//
+//   - "client_disconnect" when the client closed the connection, which is how
+//     net/http cancels the context of requests,
+//   - "shutdown" when the cause of the cancellation is ErrServerShutdown,
+//   - "timeout" when a deadline of the context expired,
+//   - "canceled" for any other cause.
+const CancelReasonTag = "http_req_cancel_reason"
+
+var (
+	// ErrServerShutdown is the cause that programs set when canceling the
+	// context of requests because the server is shutting down, for example by
+	// cancelling the base context of the server with context.WithCancelCause,
+	// so aborted requests are not mistaken for client disconnects.
+	ErrServerShutdown = errors.New("httpstats: server shutting down")
+
+	// ErrClientDisconnected is the cause that programs set when canceling the
+	// context of requests after detecting that the client went away.
+	ErrClientDisconnected = errors.New("httpstats: client disconnected")
+)
+
+// cancelReason returns the value of the CancelReasonTag for ctx, or an empty
+// string if ctx was not canceled. The reason is derived from the cause of the
+// cancellation (see context.Cause), the set of values is kept small since it
+// is used as a tag.
+func cancelReason(ctx context.Context) string {
+	if ctx.Err() == nil {
+		return ""
+	}
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrServerShutdown):
+		return "shutdown"
+	case errors.Is(cause, ErrClientDisconnected):
+		return "client_disconnect"
+	case errors.Is(cause, context.DeadlineExceeded):
+		return "timeout"
+	case cause == context.Canceled:
+		// net/http cancels the context of requests without a cause when the
+		// connection of the client is closed.
+		return "client_disconnect"
+	default:
+		return "canceled"
+	}
+}
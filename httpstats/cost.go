@@ -0,0 +1,107 @@
+package httpstats
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// RequestAddCost adds value to the cost identified by name on req, which must
+// have been received by a handler created with NewHandler or NewHandlerWith.
+// Costs added multiple times under the same name are summed.
+//
+// Costs are arbitrary numeric weights attached to a request by the
+// application (rows scanned, credits consumed, ...). When the response
+// completes, each cost is reported as an observation of the
+// "http.request.cost" histogram tagged with the cost name, the request method,
+// and the request tags, which include the http_route tag of the request (see
+// HandlerConfig.Route). Costs are not tagged with the request path, so their
+// cardinality is bounded by the number of routes.
+//
+// RequestAddCost returns true if the cost was recorded, and false if req was
+// not served by an httpstats handler.
+func RequestAddCost(req *http.Request, name string, value float64) bool {
+	return ContextAddCost(req.Context(), name, value)
+}
+
+// ContextAddCost is like RequestAddCost but operates on the context of the
+// request, which is useful in code paths that do not have access to the
+// *http.Request.
+func ContextAddCost(ctx context.Context, name string, value float64) bool {
+	if c := getRequestCosts(ctx); c != nil {
+		c.add(name, value)
+		return true
+	}
+	return false
+}
+
+// RequestCosts returns a copy of the costs recorded on req, or nil if req was
+// not served by an httpstats handler.
+func RequestCosts(req *http.Request) map[string]float64 {
+	if c := getRequestCosts(req.Context()); c != nil {
+		return c.copy()
+	}
+	return nil
+}
+
+type requestCosts struct {
+	lock  sync.Mutex
+	names []string
+	costs map[string]float64
+}
+
+func (c *requestCosts) add(name string, value float64) {
+	c.lock.Lock()
+	if c.costs == nil {
+		c.costs = make(map[string]float64)
+	}
+	if _, ok := c.costs[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.costs[name] += value
+	c.lock.Unlock()
+}
+
+func (c *requestCosts) copy() map[string]float64 {
+	c.lock.Lock()
+	m := make(map[string]float64, len(c.costs))
+	for name, value := range c.costs {
+		m[name] = value
+	}
+	c.lock.Unlock()
+	return m
+}
+
+func (c *requestCosts) report(eng *stats.Engine, req *http.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.names) == 0 {
+		return
+	}
+
+	tags := append(RequestTags(req),
+		stats.T("http_req_method", req.Method),
+		stats.Tag{Name: "cost"},
+	)
+
+	for _, name := range c.names {
+		tags[len(tags)-1].Value = name
+		eng.Observe("http.request.cost", c.costs[name], tags...)
+	}
+}
+
+// costsKey is the context key under which handlers store the request costs.
+type costsKey struct{}
+
+func contextWithCosts(ctx context.Context) (context.Context, *requestCosts) {
+	c := &requestCosts{}
+	return context.WithValue(ctx, costsKey{}, c), c
+}
+
+func getRequestCosts(ctx context.Context) *requestCosts {
+	c, _ := ctx.Value(costsKey{}).(*requestCosts)
+	return c
+}
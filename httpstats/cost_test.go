@@ -0,0 +1,78 @@
+package httpstats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestRequestAddCost(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query/{table}", func(res http.ResponseWriter, req *http.Request) {
+		RequestAddCost(req, "rows_scanned", 40)
+		RequestAddCost(req, "rows_scanned", 2)
+		ContextAddCost(req.Context(), "credits", 1.5)
+
+		if costs := RequestCosts(req); costs["rows_scanned"] != 42 || costs["credits"] != 1.5 {
+			t.Errorf("bad request costs: %v", costs)
+		}
+
+		res.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(NewHandlerWith(e, mux))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/query/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	e.Flush()
+
+	costs := map[string]float64{}
+	for _, m := range h.Measures() {
+		if m.Name != "http.request" {
+			continue
+		}
+		for _, f := range m.Fields {
+			if f.Name != "cost" || f.Type() != stats.Histogram {
+				t.Errorf("bad cost field: %v", f)
+			}
+			tags := map[string]string{}
+			for _, tag := range m.Tags {
+				tags[tag.Name] = tag.Value
+			}
+			if tags["http_route"] != "/query/{table}" || tags["http_req_method"] != "GET" {
+				t.Errorf("bad cost tags: %v", m.Tags)
+			}
+			if _, ok := tags["http_req_path"]; ok {
+				t.Errorf("bad cost tags: %v", m.Tags)
+			}
+			costs[tags["cost"]] = f.Value.Float()
+		}
+	}
+
+	if len(costs) != 2 || costs["rows_scanned"] != 42 || costs["credits"] != 1.5 {
+		t.Errorf("bad costs reported: %v", costs)
+	}
+}
+
+func TestRequestAddCostWithoutHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if RequestAddCost(req, "credits", 1) {
+		t.Error("costs must not be recorded on requests not served by an httpstats handler")
+	}
+
+	if costs := RequestCosts(req); costs != nil {
+		t.Errorf("unexpected costs: %v", costs)
+	}
+}
@@ -0,0 +1,94 @@
+package httpstats
+
+import (
+	"net/http"
+	"strconv"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// grpcStatusTags returns the grpc_code and grpc_code_bucket tags of responses
+// carrying a grpc-status trailer, which is how gRPC, and Connect using the gRPC
+// protocol, report the status of RPCs over responses which are almost always
+// 200 OK. The tags match those of the grpcstats package.
+//
+// The status is looked up in the trailer, then in the header since responses
+// to RPCs which failed before sending any message carry it in their header
+// (trailers-only responses). Server handlers set trailers in the header map,
+// either declared by the Trailer header or with the http.TrailerPrefix prefix.
+//
+// It returns nil for responses without a status, which are not RPCs.
+func grpcStatusTags(header, trailer http.Header) []stats.Tag {
+	status := headerValue(trailer, "Grpc-Status")
+	if status == "" {
+		status = headerValue(header, "Grpc-Status")
+	}
+	if status == "" {
+		status = headerValue(header, http.TrailerPrefix+"Grpc-Status")
+	}
+	if status == "" {
+		return nil
+	}
+
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		// Unparsable statuses are treated as Unknown by gRPC clients.
+		code = 2
+	}
+
+	return []stats.Tag{
+		stats.T("grpc_code", grpcCodeName(code)),
+		stats.T("grpc_code_bucket", grpcCodeBucket(code)),
+	}
+}
+
+// grpcCodes are the names of the gRPC status codes, as returned by the String
+// method of codes.Code.
+var grpcCodes = [...]string{
+	"OK",
+	"Canceled",
+	"Unknown",
+	"InvalidArgument",
+	"DeadlineExceeded",
+	"NotFound",
+	"AlreadyExists",
+	"PermissionDenied",
+	"ResourceExhausted",
+	"FailedPrecondition",
+	"Aborted",
+	"OutOfRange",
+	"Unimplemented",
+	"Internal",
+	"Unavailable",
+	"DataLoss",
+	"Unauthenticated",
+}
+
+func grpcCodeName(code uint64) string {
+	if code < uint64(len(grpcCodes)) {
+		return grpcCodes[code]
+	}
+	return "Code(" + strconv.FormatUint(code, 10) + ")"
+}
+
+// grpcCodeBucket groups status codes by the party responsible for the failure
+// of RPCs, like responseStatusBucket does for HTTP status codes.
+func grpcCodeBucket(code uint64) string {
+	switch grpcCodeName(code) {
+	case "OK":
+		return "ok"
+	case "Canceled",
+		"InvalidArgument",
+		"NotFound",
+		"AlreadyExists",
+		"PermissionDenied",
+		"ResourceExhausted",
+		"FailedPrecondition",
+		"Aborted",
+		"OutOfRange",
+		"Unauthenticated":
+		return "client_error"
+	default:
+		return "server_error"
+	}
+}
@@ -0,0 +1,100 @@
+package httpstats
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestGRPCStatusTags(t *testing.T) {
+	tests := []struct {
+		scenario string
+		status   func(http.ResponseWriter)
+		code     string
+		bucket   string
+	}{
+		{
+			scenario: "declared trailer",
+			status: func(res http.ResponseWriter) {
+				res.Header().Set("Trailer", "Grpc-Status")
+				res.Write([]byte("message"))
+				res.Header().Set("Grpc-Status", "5")
+			},
+			code:   "NotFound",
+			bucket: "client_error",
+		},
+		{
+			scenario: "prefixed trailer",
+			status: func(res http.ResponseWriter) {
+				// large enough to not be buffered, so the response is
+				// chunked and carries the undeclared trailer
+				res.Write([]byte(strings.Repeat("message\n", 1000)))
+				res.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+			},
+			code:   "OK",
+			bucket: "ok",
+		},
+		{
+			scenario: "trailers-only response",
+			status: func(res http.ResponseWriter) {
+				res.Header().Set("Grpc-Status", "14")
+				res.WriteHeader(http.StatusOK)
+			},
+			code:   "Unavailable",
+			bucket: "server_error",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			serverHandler := &statstest.Handler{}
+			clientHandler := &statstest.Handler{}
+
+			server := httptest.NewServer(NewHandlerWith(stats.NewEngine("", serverHandler), http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+				res.Header().Set("Content-Type", "application/grpc")
+				test.status(res)
+			})))
+			defer server.Close()
+
+			client := &http.Client{Transport: NewTransportWith(stats.NewEngine("", clientHandler), http.DefaultTransport)}
+
+			res, err := client.Post(server.URL, "application/grpc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.ReadAll(res.Body)
+			res.Body.Close()
+			server.Close()
+
+			for side, h := range map[string]*statstest.Handler{"server": serverHandler, "client": clientHandler} {
+				var found bool
+				for _, m := range h.Measures() {
+					if m.Name != "http.message" || !hasTag(m.Tags, stats.T("type", "response")) {
+						continue
+					}
+					found = true
+					if !hasTag(m.Tags, stats.T("grpc_code", test.code)) || !hasTag(m.Tags, stats.T("grpc_code_bucket", test.bucket)) {
+						t.Errorf("%s: bad tags of the response metrics: %v", side, m.Tags)
+					}
+				}
+				if !found {
+					t.Errorf("%s: no response metrics were reported", side)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCStatusTagsWithoutStatus(t *testing.T) {
+	if tags := grpcStatusTags(http.Header{"Content-Type": {"text/plain"}}, nil); tags != nil {
+		t.Errorf("responses without a grpc-status must not be tagged: %v", tags)
+	}
+	if tags := grpcStatusTags(nil, http.Header{"Grpc-Status": {"42"}}); tags[0].Value != "Code(42)" || tags[1].Value != "server_error" {
+		t.Errorf("bad tags of an unknown status: %v", tags)
+	}
+}
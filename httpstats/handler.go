@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"net"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	stats "github.com/segmentio/stats/v5"
@@ -18,28 +20,116 @@ func NewHandler(h http.Handler) http.Handler {
 // NewHandlerWith wraps h to produce metrics on eng for every request received
 // and every response sent.
 func NewHandlerWith(eng *stats.Engine, h http.Handler) http.Handler {
+	return NewHandlerWithConfig(h, HandlerConfig{Engine: eng})
+}
+
+// HandlerConfig carries the configuration of handlers created by
+// NewHandlerWithConfig.
+type HandlerConfig struct {
+	// Engine that metrics are produced on, defaults to stats.DefaultEngine.
+	Engine *stats.Engine
+
+	// Route returns the route of requests, which is set as the http_route tag
+	// of the metrics, so the latency of each endpoint can be charted without
+	// the cardinality of request paths. By default the route is the pattern
+	// of the http.ServeMux which served the request (see Request.Pattern),
+	// requests without a route are not tagged.
+	Route func(*http.Request) string
+
+	// TagTraceID enables attaching the trace ID of requests carrying a W3C
+	// traceparent header or B3 headers to their metrics as exemplars, so
+	// latency outliers can be correlated with traces. The trace ID is set as
+	// the TraceIDTag tag, which is registered in stats.ExemplarTags: only the
+	// handlers turning it into exemplars receive it, it is removed for the
+	// other handlers so it never creates a series per request. The tag is
+	// added to the context of requests, so metrics reported with it carry
+	// the trace ID as well.
+	TagTraceID bool
+
+	// ServerTiming enables writing a Server-Timing header on responses, with
+	// the time the handler took to produce the response header ("handler"
+	// metric). The time spent writing the response body ("write" metric) and
+	// the total time ("total" metric) are sent in a Server-Timing trailer,
+	// which clients only receive on chunked or HTTP/2 responses.
+	//
+	// Browsers and proxies use those values to correlate the latency they
+	// observe with the server metrics.
+	ServerTiming bool
+}
+
+// NewHandlerWithConfig wraps h to produce metrics for every request received
+// and every response sent, as configured by config.
+//
+// The http.rtt.seconds metric is the time until h returned, it is split in two
+// metrics: http.handler.seconds, the time h spent producing the response, and
+// http.client_io.seconds, the time h spent blocked reading the request body
+// and writing the response, which grows with slow clients. The
+// http.ttfb.seconds metric is the time until h wrote the response header.
+//
+// The number of requests being served is reported as the
+// http.requests.in_flight gauge, tagged with side=server, when requests start
+// and complete. The count covers all the handlers reporting to the engine.
+//
+// Responses carrying a grpc-status trailer, like those of gRPC services
+// served by h, are tagged with the grpc_code and grpc_code_bucket tags of the
+// RPC status, since their HTTP status is 200 OK even when the RPC failed.
+func NewHandlerWithConfig(h http.Handler, config HandlerConfig) http.Handler {
+	if config.Engine == nil {
+		config.Engine = stats.DefaultEngine
+	}
+	if config.Route == nil {
+		config.Route = servemuxRoute
+	}
+	if config.TagTraceID {
+		stats.ExemplarTags.Add(TraceIDTag)
+	}
 	return &handler{
-		handler: h,
-		eng:     eng,
+		handler:      h,
+		eng:          config.Engine,
+		route:        config.Route,
+		tagTraceID:   config.TagTraceID,
+		serverTiming: config.ServerTiming,
+		inFlight:     inFlightCount(config.Engine, serverSideTag),
 	}
 }
 
 type handler struct {
-	handler http.Handler
-	eng     *stats.Engine
+	handler      http.Handler
+	eng          *stats.Engine
+	route        func(*http.Request) string
+	tagTraceID   bool
+	serverTiming bool
+	inFlight     *atomic.Int64
+}
+
+// servemuxRoute returns the pattern set on req by the http.ServeMux that served
+// it, the mux sets it on the request that the wrapping handler passed to it.
+func servemuxRoute(req *http.Request) string {
+	return req.Pattern
 }
 
 func (h *handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	m := &metrics{}
 
-	req = RequestWithTags(req)
+	ctx, costs := contextWithCosts(req.Context())
+	req = RequestWithTags(req.WithContext(ctx))
+	if h.tagTraceID {
+		if id := traceID(req.Header); id != "" {
+			stats.ContextAddTags(req.Context(), stats.T(TraceIDTag, id))
+		}
+	}
 	w := &responseWriter{
 		ResponseWriter: res,
 		eng:            h.eng,
 		req:            req,
 		metrics:        m,
+		costs:          costs,
+		route:          h.route,
+		serverTiming:   h.serverTiming,
+		inFlight:       h.inFlight,
 		start:          time.Now(),
 	}
+	h.eng.Set(inFlightMetric, h.inFlight.Add(1), serverSideTag)
 	defer w.complete()
 
 	b := &requestBody{
@@ -48,6 +138,7 @@ func (h *handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		req:     req,
 		metrics: m,
 		op:      "read",
+		io:      &w.io,
 	}
 	defer b.close()
 
@@ -57,33 +148,41 @@ func (h *handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 type responseWriter struct {
 	http.ResponseWriter
-	start       time.Time
-	eng         *stats.Engine
-	req         *http.Request
-	metrics     *metrics
-	status      int
-	bytes       int
-	wroteHeader bool
-	wroteStats  bool
+	start        time.Time
+	header       time.Time // time the response header was written
+	eng          *stats.Engine
+	req          *http.Request
+	metrics      *metrics
+	costs        *requestCosts
+	route        func(*http.Request) string
+	inFlight     *atomic.Int64
+	status       int
+	bytes        int
+	io           time.Duration // time blocked reading or writing to the client
+	timing       handlerMetrics
+	wroteHeader  bool
+	wroteStats   bool
+	serverTiming bool
+	hijacked     bool
 }
 
 func (w *responseWriter) WriteHeader(status int) {
 	if !w.wroteHeader {
-		w.wroteHeader = true
-		w.status = status
+		w.writeHeader(status)
 		w.ResponseWriter.WriteHeader(status)
 	}
 }
 
 func (w *responseWriter) Write(b []byte) (n int, err error) {
 	if !w.wroteHeader {
-		w.wroteHeader = true
-		w.status = http.StatusOK
+		w.writeHeader(http.StatusOK)
 	}
 
+	start := time.Now()
 	if n, err = w.ResponseWriter.Write(b); n > 0 {
 		w.bytes += n
 	}
+	w.io += time.Since(start)
 
 	return
 }
@@ -91,6 +190,7 @@ func (w *responseWriter) Write(b []byte) (n int, err error) {
 func (w *responseWriter) Hijack() (conn net.Conn, buf *bufio.ReadWriter, err error) {
 	if conn, buf, err = w.ResponseWriter.(http.Hijacker).Hijack(); err == nil {
 		w.wroteHeader = true
+		w.hijacked = true
 		w.complete()
 	}
 	return
@@ -103,11 +203,12 @@ func (w *responseWriter) complete() {
 	w.wroteStats = true
 
 	if !w.wroteHeader {
-		w.wroteHeader = true
-		w.status = http.StatusOK
+		w.writeHeader(http.StatusOK)
 	}
 
 	now := time.Now()
+	w.writeServerTimingTrailer(now)
+
 	res := &http.Response{
 		ProtoMajor:    w.req.ProtoMajor,
 		ProtoMinor:    w.req.ProtoMinor,
@@ -118,6 +219,65 @@ func (w *responseWriter) complete() {
 		ContentLength: -1,
 	}
 
-	w.metrics.observeResponse(res, "write", w.bytes, now.Sub(w.start))
+	if route := w.route(w.req); route != "" {
+		// The context of the request was created by the handler, the tag is
+		// added to it so all the metrics of the request carry it.
+		stats.ContextAddTags(w.req.Context(), stats.T("http_route", route))
+	}
+	if tags := grpcStatusTags(w.Header(), nil); tags != nil {
+		stats.ContextAddTags(w.req.Context(), tags...)
+	}
+	if reason := cancelReason(w.req.Context()); reason != "" {
+		stats.ContextAddTags(w.req.Context(), stats.T(CancelReasonTag, reason))
+	}
+
+	rtt := now.Sub(w.start)
+	w.metrics.observeResponse(res, "write", w.bytes, rtt)
+	if !w.header.IsZero() {
+		w.metrics.http.res.ttfb = w.header.Sub(w.start)
+	}
 	w.eng.ReportAt(w.start, w.metrics, RequestTags(w.req)...)
+	w.costs.report(w.eng, w.req)
+
+	if !w.hijacked {
+		w.timing.http.handler = rtt - w.io
+		w.timing.http.clientIO = w.io
+		w.timing.http.method = w.req.Method
+		w.timing.http.statusBucket = responseStatusBucket(w.status)
+		w.eng.ReportAt(w.start, &w.timing, RequestTags(w.req)...)
+	}
+
+	w.eng.Set(inFlightMetric, w.inFlight.Add(-1), serverSideTag)
+}
+
+// writeHeader records the status of the response and the time its header is
+// written, it must be called right before the response header is written.
+func (w *responseWriter) writeHeader(status int) {
+	w.wroteHeader = true
+	w.status = status
+	w.header = time.Now()
+	w.writeServerTiming()
+}
+
+// writeServerTiming adds the Server-Timing header to the response.
+func (w *responseWriter) writeServerTiming() {
+	if !w.serverTiming {
+		return
+	}
+	w.Header().Add("Server-Timing", serverTimingMetric("handler", w.header.Sub(w.start)))
+}
+
+// writeServerTimingTrailer sets the Server-Timing trailer of the response.
+func (w *responseWriter) writeServerTimingTrailer(now time.Time) {
+	if !w.serverTiming || w.hijacked || w.header.IsZero() {
+		return
+	}
+	w.Header().Set(http.TrailerPrefix+"Server-Timing",
+		serverTimingMetric("write", now.Sub(w.header))+", "+serverTimingMetric("total", now.Sub(w.start)))
+}
+
+// serverTimingMetric formats a metric of the Server-Timing header, durations
+// are expressed in milliseconds.
+func serverTimingMetric(name string, d time.Duration) string {
+	return name + ";dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
 }
@@ -1,11 +1,16 @@
 package httpstats
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	stats "github.com/segmentio/stats/v5"
 	"github.com/segmentio/stats/v5/statstest"
@@ -90,3 +95,281 @@ func TestHandlerHijack(t *testing.T) {
 		t.Log(m)
 	}
 }
+
+func TestHandlerServerTiming(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	server := httptest.NewServer(NewHandlerWithConfig(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		res.WriteHeader(http.StatusOK)
+		// large enough to not be buffered, so the response is chunked and
+		// carries trailers
+		res.Write([]byte(strings.Repeat("Hello World\n", 1000)))
+	}), HandlerConfig{Engine: e, ServerTiming: true}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(res.Body)
+	res.Body.Close()
+
+	if timing := res.Header.Get("Server-Timing"); !strings.HasPrefix(timing, "handler;dur=") {
+		t.Errorf("bad Server-Timing header: %q", timing)
+	}
+
+	timing := res.Trailer.Get("Server-Timing")
+	if !strings.HasPrefix(timing, "write;dur=") || !strings.Contains(timing, ", total;dur=") {
+		t.Errorf("bad Server-Timing trailer: %q", timing)
+	}
+}
+
+func TestHandlerClientIO(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	handler := NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		io.ReadAll(req.Body)
+		res.Write([]byte("Hello World"))
+	}))
+
+	req := httptest.NewRequest("POST", "/", &slowReader{r: strings.NewReader("Hi"), delay: 20 * time.Millisecond})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var handlerTime, clientIO, rtt time.Duration
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			switch m.Name + "." + f.Name {
+			case "http.handler.seconds":
+				handlerTime = f.Value.Duration()
+			case "http.client_io.seconds":
+				clientIO = f.Value.Duration()
+			case "http.rtt.seconds":
+				rtt = f.Value.Duration()
+			}
+		}
+	}
+
+	if clientIO < 20*time.Millisecond {
+		t.Errorf("client I/O time does not include the time reading the body: %s", clientIO)
+	}
+	if handlerTime+clientIO != rtt {
+		t.Errorf("handler (%s) and client I/O (%s) times do not add up to the rtt (%s)", handlerTime, clientIO, rtt)
+	}
+}
+
+func TestHandlerInFlightAndTTFB(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	handler := NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		res.WriteHeader(http.StatusOK)
+		time.Sleep(10 * time.Millisecond)
+		res.Write([]byte("Hello World"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var inFlight []int64
+	var ttfb, rtt time.Duration
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			switch m.Name + "." + f.Name {
+			case "http.requests.in_flight":
+				inFlight = append(inFlight, f.Value.Int())
+			case "http.ttfb.seconds":
+				ttfb = f.Value.Duration()
+			case "http.rtt.seconds":
+				rtt = f.Value.Duration()
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(inFlight, []int64{1, 0}) {
+		t.Errorf("bad in-flight gauge values: %v", inFlight)
+	}
+	if ttfb < 10*time.Millisecond || ttfb >= rtt {
+		t.Errorf("bad time to first byte: %s (rtt = %s)", ttfb, rtt)
+	}
+}
+
+func TestHandlerInFlightShared(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	// Requests served by different handlers wrapped on the same engine are
+	// counted in the same gauge.
+	inner := NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	outer := NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		inner.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	outer.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var inFlight []int64
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			if m.Name+"."+f.Name == "http.requests.in_flight" {
+				inFlight = append(inFlight, f.Value.Int())
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(inFlight, []int64{1, 2, 1, 0}) {
+		t.Errorf("bad in-flight gauge values: %v", inFlight)
+	}
+}
+
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.r.Read(b)
+}
+
+func TestHandlerRoute(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("Hello World"))
+	})
+
+	for _, test := range []struct {
+		scenario string
+		config   HandlerConfig
+		route    string
+	}{
+		{
+			scenario: "the route is the pattern of the mux by default",
+			route:    "GET /users/{id}",
+		},
+		{
+			scenario: "the route is returned by the Route function",
+			config:   HandlerConfig{Route: func(*http.Request) string { return "users.get" }},
+			route:    "users.get",
+		},
+	} {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := &statstest.Handler{}
+			test.config.Engine = stats.NewEngine("", h)
+
+			handler := NewHandlerWithConfig(mux, test.config)
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/42", nil))
+
+			measures := h.Measures()
+			if len(measures) == 0 {
+				t.Fatal("no measures reported by http handler")
+			}
+
+			for _, m := range measures {
+				if m.Name == "http.requests" {
+					continue // the in-flight gauge is not tagged per request
+				}
+				found := false
+				for _, tag := range m.Tags {
+					if tag.Name == "http_route" {
+						found = true
+						if tag.Value != test.route {
+							t.Errorf("%s: bad route: %q", m.Name, tag.Value)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("%s: missing http_route tag: %v", m.Name, m.Tags)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerCancelReason(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	for _, test := range []struct {
+		scenario string
+		cancel   func(context.Context) context.Context
+		reason   string
+	}{
+		{
+			scenario: "requests that were not canceled are not tagged",
+			cancel:   func(ctx context.Context) context.Context { return ctx },
+		},
+		{
+			scenario: "requests canceled without a cause are client disconnects",
+			cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				return ctx
+			},
+			reason: "client_disconnect",
+		},
+		{
+			scenario: "requests canceled on shutdown",
+			cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancelCause(ctx)
+				cancel(fmt.Errorf("draining: %w", ErrServerShutdown))
+				return ctx
+			},
+			reason: "shutdown",
+		},
+		{
+			scenario: "requests which exceeded a deadline",
+			cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithDeadline(ctx, time.Now())
+				defer cancel()
+				return ctx
+			},
+			reason: "timeout",
+		},
+		{
+			scenario: "requests canceled with another cause",
+			cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancelCause(ctx)
+				cancel(errors.New("quota exceeded"))
+				return ctx
+			},
+			reason: "canceled",
+		},
+	} {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := &statstest.Handler{}
+			e := stats.NewEngine("", h)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(test.cancel(req.Context()))
+
+			handler := NewHandlerWith(e, http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+				res.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			for _, m := range h.Measures() {
+				if m.Name == "http.requests" {
+					continue // the in-flight gauge is not tagged per request
+				}
+				reason := ""
+				for _, tag := range m.Tags {
+					if tag.Name == CancelReasonTag {
+						reason = tag.Value
+					}
+				}
+				if reason != test.reason {
+					t.Errorf("%s: bad cancel reason: want %q, got %q", m.Name, test.reason, reason)
+				}
+			}
+		})
+	}
+}
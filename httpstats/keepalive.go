@@ -0,0 +1,163 @@
+package httpstats
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func init() {
+	stats.Buckets.Set("http.server.conn:requests",
+		1,
+		2,
+		5,
+		10,
+		100,
+		1000,
+		math.Inf(+1),
+	)
+}
+
+// KeepAlive reports how much server connections are reused by clients, to
+// help tune the IdleTimeout of http.Server and the MaxIdleConns of clients.
+//
+// The ConnState method must be installed on the server, the listener it
+// accepts connections from may also be wrapped by Listener to tell which side
+// closed the connections:
+//
+//	ka := httpstats.NewKeepAlive()
+//
+//	server := &http.Server{
+//		Handler:   httpstats.NewHandler(handler),
+//		ConnState: ka.ConnState,
+//	}
+//	server.Serve(ka.Listener(lstn))
+//
+// The metrics reported are:
+//
+//	http.server.conn.open.count     counter, incremented when connections are accepted
+//	http.server.conn.close.count    counter, tagged with the side that closed the connection
+//	http.server.conn.requests       histogram of the number of requests served per connection
+//	http.server.conn.idle.seconds   histogram of the time connections were idle between requests
+//
+// The "http_conn_closed_by" tag is set to "server" or "client", or "unknown"
+// when the connections were not accepted from a listener wrapped by Listener.
+type KeepAlive struct {
+	eng   *stats.Engine
+	conns sync.Map // net.Conn => *keepAliveState
+}
+
+// NewKeepAlive returns a KeepAlive reporting metrics on the default engine.
+func NewKeepAlive() *KeepAlive {
+	return NewKeepAliveWith(stats.DefaultEngine)
+}
+
+// NewKeepAliveWith returns a KeepAlive reporting metrics on eng.
+func NewKeepAliveWith(eng *stats.Engine) *KeepAlive {
+	return &KeepAlive{eng: eng}
+}
+
+type keepAliveState struct {
+	requests int
+	idle     time.Time
+}
+
+// ConnState is the hook to install as the ConnState field of http.Server.
+func (k *KeepAlive) ConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		k.conns.Store(conn, &keepAliveState{})
+		k.eng.Incr("http.server.conn.open.count")
+
+	case http.StateActive:
+		if s := k.state(conn); s != nil {
+			if !s.idle.IsZero() {
+				k.eng.Observe("http.server.conn.idle.seconds", time.Since(s.idle))
+				s.idle = time.Time{}
+			}
+			s.requests++
+		}
+
+	case http.StateIdle:
+		if s := k.state(conn); s != nil {
+			s.idle = time.Now()
+		}
+
+	case http.StateHijacked, http.StateClosed:
+		v, ok := k.conns.LoadAndDelete(conn)
+		if !ok {
+			return
+		}
+		s := v.(*keepAliveState)
+		k.eng.Observe("http.server.conn.requests", s.requests)
+
+		if state == http.StateClosed {
+			closedBy := "unknown"
+			if c, ok := conn.(*keepAliveConn); ok {
+				closedBy = c.closedBy()
+			}
+			k.eng.Incr("http.server.conn.close.count", stats.T("http_conn_closed_by", closedBy))
+		}
+	}
+}
+
+// state returns the state of conn, the server calls ConnState sequentially for
+// a given connection so it can be modified without synchronization.
+func (k *KeepAlive) state(conn net.Conn) *keepAliveState {
+	if v, ok := k.conns.Load(conn); ok {
+		return v.(*keepAliveState)
+	}
+	return nil
+}
+
+// Listener wraps lstn so the connections it accepts record whether they were
+// closed by the client or the server.
+func (k *KeepAlive) Listener(lstn net.Listener) net.Listener {
+	return &keepAliveListener{Listener: lstn}
+}
+
+type keepAliveListener struct {
+	net.Listener
+}
+
+func (l *keepAliveListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if c != nil {
+		c = &keepAliveConn{Conn: c}
+	}
+	return c, err
+}
+
+// keepAliveConn records whether a read saw the client close the connection
+// before the server did. Timeouts are not considered as closed by the client
+// since the server uses them to expire idle connections.
+type keepAliveConn struct {
+	net.Conn
+	peerClosed atomic.Bool
+}
+
+func (c *keepAliveConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil && !isTimeout(err) && !errors.Is(err, net.ErrClosed) {
+		c.peerClosed.Store(true)
+	}
+	return n, err
+}
+
+func (c *keepAliveConn) closedBy() string {
+	if c.peerClosed.Load() {
+		return "client"
+	}
+	return "server"
+}
+
+func isTimeout(err error) bool {
+	var e net.Error
+	return errors.As(err, &e) && e.Timeout()
+}
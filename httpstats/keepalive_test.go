@@ -0,0 +1,94 @@
+package httpstats
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestKeepAlive(t *testing.T) {
+	tests := []struct {
+		scenario string
+		close    bool
+		closedBy string
+	}{
+		{scenario: "the client closes idle connections", close: false, closedBy: "client"},
+		{scenario: "the server responds with Connection: close", close: true, closedBy: "server"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := &statstest.Handler{}
+			e := stats.NewEngine("", h)
+			ka := NewKeepAliveWith(e)
+
+			requests := 0
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				if requests++; test.close && requests == 3 {
+					res.Header().Set("Connection", "close")
+				}
+			}))
+			server.Listener = ka.Listener(server.Listener)
+			server.Config.ConnState = ka.ConnState
+			server.Start()
+			defer server.Close()
+
+			transport := &http.Transport{}
+			client := &http.Client{Transport: transport}
+
+			for i := 0; i != 3; i++ {
+				res, err := client.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+			}
+			transport.CloseIdleConnections()
+
+			var closes []stats.Measure
+			for deadline := time.Now().Add(time.Second); len(closes) == 0; {
+				if time.Now().After(deadline) {
+					t.Fatal("timeout waiting for the connection to be closed")
+				}
+				time.Sleep(10 * time.Millisecond)
+				closes = filterMeasures(h.Measures(), "http.server.conn.close")
+			}
+
+			if tag := closes[0].Tags[0]; tag != stats.T("http_conn_closed_by", test.closedBy) {
+				t.Error("bad closed by tag:", tag)
+			}
+
+			measures := h.Measures()
+
+			if n := len(filterMeasures(measures, "http.server.conn.open")); n != 1 {
+				t.Error("expected one connection to be opened, got", n)
+			}
+
+			if r := filterMeasures(measures, "http.server.conn"); len(r) != 1 {
+				t.Error("expected one requests measure, got", len(r))
+			} else if v := r[0].Fields[0].Value.Int(); v != 3 {
+				t.Error("bad number of requests per connection:", v)
+			}
+
+			if n := len(filterMeasures(measures, "http.server.conn.idle")); n != 2 {
+				t.Error("expected 2 idle times to be observed, got", n)
+			}
+		})
+	}
+}
+
+func filterMeasures(measures []stats.Measure, name string) []stats.Measure {
+	var filtered []stats.Measure
+	for _, m := range measures {
+		if m.Name == name {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	stats "github.com/segmentio/stats/v5"
@@ -44,14 +45,47 @@ func init() {
 		math.Inf(+1),
 	)
 
-	stats.Buckets.Set("http:rtt.seconds",
-		1*time.Millisecond,
-		10*time.Millisecond,
-		100*time.Millisecond,
-		1*time.Second,
-		10*time.Second,
-		math.Inf(+1),
-	)
+	for _, key := range []string{"http:rtt.seconds", "http:ttfb.seconds", "http:handler.seconds", "http:client_io.seconds"} {
+		stats.Buckets.Set(key,
+			1*time.Millisecond,
+			10*time.Millisecond,
+			100*time.Millisecond,
+			1*time.Second,
+			10*time.Second,
+			math.Inf(+1),
+		)
+	}
+}
+
+// inFlightMetric is the name of the gauge of requests being served by handlers
+// or sent by transports, distinguished by the side tag.
+const inFlightMetric = "http.requests.in_flight"
+
+var (
+	serverSideTag = stats.T("side", "server")
+	clientSideTag = stats.T("side", "client")
+)
+
+// inFlightKey identifies a series of the in-flight gauge.
+type inFlightKey struct {
+	eng  *stats.Engine
+	side string
+}
+
+// inFlightCounts holds the number of requests in flight of each series of the
+// in-flight gauge, shared by all the handlers or transports reporting to the
+// same engine, otherwise they would overwrite each other's values.
+var inFlightCounts sync.Map // map[inFlightKey]*atomic.Int64
+
+// inFlightCount returns the number of requests in flight on the side tag of
+// eng.
+func inFlightCount(eng *stats.Engine, side stats.Tag) *atomic.Int64 {
+	key := inFlightKey{eng: eng, side: side.Value}
+	if count, ok := inFlightCounts.Load(key); ok {
+		return count.(*atomic.Int64)
+	}
+	count, _ := inFlightCounts.LoadOrStore(key, new(atomic.Int64))
+	return count.(*atomic.Int64)
 }
 
 type nullBody struct{}
@@ -68,6 +102,10 @@ type requestBody struct {
 	req     *http.Request
 	op      string
 	once    sync.Once
+
+	// When set, the time spent blocked reading the body is accumulated to
+	// the pointed duration.
+	io *time.Duration
 }
 
 func (r *requestBody) Close() (err error) {
@@ -77,6 +115,10 @@ func (r *requestBody) Close() (err error) {
 }
 
 func (r *requestBody) Read(b []byte) (n int, err error) {
+	if r.io != nil {
+		start := time.Now()
+		defer func() { *r.io += time.Since(start) }()
+	}
 	if n, err = r.body.Read(b); n > 0 {
 		r.bytes += n
 	}
@@ -121,7 +163,7 @@ func (r *responseBody) close() {
 
 func (r *responseBody) complete() {
 	r.metrics.observeResponse(r.res, r.op, r.bytes, time.Since(r.start))
-	r.eng.ReportAt(r.start, r.metrics)
+	r.eng.ReportAt(r.start, r.metrics, grpcStatusTags(r.res.Header, r.res.Trailer)...)
 }
 
 type metrics struct {
@@ -143,7 +185,8 @@ type metrics struct {
 		}
 
 		res struct {
-			rtt time.Duration `metric:"rtt.seconds" type:"histogram"`
+			rtt  time.Duration `metric:"rtt.seconds"  type:"histogram"`
+			ttfb time.Duration `metric:"ttfb.seconds" type:"histogram"`
 
 			msg struct {
 				count       int `metric:"count"        type:"counter"`
@@ -177,6 +220,20 @@ type metrics struct {
 	} `metric:"http"`
 }
 
+// handlerMetrics separates the time spent by server handlers producing the
+// response from the time they spent blocked reading the request body from the
+// client and writing the response to it, so slow clients do not inflate the
+// latency of handlers.
+type handlerMetrics struct {
+	http struct {
+		handler  time.Duration `metric:"handler.seconds"   type:"histogram"`
+		clientIO time.Duration `metric:"client_io.seconds" type:"histogram"`
+
+		method       string `tag:"http_req_method"`
+		statusBucket string `tag:"http_res_status_bucket"`
+	} `metric:"http"`
+}
+
 func (m *metrics) observeRequest(req *http.Request, op string, bodyLen int) {
 	contentType, charset := contentType(req.Header)
 	contentEncoding := contentEncoding(req.Header)
@@ -199,12 +256,7 @@ func (m *metrics) observeRequest(req *http.Request, op string, bodyLen int) {
 	m.http.protocol = req.Proto
 	m.http.transferEncoding = transferEncoding
 
-	path := req.URL.Path
-
-	if !strings.HasPrefix(path, "/") {
-		path = "/" + path
-	}
-	m.http.path = path
+	m.http.path = requestPath(req)
 }
 
 func (m *metrics) observeResponse(res *http.Response, op string, bodyLen int, rtt time.Duration) {
@@ -316,6 +368,16 @@ func intLength(n int64) int {
 	return int(math.Log10(float64(n))) + 1
 }
 
+func requestPath(req *http.Request) string {
+	path := req.URL.Path
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return path
+}
+
 func requestHost(req *http.Request) (host string) {
 	if host = req.Host; len(host) == 0 {
 		if host = headerValue(req.Header, "Host"); len(host) == 0 {
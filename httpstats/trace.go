@@ -0,0 +1,64 @@
+package httpstats
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TraceIDTag is the name of the tag carrying the trace ID of requests, set on
+// metrics when the TagTraceID option of handlers or transports is enabled.
+//
+// Each request has its own trace ID, so the tag is registered in
+// stats.ExemplarTags and only passed to handlers which turn it into
+// exemplars, for example the prometheus handler configured with:
+//
+//	prometheus.Handler{ExemplarTags: []string{httpstats.TraceIDTag}}
+const TraceIDTag = "trace_id"
+
+// traceID returns the trace ID carried by the W3C traceparent header or the B3
+// headers of h, or an empty string if none of them carries a valid trace ID.
+func traceID(h http.Header) string {
+	if v := headerValue(h, "Traceparent"); v != "" {
+		// version "-" trace-id "-" parent-id "-" trace-flags
+		if len(v) >= 55 && v[2] == '-' && v[35] == '-' && v[:2] != "ff" {
+			if id := v[3:35]; isTraceID(id) {
+				return id
+			}
+		}
+	}
+
+	if v := headerValue(h, "B3"); v != "" {
+		// trace-id "-" span-id ["-" sampled ["-" parent-span-id]], or only
+		// the sampling decision
+		if i := strings.IndexByte(v, '-'); i > 0 {
+			if id := v[:i]; isTraceID(id) {
+				return id
+			}
+		}
+	}
+
+	if id := headerValue(h, "X-B3-Traceid"); isTraceID(id) {
+		return id
+	}
+
+	return ""
+}
+
+// isTraceID reports whether s is a 64 or 128 bits trace ID, encoded as lower
+// case hexadecimal, and not all zeros.
+func isTraceID(s string) bool {
+	if len(s) != 16 && len(s) != 32 {
+		return false
+	}
+	zero := true
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '0':
+		case (c >= '1' && c <= '9') || (c >= 'a' && c <= 'f'):
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
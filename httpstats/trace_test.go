@@ -0,0 +1,121 @@
+package httpstats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		scenario string
+		header   http.Header
+		traceID  string
+	}{
+		{
+			scenario: "no trace headers",
+			header:   http.Header{},
+		},
+		{
+			scenario: "W3C traceparent header",
+			header:   http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+			traceID:  "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			scenario: "W3C traceparent header with an invalid trace ID",
+			header:   http.Header{"Traceparent": {"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+		},
+		{
+			scenario: "B3 single header",
+			header:   http.Header{"B3": {"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90"}},
+			traceID:  "80f198ee56343ba864fe8b2a57d3eff7",
+		},
+		{
+			scenario: "B3 single header with only the sampling decision",
+			header:   http.Header{"B3": {"0"}},
+		},
+		{
+			scenario: "B3 multiple headers with a 64 bits trace ID",
+			header:   http.Header{"X-B3-Traceid": {"a3ce929d0e0e4736"}},
+			traceID:  "a3ce929d0e0e4736",
+		},
+		{
+			scenario: "traceparent takes precedence over B3",
+			header: http.Header{
+				"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+				"X-B3-Traceid": {"a3ce929d0e0e4736"},
+			},
+			traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if id := traceID(test.header); id != test.traceID {
+				t.Errorf("bad trace ID: %q != %q", id, test.traceID)
+			}
+		})
+	}
+}
+
+// exemplarHandler is a test handler turning the trace ID tag into exemplars.
+type exemplarHandler struct {
+	statstest.Handler
+}
+
+func (h *exemplarHandler) ExemplarTag(name string) bool {
+	return name == TraceIDTag
+}
+
+func TestHandlerTagTraceID(t *testing.T) {
+	defer stats.ExemplarTags.Delete(TraceIDTag)
+
+	h := &exemplarHandler{}
+	plain := &statstest.Handler{}
+	e := stats.NewEngine("", stats.MultiHandler(h, plain))
+
+	handler := NewHandlerWithConfig(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("Hello World"))
+	}), HandlerConfig{Engine: e, TagTraceID: true})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	found := false
+	for _, m := range h.Measures() {
+		if m.Name != "http" {
+			continue
+		}
+		found = true
+		if !hasTag(m.Tags, stats.T(TraceIDTag, "4bf92f3577b34da6a3ce929d0e0e4736")) {
+			t.Errorf("missing trace ID tag: %v", m.Tags)
+		}
+	}
+	if !found {
+		t.Error("no measures reported by http handler")
+	}
+
+	for _, m := range plain.Measures() {
+		for _, tag := range m.Tags {
+			if tag.Name == TraceIDTag {
+				t.Errorf("trace ID passed to a handler which does not support exemplars: %v", m.Tags)
+			}
+		}
+	}
+	if len(plain.Measures()) == 0 {
+		t.Error("no measures reported to the handler without exemplars")
+	}
+}
+
+func hasTag(tags []stats.Tag, tag stats.Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package httpstats
 
 import (
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	stats "github.com/segmentio/stats/v5"
@@ -16,15 +17,57 @@ func NewTransport(t http.RoundTripper) http.RoundTripper {
 // NewTransportWith wraps t to produce metrics on eng for every request sent and
 // every response received.
 func NewTransportWith(eng *stats.Engine, t http.RoundTripper) http.RoundTripper {
+	return NewTransportWithConfig(t, TransportConfig{Engine: eng})
+}
+
+// TransportConfig carries the configuration of transports created by
+// NewTransportWithConfig.
+type TransportConfig struct {
+	// Engine that metrics are produced on, defaults to stats.DefaultEngine.
+	Engine *stats.Engine
+
+	// Route returns the route of requests, which is set as the http_route tag
+	// of the metrics, for example the name of the API operation. Requests
+	// are not tagged with a route by default.
+	Route func(*http.Request) string
+
+	// TagTraceID enables attaching the trace ID of requests carrying a W3C
+	// traceparent header or B3 headers to their metrics as exemplars, see
+	// HandlerConfig.TagTraceID.
+	TagTraceID bool
+}
+
+// NewTransportWithConfig wraps t to produce metrics for every request sent and
+// every response received, as configured by config.
+//
+// The http.ttfb.seconds metric is the time until the response header was
+// received. The number of requests awaiting a response is reported as the
+// http.requests.in_flight gauge, tagged with side=client, the count covers all
+// the transports reporting to the engine. Responses carrying a grpc-status
+// trailer are tagged with the status of the RPC, as described in
+// NewHandlerWithConfig.
+func NewTransportWithConfig(t http.RoundTripper, config TransportConfig) http.RoundTripper {
+	if config.Engine == nil {
+		config.Engine = stats.DefaultEngine
+	}
+	if config.TagTraceID {
+		stats.ExemplarTags.Add(TraceIDTag)
+	}
 	return &transport{
-		transport: t,
-		eng:       eng,
+		transport:  t,
+		eng:        config.Engine,
+		route:      config.Route,
+		tagTraceID: config.TagTraceID,
+		inFlight:   inFlightCount(config.Engine, clientSideTag),
 	}
 }
 
 type transport struct {
-	transport http.RoundTripper
-	eng       *stats.Engine
+	transport  http.RoundTripper
+	eng        *stats.Engine
+	route      func(*http.Request) string
+	tagTraceID bool
+	inFlight   *atomic.Int64
 }
 
 // RoundTrip implements http.RoundTripper.
@@ -37,7 +80,21 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 		rtrip = http.DefaultTransport
 	}
 
-	if tags := RequestTags(req); len(tags) > 0 {
+	tags := RequestTags(req)
+
+	if t.route != nil {
+		if route := t.route(req); route != "" {
+			tags = append(tags, stats.T("http_route", route))
+		}
+	}
+
+	if t.tagTraceID {
+		if id := traceID(req.Header); id != "" {
+			tags = append(tags, stats.T(TraceIDTag, id))
+		}
+	}
+
+	if len(tags) > 0 {
 		eng = eng.WithTags(tags...)
 	}
 
@@ -55,7 +112,9 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 		op:      "write",
 	}
 
+	t.eng.Set(inFlightMetric, t.inFlight.Add(1), clientSideTag)
 	res, err = rtrip.RoundTrip(req)
+	t.eng.Set(inFlightMetric, t.inFlight.Add(-1), clientSideTag)
 	// safe guard, the transport should have done it already
 	req.Body.Close() // nolint
 
@@ -65,6 +124,8 @@ func (t *transport) RoundTrip(req *http.Request) (res *http.Response, err error)
 		return
 	}
 
+	m.http.res.ttfb = time.Since(start)
+
 	res.Body = &responseBody{
 		eng:     eng,
 		res:     res,
@@ -102,3 +102,51 @@ func TestTransportError(t *testing.T) {
 		t.Log(m)
 	}
 }
+
+func TestTransportRoute(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		res.Write([]byte("Hello World!"))
+	}))
+	defer server.Close()
+
+	httpc := &http.Client{
+		Transport: NewTransportWithConfig(&http.Transport{}, TransportConfig{
+			Engine: e,
+			Route:  func(*http.Request) string { return "users.get" },
+		}),
+	}
+
+	res, err := httpc.Get(server.URL + "/users/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(res.Body)
+	res.Body.Close()
+
+	measures := h.Measures()
+	if len(measures) == 0 {
+		t.Fatal("no measures reported by http transport")
+	}
+
+	for _, m := range measures {
+		if m.Name == "http.requests" {
+			continue // the in-flight gauge is not tagged per request
+		}
+		found := false
+		for _, tag := range m.Tags {
+			if tag == stats.T("http_route", "users.get") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: missing http_route tag: %v", m.Name, m.Tags)
+		}
+	}
+}
@@ -42,6 +42,25 @@ type ClientConfig struct {
 	// Name of the InfluxDB database to send metrics to.
 	Database string
 
+	// Organization and Bucket that metrics are written to in InfluxDB 2.x.
+	// Setting Bucket makes the client use the /api/v2/write endpoint instead
+	// of the 1.x /write endpoint, Database is then ignored.
+	Organization string
+	Bucket       string
+
+	// Token used to authenticate writes, required by InfluxDB 2.x. It is sent
+	// in the Authorization header of requests, which InfluxDB 1.8 and above
+	// also accept.
+	Token string
+
+	// Precision of the timestamps written to InfluxDB, one of time.Nanosecond,
+	// time.Microsecond, time.Millisecond, or time.Second. Other values are
+	// rounded down to the closest of those. Defaults to time.Nanosecond.
+	//
+	// Writes sent to the Fallback are not annotated with the precision, the
+	// Telegraf listener must be configured to expect the same one.
+	Precision time.Duration
+
 	// Maximum size of batch of events sent to InfluxDB.
 	BufferSize int
 
@@ -51,6 +70,22 @@ type ClientConfig struct {
 	// Transport configures the HTTP transport used by the client to send
 	// requests to InfluxDB. By default http.DefaultTransport is used.
 	Transport http.RoundTripper
+
+	// Fallback is the address of a local Telegraf socket listener that
+	// metrics are written to when InfluxDB returns errors, for example
+	// "udp://localhost:8094" or "unix:///var/run/telegraf.sock". When set,
+	// failed writes are not retried against InfluxDB but sent to the
+	// fallback instead.
+	Fallback string
+
+	// FallbackRetryInterval is the amount of time the client keeps writing
+	// to the fallback before trying InfluxDB again. Defaults to
+	// DefaultFallbackRetryInterval.
+	FallbackRetryInterval time.Duration
+
+	// OnFailover is called when the client switches from InfluxDB to the
+	// fallback, or back.
+	OnFailover func(FailoverEvent)
 }
 
 // Client represents an InfluxDB client that implements the stats.Handler
@@ -87,10 +122,22 @@ func NewClientWith(config ClientConfig) *Client {
 		config.Timeout = DefaultTimeout
 	}
 
+	precision := makePrecision(config.Precision)
+
+	var u *url.URL
+	if len(config.Bucket) != 0 {
+		u = makeV2URL(config.Address, config.Organization, config.Bucket, precision)
+	} else {
+		u = makeURL(config.Address, config.Database)
+		setPrecision(u, precisionV1, precision)
+	}
+
 	c := &Client{
 		serializer: serializer{
-			url:  makeURL(config.Address, config.Database),
-			done: make(chan struct{}),
+			url:       u,
+			token:     config.Token,
+			precision: precision,
+			done:      make(chan struct{}),
 			http: http.Client{
 				Timeout:   config.Timeout,
 				Transport: config.Transport,
@@ -98,13 +145,18 @@ func NewClientWith(config ClientConfig) *Client {
 		},
 	}
 
+	if len(config.Fallback) != 0 {
+		c.fallback = newFallback(config.Fallback, config.FallbackRetryInterval, config.OnFailover)
+	}
+
 	c.buffer.BufferSize = config.BufferSize
 	c.buffer.Serializer = &c.serializer
 	return c
 }
 
 // CreateDB creates a database named db in the InfluxDB server that the client
-// was configured to send metrics to.
+// was configured to send metrics to. Databases do not exist in InfluxDB 2.x,
+// where buckets are created with the influx CLI or the /api/v2/buckets API.
 func (c *Client) CreateDB(db string) error {
 	u := *c.url
 	q := u.Query()
@@ -112,12 +164,19 @@ func (c *Client) CreateDB(db string) error {
 	u.Path = "/query"
 	u.RawQuery = q.Encode()
 
-	r, err := c.http.Post(u.String(), "application/x-www-form-urlencoded", strings.NewReader(
+	req, err := http.NewRequest("POST", u.String(), strings.NewReader(
 		fmt.Sprintf("q=CREATE DATABASE %q", db),
 	))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.authorize(req)
+
+	r, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
 	return readResponse(r)
 }
 
@@ -135,24 +194,48 @@ func (c *Client) Flush() {
 func (c *Client) Close() error {
 	c.once.Do(func() { close(c.done) })
 	c.Flush()
+
+	if c.fallback != nil {
+		return c.fallback.Close()
+	}
 	return nil
 }
 
 type serializer struct {
-	url  *url.URL
-	http http.Client
-	once sync.Once
-	done chan struct{}
+	url       *url.URL
+	token     string
+	precision time.Duration
+	http      http.Client
+	once      sync.Once
+	done      chan struct{}
+	fallback  *fallback
 }
 
-func (*serializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
+func (s *serializer) AppendMeasures(b []byte, time time.Time, measures ...stats.Measure) []byte {
 	for _, m := range measures {
-		b = AppendMeasure(b, time, m)
+		b = AppendMeasurePrecision(b, time, m, s.precision)
 	}
 	return b
 }
 
+func (s *serializer) newRequest(b []byte) *http.Request {
+	req, _ := http.NewRequest("POST", s.url.String(), bytes.NewReader(b))
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	s.authorize(req)
+	return req
+}
+
+func (s *serializer) authorize(req *http.Request) {
+	if len(s.token) != 0 {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+}
+
 func (s *serializer) Write(b []byte) (n int, err error) {
+	if s.fallback != nil {
+		return s.writeWithFallback(b)
+	}
+
 	for attempt := 0; attempt != 10; attempt++ {
 		var res *http.Response
 
@@ -165,8 +248,7 @@ func (s *serializer) Write(b []byte) (n int, err error) {
 			}
 		}
 
-		req, _ := http.NewRequest("POST", s.url.String(), bytes.NewReader(b))
-		res, err = s.http.Do(req)
+		res, err = s.http.Do(s.newRequest(b))
 		if err != nil {
 			log.Print("stats/influxdb:", err)
 			continue
@@ -184,20 +266,96 @@ func (s *serializer) Write(b []byte) (n int, err error) {
 	return
 }
 
-func makeURL(address, database string) *url.URL {
-	if !strings.Contains(address, "://") {
-		address = "http://" + address
+func (s *serializer) writeWithFallback(b []byte) (n int, err error) {
+	if now := time.Now(); s.fallback.useRemote(now) {
+		if err = s.post(b); err == nil {
+			s.fallback.recover(now)
+			return len(b), nil
+		}
+		s.fallback.fail(now, err)
 	}
 
-	u, err := url.Parse(address)
+	if _, err = s.fallback.Write(b); err != nil {
+		log.Print("stats/influxdb: fallback:", err)
+	}
+
+	return len(b), nil
+}
+
+func (s *serializer) post(b []byte) error {
+	res, err := s.http.Do(s.newRequest(b))
 	if err != nil {
-		panic(err)
+		return err
 	}
+	return readResponse(res)
+}
 
-	if len(u.Scheme) == 0 {
-		u.Scheme = "http"
+// The names of precisions in the query string of the 1.x and 2.x APIs.
+var (
+	precisionV1 = map[time.Duration]string{
+		time.Nanosecond:  "n",
+		time.Microsecond: "u",
+		time.Millisecond: "ms",
+		time.Second:      "s",
+	}
+
+	precisionV2 = map[time.Duration]string{
+		time.Nanosecond:  "ns",
+		time.Microsecond: "us",
+		time.Millisecond: "ms",
+		time.Second:      "s",
+	}
+)
+
+func makePrecision(precision time.Duration) time.Duration {
+	switch {
+	case precision >= time.Second:
+		return time.Second
+	case precision >= time.Millisecond:
+		return time.Millisecond
+	case precision >= time.Microsecond:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// setPrecision sets the precision parameter of u, unless it is the default
+// nanosecond precision or was already part of the address.
+func setPrecision(u *url.URL, names map[time.Duration]string, precision time.Duration) {
+	q := u.Query()
+
+	if _, ok := q["precision"]; !ok && precision != time.Nanosecond {
+		q.Set("precision", names[precision])
+		u.RawQuery = q.Encode()
+	}
+}
+
+func makeV2URL(address, org, bucket string, precision time.Duration) *url.URL {
+	u := parseAddress(address)
+
+	if len(u.Path) == 0 {
+		u.Path = "/api/v2/write"
 	}
 
+	q := u.Query()
+
+	if _, ok := q["org"]; !ok && len(org) != 0 {
+		q.Set("org", org)
+	}
+
+	if _, ok := q["bucket"]; !ok {
+		q.Set("bucket", bucket)
+	}
+
+	u.RawQuery = q.Encode()
+	setPrecision(u, precisionV2, precision)
+	return u
+}
+
+func makeURL(address, database string) *url.URL {
+	u := parseAddress(address)
+
 	if len(u.Path) == 0 {
 		u.Path = "/write"
 	}
@@ -212,6 +370,23 @@ func makeURL(address, database string) *url.URL {
 	return u
 }
 
+func parseAddress(address string) *url.URL {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(u.Scheme) == 0 {
+		u.Scheme = "http"
+	}
+
+	return u
+}
+
 func readResponse(r *http.Response) error {
 	if r.StatusCode < 300 {
 		_, _ = io.Copy(io.Discard, r.Body)
@@ -219,7 +394,11 @@ func readResponse(r *http.Response) error {
 		return nil
 	}
 
-	info := &influxError{}
+	// InfluxDB 1.x reports errors in the "error" field, 2.x in "message".
+	info := &struct {
+		Err     string `json:"error"`
+		Message string `json:"message"`
+	}{}
 	err := json.NewDecoder(r.Body).Decode(info)
 	r.Body.Close()
 
@@ -227,7 +406,11 @@ func readResponse(r *http.Response) error {
 		return err
 	}
 
-	return info
+	if len(info.Err) == 0 {
+		info.Err = info.Message
+	}
+
+	return &influxError{Err: info.Err}
 }
 
 type influxError struct {
@@ -1,10 +1,14 @@
 package influxdb
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -45,6 +49,121 @@ func DisabledTestClient(t *testing.T) {
 	if transport.err != nil {
 		t.Error(transport.err)
 	}
+
+	query := NewQueryClientWith(QueryConfig{
+		Address:  DefaultAddress,
+		Database: "test-db",
+	})
+
+	series, err := query.Query(context.Background(), `SELECT count("count") FROM "request" WHERE "hello" = 'world'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(series) != 1 || len(series[0].Values) != 1 {
+		t.Fatalf("unexpected query result: %+v", series)
+	}
+}
+
+func TestClientWriteV2(t *testing.T) {
+	type request struct {
+		path  string
+		query url.Values
+		auth  string
+		body  string
+	}
+	var mutex sync.Mutex
+	var requests []request
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if len(body) != 0 {
+			mutex.Lock()
+			requests = append(requests, request{
+				path:  req.URL.Path,
+				query: req.URL.Query(),
+				auth:  req.Header.Get("Authorization"),
+				body:  string(body),
+			})
+			mutex.Unlock()
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClientWith(ClientConfig{
+		Address:      server.URL,
+		Organization: "test-org",
+		Bucket:       "test-bucket",
+		Token:        "secret",
+		Precision:    time.Millisecond,
+	})
+
+	client.HandleMeasures(timestamp, stats.Measure{
+		Name:   "request",
+		Fields: []stats.Field{{Name: "count", Value: stats.ValueOf(5)}},
+	})
+	client.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(requests) != 1 {
+		t.Fatal("expected 1 write request, got", len(requests))
+	}
+	req := requests[0]
+
+	if req.path != "/api/v2/write" {
+		t.Error("bad path:", req.path)
+	}
+	if org, bucket := req.query.Get("org"), req.query.Get("bucket"); org != "test-org" || bucket != "test-bucket" {
+		t.Errorf("bad organization or bucket: %q %q", org, bucket)
+	}
+	if precision := req.query.Get("precision"); precision != "ms" {
+		t.Error("bad precision:", precision)
+	}
+	if req.auth != "Token secret" {
+		t.Error("bad authorization:", req.auth)
+	}
+	if req.body != "request count=5 1500780960123\n" {
+		t.Errorf("bad body: %q", req.body)
+	}
+}
+
+func TestMakeURLPrecision(t *testing.T) {
+	tests := []struct {
+		config ClientConfig
+		url    string
+	}{
+		{
+			config: ClientConfig{Address: "localhost:8086", Database: "stats"},
+			url:    "http://localhost:8086/write?db=stats",
+		},
+		{
+			config: ClientConfig{Address: "localhost:8086", Database: "stats", Precision: time.Second},
+			url:    "http://localhost:8086/write?db=stats&precision=s",
+		},
+		{
+			config: ClientConfig{Address: "localhost:8086", Database: "stats", Precision: 10 * time.Microsecond},
+			url:    "http://localhost:8086/write?db=stats&precision=u",
+		},
+		{
+			config: ClientConfig{Address: "localhost:8086", Bucket: "stats", Precision: time.Microsecond},
+			url:    "http://localhost:8086/api/v2/write?bucket=stats&precision=us",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			test.config.Transport = &discardTransport{}
+			client := NewClientWith(test.config)
+			defer client.Close()
+
+			if u := client.url.String(); u != test.url {
+				t.Error("bad url:", u)
+			}
+		})
+	}
 }
 
 func BenchmarkClient(b *testing.B) {
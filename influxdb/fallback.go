@@ -0,0 +1,197 @@
+package influxdb
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFallbackRetryInterval is the default amount of time the client
+	// waits before trying the remote InfluxDB endpoint again after it failed
+	// over to the fallback.
+	DefaultFallbackRetryInterval = 30 * time.Second
+
+	// maxDatagramSize is the maximum size of payloads written to datagram
+	// fallback sockets, larger batches are split on line boundaries.
+	maxDatagramSize = 65000
+)
+
+// FailoverEvent values are passed to the ClientConfig.OnFailover callback when
+// the client changes the destination it writes metrics to.
+type FailoverEvent struct {
+	// Fallback is true when the client switched to the fallback, and false
+	// when it recovered and went back to the remote endpoint.
+	Fallback bool
+
+	// Err is the error returned by the remote endpoint which triggered the
+	// switch to the fallback, it is nil when recovering.
+	Err error
+
+	// Time is when the state change occurred.
+	Time time.Time
+}
+
+// fallback implements writing batches of metrics to a local Telegraf
+// socket_listener, in the InfluxDB line protocol.
+//
+// The address has the form "network://address", where network is one of
+// "tcp", "udp", "unix" or "unixgram", for example "udp://localhost:8094" or
+// "unix:///var/run/telegraf.sock". Addresses without a network are dialed
+// over UDP.
+type fallback struct {
+	network string
+	address string
+
+	retryInterval time.Duration
+	onFailover    func(FailoverEvent)
+
+	mutex    sync.Mutex
+	conn     net.Conn
+	active   bool
+	failedAt time.Time
+}
+
+func newFallback(addr string, retryInterval time.Duration, onFailover func(FailoverEvent)) *fallback {
+	network, address := "udp", addr
+
+	if i := strings.Index(addr, "://"); i >= 0 {
+		network, address = addr[:i], addr[i+3:]
+	}
+
+	if retryInterval == 0 {
+		retryInterval = DefaultFallbackRetryInterval
+	}
+
+	return &fallback{
+		network:       network,
+		address:       address,
+		retryInterval: retryInterval,
+		onFailover:    onFailover,
+	}
+}
+
+// useRemote returns true if the client should attempt to write to the remote
+// endpoint, which is always the case unless it failed over to the fallback
+// less than retryInterval ago.
+func (f *fallback) useRemote(now time.Time) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return !f.active || now.Sub(f.failedAt) >= f.retryInterval
+}
+
+// fail records that the remote endpoint returned err, switching to the
+// fallback if the client was not already using it.
+func (f *fallback) fail(now time.Time, err error) {
+	f.mutex.Lock()
+	changed := !f.active
+	f.active, f.failedAt = true, now
+	f.mutex.Unlock()
+
+	if changed {
+		f.notify(FailoverEvent{Fallback: true, Err: err, Time: now})
+	}
+}
+
+// recover records that the remote endpoint accepted a write, switching back
+// from the fallback if the client was using it.
+func (f *fallback) recover(now time.Time) {
+	f.mutex.Lock()
+	changed := f.active
+	f.active = false
+	f.mutex.Unlock()
+
+	if changed {
+		f.notify(FailoverEvent{Fallback: false, Time: now})
+	}
+}
+
+func (f *fallback) notify(e FailoverEvent) {
+	if e.Fallback {
+		log.Printf("stats/influxdb: failing over to %s://%s: %s", f.network, f.address, e.Err)
+	} else {
+		log.Print("stats/influxdb: recovered, writing to the remote endpoint again")
+	}
+
+	if f.onFailover != nil {
+		f.onFailover(e)
+	}
+}
+
+// Write writes the batch of metrics in b to the fallback socket, the
+// connection is established on first use and re-established once if the
+// write fails.
+func (f *fallback) Write(b []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var err error
+
+	for attempt := 0; attempt != 2; attempt++ {
+		if f.conn == nil {
+			if f.conn, err = net.Dial(f.network, f.address); err != nil {
+				return 0, err
+			}
+		}
+
+		if err = f.write(b); err == nil {
+			return len(b), nil
+		}
+
+		f.conn.Close()
+		f.conn = nil
+	}
+
+	return 0, err
+}
+
+func (f *fallback) write(b []byte) error {
+	switch f.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		for len(b) != 0 {
+			chunk := datagramChunk(b)
+			if _, err := f.conn.Write(chunk); err != nil {
+				return err
+			}
+			b = b[len(chunk):]
+		}
+		return nil
+	default:
+		_, err := f.conn.Write(b)
+		return err
+	}
+}
+
+func (f *fallback) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.conn == nil {
+		return nil
+	}
+
+	err := f.conn.Close()
+	f.conn = nil
+	return err
+}
+
+// datagramChunk returns the longest prefix of b made of complete lines which
+// fits in a datagram. Lines longer than a datagram are returned alone.
+func datagramChunk(b []byte) []byte {
+	if len(b) <= maxDatagramSize {
+		return b
+	}
+
+	if i := bytes.LastIndexByte(b[:maxDatagramSize], '\n'); i >= 0 {
+		return b[:i+1]
+	}
+
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i+1]
+	}
+
+	return b
+}
@@ -0,0 +1,110 @@
+package influxdb
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientFallback(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if failing.Load() {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			res.Write([]byte(`{"error":"unavailable"}`))
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	socket := filepath.Join(t.TempDir(), "telegraf.sock")
+	lstn, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lstn.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := lstn.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewScanner(conn)
+		for r.Scan() {
+			lines <- r.Text()
+		}
+	}()
+
+	var events []FailoverEvent
+	client := NewClientWith(ClientConfig{
+		Address:               server.URL,
+		Fallback:              "unix://" + socket,
+		FallbackRetryInterval: time.Millisecond,
+		OnFailover:            func(e FailoverEvent) { events = append(events, e) },
+	})
+	defer client.Close()
+
+	if _, err := client.serializer.Write([]byte("test value=1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case line := <-lines:
+		if line != "test value=1" {
+			t.Errorf("bad line received by the fallback: %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no metrics received by the fallback")
+	}
+
+	if len(events) != 1 || !events[0].Fallback || events[0].Err == nil {
+		t.Fatalf("bad failover events: %+v", events)
+	}
+
+	failing.Store(false)
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := client.serializer.Write([]byte("test value=2\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 || events[1].Fallback || events[1].Err != nil {
+		t.Fatalf("bad recovery events: %+v", events)
+	}
+
+	select {
+	case line := <-lines:
+		t.Errorf("unexpected line received by the fallback after recovery: %q", line)
+	default:
+	}
+}
+
+func TestDatagramChunk(t *testing.T) {
+	line := strings.Repeat("x", 999) + "\n"
+	b := []byte(strings.Repeat(line, 100))
+
+	n := 0
+	for len(b) != 0 {
+		chunk := datagramChunk(b)
+		if len(chunk) > maxDatagramSize || chunk[len(chunk)-1] != '\n' {
+			t.Fatalf("bad chunk of %d bytes", len(chunk))
+		}
+		b = b[len(chunk):]
+		n++
+	}
+
+	if n != 2 {
+		t.Errorf("expected 2 chunks, got %d", n)
+	}
+}
@@ -10,6 +10,14 @@ import (
 // AppendMeasure is a formatting routine to append the InflxDB line protocol
 // representation of a measure to a memory buffer.
 func AppendMeasure(b []byte, t time.Time, m stats.Measure) []byte {
+	return AppendMeasurePrecision(b, t, m, time.Nanosecond)
+}
+
+// AppendMeasurePrecision is like AppendMeasure but writes the timestamp of the
+// measure in units of precision, which must be one of the precisions
+// supported by InfluxDB (time.Nanosecond, time.Microsecond, time.Millisecond,
+// or time.Second).
+func AppendMeasurePrecision(b []byte, t time.Time, m stats.Measure, precision time.Duration) []byte {
 	b = append(b, m.Name...)
 
 	for _, tag := range m.Tags {
@@ -53,7 +61,7 @@ func AppendMeasure(b []byte, t time.Time, m stats.Measure) []byte {
 	}
 
 	b = append(b, ' ')
-	b = strconv.AppendInt(b, t.UnixNano(), 10)
+	b = strconv.AppendInt(b, t.UnixNano()/int64(precision), 10)
 
 	return append(b, '\n')
 }
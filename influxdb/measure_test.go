@@ -51,3 +51,18 @@ func TestAppendMetric(t *testing.T) {
 		})
 	}
 }
+
+func TestAppendMetricPrecision(t *testing.T) {
+	m := testMetrics[0].m
+
+	for precision, s := range map[time.Duration]string{
+		time.Nanosecond:  `request count=5 1500780960123456789`,
+		time.Microsecond: `request count=5 1500780960123456`,
+		time.Millisecond: `request count=5 1500780960123`,
+		time.Second:      `request count=5 1500780960`,
+	} {
+		if found := string(AppendMeasurePrecision(nil, timestamp, m, precision)); found != s+"\n" {
+			t.Errorf("bad metric representation with precision %s:\n- expected: %s\n- found:    %s", precision, s, found)
+		}
+	}
+}
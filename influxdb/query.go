@@ -0,0 +1,241 @@
+package influxdb
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/segmentio/objconv/json"
+)
+
+// The QueryConfig type is used to configure InfluxDB query clients.
+type QueryConfig struct {
+	// Address of the InfluxDB server to query.
+	Address string
+
+	// Name of the InfluxDB database that InfluxQL queries are run against.
+	Database string
+
+	// Organization that Flux queries are run in, required by InfluxDB 2.x.
+	Organization string
+
+	// Token used to authenticate Flux queries against InfluxDB 2.x.
+	Token string
+
+	// Maximum amount of time that queries to InfluxDB may take.
+	Timeout time.Duration
+
+	// Transport configures the HTTP transport used by the client to send
+	// requests to InfluxDB. By default http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// QueryClient is a small InfluxDB client which runs queries, it is intended
+// to be used in end-to-end tests verifying that the metrics written by a
+// Client were received by InfluxDB.
+type QueryClient struct {
+	url   *url.URL
+	db    string
+	org   string
+	token string
+	http  http.Client
+}
+
+// NewQueryClient creates and returns a new client querying the InfluxDB server
+// running at addr.
+func NewQueryClient(addr string) *QueryClient {
+	return NewQueryClientWith(QueryConfig{
+		Address: addr,
+	})
+}
+
+// NewQueryClientWith creates and returns a new InfluxDB query client
+// configured with the given config.
+func NewQueryClientWith(config QueryConfig) *QueryClient {
+	if len(config.Address) == 0 {
+		config.Address = DefaultAddress
+	}
+
+	if len(config.Database) == 0 {
+		config.Database = DefaultDatabase
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	u := makeURL(config.Address, config.Database)
+	u.Path, u.RawQuery = "", ""
+
+	return &QueryClient{
+		url:   u,
+		db:    config.Database,
+		org:   config.Organization,
+		token: config.Token,
+		http: http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+	}
+}
+
+// Series is a series of points returned by an InfluxQL query.
+//
+// Each row of Values has one value per column, times are formatted as RFC3339
+// strings and numbers are decoded as int64 or float64.
+type Series struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+// Query runs the InfluxQL query q against the /query endpoint, in the
+// database that the client was configured with, and returns the series of its
+// first statement.
+func (c *QueryClient) Query(ctx context.Context, q string) ([]Series, error) {
+	u := *c.url
+	u.Path = "/query"
+	u.RawQuery = url.Values{"db": {c.db}, "q": {q}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return nil, readResponse(res)
+	}
+
+	var result struct {
+		Results []struct {
+			Series []Series `json:"series"`
+			Err    string   `json:"error"`
+		} `json:"results"`
+		Err string `json:"error"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Err) != 0 {
+		return nil, &influxError{Err: result.Err}
+	}
+
+	if len(result.Results) == 0 {
+		return nil, nil
+	}
+
+	if err := result.Results[0].Err; len(err) != 0 {
+		return nil, &influxError{Err: err}
+	}
+
+	return result.Results[0].Series, nil
+}
+
+// QueryFlux runs the Flux query q against the /api/v2/query endpoint of
+// InfluxDB 2.x, and returns the records of all tables in the result. Records
+// map column names to their values, as formatted by InfluxDB in its CSV
+// responses.
+func (c *QueryClient) QueryFlux(ctx context.Context, q string) ([]map[string]string, error) {
+	u := *c.url
+	u.Path = "/api/v2/query"
+	u.RawQuery = url.Values{"org": {c.org}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(q))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.flux")
+	req.Header.Set("Accept", "application/csv")
+	c.authorize(req)
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return nil, readFluxError(res)
+	}
+
+	return readFluxRecords(res.Body)
+}
+
+func (c *QueryClient) authorize(req *http.Request) {
+	if len(c.token) != 0 {
+		req.Header.Set("Authorization", "Token "+c.token)
+	}
+}
+
+// readFluxRecords parses a CSV response to a Flux query, where each table
+// starts with a header row, optionally preceded by annotation rows starting
+// with '#'. Tables are separated by empty lines, which the CSV reader skips,
+// so headers are also recognized by their "result" and "table" columns.
+func readFluxRecords(r io.Reader) ([]map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	var header []string
+	var records []map[string]string
+	annotated := false
+
+	for {
+		row, err := cr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return records, err
+		}
+
+		if strings.HasPrefix(row[0], "#") {
+			annotated = true
+			continue
+		}
+
+		if header == nil || annotated || isFluxHeader(row) {
+			header, annotated = row, false
+			continue
+		}
+
+		record := make(map[string]string, len(row))
+		for i, value := range row {
+			if i < len(header) && len(header[i]) != 0 {
+				record[header[i]] = value
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+func isFluxHeader(row []string) bool {
+	return len(row) > 2 && row[1] == "result" && row[2] == "table"
+}
+
+func readFluxError(r *http.Response) error {
+	info := &struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{}
+
+	if err := json.NewDecoder(r.Body).Decode(info); err != nil {
+		return err
+	}
+
+	return &influxError{Err: info.Message}
+}
@@ -0,0 +1,111 @@
+package influxdb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestQueryClientQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/query" {
+			t.Error("bad path:", req.URL.Path)
+		}
+		if db := req.URL.Query().Get("db"); db != "test-db" {
+			t.Error("bad database:", db)
+		}
+		if q := req.URL.Query().Get("q"); q != `SELECT "count" FROM "request"` {
+			t.Error("bad query:", q)
+		}
+		_, _ = io.WriteString(res, `{"results":[{"statement_id":0,"series":[{"name":"request","tags":{"hello":"world"},"columns":["time","count"],"values":[["2017-06-04T22:12:00Z",5],["2017-06-04T22:12:01Z",1.5]]}]}]}`)
+	}))
+	defer server.Close()
+
+	client := NewQueryClientWith(QueryConfig{
+		Address:  server.URL,
+		Database: "test-db",
+	})
+
+	series, err := client.Query(context.Background(), `SELECT "count" FROM "request"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Series{{
+		Name:    "request",
+		Tags:    map[string]string{"hello": "world"},
+		Columns: []string{"time", "count"},
+		Values: [][]interface{}{
+			{"2017-06-04T22:12:00Z", int64(5)},
+			{"2017-06-04T22:12:01Z", 1.5},
+		},
+	}}
+
+	if !reflect.DeepEqual(series, expect) {
+		t.Errorf("bad series:\n- expected: %#v\n- found:    %#v", expect, series)
+	}
+}
+
+func TestQueryClientQueryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(res, `{"results":[{"statement_id":0,"error":"database not found: test-db"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewQueryClientWith(QueryConfig{
+		Address:  server.URL,
+		Database: "test-db",
+	})
+
+	if _, err := client.Query(context.Background(), `SELECT * FROM "request"`); err == nil || err.Error() != "database not found: test-db" {
+		t.Error("bad error:", err)
+	}
+}
+
+func TestQueryClientQueryFlux(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v2/query" {
+			t.Error("bad path:", req.URL.Path)
+		}
+		if org := req.URL.Query().Get("org"); org != "test-org" {
+			t.Error("bad organization:", org)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Token secret" {
+			t.Error("bad authorization:", auth)
+		}
+		res.Header().Set("Content-Type", "text/csv")
+		_, _ = io.WriteString(res, ""+
+			"#datatype,string,long,string,double\r\n"+
+			",result,table,_measurement,_value\r\n"+
+			",_result,0,request,5\r\n"+
+			",_result,0,request,1.5\r\n"+
+			"\r\n"+
+			",result,table,_measurement,_value\r\n"+
+			",_result,1,response,42\r\n")
+	}))
+	defer server.Close()
+
+	client := NewQueryClientWith(QueryConfig{
+		Address:      server.URL,
+		Organization: "test-org",
+		Token:        "secret",
+	})
+
+	records, err := client.QueryFlux(context.Background(), `from(bucket: "stats") |> range(start: -1m)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []map[string]string{
+		{"result": "_result", "table": "0", "_measurement": "request", "_value": "5"},
+		{"result": "_result", "table": "0", "_measurement": "request", "_value": "1.5"},
+		{"result": "_result", "table": "1", "_measurement": "response", "_value": "42"},
+	}
+
+	if !reflect.DeepEqual(records, expect) {
+		t.Errorf("bad records:\n- expected: %v\n- found:    %v", expect, records)
+	}
+}
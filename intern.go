@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"hash/maphash"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxInternedStrings is the default capacity of the table of interned
+// strings, see SetMaxInternedStrings.
+const DefaultMaxInternedStrings = 65536
+
+// Intern returns a string equal to s which shares its backing array with the
+// other interned copies of s.
+//
+// Metric names and scopes are interned by the engine and by the handlers of
+// this module that retain them, so programs producing tens of thousands of
+// series keep a single copy of each name. The table of interned strings is
+// bounded, once full Intern returns s unchanged.
+func Intern(s string) string {
+	return interned.intern(s)
+}
+
+// SetMaxInternedStrings sets the maximum number of strings held by the table
+// used by Intern, the default is DefaultMaxInternedStrings. Setting it to zero
+// or less disables interning; strings already in the table remain there.
+func SetMaxInternedStrings(n int) {
+	interned.max.Store(int64(n))
+}
+
+// internBytes is like Intern but takes a byte slice, it does not allocate
+// when the string is already in the table.
+func internBytes(b []byte) string {
+	return interned.internBytes(b)
+}
+
+var interned = newInternTable(DefaultMaxInternedStrings)
+
+// internShards is the number of shards of intern tables. Engines intern the
+// names of all the measures they produce, the shards spread the lookups of
+// concurrent goroutines over independent locks.
+const internShards = 64
+
+type internTable struct {
+	max    atomic.Int64
+	count  atomic.Int64
+	seed   maphash.Seed
+	shards [internShards]internShard
+}
+
+type internShard struct {
+	mutex   sync.RWMutex
+	strings map[string]string
+	_       [32]byte // keeps the locks of shards on separate cache lines
+}
+
+func newInternTable(max int) *internTable {
+	t := &internTable{seed: maphash.MakeSeed()}
+	t.max.Store(int64(max))
+	for i := range t.shards {
+		t.shards[i].strings = make(map[string]string)
+	}
+	return t
+}
+
+func (t *internTable) intern(s string) string {
+	shard := &t.shards[maphash.String(t.seed, s)%internShards]
+
+	shard.mutex.RLock()
+	v, ok := shard.strings[s]
+	shard.mutex.RUnlock()
+
+	if ok {
+		return v
+	}
+
+	return t.store(shard, s)
+}
+
+func (t *internTable) internBytes(b []byte) string {
+	shard := &t.shards[maphash.Bytes(t.seed, b)%internShards]
+
+	shard.mutex.RLock()
+	v, ok := shard.strings[string(b)]
+	shard.mutex.RUnlock()
+
+	if ok {
+		return v
+	}
+
+	return t.store(shard, string(b))
+}
+
+func (t *internTable) store(shard *internShard, s string) string {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if v, ok := shard.strings[s]; ok {
+		return v
+	}
+
+	// The capacity is shared by all the shards.
+	if t.count.Add(1) > t.max.Load() {
+		t.count.Add(-1)
+		return s
+	}
+
+	// The string is copied so the table does not retain larger buffers that
+	// s may be a substring of.
+	s = strings.Clone(s)
+	shard.strings[s] = s
+	return s
+}
+
+func (t *internTable) len() int {
+	return int(t.count.Load())
+}
@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestIntern(t *testing.T) {
+	a := Intern(string([]byte("intern.test.name")))
+	b := Intern(string([]byte("intern.test.name")))
+
+	if a != b {
+		t.Fatalf("interned strings differ: %q != %q", a, b)
+	}
+	if unsafe.StringData(a) != unsafe.StringData(b) {
+		t.Error("interned strings do not share their backing array")
+	}
+	if c := internBytes([]byte("intern.test.name")); unsafe.StringData(c) != unsafe.StringData(a) {
+		t.Error("strings interned from byte slices do not share their backing array")
+	}
+}
+
+func TestInternTableLimit(t *testing.T) {
+	table := newInternTable(2)
+	table.intern("a")
+	table.intern("b")
+
+	c := string([]byte("c"))
+	if s := table.intern(c); unsafe.StringData(s) != unsafe.StringData(c) {
+		t.Error("string was interned beyond the table capacity")
+	}
+	if n := table.len(); n != 2 {
+		t.Error("bad number of interned strings:", n)
+	}
+
+	table.max.Store(3)
+	table.intern(c)
+	if n := table.len(); n != 3 {
+		t.Error("bad number of interned strings after raising the limit:", n)
+	}
+}
+
+func TestEngineMakeNameAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not accurate under the race detector")
+	}
+
+	e := NewEngine("prefix", Discard)
+	first := e.makeName("measure")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if name := e.makeName("measure"); name != first {
+			t.Fatal("bad name:", name)
+		}
+	})
+
+	if allocs != 0 {
+		t.Error("unexpected allocations making interned names:", allocs)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build stats_noop
+
+// Package nooptest checks the stats_noop build tag. It is separate from the
+// tests of the stats package, which expect measures to be produced, so the tag
+// can be tested on its own with:
+//
+//	go test -tags stats_noop ./internal/nooptest
+package nooptest_test
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestNoop(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+
+	e.Incr("count")
+	e.Add("count", 2)
+	e.Set("gauge", 3)
+	e.Observe("histogram", 4)
+	e.Clock("clock").Stop()
+	e.Report(&struct {
+		count int `metric:"count" type:"counter"`
+	}{count: 1})
+	e.ReportAt(time.Now(), &struct {
+		count int `metric:"count" type:"counter"`
+	}{count: 1})
+
+	if measures := h.Measures(); len(measures) != 0 {
+		t.Error("measures were produced with the stats_noop build tag:", measures)
+	}
+}
+
+func BenchmarkNoop(b *testing.B) {
+	e := stats.NewEngine("test", stats.Discard)
+
+	for i := 0; i != b.N; i++ {
+		e.Incr("count", stats.T("a", "b"))
+	}
+}
@@ -0,0 +1,446 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// This file defines the serialization of measures, which is intended to let
+// programs exchange measures (ingestion servers, message queues, recorders)
+// without having to agree on a private format.
+//
+// In JSON, measures are represented as:
+//
+//	{
+//	  "name": "http",
+//	  "fields": [{"name": "requests", "type": "counter", "value": 1}],
+//	  "tags": [{"name": "method", "value": "GET"}]
+//	}
+//
+// Values are written as JSON null, booleans, or numbers, except for durations
+// which are written as strings in the format of time.Duration.String, and for
+// the non-finite floats which are written as "NaN", "+Inf", and "-Inf". Floats
+// always have a decimal point or an exponent so they can be told apart from
+// integers when decoded. Integers are decoded as Int values, unless they do
+// not fit in an int64.
+//
+// In protobuf, measures are encoded as messages with the following schema:
+//
+//	message Measure {
+//	  string name = 1;
+//	  repeated Field fields = 2;
+//	  repeated Tag tags = 3;
+//	  double sample_rate = 4;
+//	}
+//
+//	message Field {
+//	  string name = 1;
+//	  FieldType type = 2;
+//	  oneof value {
+//	    bool bool_value = 3;
+//	    sint64 int_value = 4;
+//	    uint64 uint_value = 5;
+//	    double float_value = 6;
+//	    sint64 duration_value = 7; // nanoseconds
+//	  }
+//	}
+//
+//	message Tag {
+//	  string name = 1;
+//	  string value = 2;
+//	}
+//
+//	enum FieldType {
+//	  COUNTER = 0;
+//	  GAUGE = 1;
+//	  HISTOGRAM = 2;
+//	  DISTRIBUTION = 3;
+//	}
+//
+// Fields with no value have a Null value.
+
+// MarshalText satisfies the encoding.TextMarshaler interface.
+func (t FieldType) MarshalText() ([]byte, error) {
+	s := t.String()
+	if len(s) == 0 {
+		return nil, fmt.Errorf("stats: invalid field type %d", int(t))
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface.
+func (t *FieldType) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "counter":
+		*t = Counter
+	case "gauge":
+		*t = Gauge
+	case "histogram":
+		*t = Histogram
+	case "distribution":
+		*t = Distribution
+	default:
+		return fmt.Errorf("stats: invalid field type %q", b)
+	}
+	return nil
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch v.Type() {
+	case Null:
+		return []byte("null"), nil
+	case Bool:
+		return strconv.AppendBool(nil, v.Bool()), nil
+	case Int:
+		return strconv.AppendInt(nil, v.Int(), 10), nil
+	case Uint:
+		return strconv.AppendUint(nil, v.Uint(), 10), nil
+	case Float:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return []byte(`"NaN"`), nil
+		case math.IsInf(f, +1):
+			return []byte(`"+Inf"`), nil
+		case math.IsInf(f, -1):
+			return []byte(`"-Inf"`), nil
+		}
+		b := strconv.AppendFloat(nil, f, 'g', -1, 64)
+		if bytes.IndexAny(b, ".e") < 0 {
+			b = append(b, ".0"...)
+		}
+		return b, nil
+	case Duration:
+		return strconv.AppendQuote(nil, v.Duration().String()), nil
+	default:
+		return nil, errors.New("stats: cannot marshal a value of unsupported type")
+	}
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (v *Value) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	s := string(b)
+
+	switch {
+	case s == "null":
+		*v = Value{}
+		return nil
+
+	case s == "true" || s == "false":
+		*v = boolValue(s == "true")
+		return nil
+
+	case len(s) != 0 && s[0] == '"':
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		switch s {
+		case "NaN":
+			*v = float64Value(math.NaN())
+		case "+Inf":
+			*v = float64Value(math.Inf(+1))
+		case "-Inf":
+			*v = float64Value(math.Inf(-1))
+		default:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("stats: invalid value %q: %w", s, err)
+			}
+			*v = durationValue(d)
+		}
+		return nil
+
+	case bytes.ContainsAny(b, ".eE"):
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("stats: invalid value %s: %w", s, err)
+		}
+		*v = float64Value(f)
+		return nil
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*v = int64Value(i)
+		return nil
+	}
+
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("stats: invalid value %s: %w", s, err)
+	}
+	*v = uint64Value(u)
+	return nil
+}
+
+type jsonField struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Value Value     `json:"value"`
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (f Field) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonField{Name: f.Name, Type: f.Type(), Value: f.Value})
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (f *Field) UnmarshalJSON(b []byte) error {
+	var jf jsonField
+	if err := json.Unmarshal(b, &jf); err != nil {
+		return err
+	}
+	*f = Field{Name: jf.Name, Value: jf.Value}
+	f.setType(jf.Type)
+	return nil
+}
+
+// MarshalProto returns the protobuf encoding of m.
+func (m Measure) MarshalProto() ([]byte, error) {
+	return m.AppendProto(nil)
+}
+
+// AppendProto appends the protobuf encoding of m to b and returns the
+// extended buffer.
+func (m Measure) AppendProto(b []byte) ([]byte, error) {
+	b = appendProtoString(b, 1, m.Name)
+
+	for _, f := range m.Fields {
+		var err error
+		b = appendProtoKey(b, 2, protoBytes)
+		b = binary.AppendUvarint(b, uint64(f.protoSize()))
+		if b, err = f.appendProto(b); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range m.Tags {
+		b = appendProtoKey(b, 3, protoBytes)
+		b = binary.AppendUvarint(b, uint64(protoStringSize(1, t.Name)+protoStringSize(2, t.Value)))
+		b = appendProtoString(b, 1, t.Name)
+		b = appendProtoString(b, 2, t.Value)
+	}
+
+	if m.SampleRate != 0 {
+		b = appendProtoKey(b, 4, protoFixed64)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(m.SampleRate))
+	}
+
+	return b, nil
+}
+
+// UnmarshalProto decodes the protobuf encoding of a measure from b into m.
+// Unknown fields are ignored.
+func (m *Measure) UnmarshalProto(b []byte) error {
+	*m = Measure{}
+
+	return decodeProto(b, func(num int, wireType int, v uint64, p []byte) error {
+		switch {
+		case num == 1 && wireType == protoBytes:
+			m.Name = string(p)
+		case num == 2 && wireType == protoBytes:
+			var f Field
+			if err := f.unmarshalProto(p); err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, f)
+		case num == 3 && wireType == protoBytes:
+			var t Tag
+			if err := t.unmarshalProto(p); err != nil {
+				return err
+			}
+			m.Tags = append(m.Tags, t)
+		case num == 4 && wireType == protoFixed64:
+			m.SampleRate = math.Float64frombits(v)
+		}
+		return nil
+	})
+}
+
+func (f Field) protoSize() int {
+	n := protoStringSize(1, f.Name)
+	if t := f.Type(); t != Counter {
+		n += protoVarintSize(2, uint64(t))
+	}
+	switch f.Value.Type() {
+	case Bool:
+		n += protoVarintSize(3, f.Value.bits)
+	case Int:
+		n += protoVarintSize(4, zigzag(f.Value.Int()))
+	case Uint:
+		n += protoVarintSize(5, f.Value.Uint())
+	case Float:
+		n += 1 + 8
+	case Duration:
+		n += protoVarintSize(7, zigzag(int64(f.Value.Duration())))
+	}
+	return n
+}
+
+func (f Field) appendProto(b []byte) ([]byte, error) {
+	b = appendProtoString(b, 1, f.Name)
+	if t := f.Type(); t != Counter {
+		b = appendProtoVarint(b, 2, uint64(t))
+	}
+	switch f.Value.Type() {
+	case Null:
+	case Bool:
+		b = appendProtoVarint(b, 3, f.Value.bits)
+	case Int:
+		b = appendProtoVarint(b, 4, zigzag(f.Value.Int()))
+	case Uint:
+		b = appendProtoVarint(b, 5, f.Value.Uint())
+	case Float:
+		b = appendProtoKey(b, 6, protoFixed64)
+		b = binary.LittleEndian.AppendUint64(b, f.Value.bits)
+	case Duration:
+		b = appendProtoVarint(b, 7, zigzag(int64(f.Value.Duration())))
+	default:
+		return nil, errors.New("stats: cannot marshal a value of unsupported type")
+	}
+	return b, nil
+}
+
+func (f *Field) unmarshalProto(b []byte) error {
+	var ftype FieldType
+
+	err := decodeProto(b, func(num int, wireType int, v uint64, p []byte) error {
+		switch {
+		case num == 1 && wireType == protoBytes:
+			f.Name = string(p)
+		case num == 2 && wireType == protoVarint:
+			ftype = FieldType(v)
+		case num == 3 && wireType == protoVarint:
+			f.Value = boolValue(v != 0)
+		case num == 4 && wireType == protoVarint:
+			f.Value = int64Value(unzigzag(v))
+		case num == 5 && wireType == protoVarint:
+			f.Value = uint64Value(v)
+		case num == 6 && wireType == protoFixed64:
+			f.Value = Value{typ: Float, bits: v}
+		case num == 7 && wireType == protoVarint:
+			f.Value = durationValue(time.Duration(unzigzag(v)))
+		}
+		return nil
+	})
+
+	f.setType(ftype)
+	return err
+}
+
+func (t *Tag) unmarshalProto(b []byte) error {
+	return decodeProto(b, func(num int, wireType int, v uint64, p []byte) error {
+		if wireType == protoBytes {
+			switch num {
+			case 1:
+				t.Name = string(p)
+			case 2:
+				t.Value = string(p)
+			}
+		}
+		return nil
+	})
+}
+
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var errMalformedProto = errors.New("stats: malformed protobuf measure")
+
+// decodeProto calls f for each field of the protobuf message in b, with the
+// value of the field in v for numeric wire types and in p for length-delimited
+// ones.
+func decodeProto(b []byte, f func(num int, wireType int, v uint64, p []byte) error) error {
+	for len(b) != 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformedProto
+		}
+		b = b[n:]
+
+		num, wireType := int(key>>3), int(key&7)
+		var v uint64
+		var p []byte
+
+		switch wireType {
+		case protoVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errMalformedProto
+			}
+			b = b[n:]
+		case protoFixed64:
+			if len(b) < 8 {
+				return errMalformedProto
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case protoBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errMalformedProto
+			}
+			p, b = b[n:n+int(size)], b[n+int(size):]
+		case protoFixed32:
+			if len(b) < 4 {
+				return errMalformedProto
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			return errMalformedProto
+		}
+
+		if err := f(num, wireType, v, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendProtoKey(b []byte, num int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, num int, v uint64) []byte {
+	return binary.AppendUvarint(appendProtoKey(b, num, protoVarint), v)
+}
+
+func appendProtoString(b []byte, num int, s string) []byte {
+	b = appendProtoKey(b, num, protoBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func protoVarintSize(num int, v uint64) int {
+	return uvarintSize(uint64(num)<<3) + uvarintSize(v)
+}
+
+func protoStringSize(num int, s string) int {
+	return uvarintSize(uint64(num)<<3) + uvarintSize(uint64(len(s))) + len(s)
+}
+
+func uvarintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
@@ -0,0 +1,150 @@
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var marshalMeasures = []Measure{
+	{
+		Name: "http",
+		Fields: []Field{
+			MakeField("requests", 1, Counter),
+			MakeField("negative", -42, Gauge),
+			MakeField("large", uint64(math.MaxUint64), Counter),
+			MakeField("rtt", 1.5, Histogram),
+			MakeField("integral", 2.0, Histogram),
+			MakeField("latency", 150*time.Millisecond, Histogram),
+			MakeField("up", true, Gauge),
+			MakeField("none", nil, Gauge),
+			MakeField("inf", math.Inf(-1), Gauge),
+		},
+		Tags: []Tag{T("host", "localhost"), T("method", "GET")},
+	},
+	{
+		Name:   "empty",
+		Fields: []Field{},
+	},
+	{
+		Name:       "sampled",
+		Fields:     []Field{MakeField("size", 3, Histogram)},
+		SampleRate: 0.25,
+	},
+}
+
+func TestMeasureJSON(t *testing.T) {
+	b, err := json.Marshal(marshalMeasures[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const expect = `{"name":"http","fields":[` +
+		`{"name":"requests","type":"counter","value":1},` +
+		`{"name":"negative","type":"gauge","value":-42},` +
+		`{"name":"large","type":"counter","value":18446744073709551615},` +
+		`{"name":"rtt","type":"histogram","value":1.5},` +
+		`{"name":"integral","type":"histogram","value":2.0},` +
+		`{"name":"latency","type":"histogram","value":"150ms"},` +
+		`{"name":"up","type":"gauge","value":true},` +
+		`{"name":"none","type":"gauge","value":null},` +
+		`{"name":"inf","type":"gauge","value":"-Inf"}],` +
+		`"tags":[{"name":"host","value":"localhost"},{"name":"method","value":"GET"}]}`
+
+	if string(b) != expect {
+		t.Errorf("bad JSON:\n- expected: %s\n- found:    %s", expect, b)
+	}
+
+	for _, m := range marshalMeasures {
+		b, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Measure
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		// Integers which fit in an int64 are decoded as Int values.
+		expect := m
+		expect.Fields = append([]Field{}, m.Fields...)
+		for i, f := range expect.Fields {
+			if f.Value.Type() == Uint && f.Value.Uint() <= math.MaxInt64 {
+				expect.Fields[i].Value = Value{typ: Int, pad: f.Value.pad, bits: f.Value.bits}
+			}
+		}
+
+		if !reflect.DeepEqual(decoded, expect) {
+			t.Errorf("bad JSON round trip:\n- expected: %v\n- found:    %v", expect, decoded)
+		}
+	}
+}
+
+func TestMeasureJSONErrors(t *testing.T) {
+	tests := []string{
+		`{"name":"m","fields":[{"name":"f","type":"summary","value":1}]}`,
+		`{"name":"m","fields":[{"name":"f","type":"counter","value":"1 hour"}]}`,
+		`{"name":"m","fields":[{"name":"f","type":"counter","value":{}}]}`,
+	}
+
+	for _, test := range tests {
+		var m Measure
+		if err := json.Unmarshal([]byte(test), &m); err == nil {
+			t.Errorf("%s: expected an error", test)
+		}
+	}
+}
+
+func TestMeasureProto(t *testing.T) {
+	for _, m := range marshalMeasures {
+		b, err := m.MarshalProto()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Measure
+		if err := decoded.UnmarshalProto(b); err != nil {
+			t.Fatal(err)
+		}
+
+		expect := m
+		if len(expect.Fields) == 0 {
+			expect.Fields = nil
+		}
+
+		if !reflect.DeepEqual(decoded, expect) {
+			t.Errorf("bad protobuf round trip:\n- expected: %v\n- found:    %v", expect, decoded)
+		}
+	}
+}
+
+func TestMeasureProtoEncoding(t *testing.T) {
+	m := Measure{
+		Name:   "m",
+		Fields: []Field{MakeField("f", -1, Gauge)},
+		Tags:   []Tag{T("a", "b")},
+	}
+
+	b, err := m.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []byte{
+		0x0a, 1, 'm',
+		0x12, 7, 0x0a, 1, 'f', 0x10, 1, 0x20, 1,
+		0x1a, 6, 0x0a, 1, 'a', 0x12, 1, 'b',
+	}
+
+	if !reflect.DeepEqual(b, expect) {
+		t.Errorf("bad protobuf encoding:\n- expected: %x\n- found:    %x", expect, b)
+	}
+
+	var decoded Measure
+	if err := decoded.UnmarshalProto(b[:len(b)-1]); err != errMalformedProto {
+		t.Error("expected an error decoding a truncated message, got", err)
+	}
+}
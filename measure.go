@@ -7,6 +7,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"unsafe"
+
+	"github.com/segmentio/fasthash/jody"
 )
 
 // Measure is a type that represents a single measure made by the application.
@@ -16,10 +18,19 @@ import (
 //
 // Implementations of the Handler interface receive lists of measures produced
 // by the application, and assume the tags will be sorted.
+//
+// Measures can be serialized to JSON with encoding/json, and to protobuf with
+// the MarshalProto and UnmarshalProto methods.
 type Measure struct {
-	Name   string
-	Fields []Field
-	Tags   []Tag
+	Name   string  `json:"name"`
+	Fields []Field `json:"fields"`
+	Tags   []Tag   `json:"tags,omitempty"`
+
+	// SampleRate is the rate at which the measure was sampled, in the (0, 1)
+	// range, or zero if it was not sampled. The values of counters have
+	// already been divided by the rate, handlers may use it to scale other
+	// fields or to let their backend know about the sampling.
+	SampleRate float64 `json:"sample_rate,omitempty"`
 }
 
 // Clone creates and returns a deep copy of m. The original and returned values
@@ -27,16 +38,130 @@ type Measure struct {
 // for example).
 func (m Measure) Clone() Measure {
 	return Measure{
-		Name:   m.Name,
-		Fields: copyFields(m.Fields),
-		Tags:   copyTags(m.Tags),
+		Name:       m.Name,
+		Fields:     copyFields(m.Fields),
+		Tags:       copyTags(m.Tags),
+		SampleRate: m.SampleRate,
+	}
+}
+
+// CloneMeasures creates and returns a deep copy of measures, which handlers
+// that need to retain measures after HandleMeasures returned can hold on to.
+//
+// The fields and tags of all measures are copied to two backing arrays shared
+// by the returned measures, so cloning a batch costs the same number of
+// allocations regardless of its size. The slices are capped at their length,
+// appending to the fields or tags of one measure never overwrites another.
+func CloneMeasures(measures []Measure) []Measure {
+	if len(measures) == 0 {
+		return nil
+	}
+
+	numFields, numTags := 0, 0
+	for i := range measures {
+		numFields += len(measures[i].Fields)
+		numTags += len(measures[i].Tags)
+	}
+
+	clones := make([]Measure, len(measures))
+	fields := make([]Field, 0, numFields)
+	tags := make([]Tag, 0, numTags)
+
+	for i := range measures {
+		m := &measures[i]
+		c := &clones[i]
+		c.Name = m.Name
+		c.SampleRate = m.SampleRate
+
+		if n := len(m.Fields); n != 0 {
+			fields = append(fields, m.Fields...)
+			c.Fields = fields[len(fields)-n : len(fields) : len(fields)]
+		}
+
+		if n := len(m.Tags); n != 0 {
+			tags = append(tags, m.Tags...)
+			c.Tags = tags[len(tags)-n : len(tags) : len(tags)]
+		}
 	}
+
+	return clones
 }
 
 func (m Measure) String() string {
 	return "{ " + m.Name + "(" + strings.Join(stringFields(m.Fields), ", ") + ") [" + strings.Join(stringTags(m.Tags), ", ") + "] }"
 }
 
+// Canonical returns a copy of m in canonical form: tags are sorted by name and
+// deduplicated (the last tag wins, like SortTags), and fields are sorted by
+// name, preserving the relative order of fields with the same name.
+//
+// Measures produced by the engine already have sorted tags, canonicalization
+// is useful when measures are built or combined by other means, for example
+// before comparing or hashing them in aggregation layers.
+func (m Measure) Canonical() Measure {
+	c := m.Clone()
+
+	if len(c.Tags) != 0 {
+		c.Tags = SortTags(c.Tags)
+	}
+
+	sort.SliceStable(c.Fields, func(i, j int) bool {
+		return c.Fields[i].Name < c.Fields[j].Name
+	})
+
+	return c
+}
+
+// Equal returns true if m and other have the same name, fields (including
+// their types), and tags, in the same order. Measures should be canonicalized
+// first when their fields or tags may not be in the same order.
+func (m Measure) Equal(other Measure) bool {
+	if m.Name != other.Name || len(m.Fields) != len(other.Fields) || len(m.Tags) != len(other.Tags) {
+		return false
+	}
+
+	for i := range m.Fields {
+		if m.Fields[i] != other.Fields[i] {
+			return false
+		}
+	}
+
+	for i := range m.Tags {
+		if m.Tags[i] != other.Tags[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Hash returns a 64 bits hash of m, covering its name, fields and tags. Equal
+// measures have equal hashes. The hash is stable across program executions.
+func (m Measure) Hash() uint64 {
+	h := m.SeriesHash()
+
+	for _, f := range m.Fields {
+		h = jody.AddString64(h, f.Name)
+		h = jody.AddUint64(h, uint64(f.Value.typ)<<32|uint64(uint32(f.Value.pad)))
+		h = jody.AddUint64(h, f.Value.bits)
+	}
+
+	return h
+}
+
+// SeriesHash returns a 64 bits hash of the name and tags of m, which identify
+// the time series that the measure belongs to regardless of its values.
+func (m Measure) SeriesHash() uint64 {
+	h := jody.AddString64(jody.Init64, m.Name)
+
+	for _, t := range m.Tags {
+		h = jody.AddString64(h, t.Name)
+		h = jody.AddString64(h, t.Value)
+	}
+
+	return h
+}
+
 func stringFields(fields []Field) []string {
 	s := make([]string, len(fields))
 
@@ -66,7 +191,8 @@ func stringTags(tags []Tag) []string {
 //     int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr,
 //     float32, float64, or time.Duration, and represent fields of the measures.
 //     The struct fields may also define a 'type' tag with a value of "counter",
-//     "gauge" or "histogram" to tune the behavior of the measure handlers.
+//     "gauge", "histogram" or "distribution" to tune the behavior of the
+//     measure handlers.
 //
 //  2. All fields exposing a 'tag' tag are expected to be of type string and
 //     represent tags of the measures.
@@ -74,6 +200,21 @@ func stringTags(tags []Tag) []string {
 //  3. All struct fields are searched recursively for fields matching rule (1)
 //     and (2). Tags found within a struct are inherited by measures generated from
 //     sub-fields, they may also be overwritten.
+//
+//  4. The 'metric' tag may carry comma-separated options after the name: the
+//     metric type ("counter", "gauge", "histogram" or "distribution", taking
+//     precedence over the 'type' tag), "unit=<unit>", and
+//     "buckets=<v1>|<v2>|..." for default histogram buckets, for example
+//     `metric:"latency,histogram,unit=s"`.
+//     Options are recorded in DefaultMetadataRegistry where handlers can look
+//     them up, registering a metric again with a different type or unit is
+//     reported as a conflict (see MetadataRegistry).
+//
+//  5. Fields exposing a 'metric' tag may also define a 'help' tag with the
+//     description of the metric, which is recorded in DefaultMetadataRegistry
+//     as well, for example:
+//
+//     rtt time.Duration `metric:"rtt,histogram,unit=s,buckets=0.1|1|10" help:"Time to serve requests."`
 func MakeMeasures(prefix string, value interface{}, tags ...Tag) []Measure {
 	if !TagsAreSorted(tags) {
 		SortTags(tags)
@@ -205,6 +346,7 @@ func (m *Measure) reset() {
 	}
 
 	m.Name = ""
+	m.SampleRate = 0
 	m.Fields = m.Fields[:0]
 	m.Tags = m.Tags[:0]
 }
@@ -254,7 +396,7 @@ func appendMeasureFuncs(measures []measureFuncs, typ reflect.Type, name string,
 		}
 	}
 
-	mf := measureFuncs{name: name, tags: tags.funcs()}
+	mf := measureFuncs{name: Intern(name), tags: tags.funcs()}
 
 	for i, n := 0, typ.NumField(); i != n; i++ {
 		field := typ.Field(i)
@@ -262,17 +404,32 @@ func appendMeasureFuncs(measures []measureFuncs, typ reflect.Type, name string,
 
 		switch field.Type.Kind() {
 		case reflect.Struct, reflect.Array:
+			metric, _, _ = strings.Cut(metric, ",")
 			measures = appendMeasureFuncs(measures, field.Type, concat(name, metric), tags, offset+field.Offset)
 
 		default:
 			if len(metric) != 0 {
+				mt := parseMetricTag(metric)
+				if !mt.hasType {
+					mt.ftype = makeFieldType(field.Tag.Get("type"))
+				}
 				sf := structField{typ: field.Type, off: offset + field.Offset}
-				t := makeFieldType(field.Tag.Get("type"))
-				f := makeFieldFunc(sf, metric, t)
+				f := makeFieldFunc(sf, mt.name, mt.ftype)
 				if f == nil {
-					panic("unsupported value type found for metric " + concat(name, metric) + ": " + field.Type.String())
+					panic("unsupported value type found for metric " + concat(name, mt.name) + ": " + field.Type.String())
 				}
 				mf.fields = append(mf.fields, f)
+
+				help := field.Tag.Get("help")
+
+				if mt.hasType || mt.metadata || len(help) != 0 {
+					DefaultMetadataRegistry.set(Key{Measure: name, Field: mt.name}, Metadata{
+						Unit:    mt.unit,
+						Type:    mt.ftype,
+						Buckets: mt.buckets,
+						Help:    help,
+					})
+				}
 			}
 		}
 	}
@@ -395,6 +552,8 @@ func makeFieldType(mtype string) FieldType {
 		return Counter
 	case "gauge":
 		return Gauge
+	case "distribution":
+		return Distribution
 	default:
 		return Histogram
 	}
@@ -460,10 +619,30 @@ func concat(prefix, suffix string) string {
 	return prefix + "." + suffix
 }
 
+// maxPooledMeasures is the capacity above which measure buffers are not put
+// back in measurePool, so reporting one very large batch does not pin its
+// memory for the lifetime of the program.
+const maxPooledMeasures = 1024
+
 type measuresBuffer struct {
 	measures []Measure
 }
 
+func (b *measuresBuffer) reset() {
+	for i := range b.measures {
+		b.measures[i].reset()
+	}
+	b.measures = b.measures[:0]
+}
+
+func releaseMeasures(b *measuresBuffer) {
+	if cap(b.measures) > maxPooledMeasures {
+		return
+	}
+	b.reset()
+	measurePool.Put(b)
+}
+
 var measurePool = sync.Pool{
 	New: func() interface{} {
 		return &measuresBuffer{measures: make([]Measure, 0, 32)}
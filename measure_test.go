@@ -41,6 +41,8 @@ func TestMakeMeasures(t *testing.T) {
 			N float64 `metric:"n" type:"histogram"`
 
 			O time.Duration `metric:"o" type:"histogram"`
+
+			P float64 `metric:"p" type:"distribution"`
 		}
 
 		Array [3]struct {
@@ -72,6 +74,7 @@ func TestMakeMeasures(t *testing.T) {
 	testMetrics.Simple.M = 12
 	testMetrics.Simple.N = 13
 	testMetrics.Simple.O = 14
+	testMetrics.Simple.P = 15
 
 	testMetrics.Array[0].V = 1
 	testMetrics.Array[0].X = true
@@ -113,6 +116,7 @@ func TestMakeMeasures(t *testing.T) {
 				MakeField("m", float32(12), Histogram),
 				MakeField("n", float64(13), Histogram),
 				MakeField("o", time.Duration(14), Histogram),
+				MakeField("p", float64(15), Distribution),
 			},
 			Tags: []Tag{
 				{"environment", "development"},
@@ -171,3 +175,155 @@ func TestMakeMeasures(t *testing.T) {
 		t.Logf("found:    %#v", measures)
 	}
 }
+
+func TestMeasureCanonical(t *testing.T) {
+	m := Measure{
+		Name: "test",
+		Fields: []Field{
+			MakeField("b", 1, Counter),
+			MakeField("a", 2, Gauge),
+		},
+		Tags: []Tag{T("service", "api"), T("env", "dev"), T("service", "web")},
+	}
+
+	c := m.Canonical()
+
+	expected := Measure{
+		Name: "test",
+		Fields: []Field{
+			MakeField("a", 2, Gauge),
+			MakeField("b", 1, Counter),
+		},
+		Tags: []Tag{T("env", "dev"), T("service", "web")},
+	}
+
+	if !c.Equal(expected) {
+		t.Errorf("bad canonical measure:\nwant: %v\ngot:  %v", expected, c)
+	}
+
+	if m.Tags[0] != T("service", "api") || m.Fields[0].Name != "b" {
+		t.Error("canonicalizing a measure must not modify the original:", m)
+	}
+
+	if c.Hash() != expected.Hash() || c.SeriesHash() != expected.SeriesHash() {
+		t.Error("equal measures must have equal hashes")
+	}
+}
+
+func TestMeasureEqual(t *testing.T) {
+	base := Measure{
+		Name:   "test",
+		Fields: []Field{MakeField("value", 1, Counter)},
+		Tags:   []Tag{T("env", "dev")},
+	}
+
+	tests := []struct {
+		scenario string
+		measure  Measure
+	}{
+		{
+			scenario: "different name",
+			measure:  Measure{Name: "other", Fields: base.Fields, Tags: base.Tags},
+		},
+		{
+			scenario: "different field value",
+			measure:  Measure{Name: "test", Fields: []Field{MakeField("value", 2, Counter)}, Tags: base.Tags},
+		},
+		{
+			scenario: "different field type",
+			measure:  Measure{Name: "test", Fields: []Field{MakeField("value", 1, Gauge)}, Tags: base.Tags},
+		},
+		{
+			scenario: "different tags",
+			measure:  Measure{Name: "test", Fields: base.Fields, Tags: []Tag{T("env", "prod")}},
+		},
+	}
+
+	if !base.Equal(base.Clone()) {
+		t.Error("a measure must be equal to its clone")
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if base.Equal(test.measure) {
+				t.Error("measures must not be equal")
+			}
+			if base.Hash() == test.measure.Hash() {
+				t.Error("measures must not have the same hash")
+			}
+		})
+	}
+
+	m := Measure{Name: "test", Fields: []Field{MakeField("value", 2, Counter)}, Tags: base.Tags}
+	if base.SeriesHash() != m.SeriesHash() {
+		t.Error("measures of the same series must have the same series hash")
+	}
+}
+
+func TestCloneMeasures(t *testing.T) {
+	measures := []Measure{
+		{
+			Name:   "a",
+			Fields: []Field{MakeField("count", 1, Counter), MakeField("size", 2, Histogram)},
+			Tags:   []Tag{T("env", "dev")},
+		},
+		{
+			Name:   "b",
+			Fields: []Field{MakeField("value", 3, Gauge)},
+		},
+		{
+			Name:   "c",
+			Fields: []Field{MakeField("count", 4, Counter)},
+			Tags:   []Tag{T("env", "prod"), T("host", "localhost")},
+		},
+	}
+
+	clones := CloneMeasures(measures)
+
+	if !reflect.DeepEqual(clones, measures) {
+		t.Fatalf("bad clones:\n- expected: %v\n- found:    %v", measures, clones)
+	}
+
+	measures[0].Fields[0] = MakeField("count", 42, Counter)
+	measures[2].Tags[0] = T("env", "test")
+
+	if clones[0].Fields[0].Value.Int() != 1 || clones[2].Tags[0].Value != "prod" {
+		t.Error("modifying the original measures must not modify the clones:", clones)
+	}
+
+	clones[0].Tags = append(clones[0].Tags, T("region", "us-west-2"))
+
+	if clones[2].Tags[0] != T("env", "prod") {
+		t.Error("appending to the tags of a clone must not modify the other clones:", clones)
+	}
+
+	if CloneMeasures(nil) != nil {
+		t.Error("cloning no measures must return nil")
+	}
+}
+
+func TestReportAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation budgets are not enforced with the race detector")
+	}
+
+	initValue := GoVersionReportingEnabled
+	GoVersionReportingEnabled = false
+	defer func() { GoVersionReportingEnabled = initValue }()
+
+	eng := NewEngine("", Discard)
+	tags := []Tag{T("env", "dev"), T("host", "localhost")}
+
+	metrics := struct {
+		Count int           `metric:"count" type:"counter"`
+		Size  int           `metric:"size" type:"histogram"`
+		Time  time.Duration `metric:"time" type:"histogram"`
+		Host  string        `tag:"role"`
+	}{Count: 1, Size: 2, Time: time.Second, Host: "api"}
+
+	eng.Report(&metrics, tags...) // populate the measure cache
+
+	if allocs := testing.AllocsPerRun(100, func() { eng.Report(&metrics, tags...) }); allocs != 0 {
+		t.Error("reporting measures must not allocate in steady state, allocs per run:", allocs)
+	}
+}
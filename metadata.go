@@ -0,0 +1,221 @@
+package stats
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metadata carries information about a metric which is not part of the
+// measures themselves, like its unit or the buckets of a histogram. Handlers
+// may look it up in the metadata registry to enrich what they expose.
+type Metadata struct {
+	// Unit of the metric values, for example "s" or "bytes".
+	Unit string
+
+	// Type is the type of the metric field.
+	Type FieldType
+
+	// Buckets are the default histogram buckets of the metric, they are used
+	// when none were set in stats.Buckets.
+	Buckets []Value
+
+	// Help is the description of the metric, which handlers expose when they
+	// support it, like the # HELP lines of Prometheus.
+	Help string
+}
+
+// conflictsWith returns true if md and other describe metrics that cannot
+// share the same series, because their types or units differ.
+func (md Metadata) conflictsWith(other Metadata) bool {
+	return md.Type != other.Type || (md.Unit != other.Unit && len(md.Unit) != 0 && len(other.Unit) != 0)
+}
+
+// MetadataConflictError is the error reported when a metric is registered with
+// metadata which conflicts with a previous registration of the same metric.
+type MetadataConflictError struct {
+	Key      Key
+	Existing Metadata
+	Metadata Metadata
+}
+
+// Error satisfies the error interface.
+func (e *MetadataConflictError) Error() string {
+	return fmt.Sprintf("conflicting registrations of metric %s.%s: type %s and unit %q were already registered, got type %s and unit %q",
+		e.Key.Measure, e.Key.Field, e.Existing.Type, e.Existing.Unit, e.Metadata.Type, e.Metadata.Unit)
+}
+
+// MetadataRegistry stores the metadata of metrics, it is safe to use
+// concurrently from multiple goroutines.
+//
+// Registering a metric again with a different type, or a different unit,
+// would produce series mixing incompatible values. When it happens the first
+// registration is retained, and the conflict is counted and logged, or passed
+// to OnConflict if it is set. Programs which prefer to catch the mistake as
+// soon as they start, like tests, can set Strict to panic instead.
+type MetadataRegistry struct {
+	// OnConflict is called with the conflicting registrations of a metric,
+	// the error is logged when it is nil. CountConflicts returns a function
+	// which reports conflicts as a counter.
+	OnConflict func(*MetadataConflictError)
+
+	// Strict makes the registry panic with the conflict error, after calling
+	// OnConflict.
+	Strict bool
+
+	mutex     sync.RWMutex
+	metadata  map[Key]Metadata
+	conflicts uint64
+}
+
+// Set records md as the metadata of the metric identified by key, which has
+// the form "measure.field".
+func (r *MetadataRegistry) Set(key string, md Metadata) {
+	r.set(makeKey(key), md)
+}
+
+func (r *MetadataRegistry) set(key Key, md Metadata) {
+	r.mutex.Lock()
+
+	if r.metadata == nil {
+		r.metadata = make(map[Key]Metadata)
+	}
+
+	existing, ok := r.metadata[key]
+	if !ok || !existing.conflictsWith(md) {
+		r.metadata[key] = md
+		r.mutex.Unlock()
+		return
+	}
+
+	atomic.AddUint64(&r.conflicts, 1)
+	onConflict, strict := r.OnConflict, r.Strict
+	r.mutex.Unlock()
+
+	err := &MetadataConflictError{Key: key, Existing: existing, Metadata: md}
+	if onConflict != nil {
+		onConflict(err)
+	} else {
+		log.Printf("stats: %s", err)
+	}
+	if strict {
+		panic(err)
+	}
+}
+
+// Conflicts returns the number of conflicting registrations seen by the
+// registry.
+func (r *MetadataRegistry) Conflicts() uint64 {
+	return atomic.LoadUint64(&r.conflicts)
+}
+
+// Lookup returns the metadata of the metric identified by key, and a boolean
+// indicating whether it was found.
+func (r *MetadataRegistry) Lookup(key Key) (Metadata, bool) {
+	r.mutex.RLock()
+	md, ok := r.metadata[key]
+	r.mutex.RUnlock()
+	return md, ok
+}
+
+// Range calls f for each metric in the registry, until f returns false.
+func (r *MetadataRegistry) Range(f func(Key, Metadata) bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for k, md := range r.metadata {
+		if !f(k, md) {
+			return
+		}
+	}
+}
+
+// DefaultMetadataRegistry is the registry where the metadata declared in
+// struct tags of values passed to MakeMeasures or Engine.Report is recorded.
+var DefaultMetadataRegistry = &MetadataRegistry{}
+
+// CountConflicts returns a function suitable for MetadataRegistry.OnConflict
+// which increments the "stats.metadata.conflicts" counter of eng, tagged with
+// the name of the metric, instead of logging the error.
+func CountConflicts(eng *Engine) func(*MetadataConflictError) {
+	return func(err *MetadataConflictError) {
+		eng.Incr("stats.metadata.conflicts", T("metric", concat(err.Key.Measure, err.Key.Field)))
+	}
+}
+
+// BucketsOf returns the histogram buckets of the metric identified by key,
+// looking first in buckets, then in the metadata registry.
+func BucketsOf(buckets HistogramBuckets, key Key) []Value {
+	if b, ok := buckets[key]; ok {
+		return b
+	}
+	if md, ok := DefaultMetadataRegistry.Lookup(key); ok {
+		return md.Buckets
+	}
+	return nil
+}
+
+// HelpOf returns the description of the metric identified by key recorded in
+// the metadata registry, or an empty string if it has none.
+func HelpOf(key Key) string {
+	md, _ := DefaultMetadataRegistry.Lookup(key)
+	return md.Help
+}
+
+// metricTag is the parsed representation of a `metric:"..."` struct tag.
+//
+// The tag starts with the metric name, optionally followed by comma-separated
+// options:
+//
+//	counter, gauge, histogram,  the type of the metric
+//	distribution
+//	unit=<unit>                 the unit of the metric values
+//	buckets=<v1>|<v2>|...       the default buckets of a histogram
+//
+// For example `metric:"latency,histogram,unit=s,buckets=0.1|0.5|1"`.
+type metricTag struct {
+	name     string
+	ftype    FieldType
+	hasType  bool
+	metadata bool
+	unit     string
+	buckets  []Value
+}
+
+func parseMetricTag(tag string) metricTag {
+	name, opts, _ := strings.Cut(tag, ",")
+	t := metricTag{name: name}
+
+	for len(opts) != 0 {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+
+		switch key {
+		case "counter", "gauge", "histogram", "distribution":
+			t.ftype, t.hasType = makeFieldType(key), true
+
+		case "unit":
+			t.unit, t.metadata = value, true
+
+		case "buckets":
+			for _, s := range strings.Split(value, "|") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				if err != nil {
+					panic("invalid bucket value in metric tag " + strconv.Quote(tag) + ": " + s)
+				}
+				t.buckets = append(t.buckets, ValueOf(f))
+			}
+			t.metadata = true
+
+		case "":
+		default:
+			panic("unsupported option in metric tag " + strconv.Quote(tag) + ": " + opt)
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,174 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMetricTag(t *testing.T) {
+	tests := []struct {
+		tag    string
+		expect metricTag
+	}{
+		{
+			tag:    "count",
+			expect: metricTag{name: "count"},
+		},
+		{
+			tag:    "count,counter",
+			expect: metricTag{name: "count", ftype: Counter, hasType: true},
+		},
+		{
+			tag: "latency,histogram,unit=s,buckets=0.1|0.5|1",
+			expect: metricTag{
+				name:     "latency",
+				ftype:    Histogram,
+				hasType:  true,
+				metadata: true,
+				unit:     "s",
+				buckets:  []Value{ValueOf(0.1), ValueOf(0.5), ValueOf(1.0)},
+			},
+		},
+		{
+			tag:    "size,distribution,unit=By",
+			expect: metricTag{name: "size", ftype: Distribution, hasType: true, metadata: true, unit: "By"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.tag, func(t *testing.T) {
+			if mt := parseMetricTag(test.tag); !reflect.DeepEqual(mt, test.expect) {
+				t.Errorf("bad metric tag:\nwant: %+v\ngot:  %+v", test.expect, mt)
+			}
+		})
+	}
+}
+
+func TestParseMetricTagInvalid(t *testing.T) {
+	for _, tag := range []string{"count,unknown", "latency,buckets=1|a"} {
+		t.Run(tag, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			parseMetricTag(tag)
+		})
+	}
+}
+
+func TestMakeMeasuresMetadata(t *testing.T) {
+	var metrics struct {
+		rpc struct {
+			count   int           `metric:"count,counter"`
+			size    int           `metric:"size" type:"gauge"`
+			latency time.Duration `metric:"latency,histogram,unit=s,buckets=0.1|1" help:"Time to complete RPCs, in seconds."`
+			errors  int           `metric:"errors" type:"counter" help:"Number of failed RPCs."`
+		} `metric:"rpc,ignored"`
+	}
+
+	measures := MakeMeasures("metadata.test", &metrics)
+
+	if len(measures) != 1 || measures[0].Name != "metadata.test.rpc" {
+		t.Fatalf("bad measures: %v", measures)
+	}
+
+	types := map[string]FieldType{}
+	for _, f := range measures[0].Fields {
+		types[f.Name] = f.Type()
+	}
+
+	if types["count"] != Counter || types["size"] != Gauge || types["latency"] != Histogram {
+		t.Errorf("bad field types: %v", types)
+	}
+
+	md, ok := DefaultMetadataRegistry.Lookup(Key{Measure: "metadata.test.rpc", Field: "latency"})
+	if !ok {
+		t.Fatal("missing metadata for the latency field")
+	}
+
+	if md.Unit != "s" || md.Type != Histogram || len(md.Buckets) != 2 || md.Help != "Time to complete RPCs, in seconds." {
+		t.Errorf("bad metadata: %+v", md)
+	}
+
+	if help := HelpOf(Key{Measure: "metadata.test.rpc", Field: "errors"}); help != "Number of failed RPCs." {
+		t.Errorf("bad help of a field without metric tag options: %q", help)
+	}
+
+	if _, ok := DefaultMetadataRegistry.Lookup(Key{Measure: "metadata.test.rpc", Field: "size"}); ok {
+		t.Error("fields without metric tag options must not be registered")
+	}
+
+	buckets := BucketsOf(HistogramBuckets{}, Key{Measure: "metadata.test.rpc", Field: "latency"})
+	if len(buckets) != 2 || buckets[1] != ValueOf(1.0) {
+		t.Errorf("bad default buckets: %v", buckets)
+	}
+
+	override := HistogramBuckets{}
+	override.Set("metadata.test.rpc.latency", 5)
+	if buckets := BucketsOf(override, Key{Measure: "metadata.test.rpc", Field: "latency"}); len(buckets) != 1 {
+		t.Errorf("buckets set explicitly must take precedence: %v", buckets)
+	}
+}
+
+func TestMetadataRegistryConflict(t *testing.T) {
+	key := Key{Measure: "conflict.test", Field: "value"}
+
+	r := &MetadataRegistry{}
+	r.set(key, Metadata{Type: Counter, Unit: "bytes"})
+	r.set(key, Metadata{Type: Counter})
+	r.set(key, Metadata{Type: Counter, Unit: "bytes", Buckets: []Value{ValueOf(1)}})
+
+	if n := r.Conflicts(); n != 0 {
+		t.Fatalf("compatible registrations reported as conflicts: %d", n)
+	}
+
+	r.set(key, Metadata{Type: Gauge, Unit: "bytes"})
+
+	if md, _ := r.Lookup(key); md.Type != Counter {
+		t.Errorf("the first registration must be retained on conflict: %+v", md)
+	}
+
+	r.Strict = true
+	func() {
+		defer func() {
+			err, _ := recover().(*MetadataConflictError)
+			if err == nil {
+				t.Fatal("expected a panic with a *MetadataConflictError")
+			}
+			if err.Key != key || err.Existing.Type != Counter || err.Metadata.Type != Gauge {
+				t.Errorf("bad conflict error: %+v", err)
+			}
+		}()
+		r.set(key, Metadata{Type: Gauge})
+	}()
+	r.Strict = false
+
+	initValue := GoVersionReportingEnabled
+	GoVersionReportingEnabled = false
+	defer func() { GoVersionReportingEnabled = initValue }()
+
+	var measures []Measure
+	r.OnConflict = CountConflicts(NewEngine("", HandlerFunc(func(_ time.Time, m ...Measure) {
+		for _, x := range m {
+			measures = append(measures, x.Clone())
+		}
+	})))
+	r.set(key, Metadata{Type: Counter, Unit: "s"})
+
+	if n := r.Conflicts(); n != 3 {
+		t.Errorf("bad number of conflicts: %d", n)
+	}
+
+	if md, _ := r.Lookup(key); md.Unit != "bytes" {
+		t.Errorf("the first registration must be retained on conflict: %+v", md)
+	}
+
+	if len(measures) != 1 || measures[0].Name != "stats.metadata" || measures[0].Fields[0].Name != "conflicts" {
+		t.Fatalf("bad measures: %v", measures)
+	}
+	if tags := measures[0].Tags; len(tags) != 1 || tags[0] != T("metric", "conflict.test.value") {
+		t.Errorf("bad tags: %v", tags)
+	}
+}
@@ -0,0 +1,252 @@
+package stats
+
+import (
+	"regexp"
+	"strings"
+)
+
+// HandlerMiddleware is the signature of functions wrapping a handler to alter
+// the measures it receives, for example to drop noisy metrics or strip high
+// cardinality tags without changing the code producing them.
+type HandlerMiddleware func(Handler) Handler
+
+// Chain wraps h with the given middlewares. Measures go through the
+// middlewares in the order they are given before reaching h.
+//
+//	stats.Register(stats.Chain(dd,
+//		stats.FilterMeasures(func(m stats.Measure) bool { return m.Name != "debug" }),
+//		stats.Relabel(stats.RelabelRule{Action: stats.DropTag, Tag: "request_id"}),
+//	))
+func Chain(h Handler, middlewares ...HandlerMiddleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// FilterMeasures returns a middleware dropping the measures for which keep
+// returns false.
+func FilterMeasures(keep func(Measure) bool) HandlerMiddleware {
+	return func(h Handler) Handler {
+		return FilteredHandler(h, func(measures []Measure) []Measure {
+			var filtered []Measure
+
+			for i, m := range measures {
+				if keep(m) {
+					if filtered != nil {
+						filtered = append(filtered, m)
+					}
+				} else if filtered == nil {
+					filtered = append(make([]Measure, 0, len(measures)), measures[:i]...)
+				}
+			}
+
+			if filtered == nil {
+				return measures
+			}
+			return filtered
+		})
+	}
+}
+
+// RenameMetrics returns a middleware renaming metrics. The keys of names are
+// either measure names, renaming all the fields of the measures, or full
+// metric names in the "measure.field" form, which move the fields to the
+// measures named by the values.
+func RenameMetrics(names map[string]string) HandlerMiddleware {
+	return func(h Handler) Handler {
+		return FilteredHandler(h, func(measures []Measure) []Measure {
+			var renamed []Measure
+
+			for i, m := range measures {
+				r, ok := renameMeasure(m, names)
+				if ok && renamed == nil {
+					renamed = append(make([]Measure, 0, len(measures)), measures[:i]...)
+				}
+				if renamed != nil {
+					renamed = append(renamed, r...)
+				}
+			}
+
+			if renamed == nil {
+				return measures
+			}
+			return renamed
+		})
+	}
+}
+
+func renameMeasure(m Measure, names map[string]string) ([]Measure, bool) {
+	if name, ok := names[m.Name]; ok {
+		m.Name = name
+		return []Measure{m}, true
+	}
+
+	var kept []Field
+	var moved []Measure
+
+	for i, f := range m.Fields {
+		name, ok := names[m.Name+"."+f.Name]
+		if !ok {
+			if moved != nil {
+				kept = append(kept, f)
+			}
+			continue
+		}
+
+		if moved == nil {
+			kept = append(make([]Field, 0, len(m.Fields)), m.Fields[:i]...)
+		}
+
+		measureName, fieldName := name, ""
+		if j := strings.LastIndexByte(name, '.'); j >= 0 {
+			measureName, fieldName = name[:j], name[j+1:]
+		}
+
+		f.Name = fieldName
+		moved = append(moved, Measure{
+			Name:       measureName,
+			Fields:     []Field{f},
+			Tags:       m.Tags,
+			SampleRate: m.SampleRate,
+		})
+	}
+
+	if moved == nil {
+		return nil, false
+	}
+
+	if len(kept) != 0 {
+		m.Fields = kept
+		moved = append([]Measure{m}, moved...)
+	}
+
+	return moved, true
+}
+
+// RelabelAction is the type of the actions applied by relabeling rules.
+type RelabelAction int
+
+const (
+	// DropTag removes the tag from the measures.
+	DropTag RelabelAction = iota
+
+	// RenameTag renames the tag to Replacement.
+	RenameTag
+
+	// ReplaceValue replaces the value of the tag with Replacement. When Match
+	// is set, Replacement may refer to its submatches like
+	// regexp.Regexp.ReplaceAllString.
+	ReplaceValue
+)
+
+// RelabelRule is a rule applied to the tags of measures by the middleware
+// returned by Relabel.
+type RelabelRule struct {
+	// Action applied to the tag.
+	Action RelabelAction
+
+	// Name of the tag the rule applies to.
+	Tag string
+
+	// When set, the rule only applies to tags with a value matching the
+	// regular expression.
+	Match *regexp.Regexp
+
+	// New name or value of the tag, depending on the action.
+	Replacement string
+}
+
+func (r *RelabelRule) apply(t Tag) (Tag, bool) {
+	if r.Match != nil && !r.Match.MatchString(t.Value) {
+		return t, true
+	}
+
+	switch r.Action {
+	case DropTag:
+		return t, false
+	case RenameTag:
+		t.Name = r.Replacement
+	case ReplaceValue:
+		if r.Match != nil {
+			t.Value = r.Match.ReplaceAllString(t.Value, r.Replacement)
+		} else {
+			t.Value = r.Replacement
+		}
+	}
+
+	return t, true
+}
+
+// Relabel returns a middleware applying rules to the tags of measures, in the
+// order they are given.
+func Relabel(rules ...RelabelRule) HandlerMiddleware {
+	rules = append([]RelabelRule(nil), rules...)
+
+	return func(h Handler) Handler {
+		return FilteredHandler(h, func(measures []Measure) []Measure {
+			var relabeled []Measure
+
+			for i, m := range measures {
+				tags, ok := relabel(m.Tags, rules)
+				if !ok {
+					if relabeled != nil {
+						relabeled = append(relabeled, m)
+					}
+					continue
+				}
+
+				if relabeled == nil {
+					relabeled = append(make([]Measure, 0, len(measures)), measures[:i]...)
+				}
+
+				m.Tags = tags
+				relabeled = append(relabeled, m)
+			}
+
+			if relabeled == nil {
+				return measures
+			}
+			return relabeled
+		})
+	}
+}
+
+// relabel applies rules to tags, it returns false if none of the rules applied
+// to the tags, in which case the original slice must be used.
+func relabel(tags []Tag, rules []RelabelRule) ([]Tag, bool) {
+	var relabeled []Tag
+
+	for i, t := range tags {
+		t2, keep := t, true
+
+		for j := range rules {
+			if r := &rules[j]; r.Tag == t2.Name {
+				if t2, keep = r.apply(t2); !keep {
+					break
+				}
+			}
+		}
+
+		if keep && t2 == t {
+			if relabeled != nil {
+				relabeled = append(relabeled, t)
+			}
+			continue
+		}
+
+		if relabeled == nil {
+			relabeled = append(make([]Tag, 0, len(tags)), tags[:i]...)
+		}
+
+		if keep {
+			relabeled = append(relabeled, t2)
+		}
+	}
+
+	if relabeled == nil {
+		return nil, false
+	}
+
+	return SortTags(relabeled), true
+}
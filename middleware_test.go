@@ -0,0 +1,104 @@
+package stats_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	h := &statstest.Handler{}
+	c := stats.Chain(h,
+		stats.FilterMeasures(func(m stats.Measure) bool { return m.Name != "noisy" }),
+		stats.RenameMetrics(map[string]string{"old": "new"}),
+		stats.Relabel(stats.RelabelRule{Action: stats.DropTag, Tag: "request_id"}),
+	)
+
+	c.HandleMeasures(time.Now(),
+		stats.Measure{Name: "noisy", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}},
+		stats.Measure{
+			Name:   "old",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("request_id", "1234"), stats.T("service", "api")},
+		},
+	)
+	flush(c)
+
+	assert.Equal(t, []stats.Measure{
+		{
+			Name:   "new",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "api")},
+		},
+	}, h.Measures())
+	assert.EqualValues(t, 1, h.FlushCalls())
+}
+
+func TestRenameMetrics(t *testing.T) {
+	h := &statstest.Handler{}
+	r := stats.RenameMetrics(map[string]string{"http.req.bytes": "http.request_bytes"})(h)
+
+	in := []stats.Measure{
+		{
+			Name: "http.req",
+			Fields: []stats.Field{
+				stats.MakeField("count", 1, stats.Counter),
+				stats.MakeField("bytes", 42, stats.Histogram),
+			},
+			Tags: []stats.Tag{stats.T("method", "GET")},
+		},
+	}
+
+	r.HandleMeasures(time.Now(), in...)
+
+	assert.Equal(t, []stats.Measure{
+		{
+			Name:   "http.req",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "GET")},
+		},
+		{
+			Name:   "http",
+			Fields: []stats.Field{stats.MakeField("request_bytes", 42, stats.Histogram)},
+			Tags:   []stats.Tag{stats.T("method", "GET")},
+		},
+	}, h.Measures())
+
+	assert.Len(t, in[0].Fields, 2, "the measures passed to the middleware must not be modified")
+}
+
+func TestRelabel(t *testing.T) {
+	h := &statstest.Handler{}
+	r := stats.Relabel(
+		stats.RelabelRule{Action: stats.RenameTag, Tag: "host", Replacement: "instance"},
+		stats.RelabelRule{Action: stats.ReplaceValue, Tag: "path", Match: regexp.MustCompile(`^/users/\d+$`), Replacement: "/users/:id"},
+		stats.RelabelRule{Action: stats.ReplaceValue, Tag: "instance", Replacement: "redacted"},
+	)(h)
+
+	tags := []stats.Tag{stats.T("host", "ip-10-0-0-1"), stats.T("path", "/users/42"), stats.T("zone", "a")}
+
+	r.HandleMeasures(time.Now(),
+		stats.Measure{Name: "a", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}, Tags: tags},
+		stats.Measure{Name: "b", Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)}, Tags: []stats.Tag{stats.T("path", "/")}},
+	)
+
+	assert.Equal(t, []stats.Measure{
+		{
+			Name:   "a",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("instance", "redacted"), stats.T("path", "/users/:id"), stats.T("zone", "a")},
+		},
+		{
+			Name:   "b",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("path", "/")},
+		},
+	}, h.Measures())
+
+	assert.Equal(t, stats.T("host", "ip-10-0-0-1"), tags[0], "the tags passed to the middleware must not be modified")
+}
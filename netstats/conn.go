@@ -1,11 +1,15 @@
 package netstats
 
 import (
+	"errors"
 	"io"
 	"math"
 	"net"
+	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/segmentio/vpcinfo"
@@ -37,9 +41,61 @@ func NewConn(c net.Conn) net.Conn {
 	return NewConnWith(stats.DefaultEngine, c)
 }
 
+// Config carries the configuration of connections and listeners created by
+// NewConnWithConfig and NewListenerWithConfig.
+type Config struct {
+	// Engine that metrics are produced on, defaults to stats.DefaultEngine.
+	Engine *stats.Engine
+
+	// Classify returns the application protocol spoken on connections, which
+	// is set as the app_protocol tag of their metrics. Connections are not
+	// classified when nil, or when the function returns an empty string.
+	// ClassifyProtocol implements heuristics suited to most programs.
+	Classify func(net.Conn) string
+
+	// GroupRemoteAddr returns the group of the remote address of connections,
+	// which is set as the remote_group tag of the counters of timeouts,
+	// half-open connections, and keepalive failures, so flaky network paths
+	// stand out without the cardinality of individual peers. Defaults to
+	// RemoteAddrGroup.
+	GroupRemoteAddr func(net.Addr) string
+}
+
 // NewConnWith returns a net.Conn object that wraps c and produces metrics on eng.
 func NewConnWith(eng *stats.Engine, c net.Conn) net.Conn {
-	nc := &conn{Conn: c, eng: eng}
+	return NewConnWithConfig(c, Config{Engine: eng})
+}
+
+// NewConnWithConfig returns a net.Conn object that wraps c and produces metrics
+// as configured by config.
+//
+// Besides the counts and sizes of reads and writes, connections count the
+// failures pointing at the network path to the peer, tagged with the
+// operation and the remote_group of the peer:
+//
+//   - conn.timeout.count, reads and writes whose deadline expired,
+//   - conn.half_open.count, connections reset by the peer, or broken, after
+//     writes succeeded, which means the peer went away without closing them,
+//   - conn.keepalive_failure.count, connections which the system timed out
+//     because keepalive probes, or retransmissions, were not acknowledged.
+func NewConnWithConfig(c net.Conn, config Config) net.Conn {
+	eng := config.Engine
+	if eng == nil {
+		eng = stats.DefaultEngine
+	}
+
+	groupRemoteAddr := config.GroupRemoteAddr
+	if groupRemoteAddr == nil {
+		groupRemoteAddr = RemoteAddrGroup
+	}
+
+	if config.Classify != nil {
+		if p := config.Classify(c); p != "" {
+			eng = eng.WithTags(stats.T("app_protocol", p))
+		}
+	}
+
+	nc := &conn{Conn: c, eng: eng, remoteGroup: groupRemoteAddr(c.RemoteAddr())}
 
 	proto := c.LocalAddr().Network()
 	nc.r.metrics.protocol = proto
@@ -51,8 +107,12 @@ func NewConnWith(eng *stats.Engine, c net.Conn) net.Conn {
 
 type conn struct {
 	net.Conn
-	eng  *stats.Engine
-	once sync.Once
+	eng     *stats.Engine
+	once    sync.Once
+	onClose func(*conn)
+
+	remoteGroup string
+	wrote       atomic.Bool // a write succeeded
 
 	r struct {
 		sync.Mutex
@@ -90,6 +150,9 @@ func (c *conn) Close() (err error) {
 		if err != nil {
 			c.error("close", err)
 		}
+		if c.onClose != nil {
+			c.onClose(c)
+		}
 	})
 	return
 }
@@ -111,6 +174,7 @@ func (c *conn) Read(b []byte) (n int, err error) {
 
 	if err != nil && err != io.EOF {
 		c.error("read", err)
+		c.failure("read", err)
 	}
 
 	return
@@ -133,6 +197,9 @@ func (c *conn) Write(b []byte) (n int, err error) {
 
 	if err != nil {
 		c.error("write", err)
+		c.failure("write", err)
+	} else if n != 0 {
+		c.wrote.Store(true)
 	}
 
 	return
@@ -174,6 +241,63 @@ func (c *conn) error(op string, err error) {
 	}
 }
 
+// failure counts the errors of reads and writes which point at the network
+// path to the peer, they are temporary errors which error does not count.
+func (c *conn) failure(op string, err error) {
+	var name string
+
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		name = "conn.timeout.count"
+	case errors.Is(err, syscall.ETIMEDOUT):
+		name = "conn.keepalive_failure.count"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		if !c.wrote.Load() {
+			return
+		}
+		name = "conn.half_open.count"
+	default:
+		return
+	}
+
+	c.eng.Incr(name,
+		stats.T("operation", op),
+		stats.T("protocol", c.w.metrics.protocol),
+		stats.T("remote_group", c.remoteGroup),
+	)
+}
+
+// RemoteAddrGroup is the default value of Config.GroupRemoteAddr, it groups IP
+// addresses by network, /24 for IPv4 and /64 for IPv6, for example
+// "10.0.1.0/24". Addresses of other networks, like unix sockets, are grouped
+// by network name.
+func RemoteAddrGroup(addr net.Addr) string {
+	if addr == nil {
+		return "unknown"
+	}
+
+	var ip net.IP
+
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	default:
+		return addr.Network()
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	if len(ip) == net.IPv6len {
+		return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+	}
+	return addr.Network()
+}
+
 func rootError(err error) error {
 searchRootError:
 	for i := 0; i != 10; i++ { // protect against cyclic errors
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
 	"reflect"
+	"syscall"
 	"testing"
 	"time"
 
@@ -257,3 +259,109 @@ var (
 	testRemoteAddr = &net.TCPAddr{IP: net.IP{127, 0, 0, 1}, Port: 4242}
 	errTest        = errors.New("test")
 )
+
+func TestConnFailures(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	tests := []struct {
+		scenario string
+		wrote    bool
+		op       string
+		err      error
+		metric   string
+	}{
+		{
+			scenario: "read deadline expired",
+			op:       "read",
+			err:      &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded},
+			metric:   "conn.timeout",
+		},
+		{
+			scenario: "keepalive probes not acknowledged",
+			op:       "read",
+			err:      &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ETIMEDOUT)},
+			metric:   "conn.keepalive_failure",
+		},
+		{
+			scenario: "peer gone after a successful write",
+			wrote:    true,
+			op:       "write",
+			err:      &net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)},
+			metric:   "conn.half_open",
+		},
+		{
+			scenario: "connection reset before any write",
+			op:       "read",
+			err:      &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			h := &statstest.Handler{}
+			e := stats.NewEngine("netstats.test", h)
+
+			c := &testConn{}
+			conn := NewConnWithConfig(c, Config{Engine: e})
+			if test.wrote {
+				conn.Write([]byte("Hello World!"))
+			}
+
+			c.err = test.err
+			if test.op == "read" {
+				conn.Read(make([]byte, 32))
+			} else {
+				conn.Write([]byte("Hello World!"))
+			}
+
+			var found []stats.Measure
+			for _, m := range h.Measures() {
+				switch m.Name {
+				case "netstats.test.conn.timeout", "netstats.test.conn.keepalive_failure", "netstats.test.conn.half_open":
+					found = append(found, m)
+				}
+			}
+
+			if test.metric == "" {
+				if len(found) != 0 {
+					t.Errorf("unexpected failure counters: %v", found)
+				}
+				return
+			}
+
+			expected := []stats.Measure{{
+				Name:   "netstats.test." + test.metric,
+				Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+				Tags: []stats.Tag{
+					stats.T("operation", test.op),
+					stats.T("protocol", "tcp"),
+					stats.T("remote_group", "127.0.0.0/24"),
+				},
+			}}
+
+			if !reflect.DeepEqual(found, expected) {
+				t.Errorf("bad failure counters:\nwant: %v\ngot:  %v", expected, found)
+			}
+		})
+	}
+}
+
+func TestRemoteAddrGroup(t *testing.T) {
+	tests := []struct {
+		addr  net.Addr
+		group string
+	}{
+		{addr: &net.TCPAddr{IP: net.IP{10, 1, 2, 3}, Port: 80}, group: "10.1.2.0/24"},
+		{addr: &net.UDPAddr{IP: net.ParseIP("2001:db8:0:1:2:3:4:5"), Port: 53}, group: "2001:db8:0:1::/64"},
+		{addr: &net.UnixAddr{Name: "/tmp/sock", Net: "unix"}, group: "unix"},
+		{addr: nil, group: "unknown"},
+	}
+
+	for _, test := range tests {
+		if group := RemoteAddrGroup(test.addr); group != test.group {
+			t.Errorf("%v: bad group: %q != %q", test.addr, group, test.group)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package netstats
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func init() {
+	stats.Buckets.Set("conn.dial:seconds", latencyBuckets...)
+}
+
+// Dialer establishes connections which produce metrics, and reports the time
+// it took to establish them in the conn.dial.seconds histogram. Failed dials
+// are counted in conn.error.count with the operation tag set to "dial".
+//
+// The zero value dials with the default configuration of net.Dialer and
+// produces metrics on the default engine.
+type Dialer struct {
+	// Dialer establishing the connections, defaults to a zero net.Dialer.
+	Dialer *net.Dialer
+
+	// TLSConfig is the configuration of connections established by
+	// DialTLSContext, a zero configuration is used when nil.
+	TLSConfig *tls.Config
+
+	// Config of the connections returned by the dialer, see NewConnWithConfig.
+	Config
+}
+
+// DialContext connects to the address on the named network, see
+// net.Dialer.DialContext.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := d.dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnWithConfig(c, d.Config), nil
+}
+
+// DialTLSContext connects to the address on the named network and runs the
+// TLS handshake, reporting its metrics as described in HandshakeWith.
+//
+// The connection metrics account for the bytes exchanged over TLS, including
+// the handshake.
+func (d *Dialer) DialTLSContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := d.dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	config := d.TLSConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = hostname(address)
+	}
+
+	tc := tls.Client(NewConnWithConfig(c, d.Config), config)
+
+	if err := HandshakeWith(ctx, d.engine(), tc); err != nil {
+		tc.Close()
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+func (d *Dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	start := time.Now()
+	c, err := dialer.DialContext(ctx, network, address)
+	eng := d.engine()
+
+	if err != nil {
+		eng.Incr("conn.error.count",
+			stats.T("operation", "dial"),
+			stats.T("protocol", network),
+		)
+		return nil, err
+	}
+
+	eng.Observe("conn.dial.seconds", time.Since(start), stats.T("protocol", network))
+	return c, nil
+}
+
+func (d *Dialer) engine() *stats.Engine {
+	if d.Engine != nil {
+		return d.Engine
+	}
+	return stats.DefaultEngine
+}
+
+func hostname(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
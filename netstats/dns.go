@@ -0,0 +1,115 @@
+package netstats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func init() {
+	stats.Buckets.Set("dns.lookup:seconds", latencyBuckets...)
+}
+
+// Resolver wraps a net.Resolver to report the latency of DNS lookups in the
+// dns.lookup.seconds histogram, tagged with the kind of lookup (operation) and
+// its outcome: "ok", "not_found", "timeout", or "error".
+//
+// The zero value uses net.DefaultResolver and the default engine.
+type Resolver struct {
+	// Resolver performing the lookups, defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// Engine that metrics are produced on, defaults to stats.DefaultEngine.
+	Engine *stats.Engine
+}
+
+// LookupHost wraps net.Resolver.LookupHost.
+func (r *Resolver) LookupHost(ctx context.Context, host string) (addrs []string, err error) {
+	defer r.observe("host", time.Now(), &err)
+	return r.resolver().LookupHost(ctx, host)
+}
+
+// LookupIPAddr wraps net.Resolver.LookupIPAddr.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) (addrs []net.IPAddr, err error) {
+	defer r.observe("ip", time.Now(), &err)
+	return r.resolver().LookupIPAddr(ctx, host)
+}
+
+// LookupIP wraps net.Resolver.LookupIP.
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) (ips []net.IP, err error) {
+	defer r.observe("ip", time.Now(), &err)
+	return r.resolver().LookupIP(ctx, network, host)
+}
+
+// LookupAddr wraps net.Resolver.LookupAddr.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) (names []string, err error) {
+	defer r.observe("addr", time.Now(), &err)
+	return r.resolver().LookupAddr(ctx, addr)
+}
+
+// LookupCNAME wraps net.Resolver.LookupCNAME.
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (cname string, err error) {
+	defer r.observe("cname", time.Now(), &err)
+	return r.resolver().LookupCNAME(ctx, host)
+}
+
+// LookupSRV wraps net.Resolver.LookupSRV.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+	defer r.observe("srv", time.Now(), &err)
+	return r.resolver().LookupSRV(ctx, service, proto, name)
+}
+
+// LookupMX wraps net.Resolver.LookupMX.
+func (r *Resolver) LookupMX(ctx context.Context, name string) (mxs []*net.MX, err error) {
+	defer r.observe("mx", time.Now(), &err)
+	return r.resolver().LookupMX(ctx, name)
+}
+
+// LookupTXT wraps net.Resolver.LookupTXT.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) (txts []string, err error) {
+	defer r.observe("txt", time.Now(), &err)
+	return r.resolver().LookupTXT(ctx, name)
+}
+
+func (r *Resolver) resolver() *net.Resolver {
+	if r.Resolver != nil {
+		return r.Resolver
+	}
+	return net.DefaultResolver
+}
+
+func (r *Resolver) engine() *stats.Engine {
+	if r.Engine != nil {
+		return r.Engine
+	}
+	return stats.DefaultEngine
+}
+
+func (r *Resolver) observe(op string, start time.Time, err *error) {
+	r.engine().Observe("dns.lookup.seconds", time.Since(start),
+		stats.T("operation", op),
+		stats.T("outcome", lookupOutcome(*err)),
+	)
+}
+
+func lookupOutcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return "not_found"
+		case dnsErr.IsTimeout:
+			return "timeout"
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "error"
+}
@@ -0,0 +1,74 @@
+package netstats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestResolver(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	r := &Resolver{
+		// Lookups of localhost are served from the hosts file, others fail
+		// without reaching the network.
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(context.Context, string, string) (net.Conn, error) {
+				return nil, errors.New("no network")
+			},
+		},
+		Engine: stats.NewEngine("netstats.test", h),
+	}
+
+	if _, err := r.LookupHost(context.Background(), "localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LookupTXT(context.Background(), "example.invalid"); err == nil {
+		t.Fatal("expected an error looking up example.invalid")
+	}
+
+	measures := h.Measures()
+	if len(measures) != 2 {
+		t.Fatal("bad measures:", measures)
+	}
+
+	for i, tags := range [][]stats.Tag{
+		{stats.T("operation", "host"), stats.T("outcome", "ok")},
+		{stats.T("operation", "txt"), stats.T("outcome", "error")},
+	} {
+		m := measures[i]
+		if m.Name != "netstats.test.dns.lookup" {
+			t.Errorf("bad measure name: %s", m.Name)
+		}
+		if len(m.Tags) != 2 || m.Tags[0] != tags[0] || m.Tags[1] != tags[1] {
+			t.Errorf("bad tags: %v != %v", m.Tags, tags)
+		}
+	}
+}
+
+func TestLookupOutcome(t *testing.T) {
+	tests := []struct {
+		err     error
+		outcome string
+	}{
+		{nil, "ok"},
+		{&net.DNSError{IsNotFound: true}, "not_found"},
+		{&net.DNSError{IsTimeout: true}, "timeout"},
+		{context.DeadlineExceeded, "timeout"},
+		{errors.New("oops"), "error"},
+	}
+
+	for _, test := range tests {
+		if outcome := lookupOutcome(test.err); outcome != test.outcome {
+			t.Errorf("lookupOutcome(%v): %q != %q", test.err, outcome, test.outcome)
+		}
+	}
+}
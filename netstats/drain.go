@@ -0,0 +1,102 @@
+package netstats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// DefaultDrainInterval is the interval at which Drain reports progress when
+// none was configured.
+const DefaultDrainInterval = 1 * time.Second
+
+// Drain reports the progress of connections accepted by lstn being drained
+// during a graceful shutdown, on the engine that the listener was configured
+// with. The listener must have been created by a call to NewListener or
+// NewListenerWith.
+//
+// The function blocks until all connections accepted by the listener have
+// been closed, or ctx is canceled. While waiting, it reports at each interval
+// the number of connections that remain open and the age of the oldest one.
+// When it returns, the total drain duration is reported, with a "complete"
+// tag indicating whether all connections were closed in time.
+//
+// The program is expected to stop accepting new connections (usually by
+// closing the listener) before calling Drain. The returned error is ctx.Err()
+// if the context was canceled before all connections were closed.
+func Drain(ctx context.Context, lstn net.Listener, interval time.Duration) error {
+	return DrainWith(ctx, nil, lstn, interval)
+}
+
+// DrainWith is like Drain but reports the drain metrics on eng instead of the
+// engine that the listener was configured with.
+//
+// If eng is nil, the listener's engine is used.
+func DrainWith(ctx context.Context, eng *stats.Engine, lstn net.Listener, interval time.Duration) error {
+	l, ok := lstn.(*listener)
+	if !ok {
+		return errors.New("netstats: Drain called with a listener that was not created by NewListener")
+	}
+
+	if eng == nil {
+		eng = l.eng
+	}
+
+	if interval <= 0 {
+		interval = DefaultDrainInterval
+	}
+
+	start := time.Now()
+	proto := l.Addr().Network()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	m := &drainMetrics{}
+	m.drain.protocol = proto
+
+	for {
+		now := time.Now()
+		count, oldest := l.openConns()
+
+		m.drain.remaining = count
+		m.drain.oldestAge = 0
+		if count != 0 {
+			m.drain.oldestAge = now.Sub(oldest)
+		}
+		eng.ReportAt(now, m)
+
+		if count == 0 {
+			reportDrainDuration(eng, proto, now.Sub(start), true)
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			reportDrainDuration(eng, proto, time.Since(start), false)
+			return ctx.Err()
+		}
+	}
+}
+
+type drainMetrics struct {
+	drain struct {
+		remaining int           `metric:"remaining.count"    type:"gauge"`
+		oldestAge time.Duration `metric:"oldest_age.seconds" type:"gauge"`
+		protocol  string        `tag:"protocol"`
+	} `metric:"conn.drain"`
+}
+
+func reportDrainDuration(eng *stats.Engine, proto string, d time.Duration, complete bool) {
+	status := "false"
+	if complete {
+		status = "true"
+	}
+	eng.Observe("conn.drain.duration.seconds", d,
+		stats.T("complete", status),
+		stats.T("protocol", proto),
+	)
+}
@@ -0,0 +1,121 @@
+package netstats
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestDrain(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+	h := &statstest.Handler{}
+	e := stats.NewEngine("netstats.test", h)
+
+	lstn := NewListenerWith(e, testLstn{})
+
+	conn, err := lstn.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lstn.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		conn.Close()
+	}()
+
+	if err := DrainWith(context.Background(), e, lstn, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining []int64
+	var complete string
+
+	for _, m := range h.Measures() {
+		switch m.Name {
+		case "netstats.test.conn.drain":
+			remaining = append(remaining, m.Fields[0].Value.Int())
+		case "netstats.test.conn.drain.duration":
+			for _, tag := range m.Tags {
+				if tag.Name == "complete" {
+					complete = tag.Value
+				}
+			}
+		}
+	}
+
+	if len(remaining) < 2 || remaining[0] != 1 || remaining[len(remaining)-1] != 0 {
+		t.Errorf("bad remaining connection counts: %v", remaining)
+	}
+
+	if complete != "true" {
+		t.Errorf("bad drain completion tag: %q", complete)
+	}
+}
+
+func TestDrainListenerEngine(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("netstats.test", h)
+
+	lstn := NewListenerWith(e, testLstn{})
+	lstn.Close()
+
+	if err := Drain(context.Background(), lstn, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := h.Value("netstats.test.conn.drain.duration.seconds"); !ok {
+		t.Error("the drain metrics were not reported on the engine of the listener")
+	}
+}
+
+func TestDrainCanceled(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("netstats.test", h)
+
+	lstn := NewListenerWith(e, testLstn{})
+
+	conn, err := lstn.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := DrainWith(ctx, e, lstn, time.Millisecond); err != context.DeadlineExceeded {
+		t.Error("bad error:", err)
+	}
+
+	found := false
+	for _, m := range h.Measures() {
+		if m.Name == "netstats.test.conn.drain.duration" {
+			found = true
+			if m.Tags[0] != stats.T("complete", "false") {
+				t.Error("bad tags:", m.Tags)
+			}
+		}
+	}
+	if !found {
+		t.Error("drain duration was not reported")
+	}
+}
+
+func TestDrainUnknownListener(t *testing.T) {
+	lstn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lstn.Close()
+
+	if err := Drain(context.Background(), lstn, 0); err == nil {
+		t.Error("expected an error draining a listener that wasn't instrumented")
+	}
+}
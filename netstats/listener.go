@@ -1,12 +1,26 @@
 package netstats
 
 import (
+	"math"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	stats "github.com/segmentio/stats/v5"
 )
 
+func init() {
+	stats.Buckets.Set("conn.lifetime:seconds",
+		1*time.Second,
+		10*time.Second,
+		1*time.Minute,
+		10*time.Minute,
+		1*time.Hour,
+		math.Inf(+1),
+	)
+}
+
 // NewListener returns a new net.Listener which uses the stats.DefaultEngine.
 func NewListener(lstn net.Listener) net.Listener {
 	return NewListenerWith(stats.DefaultEngine, lstn)
@@ -14,30 +28,70 @@ func NewListener(lstn net.Listener) net.Listener {
 
 // NewListenerWith returns a new net.Listener with the provided *stats.Engine.
 func NewListenerWith(eng *stats.Engine, lstn net.Listener) net.Listener {
-	return &listener{
-		lstn: lstn,
-		eng:  eng,
+	return NewListenerWithConfig(lstn, Config{Engine: eng})
+}
+
+// NewListenerWithConfig returns a new net.Listener which wraps the connections
+// it accepts as configured by config.
+//
+// The listener counts the connections it accepted and that were closed, and
+// reports the number of connections still active as a gauge, in the
+// conn.listener measure. The lifetime of connections is reported in the
+// conn.lifetime.seconds histogram when they are closed. Accept errors are
+// counted in conn.error.count.
+func NewListenerWithConfig(lstn net.Listener, config Config) net.Listener {
+	if config.Engine == nil {
+		config.Engine = stats.DefaultEngine
+	}
+	l := &listener{
+		lstn:            lstn,
+		eng:             config.Engine,
+		classify:        config.Classify,
+		groupRemoteAddr: config.GroupRemoteAddr,
 	}
+	l.metrics.listener.protocol = lstn.Addr().Network()
+	return l
 }
 
 type listener struct {
-	lstn   net.Listener
-	eng    *stats.Engine
-	closed uint32
+	lstn            net.Listener
+	eng             *stats.Engine
+	classify        func(net.Conn) string
+	groupRemoteAddr func(net.Addr) string
+	closed          uint32
+
+	// The set of connections accepted by the listener that haven't been closed
+	// yet, mapped to the time at which they were accepted.
+	mutex   sync.Mutex
+	conns   map[*conn]time.Time
+	metrics listenerMetrics
 }
 
-func (l *listener) Accept() (conn net.Conn, err error) {
-	if conn, err = l.lstn.Accept(); err != nil {
+type listenerMetrics struct {
+	listener struct {
+		accepted int    `metric:"accepted.count" type:"counter"`
+		active   int    `metric:"active.count"   type:"gauge"`
+		closed   int    `metric:"closed.count"   type:"counter"`
+		protocol string `tag:"protocol"`
+	} `metric:"conn.listener"`
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.lstn.Accept()
+	if err != nil {
 		if atomic.LoadUint32(&l.closed) == 0 {
 			l.error("accept", err)
 		}
 	}
 
-	if conn != nil {
-		conn = NewConnWith(l.eng, conn)
+	if c != nil {
+		c = NewConnWithConfig(c, Config{Engine: l.eng, Classify: l.classify, GroupRemoteAddr: l.groupRemoteAddr})
+		if nc, ok := c.(*conn); ok {
+			l.track(nc)
+		}
 	}
 
-	return
+	return c, err
 }
 
 func (l *listener) Close() (err error) {
@@ -58,6 +112,54 @@ func (l *listener) error(op string, err error) {
 	}
 }
 
+func (l *listener) track(c *conn) {
+	c.onClose = l.untrack
+	l.mutex.Lock()
+	if l.conns == nil {
+		l.conns = make(map[*conn]time.Time)
+	}
+	l.conns[c] = time.Now()
+	l.metrics.listener.accepted = 1
+	l.metrics.listener.closed = 0
+	l.metrics.listener.active = len(l.conns)
+	l.eng.Report(&l.metrics)
+	l.mutex.Unlock()
+}
+
+func (l *listener) untrack(c *conn) {
+	l.mutex.Lock()
+	accepted, ok := l.conns[c]
+	if !ok {
+		l.mutex.Unlock()
+		return
+	}
+	delete(l.conns, c)
+	l.metrics.listener.accepted = 0
+	l.metrics.listener.closed = 1
+	l.metrics.listener.active = len(l.conns)
+	l.eng.Report(&l.metrics)
+	l.mutex.Unlock()
+
+	l.eng.Observe("conn.lifetime.seconds", time.Since(accepted),
+		stats.T("protocol", l.metrics.listener.protocol),
+	)
+}
+
+// openConns returns the number of connections accepted by the listener that
+// are still open, and the time at which the oldest of them was accepted.
+func (l *listener) openConns() (count int, oldest time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, t := range l.conns {
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+
+	return len(l.conns), oldest
+}
+
 func isTemporary(err error) bool {
 	e, ok := err.(interface {
 		Temporary() bool
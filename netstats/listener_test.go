@@ -19,32 +19,67 @@ func TestListener(t *testing.T) {
 
 	lstn := NewListenerWith(e, testLstn{})
 
-	conn, err := lstn.Accept()
+	c, err := lstn.Accept()
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	conn.Close()
+	c.Close()
 	lstn.Close()
 
+	listenerMeasure := func(accepted, active, closed int) stats.Measure {
+		return stats.Measure{
+			Name: "netstats.test.conn.listener",
+			Fields: []stats.Field{
+				stats.MakeField("accepted.count", accepted, stats.Counter),
+				stats.MakeField("active.count", active, stats.Gauge),
+				stats.MakeField("closed.count", closed, stats.Counter),
+			},
+			Tags: []stats.Tag{stats.T("protocol", "tcp")},
+		}
+	}
+
 	expected := []stats.Measure{
 		{
 			Name:   "netstats.test.conn.open",
 			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
 			Tags:   []stats.Tag{stats.T("protocol", "tcp")},
 		},
+		listenerMeasure(1, 1, 0),
 		{
 			Name:   "netstats.test.conn.close",
 			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
 			Tags:   []stats.Tag{stats.T("protocol", "tcp")},
 		},
+		listenerMeasure(0, 0, 1),
 	}
 
-	if !reflect.DeepEqual(expected, h.Measures()) {
+	measures := h.Measures()
+	if len(measures) != len(expected)+1 {
+		t.Fatal("bad measures:", measures)
+	}
+
+	// The lifetime of the connection varies, only its presence is checked.
+	lifetime := measures[len(measures)-1]
+	measures = measures[:len(measures)-1]
+
+	if lifetime.Name != "netstats.test.conn.lifetime" || lifetime.Fields[0].Name != "seconds" {
+		t.Error("bad lifetime measure:", lifetime)
+	}
+
+	if !reflect.DeepEqual(expected, measures) {
 		t.Error("bad measures:")
 		t.Logf("expected: %v", expected)
-		t.Logf("found:    %v", h.Measures())
+		t.Logf("found:    %v", measures)
+	}
+
+	// Connections which are not tracked anymore are not counted again.
+	h.Clear()
+	lstn.(*listener).untrack(c.(*conn))
+
+	if measures := h.Measures(); len(measures) != 0 {
+		t.Error("untracking a closed connection reported measures:", measures)
 	}
 }
 
@@ -0,0 +1,74 @@
+package netstats
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// wellKnownPorts maps the ports of common services to the protocol they speak.
+var wellKnownPorts = map[int]string{
+	53:    "dns",
+	80:    "http",
+	443:   "tls",
+	3306:  "mysql",
+	5432:  "postgres",
+	6379:  "redis",
+	8080:  "http",
+	8443:  "tls",
+	9092:  "kafka",
+	11211: "memcached",
+	27017: "mongodb",
+}
+
+// ClassifyProtocol guesses the application protocol spoken on c. The protocol
+// negotiated by ALPN is used when c is a TLS connection which completed its
+// handshake, otherwise the protocol is derived from the remote port, or the
+// local port for connections accepted by servers, when it is the well-known
+// port of a common service (http, tls, redis, postgres, ...). TLS connections
+// on other ports are classified as "tls", and other connections are not
+// classified.
+func ClassifyProtocol(c net.Conn) string {
+	tc, isTLS := c.(interface{ ConnectionState() tls.ConnectionState })
+
+	if isTLS {
+		if p := alpnProtocol(tc.ConnectionState().NegotiatedProtocol); p != "" {
+			return p
+		}
+	}
+
+	for _, addr := range []net.Addr{c.RemoteAddr(), c.LocalAddr()} {
+		if p := wellKnownPorts[addrPort(addr)]; p != "" {
+			return p
+		}
+	}
+
+	if isTLS {
+		return "tls"
+	}
+	return ""
+}
+
+// alpnProtocol returns the name of the protocol identified by the ALPN ID.
+func alpnProtocol(id string) string {
+	switch id {
+	case "http/1.0", "http/1.1":
+		return "http"
+	case "h2":
+		return "http2"
+	case "h3":
+		return "http3"
+	case "postgresql":
+		return "postgres"
+	}
+	return id
+}
+
+func addrPort(addr net.Addr) int {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.Port
+	case *net.UDPAddr:
+		return a.Port
+	}
+	return 0
+}
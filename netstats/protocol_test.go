@@ -0,0 +1,108 @@
+package netstats
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+type addrConn struct {
+	testConn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr  { return c.local }
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+
+type tlsConn struct {
+	addrConn
+	state tls.ConnectionState
+}
+
+func (c *tlsConn) ConnectionState() tls.ConnectionState { return c.state }
+
+func TestClassifyProtocol(t *testing.T) {
+	tcp := func(port int) net.Addr { return &net.TCPAddr{IP: net.IP{127, 0, 0, 1}, Port: port} }
+
+	tests := []struct {
+		scenario string
+		conn     net.Conn
+		protocol string
+	}{
+		{
+			scenario: "connections to a well-known port are classified",
+			conn:     &addrConn{local: tcp(51000), remote: tcp(6379)},
+			protocol: "redis",
+		},
+		{
+			scenario: "connections accepted on a well-known port are classified",
+			conn:     &addrConn{local: tcp(5432), remote: tcp(51000)},
+			protocol: "postgres",
+		},
+		{
+			scenario: "connections on other ports are not classified",
+			conn:     &addrConn{local: tcp(51000), remote: tcp(4242)},
+			protocol: "",
+		},
+		{
+			scenario: "the protocol negotiated by ALPN takes precedence over ports",
+			conn: &tlsConn{
+				addrConn: addrConn{local: tcp(51000), remote: tcp(443)},
+				state:    tls.ConnectionState{HandshakeComplete: true, NegotiatedProtocol: "h2"},
+			},
+			protocol: "http2",
+		},
+		{
+			scenario: "TLS connections on other ports are classified as tls",
+			conn: &tlsConn{
+				addrConn: addrConn{local: tcp(51000), remote: tcp(4242)},
+			},
+			protocol: "tls",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if protocol := ClassifyProtocol(test.conn); protocol != test.protocol {
+				t.Errorf("bad protocol: %q != %q", protocol, test.protocol)
+			}
+		})
+	}
+}
+
+func TestConnAppProtocol(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("netstats.test", h)
+
+	c := NewConnWithConfig(&addrConn{
+		local:  &net.TCPAddr{IP: net.IP{127, 0, 0, 1}, Port: 51000},
+		remote: &net.TCPAddr{IP: net.IP{127, 0, 0, 1}, Port: 6379},
+	}, Config{Engine: e, Classify: ClassifyProtocol})
+	c.Write([]byte("PING\r\n"))
+	c.Close()
+
+	measures := h.Measures()
+	if len(measures) == 0 {
+		t.Fatal("no measures reported by the connection")
+	}
+
+	for _, m := range measures {
+		found := false
+		for _, tag := range m.Tags {
+			if tag == stats.T("app_protocol", "redis") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: missing app_protocol tag: %v", m.Name, m.Tags)
+		}
+	}
+}
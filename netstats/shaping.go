@@ -0,0 +1,182 @@
+package netstats
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Limiter is the interface of rate limiters used to shape the bandwidth of
+// connections, with rates expressed in bytes per second. It is implemented by
+// *rate.Limiter from golang.org/x/time/rate.
+type Limiter interface {
+	// WaitN blocks until n bytes may be transferred, n is never greater than
+	// the limiter's burst size.
+	WaitN(ctx context.Context, n int) error
+
+	// Burst returns the maximum number of bytes transferred at once.
+	Burst() int
+}
+
+// ShapingConfig configures the bandwidth shaping of connections created by
+// NewShapedConn.
+type ShapingConfig struct {
+	// ReadLimiter throttles reads from the connection, reads are not
+	// throttled when nil.
+	ReadLimiter Limiter
+
+	// ReadBandwidth is the read rate that the limiter was configured with, in
+	// bytes per second, it is reported to be compared with the achieved rate.
+	ReadBandwidth float64
+
+	// WriteLimiter throttles writes to the connection, writes are not
+	// throttled when nil.
+	WriteLimiter Limiter
+
+	// WriteBandwidth is the write rate that the limiter was configured with,
+	// in bytes per second, it is reported to be compared with the achieved
+	// rate.
+	WriteBandwidth float64
+}
+
+// NewShapedConn returns a net.Conn object that wraps c, throttles its reads
+// and writes with the limiters in config, and produces metrics on the default
+// engine.
+func NewShapedConn(c net.Conn, config ShapingConfig) net.Conn {
+	return NewShapedConnWith(stats.DefaultEngine, c, config)
+}
+
+// NewShapedConnWith returns a net.Conn object that wraps c, throttles its
+// reads and writes with the limiters in config, and produces metrics on eng.
+//
+// Each throttled operation reports, under "conn.shaping" and tagged with the
+// direction of the transfer, the time spent blocked on the limiter, the
+// bandwidth achieved by the connection while transferring data, and the
+// configured bandwidth. Writes are split in chunks of the limiter's burst
+// size, reads are throttled after data was received, by charging the limiter
+// for the bytes that were read.
+//
+// Waiting on the limiters does not honor the deadlines set on the connection.
+func NewShapedConnWith(eng *stats.Engine, c net.Conn, config ShapingConfig) net.Conn {
+	sc := &shapedConn{Conn: c, eng: eng}
+	proto := c.LocalAddr().Network()
+	sc.r.init(config.ReadLimiter, config.ReadBandwidth, "read", proto)
+	sc.w.init(config.WriteLimiter, config.WriteBandwidth, "write", proto)
+	return sc
+}
+
+type shapedConn struct {
+	net.Conn
+	eng *stats.Engine
+	r   shaper
+	w   shaper
+}
+
+func (c *shapedConn) BaseConn() net.Conn {
+	return c.Conn
+}
+
+func (c *shapedConn) Read(b []byte) (n int, err error) {
+	if c.r.limiter == nil {
+		return c.Conn.Read(b)
+	}
+
+	start := time.Now()
+	n, err = c.Conn.Read(b)
+	blocked, waitErr := c.r.wait(n)
+	c.r.report(c.eng, n, blocked, time.Since(start))
+
+	if err == nil {
+		err = waitErr
+	}
+	return
+}
+
+func (c *shapedConn) Write(b []byte) (n int, err error) {
+	if c.w.limiter == nil {
+		return c.Conn.Write(b)
+	}
+
+	start := time.Now()
+	var blocked time.Duration
+
+	for len(b) != 0 && err == nil {
+		chunk := c.w.chunk(len(b))
+
+		var d time.Duration
+		if d, err = c.w.wait(chunk); err == nil {
+			var m int
+			m, err = c.Conn.Write(b[:chunk])
+			n += m
+		}
+
+		blocked += d
+		b = b[chunk:]
+	}
+
+	c.w.report(c.eng, n, blocked, time.Since(start))
+	return
+}
+
+type shaper struct {
+	limiter Limiter
+
+	sync.Mutex
+	bytes   int
+	elapsed time.Duration
+	metrics struct {
+		count      int           `metric:"count"                       type:"counter"`
+		blocked    time.Duration `metric:"blocked.seconds"             type:"histogram"`
+		achieved   float64       `metric:"achieved.bytes_per_second"   type:"gauge"`
+		configured float64       `metric:"configured.bytes_per_second" type:"gauge"`
+		direction  string        `tag:"direction"`
+		protocol   string        `tag:"protocol"`
+	} `metric:"conn.shaping"`
+}
+
+func (s *shaper) init(limiter Limiter, bandwidth float64, direction, protocol string) {
+	s.limiter = limiter
+	s.metrics.configured = bandwidth
+	s.metrics.direction = direction
+	s.metrics.protocol = protocol
+}
+
+func (s *shaper) chunk(n int) int {
+	if burst := s.limiter.Burst(); burst > 0 && burst < n {
+		return burst
+	}
+	return n
+}
+
+// wait blocks until the limiter allows transferring n bytes, and returns how
+// long it was blocked.
+func (s *shaper) wait(n int) (time.Duration, error) {
+	start := time.Now()
+
+	for n != 0 {
+		chunk := s.chunk(n)
+		if err := s.limiter.WaitN(context.Background(), chunk); err != nil {
+			return time.Since(start), err
+		}
+		n -= chunk
+	}
+
+	return time.Since(start), nil
+}
+
+func (s *shaper) report(eng *stats.Engine, n int, blocked, elapsed time.Duration) {
+	s.Lock()
+	s.bytes += n
+	s.elapsed += elapsed
+	s.metrics.count = 1
+	s.metrics.blocked = blocked
+	s.metrics.achieved = 0
+	if s.elapsed > 0 {
+		s.metrics.achieved = float64(s.bytes) / s.elapsed.Seconds()
+	}
+	eng.Report(s)
+	s.Unlock()
+}
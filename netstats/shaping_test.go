@@ -0,0 +1,87 @@
+package netstats
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestShapedConn(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+	h := &statstest.Handler{}
+	e := stats.NewEngine("netstats.test", h)
+
+	limiter := &testLimiter{burst: 5, delay: 2 * time.Millisecond}
+
+	c := &testConn{}
+	conn := NewShapedConnWith(e, c, ShapingConfig{
+		WriteLimiter:   limiter,
+		WriteBandwidth: 1000,
+	})
+
+	if n, err := conn.Write([]byte("Hello World!")); n != 12 || err != nil {
+		t.Fatalf("bad write: n=%d err=%v", n, err)
+	}
+
+	// Reads are not throttled without a limiter.
+	if n, err := conn.Read(make([]byte, 32)); n != 12 || err != nil {
+		t.Fatalf("bad read: n=%d err=%v", n, err)
+	}
+
+	if waits := limiter.waits; len(waits) != 3 || waits[0] != 5 || waits[1] != 5 || waits[2] != 2 {
+		t.Error("writes were not split in chunks of the burst size:", waits)
+	}
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatalf("expected 1 measure, got %d: %v", len(measures), measures)
+	}
+
+	m := measures[0]
+	if m.Name != "netstats.test.conn.shaping" {
+		t.Error("bad measure name:", m.Name)
+	}
+
+	fields := make(map[string]stats.Value)
+	for _, f := range m.Fields {
+		fields[f.Name] = f.Value
+	}
+
+	if blocked := fields["blocked.seconds"].Duration(); blocked < 6*time.Millisecond {
+		t.Error("bad blocked time:", blocked)
+	}
+	if achieved := fields["achieved.bytes_per_second"].Float(); achieved <= 0 || achieved > 12/0.006 {
+		t.Error("bad achieved bandwidth:", achieved)
+	}
+	if configured := fields["configured.bytes_per_second"].Float(); configured != 1000 {
+		t.Error("bad configured bandwidth:", configured)
+	}
+
+	tags := []stats.Tag{stats.T("direction", "write"), stats.T("protocol", "tcp")}
+	if len(m.Tags) != 2 || m.Tags[0] != tags[0] || m.Tags[1] != tags[1] {
+		t.Error("bad tags:", m.Tags)
+	}
+}
+
+type testLimiter struct {
+	mutex sync.Mutex
+	burst int
+	delay time.Duration
+	waits []int
+}
+
+func (l *testLimiter) WaitN(ctx context.Context, n int) error {
+	l.mutex.Lock()
+	l.waits = append(l.waits, n)
+	l.mutex.Unlock()
+	time.Sleep(l.delay)
+	return nil
+}
+
+func (l *testLimiter) Burst() int { return l.burst }
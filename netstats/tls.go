@@ -0,0 +1,78 @@
+package netstats
+
+import (
+	"context"
+	"crypto/tls"
+	"math"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// latencyBuckets are the histogram buckets of the handshake, dial, and lookup
+// durations, which range from sub-millisecond to multiple seconds.
+var latencyBuckets = []interface{}{
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	5 * time.Second,
+	math.Inf(+1),
+}
+
+func init() {
+	stats.Buckets.Set("tls.handshake:seconds", latencyBuckets...)
+}
+
+// Handshake runs the TLS handshake of c and reports metrics on the default
+// engine, see HandshakeWith.
+func Handshake(ctx context.Context, c *tls.Conn) error {
+	return HandshakeWith(ctx, stats.DefaultEngine, c)
+}
+
+// HandshakeWith runs the TLS handshake of c and reports its duration on eng
+// in the tls.handshake.seconds histogram, tagged with the negotiated protocol
+// version (tls_version), cipher suite (tls_cipher), and application protocol
+// (tls_alpn). Failed handshakes are counted in tls.handshake.error.count
+// instead.
+//
+// Connections negotiate TLS on their first read or write when the handshake
+// was not run explicitly, programs have to call this function right after
+// creating TLS connections to measure it.
+func HandshakeWith(ctx context.Context, eng *stats.Engine, c *tls.Conn) error {
+	if c.ConnectionState().HandshakeComplete {
+		return nil
+	}
+
+	start := time.Now()
+
+	if err := c.HandshakeContext(ctx); err != nil {
+		eng.Incr("tls.handshake.error.count")
+		return err
+	}
+
+	state := c.ConnectionState()
+	eng.Observe("tls.handshake.seconds", time.Since(start),
+		stats.T("tls_version", tlsVersion(state.Version)),
+		stats.T("tls_cipher", tls.CipherSuiteName(state.CipherSuite)),
+		stats.T("tls_alpn", state.NegotiatedProtocol),
+	)
+	return nil
+}
+
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+	return "unknown"
+}
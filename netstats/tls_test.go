@@ -0,0 +1,113 @@
+package netstats
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestDialerTLS(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	h := &statstest.Handler{}
+	d := &Dialer{
+		TLSConfig: server.Client().Transport.(*http.Transport).TLSClientConfig,
+		Config:    Config{Engine: stats.NewEngine("netstats.test", h)},
+	}
+
+	c, err := d.DialTLSContext(context.Background(), "tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	var dial, handshake *stats.Measure
+	for _, m := range h.Measures() {
+		m := m
+		switch m.Name {
+		case "netstats.test.conn.dial":
+			dial = &m
+		case "netstats.test.tls.handshake":
+			handshake = &m
+		}
+	}
+
+	if dial == nil {
+		t.Fatal("missing conn.dial measure")
+	}
+	if dial.Fields[0].Name != "seconds" || dial.Fields[0].Type() != stats.Histogram {
+		t.Error("bad conn.dial field:", dial.Fields[0])
+	}
+
+	if handshake == nil {
+		t.Fatal("missing tls.handshake measure")
+	}
+	tags := map[string]string{}
+	for _, tag := range handshake.Tags {
+		tags[tag.Name] = tag.Value
+	}
+	if tags["tls_version"] != "1.3" {
+		t.Error("bad tls_version tag:", tags["tls_version"])
+	}
+	if tags["tls_cipher"] == "" {
+		t.Error("missing tls_cipher tag")
+	}
+}
+
+func TestHandshakeError(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	c, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("netstats.test", h)
+
+	// The server certificate is not trusted by the default configuration.
+	tc := tls.Client(c, &tls.Config{ServerName: "example.com"})
+	if err := HandshakeWith(context.Background(), e, tc); err == nil {
+		t.Fatal("expected a handshake error")
+	}
+
+	measures := h.Measures()
+	if len(measures) != 1 || measures[0].Name != "netstats.test.tls.handshake.error" {
+		t.Fatal("bad measures:", measures)
+	}
+}
+
+func TestTLSVersion(t *testing.T) {
+	for version, name := range map[uint16]string{
+		tls.VersionTLS10: "1.0",
+		tls.VersionTLS11: "1.1",
+		tls.VersionTLS12: "1.2",
+		tls.VersionTLS13: "1.3",
+		0:                "unknown",
+	} {
+		if s := tlsVersion(version); s != name {
+			t.Errorf("tlsVersion(%#x): %q != %q", version, s, name)
+		}
+	}
+}
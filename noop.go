@@ -0,0 +1,8 @@
+//go:build stats_noop
+
+package stats
+
+// noop is true when the program is compiled with the stats_noop build tag, in
+// which case the engine methods producing measures become no-ops that the
+// compiler can eliminate entirely.
+const noop = true
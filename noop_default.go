@@ -0,0 +1,7 @@
+//go:build !stats_noop
+
+package stats
+
+// noop is false in the default build, the engine methods produce measures and
+// pass them to the handlers.
+const noop = false
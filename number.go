@@ -0,0 +1,69 @@
+package stats
+
+import "time"
+
+// Number is the set of numeric types, and the types derived from them, which
+// can be reported with NumberValue and ObserveNumber.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// NumberValue returns the Value of v, without the intermediate conversion to
+// an interface of ValueOf.
+//
+// Integers are reported as integers, so their precision is preserved, and
+// time.Duration values are reported as durations. Other types derived from
+// numeric types, like a type counting bytes, are reported as the numeric type
+// they are derived from.
+func NumberValue[T Number](v T) Value {
+	var zero T
+
+	// Zero values are converted to interfaces without allocating.
+	if _, ok := any(zero).(time.Duration); ok {
+		return durationValue(time.Duration(v))
+	}
+
+	switch one := T(1); {
+	case one/2 != 0:
+		return float64Value(float64(v))
+	case zero-one > 0:
+		return uint64Value(uint64(v))
+	default:
+		return int64Value(int64(v))
+	}
+}
+
+// ObserveValue reports value for the histogram identified by name and tags.
+//
+// Unlike Observe, the value is not passed as an interface, which avoids an
+// allocation on each call for values that do not fit in a pointer.
+func (e *Engine) ObserveValue(name string, value Value, tags ...Tag) {
+	if noop {
+		return
+	}
+	e.measure(time.Now(), name, value, Histogram, tags...)
+}
+
+// ObserveValue is a helper function that delegates to DefaultEngine.
+func ObserveValue(name string, value Value, tags ...Tag) {
+	DefaultEngine.ObserveValue(name, value, tags...)
+}
+
+// ObserveNumber reports value for the histogram identified by name and tags
+// on the engine e, which is DefaultEngine when nil. The value is converted
+// by NumberValue.
+//
+// Methods cannot have type parameters, which is why the engine is passed as
+// an argument, for example:
+//
+//	type Bytes uint64
+//
+//	stats.ObserveNumber(eng, "upload.size", Bytes(n))
+func ObserveNumber[T Number](e *Engine, name string, value T, tags ...Tag) {
+	if e == nil {
+		e = DefaultEngine
+	}
+	e.ObserveValue(name, NumberValue(value), tags...)
+}
@@ -0,0 +1,87 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+type byteCount uint32
+
+type celsius float32
+
+type latency time.Duration
+
+func TestNumberValue(t *testing.T) {
+	tests := []struct {
+		value stats.Value
+		typ   stats.Type
+	}{
+		{value: stats.NumberValue(-42), typ: stats.Int},
+		{value: stats.NumberValue(int8(-1)), typ: stats.Int},
+		{value: stats.NumberValue(uint64(1) << 63), typ: stats.Uint},
+		{value: stats.NumberValue(byteCount(1024)), typ: stats.Uint},
+		{value: stats.NumberValue(celsius(21.5)), typ: stats.Float},
+		{value: stats.NumberValue(2.5), typ: stats.Float},
+		{value: stats.NumberValue(time.Second), typ: stats.Duration},
+		{value: stats.NumberValue(latency(time.Second)), typ: stats.Int},
+	}
+
+	for _, test := range tests {
+		if typ := test.value.Type(); typ != test.typ {
+			t.Errorf("%v: bad type: %s != %s", test.value, typ, test.typ)
+		}
+	}
+
+	if v := stats.NumberValue(uint64(1) << 63).Uint(); v != 1<<63 {
+		t.Errorf("bad uint value: %d", v)
+	}
+	if v := stats.NumberValue(int64(-1) << 62).Int(); v != -1<<62 {
+		t.Errorf("bad int value: %d", v)
+	}
+	if v := stats.NumberValue(celsius(21.5)).Float(); v != 21.5 {
+		t.Errorf("bad float value: %g", v)
+	}
+}
+
+func TestObserveNumber(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+
+	stats.ObserveNumber(e, "upload.size", byteCount(1024), stats.T("a", "b"))
+	stats.ObserveNumber(e, "upload.time", 3*time.Millisecond)
+
+	measures := h.Measures()
+	if len(measures) != 2 {
+		t.Fatalf("bad number of measures: %d", len(measures))
+	}
+
+	if f := measures[0].Fields[0]; f.Name != "size" || f.Type() != stats.Histogram || f.Value.Uint() != 1024 {
+		t.Errorf("bad field: %v", f)
+	}
+	if f := measures[1].Fields[0]; f.Name != "time" || f.Value.Duration() != 3*time.Millisecond {
+		t.Errorf("bad field: %v", f)
+	}
+}
+
+func TestObserveNumberAllocs(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	e := stats.NewEngine("test", stats.Discard)
+	e.Observe("value", 0) // intern the measure name
+
+	allocs := testing.AllocsPerRun(100, func() {
+		stats.ObserveNumber(e, "value", byteCount(1<<20))
+	})
+	if allocs != 0 {
+		t.Errorf("ObserveNumber allocated %g times", allocs)
+	}
+}
@@ -5,13 +5,18 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/protobuf/proto"
 )
 
+// Client is the interface implemented by the transports exporting metrics to
+// an OpenTelemetry destination, see HTTPClient and GRPCClient.
 type Client interface {
 	Handle(context.Context, *colmetricpb.ExportMetricsServiceRequest) error
 }
@@ -19,8 +24,9 @@ type Client interface {
 // HTTPClient implements the Client interface and is used to export metrics to
 // an OpenTelemetry Collector through the HTTP interface.
 //
-// The current implementation is a fire and forget approach where we do not retry
-// or buffer any failed-to-flush data on the client.
+// Requests failing with the 429, 502, 503, or 504 status codes, or with
+// transport errors, return a *RetryableError carrying the delay requested by
+// the Retry-After header of the response; the Handler retries them.
 type HTTPClient struct {
 	client   *http.Client
 	endpoint string
@@ -48,13 +54,13 @@ func (c *HTTPClient) Handle(ctx context.Context, request *colmetricpb.ExportMetr
 	return c.do(httpReq)
 }
 
-// TODO: deal with requests failures and retries. We potentially want to implement
-//
-//	some kind of retry mechanism with expotential backoff + short time window.
 func (c *HTTPClient) do(req *http.Request) error {
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return err
+		if req.Context().Err() != nil {
+			return err
+		}
+		return &RetryableError{Err: err}
 	}
 	defer resp.Body.Close()
 
@@ -64,13 +70,68 @@ func (c *HTTPClient) do(req *http.Request) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to send data to collector, code: %d, error: %s",
-			resp.StatusCode,
-			string(msg),
-		)
+		return httpError(resp, msg, time.Now())
 	}
 
-	return nil
+	return partialSuccessOf(resp.Header.Get("Content-Type"), msg)
+}
+
+// PartialSuccessError is returned by clients when the collector accepted a
+// request but rejected some of its data points.
+type PartialSuccessError struct {
+	// RejectedDataPoints is the number of data points rejected by the
+	// collector.
+	RejectedDataPoints int64
+
+	// Message is the explanation sent by the collector, it may be empty.
+	Message string
+}
+
+// Error satisfies the error interface.
+func (e *PartialSuccessError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("collector rejected %d data points", e.RejectedDataPoints)
+	}
+	return fmt.Sprintf("collector rejected %d data points: %s", e.RejectedDataPoints, e.Message)
+}
+
+// partialSuccessOf decodes the body of a successful export response, and
+// returns a *PartialSuccessError if the collector reported rejected data
+// points.
+func partialSuccessOf(contentType string, body []byte) error {
+	if len(body) == 0 || !strings.HasPrefix(contentType, "application/x-protobuf") {
+		return nil
+	}
+
+	resp := &colmetricpb.ExportMetricsServiceResponse{}
+	if err := proto.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("failed to decode collector response: %s", err)
+	}
+
+	return partialSuccessError(resp)
+}
+
+// partialSuccessError returns a *PartialSuccessError if the collector reported
+// rejected data points in resp.
+func partialSuccessError(resp *colmetricpb.ExportMetricsServiceResponse) error {
+	ps := resp.GetPartialSuccess()
+	if ps == nil {
+		return nil
+	}
+
+	if ps.GetRejectedDataPoints() == 0 {
+		// A message without rejected data points is a warning from the
+		// collector, the request was fully accepted.
+		if msg := ps.GetErrorMessage(); msg != "" {
+			log.Printf("stats/otlp: collector warning: %s", msg)
+		}
+		return nil
+	}
+
+	return &PartialSuccessError{
+		RejectedDataPoints: ps.GetRejectedDataPoints(),
+		Message:            ps.GetErrorMessage(),
+	}
 }
 
 func newRequest(ctx context.Context, endpoint string, data []byte) (*http.Request, error) {
@@ -0,0 +1,55 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// GRPCClient implements the Client interface and is used to export metrics to
+// an OpenTelemetry Collector through the gRPC interface.
+//
+// Exports failing with the status codes that the OTLP specification defines as
+// retryable return a *RetryableError, RESOURCE_EXHAUSTED only when the server
+// sent a RetryInfo detail, whose delay is then honored by the Handler.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client colmetricpb.MetricsServiceClient
+}
+
+// NewGRPCClient returns a client exporting metrics to the collector at target,
+// for example "localhost:4317". When no options are given, the connection is
+// established without transport security, which is what collectors running
+// alongside the program usually expect.
+func NewGRPCClient(target string, opts ...grpc.DialOption) (*GRPCClient, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+
+	return &GRPCClient{
+		conn:   conn,
+		client: colmetricpb.NewMetricsServiceClient(conn),
+	}, nil
+}
+
+// Handle satisfies the Client interface.
+func (c *GRPCClient) Handle(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	resp, err := c.client.Export(ctx, request)
+	if err != nil {
+		return grpcError(err)
+	}
+	return partialSuccessError(resp)
+}
+
+// Close closes the connection to the collector.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
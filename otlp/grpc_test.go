@@ -0,0 +1,76 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/segmentio/stats/v5"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+type metricsServer struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	requests chan *colmetricpb.ExportMetricsServiceRequest
+	response *colmetricpb.ExportMetricsServiceResponse
+}
+
+func (s *metricsServer) Export(_ context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	s.requests <- req
+	return s.response, nil
+}
+
+func TestGRPCClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &metricsServer{
+		requests: make(chan *colmetricpb.ExportMetricsServiceRequest, 1),
+		response: &colmetricpb.ExportMetricsServiceResponse{},
+	}
+	s := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(s, srv)
+	go s.Serve(l)
+	defer s.Stop()
+
+	h, err := NewGRPCHandler(context.Background(), l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Client.(*GRPCClient).Close()
+	h.FlushInterval = 0
+	h.Resource = []stats.Tag{stats.T("service.name", "test")}
+
+	h.HandleMeasures(now, handleTests[0].in...)
+
+	if err := h.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-srv.requests
+	rm := req.GetResourceMetrics()
+	if len(rm) != 1 {
+		t.Fatalf("expected one resource, got %d", len(rm))
+	}
+	if attrs := rm[0].GetResource().GetAttributes(); len(attrs) != 1 || attrs[0].GetKey() != "service.name" || attrs[0].GetValue().GetStringValue() != "test" {
+		t.Errorf("bad resource attributes: %v", attrs)
+	}
+	if metrics := rm[0].GetScopeMetrics()[0].GetMetrics(); len(metrics) != 1 || metrics[0].GetName() != "foobar.count" {
+		t.Errorf("bad metrics: %v", metrics)
+	}
+
+	srv.response = &colmetricpb.ExportMetricsServiceResponse{
+		PartialSuccess: &colmetricpb.ExportMetricsPartialSuccess{RejectedDataPoints: 1},
+	}
+	h.HandleMeasures(now, handleTests[0].in...)
+
+	var partial *PartialSuccessError
+	if err := h.flush(); !errors.As(err, &partial) || partial.RejectedDataPoints != 1 {
+		t.Errorf("expected a partial success error, got %v", err)
+	}
+	<-srv.requests
+}
@@ -3,6 +3,7 @@ package otlp
 import (
 	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"hash/maphash"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"github.com/segmentio/stats/v5"
 	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
 )
 
 const (
@@ -25,30 +27,122 @@ const (
 	// Metrics will be flushed to the destination when DefaultFlushInterval or
 	// DefaultMaxMetrics are reached, whichever comes first.
 	DefaultFlushInterval = 10 * time.Second
+
+	// DefaultMaxBatchSize is the default maximum number of metrics sent to
+	// the OpenTelemetry destination in a single export request.
+	DefaultMaxBatchSize = 1000
+
+	// MaxRejectedRetries is the number of times that a partially rejected
+	// request is exported again with the RetryRejected policy, after which
+	// the rejected data points are dropped.
+	MaxRejectedRetries = 3
+)
+
+// Temporality defines how the Handler exports the values of counters and
+// histograms.
+type Temporality int
+
+const (
+	// Cumulative exports the values accumulated since the handler first saw
+	// the metrics, this is what Prometheus based backends expect. This is
+	// the default temporality.
+	Cumulative Temporality = iota
+
+	// Delta exports the values accumulated since the previous export, which
+	// is what backends like Datadog or New Relic prefer.
+	Delta
+)
+
+// PartialSuccessPolicy defines how the Handler deals with data points rejected
+// by the collector in a partial success response.
+type PartialSuccessPolicy int
+
+const (
+	// DropRejected drops rejected data points, they are only accounted for
+	// in the handler's self-metrics. This is the default policy.
+	DropRejected PartialSuccessPolicy = iota
+
+	// RetryRejected re-enqueues the metrics of a partially accepted request
+	// so they are exported again on the next flush, up to MaxRejectedRetries
+	// times.
+	//
+	// Partial success responses do not say which data points were rejected,
+	// so the whole batch is sent again. With cumulative temporality the
+	// backend overwrites the accepted data points with the same values. With
+	// delta temporality the accepted data points would be counted twice, so
+	// the policy behaves like DropRejected.
+	RetryRejected
 )
 
+// String returns the name of the policy, it is used to tag self-metrics.
+func (p PartialSuccessPolicy) String() string {
+	switch p {
+	case DropRejected:
+		return "drop"
+	case RetryRejected:
+		return "retry"
+	default:
+		return "unknown"
+	}
+}
+
 // Status: Alpha. This Handler is still in heavy development phase. Do not use
 // in production.
 //
 // Handler implements stats.Handler to forward metrics to an OpenTelemetry
 // destination. Usually an OpenTelemetry Collector.
 //
-// With the current implementation this Handler is targeting a Prometheus
-// based backend or any backend expecting cumulative values.
+// Metrics are exported by Client, use NewHandler for OTLP/HTTP or
+// NewGRPCHandler for OTLP/gRPC. Counters and histograms are exported with
+// cumulative values by default (targeting Prometheus based backends), set
+// Temporality to Delta for backends expecting delta values. Export requests
+// carry up to MaxBatchSize metrics and the Resource attributes, which
+// identify the program producing the metrics (for example service.name).
 //
 // This Handler leverages a doubly linked list with a map to implement
 // a ring buffer with a lookup to ensure a low memory usage.
+//
+// Export requests wait in a queue of up to QueueSize requests until they are
+// sent to the collector by a background goroutine. Requests failing with
+// transient errors are retried with an exponential backoff, honoring the
+// throttling hints of the collector, see RetryConfig. Retries never block the
+// goroutines producing metrics, and Flush waits for the export of the queued
+// requests for at most FlushInterval (DefaultFlushInterval if zero), the
+// requests which are still being retried then are exported in the background.
+//
+// The Handler reports its own activity to Engine (or stats.DefaultEngine if
+// nil) under the "otlp.export" namespace: the number of export requests
+// tagged by result, the number of retries, the number of data points rejected
+// by the collector tagged by the policy applied to them, and the number of
+// data points dropped tagged by reason (queue_full or export_failed).
 type Handler struct {
-	Client        Client
-	Context       context.Context
-	FlushInterval time.Duration
-	MaxMetrics    int
+	Client         Client
+	Context        context.Context
+	FlushInterval  time.Duration
+	MaxMetrics     int
+	PartialSuccess PartialSuccessPolicy
+	Engine         *stats.Engine
+	Resource       []stats.Tag
+	Temporality    Temporality
+	MaxBatchSize   int
+	Retry          RetryConfig
+	QueueSize      int
 
 	once sync.Once
 
 	mu      sync.RWMutex
 	ordered list.List
 	metrics map[uint64]*list.Element
+
+	sending  sync.Mutex
+	qmu      sync.Mutex
+	queue    []*exportRequest
+	rejected []*exportRequest
+
+	exporter sync.Once
+	wake     chan struct{}
+	flushes  chan chan error
+	exited   chan struct{}
 }
 
 var hashseed = maphash.MakeSeed()
@@ -64,7 +158,24 @@ func NewHandler(ctx context.Context, endpoint string) *Handler {
 	}
 }
 
-func (h *Handler) HandlerMeasure(t time.Time, measures ...stats.Measure) {
+// NewGRPCHandler returns an instance of Handler exporting metrics to the
+// collector at target over gRPC, with the default flush interval and
+// in-memory metrics limit.
+func NewGRPCHandler(ctx context.Context, target string) (*Handler, error) {
+	c, err := NewGRPCClient(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		Client:        c,
+		Context:       ctx,
+		FlushInterval: DefaultFlushInterval,
+		MaxMetrics:    DefaultMaxMetrics,
+	}, nil
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(t time.Time, measures ...stats.Measure) {
 	h.once.Do(func() {
 		if h.FlushInterval == 0 {
 			return
@@ -76,10 +187,26 @@ func (h *Handler) HandlerMeasure(t time.Time, measures ...stats.Measure) {
 	h.handleMeasures(t, measures...)
 }
 
+// HandlerMeasure is an alias of HandleMeasures.
+//
+// Deprecated: use HandleMeasures.
+func (h *Handler) HandlerMeasure(t time.Time, measures ...stats.Measure) {
+	h.HandleMeasures(t, measures...)
+}
+
+// Flush satisfies the stats.Flusher interface, it exports the metrics which
+// were updated since the previous export.
+func (h *Handler) Flush() {
+	if err := h.flush(); err != nil {
+		log.Printf("stats/otlp: %s", err)
+	}
+}
+
 func (h *Handler) start(ctx context.Context) {
 	defer h.flush()
 
 	t := time.NewTicker(h.FlushInterval)
+	defer t.Stop()
 
 	for {
 		select {
@@ -88,7 +215,7 @@ func (h *Handler) start(ctx context.Context) {
 				log.Printf("stats/otlp: %s", err)
 			}
 		case <-ctx.Done():
-			break
+			return
 		}
 	}
 }
@@ -98,14 +225,19 @@ func (h *Handler) handleMeasures(t time.Time, measures ...stats.Measure) {
 		for _, field := range measure.Fields {
 			m := metric{
 				time:        t,
+				start:       t,
 				measureName: measure.Name,
 				fieldName:   field.Name,
 				fieldType:   field.Type(),
-				tags:        measure.Tags,
-				value:       field.Value,
+				// the measures may be reused by the caller after the handler
+				// returns, the tags must be copied
+				tags:  append([]stats.Tag(nil), measure.Tags...),
+				value: field.Value,
 			}
 
-			if field.Type() == stats.Histogram {
+			// Distributions are aggregated like histograms, OTLP has no other
+			// representation for them.
+			if t := field.Type(); t == stats.Histogram || t == stats.Distribution {
 				k := stats.Key{Measure: measure.Name, Field: field.Name}
 				m.sum = valueOf(m.value)
 				m.buckets = makeMetricBuckets(stats.Buckets[k])
@@ -117,10 +249,15 @@ func (h *Handler) handleMeasures(t time.Time, measures ...stats.Measure) {
 			m.sign = sign
 
 			known := h.lookup(sign, func(a *metric) *metric {
+				a.time = m.time
+				a.flushed = false
+
 				switch a.fieldType {
 				case stats.Counter:
 					a.value = a.add(m.value)
-				case stats.Histogram:
+				case stats.Gauge:
+					a.value = m.value
+				case stats.Histogram, stats.Distribution:
 					a.sum += valueOf(m.value)
 					a.count++
 					for i := range a.buckets {
@@ -131,52 +268,323 @@ func (h *Handler) handleMeasures(t time.Time, measures ...stats.Measure) {
 			})
 
 			if known == nil {
-				n := h.push(sign, &m)
-				if n > h.MaxMetrics {
-					if err := h.flush(); err != nil {
-						log.Printf("stats/otlp: %s", err)
-					}
+				// push evicts the least recently updated metric when the
+				// limit is exceeded, so the export is triggered as soon as
+				// the limit is reached. The export happens in the
+				// background, producers of metrics must not wait for the
+				// collector.
+				if n := h.push(sign, &m); n >= h.maxMetrics() {
+					h.enqueue(h.snapshot())
+					h.wakeExporter()
 				}
 			}
 		}
 	}
 }
 
+// flush enqueues the metrics updated since the previous export and waits for
+// the background goroutine to export the queue, for at most the flush
+// interval. The requests are exported by the calling goroutine once the
+// context of the handler is canceled, which happens when the handler flushes
+// its metrics before stopping.
 func (h *Handler) flush() error {
+	h.enqueue(h.snapshot())
+	h.startExporter()
+
+	timeout := h.FlushInterval
+	if timeout <= 0 {
+		timeout = DefaultFlushInterval
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	done := make(chan error, 1)
+	select {
+	case h.flushes <- done:
+	case <-h.exited:
+		return h.drain(h.context())
+	case <-timer.C:
+		return errFlushTimeout
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errFlushTimeout
+	}
+}
+
+var errFlushTimeout = errors.New("timed out waiting for metrics to be exported, the export continues in the background")
+
+func (h *Handler) startExporter() {
+	h.exporter.Do(func() {
+		h.wake = make(chan struct{}, 1)
+		h.flushes = make(chan chan error)
+		h.exited = make(chan struct{})
+		go h.export(h.context())
+	})
+}
+
+func (h *Handler) wakeExporter() {
+	h.startExporter()
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// export runs in the background goroutine of the handler, it drains the queue
+// of export requests when metrics are enqueued, until ctx is canceled.
+func (h *Handler) export(ctx context.Context) {
+	defer close(h.exited)
+
+	for {
+		select {
+		case <-h.wake:
+			if err := h.drain(ctx); err != nil {
+				log.Printf("stats/otlp: %s", err)
+			}
+		case done := <-h.flushes:
+			done <- h.drain(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// exportRequest is an export request waiting in the queue of the handler.
+type exportRequest struct {
+	request  *colmetricpb.ExportMetricsServiceRequest
+	points   int
+	attempts int // exports of the request which were partially rejected
+}
+
+// snapshot converts the metrics that were not flushed yet to export requests
+// of up to MaxBatchSize metrics. Metrics exported with delta temporality start
+// a new aggregation interval, the values captured in the requests are not lost
+// if the export fails since the requests are retried.
+func (h *Handler) snapshot() []*exportRequest {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	metrics := []*metricpb.Metric{}
+	batch := []*metric{}
 
 	for e := h.ordered.Front(); e != nil; e = e.Next() {
 		m := e.Value.(*metric)
 		if m.flushed {
 			continue
 		}
-		metrics = append(metrics, convertMetrics(*m)...)
+		batch = append(batch, m)
 		m.flushed = true
 	}
 
-	if len(metrics) == 0 {
-		return nil
+	size := h.MaxBatchSize
+	if size <= 0 {
+		size = DefaultMaxBatchSize
+	}
+
+	now := time.Now()
+	requests := []*exportRequest{}
+
+	for len(batch) != 0 {
+		n := size
+		if n > len(batch) {
+			n = len(batch)
+		}
+
+		requests = append(requests, h.newExportRequest(batch[:n]))
+		h.reset(batch[:n], now)
+		batch = batch[n:]
+	}
+
+	return requests
+}
+
+func (h *Handler) newExportRequest(batch []*metric) *exportRequest {
+	metrics := make([]*metricpb.Metric, 0, len(batch))
+
+	for _, m := range batch {
+		metrics = append(metrics, convertMetrics(h.Temporality, *m)...)
 	}
 
-	// FIXME how big can a metrics service request be ? need pagination ?
-	request := &colmetricpb.ExportMetricsServiceRequest{
-		ResourceMetrics: []*metricpb.ResourceMetrics{
-			{
-				ScopeMetrics: []*metricpb.ScopeMetrics{
-					{Metrics: metrics},
+	return &exportRequest{
+		request: &colmetricpb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricpb.ResourceMetrics{
+				{
+					Resource: &resourcepb.Resource{
+						Attributes: tagsToAttributes(h.Resource...),
+					},
+					ScopeMetrics: []*metricpb.ScopeMetrics{
+						{Metrics: metrics},
+					},
 				},
 			},
 		},
+		points: len(metrics),
 	}
+}
 
-	if err := h.Client.Handle(h.Context, request); err != nil {
-		return fmt.Errorf("failed to flush measures: %s", err)
+// enqueue appends requests to the queue of requests waiting to be exported,
+// after the requests rejected by the previous exports. Requests which do not
+// fit in the queue are dropped.
+func (h *Handler) enqueue(requests []*exportRequest) {
+	dropped := 0
+
+	h.qmu.Lock()
+	if len(h.rejected) != 0 {
+		requests = append(h.rejected, requests...)
+		h.rejected = nil
+	}
+	for _, r := range requests {
+		if len(h.queue) < h.queueSize() {
+			h.queue = append(h.queue, r)
+		} else {
+			dropped += r.points
+		}
 	}
+	h.qmu.Unlock()
 
-	return nil
+	if dropped != 0 {
+		h.engine().Add("otlp.export.dropped_data_points.count", dropped,
+			stats.T("reason", "queue_full"),
+		)
+	}
+}
+
+func (h *Handler) dequeue() *exportRequest {
+	h.qmu.Lock()
+	defer h.qmu.Unlock()
+
+	if len(h.queue) == 0 {
+		return nil
+	}
+
+	r := h.queue[0]
+	h.queue[0] = nil
+	h.queue = h.queue[1:]
+	return r
+}
+
+func (h *Handler) queueLen() int {
+	h.qmu.Lock()
+	defer h.qmu.Unlock()
+	return len(h.queue)
+}
+
+// drain exports the queued requests one at a time, it returns immediately if
+// another goroutine is already draining the queue. The error is the first one
+// returned by the client, retries are bounded by ctx.
+func (h *Handler) drain(ctx context.Context) (err error) {
+	for h.queueLen() != 0 {
+		if !h.sending.TryLock() {
+			return err
+		}
+
+		for r := h.dequeue(); r != nil; r = h.dequeue() {
+			if e := h.send(ctx, r); e != nil && err == nil {
+				err = e
+			}
+		}
+
+		h.sending.Unlock()
+	}
+	return err
+}
+
+// send exports r, retrying transient errors as configured by the Retry field,
+// and reports the outcome in the handler's self-metrics. The handler is not
+// locked while the request is sent, since the engine may route the
+// self-metrics back to this handler.
+func (h *Handler) send(ctx context.Context, r *exportRequest) error {
+	eng := h.engine()
+
+	retries, err := retry(ctx, h.Retry, func() error {
+		return h.Client.Handle(ctx, r.request)
+	})
+
+	if retries != 0 {
+		eng.Add("otlp.export.retries.count", retries)
+	}
+
+	var partial *PartialSuccessError
+	switch {
+	case err == nil:
+		eng.Incr("otlp.export.requests.count", stats.T("result", "success"))
+		return nil
+
+	case errors.As(err, &partial):
+		policy := h.partialSuccess()
+		if r.attempts++; r.attempts > MaxRejectedRetries {
+			policy = DropRejected
+		}
+		eng.Incr("otlp.export.requests.count", stats.T("result", "partial"))
+		eng.Add("otlp.export.rejected_data_points.count", partial.RejectedDataPoints,
+			stats.T("policy", policy.String()),
+		)
+		if policy == RetryRejected {
+			h.qmu.Lock()
+			h.rejected = append(h.rejected, r)
+			h.qmu.Unlock()
+		}
+		return fmt.Errorf("failed to flush measures: %w", err)
+
+	default:
+		eng.Incr("otlp.export.requests.count", stats.T("result", "error"))
+		eng.Add("otlp.export.dropped_data_points.count", r.points,
+			stats.T("reason", "export_failed"),
+		)
+		return fmt.Errorf("failed to flush measures: %w", err)
+	}
+}
+
+// reset starts a new aggregation interval for the metrics in batch when the
+// handler exports delta values.
+func (h *Handler) reset(batch []*metric, now time.Time) {
+	if h.Temporality != Delta {
+		return
+	}
+	for _, m := range batch {
+		m.reset(now)
+	}
+}
+
+// partialSuccess returns the policy applied to partially rejected requests,
+// rejected requests are never retried with delta temporality since the data
+// points accepted by the collector would be counted twice.
+func (h *Handler) partialSuccess() PartialSuccessPolicy {
+	if h.Temporality == Delta {
+		return DropRejected
+	}
+	return h.PartialSuccess
+}
+
+func (h *Handler) queueSize() int {
+	if h.QueueSize > 0 {
+		return h.QueueSize
+	}
+	return DefaultQueueSize
+}
+
+func (h *Handler) context() context.Context {
+	if h.Context != nil {
+		return h.Context
+	}
+	return context.Background()
+}
+
+func (h *Handler) maxMetrics() int {
+	if h.MaxMetrics > 0 {
+		return h.MaxMetrics
+	}
+	return DefaultMaxMetrics
+}
+
+func (h *Handler) engine() *stats.Engine {
+	if h.Engine != nil {
+		return h.Engine
+	}
+	return stats.DefaultEngine
 }
 
 func (h *Handler) lookup(signature uint64, update func(*metric) *metric) *metric {
@@ -203,7 +611,7 @@ func (h *Handler) push(sign uint64, m *metric) int {
 	element := h.ordered.PushFront(m)
 	h.metrics[sign] = element
 
-	if len(h.metrics) > h.MaxMetrics {
+	if len(h.metrics) > h.maxMetrics() {
 		last := h.ordered.Back()
 		h.ordered.Remove(last)
 		delete(h.metrics, last.Value.(*metric).sign)
@@ -6,10 +6,20 @@ import (
 	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
 )
 
-func convertMetrics(metrics ...metric) []*metricpb.Metric {
+func convertMetrics(temporality Temporality, metrics ...metric) []*metricpb.Metric {
 	mm := []*metricpb.Metric{}
 
+	aggregation := metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	if temporality == Delta {
+		aggregation = metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	}
+
 	for _, metric := range metrics {
+		var start uint64
+		if temporality == Delta {
+			start = uint64(metric.start.UnixNano())
+		}
+
 		attributes := tagsToAttributes(metric.tags...)
 
 		m := &metricpb.Metric{
@@ -21,7 +31,7 @@ func convertMetrics(metrics ...metric) []*metricpb.Metric {
 			if m.Data == nil {
 				m.Data = &metricpb.Metric_Sum{
 					Sum: &metricpb.Sum{
-						AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						AggregationTemporality: aggregation,
 						DataPoints:             []*metricpb.NumberDataPoint{},
 					},
 				}
@@ -29,9 +39,10 @@ func convertMetrics(metrics ...metric) []*metricpb.Metric {
 
 			sum := m.GetSum()
 			sum.DataPoints = append(sum.DataPoints, &metricpb.NumberDataPoint{
-				TimeUnixNano: uint64(metric.time.UnixNano()),
-				Value:        &metricpb.NumberDataPoint_AsDouble{AsDouble: valueOf(metric.value)},
-				Attributes:   attributes,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      uint64(metric.time.UnixNano()),
+				Value:             &metricpb.NumberDataPoint_AsDouble{AsDouble: valueOf(metric.value)},
+				Attributes:        attributes,
 			})
 		case stats.Gauge:
 			if m.Data == nil {
@@ -48,11 +59,11 @@ func convertMetrics(metrics ...metric) []*metricpb.Metric {
 				Value:        &metricpb.NumberDataPoint_AsDouble{AsDouble: valueOf(metric.value)},
 				Attributes:   attributes,
 			})
-		case stats.Histogram:
+		case stats.Histogram, stats.Distribution:
 			if m.Data == nil {
 				m.Data = &metricpb.Metric_Histogram{
 					Histogram: &metricpb.Histogram{
-						AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						AggregationTemporality: aggregation,
 						DataPoints:             []*metricpb.HistogramDataPoint{},
 					},
 				}
@@ -68,11 +79,12 @@ func convertMetrics(metrics ...metric) []*metricpb.Metric {
 
 			histogram := m.GetHistogram()
 			histogram.DataPoints = append(histogram.DataPoints, &metricpb.HistogramDataPoint{
-				TimeUnixNano:   uint64(metric.time.UnixNano()),
-				Sum:            &metric.sum,
-				Count:          metric.count,
-				ExplicitBounds: explicitBounds,
-				BucketCounts:   bucketCounts,
+				StartTimeUnixNano: start,
+				TimeUnixNano:      uint64(metric.time.UnixNano()),
+				Sum:               &metric.sum,
+				Count:             metric.count,
+				ExplicitBounds:    explicitBounds,
+				BucketCounts:      bucketCounts,
 			})
 
 		default:
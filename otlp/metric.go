@@ -14,6 +14,7 @@ type metric struct {
 	fieldType   stats.FieldType
 	flushed     bool
 	time        time.Time
+	start       time.Time
 	value       stats.Value
 	sum         float64
 	sign        uint64
@@ -51,6 +52,29 @@ func (m *metric) add(v stats.Value) stats.Value {
 	return v
 }
 
+// reset clears the values accumulated by counters and histograms, starting a
+// new aggregation interval at t.
+func (m *metric) reset(t time.Time) {
+	m.start = t
+
+	switch m.fieldType {
+	case stats.Counter:
+		switch m.value.Type() {
+		case stats.Int:
+			m.value = stats.ValueOf(int64(0))
+		case stats.Uint:
+			m.value = stats.ValueOf(uint64(0))
+		default:
+			m.value = stats.ValueOf(0.0)
+		}
+	case stats.Histogram, stats.Distribution:
+		m.sum, m.count = 0, 0
+		for i := range m.buckets {
+			m.buckets[i].count = 0
+		}
+	}
+}
+
 type bucket struct {
 	count      uint64
 	upperBound float64
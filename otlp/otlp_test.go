@@ -2,16 +2,20 @@ package otlp
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
 	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 type testCase struct {
@@ -85,6 +89,37 @@ var (
 				},
 			},
 		},
+		{
+			in: []stats.Measure{
+				{
+					Name: "foobar",
+					Fields: []stats.Field{
+						stats.MakeField("dist", 5, stats.Distribution),
+						stats.MakeField("dist", 50, stats.Distribution),
+					},
+					Tags: []stats.Tag{{Name: "region", Value: "us-west-2"}},
+				},
+			},
+			out: []*metricpb.Metric{
+				{
+					Name: "foobar.dist",
+					Data: &metricpb.Metric_Histogram{
+						Histogram: &metricpb.Histogram{
+							AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*metricpb.HistogramDataPoint{
+								{
+									TimeUnixNano:   uint64(now.UnixNano()),
+									Count:          2,
+									Sum:            sumPtr(55),
+									BucketCounts:   []uint64{0, 1, 1, 0},
+									ExplicitBounds: []float64{0, 10, 100, 1000},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			in: []stats.Measure{
 				{
@@ -128,6 +163,12 @@ func initTest() {
 		100,
 		1000,
 	)
+	stats.Buckets.Set("foobar.dist",
+		0,
+		10,
+		100,
+		1000,
+	)
 }
 
 func TestHandler(t *testing.T) {
@@ -205,3 +246,244 @@ func TestSendOtel(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestHTTPClientPartialSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := proto.Marshal(&colmetricpb.ExportMetricsServiceResponse{
+			PartialSuccess: &colmetricpb.ExportMetricsPartialSuccess{
+				RejectedDataPoints: 2,
+				ErrorMessage:       "invalid attribute",
+			},
+		})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(b)
+	}))
+	defer server.Close()
+
+	c := NewHTTPClient(server.URL)
+	err := c.Handle(context.Background(), &colmetricpb.ExportMetricsServiceRequest{})
+
+	var partial *PartialSuccessError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a partial success error, got %v", err)
+	}
+
+	if partial.RejectedDataPoints != 2 || partial.Message != "invalid attribute" {
+		t.Errorf("unexpected partial success: %+v", partial)
+	}
+}
+
+type partialClient struct {
+	calls    int
+	rejected int64
+}
+
+func (c *partialClient) Handle(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	c.calls++
+	if c.rejected != 0 {
+		return &PartialSuccessError{RejectedDataPoints: c.rejected}
+	}
+	return nil
+}
+
+func TestHandlerPartialSuccess(t *testing.T) {
+	for _, policy := range []PartialSuccessPolicy{DropRejected, RetryRejected} {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := &partialClient{rejected: 1}
+			e := &statstest.Handler{}
+			h := Handler{
+				Client:         c,
+				Context:        context.Background(),
+				MaxMetrics:     DefaultMaxMetrics,
+				PartialSuccess: policy,
+				Engine:         stats.NewEngine("", e),
+			}
+
+			h.handleMeasures(now, handleTests[0].in...)
+
+			if err := h.flush(); err == nil {
+				t.Error("expected an error on partial success")
+			}
+
+			c.rejected = 0
+			if err := h.flush(); err != nil {
+				t.Error(err)
+			}
+
+			calls := 1
+			if policy == RetryRejected {
+				calls = 2
+			}
+			if c.calls != calls {
+				t.Errorf("expected %d export requests, got %d", calls, c.calls)
+			}
+
+			rejected := 0
+			for _, m := range e.Measures() {
+				for _, f := range m.Fields {
+					if m.Name+"."+f.Name != "otlp.export.rejected_data_points.count" {
+						continue
+					}
+					rejected += int(f.Value.Int())
+					if !hasTag(m.Tags, stats.T("policy", policy.String())) {
+						t.Errorf("missing policy tag: %v", m.Tags)
+					}
+				}
+			}
+			if rejected != 1 {
+				t.Errorf("expected 1 rejected data point to be reported, got %d", rejected)
+			}
+		})
+	}
+}
+
+func TestHandlerRetryRejectedLimits(t *testing.T) {
+	for _, test := range []struct {
+		scenario    string
+		temporality Temporality
+		calls       int
+	}{
+		{scenario: "cumulative", temporality: Cumulative, calls: 1 + MaxRejectedRetries},
+		{scenario: "delta", temporality: Delta, calls: 1},
+	} {
+		t.Run(test.scenario, func(t *testing.T) {
+			c := &partialClient{rejected: 1}
+			e := &statstest.Handler{}
+			h := Handler{
+				Client:         c,
+				Context:        context.Background(),
+				PartialSuccess: RetryRejected,
+				Temporality:    test.temporality,
+				Engine:         stats.NewEngine("", e),
+			}
+
+			h.handleMeasures(now, handleTests[0].in...)
+
+			for i := 0; i != 2*MaxRejectedRetries; i++ {
+				h.flush()
+			}
+
+			if c.calls != test.calls {
+				t.Errorf("expected %d export requests, got %d", test.calls, c.calls)
+			}
+		})
+	}
+}
+
+func hasTag(tags []stats.Tag, tag stats.Tag) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var _ stats.Handler = (*Handler)(nil)
+
+type recordingClient struct {
+	requests []*colmetricpb.ExportMetricsServiceRequest
+}
+
+func (c *recordingClient) Handle(ctx context.Context, request *colmetricpb.ExportMetricsServiceRequest) error {
+	c.requests = append(c.requests, request)
+	return nil
+}
+
+func (c *recordingClient) metrics() []*metricpb.Metric {
+	var metrics []*metricpb.Metric
+	for _, r := range c.requests {
+		for _, rm := range r.GetResourceMetrics() {
+			for _, sm := range rm.GetScopeMetrics() {
+				metrics = append(metrics, sm.GetMetrics()...)
+			}
+		}
+	}
+	c.requests = nil
+	return metrics
+}
+
+func TestHandlerTemporality(t *testing.T) {
+	for _, test := range []struct {
+		temporality Temporality
+		aggregation metricpb.AggregationTemporality
+		values      []float64
+	}{
+		{Cumulative, metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, []float64{2, 5}},
+		{Delta, metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, []float64{2, 3}},
+	} {
+		c := &recordingClient{}
+		h := Handler{
+			Client:      c,
+			Context:     context.Background(),
+			Temporality: test.temporality,
+			Engine:      stats.NewEngine("", stats.Discard),
+		}
+
+		counter := func(v int) stats.Measure {
+			return stats.Measure{
+				Name:   "foobar",
+				Fields: []stats.Field{stats.MakeField("count", v, stats.Counter)},
+			}
+		}
+
+		h.handleMeasures(now, counter(1), counter(1))
+		h.flush()
+		h.handleMeasures(now.Add(time.Second), counter(3))
+		h.flush()
+		h.flush() // no updates, nothing must be exported
+
+		for i, m := range c.metrics() {
+			if i >= len(test.values) {
+				t.Fatalf("%d: unexpected metric: %v", test.temporality, m)
+			}
+			sum := m.GetSum()
+			if sum.GetAggregationTemporality() != test.aggregation {
+				t.Errorf("%d: bad temporality: %v", test.temporality, sum.GetAggregationTemporality())
+			}
+			if v := sum.GetDataPoints()[0].GetAsDouble(); v != test.values[i] {
+				t.Errorf("%d: bad value at flush %d: want %g, got %g", test.temporality, i, test.values[i], v)
+			}
+		}
+	}
+}
+
+func TestHandlerBatching(t *testing.T) {
+	c := &recordingClient{}
+	e := &statstest.Handler{}
+	h := Handler{
+		Client:       c,
+		Context:      context.Background(),
+		MaxBatchSize: 2,
+		Engine:       stats.NewEngine("", e),
+	}
+
+	for i := 0; i != 5; i++ {
+		h.handleMeasures(now, stats.Measure{
+			Name:   "foobar",
+			Fields: []stats.Field{stats.MakeField("gauge", i, stats.Gauge)},
+			Tags:   []stats.Tag{stats.T("id", fmt.Sprint(i))},
+		})
+	}
+
+	if err := h.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.requests) != 3 {
+		t.Errorf("expected 3 export requests, got %d", len(c.requests))
+	}
+	if metrics := c.metrics(); len(metrics) != 5 {
+		t.Errorf("expected 5 metrics, got %d", len(metrics))
+	}
+
+	requests := 0
+	for _, m := range e.Measures() {
+		if m.Name == "otlp.export.requests" {
+			requests++
+		}
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 export requests to be reported, got %d", requests)
+	}
+}
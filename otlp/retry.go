@@ -0,0 +1,222 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultRetryInitialInterval is the default delay before the first retry
+	// of a failed export request.
+	DefaultRetryInitialInterval = 5 * time.Second
+
+	// DefaultRetryMaxInterval is the default maximum delay between two
+	// retries of an export request.
+	DefaultRetryMaxInterval = 30 * time.Second
+
+	// DefaultRetryMaxElapsedTime is the default maximum amount of time spent
+	// retrying an export request before it is dropped.
+	DefaultRetryMaxElapsedTime = time.Minute
+
+	// DefaultQueueSize is the default maximum number of export requests
+	// waiting to be sent to the collector.
+	DefaultQueueSize = 100
+
+	// retryJitter is the fraction of the backoff delay which is randomized,
+	// delays are picked in [(1-retryJitter)*d, (1+retryJitter)*d].
+	retryJitter = 0.5
+)
+
+// RetryConfig configures how the Handler retries export requests which failed
+// with transient errors, as defined by the OTLP specification. Delays grow
+// exponentially from InitialInterval up to MaxInterval and are randomized, so
+// that programs do not retry in lockstep after a collector outage. Throttling
+// hints sent by the collector (the Retry-After header of OTLP/HTTP, or the
+// RetryInfo detail of OTLP/gRPC statuses) take precedence over the computed
+// delays.
+type RetryConfig struct {
+	// Disabled turns off retries, failed requests are dropped immediately.
+	Disabled bool
+
+	// Delay before the first retry, DefaultRetryInitialInterval if zero.
+	InitialInterval time.Duration
+
+	// Maximum delay between two retries, DefaultRetryMaxInterval if zero.
+	MaxInterval time.Duration
+
+	// Maximum amount of time spent retrying a request, after which it is
+	// dropped. DefaultRetryMaxElapsedTime if zero.
+	MaxElapsedTime time.Duration
+}
+
+// RetryableError is returned by clients when an export request failed with an
+// error that the OTLP specification allows to retry. Implementations of Client
+// may also return it to have their requests retried by the Handler.
+type RetryableError struct {
+	Err error
+
+	// RetryAfter is the delay requested by the collector before the request
+	// is retried, or zero if the collector did not send a throttling hint.
+	RetryAfter time.Duration
+}
+
+// Error satisfies the error interface.
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// backoff computes the delays between retries of a request.
+type backoff struct {
+	interval    time.Duration
+	maxInterval time.Duration
+}
+
+func newBackoff(config RetryConfig) backoff {
+	b := backoff{
+		interval:    config.InitialInterval,
+		maxInterval: config.MaxInterval,
+	}
+	if b.interval <= 0 {
+		b.interval = DefaultRetryInitialInterval
+	}
+	if b.maxInterval <= 0 {
+		b.maxInterval = DefaultRetryMaxInterval
+	}
+	return b
+}
+
+// next returns the delay before the next retry, which is retryAfter when the
+// collector sent a throttling hint.
+func (b *backoff) next(retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	d := time.Duration(float64(b.interval) * (1 + retryJitter*(2*rand.Float64()-1)))
+
+	if b.interval *= 2; b.interval > b.maxInterval {
+		b.interval = b.maxInterval
+	}
+
+	return d
+}
+
+// retry calls export until it succeeds, returns an error which is not
+// retryable, or the retry budget of config is exhausted. It returns the number
+// of retries and the last error.
+func retry(ctx context.Context, config RetryConfig, export func() error) (retries int, err error) {
+	start := time.Now()
+	b := newBackoff(config)
+
+	maxElapsedTime := config.MaxElapsedTime
+	if maxElapsedTime <= 0 {
+		maxElapsedTime = DefaultRetryMaxElapsedTime
+	}
+
+	for {
+		if err = export(); err == nil || config.Disabled {
+			return retries, err
+		}
+
+		var retryable *RetryableError
+		if !errors.As(err, &retryable) {
+			return retries, err
+		}
+
+		delay := b.next(retryable.RetryAfter)
+		if time.Since(start)+delay > maxElapsedTime {
+			return retries, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return retries, err
+		}
+
+		retries++
+	}
+}
+
+// httpError returns the error for an OTLP/HTTP response with a status code
+// other than 200, the 429, 502, 503, and 504 codes are retryable.
+func httpError(res *http.Response, body []byte, now time.Time) error {
+	err := fmt.Errorf("failed to send data to collector, code: %d, error: %s", res.StatusCode, string(body))
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &RetryableError{Err: err, RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), now)}
+	default:
+		return err
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date. It returns zero if s is empty or invalid.
+func parseRetryAfter(s string, now time.Time) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return 0
+		}
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// grpcError returns the error for a failed OTLP/gRPC export, wrapped in a
+// *RetryableError if its status code is retryable. RESOURCE_EXHAUSTED is only
+// retryable when the server sent a RetryInfo detail, since it otherwise means
+// that the request will never be accepted.
+func grpcError(err error) error {
+	wrapped := fmt.Errorf("failed to send data to collector: %w", err)
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return wrapped
+	}
+
+	var retryAfter time.Duration
+	var throttled bool
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryAfter, throttled = info.GetRetryDelay().AsDuration(), true
+		}
+	}
+
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+	case codes.ResourceExhausted:
+		if !throttled {
+			return wrapped
+		}
+	default:
+		return wrapped
+	}
+
+	return &RetryableError{Err: wrapped, RetryAfter: retryAfter}
+}
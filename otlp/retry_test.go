@@ -0,0 +1,275 @@
+package otlp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		in  string
+		out time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{"Sat, 01 Jun 2024 12:00:10 GMT", 10 * time.Second},
+		{"Sat, 01 Jun 2024 11:00:00 GMT", 0},
+	} {
+		if d := parseRetryAfter(test.in, now); d != test.out {
+			t.Errorf("%q: want %s, got %s", test.in, test.out, d)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(RetryConfig{InitialInterval: time.Second, MaxInterval: 3 * time.Second})
+
+	for i, interval := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		d := b.next(0)
+		if lo, hi := interval/2, interval*3/2; d < lo || d > hi {
+			t.Errorf("%d: delay out of [%s, %s]: %s", i, lo, hi, d)
+		}
+	}
+
+	if d := b.next(time.Minute); d != time.Minute {
+		t.Errorf("throttling hint not honored: %s", d)
+	}
+}
+
+func TestHTTPClientRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	e := &statstest.Handler{}
+	h := Handler{
+		Client:  NewHTTPClient(server.URL),
+		Context: context.Background(),
+		Engine:  stats.NewEngine("", e),
+		Retry:   RetryConfig{InitialInterval: time.Millisecond},
+	}
+
+	h.handleMeasures(now, handleTests[0].in...)
+
+	if err := h.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 export requests, got %d", calls)
+	}
+	if n := countMetric(e, "otlp.export.retries.count"); n != 1 {
+		t.Errorf("expected 1 retry to be reported, got %d", n)
+	}
+}
+
+func TestHTTPClientNotRetryable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	c := NewHTTPClient(server.URL)
+	err := c.Handle(context.Background(), nil)
+
+	var retryable *RetryableError
+	if err == nil || errors.As(err, &retryable) {
+		t.Errorf("expected a non-retryable error, got %v", err)
+	}
+}
+
+type throttledClient struct {
+	calls    int
+	failures int
+}
+
+func (c *throttledClient) Handle(context.Context, *colmetricpb.ExportMetricsServiceRequest) error {
+	if c.calls++; c.calls <= c.failures {
+		return &RetryableError{Err: errors.New("throttled"), RetryAfter: 10 * time.Millisecond}
+	}
+	return nil
+}
+
+func TestHandlerRetry(t *testing.T) {
+	for _, test := range []struct {
+		scenario string
+		config   RetryConfig
+		calls    int
+		dropped  int
+	}{
+		{
+			scenario: "retried until success",
+			config:   RetryConfig{},
+			calls:    3,
+		},
+		{
+			scenario: "disabled",
+			config:   RetryConfig{Disabled: true},
+			calls:    1,
+			dropped:  1,
+		},
+		{
+			scenario: "max elapsed time exceeded",
+			config:   RetryConfig{MaxElapsedTime: 15 * time.Millisecond},
+			calls:    2,
+			dropped:  1,
+		},
+	} {
+		t.Run(test.scenario, func(t *testing.T) {
+			c := &throttledClient{failures: 2}
+			e := &statstest.Handler{}
+			h := Handler{
+				Client:  c,
+				Context: context.Background(),
+				Engine:  stats.NewEngine("", e),
+				Retry:   test.config,
+			}
+
+			h.handleMeasures(now, handleTests[0].in...)
+			h.flush()
+
+			if c.calls != test.calls {
+				t.Errorf("expected %d export requests, got %d", test.calls, c.calls)
+			}
+			if n := countMetric(e, "otlp.export.dropped_data_points.count"); n != test.dropped {
+				t.Errorf("expected %d dropped data points, got %d", test.dropped, n)
+			}
+		})
+	}
+}
+
+func TestHandlerQueueFull(t *testing.T) {
+	e := &statstest.Handler{}
+	h := Handler{
+		Client:    &recordingClient{},
+		Context:   context.Background(),
+		Engine:    stats.NewEngine("", e),
+		QueueSize: 2,
+	}
+
+	h.enqueue([]*exportRequest{{points: 1}, {points: 2}, {points: 3}})
+
+	if n := h.queueLen(); n != 2 {
+		t.Errorf("expected 2 queued requests, got %d", n)
+	}
+
+	for _, m := range e.Measures() {
+		for _, f := range m.Fields {
+			if m.Name+"."+f.Name != "otlp.export.dropped_data_points.count" {
+				continue
+			}
+			if f.Value.Int() != 3 {
+				t.Errorf("expected 3 dropped data points, got %d", f.Value.Int())
+			}
+			if !hasTag(m.Tags, stats.T("reason", "queue_full")) {
+				t.Errorf("missing reason tag: %v", m.Tags)
+			}
+		}
+	}
+}
+
+type blockingClient struct {
+	calls   chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) Handle(ctx context.Context, _ *colmetricpb.ExportMetricsServiceRequest) error {
+	c.calls <- struct{}{}
+	<-c.release
+	return nil
+}
+
+func TestHandlerExportInBackground(t *testing.T) {
+	c := &blockingClient{calls: make(chan struct{}, 10), release: make(chan struct{})}
+	defer close(c.release)
+
+	h := Handler{
+		Client:        c,
+		Context:       context.Background(),
+		Engine:        stats.NewEngine("", stats.Discard),
+		FlushInterval: 10 * time.Millisecond,
+		MaxMetrics:    1,
+	}
+
+	// Exceeding MaxMetrics exports the metrics without blocking the
+	// producer, even if the collector does not respond.
+	h.handleMeasures(now, handleTests[0].in...)
+	h.handleMeasures(now, handleTests[1].in...)
+
+	select {
+	case <-c.calls:
+	case <-time.After(time.Second):
+		t.Fatal("metrics were not exported when MaxMetrics was exceeded")
+	}
+
+	start := time.Now()
+	if err := h.flush(); err != errFlushTimeout {
+		t.Errorf("expected the flush to time out, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("flush was not bounded by the flush interval: %s", d)
+	}
+}
+
+func TestGRPCError(t *testing.T) {
+	throttled, _ := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(2 * time.Second),
+	})
+
+	for _, test := range []struct {
+		err        error
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{status.Error(codes.Unavailable, ""), true, 0},
+		{status.Error(codes.InvalidArgument, ""), false, 0},
+		{status.Error(codes.ResourceExhausted, ""), false, 0},
+		{throttled.Err(), true, 2 * time.Second},
+	} {
+		var retryable *RetryableError
+		err := grpcError(test.err)
+
+		if errors.As(err, &retryable) != test.retryable {
+			t.Errorf("%v: expected retryable=%t", test.err, test.retryable)
+			continue
+		}
+		if test.retryable && retryable.RetryAfter != test.retryAfter {
+			t.Errorf("%v: want retry after %s, got %s", test.err, test.retryAfter, retryable.RetryAfter)
+		}
+	}
+}
+
+func countMetric(e *statstest.Handler, name string) int {
+	n := 0
+	for _, m := range e.Measures() {
+		for _, f := range m.Fields {
+			if m.Name+"."+f.Name == name {
+				n += int(f.Value.Int())
+			}
+		}
+	}
+	return n
+}
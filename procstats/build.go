@@ -0,0 +1,56 @@
+package procstats
+
+import (
+	"runtime/debug"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/version"
+)
+
+// BuildInfo is a metric collector that reports the build information embedded
+// in the program binary, as a constant gauge tagged with the module path and
+// version, the Go version, and the VCS revision when available.
+type BuildInfo struct {
+	engine *stats.Engine
+
+	build struct {
+		info int `metric:"info" type:"gauge"`
+
+		path      string `tag:"path"`
+		version   string `tag:"version"`
+		goVersion string `tag:"go_version"`
+		revision  string `tag:"revision"`
+	} `metric:"build"`
+}
+
+// NewBuildInfo collects the build information of the program and reports it
+// to the default stats engine.
+func NewBuildInfo() *BuildInfo {
+	return NewBuildInfoWith(stats.DefaultEngine)
+}
+
+// NewBuildInfoWith collects the build information of the program and reports
+// it to eng.
+func NewBuildInfoWith(eng *stats.Engine) *BuildInfo {
+	b := &BuildInfo{engine: eng}
+	b.build.info = 1
+	b.build.goVersion = version.GoVersion()
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		b.build.path = info.Main.Path
+		b.build.version = info.Main.Version
+
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				b.build.revision = s.Value
+			}
+		}
+	}
+
+	return b
+}
+
+// Collect satisfies the Collector interface.
+func (b *BuildInfo) Collect() {
+	b.engine.Report(b)
+}
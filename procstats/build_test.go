@@ -0,0 +1,36 @@
+package procstats
+
+import (
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestBuildInfo(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	NewBuildInfoWith(e).Collect()
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatalf("expected one measure, got %d: %v", len(measures), measures)
+	}
+
+	m := measures[0]
+	if m.Name != "build" || len(m.Fields) != 1 || m.Fields[0].Name != "info" || m.Fields[0].Value.Int() != 1 {
+		t.Errorf("bad build info measure: %v", m)
+	}
+
+	for _, tag := range m.Tags {
+		if tag.Name == "go_version" && tag.Value != "" {
+			return
+		}
+	}
+	t.Errorf("missing go_version tag: %v", m.Tags)
+}
@@ -0,0 +1,150 @@
+package procstats
+
+import (
+	"os"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/procstats/linux"
+)
+
+// CGroupMetrics is a metric collector that reports the resource limits and
+// usage of the cgroup that a process runs in.
+//
+// Processes running in containers see the memory and CPUs of the host in
+// /proc, the limits which apply to them are those of their cgroup. The
+// collector reads them from the cgroup v2 hierarchy, or from the v1 memory
+// and cpu controllers, and reports nothing on systems other than Linux.
+// Pressure stall information is only available with cgroup v2.
+type CGroupMetrics struct {
+	engine *stats.Engine
+	pid    int
+	last   CGroupInfo
+	init   bool
+
+	usage struct {
+		memory struct {
+			limit   uint64  `metric:"limit.bytes"   type:"gauge"` // zero when unlimited
+			usage   uint64  `metric:"usage.bytes"   type:"gauge"`
+			percent float64 `metric:"usage.percent" type:"gauge"` // share of the limit in use
+		} `metric:"cgroup.memory"`
+
+		cpu struct {
+			quota         float64       `metric:"quota.cores"       type:"gauge"` // zero when unlimited
+			periods       uint64        `metric:"periods.count"     type:"counter"`
+			throttled     uint64        `metric:"throttled.count"   type:"counter"`
+			throttledTime time.Duration `metric:"throttled.seconds" type:"counter"`
+		} `metric:"cgroup.cpu"`
+	}
+
+	pressure struct {
+		cpu    pressureMetrics `metric:"cgroup.pressure"`
+		memory pressureMetrics `metric:"cgroup.pressure"`
+		io     pressureMetrics `metric:"cgroup.pressure"`
+	}
+}
+
+type pressureMetrics struct {
+	some     stallMetrics
+	full     stallMetrics
+	resource string `tag:"resource"`
+}
+
+type stallMetrics struct {
+	avg10  float64       `metric:"avg10.percent"  type:"gauge"`
+	avg60  float64       `metric:"avg60.percent"  type:"gauge"`
+	avg300 float64       `metric:"avg300.percent" type:"gauge"`
+	total  time.Duration `metric:"stall.seconds"  type:"counter"`
+	kind   string        `tag:"kind"`
+}
+
+// NewCGroupMetrics collects cgroup metrics on the current process and reports
+// them to the default stats engine.
+func NewCGroupMetrics() *CGroupMetrics {
+	return NewCGroupMetricsWith(stats.DefaultEngine, os.Getpid())
+}
+
+// NewCGroupMetricsWith collects cgroup metrics on the process identified by
+// pid and reports them to eng.
+func NewCGroupMetricsWith(eng *stats.Engine, pid int) *CGroupMetrics {
+	c := &CGroupMetrics{engine: eng, pid: pid}
+
+	for _, p := range []struct {
+		m        *pressureMetrics
+		resource string
+	}{
+		{&c.pressure.cpu, "cpu"},
+		{&c.pressure.memory, "memory"},
+		{&c.pressure.io, "io"},
+	} {
+		p.m.resource = p.resource
+		p.m.some.kind = "some"
+		p.m.full.kind = "full"
+	}
+
+	return c
+}
+
+// Collect satisfies the Collector interface.
+func (c *CGroupMetrics) Collect() {
+	info, err := CollectCGroupInfo(c.pid)
+	if err != nil {
+		return
+	}
+
+	m := &c.usage.memory
+	m.limit = info.MemoryLimit
+	m.usage = info.MemoryUsage
+	m.percent = 0
+	if m.limit != 0 {
+		m.percent = 100 * float64(m.usage) / float64(m.limit)
+	}
+
+	cpu := &c.usage.cpu
+	cpu.quota = 0
+	if info.CPUPeriod != 0 {
+		cpu.quota = float64(info.CPUQuota) / float64(info.CPUPeriod)
+	}
+
+	// Counters are reported as the difference with the previous collection,
+	// the first collection only records the initial values.
+	if c.init {
+		cpu.periods = info.CPUPeriods - c.last.CPUPeriods
+		cpu.throttled = info.CPUThrottledPeriods - c.last.CPUThrottledPeriods
+		cpu.throttledTime = info.CPUThrottledTime - c.last.CPUThrottledTime
+	}
+
+	c.engine.Report(&c.usage)
+
+	if info.Version == 2 {
+		c.pressure.cpu.update(info.CPUPressure, c.last.CPUPressure, c.init)
+		c.pressure.memory.update(info.MemoryPressure, c.last.MemoryPressure, c.init)
+		c.pressure.io.update(info.IOPressure, c.last.IOPressure, c.init)
+		c.engine.Report(&c.pressure)
+	}
+
+	c.last, c.init = info, true
+}
+
+func (p *pressureMetrics) update(info, last linux.Pressure, init bool) {
+	p.some.update(info.Some, last.Some, init)
+	p.full.update(info.Full, last.Full, init)
+}
+
+func (s *stallMetrics) update(info, last linux.PressureStall, init bool) {
+	s.avg10, s.avg60, s.avg300 = info.Avg10, info.Avg60, info.Avg300
+	s.total = 0
+	if init {
+		s.total = info.Total - last.Total
+	}
+}
+
+// CGroupInfo contains the resource limits and usage of the cgroup of a
+// process, the values are zero when they are unknown or when no limit
+// applies.
+type CGroupInfo = linux.CGroupStats
+
+// CollectCGroupInfo returns the CGroupInfo of a pid and an error, if any.
+func CollectCGroupInfo(pid int) (CGroupInfo, error) {
+	return collectCGroupInfo(pid)
+}
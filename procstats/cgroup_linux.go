@@ -0,0 +1,7 @@
+package procstats
+
+import "github.com/segmentio/stats/v5/procstats/linux"
+
+func collectCGroupInfo(pid int) (CGroupInfo, error) {
+	return linux.ReadCGroupStats(pid)
+}
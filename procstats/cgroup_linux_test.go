@@ -0,0 +1,56 @@
+package procstats
+
+import (
+	"os"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestCGroupMetrics(t *testing.T) {
+	info, err := CollectCGroupInfo(os.Getpid())
+	if err != nil {
+		t.Skip("cgroups are not available:", err)
+	}
+
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	c := NewCGroupMetricsWith(e, os.Getpid())
+	c.Collect()
+	c.Collect()
+
+	fields := map[string]stats.Value{}
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			fields[m.Name+"."+f.Name] = f.Value
+		}
+	}
+
+	names := []string{
+		"cgroup.memory.limit.bytes",
+		"cgroup.memory.usage.bytes",
+		"cgroup.memory.usage.percent",
+		"cgroup.cpu.quota.cores",
+		"cgroup.cpu.periods.count",
+		"cgroup.cpu.throttled.count",
+		"cgroup.cpu.throttled.seconds",
+	}
+	if info.Version == 2 {
+		names = append(names,
+			"cgroup.pressure.avg10.percent",
+			"cgroup.pressure.stall.seconds",
+		)
+	}
+
+	for _, name := range names {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("missing metric %s in %v", name, fields)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+package procstats
+
+func collectCGroupInfo(_ int) (CGroupInfo, error) {
+	return CGroupInfo{}, &OSUnsupportedError{Msg: "cgroup metrics are only supported on linux"}
+}
@@ -5,6 +5,8 @@ import (
 	"runtime"
 	"sync"
 	"time"
+
+	stats "github.com/segmentio/stats/v5"
 )
 
 // Collector is an interface that wraps the Collect() method.
@@ -22,6 +24,30 @@ func (f CollectorFunc) Collect() { f() }
 type Config struct {
 	Collector       Collector
 	CollectInterval time.Duration
+
+	// StallTimeout enables a watchdog which detects collections taking longer
+	// than the timeout, for example reads of /proc stuck on a hung filesystem
+	// or hung dbus calls. Stalled collections are reported with the
+	// procstats.collector.stalled counter, and collection restarts in a new
+	// goroutine after a backoff delay.
+	//
+	// Go offers no way to interrupt a goroutine, a stalled collection is
+	// abandoned and may still be running when its replacement starts, so the
+	// Collector must be safe to use concurrently when the watchdog is enabled.
+	StallTimeout time.Duration
+
+	// MaxRestartBackoff is the maximum delay before restarting a stalled
+	// collector, the delay starts at CollectInterval and doubles on each
+	// consecutive stall. The default is DefaultMaxRestartBackoff.
+	MaxRestartBackoff time.Duration
+
+	// Name of the collector, set as the "collector" tag of the watchdog
+	// metrics.
+	Name string
+
+	// Engine that the watchdog metrics are reported to, the default is
+	// stats.DefaultEngine.
+	Engine *stats.Engine
 }
 
 // MultiCollector coalesces a variadic number of Collectors
@@ -46,6 +72,14 @@ func StartCollectorWith(config Config) io.Closer {
 	stop := make(chan struct{})
 	join := make(chan struct{})
 
+	if config.StallTimeout > 0 {
+		go func() {
+			defer close(join)
+			watch(config, stop)
+		}()
+		return &closer{stop: stop, join: join}
+	}
+
 	go func() {
 		// Locks the OS thread, stats collection heavily relies on blocking
 		// syscalls, letting other goroutines execute on the same thread
@@ -80,6 +114,14 @@ func setConfigDefaults(config Config) Config {
 		config.Collector = MultiCollector()
 	}
 
+	if config.MaxRestartBackoff == 0 {
+		config.MaxRestartBackoff = DefaultMaxRestartBackoff
+	}
+
+	if config.Engine == nil {
+		config.Engine = stats.DefaultEngine
+	}
+
 	return config
 }
 
@@ -0,0 +1,47 @@
+package procstats
+
+import (
+	"io"
+	"os"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// DefaultInstrumentationInterval is the interval at which the collectors
+// started by DefaultInstrumentation report their metrics.
+const DefaultInstrumentationInterval = 10 * time.Second
+
+// DefaultInstrumentation starts collecting the baseline telemetry of the
+// current process and reports it to eng: Go runtime metrics, both from
+// runtime.MemStats and the DefaultRuntimeMetrics of the runtime/metrics
+// package, process metrics, resource delays (where supported), and build
+// information.
+//
+// The function lives in procstats rather than in the stats package because
+// the collectors depend on stats, it is the one call new services need to
+// make to get standard metrics. The returned io.Closer stops the collection.
+func DefaultInstrumentation(eng *stats.Engine) io.Closer {
+	return DefaultInstrumentationWith(eng, DefaultInstrumentationInterval)
+}
+
+// DefaultInstrumentationWith is like DefaultInstrumentation but collects the
+// metrics at the given interval.
+func DefaultInstrumentationWith(eng *stats.Engine, interval time.Duration) io.Closer {
+	if eng == nil {
+		eng = stats.DefaultEngine
+	}
+
+	pid := os.Getpid()
+
+	return StartCollectorWith(Config{
+		CollectInterval: interval,
+		Collector: MultiCollector(
+			NewGoMetricsWith(eng),
+			NewRuntimeMetricsWith(eng),
+			NewProcMetricsWith(eng, pid),
+			NewDelayMetricsWith(eng, pid),
+			NewBuildInfoWith(eng),
+		),
+	})
+}
@@ -0,0 +1,37 @@
+package procstats
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestDefaultInstrumentation(t *testing.T) {
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	c := DefaultInstrumentationWith(e, time.Hour)
+	c.Close()
+
+	names := map[string]bool{}
+	fields := map[string]bool{}
+	for _, m := range h.Measures() {
+		names[m.Name] = true
+		for _, f := range m.Fields {
+			fields[m.Name+"."+f.Name] = true
+		}
+	}
+
+	for _, name := range []string{"go.runtime", "build"} {
+		if !names[name] {
+			t.Errorf("no %q measures were reported: %v", name, names)
+		}
+	}
+
+	// The runtime/metrics collector is part of the default instrumentation.
+	if !fields["go.runtime.sched.gomaxprocs.threads"] {
+		t.Error("no runtime/metrics measures were reported")
+	}
+}
@@ -0,0 +1,16 @@
+package procstats
+
+import "github.com/segmentio/stats/v5/procstats/linux"
+
+func collectIOInfo(pid int) (IOInfo, error) {
+	io, err := linux.ReadProcIO(pid)
+	return IOInfo{
+		ReadChars:           io.RChar,
+		WriteChars:          io.WChar,
+		ReadSyscalls:        io.SyscR,
+		WriteSyscalls:       io.SyscW,
+		ReadBytes:           io.ReadBytes,
+		WriteBytes:          io.WriteBytes,
+		CancelledWriteBytes: io.CancelledWriteBytes,
+	}, err
+}
@@ -0,0 +1,53 @@
+package procstats
+
+import (
+	"os"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestIOMetrics(t *testing.T) {
+	if _, err := CollectIOInfo(os.Getpid()); err != nil {
+		t.Skip("io accounting is not available:", err)
+	}
+
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	c := NewIOMetricsWith(e, os.Getpid())
+	c.Collect()
+
+	if _, err := os.ReadFile("/proc/self/stat"); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Clear()
+	c.Collect()
+
+	syscalls := map[string]uint64{}
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			if m.Name+"."+f.Name != "io.syscalls.count" {
+				continue
+			}
+			for _, tag := range m.Tags {
+				if tag.Name == "operation" {
+					syscalls[tag.Value] = f.Value.Uint()
+				}
+			}
+		}
+	}
+
+	if syscalls["read"] == 0 {
+		t.Errorf("expected read system calls to be counted: %v", syscalls)
+	}
+	if _, ok := syscalls["write"]; !ok {
+		t.Errorf("missing write system calls: %v", syscalls)
+	}
+}
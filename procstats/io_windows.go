@@ -0,0 +1,5 @@
+package procstats
+
+func collectIOInfo(_ int) (IOInfo, error) {
+	return IOInfo{}, &OSUnsupportedError{Msg: "I/O metrics are only supported on linux"}
+}
@@ -0,0 +1,236 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CGroupStats holds the resource limits and usage of the cgroup of a process,
+// read from the cgroup v2 unified hierarchy, or from the v1 memory and cpu
+// controllers on systems that do not use cgroup v2.
+//
+// Values are zero when they are unknown, or when no limit applies.
+type CGroupStats struct {
+	Version int // 1 or 2
+
+	MemoryLimit uint64 // memory limit in bytes
+	MemoryUsage uint64 // memory usage in bytes, including the page cache
+
+	// For more details on what those values represent see:
+	//	https://www.kernel.org/doc/Documentation/scheduler/sched-bwc.txt
+	CPUPeriod           time.Duration // scheduler period
+	CPUQuota            time.Duration // time quota in the scheduler period
+	CPUPeriods          uint64        // number of elapsed periods
+	CPUThrottledPeriods uint64        // number of periods where the cgroup was throttled
+	CPUThrottledTime    time.Duration // total time that the cgroup was throttled
+
+	// Pressure stall information, only reported by cgroup v2, see:
+	//	https://docs.kernel.org/accounting/psi.html
+	CPUPressure    Pressure
+	MemoryPressure Pressure
+	IOPressure     Pressure
+}
+
+// Pressure holds the pressure stall information of a resource.
+type Pressure struct {
+	Some PressureStall // some tasks were stalled on the resource
+	Full PressureStall // all non-idle tasks were stalled on the resource
+}
+
+// PressureStall holds the share of time that tasks were stalled on a resource
+// over the last 10, 60, and 300 seconds, in percents, and the total stall time.
+type PressureStall struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  time.Duration
+}
+
+// CGroupRoot is the mount point of the cgroup filesystems.
+const CGroupRoot = "/sys/fs/cgroup"
+
+// ReadCGroupStats takes an int argument representing a PID and returns the
+// CGroupStats of its cgroup and an error, if any is encountered.
+func ReadCGroupStats(pid int) (stats CGroupStats, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	stats = readCGroupStats(CGroupRoot, parseProcCGroup(readProcFile(pid, "cgroup")))
+	return
+}
+
+// ReadCGroupStatsAt is like ReadCGroupStats but reads the cgroup filesystems
+// mounted at root, for the cgroups of a process in the format of
+// /proc/<pid>/cgroup.
+func ReadCGroupStatsAt(root string, cgroups ProcCGroup) (stats CGroupStats, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	stats = readCGroupStats(root, cgroups)
+	return
+}
+
+func readCGroupStats(root string, cgroups ProcCGroup) CGroupStats {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		if cg, ok := cgroups.unified(); ok {
+			return readCGroupV2Stats(cgroupDir(root, cg.Path))
+		}
+	}
+	return readCGroupV1Stats(root, cgroups)
+}
+
+// unified returns the entry of the cgroup v2 hierarchy, which has the ID 0 and
+// no controller names.
+func (pcg ProcCGroup) unified() (CGroup, bool) {
+	for _, cg := range pcg {
+		if cg.ID == 0 && cg.Name == "" {
+			return cg, true
+		}
+	}
+	return CGroup{}, false
+}
+
+// cgroupDir returns the directory of the cgroup at path under root. Processes
+// running in containers without a cgroup namespace see the path of their
+// cgroup on the host, which is not mounted in the container, the directory is
+// the root in this case.
+func cgroupDir(root, path string) string {
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		dir = root
+	}
+	return dir
+}
+
+func readCGroupV2Stats(dir string) CGroupStats {
+	stats := CGroupStats{Version: 2}
+
+	if s, ok := readOptionalFile(filepath.Join(dir, "memory.max")); ok && s != "max" {
+		stats.MemoryLimit = parseUint(s)
+	}
+	if s, ok := readOptionalFile(filepath.Join(dir, "memory.current")); ok {
+		stats.MemoryUsage = parseUint(s)
+	}
+
+	if s, ok := readOptionalFile(filepath.Join(dir, "cpu.max")); ok {
+		quota, period := split(s, ' ')
+		stats.CPUPeriod = time.Duration(parseUint(period)) * time.Microsecond
+		if quota != "max" {
+			stats.CPUQuota = time.Duration(parseUint(quota)) * time.Microsecond
+		}
+	}
+
+	if s, ok := readOptionalFile(filepath.Join(dir, "cpu.stat")); ok {
+		forEachLine(s, func(line string) {
+			key, val := split(line, ' ')
+			switch key {
+			case "nr_periods":
+				stats.CPUPeriods = parseUint(val)
+			case "nr_throttled":
+				stats.CPUThrottledPeriods = parseUint(val)
+			case "throttled_usec":
+				stats.CPUThrottledTime = time.Duration(parseUint(val)) * time.Microsecond
+			}
+		})
+	}
+
+	stats.CPUPressure = readPressure(filepath.Join(dir, "cpu.pressure"))
+	stats.MemoryPressure = readPressure(filepath.Join(dir, "memory.pressure"))
+	stats.IOPressure = readPressure(filepath.Join(dir, "io.pressure"))
+	return stats
+}
+
+func readCGroupV1Stats(root string, cgroups ProcCGroup) CGroupStats {
+	stats := CGroupStats{Version: 1}
+
+	if memory, ok := cgroups.Lookup("memory"); ok {
+		dir := cgroupDir(filepath.Join(root, "memory"), memory.Path)
+
+		if s, ok := readOptionalFile(filepath.Join(dir, "memory.limit_in_bytes")); ok {
+			if limit := parseUint(s); limit != unlimitedMemoryLimit {
+				stats.MemoryLimit = limit
+			}
+		}
+		if s, ok := readOptionalFile(filepath.Join(dir, "memory.usage_in_bytes")); ok {
+			stats.MemoryUsage = parseUint(s)
+		}
+	}
+
+	if cpu, ok := cgroups.Lookup("cpu"); ok {
+		dir := cgroupDir(filepath.Join(root, "cpu"), cpu.Path)
+
+		if s, ok := readOptionalFile(filepath.Join(dir, "cpu.cfs_period_us")); ok {
+			stats.CPUPeriod = time.Duration(parseUint(s)) * time.Microsecond
+		}
+		// The quota is -1 when there is no limit.
+		if s, ok := readOptionalFile(filepath.Join(dir, "cpu.cfs_quota_us")); ok {
+			if quota := parseInt(s); quota > 0 {
+				stats.CPUQuota = time.Duration(quota) * time.Microsecond
+			}
+		}
+
+		if s, ok := readOptionalFile(filepath.Join(dir, "cpu.stat")); ok {
+			forEachLine(s, func(line string) {
+				key, val := split(line, ' ')
+				switch key {
+				case "nr_periods":
+					stats.CPUPeriods = parseUint(val)
+				case "nr_throttled":
+					stats.CPUThrottledPeriods = parseUint(val)
+				case "throttled_time":
+					stats.CPUThrottledTime = time.Duration(parseUint(val))
+				}
+			})
+		}
+	}
+
+	return stats
+}
+
+// readPressure parses a file in the format of the PSI interface:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressure(path string) (p Pressure) {
+	s, ok := readOptionalFile(path)
+	if !ok {
+		return
+	}
+
+	forEachLine(s, func(line string) {
+		kind, line := split(line, ' ')
+
+		var stall PressureStall
+		for _, field := range strings.Fields(line) {
+			key, val := split(field, '=')
+			switch key {
+			case "avg10":
+				stall.Avg10 = parseFloat(val)
+			case "avg60":
+				stall.Avg60 = parseFloat(val)
+			case "avg300":
+				stall.Avg300 = parseFloat(val)
+			case "total":
+				stall.Total = time.Duration(parseUint(val)) * time.Microsecond
+			}
+		}
+
+		switch kind {
+		case "some":
+			p.Some = stall
+		case "full":
+			p.Full = stall
+		}
+	})
+
+	return
+}
+
+// readOptionalFile returns the trimmed content of the file at path, and false
+// if it could not be read, the files of cgroups depend on the kernel version
+// and on the controllers which are enabled.
+func readOptionalFile(path string) (string, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(b)), true
+}
@@ -0,0 +1,125 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeCGroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCGroupStatsV2(t *testing.T) {
+	root := t.TempDir()
+	writeCGroupFiles(t, root, map[string]string{"cgroup.controllers": "cpu io memory\n"})
+	writeCGroupFiles(t, filepath.Join(root, "system.slice/app.service"), map[string]string{
+		"memory.max":     "536870912\n",
+		"memory.current": "134217728\n",
+		"cpu.max":        "50000 100000\n",
+		"cpu.stat": `usage_usec 1000
+nr_periods 40
+nr_throttled 10
+throttled_usec 250000
+`,
+		"cpu.pressure": `some avg10=1.50 avg60=0.75 avg300=0.25 total=120000
+full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+`,
+		"memory.pressure": `some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+`,
+	})
+
+	stats, err := ReadCGroupStatsAt(root, ProcCGroup{{0, "", "/system.slice/app.service"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := CGroupStats{
+		Version:             2,
+		MemoryLimit:         536870912,
+		MemoryUsage:         134217728,
+		CPUPeriod:           100 * time.Millisecond,
+		CPUQuota:            50 * time.Millisecond,
+		CPUPeriods:          40,
+		CPUThrottledPeriods: 10,
+		CPUThrottledTime:    250 * time.Millisecond,
+		CPUPressure: Pressure{
+			Some: PressureStall{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 120 * time.Millisecond},
+		},
+	}
+
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("bad cgroup stats:\nexpected: %+v\nfound:    %+v", expected, stats)
+	}
+}
+
+func TestReadCGroupStatsV2Unlimited(t *testing.T) {
+	root := t.TempDir()
+	writeCGroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"memory.max":         "max\n",
+		"memory.current":     "4096\n",
+		"cpu.max":            "max 100000\n",
+	})
+
+	// The cgroup of the host is not mounted in the container, the stats are
+	// read from the root.
+	stats, err := ReadCGroupStatsAt(root, ProcCGroup{{0, "", "/docker/0123456789"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.MemoryLimit != 0 || stats.MemoryUsage != 4096 || stats.CPUQuota != 0 || stats.CPUPeriod != 100*time.Millisecond {
+		t.Errorf("bad cgroup stats: %+v", stats)
+	}
+}
+
+func TestReadCGroupStatsV1(t *testing.T) {
+	root := t.TempDir()
+	writeCGroupFiles(t, filepath.Join(root, "memory/user.slice"), map[string]string{
+		"memory.limit_in_bytes": "9223372036854771712\n",
+		"memory.usage_in_bytes": "8192\n",
+	})
+	writeCGroupFiles(t, filepath.Join(root, "cpu/user.slice"), map[string]string{
+		"cpu.cfs_period_us": "100000\n",
+		"cpu.cfs_quota_us":  "200000\n",
+		"cpu.stat": `nr_periods 5
+nr_throttled 2
+throttled_time 3000000
+`,
+	})
+
+	stats, err := ReadCGroupStatsAt(root, ProcCGroup{
+		{11, "memory", "/user.slice"},
+		{5, "cpu", "/user.slice"},
+		{5, "cpuacct", "/user.slice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := CGroupStats{
+		Version:             1,
+		MemoryUsage:         8192,
+		CPUPeriod:           100 * time.Millisecond,
+		CPUQuota:            200 * time.Millisecond,
+		CPUPeriods:          5,
+		CPUThrottledPeriods: 2,
+		CPUThrottledTime:    3 * time.Millisecond,
+	}
+
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("bad cgroup stats:\nexpected: %+v\nfound:    %+v", expected, stats)
+	}
+}
@@ -33,6 +33,18 @@ func parseInt(s string) int64 {
 	return i
 }
 
+func parseUint(s string) uint64 {
+	u, err := strconv.ParseUint(s, 10, 64)
+	check(err)
+	return u
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	check(err)
+	return f
+}
+
 func procPath(who interface{}, what string) string {
 	return filepath.Join("/proc", fmt.Sprint(who), what)
 }
@@ -17,9 +17,18 @@ func readMemoryLimit(pid int) (limit uint64, err error) {
 }
 
 func readCGroupMemoryLimit(pid int) (limit uint64) {
+	limit = unlimitedMemoryLimit
+
 	if cgroups, err := ReadProcCGroup(pid); err == nil {
-		limit = readProcCGroupMemoryLimit(cgroups)
+		if _, ok := cgroups.Lookup("memory"); ok {
+			limit = readProcCGroupMemoryLimit(cgroups)
+		} else if stats, err := ReadCGroupStatsAt(CGroupRoot, cgroups); err == nil && stats.MemoryLimit != 0 {
+			// There is no memory controller in the v1 hierarchy on systems
+			// using cgroup v2.
+			limit = stats.MemoryLimit
+		}
 	}
+
 	return
 }
 
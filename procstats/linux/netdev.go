@@ -0,0 +1,67 @@
+package linux
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NetDev contains the statistics of a network interface, see proc(5).
+type NetDev struct {
+	Interface string
+
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// ReadProcNetDev returns the statistics of the network interfaces of the
+// network namespace of a PID, and an error, if any.
+func ReadProcNetDev(pid int) (devs []NetDev, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	devs = parseProcNetDev(readProcFile(pid, "net/dev"))
+	return
+}
+
+// ParseProcNetDev parses the content of /proc/<pid>/net/dev and returns the
+// list of network interfaces and an error, if any.
+func ParseProcNetDev(s string) (devs []NetDev, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	devs = parseProcNetDev(s)
+	return
+}
+
+func parseProcNetDev(s string) (devs []NetDev) {
+	// The first two lines are headers:
+	//
+	//	Inter-|   Receive                                                |  Transmit
+	//	 face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+	//	    lo: 678979305  256008    0    0    0     0          0         0 678979305  256008    0    0    0     0       0          0
+	s = skipLine(skipLine(s))
+
+	forEachLine(s, func(line string) {
+		name, line := split(line, ':')
+		columns := strings.Fields(line)
+		if len(columns) < 12 {
+			panic(fmt.Errorf("invalid line of /proc/net/dev for interface %q: %q", name, line))
+		}
+		devs = append(devs, NetDev{
+			Interface: name,
+			RxBytes:   parseUint(columns[0]),
+			RxPackets: parseUint(columns[1]),
+			RxErrors:  parseUint(columns[2]),
+			RxDropped: parseUint(columns[3]),
+			TxBytes:   parseUint(columns[8]),
+			TxPackets: parseUint(columns[9]),
+			TxErrors:  parseUint(columns[10]),
+			TxDropped: parseUint(columns[11]),
+		})
+	})
+
+	return
+}
@@ -0,0 +1,46 @@
+package linux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcNetDev(t *testing.T) {
+	text := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 678979305  256008    0    0    0     0          0         0 678979305  256008    0    0    0     0       0          0
+  eth0:   40160     150    1    2    0     0          0         0    11794     152    3    4    0     0       0          0
+`
+
+	devs, err := ParseProcNetDev(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(devs, []NetDev{
+		{
+			Interface: "lo",
+			RxBytes:   678979305,
+			RxPackets: 256008,
+			TxBytes:   678979305,
+			TxPackets: 256008,
+		},
+		{
+			Interface: "eth0",
+			RxBytes:   40160,
+			RxPackets: 150,
+			RxErrors:  1,
+			RxDropped: 2,
+			TxBytes:   11794,
+			TxPackets: 152,
+			TxErrors:  3,
+			TxDropped: 4,
+		},
+	}) {
+		t.Errorf("bad net devices: %+v", devs)
+	}
+
+	if _, err := ParseProcNetDev(text + "eth1: 1 2 3\n"); err == nil {
+		t.Error("expected an error parsing an invalid line")
+	}
+}
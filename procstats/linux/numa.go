@@ -0,0 +1,191 @@
+package linux
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProcNUMAMaps contains the memory of a process allocated on each NUMA node,
+// summed over all its mappings and indexed by node ID.
+type ProcNUMAMaps map[int]NUMAMemory
+
+// NUMAMemory contains the memory allocated on a NUMA node, in bytes.
+type NUMAMemory struct {
+	Total    uint64 // memory allocated on the node, including huge pages
+	HugePage uint64 // memory of hugetlbfs mappings allocated on the node
+}
+
+// ReadProcNUMAMaps returns a ProcNUMAMaps and error, if any, for a PID.
+func ReadProcNUMAMaps(pid int) (proc ProcNUMAMaps, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	proc = parseProcNUMAMaps(readProcFile(pid, "numa_maps"))
+	return
+}
+
+// ParseProcNUMAMaps parses the content of /proc/<pid>/numa_maps and returns a
+// ProcNUMAMaps and error, if any.
+func ParseProcNUMAMaps(s string) (proc ProcNUMAMaps, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	proc = parseProcNUMAMaps(s)
+	return
+}
+
+func parseProcNUMAMaps(s string) ProcNUMAMaps {
+	proc := ProcNUMAMaps{}
+
+	// Each line describes a mapping, for example:
+	//
+	//	7f2b4c000000 default file=/lib/libc.so.6 mapped=90 N0=60 N1=30 kernelpagesize_kB=4
+	//	7f2b50000000 default file=/dev/hugepages/x huge dirty=2 N0=2 kernelpagesize_kB=2048
+	forEachLine(s, func(line string) {
+		pageSize := uint64(4096)
+		huge := false
+		pages := map[int]uint64{}
+
+		for _, field := range strings.Fields(line) {
+			if field == "huge" {
+				huge = true
+				continue
+			}
+			key, val := split(field, '=')
+			switch {
+			case key == "kernelpagesize_kB":
+				pageSize = parseUint(val) * 1024
+			case len(key) > 1 && key[0] == 'N':
+				if node, err := strconv.Atoi(key[1:]); err == nil {
+					pages[node] += parseUint(val)
+				}
+			}
+		}
+
+		for node, n := range pages {
+			mem := proc[node]
+			mem.Total += n * pageSize
+			if huge {
+				mem.HugePage += n * pageSize
+			}
+			proc[node] = mem
+		}
+	})
+
+	return proc
+}
+
+// NUMANode contains the memory statistics of a NUMA node of the system, all
+// values are in bytes.
+type NUMANode struct {
+	ID        int
+	MemTotal  uint64 // MemTotal
+	MemFree   uint64 // MemFree
+	MemUsed   uint64 // MemUsed
+	HugePages []HugePages
+}
+
+// HugePages contains the state of the pool of huge pages of a given size on a
+// NUMA node, values other than Size are page counts.
+type HugePages struct {
+	Size    uint64 // size of the pages in bytes
+	Total   uint64 // nr_hugepages
+	Free    uint64 // free_hugepages
+	Surplus uint64 // surplus_hugepages
+}
+
+// NUMANodeRoot is the directory where the kernel exposes NUMA nodes.
+const NUMANodeRoot = "/sys/devices/system/node"
+
+// ReadNUMANodes returns the list of NUMA nodes of the system, sorted by ID,
+// and an error, if any.
+func ReadNUMANodes() ([]NUMANode, error) {
+	return ReadNUMANodesAt(NUMANodeRoot)
+}
+
+// ReadNUMANodesAt is like ReadNUMANodes but reads the NUMA nodes exposed in the
+// root directory.
+func ReadNUMANodesAt(root string) (nodes []NUMANode, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	nodes = readNUMANodes(root)
+	return
+}
+
+func readNUMANodes(root string) []NUMANode {
+	dirs, err := filepath.Glob(filepath.Join(root, "node[0-9]*"))
+	check(err)
+
+	nodes := make([]NUMANode, 0, len(dirs))
+
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		node := parseNUMANodeMeminfo(readFile(filepath.Join(dir, "meminfo")))
+		node.ID = id
+		node.HugePages = readNUMANodeHugePages(filepath.Join(dir, "hugepages"))
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// parseNUMANodeMeminfo parses the meminfo file of a NUMA node, which is in
+// the format of /proc/meminfo prefixed with the node:
+//
+//	Node 0 MemTotal:       32780484 kB
+//	Node 0 MemFree:         1207868 kB
+func parseNUMANodeMeminfo(s string) (node NUMANode) {
+	intFields := map[string]*uint64{
+		"MemTotal": &node.MemTotal,
+		"MemFree":  &node.MemFree,
+		"MemUsed":  &node.MemUsed,
+	}
+
+	forEachLine(s, func(line string) {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "Node" {
+			line = strings.Join(fields[2:], " ")
+		}
+		key, val := splitProperty(line)
+		if field := intFields[key]; field != nil {
+			val, unit := split(val, ' ')
+			v := parseUint(val)
+			if strings.EqualFold(unit, "kB") {
+				v *= 1024
+			}
+			*field = v
+		}
+	})
+
+	return
+}
+
+func readNUMANodeHugePages(dir string) []HugePages {
+	dirs, err := filepath.Glob(filepath.Join(dir, "hugepages-*kB"))
+	check(err)
+
+	var pages []HugePages
+
+	for _, dir := range dirs {
+		size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(dir), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		pages = append(pages, HugePages{
+			Size:    size * 1024,
+			Total:   readOptionalUint(filepath.Join(dir, "nr_hugepages")),
+			Free:    readOptionalUint(filepath.Join(dir, "free_hugepages")),
+			Surplus: readOptionalUint(filepath.Join(dir, "surplus_hugepages")),
+		})
+	}
+
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Size < pages[j].Size })
+	return pages
+}
+
+func readOptionalUint(path string) uint64 {
+	if s, ok := readOptionalFile(path); ok {
+		return parseUint(s)
+	}
+	return 0
+}
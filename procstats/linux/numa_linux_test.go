@@ -0,0 +1,15 @@
+package linux
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReadProcNUMAMaps(t *testing.T) {
+	if _, err := os.Stat("/proc/self/numa_maps"); err != nil {
+		t.Skip("numa_maps is not supported by this kernel:", err)
+	}
+	if _, err := ReadProcNUMAMaps(os.Getpid()); err != nil {
+		t.Error("ReadProcNUMAMaps:", err)
+	}
+}
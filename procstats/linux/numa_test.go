@@ -0,0 +1,84 @@
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseProcNUMAMaps(t *testing.T) {
+	text := `55d1f6a4e000 default file=/usr/bin/app mapped=10 N0=10 kernelpagesize_kB=4
+7f2b4c000000 default anon=300 dirty=300 active=0 N0=100 N1=200 kernelpagesize_kB=4
+7f2b50000000 default file=/dev/hugepages/buffer huge dirty=2 N1=2 kernelpagesize_kB=2048
+7ffc8a7d3000 default stack anon=3 dirty=3 N0=3 kernelpagesize_kB=4
+7ffc8a7f4000 default
+`
+
+	proc, err := ParseProcNUMAMaps(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(proc, ProcNUMAMaps{
+		0: {Total: 113 * 4096},
+		1: {Total: 200*4096 + 2*2048*1024, HugePage: 2 * 2048 * 1024},
+	}) {
+		t.Error("bad numa maps:", proc)
+	}
+}
+
+func TestReadNUMANodesAt(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("node1/meminfo", `Node 1 MemTotal:       2048 kB
+Node 1 MemFree:         512 kB
+Node 1 MemUsed:        1536 kB
+Node 1 HugePages_Total:     0
+`)
+	writeFile("node0/meminfo", `Node 0 MemTotal:       4096 kB
+Node 0 MemFree:        1024 kB
+Node 0 MemUsed:        3072 kB
+`)
+	writeFile("node0/hugepages/hugepages-2048kB/nr_hugepages", "8\n")
+	writeFile("node0/hugepages/hugepages-2048kB/free_hugepages", "6\n")
+	writeFile("node0/hugepages/hugepages-2048kB/surplus_hugepages", "1\n")
+	writeFile("node0/hugepages/hugepages-1048576kB/nr_hugepages", "1\n")
+	writeFile("online", "0-1\n")
+
+	nodes, err := ReadNUMANodesAt(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(nodes, []NUMANode{
+		{
+			ID:       0,
+			MemTotal: 4096 * 1024,
+			MemFree:  1024 * 1024,
+			MemUsed:  3072 * 1024,
+			HugePages: []HugePages{
+				{Size: 2048 * 1024, Total: 8, Free: 6, Surplus: 1},
+				{Size: 1048576 * 1024, Total: 1},
+			},
+		},
+		{
+			ID:       1,
+			MemTotal: 2048 * 1024,
+			MemFree:  512 * 1024,
+			MemUsed:  1536 * 1024,
+		},
+	}) {
+		t.Errorf("bad numa nodes: %+v", nodes)
+	}
+}
@@ -0,0 +1,47 @@
+package linux
+
+// ProcIO contains the I/O statistics of a process, see proc(5).
+type ProcIO struct {
+	RChar               uint64 // rchar: bytes read, including from the page cache and sockets
+	WChar               uint64 // wchar: bytes written, including to the page cache and sockets
+	SyscR               uint64 // syscr: number of read system calls
+	SyscW               uint64 // syscw: number of write system calls
+	ReadBytes           uint64 // read_bytes: bytes fetched from the storage layer
+	WriteBytes          uint64 // write_bytes: bytes sent to the storage layer
+	CancelledWriteBytes uint64 // cancelled_write_bytes: bytes written to the page cache then truncated
+}
+
+// ReadProcIO returns the ProcIO and an error, if any, for a PID.
+func ReadProcIO(pid int) (proc ProcIO, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	proc = parseProcIO(readProcFile(pid, "io"))
+	return
+}
+
+// ParseProcIO parses the content of /proc/<pid>/io and returns a ProcIO and
+// error, if any.
+func ParseProcIO(s string) (proc ProcIO, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	proc = parseProcIO(s)
+	return
+}
+
+func parseProcIO(s string) (proc ProcIO) {
+	intFields := map[string]*uint64{
+		"rchar":                 &proc.RChar,
+		"wchar":                 &proc.WChar,
+		"syscr":                 &proc.SyscR,
+		"syscw":                 &proc.SyscW,
+		"read_bytes":            &proc.ReadBytes,
+		"write_bytes":           &proc.WriteBytes,
+		"cancelled_write_bytes": &proc.CancelledWriteBytes,
+	}
+
+	forEachProperty(s, func(key, val string) {
+		if field := intFields[key]; field != nil {
+			*field = parseUint(val)
+		}
+	})
+
+	return
+}
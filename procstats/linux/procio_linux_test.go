@@ -0,0 +1,25 @@
+package linux
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReadProcIO(t *testing.T) {
+	if _, err := os.Stat("/proc/self/io"); err != nil {
+		t.Skip("io accounting is not supported by this kernel:", err)
+	}
+	if io, err := ReadProcIO(os.Getpid()); err != nil {
+		t.Error("ReadProcIO:", err)
+	} else if io.SyscR == 0 {
+		t.Error("ReadProcIO: the process must have made read system calls")
+	}
+}
+
+func TestReadProcNetDev(t *testing.T) {
+	if devs, err := ReadProcNetDev(os.Getpid()); err != nil {
+		t.Error("ReadProcNetDev:", err)
+	} else if len(devs) == 0 {
+		t.Error("ReadProcNetDev: no network interfaces")
+	}
+}
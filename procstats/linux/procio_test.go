@@ -0,0 +1,34 @@
+package linux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcIO(t *testing.T) {
+	text := `rchar: 3980
+wchar: 1024
+syscr: 9
+syscw: 2
+read_bytes: 4096
+write_bytes: 8192
+cancelled_write_bytes: 512
+`
+
+	proc, err := ParseProcIO(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(proc, ProcIO{
+		RChar:               3980,
+		WChar:               1024,
+		SyscR:               9,
+		SyscW:               2,
+		ReadBytes:           4096,
+		WriteBytes:          8192,
+		CancelledWriteBytes: 512,
+	}) {
+		t.Error("bad proc io:", proc)
+	}
+}
@@ -0,0 +1,89 @@
+package linux
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ProcSmapsRollup contains the memory mappings statistics of a process summed
+// over all its mappings, all values are in bytes.
+type ProcSmapsRollup struct {
+	Rss            uint64 // Rss
+	Pss            uint64 // Pss
+	PssAnon        uint64 // Pss_Anon
+	PssFile        uint64 // Pss_File
+	PssShmem       uint64 // Pss_Shmem
+	SharedClean    uint64 // Shared_Clean
+	SharedDirty    uint64 // Shared_Dirty
+	PrivateClean   uint64 // Private_Clean
+	PrivateDirty   uint64 // Private_Dirty
+	Referenced     uint64 // Referenced
+	Anonymous      uint64 // Anonymous
+	LazyFree       uint64 // LazyFree
+	AnonHugePages  uint64 // AnonHugePages
+	ShmemPmdMapped uint64 // ShmemPmdMapped
+	FilePmdMapped  uint64 // FilePmdMapped
+	SharedHugetlb  uint64 // Shared_Hugetlb
+	PrivateHugetlb uint64 // Private_Hugetlb
+	Swap           uint64 // Swap
+	SwapPss        uint64 // SwapPss
+	Locked         uint64 // Locked
+}
+
+// ReadProcSmapsRollup returns a ProcSmapsRollup and error, if any, for a PID.
+func ReadProcSmapsRollup(pid int) (proc ProcSmapsRollup, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	proc = parseProcSmapsRollup(readProcFile(pid, "smaps_rollup"))
+	return
+}
+
+// ParseProcSmapsRollup parses the content of /proc/<pid>/smaps_rollup and
+// returns a ProcSmapsRollup and error, if any.
+func ParseProcSmapsRollup(s string) (proc ProcSmapsRollup, err error) {
+	defer func() { err = convertPanicToError(recover()) }()
+	proc = parseProcSmapsRollup(s)
+	return
+}
+
+func parseProcSmapsRollup(s string) (proc ProcSmapsRollup) {
+	intFields := map[string]*uint64{
+		"Rss":             &proc.Rss,
+		"Pss":             &proc.Pss,
+		"Pss_Anon":        &proc.PssAnon,
+		"Pss_File":        &proc.PssFile,
+		"Pss_Shmem":       &proc.PssShmem,
+		"Shared_Clean":    &proc.SharedClean,
+		"Shared_Dirty":    &proc.SharedDirty,
+		"Private_Clean":   &proc.PrivateClean,
+		"Private_Dirty":   &proc.PrivateDirty,
+		"Referenced":      &proc.Referenced,
+		"Anonymous":       &proc.Anonymous,
+		"LazyFree":        &proc.LazyFree,
+		"AnonHugePages":   &proc.AnonHugePages,
+		"ShmemPmdMapped":  &proc.ShmemPmdMapped,
+		"FilePmdMapped":   &proc.FilePmdMapped,
+		"Shared_Hugetlb":  &proc.SharedHugetlb,
+		"Private_Hugetlb": &proc.PrivateHugetlb,
+		"Swap":            &proc.Swap,
+		"SwapPss":         &proc.SwapPss,
+		"Locked":          &proc.Locked,
+	}
+
+	s = skipLine(s) // 00400000-ffffffffff601000 ---p 00000000 00:00 0  [rollup]
+
+	forEachProperty(s, func(key, val string) {
+		if field := intFields[key]; field != nil {
+			val, unit := split(val, ' ')
+			v, e := strconv.ParseUint(val, 10, 64)
+			check(e)
+
+			if strings.EqualFold(unit, "kB") {
+				v *= 1024
+			}
+
+			*field = v
+		}
+	})
+
+	return
+}
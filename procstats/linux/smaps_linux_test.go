@@ -0,0 +1,17 @@
+package linux
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReadProcSmapsRollup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/smaps_rollup"); err != nil {
+		t.Skip("smaps_rollup is not supported by this kernel:", err)
+	}
+	if smaps, err := ReadProcSmapsRollup(os.Getpid()); err != nil {
+		t.Error("ReadProcSmapsRollup:", err)
+	} else if smaps.Rss == 0 {
+		t.Error("ReadProcSmapsRollup: rss cannot be zero")
+	}
+}
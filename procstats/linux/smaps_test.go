@@ -0,0 +1,53 @@
+package linux
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcSmapsRollup(t *testing.T) {
+	text := `55d1f6a4e000-7ffc8a7f4000 ---p 00000000 00:00 0                          [rollup]
+Rss:               10240 kB
+Pss:                8192 kB
+Pss_Anon:           4096 kB
+Pss_File:           3072 kB
+Pss_Shmem:          1024 kB
+Shared_Clean:       2048 kB
+Shared_Dirty:          0 kB
+Private_Clean:      1024 kB
+Private_Dirty:      7168 kB
+Referenced:        10240 kB
+Anonymous:          4096 kB
+LazyFree:              0 kB
+AnonHugePages:         0 kB
+ShmemPmdMapped:        0 kB
+FilePmdMapped:         0 kB
+Shared_Hugetlb:        0 kB
+Private_Hugetlb:       0 kB
+Swap:                 16 kB
+SwapPss:              16 kB
+Locked:                0 kB
+`
+
+	proc, err := ParseProcSmapsRollup(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(proc, ProcSmapsRollup{
+		Rss:          10240 * 1024,
+		Pss:          8192 * 1024,
+		PssAnon:      4096 * 1024,
+		PssFile:      3072 * 1024,
+		PssShmem:     1024 * 1024,
+		SharedClean:  2048 * 1024,
+		PrivateClean: 1024 * 1024,
+		PrivateDirty: 7168 * 1024,
+		Referenced:   10240 * 1024,
+		Anonymous:    4096 * 1024,
+		Swap:         16 * 1024,
+		SwapPss:      16 * 1024,
+	}) {
+		t.Error(proc)
+	}
+}
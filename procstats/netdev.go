@@ -0,0 +1,109 @@
+package procstats
+
+import (
+	"os"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// NetDevMetrics is a metric collector that reports the traffic of the network
+// interfaces seen by processes, which are those of their network namespace.
+//
+// The metrics are tagged with the name of the interface and the direction of
+// the traffic ("receive" or "transmit"). The collector reports nothing on
+// systems other than Linux.
+type NetDevMetrics struct {
+	engine  *stats.Engine
+	pid     int
+	last    map[string]NetDevInfo
+	metrics []netDevMetrics
+}
+
+type netDevMetrics struct {
+	netdev struct {
+		receive  netDevTraffic
+		transmit netDevTraffic
+	} `metric:"netdev"`
+
+	iface string `tag:"interface"`
+}
+
+type netDevTraffic struct {
+	bytes   uint64 `metric:"bytes"         type:"counter"`
+	packets uint64 `metric:"packets.count" type:"counter"`
+	errors  uint64 `metric:"errors.count"  type:"counter"`
+	drops   uint64 `metric:"drops.count"   type:"counter"`
+
+	direction string `tag:"direction"`
+}
+
+// NewNetDevMetrics collects network interface metrics for the current process
+// and reports them to the default stats engine.
+func NewNetDevMetrics() *NetDevMetrics {
+	return NewNetDevMetricsWith(stats.DefaultEngine, os.Getpid())
+}
+
+// NewNetDevMetricsWith collects network interface metrics for the process
+// identified by pid and reports them to eng.
+func NewNetDevMetricsWith(eng *stats.Engine, pid int) *NetDevMetrics {
+	return &NetDevMetrics{engine: eng, pid: pid, last: map[string]NetDevInfo{}}
+}
+
+// Collect satisfies the Collector interface.
+func (n *NetDevMetrics) Collect() {
+	devs, err := CollectNetDevInfo(n.pid)
+	if err != nil {
+		return
+	}
+
+	n.metrics = n.metrics[:0]
+	last := make(map[string]NetDevInfo, len(devs))
+
+	for _, dev := range devs {
+		prev := n.last[dev.Interface]
+
+		m := netDevMetrics{iface: dev.Interface}
+		m.netdev.receive = netDevTraffic{
+			bytes:     dev.RxBytes - prev.RxBytes,
+			packets:   dev.RxPackets - prev.RxPackets,
+			errors:    dev.RxErrors - prev.RxErrors,
+			drops:     dev.RxDropped - prev.RxDropped,
+			direction: "receive",
+		}
+		m.netdev.transmit = netDevTraffic{
+			bytes:     dev.TxBytes - prev.TxBytes,
+			packets:   dev.TxPackets - prev.TxPackets,
+			errors:    dev.TxErrors - prev.TxErrors,
+			drops:     dev.TxDropped - prev.TxDropped,
+			direction: "transmit",
+		}
+		n.metrics = append(n.metrics, m)
+		last[dev.Interface] = dev
+	}
+
+	// Interfaces which were removed are forgotten, their counters start from
+	// zero if they are created again.
+	n.last = last
+	n.engine.Report(n.metrics)
+}
+
+// NetDevInfo contains the counters of a network interface.
+type NetDevInfo struct {
+	Interface string
+
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrors  uint64
+	RxDropped uint64
+
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// CollectNetDevInfo returns the list of network interfaces seen by a pid and
+// an error, if any.
+func CollectNetDevInfo(pid int) ([]NetDevInfo, error) {
+	return collectNetDevInfo(pid)
+}
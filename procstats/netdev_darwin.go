@@ -0,0 +1,5 @@
+package procstats
+
+func collectNetDevInfo(_ int) ([]NetDevInfo, error) {
+	return nil, &OSUnsupportedError{Msg: "network interface metrics are only supported on linux"}
+}
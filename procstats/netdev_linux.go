@@ -0,0 +1,15 @@
+package procstats
+
+import "github.com/segmentio/stats/v5/procstats/linux"
+
+func collectNetDevInfo(pid int) ([]NetDevInfo, error) {
+	devs, err := linux.ReadProcNetDev(pid)
+	if err != nil {
+		return nil, err
+	}
+	info := make([]NetDevInfo, len(devs))
+	for i, dev := range devs {
+		info[i] = NetDevInfo(dev)
+	}
+	return info, nil
+}
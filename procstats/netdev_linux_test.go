@@ -0,0 +1,51 @@
+package procstats
+
+import (
+	"os"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestNetDevMetrics(t *testing.T) {
+	devs, err := CollectNetDevInfo(os.Getpid())
+	if err != nil {
+		t.Skip("network interfaces are not available:", err)
+	}
+
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	NewNetDevMetricsWith(e, os.Getpid()).Collect()
+
+	series := map[string]bool{}
+	for _, m := range h.Measures() {
+		if m.Name != "netdev" {
+			t.Errorf("unexpected measure: %v", m)
+			continue
+		}
+		var iface, direction string
+		for _, tag := range m.Tags {
+			switch tag.Name {
+			case "interface":
+				iface = tag.Value
+			case "direction":
+				direction = tag.Value
+			}
+		}
+		series[iface+":"+direction] = true
+	}
+
+	for _, dev := range devs {
+		for _, direction := range []string{"receive", "transmit"} {
+			if !series[dev.Interface+":"+direction] {
+				t.Errorf("missing metrics of %s traffic on %s: %v", direction, dev.Interface, series)
+			}
+		}
+	}
+}
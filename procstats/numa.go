@@ -0,0 +1,106 @@
+package procstats
+
+import (
+	"os"
+	"strconv"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/procstats/linux"
+)
+
+// NUMAMetrics is a metric collector that reports the memory of the NUMA nodes
+// of the system, and the memory that a process allocated on each of them.
+//
+// Latency-sensitive services pinned to a NUMA node slow down when their memory
+// is allocated on remote nodes, or when the node they run on has no free
+// memory or huge pages left, the metrics are tagged with the numa_node to
+// detect those situations. The collector reports nothing on systems other than
+// Linux.
+type NUMAMetrics struct {
+	engine *stats.Engine
+	pid    int
+	nodes  []numaNodeMetrics
+	pages  []hugePageMetrics
+}
+
+type numaNodeMetrics struct {
+	memory struct {
+		total    uint64 `metric:"total.bytes"            type:"gauge"`
+		free     uint64 `metric:"free.bytes"             type:"gauge"`
+		used     uint64 `metric:"used.bytes"             type:"gauge"`
+		process  uint64 `metric:"process.bytes"          type:"gauge"` // allocated by the process on the node
+		hugePage uint64 `metric:"process.hugepage.bytes" type:"gauge"` // hugetlbfs mappings of the process
+	} `metric:"numa.memory"`
+
+	node string `tag:"numa_node"`
+}
+
+type hugePageMetrics struct {
+	hugepages struct {
+		total   uint64 `metric:"total.count"   type:"gauge"`
+		free    uint64 `metric:"free.count"    type:"gauge"`
+		surplus uint64 `metric:"surplus.count" type:"gauge"`
+	} `metric:"numa.hugepages"`
+
+	node string `tag:"numa_node"`
+	size string `tag:"page_size"`
+}
+
+// NewNUMAMetrics collects NUMA metrics on the current process and reports
+// them to the default stats engine.
+func NewNUMAMetrics() *NUMAMetrics {
+	return NewNUMAMetricsWith(stats.DefaultEngine, os.Getpid())
+}
+
+// NewNUMAMetricsWith collects NUMA metrics on the process identified by pid
+// and reports them to eng.
+func NewNUMAMetricsWith(eng *stats.Engine, pid int) *NUMAMetrics {
+	return &NUMAMetrics{engine: eng, pid: pid}
+}
+
+// Collect satisfies the Collector interface.
+func (n *NUMAMetrics) Collect() {
+	info, err := CollectNUMAInfo(n.pid)
+	if err != nil {
+		return
+	}
+
+	n.nodes = n.nodes[:0]
+	n.pages = n.pages[:0]
+
+	for _, node := range info.Nodes {
+		id := strconv.Itoa(node.ID)
+		mem := info.Process[node.ID]
+
+		m := numaNodeMetrics{node: id}
+		m.memory.total = node.MemTotal
+		m.memory.free = node.MemFree
+		m.memory.used = node.MemUsed
+		m.memory.process = mem.Total
+		m.memory.hugePage = mem.HugePage
+		n.nodes = append(n.nodes, m)
+
+		for _, hp := range node.HugePages {
+			p := hugePageMetrics{node: id, size: strconv.FormatUint(hp.Size, 10)}
+			p.hugepages.total = hp.Total
+			p.hugepages.free = hp.Free
+			p.hugepages.surplus = hp.Surplus
+			n.pages = append(n.pages, p)
+		}
+	}
+
+	n.engine.Report(n.nodes)
+	n.engine.Report(n.pages)
+}
+
+// NUMAInfo contains the memory of the NUMA nodes of the system, and the memory
+// allocated by a process on each of them.
+type NUMAInfo struct {
+	Nodes   []linux.NUMANode
+	Process linux.ProcNUMAMaps
+}
+
+// CollectNUMAInfo returns the NUMAInfo of a pid and an error, if any.
+func CollectNUMAInfo(pid int) (NUMAInfo, error) {
+	return collectNUMAInfo(pid)
+}
@@ -0,0 +1,11 @@
+package procstats
+
+import "github.com/segmentio/stats/v5/procstats/linux"
+
+func collectNUMAInfo(pid int) (info NUMAInfo, err error) {
+	if info.Nodes, err = linux.ReadNUMANodes(); err != nil {
+		return
+	}
+	info.Process, err = linux.ReadProcNUMAMaps(pid)
+	return
+}
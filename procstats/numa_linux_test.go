@@ -0,0 +1,51 @@
+package procstats
+
+import (
+	"os"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestNUMAMetrics(t *testing.T) {
+	info, err := CollectNUMAInfo(os.Getpid())
+	if err != nil || len(info.Nodes) == 0 {
+		t.Skip("NUMA nodes are not available:", err)
+	}
+
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	NewNUMAMetricsWith(e, os.Getpid()).Collect()
+
+	var process uint64
+	nodes := map[string]bool{}
+
+	for _, m := range h.Measures() {
+		if m.Name != "numa.memory" {
+			continue
+		}
+		for _, tag := range m.Tags {
+			if tag.Name == "numa_node" {
+				nodes[tag.Value] = true
+			}
+		}
+		for _, f := range m.Fields {
+			if f.Name == "process.bytes" {
+				process += f.Value.Uint()
+			}
+		}
+	}
+
+	if len(nodes) != len(info.Nodes) {
+		t.Errorf("expected metrics for %d NUMA nodes, got %v", len(info.Nodes), nodes)
+	}
+	if process == 0 {
+		t.Error("the memory of the process was not reported on any NUMA node")
+	}
+}
@@ -0,0 +1,5 @@
+package procstats
+
+func collectNUMAInfo(_ int) (NUMAInfo, error) {
+	return NUMAInfo{}, &OSUnsupportedError{Msg: "NUMA metrics are only supported on linux"}
+}
@@ -0,0 +1,5 @@
+package procstats
+
+func collectPageCacheInfo(_ int) (PageCacheInfo, error) {
+	return PageCacheInfo{}, &OSUnsupportedError{Msg: "page cache metrics are only supported on linux"}
+}
@@ -0,0 +1,23 @@
+package procstats
+
+import "github.com/segmentio/stats/v5/procstats/linux"
+
+func collectPageCacheInfo(pid int) (PageCacheInfo, error) {
+	smaps, err := linux.ReadProcSmapsRollup(pid)
+	if err != nil {
+		return PageCacheInfo{}, err
+	}
+
+	info := PageCacheInfo{
+		AnonResident: smaps.Anonymous,
+		FileMapped:   smaps.PssFile + smaps.PssShmem,
+		Dirty:        smaps.SharedDirty + smaps.PrivateDirty,
+		Swap:         smaps.Swap,
+	}
+
+	if smaps.Rss > smaps.Anonymous {
+		info.FileResident = smaps.Rss - smaps.Anonymous
+	}
+
+	return info, nil
+}
@@ -0,0 +1,48 @@
+package procstats
+
+import (
+	"os"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestPageCacheMetrics(t *testing.T) {
+	if _, err := os.Stat("/proc/self/smaps_rollup"); err != nil {
+		t.Skip("smaps_rollup is not supported by this kernel:", err)
+	}
+
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	NewPageCacheMetricsWith(e, os.Getpid()).Collect()
+
+	fields := map[string]stats.Value{}
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			fields[m.Name+"."+f.Name] = f.Value
+		}
+	}
+
+	for _, name := range []string{
+		"resident.file.bytes",
+		"resident.anonymous.bytes",
+		"resident.page_cache.percent",
+		"mapped.file.pss.bytes",
+		"pages.dirty.bytes",
+		"pages.swapped.bytes",
+	} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("missing metric %s in %v", name, fields)
+		}
+	}
+
+	if v := fields["resident.page_cache.percent"].Float(); v < 0 || v > 100 {
+		t.Errorf("page cache share out of range: %g", v)
+	}
+}
@@ -1,6 +1,7 @@
 package procstats
 
 import (
+	"math"
 	"os"
 	"runtime"
 	"time"
@@ -79,8 +80,9 @@ type procMemory struct {
 
 type procFiles struct {
 	// File descriptors
-	open uint64 `metric:"open.count" type:"gauge"` // fds opened by the process
-	max  uint64 `metric:"open.max"   type:"gauge"` // max number of fds the process can open
+	open    uint64  `metric:"open.count"   type:"gauge"` // fds opened by the process
+	max     uint64  `metric:"open.max"     type:"gauge"` // max number of fds the process can open
+	percent float64 `metric:"open.percent" type:"gauge"` // share of the limit in use
 }
 
 type procThreads struct {
@@ -168,6 +170,10 @@ func (p *ProcMetrics) Collect() {
 
 		p.files.open = m.Files.Open
 		p.files.max = m.Files.Max
+		p.files.percent = 0
+		if p.files.max != 0 && p.files.max != math.MaxUint64 {
+			p.files.percent = 100 * float64(p.files.open) / float64(p.files.max)
+		}
 
 		p.threads.num = m.Threads.Num
 		p.threads.switches.voluntary.count = m.Threads.VoluntaryContextSwitches - p.last.Threads.VoluntaryContextSwitches
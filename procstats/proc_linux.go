@@ -139,6 +139,14 @@ func collectProcInfo(pid int) (info ProcInfo, err error) {
 		}
 	}
 
+	// The cpu controller of cgroup v1 is absent on systems using cgroup v2,
+	// where the quota is read from the unified hierarchy instead.
+	if cpu.Period == 0 && cpu.Quota == 0 {
+		if cg, err := linux.ReadCGroupStats(pid); err == nil && cg.Version == 2 {
+			cpu.Period, cpu.Quota = cg.CPUPeriod, cg.CPUQuota
+		}
+	}
+
 	info = ProcInfo{
 		CPU: cpu,
 
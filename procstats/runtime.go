@@ -0,0 +1,221 @@
+package procstats
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// DefaultRuntimeMetrics is the list of runtime/metrics names reported by
+// RuntimeMetrics collectors when their configuration does not include any.
+var DefaultRuntimeMetrics = []string{
+	"/sched/latencies:seconds",
+	"/sched/pauses/total/gc:seconds",
+	"/sched/gomaxprocs:threads",
+	"/sched/goroutines:goroutines",
+	"/sync/mutex/wait/total:seconds",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/heap/goal:bytes",
+	"/gc/gomemlimit:bytes",
+	"/memory/classes/total:bytes",
+	"/cpu/classes/gc/total:cpu-seconds",
+}
+
+// RuntimeMetricsConfig carries the configuration of collectors created by
+// NewRuntimeMetricsWithConfig.
+//
+// Metric names have the form of the runtime/metrics package, for example
+// "/sched/latencies:seconds". Entries of the Include and Exclude lists match
+// a metric when they are equal to its name, or when they end with a '/' and
+// are a prefix of its name, for example "/gc/" matches all the metrics of the
+// garbage collector.
+type RuntimeMetricsConfig struct {
+	// Engine that metrics are produced on, defaults to stats.DefaultEngine.
+	Engine *stats.Engine
+
+	// Include lists the metrics to report, defaults to DefaultRuntimeMetrics.
+	// The metrics not supported by the Go runtime are ignored.
+	Include []string
+
+	// Exclude lists the metrics not to report, even if they are included.
+	Exclude []string
+}
+
+// RuntimeMetrics is a metric collector that reports metrics from the Go
+// runtime, read with the runtime/metrics package.
+//
+// It complements GoMetrics with the metrics which are not available in
+// runtime.MemStats, like the distribution of scheduling latencies, the time
+// goroutines spent waiting on mutexes, or GOMAXPROCS, and does not stop the
+// world to read them.
+//
+// Metrics are named after their runtime/metrics name under go.runtime, the
+// unit being the last part of the name, for example "/sched/gomaxprocs:threads"
+// is reported as go.runtime.sched.gomaxprocs.threads. Cumulative metrics are
+// reported as counters, incremented by the difference with the previous
+// collection, the others as gauges. Since histograms of the runtime count
+// their values since the program started, the distribution of values seen
+// between two collections is reported as the p50, p90, p99, and max gauges,
+// for example go.runtime.sched.latencies.seconds.p99.
+type RuntimeMetrics struct {
+	engine  *stats.Engine
+	samples []metrics.Sample
+	metrics []runtimeMetric
+}
+
+type runtimeMetric struct {
+	name       string
+	cumulative bool
+	lastUint   uint64
+	lastFloat  float64
+	lastCounts []uint64
+	counts     []uint64
+}
+
+// NewRuntimeMetrics creates a new collector for the Go runtime that produces
+// the DefaultRuntimeMetrics on the default stats engine.
+func NewRuntimeMetrics() *RuntimeMetrics {
+	return NewRuntimeMetricsWith(stats.DefaultEngine)
+}
+
+// NewRuntimeMetricsWith creates a new collector for the Go runtime that
+// produces the DefaultRuntimeMetrics on eng.
+func NewRuntimeMetricsWith(eng *stats.Engine) *RuntimeMetrics {
+	return NewRuntimeMetricsWithConfig(RuntimeMetricsConfig{Engine: eng})
+}
+
+// NewRuntimeMetricsWithConfig creates a new collector for the Go runtime, as
+// configured by config.
+func NewRuntimeMetricsWithConfig(config RuntimeMetricsConfig) *RuntimeMetrics {
+	if config.Engine == nil {
+		config.Engine = stats.DefaultEngine
+	}
+	if config.Include == nil {
+		config.Include = DefaultRuntimeMetrics
+	}
+
+	r := &RuntimeMetrics{engine: config.Engine}
+
+	for _, desc := range metrics.All() {
+		if desc.Kind == metrics.KindBad {
+			continue
+		}
+		if !matchRuntimeMetric(desc.Name, config.Include) || matchRuntimeMetric(desc.Name, config.Exclude) {
+			continue
+		}
+		r.samples = append(r.samples, metrics.Sample{Name: desc.Name})
+		r.metrics = append(r.metrics, runtimeMetric{
+			name:       runtimeMetricName(desc.Name),
+			cumulative: desc.Cumulative,
+		})
+	}
+
+	return r
+}
+
+// Collect satisfies the Collector interface.
+func (r *RuntimeMetrics) Collect() {
+	if len(r.samples) == 0 {
+		return
+	}
+
+	now := time.Now()
+	metrics.Read(r.samples)
+
+	for i := range r.samples {
+		r.metrics[i].report(r.engine, now, r.samples[i].Value)
+	}
+}
+
+func (m *runtimeMetric) report(eng *stats.Engine, now time.Time, value metrics.Value) {
+	switch value.Kind() {
+	case metrics.KindUint64:
+		v := value.Uint64()
+		if m.cumulative {
+			eng.AddAt(now, m.name, v-m.lastUint)
+			m.lastUint = v
+		} else {
+			eng.SetAt(now, m.name, v)
+		}
+
+	case metrics.KindFloat64:
+		v := value.Float64()
+		if m.cumulative {
+			eng.AddAt(now, m.name, v-m.lastFloat)
+			m.lastFloat = v
+		} else {
+			eng.SetAt(now, m.name, v)
+		}
+
+	case metrics.KindFloat64Histogram:
+		h := value.Float64Histogram()
+		if len(m.lastCounts) != len(h.Counts) {
+			m.lastCounts = make([]uint64, len(h.Counts))
+			m.counts = make([]uint64, len(h.Counts))
+		}
+		for i, c := range h.Counts {
+			m.counts[i] = c - m.lastCounts[i]
+		}
+		copy(m.lastCounts, h.Counts)
+
+		eng.SetAt(now, m.name+".p50", histogramQuantile(h.Buckets, m.counts, 0.50))
+		eng.SetAt(now, m.name+".p90", histogramQuantile(h.Buckets, m.counts, 0.90))
+		eng.SetAt(now, m.name+".p99", histogramQuantile(h.Buckets, m.counts, 0.99))
+		eng.SetAt(now, m.name+".max", histogramQuantile(h.Buckets, m.counts, 1))
+	}
+}
+
+// histogramQuantile returns an estimate of the quantile q of the values counted
+// in a histogram of the runtime/metrics package, where counts[i] is the number
+// of values in [buckets[i], buckets[i+1]). The estimate is the upper bound of
+// the bucket that the quantile falls in, or its lower bound when the upper
+// bound is infinite. Zero is returned when the histogram is empty.
+func histogramQuantile(buckets []float64, counts []uint64, q float64) float64 {
+	total := uint64(0)
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	sum := uint64(0)
+	for i, c := range counts {
+		if sum += c; sum >= rank {
+			if upper := buckets[i+1]; !math.IsInf(upper, +1) {
+				return upper
+			}
+			if lower := buckets[i]; !math.IsInf(lower, -1) {
+				return lower
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// runtimeMetricName converts the name of a runtime/metrics metric to the name
+// of the metric reported to the stats engine, for example
+// "/cpu/classes/gc/total:cpu-seconds" is go.runtime.cpu.classes.gc.total.cpu_seconds.
+func runtimeMetricName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	name = strings.NewReplacer("/", ".", ":", ".", "-", "_").Replace(name)
+	return "go.runtime." + name
+}
+
+func matchRuntimeMetric(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if name == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(name, p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package procstats
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	rtstats := NewRuntimeMetricsWith(e)
+
+	for i := 0; i != 3; i++ {
+		runtime.GC() // to get non-zero GC stats
+		rtstats.Collect()
+	}
+
+	values := map[string]stats.Field{}
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			values[m.Name+"."+f.Name] = f
+		}
+	}
+
+	for _, name := range []string{
+		"go.runtime.sched.latencies.seconds.p50",
+		"go.runtime.sched.latencies.seconds.p90",
+		"go.runtime.sched.latencies.seconds.p99",
+		"go.runtime.sched.latencies.seconds.max",
+		"go.runtime.sched.pauses.total.gc.seconds.max",
+		"go.runtime.sync.mutex.wait.total.seconds",
+		"go.runtime.gc.cycles.total.gc_cycles",
+	} {
+		if _, ok := values[name]; !ok {
+			t.Errorf("%s: missing metric", name)
+		}
+	}
+
+	if f := values["go.runtime.sched.gomaxprocs.threads"]; f.Type() != stats.Gauge || f.Value.Int() != int64(runtime.GOMAXPROCS(0)) {
+		t.Errorf("bad gomaxprocs: %v", f)
+	}
+	if f := values["go.runtime.gc.cycles.total.gc_cycles"]; f.Type() != stats.Counter || f.Value.Uint() == 0 {
+		t.Errorf("bad gc cycles: %v", f)
+	}
+}
+
+func TestRuntimeMetricsIncludeExclude(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	rtstats := NewRuntimeMetricsWithConfig(RuntimeMetricsConfig{
+		Engine:  e,
+		Include: []string{"/sched/", "/no/such/metric:bytes"},
+		Exclude: []string{"/sched/latencies:seconds", "/sched/pauses/"},
+	})
+	rtstats.Collect()
+
+	names := map[string]bool{}
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			names[m.Name+"."+f.Name] = true
+		}
+	}
+
+	if !names["go.runtime.sched.gomaxprocs.threads"] || !names["go.runtime.sched.goroutines.goroutines"] {
+		t.Errorf("missing included metrics: %v", names)
+	}
+	for name := range names {
+		switch name {
+		case "go.runtime.sched.gomaxprocs.threads", "go.runtime.sched.goroutines.goroutines":
+		default:
+			if !strings.HasPrefix(name, "go.runtime.sched.") {
+				t.Errorf("%s: metric was not included", name)
+			}
+			if name == "go.runtime.sched.latencies.seconds.p50" || name == "go.runtime.sched.pauses.total.gc.seconds.p50" {
+				t.Errorf("%s: metric was not excluded", name)
+			}
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(+1)}
+
+	for _, test := range []struct {
+		counts []uint64
+		q      float64
+		value  float64
+	}{
+		{counts: []uint64{0, 0, 0, 0}, q: 0.5, value: 0},
+		{counts: []uint64{0, 10, 0, 0}, q: 0.5, value: 2},
+		{counts: []uint64{0, 5, 4, 1}, q: 0.5, value: 2},
+		{counts: []uint64{0, 5, 4, 1}, q: 0.9, value: 4},
+		{counts: []uint64{0, 5, 4, 1}, q: 1, value: 4},
+		{counts: []uint64{1, 0, 0, 0}, q: 1, value: 1},
+	} {
+		if value := histogramQuantile(buckets, test.counts, test.q); value != test.value {
+			t.Errorf("histogramQuantile(%v, %g): want %g, got %g", test.counts, test.q, test.value, value)
+		}
+	}
+}
+
+func TestRuntimeMetricName(t *testing.T) {
+	if name := runtimeMetricName("/cpu/classes/gc/total:cpu-seconds"); name != "go.runtime.cpu.classes.gc.total.cpu_seconds" {
+		t.Error("bad metric name:", name)
+	}
+}
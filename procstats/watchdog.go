@@ -0,0 +1,145 @@
+package procstats
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// DefaultMaxRestartBackoff is the default maximum delay before restarting a
+// stalled collector.
+const DefaultMaxRestartBackoff = 5 * time.Minute
+
+// collectorWorker runs collections in a goroutine locked to its OS thread,
+// recording when the ongoing collection started so the watchdog can detect
+// that it stalled.
+type collectorWorker struct {
+	stop    chan struct{}
+	join    chan struct{}
+	started atomic.Int64 // unix nanoseconds, zero when not collecting
+	done    atomic.Int64 // number of completed collections
+}
+
+func startCollectorWorker(config Config) *collectorWorker {
+	w := &collectorWorker{
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(w.join)
+
+		// See StartCollectorWith for why the OS thread is locked. A stalled
+		// worker keeps its thread until the collection returns, the next one
+		// runs on a new thread.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		ticker := time.NewTicker(config.CollectInterval)
+		defer ticker.Stop()
+
+		for {
+			w.collect(config.Collector)
+
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+
+			select {
+			case <-ticker.C:
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+
+	return w
+}
+
+func (w *collectorWorker) collect(c Collector) {
+	w.started.Store(time.Now().UnixNano())
+	c.Collect()
+	w.started.Store(0)
+	w.done.Add(1)
+}
+
+// stalled returns true if the ongoing collection started more than timeout
+// before now.
+func (w *collectorWorker) stalled(now time.Time, timeout time.Duration) bool {
+	started := w.started.Load()
+	return started != 0 && now.Sub(time.Unix(0, started)) > timeout
+}
+
+// watch runs the collector of config until stop is closed, restarting it with
+// exponential backoff when collections stall.
+func watch(config Config, stop <-chan struct{}) {
+	var tags []stats.Tag
+	if len(config.Name) != 0 {
+		tags = []stats.Tag{stats.T("collector", config.Name)}
+	}
+
+	checkInterval := config.StallTimeout / 4
+	if checkInterval <= 0 {
+		checkInterval = config.StallTimeout
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	backoff := time.Duration(0)
+	worker := startCollectorWorker(config)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if !worker.stalled(now, config.StallTimeout) {
+				// The delay is reset once a collection completed after a
+				// restart.
+				if backoff != 0 && worker.done.Load() != 0 {
+					backoff = 0
+				}
+				continue
+			}
+
+			config.Engine.Incr("procstats.collector.stalled", tags...)
+
+			// The stalled worker exits if its collection ever returns.
+			close(worker.stop)
+
+			backoff = nextRestartBackoff(backoff, config.CollectInterval, config.MaxRestartBackoff)
+
+			select {
+			case <-time.After(backoff):
+			case <-stop:
+				return
+			}
+
+			worker = startCollectorWorker(config)
+
+		case <-stop:
+			// Waits for the ongoing collection to complete, unless it stalls.
+			close(worker.stop)
+			select {
+			case <-worker.join:
+			case <-time.After(config.StallTimeout):
+			}
+			return
+		}
+	}
+}
+
+func nextRestartBackoff(backoff, initial, limit time.Duration) time.Duration {
+	if backoff == 0 {
+		backoff = initial
+	} else {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
@@ -0,0 +1,83 @@
+package procstats
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestCollectorWatchdog(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", h)
+
+	// The first collection hangs until the end of the test, the following
+	// ones complete immediately.
+	unblock := make(chan struct{})
+	var release sync.Once
+	defer release.Do(func() { close(unblock) })
+
+	var calls atomic.Int64
+
+	c := StartCollectorWith(Config{
+		CollectInterval: time.Millisecond,
+		StallTimeout:    10 * time.Millisecond,
+		Name:            "test",
+		Engine:          e,
+		Collector: CollectorFunc(func() {
+			if calls.Add(1) == 1 {
+				<-unblock
+			}
+		}),
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load() < 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("the stalled collector was not restarted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Close()
+	release.Do(func() { close(unblock) })
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatalf("expected 1 measure, got %d: %v", len(measures), measures)
+	}
+
+	expect := stats.Measure{
+		Name:   "procstats.collector",
+		Fields: []stats.Field{stats.MakeField("stalled", 1, stats.Counter)},
+		Tags:   []stats.Tag{stats.T("collector", "test")},
+	}
+	if !measures[0].Equal(expect) {
+		t.Errorf("bad measure:\n- expected: %v\n- found:    %v", expect, measures[0])
+	}
+}
+
+func TestNextRestartBackoff(t *testing.T) {
+	var backoff time.Duration
+	var found []time.Duration
+
+	for i := 0; i != 5; i++ {
+		backoff = nextRestartBackoff(backoff, time.Second, 5*time.Second)
+		found = append(found, backoff)
+	}
+
+	expect := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range expect {
+		if found[i] != expect[i] {
+			t.Errorf("bad backoff sequence:\n- expected: %v\n- found:    %v", expect, found)
+			break
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// DisableFamilies stops exposing the metric families with the given names,
+// which are the exposed names of families (after prefix trimming and
+// sanitization) like "http_req_count", a trailing '*' matches all families
+// with the given prefix.
+//
+// The handler keeps collecting the measures of disabled families, so their
+// series are exposed with up to date values when enabled again. This is
+// intended as an emergency response to scrapers overloaded by a single metric.
+func (h *Handler) DisableFamilies(names ...string) {
+	h.metrics.mutex.Lock()
+	defer h.metrics.mutex.Unlock()
+
+	for _, name := range names {
+		if !contains(h.metrics.disabledFamilies, name) {
+			h.metrics.disabledFamilies = append(h.metrics.disabledFamilies, name)
+		}
+	}
+}
+
+// EnableFamilies exposes again the metric families disabled by a call to
+// DisableFamilies with the same names.
+func (h *Handler) EnableFamilies(names ...string) {
+	h.metrics.mutex.Lock()
+	defer h.metrics.mutex.Unlock()
+
+	disabled := h.metrics.disabledFamilies[:0]
+	for _, name := range h.metrics.disabledFamilies {
+		if !contains(names, name) {
+			disabled = append(disabled, name)
+		}
+	}
+	h.metrics.disabledFamilies = disabled
+}
+
+// DisabledFamilies returns the sorted list of names passed to DisableFamilies
+// which were not enabled again.
+func (h *Handler) DisabledFamilies() []string {
+	h.metrics.mutex.RLock()
+	names := append([]string{}, h.metrics.disabledFamilies...)
+	h.metrics.mutex.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// PurgeFamilies removes the metric families matching the given names from the
+// handler, names are matched like in DisableFamilies. It returns the number of
+// families removed.
+//
+// Families are created again by the next measures the handler receives, the
+// families should also be disabled to stop exposing them.
+func (h *Handler) PurgeFamilies(names ...string) int {
+	if len(names) == 0 {
+		return 0
+	}
+
+	return h.metrics.purge(names)
+}
+
+func (store *metricStore) purge(names []string) int {
+	n := 0
+
+	for i := range store.shards {
+		shard := &store.shards[i]
+		shard.mutex.Lock()
+
+		for key, entry := range shard.entries {
+			if matchFamilyName(entryFamilyName(entry), names) {
+				delete(shard.entries, key)
+				n++
+			}
+		}
+
+		shard.mutex.Unlock()
+	}
+
+	return n
+}
+
+// ServeAdmin is an HTTP handler exposing an admin endpoint to disable, enable,
+// or purge metric families at runtime.
+//
+// GET requests return the list of disabled families as JSON. POST requests
+// apply the action given by the "action" form value ("disable", "enable", or
+// "purge") to the families named by the "name" form values, which may be
+// repeated, and return the list of disabled families as well as the number of
+// purged families.
+//
+// Like ServeFind, the endpoint is not served by ServeHTTP, programs have to
+// mount it explicitly, usually on a listener that is not reachable by the
+// scrapers.
+func (h *Handler) ServeAdmin(res http.ResponseWriter, req *http.Request) {
+	var purged int
+
+	switch req.Method {
+	case "GET", "HEAD":
+	case "POST":
+		if err := req.ParseForm(); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		names := req.PostForm["name"]
+		if len(names) == 0 {
+			http.Error(res, "missing family name", http.StatusBadRequest)
+			return
+		}
+
+		switch action := req.PostForm.Get("action"); action {
+		case "disable":
+			h.DisableFamilies(names...)
+		case "enable":
+			h.EnableFamilies(names...)
+		case "purge":
+			purged = h.PurgeFamilies(names...)
+		default:
+			http.Error(res, "unsupported action: "+action, http.StatusBadRequest)
+			return
+		}
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(struct {
+		Disabled []string `json:"disabled"`
+		Purged   int      `json:"purged"`
+	}{
+		Disabled: h.DisabledFamilies(),
+		Purged:   purged,
+	})
+}
+
+// disabled reports whether the family of entry must not be exposed, the store
+// mutex must be held.
+func (store *metricStore) disabled(entry *metricEntry) bool {
+	return len(store.disabledFamilies) != 0 && matchFamilyName(entryFamilyName(entry), store.disabledFamilies)
+}
+
+func entryFamilyName(entry *metricEntry) string {
+	return string(appendMetricScopedName(nil, entry.scope, entry.name))
+}
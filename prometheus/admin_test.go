@@ -0,0 +1,107 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestDisableFamilies(t *testing.T) {
+	now := time.Now()
+
+	handler := &Handler{}
+	handler.HandleMeasures(now,
+		stats.Measure{Name: "http", Fields: []stats.Field{stats.MakeField("req", 1, stats.Counter)}},
+		stats.Measure{Name: "http", Fields: []stats.Field{stats.MakeField("err", 1, stats.Counter)}},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 1, stats.Gauge)}},
+	)
+
+	scrape := func() string {
+		b := &bytes.Buffer{}
+		handler.WriteStats(b)
+		return b.String()
+	}
+
+	handler.DisableFamilies("http_*")
+
+	if s := scrape(); strings.Contains(s, "http_") || !strings.Contains(s, "B ") {
+		t.Errorf("disabled families are exposed:\n%s", s)
+	}
+
+	// Measures of disabled families are still collected.
+	handler.HandleMeasures(now,
+		stats.Measure{Name: "http", Fields: []stats.Field{stats.MakeField("req", 1, stats.Counter)}},
+	)
+
+	if names := handler.DisabledFamilies(); !reflect.DeepEqual(names, []string{"http_*"}) {
+		t.Errorf("bad disabled families: %v", names)
+	}
+
+	handler.EnableFamilies("http_*")
+
+	if s := scrape(); !strings.Contains(s, "http_req 2 ") || !strings.Contains(s, "http_err 1 ") {
+		t.Errorf("enabled families are not exposed:\n%s", s)
+	}
+
+	if n := handler.PurgeFamilies("http_err"); n != 1 {
+		t.Errorf("bad number of purged families: %d", n)
+	}
+
+	if s := scrape(); strings.Contains(s, "http_err") || !strings.Contains(s, "http_req") {
+		t.Errorf("purged families are exposed:\n%s", s)
+	}
+}
+
+func TestServeAdmin(t *testing.T) {
+	handler := &Handler{}
+	handler.HandleMeasures(time.Now(),
+		stats.Measure{Name: "http", Fields: []stats.Field{stats.MakeField("req", 1, stats.Counter)}},
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(handler.ServeAdmin))
+	defer server.Close()
+
+	type state struct {
+		Disabled []string `json:"disabled"`
+		Purged   int      `json:"purged"`
+	}
+
+	post := func(action string, names ...string) (state, int) {
+		res, err := http.PostForm(server.URL, url.Values{"action": {action}, "name": names})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var s state
+		json.NewDecoder(res.Body).Decode(&s)
+		return s, res.StatusCode
+	}
+
+	if s, status := post("disable", "http_req", "other"); status != http.StatusOK || !reflect.DeepEqual(s.Disabled, []string{"http_req", "other"}) {
+		t.Errorf("bad response to disable: %d %+v", status, s)
+	}
+
+	if s, status := post("enable", "other"); status != http.StatusOK || !reflect.DeepEqual(s.Disabled, []string{"http_req"}) {
+		t.Errorf("bad response to enable: %d %+v", status, s)
+	}
+
+	if s, status := post("purge", "http_req"); status != http.StatusOK || s.Purged != 1 {
+		t.Errorf("bad response to purge: %d %+v", status, s)
+	}
+
+	if _, status := post("explode", "http_req"); status != http.StatusBadRequest {
+		t.Errorf("bad status for an unsupported action: %d", status)
+	}
+
+	if _, status := post("disable"); status != http.StatusBadRequest {
+		t.Errorf("bad status for a missing family name: %d", status)
+	}
+}
@@ -20,17 +20,21 @@ func appendMetricScopedName(b []byte, scope, name string) []byte {
 	return appendMetricName(b, name)
 }
 
-func appendMetric(b []byte, metric metric) []byte {
+func appendMetric(b []byte, metric metric, e nameEscaping) []byte {
 	if len(metric.help) != 0 {
-		b = appendMetricHelp(b, metric.scope, metric.rootName(), metric.help)
+		b = appendMetricHelp(b, e, metric.scope, metric.rootName(), metric.help)
 	}
 
 	if metric.mtype != untyped {
-		b = appendMetricType(b, metric.scope, metric.rootName(), metric.mtype.String())
+		b = appendMetricType(b, e, metric.scope, metric.rootName(), metric.mtype.String())
 	}
 
-	b = appendMetricScopedName(b, metric.scope, metric.name)
-	b = appendLabels(b, metric.labels...)
+	if e == underscoreEscaping {
+		b = appendMetricScopedName(b, metric.scope, metric.name)
+		b = e.appendLabels(b, metric.labels...)
+	} else {
+		b = e.appendSeries(b, e.metricName(metric.scope, metric.name), "", metric.labels)
+	}
 	b = append(b, ' ')
 	b = strconv.AppendFloat(b, metric.value, 'g', -1, 64)
 
@@ -44,23 +48,23 @@ func appendMetric(b []byte, metric metric) []byte {
 	return append(b, '\n')
 }
 
-func appendMetricHelp(b []byte, scope, name, help string) []byte {
+func appendMetricHelp(b []byte, e nameEscaping, scope, name, help string) []byte {
 	b = append(b, "# HELP "...)
-	b = appendMetricScopedName(b, scope, name)
+	b = e.appendMetricName(b, scope, name)
 	b = append(b, ' ')
 	b = appendEscapedString(b, help, indexOfSpecialHelpByte)
 	return append(b, '\n')
 }
 
-func appendMetricType(b []byte, scope, name, mtype string) []byte {
+func appendMetricType(b []byte, e nameEscaping, scope, name, mtype string) []byte {
 	b = append(b, "# TYPE "...)
-	b = appendMetricScopedName(b, scope, name)
+	b = e.appendMetricName(b, scope, name)
 	b = append(b, ' ')
 	b = append(b, mtype...)
 	return append(b, '\n')
 }
 
-func appendLabels(b []byte, labels ...label) []byte {
+func (e nameEscaping) appendLabels(b []byte, labels ...label) []byte {
 	if len(labels) != 0 {
 		b = append(b, '{')
 
@@ -68,7 +72,7 @@ func appendLabels(b []byte, labels ...label) []byte {
 			if i != 0 {
 				b = append(b, ',')
 			}
-			b = appendLabel(b, label)
+			b = e.appendLabel(b, label)
 		}
 
 		b = append(b, '}')
@@ -76,8 +80,8 @@ func appendLabels(b []byte, labels ...label) []byte {
 	return b
 }
 
-func appendLabel(b []byte, label label) []byte {
-	b = appendLabelName(b, label.name)
+func (e nameEscaping) appendLabel(b []byte, label label) []byte {
+	b = e.appendLabelName(b, label.name)
 	b = append(b, '=', '"')
 	b = appendEscapedString(b, label.value, indexOfSpecialLabelValueByte)
 	return append(b, '"')
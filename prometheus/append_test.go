@@ -68,7 +68,7 @@ global_hello_world{question="\"???\"\n",answer="42"} 0.5 1496614320000
 func TestAppendMetric(t *testing.T) {
 	for _, test := range testMetrics {
 		t.Run(test.scenario, func(t *testing.T) {
-			b := appendMetric(nil, test.metric)
+			b := appendMetric(nil, test.metric, underscoreEscaping)
 			s := string(b)
 
 			if s != test.string {
@@ -86,7 +86,7 @@ func BenchmarkAppendMetric(b *testing.B) {
 	for _, test := range testMetrics {
 		b.Run(test.scenario, func(b *testing.B) {
 			for i := 0; i != b.N; i++ {
-				appendMetric(a[:0], test.metric)
+				appendMetric(a[:0], test.metric, underscoreEscaping)
 			}
 		})
 	}
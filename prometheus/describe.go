@@ -0,0 +1,103 @@
+package prometheus
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/segmentio/stats/v5"
+)
+
+// SetMetricHelp sets the description of the metric family exposed under name,
+// for example "http_req_count", which is written in its # HELP line.
+func (h *Handler) SetMetricHelp(name, help string) {
+	h.descriptions.set(name, func(d *metricDescription) { d.help = help })
+}
+
+// DescribeMetric declares the type and description of the metric family
+// exposed under name.
+//
+// Described families are exposed with their # HELP and # TYPE lines even when
+// they have no series, because they were not reported yet or their series
+// expired, so scrapers and humans see a consistent set of families. The type
+// only applies to families without series, the type of the series reported to
+// the handler takes precedence.
+func (h *Handler) DescribeMetric(name string, ftype stats.FieldType, help string) {
+	h.descriptions.set(name, func(d *metricDescription) { d.mtype, d.help = typeOf(ftype), help })
+}
+
+type metricDescription struct {
+	mtype metricType // untyped when only the help was set
+	help  string
+}
+
+// metricDescriptions stores the descriptions of metric families, indexed by
+// their exposed names.
+type metricDescriptions struct {
+	mutex    sync.RWMutex
+	families map[string]metricDescription
+}
+
+func (d *metricDescriptions) set(name string, update func(*metricDescription)) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.families == nil {
+		d.families = make(map[string]metricDescription)
+	}
+
+	desc := d.families[name]
+	update(&desc)
+	d.families[name] = desc
+}
+
+func (d *metricDescriptions) len() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.families)
+}
+
+// help returns the description of the family, or help if it has none.
+func (d *metricDescriptions) help(family, help string) string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if desc, ok := d.families[family]; ok && len(desc.help) != 0 {
+		return desc.help
+	}
+	return help
+}
+
+// missing returns the typed families which are not in seen, sorted by name.
+func (d *metricDescriptions) missing(seen map[string]bool) []protoFamily {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var families []protoFamily
+
+	for name, desc := range d.families {
+		if desc.mtype != untyped && !seen[name] {
+			families = append(families, protoFamily{mtype: desc.mtype, name: name, help: desc.help})
+		}
+	}
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+	return families
+}
+
+// describeFamilies sets the help of the families which have a description,
+// and appends the described families which have no series.
+func (d *metricDescriptions) describeFamilies(families []protoFamily) []protoFamily {
+	if d.len() == 0 {
+		return families
+	}
+
+	seen := make(map[string]bool, len(families))
+
+	for i := range families {
+		f := &families[i]
+		f.help = d.help(f.name, f.help)
+		seen[f.name] = true
+	}
+
+	return append(families, d.missing(seen)...)
+}
@@ -0,0 +1,62 @@
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestHandlerDescribeMetric(t *testing.T) {
+	handler := &Handler{DisableTimestamps: true}
+	handler.SetMetricHelp("A", "The A counter.")
+	handler.DescribeMetric("B", stats.Gauge, "The B gauge.")
+	handler.DescribeMetric("C", stats.Counter, "")
+
+	get := func(accept string) string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Body.String()
+	}
+
+	if s, expect := get(""), "# HELP B The B gauge.\n# TYPE B gauge\n\n# TYPE C counter\n"; s != expect {
+		t.Errorf("bad output without series:\n%s", s)
+	}
+
+	handler.HandleMeasures(time.Now(),
+		stats.Measure{Fields: []stats.Field{stats.MakeField("A", 1, stats.Counter)}},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 2, stats.Gauge)}},
+	)
+
+	if s, expect := get(""), "# HELP A The A counter.\n# TYPE A counter\nA 1\n\n# HELP B The B gauge.\n# TYPE B gauge\nB 2\n\n# TYPE C counter\n"; s != expect {
+		t.Errorf("bad output with series:\n%s", s)
+	}
+
+	s := get("application/openmetrics-text")
+	if !strings.HasPrefix(s, "# HELP A The A counter.\n# TYPE A counter\nA_total 1\n") || !strings.HasSuffix(s, "# TYPE C counter\n# EOF\n") {
+		t.Errorf("bad openmetrics output:\n%s", s)
+	}
+}
+
+func TestHandlerStructTagHelp(t *testing.T) {
+	var metrics struct {
+		jobs struct {
+			done int `metric:"done" type:"counter" help:"Number of completed jobs."`
+		} `metric:"jobs"`
+	}
+	metrics.jobs.done = 3
+
+	handler := &Handler{DisableTimestamps: true}
+	stats.NewEngine("describe.test", handler).Report(&metrics)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+
+	if s := res.Body.String(); !strings.Contains(s, "# HELP describe_test_jobs_done Number of completed jobs.\n# TYPE describe_test_jobs_done counter\ndescribe_test_jobs_done 3\n") {
+		t.Errorf("the help of the struct tag was not exposed:\n%s", s)
+	}
+}
@@ -0,0 +1,69 @@
+package prometheus
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// maxExemplarRunes is the maximum length of the labels of an exemplar, names
+// and values combined, allowed by the OpenMetrics specification.
+const maxExemplarRunes = 128
+
+// exemplar is an observation carrying labels which identify where it came
+// from, typically a trace ID, exposed alongside the counter or histogram
+// bucket it was recorded in.
+//
+// Exemplars are immutable once created, which allows sharing them between the
+// metric states and the snapshots taken when collecting metrics.
+type exemplar struct {
+	labels labels
+	value  float64
+	time   time.Time
+}
+
+// newExemplar returns an exemplar for value with a copy of labels, or nil if
+// the labels exceed the length limit of exemplars.
+func newExemplar(labels labels, value float64, time time.Time) *exemplar {
+	n := 0
+	for _, l := range labels {
+		n += utf8.RuneCountInString(l.name) + utf8.RuneCountInString(l.value)
+	}
+	if n > maxExemplarRunes {
+		return nil
+	}
+	return &exemplar{
+		labels: labels.copy(),
+		value:  value,
+		time:   time,
+	}
+}
+
+// splitExemplarLabels moves the labels named in names from l to ex, preserving
+// their order, and returns both lists.
+func splitExemplarLabels(l, ex labels, names []string) (labels, labels) {
+	i := 0
+
+	for _, x := range l {
+		if contains(names, x.name) {
+			ex = append(ex, x)
+		} else {
+			l[i] = x
+			i++
+		}
+	}
+
+	for j := i; j < len(l); j++ {
+		l[j] = label{}
+	}
+
+	return l[:i], ex
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestServeHTTPExemplars(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Measure: "rpc", Field: "latency"}: {stats.ValueOf(0.5), stats.ValueOf(1.0)},
+		},
+		ExemplarTags: []string{"trace_id"},
+	}
+
+	handler.HandleMeasures(now,
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "get"), stats.T("trace_id", "abc")},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "get")},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("latency", 0.25, stats.Histogram)},
+			Tags:   []stats.Tag{stats.T("trace_id", "def")},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("latency", 2.0, stats.Histogram)},
+			Tags:   []stats.Tag{stats.T("trace_id", "ghi")},
+		},
+	)
+
+	get := func(accept string) (string, string) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Header().Get("Content-Type"), res.Body.String()
+	}
+
+	contentType, body := get("application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+
+	if contentType != openMetricsContentType {
+		t.Error("bad content type:", contentType)
+	}
+
+	const expect = `# TYPE rpc_count counter
+rpc_count_total{method="get"} 2 1496614320 # {trace_id="abc"} 1 1496614320
+rpc_count_created{method="get"} 1496614320 1496614320
+# TYPE rpc_latency histogram
+rpc_latency_bucket{le="0.5"} 1 1496614320 # {trace_id="def"} 0.25 1496614320
+rpc_latency_bucket{le="1"} 1 1496614320
+rpc_latency_bucket{le="+Inf"} 2 1496614320 # {trace_id="ghi"} 2 1496614320
+rpc_latency_count 2 1496614320
+rpc_latency_sum 2.25 1496614320
+rpc_latency_created 1496614320 1496614320
+# EOF
+`
+
+	if body != expect {
+		t.Errorf("bad OpenMetrics output:\n- expected:\n%s\n- found:\n%s", expect, body)
+	}
+
+	// The classic text format has no exemplars, and the exemplar tags are
+	// never used as labels.
+	if _, body := get(""); strings.Contains(body, "trace_id") {
+		t.Errorf("exemplar labels found in the text output:\n%s", body)
+	}
+}
+
+func TestSplitExemplarLabels(t *testing.T) {
+	l := labels{{"method", "get"}, {"span_id", "1"}, {"status", "200"}, {"trace_id", "2"}}
+
+	l, ex := splitExemplarLabels(l, nil, []string{"trace_id", "span_id"})
+
+	if !l.equal(labels{{"method", "get"}, {"status", "200"}}) {
+		t.Error("bad labels:", l)
+	}
+	if !ex.equal(labels{{"span_id", "1"}, {"trace_id", "2"}}) {
+		t.Error("bad exemplar labels:", ex)
+	}
+}
+
+func TestNewExemplarTooLong(t *testing.T) {
+	if ex := newExemplar(labels{{"trace_id", strings.Repeat("x", 121)}}, 1, time.Time{}); ex != nil {
+		t.Error("expected exemplars with labels longer than 128 runes to be dropped")
+	}
+	if ex := newExemplar(labels{{"trace_id", strings.Repeat("x", 120)}}, 1, time.Time{}); ex == nil {
+		t.Error("expected exemplars with labels of 128 runes to be kept")
+	}
+}
+
+func TestHandlerExemplarTag(t *testing.T) {
+	var h stats.ExemplarHandler = &Handler{ExemplarTags: []string{"trace_id"}}
+
+	if !h.ExemplarTag("trace_id") {
+		t.Error("the exemplar tags of the handler must be reported")
+	}
+	if h.ExemplarTag("method") {
+		t.Error("tags used as labels must not be reported as exemplar tags")
+	}
+}
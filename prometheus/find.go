@@ -0,0 +1,140 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServeFind is an HTTP handler exposing a debug endpoint which returns the
+// state of the metric families matching the query as JSON, which is easier to
+// work with than grepping the full exposition when debugging a single metric.
+//
+// The query supports two parameters:
+//
+//   - name selects the metric family by its exposed name (after prefix
+//     trimming and sanitization), for example "http_req_count". The parameter
+//     may be repeated to select multiple families, and a trailing '*' matches
+//     all families with the given prefix.
+//
+//   - label filters series by label, in the form "name=value". The parameter
+//     may be repeated, in which case series must match all labels.
+//
+// The endpoint is not served by ServeHTTP, programs mount it explicitly, for
+// example:
+//
+//	http.HandleFunc("/metrics/find", handler.ServeFind)
+func (h *Handler) ServeFind(res http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET", "HEAD":
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+	names := query["name"]
+	filter, ok := parseLabelFilter(query["label"])
+	if !ok {
+		http.Error(res, "malformed label filter, expected name=value", http.StatusBadRequest)
+		return
+	}
+
+	families := h.find(names, filter)
+
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(families)
+}
+
+type foundFamily struct {
+	Name   string        `json:"name"`
+	Type   string        `json:"type"`
+	Help   string        `json:"help,omitempty"`
+	Series []foundSeries `json:"series"`
+}
+
+type foundSeries struct {
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels"`
+	Value      float64           `json:"value"`
+	LastUpdate time.Time         `json:"last_update"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+}
+
+func (h *Handler) find(names []string, filter labels) []foundFamily {
+	metrics := h.metrics.collect(make([]metric, 0, 64))
+	sort.Sort(byNameAndLabels(metrics))
+
+	timeout := h.timeout()
+	families := []foundFamily{}
+	b := make([]byte, 0, 128)
+
+	for _, m := range metrics {
+		b = appendMetricScopedName(b[:0], m.scope, m.rootName())
+		family := string(b)
+
+		if !matchFamilyName(family, names) || !m.labels.contains(filter) {
+			continue
+		}
+
+		if n := len(families); n == 0 || families[n-1].Name != family {
+			families = append(families, foundFamily{
+				Name: family,
+				Type: m.mtype.String(),
+				Help: h.descriptions.help(family, m.help),
+			})
+		}
+
+		f := &families[len(families)-1]
+		f.Series = append(f.Series, foundSeries{
+			Name:       string(appendMetricScopedName(b[:0], m.scope, m.name)),
+			Labels:     m.labels.stringMap(),
+			Value:      m.value,
+			LastUpdate: m.time,
+			ExpiresAt:  m.time.Add(h.seriesTimeout(m.labels, timeout)),
+		})
+	}
+
+	return families
+}
+
+// seriesTimeout returns the timeout of the series with the given labels, the
+// one configured in LabelTimeouts if any, or the default timeout otherwise,
+// matching the expiration applied by cleanups.
+func (h *Handler) seriesTimeout(labels labels, timeout time.Duration) time.Duration {
+	if t := h.labelTimeout(labels); t != 0 {
+		return t
+	}
+	return timeout
+}
+
+func matchFamilyName(family string, names []string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, name := range names {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			if strings.HasPrefix(family, prefix) {
+				return true
+			}
+		} else if family == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLabelFilter(params []string) (filter labels, ok bool) {
+	for _, p := range params {
+		name, value, found := strings.Cut(p, "=")
+		if !found || len(name) == 0 {
+			return nil, false
+		}
+		filter = append(filter, label{name: name, value: value})
+	}
+	return filter, true
+}
@@ -0,0 +1,143 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestServeFind(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		MetricTimeout: time.Minute,
+		LabelTimeouts: map[string]time.Duration{"b": 10 * time.Second},
+	}
+	handler.HandleMeasures(now,
+		stats.Measure{Name: "http", Fields: []stats.Field{stats.MakeField("req", 1, stats.Counter)}},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 1, stats.Gauge)}, Tags: []stats.Tag{stats.T("a", "1"), stats.T("b", "2")}},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 42, stats.Gauge)}, Tags: []stats.Tag{stats.T("a", "2")}},
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics/", handler)
+	mux.HandleFunc("/metrics/find", handler.ServeFind)
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		query  string
+		expect []foundFamily
+	}{
+		{
+			query: "name=B&label=a=1",
+			expect: []foundFamily{{
+				Name: "B",
+				Type: "gauge",
+				Series: []foundSeries{{
+					Name:       "B",
+					Labels:     map[string]string{"a": "1", "b": "2"},
+					Value:      1,
+					LastUpdate: now,
+					ExpiresAt:  now.Add(10 * time.Second),
+				}},
+			}},
+		},
+		{
+			query: "name=http_*",
+			expect: []foundFamily{{
+				Name: "http_req",
+				Type: "counter",
+				Series: []foundSeries{{
+					Name:       "http_req",
+					Labels:     map[string]string{},
+					Value:      1,
+					LastUpdate: now,
+					ExpiresAt:  now.Add(time.Minute),
+				}},
+			}},
+		},
+		{
+			query: "name=B&label=a=2",
+			expect: []foundFamily{{
+				Name: "B",
+				Type: "gauge",
+				Series: []foundSeries{{
+					Name:       "B",
+					Labels:     map[string]string{"a": "2"},
+					Value:      42,
+					LastUpdate: now,
+					ExpiresAt:  now.Add(time.Minute),
+				}},
+			}},
+		},
+		{
+			query:  "name=C",
+			expect: []foundFamily{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			res, err := http.Get(server.URL + "/metrics/find?" + test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				t.Fatal("bad status:", res.StatusCode)
+			}
+
+			var found []foundFamily
+			if err := json.NewDecoder(res.Body).Decode(&found); err != nil {
+				t.Fatal(err)
+			}
+
+			if !equalFamilies(found, test.expect) {
+				t.Errorf("bad families:\nexpected: %+v\nfound:    %+v", test.expect, found)
+			}
+		})
+	}
+
+	t.Run("malformed label", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/metrics/find?label=oops")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Error("bad status:", res.StatusCode)
+		}
+	})
+}
+
+func TestServeHTTPFindSuffix(t *testing.T) {
+	handler := &Handler{}
+	handler.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "http",
+		Fields: []stats.Field{stats.MakeField("req", 1, stats.Counter)},
+	})
+
+	// Paths ending in /find are not reserved by ServeHTTP, handlers mounted
+	// on a prefix expose the metrics on all paths.
+	req := httptest.NewRequest("GET", "/metrics/find", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if contentType := res.Header().Get("Content-Type"); contentType != textContentType {
+		t.Error("bad content type:", contentType)
+	}
+}
+
+func equalFamilies(f1, f2 []foundFamily) bool {
+	b1, _ := json.Marshal(f1)
+	b2, _ := json.Marshal(f2)
+	return string(b1) == string(b2)
+}
@@ -3,8 +3,11 @@ package prometheus
 import (
 	"compress/gzip"
 	"io"
+	"mime"
 	"net/http"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,7 +22,8 @@ import (
 // Typically, a program creates one Handler, registers it to the stats package,
 // and adds it to the muxer used by the application under the /metrics path.
 //
-// The handle ignores histograms that have no buckets set.
+// The handle ignores histograms that have no buckets set, unless they are
+// exposed as native histograms (see NativeHistograms).
 type Handler struct {
 	// Setting this field will trim this prefix from metric namespaces of the
 	// metrics received by this handler.
@@ -41,14 +45,101 @@ type Handler struct {
 	// The default is to use a 2 minutes metric timeout.
 	MetricTimeout time.Duration
 
+	// LabelTimeouts overrides MetricTimeout for the series which have labels
+	// with the given names, so series of short-lived entities, like pods or
+	// connections, stop being exposed before the metric timeout. When a
+	// series has several of those labels, the shortest timeout applies.
+	//
+	// Expired series are removed at each scrape when this field is set.
+	LabelTimeouts map[string]time.Duration
+
 	// Buckets is the registry of histogram buckets used by the handler,
 	// If nil, stats.Buckets is used instead.
 	Buckets stats.HistogramBuckets
 
-	opcount uint64
-	metrics metricStore
+	// ScrapeTimeoutOffset is subtracted from the scrape timeout advertised by
+	// Prometheus in the X-Prometheus-Scrape-Timeout-Seconds header to compute
+	// the time budget of a scrape, leaving room for the response to reach the
+	// scraper.
+	//
+	// When the budget is exhausted the handler stops collecting and writing
+	// metrics, and ends the partial response with a "# TRUNCATED" comment,
+	// rather than producing a response that the scraper would discard.
+	//
+	// The default is to use DefaultScrapeTimeoutOffset.
+	ScrapeTimeoutOffset time.Duration
+
+	// NativeHistograms configures the histograms exposed as native histograms
+	// (see NativeHistogram). Histograms which are not listed use the default
+	// configuration in NativeHistogramDefault.
+	NativeHistograms NativeHistograms
+
+	// NativeHistogramDefault is the configuration of the native histograms
+	// for histograms which are not listed in NativeHistograms. When nil, those
+	// histograms are only exposed with their classic buckets.
+	NativeHistogramDefault *NativeHistogram
+
+	// Summaries configures the histograms exposed as summaries instead (see
+	// Summary), which take precedence over native histograms.
+	Summaries Summaries
+
+	// DisableTimestamps suppresses the timestamps of exposed samples, letting
+	// the scraper assign the scrape time instead. Some pipelines, like the
+	// Pushgateway, reject or mishandle timestamped series.
+	DisableTimestamps bool
+
+	// TimestampFamilies overrides DisableTimestamps for individual metric
+	// families, the keys are the exposed family names (e.g. "http_req_count")
+	// and the values whether their samples carry timestamps.
+	TimestampFamilies map[string]bool
+
+	// ExemplarTags lists the names of tags which carry exemplar labels, like
+	// "trace_id". Those tags are not used as labels of the series, instead the
+	// last value observed with them in each counter or histogram bucket is
+	// kept as its exemplar, which is exposed in the OpenMetrics and protobuf
+	// formats.
+	ExemplarTags []string
+
+	// Namespace and Subsystem are prepended to the names of all exposed
+	// metric families, joined with underscores, like the fully-qualified
+	// names built from the options of client_golang collectors. They are
+	// applied when metrics are exposed, the names used to configure the
+	// handler, like the keys of TimestampFamilies, do not include them.
+	Namespace string
+	Subsystem string
+
+	// ConstLabels are added to all exposed series, for example to identify
+	// the instance or the version of the program. Labels of the series take
+	// precedence over constant labels with the same name.
+	ConstLabels map[string]string
+
+	// Job and Instance are added as job and instance labels to all exposed
+	// series, taking precedence over ConstLabels. Prometheus attaches those
+	// labels to the series that it scrapes, but agents forwarding metrics
+	// with remote write, like Grafana Agent or Alloy in push setups, may not,
+	// which breaks the joins of the series with target_info downstream.
+	Job      string
+	Instance string
+
+	// TargetInfo holds attributes of the program, for example its version or
+	// the cluster it runs in, exposed as labels of a target_info gauge with
+	// the value 1, like the OpenTelemetry resource attributes. Queries join
+	// target_info with other series on the job and instance labels to select
+	// them by attribute, without adding the attributes to every series.
+	//
+	// The target_info series is exposed when this field, Job, or Instance is
+	// set, with the job and instance labels.
+	TargetInfo map[string]string
+
+	opcount      uint64
+	metrics      metricStore
+	descriptions metricDescriptions
 }
 
+// DefaultScrapeTimeoutOffset is the default value of the ScrapeTimeoutOffset
+// field of Handler.
+const DefaultScrapeTimeoutOffset = 500 * time.Millisecond
+
 // HandleMeasures satisfies the stats.Handler interface.
 func (h *Handler) HandleMeasures(mtime time.Time, measures ...stats.Measure) {
 	cache := handleMetricPool.Get().(*handleMetricCache)
@@ -58,34 +149,48 @@ func (h *Handler) HandleMeasures(mtime time.Time, measures ...stats.Measure) {
 
 		cache.labels = cache.labels[:0]
 		cache.labels = cache.labels.appendTags(m.Tags...)
+		cache.exemplar = cache.exemplar[:0]
+
+		if len(h.ExemplarTags) != 0 {
+			cache.labels, cache.exemplar = splitExemplarLabels(cache.labels, cache.exemplar, h.ExemplarTags)
+		}
+
+		timeout := h.labelTimeout(cache.labels)
 
 		for _, f := range m.Fields {
-			var buckets []stats.Value
+			k := stats.Key{Measure: m.Name, Field: f.Name}
+			opts := updateOptions{exemplar: cache.exemplar, timeout: timeout, weight: sampleWeight(m.SampleRate), desc: k}
 			mtype := typeOf(f.Type())
 
 			if mtype == histogram {
-				k := stats.Key{Measure: m.Name, Field: f.Name}
-
-				if b := h.Buckets; b != nil {
-					buckets = b[k]
+				if s, ok := h.Summaries[k]; ok {
+					mtype, opts.summary = summary, s
 				} else {
-					buckets = stats.Buckets[k]
+					if b := h.Buckets; b != nil {
+						opts.buckets = stats.BucketsOf(b, k)
+					} else {
+						opts.buckets = stats.BucketsOf(stats.Buckets, k)
+					}
+					opts.native = h.nativeHistogram(k)
 				}
 			}
 
-			h.metrics.update(metric{
+			h.metrics.updateWith(metric{
 				mtype:  mtype,
 				scope:  scope,
 				name:   f.Name,
 				value:  valueOf(f.Value),
 				time:   mtime,
 				labels: cache.labels,
-			}, buckets)
+			}, opts)
 		}
 
 		for i := range cache.labels {
 			cache.labels[i] = label{}
 		}
+		for i := range cache.exemplar {
+			cache.exemplar[i] = label{}
+		}
 	}
 
 	handleMetricPool.Put(cache)
@@ -94,7 +199,51 @@ func (h *Handler) HandleMeasures(mtime time.Time, measures ...stats.Measure) {
 	// having memory leaks if the program has generated metrics for a pair of
 	// metric name and labels that won't be seen again.
 	if (atomic.AddUint64(&h.opcount, 1) % 10000) == 0 {
-		h.metrics.cleanup(time.Now().Add(-h.timeout()))
+		h.metrics.cleanup(time.Now(), h.timeout())
+	}
+}
+
+// labelTimeout returns the shortest timeout configured in LabelTimeouts for
+// the labels of a series, or zero if none of them has one.
+func (h *Handler) labelTimeout(labels labels) time.Duration {
+	var timeout time.Duration
+
+	if len(h.LabelTimeouts) != 0 {
+		for _, l := range labels {
+			if t, ok := h.LabelTimeouts[l.name]; ok && (timeout == 0 || t < timeout) {
+				timeout = t
+			}
+		}
+	}
+
+	return timeout
+}
+
+func (h *Handler) nativeHistogram(k stats.Key) *NativeHistogram {
+	if nh, ok := h.NativeHistograms[k]; ok {
+		return nh
+	}
+	return h.NativeHistogramDefault
+}
+
+// RemoveMeasures satisfies the stats.Remover interface, the series of the
+// measures are not exposed anymore until they are updated again.
+func (h *Handler) RemoveMeasures(measures ...stats.Measure) {
+	var l, ex labels
+
+	for _, m := range measures {
+		scope := h.trimPrefix(m.Name)
+		l = l.appendTags(m.Tags...)
+
+		if len(h.ExemplarTags) != 0 {
+			l, ex = splitExemplarLabels(l, ex[:0], h.ExemplarTags)
+		}
+
+		for _, f := range m.Fields {
+			h.metrics.remove(metricKey{scope: scope, name: f.Name}, l)
+		}
+
+		l = l[:0]
 	}
 }
 
@@ -113,7 +262,24 @@ func (h *Handler) timeout() time.Duration {
 	return 2 * time.Minute
 }
 
+// ExemplarTag satisfies the stats.ExemplarHandler interface, it returns true
+// if name is one of the ExemplarTags.
+func (h *Handler) ExemplarTag(name string) bool {
+	return slices.Contains(h.ExemplarTags, name)
+}
+
 // ServeHTTP satisfies the http.Handler interface.
+//
+// Metrics are written in the format preferred by the Accept header of the
+// request: the protobuf exposition format, which is required to expose native
+// histograms, the OpenMetrics text format, which carries exemplars and _created
+// series, or the classic text format, which is also the fallback when no
+// supported format is listed. Names which are not valid legacy Prometheus
+// names, like dotted names, are exposed as they are to scrapers which accept
+// UTF-8 names with the escaping parameter of the Accept header, and with
+// invalid characters replaced by underscores otherwise. Responses are
+// compressed with gzip when the Accept-Encoding header of the request allows
+// it.
 func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case "GET", "HEAD":
@@ -122,64 +288,345 @@ func (h *Handler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if len(h.LabelTimeouts) != 0 {
+		h.metrics.cleanup(time.Now(), h.timeout())
+	}
+
 	w := io.Writer(res)
-	res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	format, escaping, contentType := negotiateFormat(req.Header.Get("Accept"))
+	res.Header().Set("Content-Type", contentType)
+
+	res.Header().Add("Vary", "Accept-Encoding")
 
 	if acceptEncoding(req.Header.Get("Accept-Encoding"), "gzip") {
 		res.Header().Set("Content-Encoding", "gzip")
-		zw := gzip.NewWriter(w)
-		defer zw.Close()
+		zw := gzipWriterPool.Get().(*gzip.Writer)
+		zw.Reset(w)
+		defer func() {
+			zw.Close()
+			zw.Reset(nil)
+			gzipWriterPool.Put(zw)
+		}()
 		w = zw
 	}
 
-	h.WriteStats(w)
+	switch format {
+	case protobufFormat:
+		h.writeProtobuf(w, h.scrapeDeadline(req), escaping)
+	case openMetricsFormat:
+		h.writeOpenMetrics(w, h.scrapeDeadline(req), escaping)
+	default:
+		h.writeStats(w, h.scrapeDeadline(req), false, escaping)
+	}
+}
+
+// scrapeDeadline returns the time by which the response to req must be
+// written, based on the scrape timeout advertised by Prometheus. It returns
+// the zero time if the request has no scrape timeout.
+func (h *Handler) scrapeDeadline(req *http.Request) time.Time {
+	s := req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if s == "" {
+		return time.Time{}
+	}
+
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	offset := h.ScrapeTimeoutOffset
+	if offset == 0 {
+		offset = DefaultScrapeTimeoutOffset
+	}
+
+	// When the offset would consume the whole timeout we fall back to using
+	// half of it, a short budget is better than none.
+	if timeout > offset {
+		timeout -= offset
+	} else {
+		timeout /= 2
+	}
+
+	return time.Now().Add(timeout)
 }
 
 // WriteStats accepts a writer and pushes metrics (one at a time) to it.
 // An example could be if you just want to print all the metrics on to Stdout
 // It will not call flush. Make sure the Close and Flush are handled at the caller.
 func (h *Handler) WriteStats(w io.Writer) {
-	b := make([]byte, 1024)
+	h.writeStats(w, time.Time{}, false, underscoreEscaping)
+}
+
+func (h *Handler) writeStats(w io.Writer, deadline time.Time, omitTimestamps bool, escaping nameEscaping) {
+	buf := scrapeBufferPool.Get().(*scrapeBuffer)
+	defer buf.release()
 
 	var lastMetricName string
-	metrics := h.metrics.collect(make([]metric, 0, 10000))
+	var family string
+	var seen map[string]bool
+	metrics, complete := h.metrics.collectUntil(buf.metrics[:0], deadline)
+	buf.metrics = metrics
 	sort.Sort(byNameAndLabels(metrics))
+	b := buf.bytes[:0]
+	defer func() { buf.bytes = b }()
+	now := time.Now()
+	describe := h.descriptions.len() != 0
+	prefix, constLabels := h.namePrefix(), h.constLabels()
+	var exposedLabels labels
+
+	if describe {
+		seen = make(map[string]bool)
+	}
+
+	// The target_info series comes first, so it is not dropped from responses
+	// truncated by the scrape deadline.
+	target, hasTarget := h.targetInfoMetric()
+	if hasTarget {
+		b = appendMetric(b, target, escaping)
+		_, _ = w.Write(b)
+	}
 
 	for i, m := range metrics {
 		b = b[:0]
 		name := m.rootName()
 
+		if name != lastMetricName && (len(h.TimestampFamilies) != 0 || describe) {
+			family = string(appendMetricScopedName(b, m.scope, name))
+		}
+		if describe && name != lastMetricName {
+			m.help = h.descriptions.help(family, m.help)
+			seen[family] = true
+		}
+		if omitTimestamps {
+			m.time = time.Time{}
+		} else {
+			m.time = h.timestamp(family, m.time, now)
+		}
+
+		// The deadline is checked at each metric boundary while writing, so
+		// the scraper doesn't receive families with only part of their series.
+		if !deadline.IsZero() && i != 0 && name != lastMetricName && !time.Now().Before(deadline) {
+			complete = false
+			break
+		}
+
 		if name == lastMetricName {
 			// Silence the repeated output of type for values belonging to the
 			// same metric.
 			m.mtype, m.help = untyped, ""
-		} else if i != 0 {
+		} else if i != 0 || hasTarget {
 			// After every metric we want to output an empty line to make the
 			// output easier to read.
 			b = append(b, '\n')
 		}
 
-		_, _ = w.Write(appendMetric(b, m))
+		if len(prefix) != 0 {
+			m.scope = joinScope(prefix, m.scope)
+		}
+		if len(constLabels) != 0 {
+			exposedLabels = m.labels.appendMissing(exposedLabels[:0], constLabels)
+			m.labels = exposedLabels
+		}
+
+		_, _ = w.Write(appendMetric(b, m, escaping))
 		lastMetricName = name
 	}
+
+	if !complete {
+		_, _ = w.Write([]byte("\n# TRUNCATED scrape timeout exceeded\n"))
+		return
+	}
+
+	// Described families without series are exposed with their metadata
+	// only, so they do not disappear from the output when they expire.
+	if describe {
+		for i, f := range h.descriptions.missing(seen) {
+			b = b[:0]
+			if len(metrics) != 0 || i != 0 || hasTarget {
+				b = append(b, '\n')
+			}
+			if len(f.help) != 0 {
+				b = appendMetricHelp(b, escaping, prefix, f.name, f.help)
+			}
+			_, _ = w.Write(appendMetricType(b, escaping, prefix, f.name, f.mtype.String()))
+		}
+	}
+}
+
+// timestamp returns the time exposed for samples of the given family which
+// were last updated at t, or the zero time if they must not have one. Times in
+// the future are clamped to now, since scrapers reject samples too far ahead
+// of their own clock.
+func (h *Handler) timestamp(family string, t, now time.Time) time.Time {
+	emit, ok := h.TimestampFamilies[family]
+	if !ok {
+		emit = !h.DisableTimestamps
+	}
+	if !emit {
+		return time.Time{}
+	}
+	if t.After(now) {
+		return now
+	}
+	return t
 }
 
+// textContentType is the content type of the classic text format, which is
+// used when the Accept header of a request lists no other supported format.
+const textContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// textUTF8ContentType is the content type of the version of the text format
+// which supports quoted UTF-8 names, the output of the handler is the same in
+// both versions.
+const textUTF8ContentType = "text/plain; version=1.0.0; charset=utf-8"
+
+type exposition int
+
+const (
+	textFormat exposition = iota
+	openMetricsFormat
+	protobufFormat
+)
+
+// negotiateFormat returns the exposition format that responses to a request
+// with the given Accept header are written in, the escaping scheme of names,
+// and their content type.
+//
+// The media range with the highest quality value wins, ties are broken in
+// favor of the protobuf format, then OpenMetrics. The classic text format is
+// used when no supported format is listed. Names are escaped with underscores
+// unless the selected media range has an escaping parameter, which is then
+// repeated in the content type.
+func negotiateFormat(accept string) (exposition, nameEscaping, string) {
+	format, escaping, contentType := textFormat, underscoreEscaping, textContentType
+	quality := -1.0
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil || q <= 0 || q > 1 {
+				continue
+			}
+		}
+
+		var f exposition
+		var t string
+
+		switch mediaType {
+		case "application/vnd.google.protobuf":
+			if params["proto"] != "io.prometheus.client.MetricFamily" || params["encoding"] != "delimited" {
+				continue
+			}
+			f, t = protobufFormat, protobufContentType
+
+		case "application/openmetrics-text":
+			switch params["version"] {
+			case "", "1.0.0":
+				f, t = openMetricsFormat, openMetricsContentType
+			case "0.0.1":
+				f, t = openMetricsFormat, openMetricsLegacyContentType
+			default:
+				continue
+			}
+
+		case "text/plain", "text/*", "*/*":
+			f, t = textFormat, textContentType
+			if params["version"] == "1.0.0" {
+				t = textUTF8ContentType
+			}
+
+		default:
+			continue
+		}
+
+		e, ok := parseNameEscaping(params["escaping"])
+		if ok {
+			t += "; escaping=" + e.String()
+		}
+
+		if q > quality || (q == quality && f > format) {
+			format, escaping, contentType, quality = f, e, t, q
+		}
+	}
+
+	return format, escaping, contentType
+}
+
+// acceptEncoding returns true if the content coding check is listed in the
+// Accept-Encoding header of a request, either explicitly or through the "*"
+// wildcard, and was not given a quality value of zero.
 func acceptEncoding(accept, check string) bool {
+	wildcard := false
+
 	for _, coding := range strings.Split(accept, ",") {
-		if coding = strings.TrimSpace(coding); strings.HasPrefix(coding, check) {
-			return true
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.TrimSpace(name)
+
+		if !strings.EqualFold(name, check) && name != "*" {
+			continue
 		}
+
+		ok := true
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(k, "q") {
+				q, err := strconv.ParseFloat(v, 64)
+				ok = err == nil && q > 0
+			}
+		}
+
+		if name != "*" {
+			// Explicit codings take precedence over the wildcard.
+			return ok
+		}
+		wildcard = ok
 	}
-	return false
+
+	return wildcard
+}
+
+// gzipWriterPool recycles the compressors of scrape responses, whose internal
+// state takes hundreds of kilobytes of memory.
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// scrapeBufferPool recycles the buffers used to write scrapes in the text
+// format, they hold one metric per series and would otherwise be allocated
+// again at every scrape, causing garbage collection spikes on large stores.
+var scrapeBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &scrapeBuffer{metrics: make([]metric, 0, 10000), bytes: make([]byte, 0, 1024)}
+	},
+}
+
+type scrapeBuffer struct {
+	metrics []metric
+	bytes   []byte
+}
+
+func (buf *scrapeBuffer) release() {
+	// The metrics reference the labels of the store, they are cleared so the
+	// pool does not retain series which were removed from it.
+	clear(buf.metrics)
+	buf.metrics = buf.metrics[:0]
+	scrapeBufferPool.Put(buf)
 }
 
 type handleMetricCache struct {
-	labels labels
+	labels   labels
+	exemplar labels
 }
 
 var handleMetricPool = sync.Pool{
 	New: func() interface{} {
-		return &handleMetricCache{labels: make(labels, 0, 8)}
+		return &handleMetricCache{labels: make(labels, 0, 8), exemplar: make(labels, 0, 2)}
 	},
 }
 
@@ -207,13 +654,23 @@ func typeOf(t stats.FieldType) metricType {
 		return counter
 	case stats.Gauge:
 		return gauge
-	case stats.Histogram:
+	case stats.Histogram, stats.Distribution:
 		return histogram
 	default:
 		return untyped
 	}
 }
 
+// sampleWeight returns the number of observations that a histogram value
+// sampled at rate stands for. Counters are already scaled by the engine, but
+// the counts and sums of histograms must be scaled by the handler.
+func sampleWeight(rate float64) float64 {
+	if rate <= 0 || rate >= 1 {
+		return 1
+	}
+	return 1 / rate
+}
+
 func valueOf(v stats.Value) float64 {
 	switch v.Type() {
 	case stats.Bool:
@@ -1,10 +1,14 @@
 package prometheus
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,6 +44,30 @@ func TestAcceptEncoding(t *testing.T) {
 			check:  "gzip",
 			expect: false,
 		},
+
+		{
+			accept: "deflate, gzip;q=0.5",
+			check:  "gzip",
+			expect: true,
+		},
+
+		{
+			accept: "gzip;q=0, *",
+			check:  "gzip",
+			expect: false,
+		},
+
+		{
+			accept: "br, *;q=0.1",
+			check:  "gzip",
+			expect: true,
+		},
+
+		{
+			accept: "gzip-like",
+			check:  "gzip",
+			expect: false,
+		},
 	}
 
 	for _, test := range tests {
@@ -157,3 +185,327 @@ func BenchmarkHandleMetric(b *testing.B) {
 		})
 	}
 }
+
+func TestWriteStatsReusesBuffers(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{}
+	for i := 0; i != 100; i++ {
+		handler.HandleMeasures(now, stats.Measure{
+			Fields: []stats.Field{stats.MakeField("M"+strconv.Itoa(i), i, stats.Gauge)},
+			Tags:   []stats.Tag{stats.T("a", "1")},
+		})
+	}
+
+	write := func() string {
+		b := &bytes.Buffer{}
+		handler.WriteStats(b)
+		return b.String()
+	}
+
+	first := write()
+	for i := 0; i != 10; i++ {
+		if s := write(); s != first {
+			t.Fatalf("scrape %d differs from the first one:\n%s\n%s", i, first, s)
+		}
+	}
+}
+
+func BenchmarkWriteStats(b *testing.B) {
+	now := time.Now()
+	handler := &Handler{}
+
+	for i := 0; i != 10000; i++ {
+		handler.HandleMeasures(now, stats.Measure{
+			Fields: []stats.Field{stats.MakeField("M"+strconv.Itoa(i%100), i, stats.Gauge)},
+			Tags:   []stats.Tag{stats.T("id", strconv.Itoa(i))},
+		})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i != b.N; i++ {
+		handler.WriteStats(io.Discard)
+	}
+}
+
+func TestServeHTTPScrapeTimeout(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{}
+	handler.HandleMeasures(now,
+		stats.Measure{Fields: []stats.Field{stats.MakeField("A", 1, stats.Counter)}},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 2, stats.Gauge)}},
+	)
+
+	get := func(timeout string) string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", timeout)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Body.String()
+	}
+
+	const complete = `# TYPE A counter
+A 1 1496614320000
+
+# TYPE B gauge
+B 2 1496614320000
+`
+
+	if s := get("10"); s != complete {
+		t.Errorf("bad output with a large scrape timeout:\n%s", s)
+	}
+
+	if s := get("invalid"); s != complete {
+		t.Errorf("bad output with an invalid scrape timeout:\n%s", s)
+	}
+
+	// A timeout shorter than the offset leaves a budget of zero, simulating a
+	// store too slow to be collected within the scrape timeout.
+	if s := get("0.000000001"); !strings.HasSuffix(s, "# TRUNCATED scrape timeout exceeded\n") {
+		t.Errorf("missing truncation marker:\n%s", s)
+	}
+}
+
+func TestServeHTTPTimestamps(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{}
+	handler.HandleMeasures(now,
+		stats.Measure{Fields: []stats.Field{stats.MakeField("A", 1, stats.Counter)}},
+		stats.Measure{Fields: []stats.Field{stats.MakeField("B", 2, stats.Gauge)}},
+	)
+
+	get := func() string {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Body.String()
+	}
+
+	handler.DisableTimestamps = true
+
+	if s, expect := get(), "# TYPE A counter\nA 1\n\n# TYPE B gauge\nB 2\n"; s != expect {
+		t.Errorf("bad output with timestamps disabled:\n%s", s)
+	}
+
+	handler.TimestampFamilies = map[string]bool{"B": true}
+
+	if s, expect := get(), "# TYPE A counter\nA 1\n\n# TYPE B gauge\nB 2 1496614320000\n"; s != expect {
+		t.Errorf("bad output with timestamps enabled for one family:\n%s", s)
+	}
+
+	// Samples from the future are exposed with the time of the scrape.
+	handler.DisableTimestamps = false
+	handler.TimestampFamilies = nil
+	handler.HandleMeasures(time.Now().Add(time.Hour),
+		stats.Measure{Fields: []stats.Field{stats.MakeField("C", 3, stats.Gauge)}},
+	)
+
+	start := time.Now()
+	s := get()
+
+	i := strings.LastIndexByte(strings.TrimSpace(s), ' ')
+	ms, err := strconv.ParseInt(strings.TrimSpace(s[i+1:]), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := time.UnixMilli(ms); ts.Before(start.Truncate(time.Millisecond)) || ts.After(time.Now()) {
+		t.Errorf("future timestamp was not clamped:\n%s", s)
+	}
+}
+
+func TestServeHTTPGzip(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{}
+	handler.HandleMeasures(now, stats.Measure{
+		Name:   "rpc",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		Tags:   []stats.Tag{stats.T("method", "get")},
+	})
+
+	for _, accept := range []string{"", "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited"} {
+		get := func(acceptEncoding string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			req.Header.Set("Accept", accept)
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			return res
+		}
+
+		// Run twice to exercise the recycling of compressors.
+		for i := 0; i < 2; i++ {
+			plain, compressed := get(""), get("gzip")
+
+			if encoding := compressed.Header().Get("Content-Encoding"); encoding != "gzip" {
+				t.Fatal("bad content encoding:", encoding)
+			}
+			if vary := compressed.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Error("bad vary header:", vary)
+			}
+
+			zr, err := gzip.NewReader(compressed.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, plain.Body.Bytes()) {
+				t.Errorf("bad decompressed body:\n- expected: %q\n- found:    %q", plain.Body.Bytes(), b)
+			}
+		}
+	}
+}
+
+func TestServeHTTPLabelTimeouts(t *testing.T) {
+	now := time.Now()
+
+	handler := &Handler{
+		LabelTimeouts: map[string]time.Duration{
+			"pod":        10 * time.Second,
+			"connection": time.Second,
+		},
+	}
+
+	handler.HandleMeasures(now.Add(-5*time.Second),
+		stats.Measure{
+			Name:   "requests",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		},
+		stats.Measure{
+			Name:   "requests",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("pod", "A")},
+		},
+		stats.Measure{
+			Name:   "requests",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("connection", "1"), stats.T("pod", "B")},
+		},
+	)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	handler.DisableTimestamps = true
+	handler.ServeHTTP(res, req)
+
+	// The series with a connection label expired, the shortest timeout
+	// applies when a series has multiple labels with timeouts.
+	const expect = `# TYPE requests_count counter
+requests_count 1
+requests_count{pod="A"} 1
+`
+
+	if body := res.Body.String(); body != expect {
+		t.Errorf("bad output:\n- expected:\n%s\n- found:\n%s", expect, body)
+	}
+}
+
+func TestServeHTTPSampledHistogram(t *testing.T) {
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Measure: "rpc", Field: "size"}: {stats.ValueOf(1), stats.ValueOf(10)},
+		},
+		DisableTimestamps: true,
+	}
+
+	handler.HandleMeasures(time.Now(),
+		stats.Measure{
+			Name:       "rpc",
+			Fields:     []stats.Field{stats.MakeField("size", 5, stats.Histogram)},
+			SampleRate: 0.25,
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("size", 20, stats.Histogram)},
+		},
+	)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	// The sampled value stands for 4 observations.
+	const expect = `# TYPE rpc_size histogram
+rpc_size_bucket{le="1"} 0
+rpc_size_bucket{le="10"} 4
+rpc_size_count 5
+rpc_size_sum 40
+`
+
+	if body := res.Body.String(); body != expect {
+		t.Errorf("bad output:\n- expected:\n%s\n- found:\n%s", expect, body)
+	}
+}
+
+func TestServeHTTPSampledHistogramFractionalWeight(t *testing.T) {
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Measure: "rpc", Field: "size"}: {stats.ValueOf(1), stats.ValueOf(10)},
+		},
+		DisableTimestamps: true,
+	}
+
+	m := stats.Measure{
+		Name:       "rpc",
+		Fields:     []stats.Field{stats.MakeField("size", 2, stats.Histogram)},
+		SampleRate: 0.4,
+	}
+	handler.HandleMeasures(time.Now(), m, m)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	// Each sampled value stands for 2.5 observations, the half observation of
+	// the first value is counted with the second one.
+	const expect = `# TYPE rpc_size histogram
+rpc_size_bucket{le="1"} 0
+rpc_size_bucket{le="10"} 5
+rpc_size_count 5
+rpc_size_sum 10
+`
+
+	if body := res.Body.String(); body != expect {
+		t.Errorf("bad output:\n- expected:\n%s\n- found:\n%s", expect, body)
+	}
+}
+
+func TestHandlerRemoveMeasures(t *testing.T) {
+	now := time.Now()
+
+	handler := &Handler{}
+	handler.HandleMeasures(now,
+		stats.Measure{Name: "queue", Fields: []stats.Field{stats.MakeField("size", 1, stats.Gauge)}, Tags: []stats.Tag{stats.T("name", "A")}},
+		stats.Measure{Name: "queue", Fields: []stats.Field{stats.MakeField("size", 2, stats.Gauge)}, Tags: []stats.Tag{stats.T("name", "B")}},
+	)
+
+	scrape := func() string {
+		b := &bytes.Buffer{}
+		handler.WriteStats(b)
+		return b.String()
+	}
+
+	handler.RemoveMeasures(
+		stats.Measure{Name: "queue", Fields: []stats.Field{stats.MakeField("size", 0, stats.Gauge)}, Tags: []stats.Tag{stats.T("name", "A")}},
+	)
+
+	if s := scrape(); strings.Contains(s, `name="A"`) || !strings.Contains(s, `queue_size{name="B"} 2`) {
+		t.Errorf("bad metrics after removing a series:\n%s", s)
+	}
+
+	handler.RemoveMeasures(
+		stats.Measure{Name: "queue", Fields: []stats.Field{stats.MakeField("size", 0, stats.Gauge)}, Tags: []stats.Tag{stats.T("name", "B")}},
+	)
+
+	if s := scrape(); strings.Contains(s, "queue_size") {
+		t.Errorf("bad metrics after removing all series:\n%s", s)
+	}
+}
@@ -80,3 +80,27 @@ func (l labels) appendTags(tags ...stats.Tag) labels {
 	}
 	return l
 }
+
+func (l labels) contains(subset labels) bool {
+	for _, s := range subset {
+		found := false
+		for i := range l {
+			if l[i].equal(s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (l labels) stringMap() map[string]string {
+	m := make(map[string]string, len(l))
+	for _, x := range l {
+		m[x.name] = x.value
+	}
+	return m
+}
@@ -1,6 +1,8 @@
 package prometheus
 
 import (
+	"hash/maphash"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -57,76 +59,205 @@ func (m metric) key() metricKey {
 }
 
 func (m metric) rootName() string {
-	if m.mtype == histogram {
+	switch m.mtype {
+	case histogram:
 		return m.name[:strings.LastIndexByte(m.name, '_')]
+	case summary:
+		// Quantile series are named after the summary itself, only the sum
+		// and count series carry a suffix.
+		if name, ok := strings.CutSuffix(m.name, "_sum"); ok {
+			return name
+		}
+		if name, ok := strings.CutSuffix(m.name, "_count"); ok {
+			return name
+		}
 	}
 	return m.name
 }
 
+// metricStoreShards is the number of shards of metric stores. Entries are
+// spread across shards by the hash of their key, so that concurrent updates of
+// different metrics do not contend on the same mutex.
+const metricStoreShards = 64
+
 type metricStore struct {
+	shards [metricStoreShards]metricShard
+
+	// Names of the families which are not exposed, guarded by mutex.
+	mutex            sync.RWMutex
+	disabledFamilies []string
+}
+
+type metricShard struct {
 	mutex   sync.RWMutex
 	entries map[metricKey]*metricEntry
+
+	// Shards are padded to distinct cache lines, otherwise locking a shard
+	// would invalidate the cached mutexes of its neighbours.
+	_ [64]byte
 }
 
-func (store *metricStore) lookup(mtype metricType, key metricKey, help string) *metricEntry {
+var metricStoreSeed = maphash.MakeSeed()
+
+func (store *metricStore) shard(key metricKey) *metricShard {
+	h := maphash.String(metricStoreSeed, key.scope)*31 + maphash.String(metricStoreSeed, key.name)
+	return &store.shards[h%metricStoreShards]
+}
+
+// rangeEntries calls f with the entries of the store which are not disabled,
+// until f returns false, in which case it returns false as well. The shard of
+// the entries is read-locked during the calls.
+func (store *metricStore) rangeEntries(f func(*metricEntry) bool) bool {
 	store.mutex.RLock()
-	entry := store.entries[key]
-	store.mutex.RUnlock()
+	defer store.mutex.RUnlock()
+
+	for i := range store.shards {
+		shard := &store.shards[i]
+		shard.mutex.RLock()
+
+		for _, entry := range shard.entries {
+			if store.disabled(entry) {
+				continue
+			}
+			if !f(entry) {
+				shard.mutex.RUnlock()
+				return false
+			}
+		}
+
+		shard.mutex.RUnlock()
+	}
+
+	return true
+}
+
+// lookup returns the entry of key, creating it if needed. The help of new
+// entries defaults to the description of the metric identified by desc in the
+// metadata registry, it is only looked up when entries are created.
+func (store *metricStore) lookup(mtype metricType, key metricKey, help string, desc stats.Key) *metricEntry {
+	shard := store.shard(key)
+
+	shard.mutex.RLock()
+	entry := shard.entries[key]
+	shard.mutex.RUnlock()
 
 	// The program may choose to change the type of a metric, this is likely a
 	// pretty bad idea but I don't think we have enough context here to tell if
 	// it's a bug or a feature so we just accept to mutate the entry.
 	if entry == nil || entry.mtype != mtype {
-		store.mutex.Lock()
+		shard.mutex.Lock()
 
-		if store.entries == nil {
-			store.entries = make(map[metricKey]*metricEntry)
+		if shard.entries == nil {
+			shard.entries = make(map[metricKey]*metricEntry)
 		}
 
-		if entry = store.entries[key]; entry == nil || entry.mtype != mtype {
+		if entry = shard.entries[key]; entry == nil || entry.mtype != mtype {
+			if len(help) == 0 && desc != (stats.Key{}) {
+				help = stats.HelpOf(desc)
+			}
 			entry = newMetricEntry(mtype, key.scope, key.name, help)
-			store.entries[key] = entry
+			shard.entries[key] = entry
 		}
 
-		store.mutex.Unlock()
+		shard.mutex.Unlock()
 	}
 
 	return entry
 }
 
 func (store *metricStore) update(metric metric, buckets []stats.Value) {
-	entry := store.lookup(metric.mtype, metric.key(), metric.help)
-	state := entry.lookup(metric.labels)
-	state.update(metric.mtype, metric.value, metric.time, buckets)
+	store.updateWith(metric, updateOptions{buckets: buckets})
 }
 
-func (store *metricStore) collect(metrics []metric) []metric {
-	store.mutex.RLock()
+// updateOptions carries the configuration of histograms and summaries which
+// is looked up by the handler for each update.
+type updateOptions struct {
+	buckets  []stats.Value
+	native   *NativeHistogram
+	summary  *Summary
+	exemplar labels
+	timeout  time.Duration // of new series, zero uses the timeout of cleanups
+	weight   float64       // observations each histogram value stands for, zero counts as one
+	desc     stats.Key     // metric whose registered help describes new entries
+}
 
-	for _, entry := range store.entries {
-		metrics = entry.collect(metrics)
-	}
+// updateWith is like update but also records histogram values in a native
+// histogram when configured, and summary values in quantile estimates.
+func (store *metricStore) updateWith(metric metric, opts updateOptions) {
+	entry := store.lookup(metric.mtype, metric.key(), metric.help, opts.desc)
+	state := entry.lookup(metric.labels, opts.timeout)
+	state.update(metric.mtype, metric.value, metric.time, opts)
+}
 
-	store.mutex.RUnlock()
+func (store *metricStore) collect(metrics []metric) []metric {
+	metrics, _ = store.collectUntil(metrics, time.Time{})
 	return metrics
 }
 
-func (store *metricStore) cleanup(exp time.Time) {
-	store.mutex.RLock()
+// collectUntil is like collect but stops collecting entries once the deadline
+// has passed, in which case it returns false. A zero deadline means no limit.
+func (store *metricStore) collectUntil(metrics []metric, deadline time.Time) ([]metric, bool) {
+	complete := store.rangeEntries(func(entry *metricEntry) bool {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return false
+		}
+		metrics = entry.collect(metrics)
+		return true
+	})
+	return metrics, complete
+}
 
-	for name, entry := range store.entries {
-		store.mutex.RUnlock()
+// cleanup removes the series that were last updated more than timeout before
+// now, or more than their own timeout if they were created with one.
+func (store *metricStore) cleanup(now time.Time, timeout time.Duration) {
+	var keys []metricKey
+	var entries []*metricEntry
 
-		entry.cleanup(exp, func() {
-			store.mutex.Lock()
-			delete(store.entries, name)
-			store.mutex.Unlock()
-		})
+	for i := range store.shards {
+		shard := &store.shards[i]
 
-		store.mutex.RLock()
+		// The entries are cleaned up after releasing the lock of the shard,
+		// so updates of the shard are not blocked while series expire.
+		shard.mutex.RLock()
+		for key, entry := range shard.entries {
+			keys, entries = append(keys, key), append(entries, entry)
+		}
+		shard.mutex.RUnlock()
+
+		for j, entry := range entries {
+			key := keys[j]
+			entry.cleanup(now, timeout, func() {
+				shard.mutex.Lock()
+				// The entry may have been replaced or updated in the meantime.
+				if shard.entries[key] == entry && entry.empty() {
+					delete(shard.entries, key)
+				}
+				shard.mutex.Unlock()
+			})
+			entries[j] = nil
+		}
+
+		keys, entries = keys[:0], entries[:0]
 	}
+}
+
+// remove deletes the series identified by key and labels, and the entry of
+// the metric when it was its last series.
+func (store *metricStore) remove(key metricKey, labels labels) {
+	shard := store.shard(key)
 
-	store.mutex.RUnlock()
+	shard.mutex.RLock()
+	entry := shard.entries[key]
+	shard.mutex.RUnlock()
+
+	if entry != nil && entry.remove(labels) {
+		shard.mutex.Lock()
+		// The entry may have been replaced or updated in the meantime.
+		if shard.entries[key] == entry && entry.empty() {
+			delete(shard.entries, key)
+		}
+		shard.mutex.Unlock()
+	}
 }
 
 type metricEntry struct {
@@ -144,13 +275,13 @@ type metricEntry struct {
 func newMetricEntry(mtype metricType, scope, name, help string) *metricEntry {
 	entry := &metricEntry{
 		mtype:  mtype,
-		scope:  scope,
-		name:   name,
+		scope:  stats.Intern(scope),
+		name:   stats.Intern(name),
 		help:   help,
 		states: make(metricStateMap),
 	}
 
-	if mtype == histogram {
+	if mtype == histogram || mtype == summary {
 		// Here we cache those metric names to avoid having to recompute them
 		// every time we collect the state of the metrics.
 		entry.bucket = name + "_bucket"
@@ -161,7 +292,7 @@ func newMetricEntry(mtype metricType, scope, name, help string) *metricEntry {
 	return entry
 }
 
-func (entry *metricEntry) lookup(labels labels) *metricState {
+func (entry *metricEntry) lookup(labels labels, timeout time.Duration) *metricState {
 	key := labels.hash()
 
 	entry.mutex.RLock()
@@ -172,7 +303,7 @@ func (entry *metricEntry) lookup(labels labels) *metricState {
 		entry.mutex.Lock()
 
 		if state = entry.states.find(key, labels); state == nil {
-			state = newMetricState(labels)
+			state = newMetricState(labels, timeout)
 			entry.states.put(key, state)
 		}
 
@@ -182,6 +313,37 @@ func (entry *metricEntry) lookup(labels labels) *metricState {
 	return state
 }
 
+// remove deletes the series with labels from the entry, and returns true if
+// the entry has no series left.
+func (entry *metricEntry) remove(labels labels) bool {
+	key := labels.hash()
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	states := entry.states[key]
+	for i, state := range states {
+		if state.labels.equal(labels) {
+			states = append(states[:i], states[i+1:]...)
+			break
+		}
+	}
+
+	if len(states) == 0 {
+		delete(entry.states, key)
+	} else {
+		entry.states[key] = states
+	}
+
+	return len(entry.states) == 0
+}
+
+func (entry *metricEntry) empty() bool {
+	entry.mutex.RLock()
+	defer entry.mutex.RUnlock()
+	return len(entry.states) == 0
+}
+
 func (entry *metricEntry) collect(metrics []metric) []metric {
 	entry.mutex.RLock()
 
@@ -197,7 +359,7 @@ func (entry *metricEntry) collect(metrics []metric) []metric {
 	return metrics
 }
 
-func (entry *metricEntry) cleanup(exp time.Time, empty func()) {
+func (entry *metricEntry) cleanup(now time.Time, timeout time.Duration, empty func()) {
 	// TODO: there may be high contention on this mutex, maybe not, it would be
 	// a good idea to measure.
 	entry.mutex.Lock()
@@ -209,9 +371,10 @@ func (entry *metricEntry) cleanup(exp time.Time, empty func()) {
 			states[j] = nil
 			state.mutex.Lock()
 
-			// We expire all entries that have been last updated before exp,
-			// they don't get copied back into the state slice.
-			if exp.Before(state.time) {
+			// We expire all entries that have been last updated before their
+			// expiration time, they don't get copied back into the state
+			// slice.
+			if state.expiration(now, timeout).Before(state.time) {
 				states[i] = state
 				i++
 			}
@@ -230,7 +393,7 @@ func (entry *metricEntry) cleanup(exp time.Time, empty func()) {
 	shouldDelete := (len(entry.states) == 0)
 	entry.mutex.Unlock()
 
-	// now call back into store (taking store.mutex) only after releasing entry.mutex
+	// now call back into store (taking the shard mutex) only after releasing entry.mutex
 	if shouldDelete {
        empty()
     }
@@ -238,45 +401,105 @@ func (entry *metricEntry) cleanup(exp time.Time, empty func()) {
 
 type metricState struct {
 	// immutable
-	labels labels
+	labels  labels
+	timeout time.Duration
 	// mutable
-	mutex   sync.Mutex
-	buckets metricBuckets
-	value   float64
-	sum     float64
-	count   uint64
-	time    time.Time
+	mutex    sync.Mutex
+	buckets  metricBuckets
+	native   *nativeBuckets
+	summary  *summaryState
+	exemplar *exemplar // counters, or the implicit +Inf bucket of histograms
+	value    float64
+	sum      float64
+	count    uint64
+	fraction float64 // observations of sampled values not counted yet
+	time     time.Time
+	created  time.Time // time of the first update, exposed in _created series
 }
 
-func newMetricState(labels labels) *metricState {
+func newMetricState(labels labels, timeout time.Duration) *metricState {
 	return &metricState{
-		labels: labels.copy(),
+		labels:  labels.copy(),
+		timeout: timeout,
+	}
+}
+
+// expiration returns the time before which the state must have been updated
+// to be considered expired at now, timeout is used unless the state has its
+// own.
+func (state *metricState) expiration(now time.Time, timeout time.Duration) time.Time {
+	if state.timeout != 0 {
+		timeout = state.timeout
 	}
+	return now.Add(-timeout)
 }
 
-func (state *metricState) update(mtype metricType, value float64, time time.Time, buckets []stats.Value) {
+func (state *metricState) update(mtype metricType, value float64, time time.Time, opts updateOptions) {
+	weight := opts.weight
+	if weight <= 0 {
+		weight = 1
+	}
 	state.mutex.Lock()
 
 	switch mtype {
 	case counter:
 		state.value += value
+		if len(opts.exemplar) != 0 {
+			state.exemplar = newExemplar(opts.exemplar, value, time)
+		}
 
 	case gauge:
 		state.value = value
 
 	case histogram:
-		if len(state.buckets) != len(buckets) {
-			state.buckets = makeMetricBuckets(buckets, state.labels)
+		if len(state.buckets) != len(opts.buckets) {
+			state.buckets = makeMetricBuckets(opts.buckets, state.labels)
 		}
-		state.buckets.update(value)
-		state.sum += value
-		state.count++
+		n := state.observations(weight)
+		i := state.buckets.update(value, n)
+		if len(opts.exemplar) != 0 {
+			if i >= 0 {
+				state.buckets[i].exemplar = newExemplar(opts.exemplar, value, time)
+			} else {
+				state.exemplar = newExemplar(opts.exemplar, value, time)
+			}
+		}
+		if opts.native != nil {
+			if state.native == nil || !state.native.configuredWith(opts.native) {
+				state.native = newNativeBuckets(opts.native)
+			}
+			state.native.update(value, n)
+		}
+		state.sum += value * weight
+		state.count += n
+
+	case summary:
+		if state.summary == nil || !state.summary.configuredWith(opts.summary) {
+			state.summary = newSummaryState(opts.summary, state.labels)
+		}
+		state.summary.observe(value, time)
+		state.sum += value * weight
+		state.count += state.observations(weight)
 	}
 
+	if state.created.IsZero() {
+		state.created = time
+	}
 	state.time = time
 	state.mutex.Unlock()
 }
 
+// observations returns the whole number of observations that a value of the
+// given weight adds to the counts of the state. The fraction of the weight is
+// carried over to the next values, so counts remain unbiased for sample rates
+// which are not of the form 1/n. The mutex must be held.
+func (state *metricState) observations(weight float64) uint64 {
+	w := state.fraction + weight
+	n := math.Floor(w)
+	state.fraction = w - n
+	return uint64(n)
+}
+
 func (state *metricState) collect(metrics []metric, entry *metricEntry) []metric {
 	state.mutex.Lock()
 
@@ -329,6 +552,39 @@ func (state *metricState) collect(metrics []metric, entry *metricEntry) []metric
 				labels: state.labels,
 			},
 		)
+
+	case summary:
+		for i := range state.summary.quantiles {
+			metrics = append(metrics, metric{
+				mtype:  entry.mtype,
+				scope:  entry.scope,
+				name:   entry.name,
+				help:   entry.help,
+				value:  state.summary.query(i),
+				time:   state.time,
+				labels: state.summary.labels[i],
+			})
+		}
+		metrics = append(metrics,
+			metric{
+				mtype:  entry.mtype,
+				scope:  entry.scope,
+				name:   entry.sum,
+				help:   entry.help,
+				value:  state.sum,
+				time:   state.time,
+				labels: state.labels,
+			},
+			metric{
+				mtype:  entry.mtype,
+				scope:  entry.scope,
+				name:   entry.count,
+				help:   entry.help,
+				value:  float64(state.count),
+				time:   state.time,
+				labels: state.labels,
+			},
+		)
 	}
 
 	state.mutex.Unlock()
@@ -354,9 +610,10 @@ func (m metricStateMap) find(key uint64, labels labels) *metricState {
 }
 
 type metricBucket struct {
-	limit  float64
-	count  uint64
-	labels labels
+	limit    float64
+	count    uint64
+	labels   labels
+	exemplar *exemplar
 }
 
 type metricBuckets []metricBucket
@@ -375,13 +632,17 @@ func makeMetricBuckets(buckets []stats.Value, labels labels) metricBuckets {
 	return b
 }
 
-func (m metricBuckets) update(value float64) {
+// update counts value weight times in the first bucket it fits in, and returns
+// the index of this bucket, or -1 if the value is greater than all bucket
+// limits.
+func (m metricBuckets) update(value float64, weight uint64) int {
 	for i := range m {
 		if value <= m[i].limit {
-			m[i].count++
-			break
+			m[i].count += weight
+			return i
 		}
 	}
+	return -1
 }
 
 // This function builds a string of column-separated float representations of
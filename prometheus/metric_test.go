@@ -4,6 +4,7 @@ import (
 	"math"
 	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -20,7 +21,6 @@ func TestFuzzyDeadlock(t *testing.T) {
 	for i := 0; i < iterations; i++ {
 		// 1) fresh store with one expired metric so cleanup() will actually delete
 		var store metricStore
-		store.entries = make(map[metricKey]*metricEntry)
 		m := metric{
 			mtype: counter,
 			scope: "svc",
@@ -37,7 +37,7 @@ func TestFuzzyDeadlock(t *testing.T) {
 			done <- struct{}{}
 		}()
 		go func() {
-			store.cleanup(time.Now())
+			store.cleanup(time.Now(), 0)
 			done <- struct{}{}
 		}()
 
@@ -165,7 +165,7 @@ func TestMetricEntryCleanup(t *testing.T) {
 	callback := func() { empty = true }
 
 	// Cleanup all states older than 1 second.
-	entry.cleanup(now.Add(-time.Second), callback)
+	entry.cleanup(now.Add(-time.Second), 0, callback)
 
 	if empty {
 		t.Error("unexpected call to notify that the entry is empty")
@@ -185,7 +185,7 @@ func TestMetricEntryCleanup(t *testing.T) {
 
 	// Cleanup all states older than now to check that the comparison is
 	// inclusive.
-	entry.cleanup(now, callback)
+	entry.cleanup(now, 0, callback)
 
 	if empty {
 		t.Error("unexpected call to notify that the entry is empty")
@@ -200,7 +200,7 @@ func TestMetricEntryCleanup(t *testing.T) {
 	}
 
 	// Cleanup all states.
-	entry.cleanup(now.Add(time.Second), callback)
+	entry.cleanup(now.Add(time.Second), 0, callback)
 
 	if !empty {
 		t.Error("callback not called!")
@@ -225,7 +225,7 @@ func TestMetricStoreCleanup(t *testing.T) {
 	wg.Add(8)
 
 	cleanup := func(exp time.Time) {
-		store.cleanup(exp)
+		store.cleanup(exp, 0)
 		wg.Done()
 	}
 
@@ -255,6 +255,52 @@ func TestMetricStoreCleanup(t *testing.T) {
 	}
 }
 
+func TestMetricStoreConcurrentUpdates(t *testing.T) {
+	now := time.Now()
+	store := metricStore{}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i != 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j != 100; j++ {
+				store.update(metric{mtype: counter, scope: "svc", name: "metric_" + strconv.Itoa(j), value: 1, time: now}, nil)
+				if j%10 == 0 {
+					store.collect(nil)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	metrics := store.collect(nil)
+	if len(metrics) != 100 {
+		t.Fatalf("bad number of metrics: %d", len(metrics))
+	}
+	for _, m := range metrics {
+		if m.value != 16 {
+			t.Errorf("%s: bad value: %g", m.name, m.value)
+		}
+	}
+}
+
+func BenchmarkMetricStoreUpdateParallel(b *testing.B) {
+	now := time.Now()
+	store := metricStore{}
+
+	names := make([]string, 64)
+	for i := range names {
+		names[i] = "metric_" + strconv.Itoa(i)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			store.update(metric{mtype: counter, scope: "svc", name: names[i%len(names)], value: 1, time: now}, nil)
+		}
+	})
+}
+
 func BenchmarkLE(b *testing.B) {
 	buckets := []stats.Value{
 		stats.ValueOf(0.001),
@@ -0,0 +1,214 @@
+package prometheus
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// nameEscaping is the scheme used to expose metric and label names which are
+// not valid in the legacy character set of Prometheus, like the dotted names
+// of OpenTelemetry conventions.
+//
+// Scrapers which support UTF-8 names negotiate the scheme with the escaping
+// parameter of the Accept header
+// (https://github.com/prometheus/proposals/blob/main/proposals/2023-08-21-utf8.md),
+// the others receive names with invalid characters replaced by underscores.
+type nameEscaping int
+
+const (
+	// underscoreEscaping replaces invalid characters with underscores, it is
+	// lossy but the names are the same as in previous versions.
+	underscoreEscaping nameEscaping = iota
+	// allowUTF8 writes names as they are, names which are not valid legacy
+	// names are quoted in text formats.
+	allowUTF8
+	// dotsEscaping replaces dots with _dot_, underscores with __, and other
+	// invalid characters with __.
+	dotsEscaping
+	// valueEscaping prefixes invalid names with U__ and replaces invalid
+	// characters with their code point in hexadecimal, enclosed in
+	// underscores, so names can be decoded by the scraper.
+	valueEscaping
+)
+
+func (e nameEscaping) String() string {
+	switch e {
+	case allowUTF8:
+		return "allow-utf-8"
+	case dotsEscaping:
+		return "dots"
+	case valueEscaping:
+		return "values"
+	default:
+		return "underscores"
+	}
+}
+
+func parseNameEscaping(s string) (nameEscaping, bool) {
+	switch s {
+	case "underscores":
+		return underscoreEscaping, true
+	case "allow-utf-8":
+		return allowUTF8, true
+	case "dots":
+		return dotsEscaping, true
+	case "values":
+		return valueEscaping, true
+	default:
+		return underscoreEscaping, false
+	}
+}
+
+// metricName returns the exposed name of a metric made of scope and name,
+// before quoting.
+func (e nameEscaping) metricName(scope, name string) string {
+	if e == underscoreEscaping {
+		return string(appendMetricScopedName(nil, scope, name))
+	}
+	if len(scope) != 0 {
+		name = scope + "_" + name
+	}
+	return e.escape(name, isValidFirstMetricByte, isValidMetricByte)
+}
+
+// labelName returns the exposed name of a label, before quoting.
+func (e nameEscaping) labelName(name string) string {
+	if e == underscoreEscaping {
+		if isLegacyLabelName(name) {
+			return name
+		}
+		return string(appendLabelName(nil, name))
+	}
+	return e.escape(name, isValidFirstLabelByte, isValidLabelByte)
+}
+
+func (e nameEscaping) escape(s string, first, rest func(byte) bool) string {
+	valid := func(r rune, i int) bool {
+		if r >= utf8.RuneSelf {
+			return false
+		}
+		if i == 0 {
+			return first(byte(r))
+		}
+		return rest(byte(r))
+	}
+
+	switch e {
+	case dotsEscaping:
+		b := make([]byte, 0, len(s))
+		for i, r := range s {
+			switch {
+			case r == '_':
+				b = append(b, '_', '_')
+			case r == '.':
+				b = append(b, "_dot_"...)
+			case valid(r, i):
+				b = append(b, byte(r))
+			default:
+				b = append(b, '_', '_')
+			}
+		}
+		return string(b)
+
+	case valueEscaping:
+		if isLegacyName(s, first, rest) {
+			return s
+		}
+		b := make([]byte, 0, len(s)+3)
+		b = append(b, "U__"...)
+		for i, r := range s {
+			switch {
+			case r == '_':
+				b = append(b, '_', '_')
+			case valid(r, i):
+				b = append(b, byte(r))
+			default:
+				b = append(b, '_')
+				b = strconv.AppendInt(b, int64(r), 16)
+				b = append(b, '_')
+			}
+		}
+		return string(b)
+
+	default:
+		return strings.ToValidUTF8(s, "\uFFFD")
+	}
+}
+
+// appendName appends a metric name returned by metricName, quoted if it
+// must be.
+func (e nameEscaping) appendName(b []byte, name string) []byte {
+	if e == allowUTF8 && !isLegacyMetricName(name) {
+		return appendQuotedName(b, name)
+	}
+	return append(b, name...)
+}
+
+// appendMetricName appends the name of a metric made of scope and name.
+func (e nameEscaping) appendMetricName(b []byte, scope, name string) []byte {
+	if e == underscoreEscaping {
+		return appendMetricScopedName(b, scope, name)
+	}
+	return e.appendName(b, e.metricName(scope, name))
+}
+
+// appendLabelName appends the name of a label, quoted if it must be.
+func (e nameEscaping) appendLabelName(b []byte, name string) []byte {
+	switch e {
+	case underscoreEscaping:
+		return appendLabelName(b, name)
+	case allowUTF8:
+		if !isLegacyLabelName(name) {
+			return appendQuotedName(b, e.labelName(name))
+		}
+		return append(b, name...)
+	default:
+		return append(b, e.labelName(name)...)
+	}
+}
+
+// appendSeries appends the name of a series followed by its labels. Quoted
+// names are written first within the braces of the labels, as required by the
+// text formats.
+func (e nameEscaping) appendSeries(b []byte, name, suffix string, labels labels) []byte {
+	if e != allowUTF8 || isLegacyMetricName(name) {
+		b = append(b, name...)
+		b = append(b, suffix...)
+		return e.appendLabels(b, labels...)
+	}
+
+	b = append(b, '{')
+	b = appendQuotedName(b, name+suffix)
+	for _, label := range labels {
+		b = append(b, ',')
+		b = e.appendLabel(b, label)
+	}
+	return append(b, '}')
+}
+
+func appendQuotedName(b []byte, s string) []byte {
+	b = append(b, '"')
+	b = appendEscapedString(b, s, indexOfSpecialLabelValueByte)
+	return append(b, '"')
+}
+
+func isLegacyMetricName(s string) bool {
+	return isLegacyName(s, isValidFirstMetricByte, isValidMetricByte)
+}
+
+func isLegacyLabelName(s string) bool {
+	return isLegacyName(s, isValidFirstLabelByte, isValidLabelByte)
+}
+
+func isLegacyName(s string, first, rest func(byte) bool) bool {
+	if len(s) == 0 || !first(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !rest(s[i]) {
+			return false
+		}
+	}
+	return true
+}
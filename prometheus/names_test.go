@@ -0,0 +1,108 @@
+package prometheus
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestNameEscaping(t *testing.T) {
+	tests := []struct {
+		escaping nameEscaping
+		scope    string
+		name     string
+		expect   string
+	}{
+		{escaping: underscoreEscaping, scope: "http.server", name: "request.count", expect: "http_server_request_count"},
+		{escaping: allowUTF8, scope: "http.server", name: "request.count", expect: "http.server_request.count"},
+		{escaping: allowUTF8, scope: "", name: "température", expect: "température"},
+		{escaping: dotsEscaping, scope: "http.server", name: "req_count", expect: "http_dot_server__req__count"},
+		{escaping: valueEscaping, scope: "http.server", name: "count", expect: "U__http_2e_server__count"},
+		{escaping: valueEscaping, scope: "http", name: "count", expect: "http_count"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.escaping.String()+"/"+test.expect, func(t *testing.T) {
+			if name := test.escaping.metricName(test.scope, test.name); name != test.expect {
+				t.Errorf("bad name: expected %q, got %q", test.expect, name)
+			}
+		})
+	}
+}
+
+func TestServeHTTPUTF8Names(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{DisableTimestamps: true}
+	handler.HandleMeasures(now,
+		stats.Measure{
+			Name:   "http.server",
+			Fields: []stats.Field{stats.MakeField("request.count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("http.method", "GET"), stats.T("status", "200")},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("inflight", 3, stats.Gauge)},
+		},
+	)
+
+	scrape := func(accept string) (string, string) {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Header().Get("Content-Type"), res.Body.String()
+	}
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{
+			accept:      "text/plain;version=1.0.0;escaping=allow-utf-8",
+			contentType: "text/plain; version=1.0.0; charset=utf-8; escaping=allow-utf-8",
+			body: `# TYPE rpc_inflight gauge
+rpc_inflight 3
+
+# TYPE "http.server_request.count" counter
+{"http.server_request.count","http.method"="GET",status="200"} 1
+`,
+		},
+		{
+			accept:      "text/plain;version=0.0.4",
+			contentType: "text/plain; version=0.0.4; charset=utf-8",
+			body: `# TYPE rpc_inflight gauge
+rpc_inflight 3
+
+# TYPE http_server_request_count counter
+http_server_request_count{http_method="GET",status="200"} 1
+`,
+		},
+		{
+			accept:      "application/openmetrics-text;version=1.0.0;escaping=allow-utf-8",
+			contentType: "application/openmetrics-text; version=1.0.0; charset=utf-8; escaping=allow-utf-8",
+			body: `# TYPE "http.server_request.count" counter
+{"http.server_request.count_total","http.method"="GET",status="200"} 1
+{"http.server_request.count_created","http.method"="GET",status="200"} 1496614320
+# TYPE rpc_inflight gauge
+rpc_inflight 3
+# EOF
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.accept, func(t *testing.T) {
+			contentType, body := scrape(test.accept)
+			if contentType != test.contentType {
+				t.Errorf("bad content type: expected %q, got %q", test.contentType, contentType)
+			}
+			if body != test.body {
+				t.Errorf("bad body:\n%s\nexpected:\n%s", body, test.body)
+			}
+		})
+	}
+}
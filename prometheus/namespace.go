@@ -0,0 +1,79 @@
+package prometheus
+
+import "sort"
+
+// namePrefix returns the prefix of the exposed family names, made of the
+// namespace and subsystem of the handler.
+func (h *Handler) namePrefix() string {
+	return joinScope(h.Namespace, h.Subsystem)
+}
+
+func joinScope(prefix, scope string) string {
+	switch {
+	case len(prefix) == 0:
+		return scope
+	case len(scope) == 0:
+		return prefix
+	default:
+		return prefix + "_" + scope
+	}
+}
+
+// constLabels returns the constant labels of the handler, including the job
+// and instance labels, sorted by name.
+func (h *Handler) constLabels() labels {
+	l := h.targetLabels()
+	if len(l) == 0 && len(h.ConstLabels) == 0 {
+		return nil
+	}
+	for name, value := range h.ConstLabels {
+		if !l.hasName(name) {
+			l = append(l, label{name: name, value: value})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].name < l[j].name })
+	return l
+}
+
+// appendMissing appends the labels of l to dst, followed by the labels of c
+// which l does not have.
+func (l labels) appendMissing(dst labels, c labels) labels {
+	dst = append(dst, l...)
+	for _, m := range c {
+		if !l.hasName(m.name) {
+			dst = append(dst, m)
+		}
+	}
+	return dst
+}
+
+func (l labels) hasName(name string) bool {
+	for i := range l {
+		if l[i].name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exposeFamily applies the name prefix and the constant labels to a family
+// which is about to be written. The series of families are snapshots, but
+// their labels are shared with the metric store so they are copied.
+func exposeFamily(f *protoFamily, prefix string, constLabels labels) {
+	if len(prefix) != 0 {
+		f.name = string(appendMetricScopedName(nil, prefix, f.name))
+		if len(f.base) != 0 {
+			f.scope = joinScope(prefix, f.scope)
+		}
+	}
+
+	if len(constLabels) != 0 {
+		for i := range f.series {
+			s := &f.series[i]
+			s.labels = s.labels.appendMissing(nil, constLabels)
+			for j := range s.buckets {
+				s.buckets[j].labels = s.buckets[j].labels.appendMissing(nil, constLabels)
+			}
+		}
+	}
+}
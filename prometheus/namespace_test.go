@@ -0,0 +1,147 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestHandlerNamespaceAndConstLabels(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		Namespace:         "acme",
+		Subsystem:         "api",
+		ConstLabels:       map[string]string{"version": "1.2.3", "instance": "host-1"},
+		DisableTimestamps: true,
+		TimestampFamilies: map[string]bool{"rpc_inflight": true},
+	}
+	handler.HandleMeasures(now,
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("instance", "override")},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("inflight", 3, stats.Gauge)},
+		},
+	)
+
+	b := &bytes.Buffer{}
+	handler.WriteStats(b)
+
+	expect := `# TYPE acme_api_rpc_count counter
+acme_api_rpc_count{instance="override",version="1.2.3"} 1
+
+# TYPE acme_api_rpc_inflight gauge
+acme_api_rpc_inflight{instance="host-1",version="1.2.3"} 3 1496614320000
+`
+	if s := b.String(); s != expect {
+		t.Errorf("bad text output:\n%s\nexpected:\n%s", s, expect)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	expect = `# TYPE acme_api_rpc_count counter
+acme_api_rpc_count_total{instance="override",version="1.2.3"} 1
+acme_api_rpc_count_created{instance="override",version="1.2.3"} 1496614320
+# TYPE acme_api_rpc_inflight gauge
+acme_api_rpc_inflight{instance="host-1",version="1.2.3"} 3 1496614320
+# EOF
+`
+	if s := res.Body.String(); s != expect {
+		t.Errorf("bad openmetrics output:\n%s\nexpected:\n%s", s, expect)
+	}
+}
+
+func TestHandlerTargetInfo(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		Namespace:         "acme",
+		Job:               "api",
+		Instance:          "host-1:8080",
+		ConstLabels:       map[string]string{"job": "ignored", "region": "us-west-2"},
+		TargetInfo:        map[string]string{"version": "1.2.3", "instance": "ignored"},
+		DisableTimestamps: true,
+	}
+	handler.HandleMeasures(now, stats.Measure{
+		Name:   "rpc",
+		Fields: []stats.Field{stats.MakeField("inflight", 3, stats.Gauge)},
+	})
+
+	b := &bytes.Buffer{}
+	handler.WriteStats(b)
+
+	expect := `# HELP target_info Target metadata
+# TYPE target_info gauge
+target_info{instance="host-1:8080",job="api",version="1.2.3"} 1
+
+# TYPE acme_rpc_inflight gauge
+acme_rpc_inflight{instance="host-1:8080",job="api",region="us-west-2"} 3
+`
+	if s := b.String(); s != expect {
+		t.Errorf("bad text output:\n%s\nexpected:\n%s", s, expect)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	expect = `# HELP target_info Target metadata
+# TYPE target_info gauge
+target_info{instance="host-1:8080",job="api",version="1.2.3"} 1
+# TYPE acme_rpc_inflight gauge
+acme_rpc_inflight{instance="host-1:8080",job="api",region="us-west-2"} 3
+# EOF
+`
+	if s := res.Body.String(); s != expect {
+		t.Errorf("bad openmetrics output:\n%s\nexpected:\n%s", s, expect)
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", protobufContentType)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	body := res.Body.Bytes()
+	size, n := binary.Uvarint(body)
+	family := decodeProto(t, body[n:n+int(size)])
+
+	if name := string(family[0].bytes); name != "target_info" {
+		t.Fatal("bad name of the first family:", name)
+	}
+	if typ := family[2].varint; typ != protoGaugeType {
+		t.Error("bad type of target_info:", typ)
+	}
+	metric := decodeProto(t, family[3].bytes)
+	if len(metric) != 4 {
+		t.Fatalf("bad number of fields of the target_info series: %d", len(metric))
+	}
+	if label := decodeProto(t, metric[1].bytes); string(label[0].bytes) != "job" || string(label[1].bytes) != "api" {
+		t.Errorf("bad label of the target_info series: %s=%s", label[0].bytes, label[1].bytes)
+	}
+	if value := decodeDouble(decodeProto(t, metric[3].bytes)[0]); value != 1 {
+		t.Error("bad value of the target_info series:", value)
+	}
+}
+
+func TestHandlerWithoutTargetInfo(t *testing.T) {
+	handler := &Handler{ConstLabels: map[string]string{"version": "1.2.3"}}
+
+	b := &bytes.Buffer{}
+	handler.WriteStats(b)
+
+	if s := b.String(); s != "" {
+		t.Errorf("unexpected output:\n%s", s)
+	}
+}
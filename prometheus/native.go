@@ -0,0 +1,196 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultNativeHistogramBucketFactor is the default growth factor of the
+	// buckets of native histograms, it results in buckets about 10% wider than
+	// the previous ones.
+	DefaultNativeHistogramBucketFactor = 1.1
+
+	// DefaultNativeHistogramZeroThreshold is the default width of the zero
+	// bucket of native histograms (2^-128), the same as the official
+	// Prometheus client.
+	DefaultNativeHistogramZeroThreshold = 2.938735877055719e-39
+)
+
+// NativeHistogram configures a Prometheus native histogram.
+//
+// Native histograms have exponentially growing buckets which are created as
+// observations are made, so they don't require tuning bucket boundaries for
+// each metric. They are only exposed when Prometheus negotiates the protobuf
+// exposition format, which requires enabling the native-histograms feature in
+// Prometheus; the text format only exposes their sum and count, and the
+// classic buckets if some were configured as well.
+type NativeHistogram struct {
+	// BucketFactor is the maximum ratio between the upper and lower bounds of
+	// the buckets, the resolution picked is the highest one with a ratio lower
+	// than or equal to the factor (Prometheus supports factors between 1.0027
+	// and 65536). The default is DefaultNativeHistogramBucketFactor.
+	BucketFactor float64
+
+	// ZeroThreshold is the width of the bucket counting observations close to
+	// zero. The default is DefaultNativeHistogramZeroThreshold.
+	ZeroThreshold float64
+}
+
+// NativeHistograms is a map type used to configure the metrics exposed as
+// native histograms by a Handler.
+type NativeHistograms map[stats.Key]*NativeHistogram
+
+// Set sets the native histogram configuration of the metric identified by key,
+// which has the form "measure.field".
+func (n NativeHistograms) Set(key string, nh NativeHistogram) {
+	k := stats.Key{Field: key}
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		k = stats.Key{Measure: key[:i], Field: key[i+1:]}
+	}
+	n[k] = &nh
+}
+
+func (nh *NativeHistogram) schema() int32 {
+	factor := nh.BucketFactor
+	if factor <= 1 {
+		factor = DefaultNativeHistogramBucketFactor
+	}
+	floor := math.Floor(math.Log2(math.Log2(factor)))
+	switch {
+	case floor <= -8:
+		return 8
+	case floor >= 4:
+		return -4
+	default:
+		return -int32(floor)
+	}
+}
+
+func (nh *NativeHistogram) zeroThreshold() float64 {
+	if nh.ZeroThreshold > 0 {
+		return nh.ZeroThreshold
+	}
+	return DefaultNativeHistogramZeroThreshold
+}
+
+// nativeHistogramBounds holds, for each positive schema, the fractions in the
+// [0.5, 1) range which delimit the buckets within a power of two.
+var nativeHistogramBounds [9][]float64
+
+func init() {
+	for schema := range nativeHistogramBounds {
+		n := 1 << schema
+		bounds := make([]float64, n)
+		for i := range bounds {
+			bounds[i] = math.Exp2(float64(i)/float64(n)) / 2
+		}
+		nativeHistogramBounds[schema] = bounds
+	}
+}
+
+// nativeBuckets is the state of a native histogram, counting observations in
+// sparse buckets of exponentially growing width. The bucket of index i covers
+// the (base^(i-1), base^i] range where base is 2^(2^-schema).
+type nativeBuckets struct {
+	config        *NativeHistogram
+	schema        int32
+	zeroThreshold float64
+	zeroCount     uint64
+	positive      map[int32]uint64
+	negative      map[int32]uint64
+}
+
+func newNativeBuckets(nh *NativeHistogram) *nativeBuckets {
+	return &nativeBuckets{
+		config:        nh,
+		schema:        nh.schema(),
+		zeroThreshold: nh.zeroThreshold(),
+		positive:      make(map[int32]uint64),
+		negative:      make(map[int32]uint64),
+	}
+}
+
+func (n *nativeBuckets) configuredWith(nh *NativeHistogram) bool {
+	return n.config == nh
+}
+
+func (n *nativeBuckets) update(value float64, weight uint64) {
+	switch {
+	case math.IsNaN(value):
+	case math.Abs(value) <= n.zeroThreshold:
+		n.zeroCount += weight
+	case value > 0:
+		n.positive[nativeBucketIndex(value, n.schema)] += weight
+	default:
+		n.negative[nativeBucketIndex(-value, n.schema)] += weight
+	}
+}
+
+// nativeBucketIndex returns the index of the bucket that the positive value
+// falls in, for the given schema.
+func nativeBucketIndex(value float64, schema int32) int32 {
+	if math.IsInf(value, +1) {
+		value = math.MaxFloat64
+	}
+
+	frac, exp := math.Frexp(value)
+
+	if schema > 0 {
+		bounds := nativeHistogramBounds[schema]
+		return int32(sort.SearchFloat64s(bounds, frac) + (exp-1)*len(bounds))
+	}
+
+	index := exp
+	if frac == 0.5 {
+		index--
+	}
+	offset := (1 << -schema) - 1
+	return int32((index + offset) >> -schema)
+}
+
+// nativeSpan is a run of consecutive buckets.
+type nativeSpan struct {
+	offset int32
+	length uint32
+}
+
+// spans returns the spans and the deltas between the counts of consecutive
+// buckets, which is how the Prometheus protobuf format represents sparse
+// buckets: the offset of the first span is the index of the first bucket,
+// the offsets of the following spans are the number of empty buckets since
+// the previous span, and the first delta is the count of the first bucket.
+func nativeSpans(buckets map[int32]uint64) (spans []nativeSpan, deltas []int64) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+
+	indexes := make([]int32, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	deltas = make([]int64, 0, len(indexes))
+	var prevCount int64
+
+	for i, index := range indexes {
+		switch {
+		case i == 0:
+			spans = append(spans, nativeSpan{offset: index, length: 1})
+		case index == indexes[i-1]+1:
+			spans[len(spans)-1].length++
+		default:
+			spans = append(spans, nativeSpan{offset: index - indexes[i-1] - 1, length: 1})
+		}
+
+		count := int64(buckets[index])
+		deltas = append(deltas, count-prevCount)
+		prevCount = count
+	}
+
+	return spans, deltas
+}
@@ -0,0 +1,250 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestNativeHistogramSchema(t *testing.T) {
+	tests := []struct {
+		factor float64
+		schema int32
+	}{
+		{factor: 0, schema: 3},
+		{factor: 1.1, schema: 3},
+		{factor: 1.01, schema: 7},
+		{factor: 1.0001, schema: 8},
+		{factor: 2, schema: 0},
+		{factor: 4, schema: -1},
+		{factor: 1e30, schema: -4},
+	}
+
+	for _, test := range tests {
+		nh := &NativeHistogram{BucketFactor: test.factor}
+		if schema := nh.schema(); schema != test.schema {
+			t.Errorf("factor %g: expected schema %d, got %d", test.factor, test.schema, schema)
+		}
+	}
+}
+
+func TestNativeBucketIndex(t *testing.T) {
+	tests := []struct {
+		value  float64
+		schema int32
+		index  int32
+	}{
+		{value: 1, schema: 0, index: 0},
+		{value: 1.5, schema: 0, index: 1},
+		{value: 2, schema: 0, index: 1},
+		{value: 3, schema: 0, index: 2},
+		{value: 0.5, schema: 0, index: -1},
+		{value: 1, schema: 3, index: 0},
+		{value: 1.05, schema: 3, index: 1},
+		{value: math.Exp2(1.0 / 8), schema: 3, index: 1},
+		{value: 2, schema: 3, index: 8},
+		{value: 4, schema: -1, index: 1},
+		{value: 5, schema: -1, index: 2},
+		{value: 16, schema: -1, index: 2},
+	}
+
+	for _, test := range tests {
+		if index := nativeBucketIndex(test.value, test.schema); index != test.index {
+			t.Errorf("value %g with schema %d: expected index %d, got %d", test.value, test.schema, test.index, index)
+		}
+	}
+}
+
+func TestNativeSpans(t *testing.T) {
+	spans, deltas := nativeSpans(map[int32]uint64{
+		-2: 1,
+		-1: 3,
+		3:  2,
+		4:  2,
+		5:  1,
+	})
+
+	expectSpans := []nativeSpan{{offset: -2, length: 2}, {offset: 3, length: 3}}
+	expectDeltas := []int64{1, 2, -1, 0, -1}
+
+	if !reflect.DeepEqual(spans, expectSpans) {
+		t.Errorf("bad spans:\n- expected: %v\n- found:    %v", expectSpans, spans)
+	}
+	if !reflect.DeepEqual(deltas, expectDeltas) {
+		t.Errorf("bad deltas:\n- expected: %v\n- found:    %v", expectDeltas, deltas)
+	}
+}
+
+func TestServeHTTPProtobuf(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{
+		Buckets: map[stats.Key][]stats.Value{
+			{Measure: "rpc", Field: "latency"}: {stats.ValueOf(0.5), stats.ValueOf(1.0)},
+		},
+		NativeHistograms: NativeHistograms{},
+	}
+	handler.NativeHistograms.Set("rpc.latency", NativeHistogram{BucketFactor: 2})
+
+	handler.HandleMeasures(now,
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("count", 2, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "get")},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("latency", 0.25, stats.Histogram)},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("latency", 3.0, stats.Histogram)},
+		},
+	)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept", "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if contentType := res.Header.Get("Content-Type"); contentType != protobufContentType {
+		t.Fatal("bad content type:", contentType)
+	}
+
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(res.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	var families [][]protoField
+	for b := body.Bytes(); len(b) != 0; {
+		size, n := binary.Uvarint(b)
+		families = append(families, decodeProto(t, b[n:n+int(size)]))
+		b = b[n+int(size):]
+	}
+
+	if len(families) != 2 {
+		t.Fatal("expected 2 families, got", len(families))
+	}
+
+	counter := families[0]
+	if name := string(counter[0].bytes); name != "rpc_count" {
+		t.Error("bad counter name:", name)
+	}
+	if typ := counter[1].varint; typ != protoCounterType {
+		t.Error("bad counter type:", typ)
+	}
+	metric := decodeProto(t, counter[2].bytes)
+	label := decodeProto(t, metric[0].bytes)
+	if name, value := string(label[0].bytes), string(label[1].bytes); name != "method" || value != "get" {
+		t.Errorf("bad counter label: %s=%s", name, value)
+	}
+	if value := decodeDouble(decodeProto(t, metric[1].bytes)[0]); value != 2 {
+		t.Error("bad counter value:", value)
+	}
+	if ts := metric[2].varint; ts != uint64(now.UnixMilli()) {
+		t.Error("bad counter timestamp:", ts)
+	}
+
+	hist := families[1]
+	if name := string(hist[0].bytes); name != "rpc_latency" {
+		t.Error("bad histogram name:", name)
+	}
+	if typ := hist[1].varint; typ != protoHistogramType {
+		t.Error("bad histogram type:", typ)
+	}
+
+	fields := make(map[int][]protoField)
+	for _, f := range decodeProto(t, decodeProto(t, hist[2].bytes)[0].bytes) {
+		fields[f.num] = append(fields[f.num], f)
+	}
+
+	if count := fields[1][0].varint; count != 2 {
+		t.Error("bad histogram count:", count)
+	}
+	if sum := decodeDouble(fields[2][0]); sum != 3.25 {
+		t.Error("bad histogram sum:", sum)
+	}
+	if len(fields[3]) != 2 {
+		t.Error("expected 2 classic buckets, got", len(fields[3]))
+	}
+	if schema := fields[5][0].varint; schema != zigzag(0) {
+		t.Error("bad histogram schema:", schema)
+	}
+	if len(fields[9]) != 0 || len(fields[10]) != 0 {
+		t.Error("unexpected negative buckets")
+	}
+
+	// 0.25 falls in bucket -2 and 3.0 in bucket 2, two spans of one bucket
+	// with three empty buckets in between.
+	var spans [][2]uint64
+	for _, f := range fields[12] {
+		span := decodeProto(t, f.bytes)
+		spans = append(spans, [2]uint64{span[0].varint, span[1].varint})
+	}
+	if expect := [][2]uint64{{zigzag(-2), 1}, {zigzag(3), 1}}; !reflect.DeepEqual(spans, expect) {
+		t.Errorf("bad positive spans:\n- expected: %v\n- found:    %v", expect, spans)
+	}
+
+	var deltas []uint64
+	for b := fields[13][0].bytes; len(b) != 0; {
+		d, n := binary.Uvarint(b)
+		deltas = append(deltas, d)
+		b = b[n:]
+	}
+	if expect := []uint64{zigzag(1), zigzag(0)}; !reflect.DeepEqual(deltas, expect) {
+		t.Errorf("bad positive deltas:\n- expected: %v\n- found:    %v", expect, deltas)
+	}
+}
+
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+
+	for len(b) != 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		f := protoField{num: int(tag >> 3)}
+
+		switch tag & 7 {
+		case protoVarint:
+			f.varint, n = binary.Uvarint(b)
+			b = b[n:]
+		case protoFixed64:
+			f.bytes, b = b[:8], b[8:]
+		case protoBytes:
+			size, n := binary.Uvarint(b)
+			f.bytes, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatal("unexpected wire type:", tag&7)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+func decodeDouble(f protoField) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(f.bytes))
+}
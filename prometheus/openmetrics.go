@@ -0,0 +1,172 @@
+package prometheus
+
+import (
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openMetricsContentType is the content type of the OpenMetrics text format
+// (https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md).
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// openMetricsLegacyContentType is the content type of the pre-release version
+// of the format, which some scrapers still ask for. The output of the handler
+// is the same in both versions.
+const openMetricsLegacyContentType = "application/openmetrics-text; version=0.0.1; charset=utf-8"
+
+func (h *Handler) writeOpenMetrics(w io.Writer, deadline time.Time, escaping nameEscaping) {
+	families, _ := h.metrics.collectFamilies(deadline)
+	families = h.descriptions.describeFamilies(families)
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	b := make([]byte, 0, 1024)
+	now := time.Now()
+	prefix, constLabels := h.namePrefix(), h.constLabels()
+
+	if target, ok := h.targetInfoFamily(); ok {
+		if _, err := w.Write(appendOpenMetricsFamily(b, &target, escaping)); err != nil {
+			return
+		}
+	}
+
+	for i := range families {
+		// The format does not allow comments, so unlike the text format there
+		// is no way to mark the response as truncated, it simply ends early
+		// when the deadline is exceeded.
+		if !deadline.IsZero() && i != 0 && !time.Now().Before(deadline) {
+			break
+		}
+
+		for j := range families[i].series {
+			s := &families[i].series[j]
+			s.time = h.timestamp(families[i].name, s.time, now)
+		}
+		exposeFamily(&families[i], prefix, constLabels)
+
+		if _, err := w.Write(appendOpenMetricsFamily(b[:0], &families[i], escaping)); err != nil {
+			return
+		}
+	}
+
+	_, _ = io.WriteString(w, "# EOF\n")
+}
+
+func appendOpenMetricsFamily(b []byte, f *protoFamily, e nameEscaping) []byte {
+	name := f.exposedName(e)
+	if f.mtype == counter {
+		// Counter samples are suffixed with _total, which isn't part of the
+		// family name.
+		name = strings.TrimSuffix(name, "_total")
+	}
+
+	if len(f.help) != 0 {
+		b = append(b, "# HELP "...)
+		b = e.appendName(b, name)
+		b = append(b, ' ')
+		b = appendEscapedString(b, f.help, indexOfSpecialLabelValueByte)
+		b = append(b, '\n')
+	}
+
+	b = append(b, "# TYPE "...)
+	b = e.appendName(b, name)
+	b = append(b, ' ')
+	b = append(b, f.mtype.String()...)
+	b = append(b, '\n')
+
+	for i := range f.series {
+		s := &f.series[i]
+
+		switch f.mtype {
+		case counter:
+			b = appendOpenMetricsSample(b, e, name, "_total", s.labels, s.value, s.time, s.exemplar)
+			b = appendOpenMetricsCreated(b, e, name, s)
+
+		case gauge:
+			b = appendOpenMetricsSample(b, e, name, "", s.labels, s.value, s.time, nil)
+
+		case histogram:
+			var cumulativeCount uint64
+			for _, bucket := range s.buckets {
+				cumulativeCount += bucket.count
+				b = appendOpenMetricsSample(b, e, name, "_bucket", bucket.labels, float64(cumulativeCount), s.time, bucket.exemplar)
+			}
+			// The format requires histograms to have a +Inf bucket.
+			if n := len(s.buckets); n == 0 || !math.IsInf(s.buckets[n-1].limit, +1) {
+				inf := s.labels.copyAppend(label{"le", "+Inf"})
+				b = appendOpenMetricsSample(b, e, name, "_bucket", inf, float64(s.count), s.time, s.exemplar)
+			}
+			b = appendOpenMetricsSample(b, e, name, "_count", s.labels, float64(s.count), s.time, nil)
+			b = appendOpenMetricsSample(b, e, name, "_sum", s.labels, s.sum, s.time, nil)
+			b = appendOpenMetricsCreated(b, e, name, s)
+
+		case summary:
+			for _, q := range s.quantiles {
+				l := s.labels.copyAppend(label{"quantile", string(appendFloat(nil, q.quantile))})
+				b = appendOpenMetricsSample(b, e, name, "", l, q.value, s.time, nil)
+			}
+			b = appendOpenMetricsSample(b, e, name, "_count", s.labels, float64(s.count), s.time, nil)
+			b = appendOpenMetricsSample(b, e, name, "_sum", s.labels, s.sum, s.time, nil)
+			b = appendOpenMetricsCreated(b, e, name, s)
+		}
+	}
+
+	return b
+}
+
+func appendOpenMetricsSample(b []byte, e nameEscaping, name, suffix string, labels labels, value float64, t time.Time, ex *exemplar) []byte {
+	b = e.appendSeries(b, name, suffix, labels)
+	b = append(b, ' ')
+	b = appendFloat(b, value)
+
+	if !t.IsZero() {
+		b = append(b, ' ')
+		b = appendOpenMetricsTimestamp(b, t)
+	}
+
+	if ex != nil {
+		b = append(b, " # {"...)
+		for i, l := range ex.labels {
+			if i != 0 {
+				b = append(b, ',')
+			}
+			b = e.appendLabel(b, l)
+		}
+		b = append(b, "} "...)
+		b = appendFloat(b, ex.value)
+		if !ex.time.IsZero() {
+			b = append(b, ' ')
+			b = appendOpenMetricsTimestamp(b, ex.time)
+		}
+	}
+
+	return append(b, '\n')
+}
+
+// appendOpenMetricsCreated appends the _created sample of a series, which
+// tells scrapers when it was first observed so counter resets can be told
+// apart from series that expired and came back.
+func appendOpenMetricsCreated(b []byte, e nameEscaping, name string, s *protoSeries) []byte {
+	if s.created.IsZero() {
+		return b
+	}
+	b = e.appendSeries(b, name, "_created", s.labels)
+	b = append(b, ' ')
+	b = appendOpenMetricsTimestamp(b, s.created)
+	if !s.time.IsZero() {
+		b = append(b, ' ')
+		b = appendOpenMetricsTimestamp(b, s.time)
+	}
+	return append(b, '\n')
+}
+
+// appendOpenMetricsTimestamp appends t in seconds with millisecond precision,
+// which is how timestamps are represented in the OpenMetrics format.
+func appendOpenMetricsTimestamp(b []byte, t time.Time) []byte {
+	return strconv.AppendFloat(b, float64(t.UnixMilli())/1e3, 'f', -1, 64)
+}
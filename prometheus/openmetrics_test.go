@@ -0,0 +1,165 @@
+package prometheus
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept      string
+		format      exposition
+		escaping    nameEscaping
+		contentType string
+	}{
+		{
+			accept:      "",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+		{
+			accept:      "application/json",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+		{
+			accept:      "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+			format:      openMetricsFormat,
+			contentType: openMetricsContentType,
+		},
+		{
+			accept:      "application/openmetrics-text;version=0.0.1",
+			format:      openMetricsFormat,
+			contentType: openMetricsLegacyContentType,
+		},
+		{
+			accept:      "application/openmetrics-text;version=2.0.0",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+		{
+			accept:      "text/plain;version=0.0.4;q=0.9,application/openmetrics-text;q=0.5",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+		{
+			accept:      "application/openmetrics-text;q=0,text/plain",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+		{
+			accept:      "text/plain,application/openmetrics-text",
+			format:      openMetricsFormat,
+			contentType: openMetricsContentType,
+		},
+		{
+			accept:      "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.6,application/openmetrics-text;version=1.0.0;q=0.5",
+			format:      protobufFormat,
+			contentType: protobufContentType,
+		},
+		{
+			accept:      "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=text",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+		{
+			accept:      "text/plain;version=1.0.0;escaping=allow-utf-8;q=0.5,text/plain;version=0.0.4;q=0.4",
+			format:      textFormat,
+			escaping:    allowUTF8,
+			contentType: textUTF8ContentType + "; escaping=allow-utf-8",
+		},
+		{
+			accept:      "application/openmetrics-text;version=1.0.0;escaping=dots",
+			format:      openMetricsFormat,
+			escaping:    dotsEscaping,
+			contentType: openMetricsContentType + "; escaping=dots",
+		},
+		{
+			accept:      "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;escaping=values",
+			format:      protobufFormat,
+			escaping:    valueEscaping,
+			contentType: protobufContentType + "; escaping=values",
+		},
+		{
+			accept:      "text/plain;version=0.0.4;escaping=unknown",
+			format:      textFormat,
+			contentType: textContentType,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.accept, func(t *testing.T) {
+			format, escaping, contentType := negotiateFormat(test.accept)
+			if format != test.format {
+				t.Errorf("bad format: expected %d, got %d", test.format, format)
+			}
+			if escaping != test.escaping {
+				t.Errorf("bad escaping: expected %s, got %s", test.escaping, escaping)
+			}
+			if contentType != test.contentType {
+				t.Errorf("bad content type: expected %q, got %q", test.contentType, contentType)
+			}
+		})
+	}
+}
+
+func TestServeHTTPOpenMetrics(t *testing.T) {
+	start := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+	now := start.Add(1500 * time.Millisecond)
+
+	handler := &Handler{
+		Summaries: Summaries{},
+	}
+	handler.Summaries.Set("rpc.latency", Summary{Objectives: map[float64]float64{0.5: 0.05}})
+
+	handler.HandleMeasures(start,
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		},
+		stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("latency", 1.0, stats.Histogram)},
+		},
+	)
+	handler.HandleMeasures(now,
+		stats.Measure{
+			Name: "rpc",
+			Fields: []stats.Field{
+				stats.MakeField("count", 1, stats.Counter),
+				stats.MakeField("inflight", 3, stats.Gauge),
+			},
+		},
+	)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	if contentType := res.Header().Get("Content-Type"); contentType != openMetricsContentType {
+		t.Error("bad content type:", contentType)
+	}
+
+	// Gauges have no _created series, the creation time of other series is
+	// the time of their first measure.
+	const expect = `# TYPE rpc_count counter
+rpc_count_total 2 1496614321.5
+rpc_count_created 1496614320 1496614321.5
+# TYPE rpc_inflight gauge
+rpc_inflight 3 1496614321.5
+# TYPE rpc_latency summary
+rpc_latency{quantile="0.5"} 1 1496614320
+rpc_latency_count 1 1496614320
+rpc_latency_sum 1 1496614320
+rpc_latency_created 1496614320 1496614320
+# EOF
+`
+
+	if body := res.Body.String(); body != expect {
+		t.Errorf("bad OpenMetrics output:\n- expected:\n%s\n- found:\n%s", expect, body)
+	}
+}
@@ -0,0 +1,386 @@
+// Package promtest provides utilities to validate the metrics exposed by
+// prometheus handlers, with lint rules modeled after "promtool check metrics".
+//
+// Programs can use it in their tests to make sure that the metrics they
+// produce are valid before they reach a Prometheus server:
+//
+//	func TestMetrics(t *testing.T) {
+//		h := &prometheus.Handler{}
+//		eng := stats.NewEngine("myapp", h)
+//		... produce metrics with eng ...
+//		promtest.Check(t, h)
+//	}
+package promtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Names of the lint rules, they are set in the Rule field of problems.
+const (
+	// The line could not be parsed.
+	RuleMalformed = "malformed"
+
+	// The same series (metric name and labels) is exposed more than once.
+	RuleDuplicateSeries = "duplicate-series"
+
+	// The metric name does not match [a-zA-Z_:][a-zA-Z0-9_:]*.
+	RuleInvalidMetricName = "invalid-metric-name"
+
+	// The label name does not match [a-zA-Z_][a-zA-Z0-9_]*.
+	RuleInvalidLabelName = "invalid-label-name"
+
+	// The label name starts with "__", which is reserved by Prometheus.
+	RuleReservedLabelName = "reserved-label-name"
+
+	// The TYPE of the metric is declared more than once.
+	RuleTypeRedeclared = "type-redeclared"
+
+	// The metric name is written in camelCase instead of snake_case.
+	RuleCamelCase = "camel-case"
+
+	// The metric name has a unit suffix which is not a base unit, for
+	// example "_milliseconds" instead of "_seconds".
+	RuleNonBaseUnit = "non-base-unit"
+
+	// The name of the counter does not end with "_total", see
+	// LintConfig.CounterSuffix.
+	RuleCounterSuffix = "counter-suffix"
+
+	// The metric has no HELP text, see LintConfig.RequireHelp.
+	RuleMissingHelp = "missing-help"
+)
+
+// Problem is a problem found in a metrics exposition.
+type Problem struct {
+	// Line number of the problem in the exposition.
+	Line int
+
+	// Name of the metric the problem was found on.
+	Metric string
+
+	// Name of the rule which found the problem.
+	Rule string
+
+	// Text describes the problem.
+	Text string
+}
+
+// String satisfies the fmt.Stringer interface, the format is similar to the
+// output of promtool.
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s: %s (%s)", p.Line, p.Metric, p.Text, p.Rule)
+}
+
+// LintConfig carries the configuration of LintWith.
+type LintConfig struct {
+	// CounterSuffix enables the RuleCounterSuffix rule, counters exposed by
+	// the handlers of this module are named after the stats metrics, and do
+	// not get a "_total" suffix.
+	CounterSuffix bool
+
+	// RequireHelp enables the RuleMissingHelp rule.
+	RequireHelp bool
+}
+
+// Lint parses the metrics in the prometheus text exposition format read from r,
+// and returns the problems found with the default configuration.
+func Lint(r io.Reader) ([]Problem, error) {
+	return LintWith(r, LintConfig{})
+}
+
+// LintWith parses the metrics in the prometheus text exposition format read
+// from r, and returns the problems found with the given configuration. The
+// error is only set if reading from r failed.
+func LintWith(r io.Reader, config LintConfig) ([]Problem, error) {
+	l := linter{
+		config: config,
+		types:  make(map[string]string),
+		helps:  make(map[string]bool),
+		series: make(map[string]int),
+		names:  make(map[string]int),
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		l.line++
+		l.lint(s.Text())
+	}
+
+	if err := s.Err(); err != nil {
+		return l.problems, err
+	}
+
+	l.finish()
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+	return l.problems, nil
+}
+
+type linter struct {
+	config   LintConfig
+	line     int
+	types    map[string]string // family name => type
+	helps    map[string]bool   // family name => has help
+	series   map[string]int    // series key => first line
+	names    map[string]int    // metric name => first line
+	problems []Problem
+}
+
+func (l *linter) report(metric, rule, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		Line:   l.line,
+		Metric: metric,
+		Rule:   rule,
+		Text:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lint(line string) {
+	switch {
+	case strings.TrimSpace(line) == "":
+	case strings.HasPrefix(line, "#"):
+		l.lintComment(line)
+	default:
+		l.lintSample(line)
+	}
+}
+
+func (l *linter) lintComment(line string) {
+	fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+
+	if len(fields) < 2 {
+		return // other comments, like "# EOF" in OpenMetrics
+	}
+
+	switch name := fields[1]; fields[0] {
+	case "TYPE":
+		if len(fields) != 3 {
+			l.report(name, RuleMalformed, "TYPE line without a type")
+			return
+		}
+		if _, ok := l.types[name]; ok {
+			l.report(name, RuleTypeRedeclared, "TYPE declared more than once")
+			return
+		}
+		l.types[name] = fields[2]
+		l.lintName(name)
+	case "HELP":
+		l.helps[name] = true
+	}
+}
+
+func (l *linter) lintSample(line string) {
+	name, labels, rest, err := parseSample(line)
+	if err != nil {
+		l.report(name, RuleMalformed, "%s", err)
+		return
+	}
+
+	if len(strings.Fields(rest)) == 0 {
+		l.report(name, RuleMalformed, "sample without a value")
+		return
+	}
+
+	if _, ok := l.names[name]; !ok {
+		l.names[name] = l.line
+		if _, typed := l.types[l.family(name)]; !typed {
+			l.lintName(name)
+		}
+	}
+
+	for _, label := range labels {
+		switch {
+		case !validLabelName(label[0]):
+			l.report(name, RuleInvalidLabelName, "invalid label name %q", label[0])
+		case strings.HasPrefix(label[0], "__"):
+			l.report(name, RuleReservedLabelName, "label name %q is reserved", label[0])
+		}
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+
+	key := name
+	for _, label := range labels {
+		key += "\xff" + label[0] + "\xfe" + label[1]
+	}
+
+	if first, ok := l.series[key]; ok {
+		l.report(name, RuleDuplicateSeries, "series already exposed on line %d", first)
+		return
+	}
+	l.series[key] = l.line
+}
+
+// lintName checks the conventions on the name of a metric family.
+func (l *linter) lintName(name string) {
+	if !validMetricName(name) {
+		l.report(name, RuleInvalidMetricName, "invalid metric name")
+		return
+	}
+
+	for i := 1; i < len(name); i++ {
+		if isLower(name[i-1]) && isUpper(name[i]) {
+			l.report(name, RuleCamelCase, "metric names should be written in snake_case not camelCase")
+			break
+		}
+	}
+
+	for _, unit := range nonBaseUnits {
+		if strings.HasSuffix(name, "_"+unit[0]) || strings.Contains(name, "_"+unit[0]+"_") {
+			l.report(name, RuleNonBaseUnit, "use base unit %q instead of %q", unit[1], unit[0])
+			break
+		}
+	}
+}
+
+// family returns the name of the family that the sample named name belongs to,
+// taking into account the suffixes of histograms and summaries.
+func (l *linter) family(name string) string {
+	if _, ok := l.types[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_count", "_sum", "_created", "_total"} {
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			if _, ok := l.types[base]; ok {
+				return base
+			}
+		}
+	}
+	return name
+}
+
+func (l *linter) finish() {
+	families := make([]string, 0, len(l.types))
+	for name := range l.types {
+		families = append(families, name)
+	}
+	sort.Strings(families)
+
+	for _, name := range families {
+		l.line = 0
+		for metric, line := range l.names {
+			if l.family(metric) == name && (l.line == 0 || line < l.line) {
+				l.line = line
+			}
+		}
+
+		if l.config.CounterSuffix && l.types[name] == "counter" && !strings.HasSuffix(name, "_total") {
+			l.report(name, RuleCounterSuffix, `counter metrics should have "_total" suffix`)
+		}
+
+		if l.config.RequireHelp && !l.helps[name] {
+			l.report(name, RuleMissingHelp, "no help text")
+		}
+	}
+}
+
+var nonBaseUnits = [][2]string{
+	{"milliseconds", "seconds"},
+	{"microseconds", "seconds"},
+	{"nanoseconds", "seconds"},
+	{"minutes", "seconds"},
+	{"hours", "seconds"},
+	{"kilobytes", "bytes"},
+	{"megabytes", "bytes"},
+	{"gigabytes", "bytes"},
+	{"bits", "bytes"},
+	{"percent", "ratio"},
+}
+
+// parseSample splits a sample line into the metric name, its labels, and the
+// rest of the line (value, timestamp, and exemplar).
+func parseSample(line string) (name string, labels [][2]string, rest string, err error) {
+	i := strings.IndexAny(line, "{ \t")
+	if i < 0 {
+		return line, nil, "", fmt.Errorf("sample without a value")
+	}
+
+	name, rest = line[:i], line[i:]
+
+	if !strings.HasPrefix(rest, "{") {
+		return name, nil, rest, nil
+	}
+	rest = rest[1:]
+
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+
+		if strings.HasPrefix(rest, "}") {
+			return name, labels, rest[1:], nil
+		}
+
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 || len(rest) < eq+2 || rest[eq+1] != '"' {
+			return name, labels, "", fmt.Errorf("malformed labels")
+		}
+
+		label := strings.TrimSpace(rest[:eq])
+		value, n, ok := parseQuoted(rest[eq+1:])
+		if !ok {
+			return name, labels, "", fmt.Errorf("unterminated value of label %q", label)
+		}
+
+		labels = append(labels, [2]string{label, value})
+		rest = rest[eq+1+n:]
+	}
+}
+
+// parseQuoted parses the quoted string at the beginning of s, it returns the
+// unescaped value and the number of bytes consumed.
+func parseQuoted(s string) (string, int, bool) {
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, true
+		case '\\':
+			if i++; i == len(s) {
+				return "", 0, false
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, false
+}
+
+func validMetricName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(isLetter(c) || c == '_' || c == ':' || (i != 0 && isDigit(c))) {
+			return false
+		}
+	}
+	return len(s) != 0
+}
+
+func validLabelName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(isLetter(c) || c == '_' || (i != 0 && isDigit(c))) {
+			return false
+		}
+	}
+	return len(s) != 0
+}
+
+func isLetter(c byte) bool { return isLower(c) || isUpper(c) }
+func isLower(c byte) bool  { return c >= 'a' && c <= 'z' }
+func isUpper(c byte) bool  { return c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
@@ -0,0 +1,76 @@
+package promtest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	const exposition = `# TYPE http_requests counter
+http_requests{method="GET",path="/a"} 1
+http_requests{path="/a",method="GET"} 2
+http_requests{method="GET",__path="/b"} 3
+# TYPE http_requests counter
+# TYPE request_duration_milliseconds histogram
+request_duration_milliseconds_bucket{le="0.1"} 1
+request_duration_milliseconds_bucket{le="+Inf"} 1
+request_duration_milliseconds_count 1
+request_duration_milliseconds_sum 0.1
+httpRequests{1abc="x"} 1
+queue_size{name="a \"quoted\" value"} 1
+queue_size{name="a \"quoted\" value"} 2
+broken{name="a} 1
+`
+
+	problems, err := Lint(strings.NewReader(exposition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rules []string
+	for _, p := range problems {
+		rules = append(rules, p.Rule)
+	}
+
+	expected := []string{
+		RuleDuplicateSeries,
+		RuleReservedLabelName,
+		RuleTypeRedeclared,
+		RuleNonBaseUnit,
+		RuleCamelCase,
+		RuleInvalidLabelName,
+		RuleDuplicateSeries,
+		RuleMalformed,
+	}
+
+	if !reflect.DeepEqual(rules, expected) {
+		for _, p := range problems {
+			t.Log(p)
+		}
+		t.Errorf("bad problems:\nwant %v\ngot  %v", expected, rules)
+	}
+}
+
+func TestLintWith(t *testing.T) {
+	const exposition = `# HELP jobs_total Number of jobs.
+# TYPE jobs_total counter
+jobs_total 1
+# TYPE jobs_failed counter
+jobs_failed 1
+`
+
+	problems, err := LintWith(strings.NewReader(exposition), LintConfig{CounterSuffix: true, RequireHelp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Problem{
+		{Line: 5, Metric: "jobs_failed", Rule: RuleCounterSuffix, Text: `counter metrics should have "_total" suffix`},
+		{Line: 5, Metric: "jobs_failed", Rule: RuleMissingHelp, Text: "no help text"},
+	}
+
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("bad problems:\nwant %v\ngot  %v", expected, problems)
+	}
+}
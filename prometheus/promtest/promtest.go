@@ -0,0 +1,61 @@
+package promtest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// Scrape sends a scrape request to h, like a Prometheus server would, and
+// returns the body of the response. The exposition is requested in the text
+// format.
+func Scrape(h http.Handler) ([]byte, error) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "text/plain; version=0.0.4")
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("scrape failed with status %d: %s", res.Code, strings.TrimSpace(res.Body.String()))
+	}
+
+	return res.Body.Bytes(), nil
+}
+
+// T is the subset of testing.TB used by Check.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Check scrapes h and reports the problems found in the exposition with the
+// default configuration as errors of t.
+func Check(t T, h http.Handler) {
+	t.Helper()
+	CheckWith(t, h, LintConfig{})
+}
+
+// CheckWith scrapes h and reports the problems found in the exposition with
+// the given configuration as errors of t.
+func CheckWith(t T, h http.Handler, config LintConfig) {
+	t.Helper()
+
+	b, err := Scrape(h)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+
+	problems, err := LintWith(bytes.NewReader(b), config)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+
+	for _, p := range problems {
+		t.Errorf("%s", p)
+	}
+}
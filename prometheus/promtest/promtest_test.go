@@ -0,0 +1,37 @@
+package promtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/prometheus"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestCheck(t *testing.T) {
+	h := &prometheus.Handler{}
+	eng := stats.NewEngine("app", h)
+	eng.Incr("requests.count", stats.T("method", "GET"))
+	eng.Set("queue.size", 3)
+	eng.Set("latency.milliseconds", 3)
+
+	r := &recorder{}
+	Check(r, h)
+
+	if len(r.errors) != 1 {
+		t.Fatalf("expected 1 problem, got %q", r.errors)
+	}
+	t.Log(r.errors[0])
+}
+
+var _ T = (*testing.T)(nil)
@@ -0,0 +1,414 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// protobufContentType is the content type of the protobuf exposition format,
+// where the response is a sequence of length-delimited MetricFamily messages
+// (https://github.com/prometheus/client_model/blob/master/io/prometheus/client/metrics.proto).
+const protobufContentType = "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited"
+
+// protoFamily is a snapshot of a metric entry, taken to be written in the
+// protobuf format where all series of a family are grouped in one message.
+type protoFamily struct {
+	mtype  metricType
+	name   string // exposed name, with invalid characters replaced by underscores
+	help   string
+	series []protoSeries
+
+	// scope and base are the parts of the unescaped name, they are empty for
+	// families which were only described.
+	scope string
+	base  string
+}
+
+// exposedName returns the name of the family escaped with e.
+func (f *protoFamily) exposedName(e nameEscaping) string {
+	if e == underscoreEscaping || len(f.base) == 0 {
+		return f.name
+	}
+	return e.metricName(f.scope, f.base)
+}
+
+type protoSeries struct {
+	labels    labels
+	value     float64
+	sum       float64
+	count     uint64
+	time      time.Time
+	created   time.Time
+	buckets   []metricBucket
+	native    *protoNative
+	quantiles []protoQuantile
+	exemplar  *exemplar
+}
+
+type protoQuantile struct {
+	quantile float64
+	value    float64
+}
+
+type protoNative struct {
+	schema         int32
+	zeroThreshold  float64
+	zeroCount      uint64
+	positiveSpans  []nativeSpan
+	positiveDeltas []int64
+	negativeSpans  []nativeSpan
+	negativeDeltas []int64
+}
+
+func (store *metricStore) collectFamilies(deadline time.Time) ([]protoFamily, bool) {
+	var families []protoFamily
+
+	complete := store.rangeEntries(func(entry *metricEntry) bool {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return false
+		}
+		if family, ok := entry.collectFamily(); ok {
+			families = append(families, family)
+		}
+		return true
+	})
+
+	return families, complete
+}
+
+func (entry *metricEntry) collectFamily() (protoFamily, bool) {
+	family := protoFamily{
+		mtype: entry.mtype,
+		name:  string(appendMetricScopedName(nil, entry.scope, entry.name)),
+		help:  entry.help,
+		scope: entry.scope,
+		base:  entry.name,
+	}
+
+	if entry.mtype == untyped {
+		return family, false
+	}
+
+	entry.mutex.RLock()
+
+	for _, states := range entry.states {
+		for _, state := range states {
+			family.series = append(family.series, state.collectSeries())
+		}
+	}
+
+	entry.mutex.RUnlock()
+
+	if len(family.series) == 0 {
+		return family, false
+	}
+
+	sort.Slice(family.series, func(i, j int) bool {
+		return family.series[i].labels.less(family.series[j].labels)
+	})
+	return family, true
+}
+
+func (state *metricState) collectSeries() protoSeries {
+	state.mutex.Lock()
+
+	series := protoSeries{
+		labels:  state.labels,
+		value:   state.value,
+		sum:     state.sum,
+		count:   state.count,
+		time:    state.time,
+		created: state.created,
+		// exemplars are immutable, they can be shared with the snapshot
+		exemplar: state.exemplar,
+	}
+
+	if len(state.buckets) != 0 {
+		series.buckets = make([]metricBucket, len(state.buckets))
+		copy(series.buckets, state.buckets)
+	}
+
+	if n := state.native; n != nil {
+		series.native = &protoNative{
+			schema:        n.schema,
+			zeroThreshold: n.zeroThreshold,
+			zeroCount:     n.zeroCount,
+		}
+		series.native.positiveSpans, series.native.positiveDeltas = nativeSpans(n.positive)
+		series.native.negativeSpans, series.native.negativeDeltas = nativeSpans(n.negative)
+	}
+
+	if s := state.summary; s != nil {
+		series.quantiles = make([]protoQuantile, len(s.quantiles))
+		for i, q := range s.quantiles {
+			series.quantiles[i] = protoQuantile{quantile: q, value: s.query(i)}
+		}
+	}
+
+	state.mutex.Unlock()
+	return series
+}
+
+func (h *Handler) writeProtobuf(w io.Writer, deadline time.Time, escaping nameEscaping) {
+	families, _ := h.metrics.collectFamilies(deadline)
+	families = h.descriptions.describeFamilies(families)
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	var b, m []byte
+	now := time.Now()
+	prefix, constLabels := h.namePrefix(), h.constLabels()
+
+	if target, ok := h.targetInfoFamily(); ok {
+		m = appendProtoFamily(m, &target, escaping)
+		b = binary.AppendUvarint(b, uint64(len(m)))
+		b = append(b, m...)
+
+		if _, err := w.Write(b); err != nil {
+			return
+		}
+	}
+
+	for i := range families {
+		// Families are written one at a time, there is no way to tell the
+		// scraper that the response is partial in this format so it simply
+		// ends early when the deadline is exceeded.
+		if !deadline.IsZero() && i != 0 && !time.Now().Before(deadline) {
+			break
+		}
+
+		for j := range families[i].series {
+			s := &families[i].series[j]
+			s.time = h.timestamp(families[i].name, s.time, now)
+		}
+		exposeFamily(&families[i], prefix, constLabels)
+
+		m = appendProtoFamily(m[:0], &families[i], escaping)
+		b = binary.AppendUvarint(b[:0], uint64(len(m)))
+		b = append(b, m...)
+
+		if _, err := w.Write(b); err != nil {
+			break
+		}
+	}
+}
+
+// Field numbers and enum values of the io.prometheus.client messages.
+const (
+	protoCounterType   = 0
+	protoGaugeType     = 1
+	protoSummaryType   = 2
+	protoHistogramType = 4
+
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+func appendProtoFamily(b []byte, family *protoFamily, escaping nameEscaping) []byte {
+	// Names are not quoted in this format, all names are valid with UTF-8
+	// escaping.
+	b = appendProtoString(b, 1, family.exposedName(escaping))
+	if len(family.help) != 0 {
+		b = appendProtoString(b, 2, family.help)
+	}
+
+	switch family.mtype {
+	case counter:
+		b = appendProtoVarint(b, 3, protoCounterType)
+	case gauge:
+		b = appendProtoVarint(b, 3, protoGaugeType)
+	case summary:
+		b = appendProtoVarint(b, 3, protoSummaryType)
+	case histogram:
+		b = appendProtoVarint(b, 3, protoHistogramType)
+	}
+
+	for i := range family.series {
+		s := &family.series[i]
+		b = appendProtoMessage(b, 4, func(b []byte) []byte {
+			return appendProtoMetric(b, family.mtype, s, escaping)
+		})
+	}
+
+	return b
+}
+
+func appendProtoMetric(b []byte, mtype metricType, s *protoSeries, escaping nameEscaping) []byte {
+	for _, l := range s.labels {
+		b = appendProtoMessage(b, 1, func(b []byte) []byte {
+			b = appendProtoString(b, 1, escaping.labelName(l.name))
+			return appendProtoString(b, 2, l.value)
+		})
+	}
+
+	switch mtype {
+	case counter:
+		b = appendProtoMessage(b, 3, func(b []byte) []byte {
+			b = appendProtoDouble(b, 1, s.value)
+			b = appendProtoExemplar(b, 2, s.exemplar)
+			return appendProtoTimestamp(b, 3, s.created)
+		})
+	case gauge:
+		b = appendProtoMessage(b, 2, func(b []byte) []byte {
+			return appendProtoDouble(b, 1, s.value)
+		})
+	case summary:
+		b = appendProtoMessage(b, 4, func(b []byte) []byte {
+			return appendProtoSummary(b, s)
+		})
+	case histogram:
+		b = appendProtoMessage(b, 7, func(b []byte) []byte {
+			return appendProtoHistogram(b, s)
+		})
+	}
+
+	if !s.time.IsZero() {
+		b = appendProtoVarint(b, 6, uint64(s.time.UnixMilli()))
+	}
+
+	return b
+}
+
+func appendProtoHistogram(b []byte, s *protoSeries) []byte {
+	b = appendProtoVarint(b, 1, s.count)
+	b = appendProtoDouble(b, 2, s.sum)
+
+	var cumulativeCount uint64
+	for _, bucket := range s.buckets {
+		cumulativeCount += bucket.count
+		b = appendProtoMessage(b, 3, func(b []byte) []byte {
+			b = appendProtoVarint(b, 1, cumulativeCount)
+			b = appendProtoDouble(b, 2, bucket.limit)
+			return appendProtoExemplar(b, 3, bucket.exemplar)
+		})
+	}
+
+	// The +Inf bucket is implicit, it is only written to carry its exemplar.
+	if s.exemplar != nil {
+		b = appendProtoMessage(b, 3, func(b []byte) []byte {
+			b = appendProtoVarint(b, 1, s.count)
+			b = appendProtoDouble(b, 2, math.Inf(+1))
+			return appendProtoExemplar(b, 3, s.exemplar)
+		})
+	}
+
+	if n := s.native; n != nil {
+		b = appendProtoVarint(b, 5, zigzag(int64(n.schema)))
+		b = appendProtoDouble(b, 6, n.zeroThreshold)
+		b = appendProtoVarint(b, 7, n.zeroCount)
+		b = appendProtoSpans(b, 9, n.negativeSpans)
+		b = appendProtoDeltas(b, 10, n.negativeDeltas)
+		b = appendProtoSpans(b, 12, n.positiveSpans)
+		b = appendProtoDeltas(b, 13, n.positiveDeltas)
+	}
+
+	return appendProtoTimestamp(b, 15, s.created)
+}
+
+func appendProtoSummary(b []byte, s *protoSeries) []byte {
+	b = appendProtoVarint(b, 1, s.count)
+	b = appendProtoDouble(b, 2, s.sum)
+
+	for _, q := range s.quantiles {
+		b = appendProtoMessage(b, 3, func(b []byte) []byte {
+			b = appendProtoDouble(b, 1, q.quantile)
+			return appendProtoDouble(b, 2, q.value)
+		})
+	}
+
+	return appendProtoTimestamp(b, 4, s.created)
+}
+
+func appendProtoExemplar(b []byte, field int, ex *exemplar) []byte {
+	if ex == nil {
+		return b
+	}
+	return appendProtoMessage(b, field, func(b []byte) []byte {
+		for _, l := range ex.labels {
+			b = appendProtoMessage(b, 1, func(b []byte) []byte {
+				b = appendProtoString(b, 1, l.name)
+				return appendProtoString(b, 2, l.value)
+			})
+		}
+		b = appendProtoDouble(b, 2, ex.value)
+		return appendProtoTimestamp(b, 3, ex.time)
+	})
+}
+
+// appendProtoTimestamp appends t as a google.protobuf.Timestamp message, or
+// nothing if t is the zero time.
+func appendProtoTimestamp(b []byte, field int, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return appendProtoMessage(b, field, func(b []byte) []byte {
+		b = appendProtoVarint(b, 1, uint64(t.Unix()))
+		return appendProtoVarint(b, 2, uint64(t.Nanosecond()))
+	})
+}
+
+func appendProtoSpans(b []byte, field int, spans []nativeSpan) []byte {
+	for _, span := range spans {
+		b = appendProtoMessage(b, field, func(b []byte) []byte {
+			b = appendProtoVarint(b, 1, zigzag(int64(span.offset)))
+			return appendProtoVarint(b, 2, uint64(span.length))
+		})
+	}
+	return b
+}
+
+func appendProtoDeltas(b []byte, field int, deltas []int64) []byte {
+	if len(deltas) == 0 {
+		return b
+	}
+	return appendProtoMessage(b, field, func(b []byte) []byte {
+		for _, d := range deltas {
+			b = binary.AppendUvarint(b, zigzag(d))
+		}
+		return b
+	})
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = appendProtoTag(b, field, protoVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoDouble(b []byte, field int, v float64) []byte {
+	b = appendProtoTag(b, field, protoFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = appendProtoTag(b, field, protoBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendProtoMessage appends an embedded message produced by f, its length is
+// only known once written so it gets inserted in front of it afterwards.
+func appendProtoMessage(b []byte, field int, f func([]byte) []byte) []byte {
+	b = appendProtoTag(b, field, protoBytes)
+	start := len(b)
+	b = f(b)
+
+	var n [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(n[:], uint64(len(b)-start))
+	b = append(b, n[:size]...)
+	copy(b[start+size:], b[start:len(b)-size])
+	copy(b[start:], n[:size])
+	return b
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,267 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPushInterval is the default interval at which a PushHandler
+	// pushes metrics to the Pushgateway.
+	DefaultPushInterval = 15 * time.Second
+
+	// DefaultPushTimeout is the default timeout of requests made to the
+	// Pushgateway.
+	DefaultPushTimeout = 5 * time.Second
+)
+
+// The PushConfig type is used to configure a PushHandler.
+type PushConfig struct {
+	// URL of the Pushgateway, for example "http://localhost:9091".
+	URL string
+
+	// Job is the value of the job label that the metrics are grouped under,
+	// defaults to the name of the program.
+	Job string
+
+	// Grouping holds additional labels identifying the group of metrics, for
+	// example {"instance": hostname}. Pushes replace all the metrics of their
+	// group.
+	Grouping map[string]string
+
+	// PushInterval is the interval at which metrics are pushed in the
+	// background, defaults to DefaultPushInterval. When negative, metrics are
+	// only pushed when the handler is flushed or closed.
+	PushInterval time.Duration
+
+	// DeleteOnClose deletes the group of metrics from the Pushgateway when the
+	// handler is closed, instead of pushing them a last time.
+	DeleteOnClose bool
+
+	// Timeout of requests made to the Pushgateway, defaults to
+	// DefaultPushTimeout.
+	Timeout time.Duration
+
+	// Transport configures the HTTP transport used to send requests to the
+	// Pushgateway. By default http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// Handler is the handler aggregating the metrics to push, a new one is
+	// created when nil.
+	Handler *Handler
+}
+
+// PushHandler is a Handler which pushes the metrics that it receives to a
+// Prometheus Pushgateway, allowing short-lived programs, like batch jobs, to
+// report metrics even if they exit before being scraped.
+//
+// Metrics are pushed periodically, when the handler is flushed, and when it is
+// closed, so a program only needs to flush or close the handler before exiting
+// to have its metrics reported. Pushed metrics never have timestamps, since
+// the Pushgateway rejects them.
+type PushHandler struct {
+	*Handler
+
+	url           string
+	deleteOnClose bool
+	http          http.Client
+
+	// serializes pushes, so the Pushgateway always ends up with the latest
+	// state of the metrics
+	mutex sync.Mutex
+
+	once sync.Once
+	stop chan struct{}
+	join chan struct{}
+}
+
+// NewPushHandler creates and returns a handler pushing metrics to the
+// Pushgateway at url, grouped under job.
+func NewPushHandler(url, job string) *PushHandler {
+	return NewPushHandlerWith(PushConfig{
+		URL: url,
+		Job: job,
+	})
+}
+
+// NewPushHandlerWith creates and returns a handler pushing metrics to the
+// Pushgateway, configured with the given config.
+func NewPushHandlerWith(config PushConfig) *PushHandler {
+	if len(config.Job) == 0 {
+		config.Job = filepath.Base(os.Args[0])
+	}
+
+	if config.PushInterval == 0 {
+		config.PushInterval = DefaultPushInterval
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = DefaultPushTimeout
+	}
+
+	if config.Handler == nil {
+		config.Handler = &Handler{}
+	}
+
+	p := &PushHandler{
+		Handler:       config.Handler,
+		url:           pushURL(config.URL, config.Job, config.Grouping),
+		deleteOnClose: config.DeleteOnClose,
+		http: http.Client{
+			Timeout:   config.Timeout,
+			Transport: config.Transport,
+		},
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	if config.PushInterval > 0 {
+		go p.run(config.PushInterval)
+	} else {
+		close(p.join)
+	}
+
+	return p
+}
+
+func (p *PushHandler) run(interval time.Duration) {
+	defer close(p.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.Flush()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Push sends the current state of the metrics to the Pushgateway, replacing
+// the metrics previously pushed to the same group.
+func (p *PushHandler) Push(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var body bytes.Buffer
+	p.Handler.writeStats(&body, time.Time{}, true, underscoreEscaping)
+	return p.do(ctx, "PUT", &body)
+}
+
+// Delete deletes the group of metrics from the Pushgateway.
+func (p *PushHandler) Delete(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.do(ctx, "DELETE", nil)
+}
+
+// Flush satisfies the stats.Flusher interface, it pushes the metrics to the
+// Pushgateway.
+func (p *PushHandler) Flush() {
+	if err := p.Push(context.Background()); err != nil {
+		log.Printf("stats/prometheus: push: %s", err)
+	}
+}
+
+// Close stops pushing metrics in the background, then pushes them a last time,
+// or deletes them from the Pushgateway if the handler was configured to.
+func (p *PushHandler) Close() error {
+	var err error
+
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.join
+
+		if p.deleteOnClose {
+			err = p.Delete(context.Background())
+		} else {
+			err = p.Push(context.Background())
+		}
+	})
+
+	return err
+}
+
+func (p *PushHandler) do(ctx context.Context, method string, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, method, p.url, body)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	}
+
+	res, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, p.url, res.Status, bytes.TrimSpace(msg))
+	}
+
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+// pushURL returns the URL of the group of metrics identified by job and the
+// grouping labels, which is made of the name and value of each label in the
+// path, sorted by name after the job so the URL is stable.
+func pushURL(addr, job string, grouping map[string]string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	b := []byte(strings.TrimSuffix(addr, "/"))
+	b = append(b, "/metrics"...)
+	b = appendPushLabel(b, "job", job)
+
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b = appendPushLabel(b, name, grouping[name])
+	}
+
+	return string(b)
+}
+
+// appendPushLabel appends a label to the path of a Pushgateway URL, values
+// which cannot be placed in a path segment are base64-encoded as documented
+// in https://github.com/prometheus/pushgateway#url.
+func appendPushLabel(b []byte, name, value string) []byte {
+	b = append(b, '/')
+	b = append(b, name...)
+
+	if len(value) == 0 || strings.ContainsAny(value, "/%?#") {
+		b = append(b, "@base64/"...)
+		if len(value) == 0 {
+			return append(b, '=')
+		}
+		return append(b, base64.RawURLEncoding.EncodeToString([]byte(value))...)
+	}
+
+	b = append(b, '/')
+	return append(b, url.PathEscape(value)...)
+}
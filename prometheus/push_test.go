@@ -0,0 +1,118 @@
+package prometheus
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestPushURL(t *testing.T) {
+	tests := []struct {
+		addr     string
+		job      string
+		grouping map[string]string
+		url      string
+	}{
+		{
+			addr: "localhost:9091",
+			job:  "backup",
+			url:  "http://localhost:9091/metrics/job/backup",
+		},
+		{
+			addr:     "https://pushgateway/",
+			job:      "backup",
+			grouping: map[string]string{"instance": "host-1", "db": "users"},
+			url:      "https://pushgateway/metrics/job/backup/db/users/instance/host-1",
+		},
+		{
+			addr:     "http://pushgateway",
+			job:      "/usr/bin/backup",
+			grouping: map[string]string{"instance": ""},
+			url:      "http://pushgateway/metrics/job@base64/L3Vzci9iaW4vYmFja3Vw/instance@base64/=",
+		},
+	}
+
+	for _, test := range tests {
+		if url := pushURL(test.addr, test.job, test.grouping); url != test.url {
+			t.Errorf("bad URL:\n- expected: %s\n- found:    %s", test.url, url)
+		}
+	}
+}
+
+func TestPushHandler(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		body   string
+	}
+
+	var mutex sync.Mutex
+	var requests []request
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		mutex.Lock()
+		requests = append(requests, request{method: req.Method, path: req.URL.Path, body: string(b)})
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	handler := NewPushHandlerWith(PushConfig{
+		URL:           server.URL,
+		Job:           "test",
+		Grouping:      map[string]string{"instance": "host-1"},
+		PushInterval:  -1,
+		DeleteOnClose: true,
+	})
+
+	handler.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "batch",
+		Fields: []stats.Field{stats.MakeField("processed", 42, stats.Counter)},
+	})
+
+	handler.Flush()
+
+	if err := handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []request{
+		{method: "PUT", path: "/metrics/job/test/instance/host-1", body: "# TYPE batch_processed counter\nbatch_processed 42\n"},
+		{method: "DELETE", path: "/metrics/job/test/instance/host-1"},
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(requests) != len(expect) {
+		t.Fatalf("expected %d requests, got %d: %+v", len(expect), len(requests), requests)
+	}
+
+	for i := range expect {
+		if requests[i] != expect[i] {
+			t.Errorf("bad request #%d:\n- expected: %+v\n- found:    %+v", i, expect[i], requests[i])
+		}
+	}
+}
+
+func TestPushHandlerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "pushed metrics are invalid", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	handler := NewPushHandlerWith(PushConfig{
+		URL:          server.URL,
+		Job:          "test",
+		PushInterval: -1,
+	})
+
+	if err := handler.Close(); err == nil {
+		t.Error("expected an error from the Pushgateway")
+	}
+}
@@ -0,0 +1,317 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultSummaryMaxAge is the default duration for which observations
+	// contribute to the quantiles of summaries.
+	DefaultSummaryMaxAge = 10 * time.Minute
+
+	// DefaultSummaryAgeBuckets is the default number of buckets that the
+	// MaxAge window of summaries is divided in.
+	DefaultSummaryAgeBuckets = 5
+
+	// summaryBufferSize is the number of observations buffered before being
+	// merged into the quantile estimates.
+	summaryBufferSize = 500
+)
+
+// DefaultSummaryObjectives are the quantiles exposed by summaries that were
+// configured without objectives, mapped to their allowed absolute errors.
+var DefaultSummaryObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// Summary configures a histogram to be exposed as a Prometheus summary.
+//
+// Summaries expose streaming estimates of quantiles computed by the handler,
+// as series with a "quantile" label, instead of buckets. They give accurate
+// percentiles without having to choose bucket boundaries, but cannot be
+// aggregated across label sets or instances.
+type Summary struct {
+	// Objectives maps the quantiles to expose, in the [0, 1] range, to their
+	// allowed absolute error, for example {0.99: 0.001} exposes the 99th
+	// percentile with a rank error of 0.1%. The default is
+	// DefaultSummaryObjectives.
+	Objectives map[float64]float64
+
+	// MaxAge is the duration for which observations contribute to the
+	// quantiles. The default is DefaultSummaryMaxAge.
+	MaxAge time.Duration
+
+	// AgeBuckets is the number of buckets the MaxAge window is divided in,
+	// observations are discarded one bucket at a time. The default is
+	// DefaultSummaryAgeBuckets.
+	AgeBuckets int
+}
+
+// Summaries is a map type used to configure the histograms exposed as
+// summaries by a Handler.
+type Summaries map[stats.Key]*Summary
+
+// Set sets the summary configuration of the metric identified by key, which
+// has the form "measure.field".
+func (s Summaries) Set(key string, summary Summary) {
+	k := stats.Key{Field: key}
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		k = stats.Key{Measure: key[:i], Field: key[i+1:]}
+	}
+	s[k] = &summary
+}
+
+// summaryState holds the quantile estimates of a summary. Observations are
+// recorded in all streams, which are reset in turn every MaxAge/AgeBuckets;
+// the quantiles are read from the oldest stream.
+type summaryState struct {
+	config    *Summary
+	quantiles []float64
+	labels    []labels
+	streams   []*quantileStream
+	head      int
+	step      time.Duration
+	expires   time.Time
+}
+
+func newSummaryState(config *Summary, l labels) *summaryState {
+	var c Summary
+	if config != nil {
+		c = *config
+	}
+
+	objectives := c.Objectives
+	if len(objectives) == 0 {
+		objectives = DefaultSummaryObjectives
+	}
+
+	maxAge := c.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultSummaryMaxAge
+	}
+
+	ageBuckets := c.AgeBuckets
+	if ageBuckets <= 0 {
+		ageBuckets = DefaultSummaryAgeBuckets
+	}
+
+	s := &summaryState{
+		config:    config,
+		quantiles: make([]float64, 0, len(objectives)),
+		streams:   make([]*quantileStream, ageBuckets),
+		step:      maxAge / time.Duration(ageBuckets),
+	}
+
+	targets := make([]quantileTarget, 0, len(objectives))
+	for q, e := range objectives {
+		s.quantiles = append(s.quantiles, q)
+		targets = append(targets, quantileTarget{quantile: q, epsilon: e})
+	}
+	sort.Float64s(s.quantiles)
+
+	s.labels = make([]labels, len(s.quantiles))
+	for i, q := range s.quantiles {
+		s.labels[i] = l.copyAppend(label{"quantile", string(appendFloat(nil, q))})
+	}
+
+	for i := range s.streams {
+		s.streams[i] = newQuantileStream(targets)
+	}
+
+	return s
+}
+
+func (s *summaryState) configuredWith(config *Summary) bool {
+	return s.config == config
+}
+
+func (s *summaryState) observe(value float64, now time.Time) {
+	s.rotate(now)
+	for _, stream := range s.streams {
+		stream.insert(value)
+	}
+}
+
+func (s *summaryState) rotate(now time.Time) {
+	if s.expires.IsZero() {
+		s.expires = now.Add(s.step)
+		return
+	}
+
+	if now.Sub(s.expires) >= time.Duration(len(s.streams))*s.step {
+		for _, stream := range s.streams {
+			stream.reset()
+		}
+		s.expires = now.Add(s.step)
+		return
+	}
+
+	for !now.Before(s.expires) {
+		s.streams[s.head].reset()
+		s.head = (s.head + 1) % len(s.streams)
+		s.expires = s.expires.Add(s.step)
+	}
+}
+
+// query returns the estimate of the i-th configured quantile, or NaN if no
+// values were observed in the last MaxAge.
+func (s *summaryState) query(i int) float64 {
+	return s.streams[s.head].query(s.quantiles[i])
+}
+
+type quantileTarget struct {
+	quantile float64
+	epsilon  float64
+}
+
+type quantileSample struct {
+	value float64
+	width float64
+	delta float64
+}
+
+// quantileStream computes biased quantile estimates over a stream of values,
+// using the CKMS algorithm for targeted quantiles described in "Effective
+// Computation of Biased Quantiles over Data Streams" by Cormode, Korn,
+// Muthukrishnan and Srivastava.
+type quantileStream struct {
+	targets []quantileTarget
+	buffer  []float64
+	samples []quantileSample
+	n       float64
+}
+
+func newQuantileStream(targets []quantileTarget) *quantileStream {
+	return &quantileStream{
+		targets: targets,
+		buffer:  make([]float64, 0, summaryBufferSize),
+	}
+}
+
+func (s *quantileStream) reset() {
+	s.buffer = s.buffer[:0]
+	s.samples = s.samples[:0]
+	s.n = 0
+}
+
+func (s *quantileStream) insert(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	if s.buffer = append(s.buffer, value); len(s.buffer) == cap(s.buffer) {
+		s.flush()
+	}
+}
+
+func (s *quantileStream) query(q float64) float64 {
+	s.flush()
+
+	if len(s.samples) == 0 {
+		return math.NaN()
+	}
+
+	t := math.Ceil(q * s.n)
+	t += math.Ceil(s.invariant(t) / 2)
+	p := s.samples[0]
+	r := 0.0
+
+	for _, c := range s.samples[1:] {
+		r += p.width
+		if r+c.width+c.delta > t {
+			return p.value
+		}
+		p = c
+	}
+
+	return p.value
+}
+
+// invariant returns the maximum error allowed for a sample of rank r.
+func (s *quantileStream) invariant(r float64) float64 {
+	m := math.MaxFloat64
+
+	for _, t := range s.targets {
+		var f float64
+		if t.quantile*s.n <= r {
+			f = (2 * t.epsilon * r) / t.quantile
+		} else {
+			f = (2 * t.epsilon * (s.n - r)) / (1 - t.quantile)
+		}
+		if f < m {
+			m = f
+		}
+	}
+
+	return m
+}
+
+func (s *quantileStream) flush() {
+	if len(s.buffer) == 0 {
+		return
+	}
+
+	sort.Float64s(s.buffer)
+	s.merge(s.buffer)
+	s.buffer = s.buffer[:0]
+	s.compress()
+}
+
+func (s *quantileStream) merge(values []float64) {
+	r := 0.0
+	i := 0
+
+	for _, v := range values {
+		inserted := false
+
+		for ; i < len(s.samples); i++ {
+			c := s.samples[i]
+			if c.value > v {
+				s.samples = append(s.samples, quantileSample{})
+				copy(s.samples[i+1:], s.samples[i:])
+				s.samples[i] = quantileSample{value: v, width: 1, delta: math.Max(0, math.Floor(s.invariant(r))-1)}
+				i++
+				inserted = true
+				break
+			}
+			r += c.width
+		}
+
+		if !inserted {
+			s.samples = append(s.samples, quantileSample{value: v, width: 1})
+			i++
+		}
+
+		s.n++
+		r++
+	}
+}
+
+func (s *quantileStream) compress() {
+	if len(s.samples) < 2 {
+		return
+	}
+
+	x := s.samples[len(s.samples)-1]
+	xi := len(s.samples) - 1
+	r := s.n - 1 - x.width
+
+	for i := len(s.samples) - 2; i >= 0; i-- {
+		c := s.samples[i]
+
+		if c.width+x.width+x.delta <= s.invariant(r) {
+			x.width += c.width
+			s.samples[xi] = x
+			copy(s.samples[i:], s.samples[i+1:])
+			s.samples = s.samples[:len(s.samples)-1]
+			xi--
+		} else {
+			x = c
+			xi = i
+		}
+
+		r -= c.width
+	}
+}
@@ -0,0 +1,110 @@
+package prometheus
+
+import (
+	"math"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestQuantileStream(t *testing.T) {
+	objectives := map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+	targets := make([]quantileTarget, 0, len(objectives))
+	for q, e := range objectives {
+		targets = append(targets, quantileTarget{quantile: q, epsilon: e})
+	}
+
+	s := newQuantileStream(targets)
+
+	if v := s.query(0.5); !math.IsNaN(v) {
+		t.Error("expected NaN from an empty stream, got", v)
+	}
+
+	const n = 100000
+	for _, v := range rand.New(rand.NewSource(0)).Perm(n) {
+		s.insert(float64(v + 1))
+	}
+
+	for q, e := range objectives {
+		v := s.query(q)
+		if min, max := (q-e)*n, (q+e)*n; v < min || v > max {
+			t.Errorf("quantile %g: %g is outside of the [%g, %g] range", q, v, min, max)
+		}
+	}
+
+	if len(s.samples) >= n/10 {
+		t.Errorf("the stream was not compressed: %d samples for %d values", len(s.samples), n)
+	}
+}
+
+func TestSummaryStateRotate(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+	s := newSummaryState(&Summary{
+		Objectives: map[float64]float64{0.5: 0.01},
+		MaxAge:     time.Minute,
+		AgeBuckets: 2,
+	}, nil)
+
+	s.observe(1, now)
+	s.observe(1, now.Add(10*time.Second))
+	s.observe(1, now.Add(20*time.Second))
+	s.observe(2, now.Add(40*time.Second))
+
+	// The first bucket was reset after 30s, but the quantiles are read from
+	// the second one which still covers the whole minute.
+	if v := s.query(0); v != 1 {
+		t.Error("bad median after the first rotation:", v)
+	}
+
+	// The second bucket was reset after 60s, dropping the observations made
+	// before the first rotation.
+	s.observe(2, now.Add(70*time.Second))
+
+	if v := s.query(0); v != 2 {
+		t.Error("bad median after the second rotation:", v)
+	}
+
+	// After MaxAge without observations everything is dropped.
+	s.observe(3, now.Add(5*time.Minute))
+
+	if v := s.query(0); v != 3 {
+		t.Error("bad median after expiration:", v)
+	}
+}
+
+func TestServeHTTPSummary(t *testing.T) {
+	now := time.Date(2017, 6, 4, 22, 12, 0, 0, time.UTC)
+
+	handler := &Handler{Summaries: Summaries{}}
+	handler.Summaries.Set("rpc.latency", Summary{
+		Objectives: map[float64]float64{0.5: 0.01, 0.99: 0.001},
+	})
+
+	for i := 1; i <= 100; i++ {
+		handler.HandleMeasures(now, stats.Measure{
+			Name:   "rpc",
+			Fields: []stats.Field{stats.MakeField("latency", float64(i), stats.Histogram)},
+			Tags:   []stats.Tag{stats.T("method", "get")},
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	// Estimates are within the allowed rank error of the exact quantiles, 50
+	// and 99.
+	const expect = `# TYPE rpc_latency summary
+rpc_latency{method="get",quantile="0.5"} 51 1496614320000
+rpc_latency{method="get",quantile="0.99"} 100 1496614320000
+rpc_latency_count{method="get"} 100 1496614320000
+rpc_latency_sum{method="get"} 5050 1496614320000
+`
+
+	if s := res.Body.String(); s != expect {
+		t.Errorf("bad output:\n- expected:\n%s\n- found:\n%s", expect, s)
+	}
+}
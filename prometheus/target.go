@@ -0,0 +1,66 @@
+package prometheus
+
+import "sort"
+
+// targetInfoHelp is the description of the target_info family, as written by
+// the OpenTelemetry exporters.
+const targetInfoHelp = "Target metadata"
+
+// targetLabels returns the job and instance labels configured on the handler.
+func (h *Handler) targetLabels() labels {
+	var l labels
+	if len(h.Instance) != 0 {
+		l = append(l, label{name: "instance", value: h.Instance})
+	}
+	if len(h.Job) != 0 {
+		l = append(l, label{name: "job", value: h.Job})
+	}
+	return l
+}
+
+// targetInfo returns the labels of the target_info series, made of the job and
+// instance labels and the attributes in TargetInfo, sorted by name. It returns
+// false if the handler exposes no target_info series.
+func (h *Handler) targetInfo() (labels, bool) {
+	l := h.targetLabels()
+	if len(l) == 0 && len(h.TargetInfo) == 0 {
+		return nil, false
+	}
+
+	for name, value := range h.TargetInfo {
+		if !l.hasName(name) {
+			l = append(l, label{name: name, value: value})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].name < l[j].name })
+	return l, true
+}
+
+// targetInfoMetric returns the target_info series as written in the text
+// format. Its name is not prefixed by the namespace of the handler, since
+// target_info is the name that queries joining it expect.
+func (h *Handler) targetInfoMetric() (metric, bool) {
+	l, ok := h.targetInfo()
+	return metric{
+		mtype:  gauge,
+		scope:  "target",
+		name:   "info",
+		help:   targetInfoHelp,
+		value:  1,
+		labels: l,
+	}, ok
+}
+
+// targetInfoFamily is like targetInfoMetric for the OpenMetrics and protobuf
+// formats.
+func (h *Handler) targetInfoFamily() (protoFamily, bool) {
+	l, ok := h.targetInfo()
+	return protoFamily{
+		mtype:  gauge,
+		name:   "target_info",
+		help:   targetInfoHelp,
+		series: []protoSeries{{labels: l, value: 1}},
+		scope:  "target",
+		base:   "info",
+	}, ok
+}
@@ -0,0 +1,333 @@
+package stats
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+const (
+	// DefaultQuotaSampleRate is the default rate at which measures exceeding
+	// the throughput budget of a scope are kept by the SampleOverQuota
+	// enforcement.
+	DefaultQuotaSampleRate = 0.1
+
+	// DefaultQuotaSeriesTTL is the default time after which series which
+	// were not reported stop counting against the series budget of a scope.
+	DefaultQuotaSeriesTTL = 10 * time.Minute
+)
+
+// QuotaEnforcement defines what EnforceQuotas does with the measures of a
+// scope exceeding its throughput budget.
+type QuotaEnforcement int
+
+const (
+	// DropOverQuota drops the measures exceeding the budget. This is the
+	// default enforcement.
+	DropOverQuota QuotaEnforcement = iota
+
+	// SampleOverQuota keeps a fraction of the measures exceeding the budget,
+	// with their counters scaled and their sample rate set like the engine
+	// does when sampling.
+	SampleOverQuota
+)
+
+// Quota is the budget of a scope, which is the set of metrics with a measure
+// name equal to Scope or starting with Scope followed by a dot. Scopes
+// usually map to the teams owning the metrics, for example "checkout".
+type Quota struct {
+	// Scope the quota applies to. When scopes are nested, the measures
+	// count against the quota of the longest matching scope.
+	Scope string
+
+	// Maximum number of series (distinct metric names and tags) in the
+	// scope, zero means no limit. New series exceeding the budget are
+	// always dropped.
+	MaxSeries int
+
+	// Time after which series which were not reported stop counting against
+	// MaxSeries, defaults to DefaultQuotaSeriesTTL. Series are expired when
+	// the handler is flushed, so scopes which reached their budget admit new
+	// series once the old ones went away.
+	SeriesTTL time.Duration
+
+	// Maximum number of data points (fields of measures) per second in the
+	// scope, zero means no limit.
+	MaxRate float64
+
+	// Enforcement applied to the data points exceeding MaxRate.
+	Enforcement QuotaEnforcement
+
+	// Fraction of the data points exceeding MaxRate which are kept by the
+	// SampleOverQuota enforcement, defaults to DefaultQuotaSampleRate.
+	SampleRate float64
+}
+
+// QuotaConfig carries the configuration of the middleware returned by
+// EnforceQuotas.
+type QuotaConfig struct {
+	// Quotas of the scopes, measures of other scopes are not limited.
+	Quotas []Quota
+
+	// Engine the utilization of the budgets is reported to when the handler
+	// is flushed, defaults to DefaultEngine.
+	Engine *Engine
+}
+
+// EnforceQuotas returns a middleware enforcing per-scope budgets of series
+// and throughput, supporting the governance of metrics shared by several
+// teams.
+//
+// Each handler wrapped by the middleware enforces its own budgets.
+//
+// Each time the handler is flushed, the utilization of the budgets is
+// reported to the engine of config as gauges tagged by scope, where 1 means
+// the budget is fully used:
+//
+//	stats.quota.series.utilization{scope}
+//	stats.quota.throughput.utilization{scope}
+//	stats.quota.dropped.count{scope,reason}
+func EnforceQuotas(config QuotaConfig) HandlerMiddleware {
+	if config.Engine == nil {
+		config.Engine = DefaultEngine
+	}
+
+	configs := make([]Quota, 0, len(config.Quotas))
+
+	for _, q := range config.Quotas {
+		if q.SampleRate <= 0 || q.SampleRate > 1 {
+			q.SampleRate = DefaultQuotaSampleRate
+		}
+		if q.SeriesTTL <= 0 {
+			q.SeriesTTL = DefaultQuotaSeriesTTL
+		}
+		configs = append(configs, q)
+	}
+
+	// Longest scopes first so nested scopes match before their parents.
+	sort.SliceStable(configs, func(i, j int) bool {
+		return len(configs[i].Scope) > len(configs[j].Scope)
+	})
+
+	return func(h Handler) Handler {
+		// The state of the budgets is protected by the mutex of the handler,
+		// it must not be shared with the other handlers.
+		quotas := make([]*scopeQuota, len(configs))
+		for i, q := range configs {
+			quotas[i] = &scopeQuota{
+				Quota:  q,
+				series: make(map[uint64]time.Time),
+			}
+		}
+		return &quotaHandler{
+			handler: h,
+			eng:     config.Engine,
+			quotas:  quotas,
+		}
+	}
+}
+
+type scopeQuota struct {
+	Quota
+
+	series      map[uint64]time.Time // last time each series was seen
+	windowStart time.Time
+	window      int     // data points in the current window
+	throughput  float64 // utilization of the previous window
+	dropped     map[string]int
+}
+
+func (q *scopeQuota) match(name string) bool {
+	return strings.HasPrefix(name, q.Scope) && (len(name) == len(q.Scope) || name[len(q.Scope)] == '.')
+}
+
+// admit reports whether the data point of metric name with the given tags hash
+// fits in the budget, and the rate at which it must be sampled.
+func (q *scopeQuota) admit(name string, tags uint64, now time.Time) (bool, float64) {
+	if q.MaxSeries > 0 {
+		h := jody.AddString64(tags, name)
+		if _, ok := q.series[h]; !ok && len(q.series) >= q.MaxSeries {
+			q.drop("series")
+			return false, 0
+		}
+		q.series[h] = now
+	}
+
+	if q.MaxRate <= 0 {
+		return true, 1
+	}
+
+	if elapsed := now.Sub(q.windowStart); elapsed >= time.Second {
+		if elapsed < 2*time.Second {
+			q.throughput = float64(q.window) / q.MaxRate
+		} else {
+			q.throughput = 0
+		}
+		q.windowStart, q.window = now, 0
+	}
+
+	if q.window++; float64(q.window) <= q.MaxRate {
+		return true, 1
+	}
+
+	if q.Enforcement == SampleOverQuota && rand.Float64() < q.SampleRate {
+		return true, q.SampleRate
+	}
+
+	q.drop("throughput")
+	return false, 0
+}
+
+// expire removes the series which were not seen within the TTL of the quota.
+func (q *scopeQuota) expire(now time.Time) {
+	for h, t := range q.series {
+		if now.Sub(t) >= q.SeriesTTL {
+			delete(q.series, h)
+		}
+	}
+}
+
+func (q *scopeQuota) drop(reason string) {
+	if q.dropped == nil {
+		q.dropped = make(map[string]int)
+	}
+	q.dropped[reason]++
+}
+
+type quotaHandler struct {
+	handler Handler
+	eng     *Engine
+	mutex   sync.Mutex
+	quotas  []*scopeQuota
+}
+
+func (h *quotaHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	h.handler.HandleMeasures(t, h.filter(measures)...)
+}
+
+func (h *quotaHandler) filter(measures []Measure) []Measure {
+	var filtered []Measure
+
+	now := time.Now()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, m := range measures {
+		q := h.lookup(m.Name)
+		if q == nil {
+			if filtered != nil {
+				filtered = append(filtered, m)
+			}
+			continue
+		}
+
+		tags := tagsHash(m.Tags)
+		changed := false
+		fields := make([]Field, 0, len(m.Fields))
+		sampled := make([]Field, 0, len(m.Fields))
+		sampleRate := 1.0
+
+		for _, f := range m.Fields {
+			ok, rate := q.admit(m.Name+"."+f.Name, tags, now)
+			switch {
+			case !ok:
+				changed = true
+			case rate < 1:
+				changed = true
+				sampleRate = rate
+				if f.Type() == Counter {
+					f = MakeField(f.Name, scaleValue(f.Value, rate), Counter)
+				}
+				sampled = append(sampled, f)
+			default:
+				fields = append(fields, f)
+			}
+		}
+
+		if !changed {
+			if filtered != nil {
+				filtered = append(filtered, m)
+			}
+			continue
+		}
+
+		if filtered == nil {
+			filtered = append(make([]Measure, 0, len(measures)), measures[:i]...)
+		}
+
+		if len(fields) != 0 {
+			m2 := m
+			m2.Fields = fields
+			filtered = append(filtered, m2)
+		}
+
+		if len(sampled) != 0 {
+			m2 := m
+			m2.Fields = sampled
+			if m2.SampleRate > 0 {
+				m2.SampleRate *= sampleRate
+			} else {
+				m2.SampleRate = sampleRate
+			}
+			filtered = append(filtered, m2)
+		}
+	}
+
+	if filtered == nil {
+		return measures
+	}
+	return filtered
+}
+
+func (h *quotaHandler) lookup(name string) *scopeQuota {
+	for _, q := range h.quotas {
+		if q.match(name) {
+			return q
+		}
+	}
+	return nil
+}
+
+// Flush expires the series which were not seen within their TTL, reports the
+// utilization of the budgets, and flushes the wrapped handler.
+func (h *quotaHandler) Flush() {
+	type usage struct {
+		scope      string
+		series     float64
+		throughput float64
+		dropped    map[string]int
+	}
+
+	now := time.Now()
+
+	h.mutex.Lock()
+	usages := make([]usage, 0, len(h.quotas))
+	for _, q := range h.quotas {
+		q.expire(now)
+		u := usage{scope: q.Scope, throughput: q.throughput, dropped: q.dropped}
+		if q.MaxSeries > 0 {
+			u.series = float64(len(q.series)) / float64(q.MaxSeries)
+		}
+		q.dropped = nil
+		usages = append(usages, u)
+	}
+	h.mutex.Unlock()
+
+	// The engine may route the measures back to this handler, so they are
+	// reported after releasing the mutex.
+	for _, u := range usages {
+		scope := T("scope", u.scope)
+		h.eng.Set("stats.quota.series.utilization", u.series, scope)
+		h.eng.Set("stats.quota.throughput.utilization", u.throughput, scope)
+		for reason, n := range u.dropped {
+			h.eng.Add("stats.quota.dropped.count", n, scope, T("reason", reason))
+		}
+	}
+
+	flush(h.handler)
+}
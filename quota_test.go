@@ -0,0 +1,161 @@
+package stats_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceQuotas(t *testing.T) {
+	h := &statstest.Handler{}
+	budgets := &statstest.Handler{}
+
+	q := stats.EnforceQuotas(stats.QuotaConfig{
+		Quotas: []stats.Quota{
+			{Scope: "checkout", MaxSeries: 2},
+			{Scope: "checkout.cart", MaxRate: 2},
+		},
+		Engine: stats.NewEngine("", budgets),
+	})(h)
+
+	measure := func(name string, user int) stats.Measure {
+		return stats.Measure{
+			Name:   name,
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("user", fmt.Sprint(user))},
+		}
+	}
+
+	q.HandleMeasures(time.Now(),
+		measure("checkout", 0),
+		measure("checkout", 1),
+		measure("checkout", 2), // exceeds the series budget
+		measure("checkout", 0),
+		measure("checkout.cart", 0),
+		measure("checkout.cart", 1),
+		measure("checkout.cart", 2), // exceeds the throughput budget
+		measure("checkoutv2", 0),    // not in the checkout scope
+	)
+
+	var names []string
+	for _, m := range h.Measures() {
+		names = append(names, m.Name+"{"+m.Tags[0].Value+"}")
+	}
+	assert.Equal(t, []string{
+		"checkout{0}",
+		"checkout{1}",
+		"checkout{0}",
+		"checkout.cart{0}",
+		"checkout.cart{1}",
+		"checkoutv2{0}",
+	}, names)
+
+	flush(q)
+	assert.EqualValues(t, 1, h.FlushCalls())
+
+	reported := map[string]float64{}
+	for _, m := range budgets.Measures() {
+		for _, f := range m.Fields {
+			key := m.Name + "." + f.Name + "{"
+			for i, tag := range m.Tags {
+				if i != 0 {
+					key += ","
+				}
+				key += tag.Name + "=" + tag.Value
+			}
+			if f.Value.Type() == stats.Float {
+				reported[key+"}"] += f.Value.Float()
+			} else {
+				reported[key+"}"] += float64(f.Value.Int())
+			}
+		}
+	}
+	assert.Equal(t, 1.0, reported["stats.quota.series.utilization{scope=checkout}"])
+	assert.Equal(t, 1.0, reported["stats.quota.dropped.count{reason=series,scope=checkout}"])
+	assert.Equal(t, 1.0, reported["stats.quota.dropped.count{reason=throughput,scope=checkout.cart}"])
+}
+
+func TestEnforceQuotasSampling(t *testing.T) {
+	h := &statstest.Handler{}
+	q := stats.EnforceQuotas(stats.QuotaConfig{
+		Quotas: []stats.Quota{
+			{Scope: "events", MaxRate: 1, Enforcement: stats.SampleOverQuota, SampleRate: 0.5},
+		},
+		Engine: stats.NewEngine("", stats.Discard),
+	})(h)
+
+	measures := make([]stats.Measure, 1000)
+	for i := range measures {
+		measures[i] = stats.Measure{
+			Name:   "events",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		}
+	}
+	q.HandleMeasures(time.Now(), measures...)
+
+	found := h.Measures()
+	if n := len(found); n < 400 || n > 600 {
+		t.Errorf("expected about half of the measures to be kept, got %d", n)
+	}
+	for _, m := range found[1:] {
+		if m.SampleRate != 0.5 || m.Fields[0].Value.Float() != 2 {
+			t.Fatalf("sampled measure not scaled: %+v", m)
+		}
+	}
+	if measures[1].Fields[0].Value.Int() != 1 {
+		t.Error("the measures passed to the middleware must not be modified")
+	}
+}
+
+func TestEnforceQuotasPerHandler(t *testing.T) {
+	middleware := stats.EnforceQuotas(stats.QuotaConfig{
+		Quotas: []stats.Quota{{Scope: "checkout", MaxSeries: 1}},
+		Engine: stats.NewEngine("", stats.Discard),
+	})
+
+	h1, h2 := &statstest.Handler{}, &statstest.Handler{}
+	q1, q2 := middleware(h1), middleware(h2)
+
+	m := stats.Measure{
+		Name:   "checkout",
+		Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+		Tags:   []stats.Tag{stats.T("user", "0")},
+	}
+	q1.HandleMeasures(time.Now(), m)
+
+	m.Tags = []stats.Tag{stats.T("user", "1")}
+	q2.HandleMeasures(time.Now(), m)
+
+	assert.Len(t, h1.Measures(), 1)
+	assert.Len(t, h2.Measures(), 1, "budgets must not be shared between handlers")
+}
+
+func TestEnforceQuotasSeriesTTL(t *testing.T) {
+	h := &statstest.Handler{}
+	q := stats.EnforceQuotas(stats.QuotaConfig{
+		Quotas: []stats.Quota{{Scope: "checkout", MaxSeries: 1, SeriesTTL: time.Millisecond}},
+		Engine: stats.NewEngine("", stats.Discard),
+	})(h)
+
+	measure := func(user string) stats.Measure {
+		return stats.Measure{
+			Name:   "checkout",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("user", user)},
+		}
+	}
+
+	q.HandleMeasures(time.Now(), measure("0"), measure("1"))
+	assert.Len(t, h.Measures(), 1)
+
+	time.Sleep(5 * time.Millisecond)
+	flush(q)
+
+	q.HandleMeasures(time.Now(), measure("1"))
+	assert.Len(t, h.Measures(), 2, "expired series must not count against the budget")
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package stats
+
+// The race detector instruments memory accesses and causes extra allocations,
+// allocation budgets are not enforced when it is enabled.
+const raceEnabled = true
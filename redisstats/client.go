@@ -0,0 +1,220 @@
+package redisstats
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultAddress is the default address of the Redis server that the client
+// connects to.
+const DefaultAddress = "localhost:6379"
+
+// DefaultTimeout is the default timeout for pipelines sent to Redis.
+const DefaultTimeout = 5 * time.Second
+
+// Pipeliner is the interface used by the Handler to send commands to Redis.
+//
+// Pipeline sends cmds to Redis in a single round trip and returns one error
+// per command (nil when the command succeeded), or a non-nil error if the
+// pipeline could not be sent at all.
+//
+// The package provides a minimal implementation with Client, programs that
+// already use a Redis client library can adapt it to this interface.
+type Pipeliner interface {
+	Pipeline(ctx context.Context, cmds ...[]string) ([]error, error)
+}
+
+// Error represents an error reply returned by Redis.
+type Error string
+
+// Error satisfies the error interface.
+func (e Error) Error() string { return string(e) }
+
+// Client is a minimal Redis client implementing the Pipeliner interface over
+// a single connection, which is re-established when an error occurs.
+type Client struct {
+	// Address of the Redis server.
+	Address string
+
+	// Timeout is the maximum amount of time a pipeline may take, including
+	// the time to establish the connection.
+	Timeout time.Duration
+
+	mutex sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+}
+
+// NewClient returns a Client connecting to the Redis server at addr.
+func NewClient(addr string) *Client {
+	if len(addr) == 0 {
+		addr = DefaultAddress
+	}
+	return &Client{Address: addr, Timeout: DefaultTimeout}
+}
+
+// Pipeline satisfies the Pipeliner interface.
+func (c *Client) Pipeline(ctx context.Context, cmds ...[]string) ([]error, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	errs, err := c.pipeline(ctx, cmds)
+	if err != nil {
+		c.close()
+	}
+	return errs, err
+}
+
+func (c *Client) pipeline(ctx context.Context, cmds [][]string) ([]error, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	if c.conn == nil {
+		d := net.Dialer{Deadline: deadline}
+		conn, err := d.DialContext(ctx, "tcp", c.Address)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+		c.r = bufio.NewReader(conn)
+		c.w = bufio.NewWriter(conn)
+	}
+
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range cmds {
+		writeCommand(c.w, cmd)
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(cmds))
+
+	for i := range cmds {
+		if err := readReply(c.r); err != nil {
+			var e Error
+			if !errors.As(err, &e) {
+				return nil, err
+			}
+			errs[i] = e
+		}
+	}
+
+	return errs, nil
+}
+
+// Close closes the connection to Redis, satisfies the io.Closer interface.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.close()
+}
+
+func (c *Client) close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.r, c.w = nil, nil, nil
+	return err
+}
+
+// writeCommand writes cmd to w as a RESP array of bulk strings.
+func writeCommand(w *bufio.Writer, cmd []string) {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(cmd)))
+	w.WriteString("\r\n")
+
+	for _, arg := range cmd {
+		w.WriteByte('$')
+		w.WriteString(strconv.Itoa(len(arg)))
+		w.WriteString("\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+}
+
+// readReply reads and discards a RESP reply from r, it returns an Error if
+// the reply was an error reply.
+func readReply(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+
+	if len(line) == 0 {
+		return errors.New("redisstats: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return nil
+
+	case '-':
+		return Error(line[1:])
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("redisstats: malformed bulk string length: %q", line)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = r.Discard(n + 2)
+		return err
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("redisstats: malformed array length: %q", line)
+		}
+		var replyErr error
+		for i := 0; i < n; i++ {
+			if err := readReply(r); err != nil {
+				var e Error
+				if !errors.As(err, &e) {
+					return err
+				}
+				replyErr = e
+			}
+		}
+		return replyErr
+
+	default:
+		return fmt.Errorf("redisstats: unsupported reply: %q", line)
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && len(line) != 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redisstats: malformed reply line: %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,139 @@
+package redisstats
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// server is a fake Redis server recording the commands it receives, and
+// replying with an error to commands starting with "ERR".
+type server struct {
+	lstn  net.Listener
+	mutex sync.Mutex
+	cmds  [][]string
+}
+
+func newServer(t *testing.T) *server {
+	lstn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{lstn: lstn}
+	go s.serve()
+	t.Cleanup(func() { lstn.Close() })
+	return s
+}
+
+func (s *server) addr() string { return s.lstn.Addr().String() }
+
+func (s *server) commands() [][]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([][]string{}, s.cmds...)
+}
+
+func (s *server) serve() {
+	for {
+		conn, err := s.lstn.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.cmds = append(s.cmds, cmd)
+		s.mutex.Unlock()
+
+		if strings.HasPrefix(cmd[0], "ERR") {
+			fmt.Fprintf(conn, "-ERR %s\r\n", strings.ToLower(cmd[0]))
+		} else {
+			fmt.Fprintf(conn, "+OK\r\n")
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(line[1:])
+	cmd := make([]string, n)
+	for i := range cmd {
+		if _, err := readLine(r); err != nil {
+			return nil, err
+		}
+		if cmd[i], err = readLine(r); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
+
+func TestClientPipeline(t *testing.T) {
+	s := newServer(t)
+	c := NewClient(s.addr())
+	defer c.Close()
+
+	errs, err := c.Pipeline(context.Background(),
+		[]string{"SET", "a", "1"},
+		[]string{"ERRCMD"},
+		[]string{"SET", "b", "hello world"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 3 || errs[0] != nil || errs[1] != Error("ERR errcmd") || errs[2] != nil {
+		t.Errorf("bad pipeline errors: %v", errs)
+	}
+
+	cmds := s.commands()
+	if len(cmds) != 3 || strings.Join(cmds[2], " ") != "SET b hello world" {
+		t.Errorf("bad commands received by the server: %q", cmds)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		reply string
+		err   error
+	}{
+		{reply: "+OK\r\n"},
+		{reply: ":42\r\n"},
+		{reply: "$5\r\nhello\r\n"},
+		{reply: "$-1\r\n"},
+		{reply: "*2\r\n$1\r\na\r\n:1\r\n"},
+		{reply: "-ERR failure\r\n", err: Error("ERR failure")},
+	}
+
+	for _, test := range tests {
+		t.Run(strconv.Quote(test.reply), func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(test.reply))
+			if err := readReply(r); err != test.err {
+				t.Errorf("want %v, got %v", test.err, err)
+			}
+			if n := r.Buffered(); n != 0 {
+				t.Errorf("%d bytes were left unread", n)
+			}
+		})
+	}
+}
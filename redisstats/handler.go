@@ -0,0 +1,353 @@
+package redisstats
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultPrefix is the default prefix of the keys written to Redis.
+	DefaultPrefix = "stats"
+
+	// DefaultWindow is the default size of the aggregation windows.
+	DefaultWindow = 10 * time.Second
+
+	// DefaultWindowTTL is the default amount of time that window keys are
+	// retained in Redis.
+	DefaultWindowTTL = 1 * time.Hour
+)
+
+// Handler is a stats.Handler which aggregates measures into Redis, so that
+// horizontally scaled processes contribute to the same time series, and a
+// single exporter job can produce globally accurate values from them.
+//
+// Measures are aggregated locally and written to Redis when the handler is
+// flushed, in the following keys, where <window> is the unix time (in
+// seconds) of the start of the aggregation window that the measures were
+// produced in, and <series> is the metric name followed by its sorted tags
+// (for example "http.requests.count{method=GET,status=200}"):
+//
+//	<prefix>:<window>:counters          hash of <series> to the sum of counters (HINCRBYFLOAT)
+//	<prefix>:<window>:gauges            hash of <series> to the last gauge value (HSET)
+//	<prefix>:<window>:histograms        hash of <series>:count, <series>:sum, and
+//	                                    <series>:le=<bound> cumulative bucket counts (HINCRBYFLOAT)
+//	<prefix>:<window>:tdigest:<series>  t-digest of the histogram values (TDIGEST.ADD),
+//	                                    only when Digest is true
+//
+// Histogram buckets are configured in stats.Buckets, or declared in struct
+// tags (see stats.BucketsOf). The t-digest keys require the RedisBloom module
+// (or Redis Stack), they give percentiles that are accurate across all
+// processes regardless of bucket boundaries.
+//
+// All keys expire after WindowTTL.
+type Handler struct {
+	// Client used to send commands to Redis.
+	Client Pipeliner
+
+	// Prefix of the keys written to Redis, defaults to DefaultPrefix.
+	Prefix string
+
+	// Window is the size of aggregation windows, defaults to DefaultWindow.
+	Window time.Duration
+
+	// WindowTTL is how long window keys are kept in Redis, defaults to
+	// DefaultWindowTTL.
+	WindowTTL time.Duration
+
+	// Digest enables writing histogram values to t-digest keys.
+	Digest bool
+
+	mutex   sync.Mutex
+	windows map[int64]*window
+	digests map[string]struct{}
+}
+
+type window struct {
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	count   float64
+	sum     float64
+	bounds  []float64
+	buckets []float64
+	values  []float64
+}
+
+// NewHandler returns a Handler aggregating measures in the Redis server at
+// addr.
+func NewHandler(addr string) *Handler {
+	return &Handler{Client: NewClient(addr)}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (h *Handler) HandleMeasures(t time.Time, measures ...stats.Measure) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	w := h.window(t)
+
+	for _, m := range measures {
+		for _, f := range m.Fields {
+			series := seriesName(m.Name, f.Name, m.Tags)
+			value := valueOf(f.Value)
+
+			switch f.Type() {
+			case stats.Counter:
+				w.counters[series] += value
+
+			case stats.Gauge:
+				w.gauges[series] = value
+
+			case stats.Histogram, stats.Distribution:
+				hist := w.histograms[series]
+				if hist == nil {
+					hist = newHistogram(stats.BucketsOf(stats.Buckets, stats.Key{Measure: m.Name, Field: f.Name}))
+					w.histograms[series] = hist
+				}
+				hist.observe(value, h.Digest)
+			}
+		}
+	}
+}
+
+func (h *Handler) window(t time.Time) *window {
+	size := h.Window
+	if size <= 0 {
+		size = DefaultWindow
+	}
+
+	start := t.Truncate(size).Unix()
+
+	if h.windows == nil {
+		h.windows = make(map[int64]*window)
+	}
+
+	w := h.windows[start]
+	if w == nil {
+		w = &window{
+			counters:   make(map[string]float64),
+			gauges:     make(map[string]float64),
+			histograms: make(map[string]*histogram),
+		}
+		h.windows[start] = w
+	}
+
+	return w
+}
+
+// Flush satisfies the stats.Flusher interface, it writes the measures
+// aggregated since the last flush to Redis.
+func (h *Handler) Flush() {
+	h.mutex.Lock()
+	windows := h.windows
+	h.windows = nil
+	cmds := h.commands(windows)
+	h.mutex.Unlock()
+
+	if len(cmds) == 0 {
+		return
+	}
+
+	errs, err := h.Client.Pipeline(context.Background(), cmds...)
+	if err != nil {
+		log.Printf("stats/redisstats: %s", err)
+		return
+	}
+
+	for i, err := range errs {
+		if err != nil && !isDigestExists(cmds[i], err) {
+			log.Printf("stats/redisstats: %s: %s", cmds[i][0], err)
+		}
+	}
+}
+
+func (h *Handler) commands(windows map[int64]*window) [][]string {
+	prefix := h.Prefix
+	if len(prefix) == 0 {
+		prefix = DefaultPrefix
+	}
+
+	ttl := h.WindowTTL
+	if ttl <= 0 {
+		ttl = DefaultWindowTTL
+	}
+	expire := strconv.FormatInt(int64(ttl/time.Second), 10)
+
+	var cmds [][]string
+
+	for start, w := range windows {
+		key := prefix + ":" + strconv.FormatInt(start, 10)
+
+		if len(w.counters) != 0 {
+			counters := key + ":counters"
+			for series, value := range w.counters {
+				cmds = append(cmds, []string{"HINCRBYFLOAT", counters, series, formatFloat(value)})
+			}
+			cmds = append(cmds, []string{"EXPIRE", counters, expire})
+		}
+
+		if len(w.gauges) != 0 {
+			gauges := key + ":gauges"
+			cmd := []string{"HSET", gauges}
+			for series, value := range w.gauges {
+				cmd = append(cmd, series, formatFloat(value))
+			}
+			cmds = append(cmds, cmd, []string{"EXPIRE", gauges, expire})
+		}
+
+		if len(w.histograms) != 0 {
+			histograms := key + ":histograms"
+			for series, hist := range w.histograms {
+				cmds = append(cmds,
+					[]string{"HINCRBYFLOAT", histograms, series + ":count", formatFloat(hist.count)},
+					[]string{"HINCRBYFLOAT", histograms, series + ":sum", formatFloat(hist.sum)},
+				)
+				for i, bound := range hist.bounds {
+					cmds = append(cmds, []string{"HINCRBYFLOAT", histograms, series + ":le=" + formatFloat(bound), formatFloat(hist.buckets[i])})
+				}
+
+				if len(hist.values) != 0 {
+					digest := key + ":tdigest:" + series
+					if _, ok := h.digests[digest]; !ok {
+						// TDIGEST.ADD fails on missing keys, the creation is
+						// attempted the first time the process sees a key,
+						// "key already exists" errors from other processes
+						// having created it first are ignored.
+						if h.digests == nil {
+							h.digests = make(map[string]struct{})
+						}
+						h.digests[digest] = struct{}{}
+						cmds = append(cmds, []string{"TDIGEST.CREATE", digest})
+					}
+					cmd := append(make([]string, 0, 2+len(hist.values)), "TDIGEST.ADD", digest)
+					for _, v := range hist.values {
+						cmd = append(cmd, formatFloat(v))
+					}
+					cmds = append(cmds, cmd, []string{"EXPIRE", digest, expire})
+				}
+			}
+			cmds = append(cmds, []string{"EXPIRE", histograms, expire})
+		}
+	}
+
+	h.expireDigests(windows)
+	return cmds
+}
+
+// expireDigests forgets about the t-digest keys of windows older than the
+// ones being flushed, bounding the memory used to track created keys.
+func (h *Handler) expireDigests(windows map[int64]*window) {
+	if len(h.digests) == 0 || len(windows) == 0 {
+		return
+	}
+
+	oldest := int64(-1)
+	for start := range windows {
+		if oldest < 0 || start < oldest {
+			oldest = start
+		}
+	}
+
+	for digest := range h.digests {
+		if start, ok := digestWindow(digest); ok && start < oldest {
+			delete(h.digests, digest)
+		}
+	}
+}
+
+func digestWindow(digest string) (int64, bool) {
+	i := strings.Index(digest, ":tdigest:")
+	if i < 0 {
+		return 0, false
+	}
+	j := strings.LastIndexByte(digest[:i], ':')
+	start, err := strconv.ParseInt(digest[j+1:i], 10, 64)
+	return start, err == nil
+}
+
+func isDigestExists(cmd []string, err error) bool {
+	return cmd[0] == "TDIGEST.CREATE" && strings.Contains(strings.ToLower(err.Error()), "exists")
+}
+
+func newHistogram(buckets []stats.Value) *histogram {
+	hist := &histogram{
+		bounds:  make([]float64, len(buckets)),
+		buckets: make([]float64, len(buckets)),
+	}
+	for i, b := range buckets {
+		hist.bounds[i] = valueOf(b)
+	}
+	return hist
+}
+
+func (hist *histogram) observe(value float64, digest bool) {
+	hist.count++
+	hist.sum += value
+
+	for i, bound := range hist.bounds {
+		if value <= bound {
+			hist.buckets[i]++
+		}
+	}
+
+	if digest {
+		hist.values = append(hist.values, value)
+	}
+}
+
+// seriesName returns the name of the series that a measure field belongs to,
+// tags are expected to be sorted like in measures produced by the engine.
+func seriesName(measure, field string, tags []stats.Tag) string {
+	var b strings.Builder
+	b.WriteString(measure)
+	if len(measure) != 0 && len(field) != 0 {
+		b.WriteByte('.')
+	}
+	b.WriteString(field)
+
+	if len(tags) != 0 {
+		b.WriteByte('{')
+		for i, t := range tags {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(t.Name)
+			b.WriteByte('=')
+			b.WriteString(t.Value)
+		}
+		b.WriteByte('}')
+	}
+
+	return b.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func valueOf(v stats.Value) float64 {
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return 1.0
+		}
+	case stats.Int:
+		return float64(v.Int())
+	case stats.Uint:
+		return float64(v.Uint())
+	case stats.Float:
+		return v.Float()
+	case stats.Duration:
+		return v.Duration().Seconds()
+	}
+	return 0.0
+}
@@ -0,0 +1,75 @@
+package redisstats
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestHandler(t *testing.T) {
+	stats.Buckets.Set("redisstats.test.rtt", 1, 10, math.Inf(+1))
+
+	s := newServer(t)
+	h := &Handler{
+		Client: NewClient(s.addr()),
+		Prefix: "test",
+		Window: time.Minute,
+		Digest: true,
+	}
+
+	now := time.Unix(1700000000, 0)
+	tags := []stats.Tag{stats.T("env", "dev"), stats.T("host", "a")}
+
+	for i := 0; i != 2; i++ {
+		h.HandleMeasures(now, stats.Measure{
+			Name: "redisstats.test",
+			Fields: []stats.Field{
+				stats.MakeField("count", 1, stats.Counter),
+				stats.MakeField("size", 10+i, stats.Gauge),
+				stats.MakeField("rtt", 5*(i+1), stats.Histogram),
+			},
+			Tags: tags,
+		})
+	}
+
+	h.Flush()
+
+	window := "test:" + "1699999980"
+	series := "{env=dev,host=a}"
+
+	expected := []string{
+		"EXPIRE " + window + ":counters 3600",
+		"EXPIRE " + window + ":gauges 3600",
+		"EXPIRE " + window + ":histograms 3600",
+		"EXPIRE " + window + ":tdigest:redisstats.test.rtt" + series + " 3600",
+		"HINCRBYFLOAT " + window + ":counters redisstats.test.count" + series + " 2",
+		"HINCRBYFLOAT " + window + ":histograms redisstats.test.rtt" + series + ":count 2",
+		"HINCRBYFLOAT " + window + ":histograms redisstats.test.rtt" + series + ":le=+Inf 2",
+		"HINCRBYFLOAT " + window + ":histograms redisstats.test.rtt" + series + ":le=1 0",
+		"HINCRBYFLOAT " + window + ":histograms redisstats.test.rtt" + series + ":le=10 2",
+		"HINCRBYFLOAT " + window + ":histograms redisstats.test.rtt" + series + ":sum 15",
+		"HSET " + window + ":gauges redisstats.test.size" + series + " 11",
+		"TDIGEST.ADD " + window + ":tdigest:redisstats.test.rtt" + series + " 5 10",
+		"TDIGEST.CREATE " + window + ":tdigest:redisstats.test.rtt" + series,
+	}
+
+	var received []string
+	for _, cmd := range s.commands() {
+		received = append(received, strings.Join(cmd, " "))
+	}
+	sort.Strings(received)
+
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("bad commands:\nwant:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(received, "\n"))
+	}
+
+	h.Flush()
+
+	if n := len(s.commands()); n != len(expected) {
+		t.Errorf("flushing without new measures must not send commands, got %d", n-len(expected))
+	}
+}
@@ -0,0 +1,487 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reservoir is an interface implemented by types that accumulate histogram
+// observations and estimate their distribution.
+//
+// Implementations trade precision for memory: ExactReservoir retains every
+// observation, SampledReservoir retains a bounded uniform sample, and
+// SketchReservoir retains a DDSketch with a relative accuracy guarantee.
+//
+// Reservoirs are not safe to use concurrently from multiple goroutines.
+type Reservoir interface {
+	// Observe adds v to the reservoir.
+	Observe(v float64)
+
+	// Count returns the number of values observed since the last reset.
+	Count() uint64
+
+	// Sum returns the sum of values observed since the last reset.
+	Sum() float64
+
+	// Quantile returns an estimation of the q-quantile of the observed values,
+	// q must be between 0 and 1. If no values were observed, zero is returned.
+	Quantile(q float64) float64
+
+	// Reset clears the reservoir.
+	Reset()
+}
+
+// ExactReservoir is a Reservoir which retains all observations, it gives exact
+// quantiles at the cost of memory growing linearly with the number of
+// observations.
+type ExactReservoir struct {
+	values []float64
+	sum    float64
+	sorted bool
+}
+
+// NewExactReservoir returns a new ExactReservoir.
+func NewExactReservoir() Reservoir { return &ExactReservoir{} }
+
+// Observe satisfies the Reservoir interface.
+func (r *ExactReservoir) Observe(v float64) {
+	r.values = append(r.values, v)
+	r.sum += v
+	r.sorted = false
+}
+
+// Count satisfies the Reservoir interface.
+func (r *ExactReservoir) Count() uint64 { return uint64(len(r.values)) }
+
+// Sum satisfies the Reservoir interface.
+func (r *ExactReservoir) Sum() float64 { return r.sum }
+
+// Quantile satisfies the Reservoir interface.
+func (r *ExactReservoir) Quantile(q float64) float64 {
+	if !r.sorted {
+		sort.Float64s(r.values)
+		r.sorted = true
+	}
+	return quantileOf(r.values, q)
+}
+
+// Reset satisfies the Reservoir interface.
+func (r *ExactReservoir) Reset() {
+	r.values, r.sum, r.sorted = r.values[:0], 0, false
+}
+
+// SampledReservoir is a Reservoir which retains a uniform random sample of
+// fixed size of the observations (using Vitter's algorithm R), its memory
+// footprint is bounded regardless of the rate of observations.
+//
+// Count and Sum remain exact, only quantiles are estimated from the sample.
+type SampledReservoir struct {
+	values []float64
+	sorted []float64
+	count  uint64
+	sum    float64
+	rand   *rand.Rand
+}
+
+// DefaultReservoirSize is the number of samples retained by SampledReservoir
+// values created with a zero size.
+const DefaultReservoirSize = 1028
+
+// NewSampledReservoir returns a new SampledReservoir retaining up to size
+// observations.
+func NewSampledReservoir(size int) Reservoir {
+	if size <= 0 {
+		size = DefaultReservoirSize
+	}
+	return &SampledReservoir{
+		values: make([]float64, 0, size),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Observe satisfies the Reservoir interface.
+func (r *SampledReservoir) Observe(v float64) {
+	r.count++
+	r.sum += v
+
+	if len(r.values) < cap(r.values) {
+		r.values = append(r.values, v)
+	} else if i := r.rand.Int63n(int64(r.count)); i < int64(len(r.values)) {
+		r.values[i] = v
+	}
+}
+
+// Count satisfies the Reservoir interface.
+func (r *SampledReservoir) Count() uint64 { return r.count }
+
+// Sum satisfies the Reservoir interface.
+func (r *SampledReservoir) Sum() float64 { return r.sum }
+
+// Quantile satisfies the Reservoir interface.
+func (r *SampledReservoir) Quantile(q float64) float64 {
+	r.sorted = append(r.sorted[:0], r.values...)
+	sort.Float64s(r.sorted)
+	return quantileOf(r.sorted, q)
+}
+
+// Reset satisfies the Reservoir interface.
+func (r *SampledReservoir) Reset() {
+	r.values, r.count, r.sum = r.values[:0], 0, 0
+}
+
+// SketchReservoir is a Reservoir implementing the DDSketch algorithm, quantile
+// estimations are guaranteed to be within a relative error of the actual
+// value, and memory grows logarithmically with the range of observed values.
+//
+// See https://arxiv.org/abs/1908.10693 for details on the algorithm.
+type SketchReservoir struct {
+	gamma    float64
+	logGamma float64
+	positive map[int]uint64
+	negative map[int]uint64
+	zero     uint64
+	count    uint64
+	sum      float64
+	keys     []int
+}
+
+// DefaultSketchAccuracy is the relative accuracy of SketchReservoir values
+// created with a zero accuracy.
+const DefaultSketchAccuracy = 0.01
+
+// NewSketchReservoir returns a new SketchReservoir with the given relative
+// accuracy, which must be between 0 and 1 (exclusive).
+func NewSketchReservoir(relativeAccuracy float64) Reservoir {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		relativeAccuracy = DefaultSketchAccuracy
+	}
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &SketchReservoir{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64),
+	}
+}
+
+// Observe satisfies the Reservoir interface.
+func (r *SketchReservoir) Observe(v float64) {
+	r.count++
+	r.sum += v
+
+	switch {
+	case v > 0:
+		r.positive[r.index(v)]++
+	case v < 0:
+		r.negative[r.index(-v)]++
+	default:
+		r.zero++
+	}
+}
+
+// Count satisfies the Reservoir interface.
+func (r *SketchReservoir) Count() uint64 { return r.count }
+
+// Sum satisfies the Reservoir interface.
+func (r *SketchReservoir) Sum() float64 { return r.sum }
+
+// Quantile satisfies the Reservoir interface.
+func (r *SketchReservoir) Quantile(q float64) float64 {
+	if r.count == 0 {
+		return 0
+	}
+
+	rank := uint64(clampQuantile(q) * float64(r.count-1))
+	seen := uint64(0)
+
+	// Negative values are visited from the largest magnitude to the smallest.
+	r.keys = sortedKeys(r.keys[:0], r.negative)
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if seen += r.negative[r.keys[i]]; seen > rank {
+			return -r.value(r.keys[i])
+		}
+	}
+
+	if seen += r.zero; seen > rank {
+		return 0
+	}
+
+	r.keys = sortedKeys(r.keys[:0], r.positive)
+	for _, k := range r.keys {
+		if seen += r.positive[k]; seen > rank {
+			return r.value(k)
+		}
+	}
+
+	return 0
+}
+
+// Reset satisfies the Reservoir interface.
+func (r *SketchReservoir) Reset() {
+	clear(r.positive)
+	clear(r.negative)
+	r.zero, r.count, r.sum = 0, 0, 0
+}
+
+func (r *SketchReservoir) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / r.logGamma))
+}
+
+func (r *SketchReservoir) value(i int) float64 {
+	return 2 * math.Pow(r.gamma, float64(i)) / (r.gamma + 1)
+}
+
+func sortedKeys(keys []int, m map[int]uint64) []int {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func quantileOf(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(clampQuantile(q)*float64(len(sorted)-1))]
+}
+
+func clampQuantile(q float64) float64 {
+	switch {
+	case q < 0:
+		return 0
+	case q > 1:
+		return 1
+	default:
+		return q
+	}
+}
+
+// HistogramReservoirs is a map type storing the reservoirs used to aggregate
+// histograms.
+type HistogramReservoirs map[Key]func() Reservoir
+
+// Set configures the histogram identified by key to be aggregated in
+// reservoirs created by newReservoir.
+func (r HistogramReservoirs) Set(key string, newReservoir func() Reservoir) {
+	r[makeKey(key)] = newReservoir
+}
+
+// Reservoirs is the registry where histogram reservoirs used by
+// ReservoirHandler are configured, similarly to Buckets.
+var Reservoirs = HistogramReservoirs{}
+
+// DefaultQuantiles is the list of quantiles reported by a ReservoirHandler
+// when none were configured.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// ReservoirHandler is a Handler which aggregates histogram observations into
+// reservoirs instead of forwarding them individually, bounding the memory and
+// bandwidth used by histograms in high-rate paths.
+//
+// Histogram and distribution fields for which a reservoir is configured are
+// accumulated until the handler is flushed, at which point it forwards, for
+// each series, a measure with a "<field>.count" and "<field>.sum" counter and
+// one "<field>.p<N>" gauge per quantile. All other fields are forwarded
+// unchanged.
+type ReservoirHandler struct {
+	// Handler receives the measures produced by the reservoir handler.
+	Handler Handler
+
+	// Reservoirs configures the reservoir used for each histogram. If nil,
+	// the global Reservoirs registry is used.
+	Reservoirs HistogramReservoirs
+
+	// Default creates reservoirs for histograms that have none configured in
+	// Reservoirs. If nil, those histograms are forwarded unchanged.
+	Default func() Reservoir
+
+	// Quantiles reported for each reservoir. If nil, DefaultQuantiles is
+	// used.
+	Quantiles []float64
+
+	mutex  sync.Mutex
+	series map[string]*reservoirSeries
+}
+
+type reservoirSeries struct {
+	name      string
+	field     string
+	tags      []Tag
+	reservoir Reservoir
+}
+
+// HandleMeasures satisfies the Handler interface.
+func (h *ReservoirHandler) HandleMeasures(t time.Time, measures ...Measure) {
+	var forward []Measure
+
+	for i, m := range measures {
+		// The fields are only copied once one of them is diverted to a
+		// reservoir, measures without such fields are forwarded unchanged.
+		var fields []Field
+
+		for j, f := range m.Fields {
+			newReservoir := h.reservoirOf(m.Name, f)
+			if newReservoir == nil {
+				if fields != nil {
+					fields = append(fields, f)
+				}
+				continue
+			}
+			if fields == nil {
+				fields = append(make([]Field, 0, len(m.Fields)-1), m.Fields[:j]...)
+			}
+			h.observe(m, f, newReservoir)
+		}
+
+		switch {
+		case fields == nil:
+			if forward != nil {
+				forward = append(forward, m)
+			}
+		default:
+			if forward == nil {
+				forward = append(make([]Measure, 0, len(measures)), measures[:i]...)
+			}
+			if len(fields) != 0 {
+				forward = append(forward, Measure{Name: m.Name, Fields: fields, Tags: m.Tags})
+			}
+		}
+	}
+
+	if forward == nil {
+		forward = measures
+	}
+
+	if len(forward) != 0 {
+		h.Handler.HandleMeasures(t, forward...)
+	}
+}
+
+func (h *ReservoirHandler) reservoirOf(name string, f Field) func() Reservoir {
+	if t := f.Type(); t != Histogram && t != Distribution {
+		return nil
+	}
+
+	reservoirs := h.Reservoirs
+	if reservoirs == nil {
+		reservoirs = Reservoirs
+	}
+
+	if newReservoir := reservoirs[Key{Measure: name, Field: f.Name}]; newReservoir != nil {
+		return newReservoir
+	}
+
+	return h.Default
+}
+
+func (h *ReservoirHandler) observe(m Measure, f Field, newReservoir func() Reservoir) {
+	key := seriesKey(m.Name, f.Name, m.Tags)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.series == nil {
+		h.series = make(map[string]*reservoirSeries)
+	}
+
+	s := h.series[key]
+	if s == nil {
+		s = &reservoirSeries{
+			name:      m.Name,
+			field:     f.Name,
+			tags:      copyTags(m.Tags),
+			reservoir: newReservoir(),
+		}
+		h.series[key] = s
+	}
+
+	s.reservoir.Observe(floatValueOf(f.Value))
+}
+
+// Flush satisfies the Flusher interface, it reports the state of all the
+// reservoirs, resets them, then flushes the underlying handler.
+func (h *ReservoirHandler) Flush() {
+	now := time.Now()
+	quantiles := h.Quantiles
+	if quantiles == nil {
+		quantiles = DefaultQuantiles
+	}
+
+	h.mutex.Lock()
+	measures := make([]Measure, 0, len(h.series))
+
+	for key, s := range h.series {
+		r := s.reservoir
+		if r.Count() == 0 {
+			// Series that didn't receive observations during a full flush
+			// interval are released.
+			delete(h.series, key)
+			continue
+		}
+
+		fields := make([]Field, 0, 2+len(quantiles))
+		fields = append(fields,
+			MakeField(concat(s.field, "count"), r.Count(), Counter),
+			MakeField(concat(s.field, "sum"), r.Sum(), Counter),
+		)
+		for _, q := range quantiles {
+			fields = append(fields, MakeField(concat(s.field, quantileName(q)), r.Quantile(q), Gauge))
+		}
+
+		measures = append(measures, Measure{Name: s.name, Fields: fields, Tags: s.tags})
+		r.Reset()
+	}
+
+	h.mutex.Unlock()
+
+	if len(measures) != 0 {
+		h.Handler.HandleMeasures(now, measures...)
+	}
+
+	flush(h.Handler)
+}
+
+func seriesKey(name, field string, tags []Tag) string {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte(0)
+	b.WriteString(field)
+	for _, t := range tags {
+		b.WriteByte(0)
+		b.WriteString(t.Name)
+		b.WriteByte('=')
+		b.WriteString(t.Value)
+	}
+	return b.String()
+}
+
+// quantileName returns the field name suffix used to report q, for example
+// "p99" for 0.99, or "p999" for 0.999. The percentile is rounded to 1e-2, q*100
+// is otherwise not exact for most quantiles (0.29*100 is 28.999999999999996).
+func quantileName(q float64) string {
+	return "p" + strings.Replace(strconv.FormatFloat(math.Round(q*1e4)/1e2, 'f', -1, 64), ".", "", 1)
+}
+
+func floatValueOf(v Value) float64 {
+	switch v.Type() {
+	case Bool:
+		if v.Bool() {
+			return 1
+		}
+	case Int:
+		return float64(v.Int())
+	case Uint:
+		return float64(v.Uint())
+	case Float:
+		return v.Float()
+	case Duration:
+		return v.Duration().Seconds()
+	}
+	return 0
+}
@@ -0,0 +1,234 @@
+package stats_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestReservoirs(t *testing.T) {
+	reservoirs := []struct {
+		name      string
+		new       func() stats.Reservoir
+		tolerance float64
+	}{
+		{name: "exact", new: stats.NewExactReservoir, tolerance: 0},
+		{name: "sampled", new: func() stats.Reservoir { return stats.NewSampledReservoir(10000) }, tolerance: 0},
+		{name: "sketch", new: func() stats.Reservoir { return stats.NewSketchReservoir(0.01) }, tolerance: 0.01},
+	}
+
+	for _, test := range reservoirs {
+		t.Run(test.name, func(t *testing.T) {
+			r := test.new()
+
+			if q := r.Quantile(0.5); q != 0 {
+				t.Error("empty reservoir must report zero quantiles:", q)
+			}
+
+			for i := 1; i <= 1000; i++ {
+				r.Observe(float64(i))
+			}
+
+			if n := r.Count(); n != 1000 {
+				t.Error("bad count:", n)
+			}
+
+			if s := r.Sum(); s != 500500 {
+				t.Error("bad sum:", s)
+			}
+
+			for _, q := range []struct {
+				q float64
+				v float64
+			}{
+				{q: 0, v: 1},
+				{q: 0.5, v: 500},
+				{q: 0.99, v: 990},
+				{q: 1, v: 1000},
+			} {
+				v := r.Quantile(q.q)
+				if math.Abs(v-q.v) > q.v*test.tolerance+1e-9 {
+					t.Errorf("bad quantile %g: want %g, got %g", q.q, q.v, v)
+				}
+			}
+
+			r.Reset()
+
+			if n := r.Count(); n != 0 {
+				t.Error("reset reservoir must have a zero count:", n)
+			}
+		})
+	}
+}
+
+func TestSampledReservoirBounded(t *testing.T) {
+	r := stats.NewSampledReservoir(100)
+
+	for i := 0; i < 100000; i++ {
+		r.Observe(float64(i % 100))
+	}
+
+	if n := r.Count(); n != 100000 {
+		t.Error("bad count:", n)
+	}
+
+	if q := r.Quantile(0.5); q < 25 || q > 75 {
+		t.Error("sampled median is too far from the actual value:", q)
+	}
+}
+
+func TestSketchReservoirNegative(t *testing.T) {
+	r := stats.NewSketchReservoir(0.01)
+
+	for _, v := range []float64{-100, -10, 0, 10, 100} {
+		r.Observe(v)
+	}
+
+	for _, q := range []struct {
+		q float64
+		v float64
+	}{
+		{q: 0, v: -100},
+		{q: 0.25, v: -10},
+		{q: 0.5, v: 0},
+		{q: 1, v: 100},
+	} {
+		v := r.Quantile(q.q)
+		if math.Abs(v-q.v) > math.Abs(q.v)*0.01+1e-9 {
+			t.Errorf("bad quantile %g: want %g, got %g", q.q, q.v, v)
+		}
+	}
+}
+
+func TestReservoirHandler(t *testing.T) {
+	h := &statstest.Handler{}
+	r := &stats.ReservoirHandler{
+		Handler:    h,
+		Reservoirs: stats.HistogramReservoirs{},
+		Quantiles:  []float64{0.5, 0.99},
+	}
+	r.Reservoirs.Set("rpc.latency", stats.NewExactReservoir)
+
+	now := time.Now()
+	tags := []stats.Tag{stats.T("op", "get")}
+
+	for i := 1; i <= 100; i++ {
+		r.HandleMeasures(now, stats.Measure{
+			Name: "rpc",
+			Fields: []stats.Field{
+				stats.MakeField("latency", i, stats.Histogram),
+				stats.MakeField("size", i, stats.Histogram),
+			},
+			Tags: tags,
+		})
+	}
+
+	if n := len(h.Measures()); n != 100 {
+		t.Fatal("fields without reservoirs must be forwarded:", n)
+	}
+
+	for _, m := range h.Measures() {
+		if len(m.Fields) != 1 || m.Fields[0].Name != "size" {
+			t.Fatal("fields with reservoirs must not be forwarded:", m)
+		}
+	}
+
+	h.Clear()
+	r.Flush()
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatal("bad number of measures reported on flush:", measures)
+	}
+
+	expected := map[string]stats.Value{
+		"latency.count": stats.ValueOf(uint64(100)),
+		"latency.sum":   stats.ValueOf(5050.0),
+		"latency.p50":   stats.ValueOf(50.0),
+		"latency.p99":   stats.ValueOf(99.0),
+	}
+
+	m := measures[0]
+	if m.Name != "rpc" || len(m.Tags) != 1 || m.Tags[0] != tags[0] {
+		t.Error("bad measure:", m)
+	}
+
+	if len(m.Fields) != len(expected) {
+		t.Error("bad fields:", m.Fields)
+	}
+
+	for _, f := range m.Fields {
+		if v, ok := expected[f.Name]; !ok || v.Interface() != f.Value.Interface() {
+			t.Errorf("bad field %s: want %v, got %v", f.Name, v, f.Value)
+		}
+	}
+
+	if n := h.FlushCalls(); n != 1 {
+		t.Error("the underlying handler must be flushed:", n)
+	}
+
+	h.Clear()
+	r.Flush()
+
+	if n := len(h.Measures()); n != 0 {
+		t.Error("idle reservoirs must not be reported:", n)
+	}
+}
+
+func TestReservoirHandlerForwardAllocs(t *testing.T) {
+	r := &stats.ReservoirHandler{
+		Handler:    stats.Discard,
+		Reservoirs: stats.HistogramReservoirs{},
+	}
+	r.Reservoirs.Set("rpc.latency", stats.NewExactReservoir)
+
+	now := time.Now()
+	measures := []stats.Measure{{
+		Name: "rpc",
+		Fields: []stats.Field{
+			stats.MakeField("count", 1, stats.Counter),
+			stats.MakeField("size", 1, stats.Histogram),
+		},
+	}}
+
+	if n := testing.AllocsPerRun(100, func() { r.HandleMeasures(now, measures...) }); n != 0 {
+		t.Error("measures without reservoirs must be forwarded without allocating:", n)
+	}
+}
+
+func TestReservoirHandlerDistributionQuantileNames(t *testing.T) {
+	h := &statstest.Handler{}
+	r := &stats.ReservoirHandler{
+		Handler:    h,
+		Reservoirs: stats.HistogramReservoirs{},
+		Quantiles:  []float64{0.29, 0.57, 0.999},
+	}
+	r.Reservoirs.Set("rpc.latency", stats.NewExactReservoir)
+
+	r.HandleMeasures(time.Now(), stats.Measure{
+		Name:   "rpc",
+		Fields: []stats.Field{stats.MakeField("latency", 1, stats.Distribution)},
+	})
+
+	if n := len(h.Measures()); n != 0 {
+		t.Fatal("distributions with reservoirs must not be forwarded:", n)
+	}
+
+	r.Flush()
+
+	var names []string
+	for _, m := range h.Measures() {
+		for _, f := range m.Fields {
+			names = append(names, f.Name)
+		}
+	}
+
+	expected := []string{"latency.count", "latency.sum", "latency.p29", "latency.p57", "latency.p999"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("bad field names:\nwant %v\ngot  %v", expected, names)
+	}
+}
@@ -0,0 +1,182 @@
+package stats
+
+import (
+	"context"
+	"maps"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+// ContextWithSamplingKey returns a child context carrying key as sampling key,
+// which is typically the request or trace ID.
+//
+// When sampling is enabled on an engine (see Engine.SampleRate), all measures
+// produced with contexts carrying the same sampling key are either reported
+// or dropped together, because the decision is derived from a hash of the key
+// instead of a random number.
+func ContextWithSamplingKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextKeySampling, mix64(jody.HashString64(key)))
+}
+
+// mix64 spreads the bits of h across the whole hash space (this is the
+// finalizer of MurmurHash3), the hashes of short keys are otherwise clustered
+// and would not be sampled at the expected rate.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// contextSamplingHash returns the hash of the sampling key of ctx, and a
+// boolean indicating whether ctx carried one.
+func contextSamplingHash(ctx context.Context) (uint64, bool) {
+	h, ok := ctx.Value(contextKeySampling).(uint64)
+	return h, ok
+}
+
+type samplingKey struct{}
+
+// String implements the fmt.Stringer interface.
+func (k samplingKey) String() string {
+	return "stats_sampling_context_key"
+}
+
+var contextKeySampling = samplingKey{}
+
+// MetricSampleRates is a registry storing the sample rates of metrics. It is
+// safe to use concurrently from multiple goroutines, rates can be changed
+// while the program reports measures. The zero value is an empty registry.
+type MetricSampleRates struct {
+	mutex sync.Mutex // serializes updates
+	rates atomic.Pointer[map[Key]float64]
+}
+
+// Set sets the rate at which the metric identified by key, which has the form
+// "measure.field", is sampled.
+func (r *MetricSampleRates) Set(key string, rate float64) {
+	r.update(func(rates map[Key]float64) { rates[makeKey(key)] = rate })
+}
+
+// Delete removes the sample rate of the metric identified by key, which is
+// then sampled at the rate of the engine producing it.
+func (r *MetricSampleRates) Delete(key string) {
+	r.update(func(rates map[Key]float64) { delete(rates, makeKey(key)) })
+}
+
+// Get returns the sample rate of the metric identified by key, and a boolean
+// indicating whether the registry has one.
+func (r *MetricSampleRates) Get(key string) (float64, bool) {
+	rate, ok := r.load()[makeKey(key)]
+	return rate, ok
+}
+
+// load returns the current rates, the map must not be modified.
+func (r *MetricSampleRates) load() map[Key]float64 {
+	if rates := r.rates.Load(); rates != nil {
+		return *rates
+	}
+	return nil
+}
+
+// update applies f to a copy of the rates and publishes it, readers never see
+// the map being modified.
+func (r *MetricSampleRates) update(f func(map[Key]float64)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rates := maps.Clone(r.load())
+	if rates == nil {
+		rates = make(map[Key]float64)
+	}
+	f(rates)
+	r.rates.Store(&rates)
+}
+
+// SampleRates is a registry where the sample rates of individual metrics are
+// placed, they take precedence over the SampleRate of engines for measures
+// produced by the Incr, Add, Set, Observe, and Distribute methods (and their
+// variants). Keys are the full names of metrics, including the engine prefix.
+//
+// A common pattern is to sample high-frequency counters in the init function
+// of the package producing them:
+//
+//	func init() {
+//		stats.SampleRates.Set("cache.lookup.count", 0.01)
+//	}
+//
+// A rate of 1 disables sampling of a metric on engines that sample all other
+// metrics.
+var SampleRates MetricSampleRates
+
+// sampleRate returns the rate at which the metric identified by name is
+// sampled by the engine.
+func (e *Engine) sampleRate(name string) float64 {
+	if rates := SampleRates.load(); len(rates) != 0 {
+		measure, field := splitMeasureField(name)
+		if rate, ok := rates[Key{Measure: e.makeName(measure), Field: field}]; ok {
+			return rate
+		}
+	}
+	return e.SampleRate
+}
+
+// sampling returns true if sampling is enabled on the engine.
+func (e *Engine) sampling() bool {
+	return sampling(e.SampleRate)
+}
+
+// sample returns true if the measures produced on behalf of ctx must be
+// reported.
+func (e *Engine) sample(ctx context.Context) bool {
+	return sample(ctx, e.SampleRate)
+}
+
+func sampling(rate float64) bool {
+	return rate > 0 && rate < 1
+}
+
+func sample(ctx context.Context, rate float64) bool {
+	if !sampling(rate) {
+		return true
+	}
+	h, ok := contextSamplingHash(ctx)
+	if !ok {
+		h = rand.Uint64()
+	}
+	return sampled(h, rate)
+}
+
+// sampled returns true if the hash h falls in the fraction rate of the hash
+// space.
+func sampled(h uint64, rate float64) bool {
+	return float64(h) < rate*(1<<64)
+}
+
+// scaleCounters divides the values of counter fields in measures by rate, so
+// that sums of sampled counters remain unbiased estimates of the actual sums.
+func scaleCounters(measures []Measure, rate float64) {
+	for i := range measures {
+		fields := measures[i].Fields
+		for j := range fields {
+			if fields[j].Type() == Counter {
+				fields[j] = MakeField(fields[j].Name, scaleValue(fields[j].Value, rate), Counter)
+			}
+		}
+	}
+}
+
+// scaleValue returns v divided by rate, durations remain durations and other
+// types are converted to floats.
+func scaleValue(v Value, rate float64) Value {
+	if v.Type() == Duration {
+		return durationValue(time.Duration(float64(v.Duration()) / rate))
+	}
+	return float64Value(floatValueOf(v) / rate)
+}
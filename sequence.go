@@ -0,0 +1,104 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SequencedHandler is implemented by handlers which forward batches of
+// measures to systems that need to detect their loss or reordering, like
+// message queues or forwarding protocols.
+//
+// When the Sequenced field of an engine is set, the engine calls
+// HandleSequencedMeasures instead of HandleMeasures with the sequence number
+// of each batch of measures, and guarantees that:
+//
+//   - sequence numbers start at 1 and increase by one with each batch, without
+//     gaps, across the engine and all the engines derived from it by
+//     WithPrefix and WithTags,
+//   - calls to the handler are serialized, handlers observe batches in the
+//     order of their sequence numbers,
+//   - calls to Flush are ordered with the batches, all the batches with lower
+//     sequence numbers were handled when the handler is flushed, and none of
+//     the batches with greater sequence numbers.
+//
+// Multi-handlers pass sequence numbers to the handlers which implement this
+// interface, the other handlers receive the measures by HandleMeasures.
+// Batches may be emptied by filtering handlers, in which case they are still
+// handled, with no measures, so receivers do not mistake them for lost
+// batches.
+type SequencedHandler interface {
+	Handler
+
+	// HandleSequencedMeasures is like HandleMeasures, with seq the sequence
+	// number of the batch of measures.
+	HandleSequencedMeasures(seq uint64, time time.Time, measures ...Measure)
+}
+
+func handleSequenced(h Handler, seq uint64, t time.Time, measures []Measure) {
+	switch s := h.(type) {
+	case SequencedHandler:
+		s.HandleSequencedMeasures(seq, t, measures...)
+	case *multiHandler:
+		for _, h := range s.handlers {
+			handleSequenced(h, seq, t, measures)
+		}
+	case *filteredHandler:
+		handleSequenced(s.handler, seq, t, s.filter(measures))
+	default:
+		h.HandleMeasures(t, measures...)
+	}
+}
+
+// sequencer numbers the batches of measures of engines which have Sequenced
+// set, it is shared by the engines created by WithPrefix and WithTags.
+type sequencer struct {
+	mutex sync.Mutex
+	last  uint64
+}
+
+func (s *sequencer) handle(h Handler, t time.Time, measures []Measure) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.last++
+	handleSequenced(h, s.last, t, measures)
+}
+
+// flush flushes h in between two batches of measures.
+func (s *sequencer) flush(h Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	flush(h)
+}
+
+// lazySequencer is embedded in engines, which may be constructed as struct
+// literals, to create their sequencer on first use.
+type lazySequencer struct {
+	ptr atomic.Pointer[sequencer]
+}
+
+func (l *lazySequencer) load() *sequencer {
+	if s := l.ptr.Load(); s != nil {
+		return s
+	}
+	l.ptr.CompareAndSwap(nil, new(sequencer))
+	return l.ptr.Load()
+}
+
+// handle passes measures to the handler of the engine.
+func (e *Engine) handle(t time.Time, measures []Measure) {
+	e.trackMetrics(t, measures)
+	e.handleWith(e.Handler, t, measures)
+}
+
+func (e *Engine) handleWith(h Handler, t time.Time, measures []Measure) {
+	if names := ExemplarTags.load(); len(names) != 0 && hasTagNames(measures, names) {
+		h = &exemplarDispatcher{handler: h, names: names}
+	}
+	if e.Sequenced {
+		e.sequence.load().handle(h, t, measures)
+	} else {
+		h.HandleMeasures(t, measures...)
+	}
+}
@@ -0,0 +1,107 @@
+package stats_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+type sequenceRecorder struct {
+	mutex   sync.Mutex
+	seqs    []uint64
+	flushes []int // number of batches seen at each flush
+	names   []string
+}
+
+func (r *sequenceRecorder) HandleMeasures(time.Time, ...stats.Measure) {
+	panic("sequenced handlers must receive sequence numbers")
+}
+
+func (r *sequenceRecorder) HandleSequencedMeasures(seq uint64, _ time.Time, measures ...stats.Measure) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.seqs = append(r.seqs, seq)
+	for _, m := range measures {
+		r.names = append(r.names, m.Name)
+	}
+}
+
+func (r *sequenceRecorder) Flush() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.flushes = append(r.flushes, len(r.seqs))
+}
+
+func TestEngineSequenced(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	r := &sequenceRecorder{}
+	h := &statstest.Handler{}
+	e := stats.NewEngine("", stats.MultiHandler(r, h))
+	e.Sequenced = true
+
+	sub := e.WithPrefix("sub")
+
+	var wg sync.WaitGroup
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j != 100; j++ {
+				e.Incr("a.count")
+				sub.Set("b.value", j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	e.Flush()
+	sub.Flush()
+
+	if len(r.seqs) != 2000 {
+		t.Fatalf("bad number of batches: %d", len(r.seqs))
+	}
+	for i, seq := range r.seqs {
+		if seq != uint64(i+1) {
+			t.Fatalf("batch %d has sequence number %d", i, seq)
+		}
+	}
+	if len(r.flushes) != 2 || r.flushes[0] != 2000 || r.flushes[1] != 2000 {
+		t.Errorf("bad flushes: %v", r.flushes)
+	}
+	// Handlers which are not sequenced receive the measures as usual.
+	if n := len(h.Measures()); n != 2000 {
+		t.Errorf("bad number of measures: %d", n)
+	}
+}
+
+func TestEngineSequencedFilteredHandler(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	r := &sequenceRecorder{}
+	e := stats.NewEngine("", stats.FilteredHandler(r, func(measures []stats.Measure) []stats.Measure {
+		if len(measures) != 0 && measures[0].Name == "dropped" {
+			return nil
+		}
+		return measures
+	}))
+	e.Sequenced = true
+
+	e.Incr("kept.count")
+	e.Incr("dropped.count")
+	e.Incr("kept.count")
+
+	if len(r.seqs) != 3 || r.seqs[2] != 3 {
+		t.Errorf("batches emptied by filters must keep their sequence number: %v", r.seqs)
+	}
+	if len(r.names) != 2 {
+		t.Errorf("bad measures: %v", r.names)
+	}
+}
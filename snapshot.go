@@ -0,0 +1,145 @@
+package stats
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetricSnapshot describes a metric produced by an engine, as returned by
+// Engine.Snapshot.
+type MetricSnapshot struct {
+	// Key identifies the metric, the measure name includes the prefix of the
+	// engine which produced it.
+	Key Key
+
+	// Type of the metric, the last one reported if it changed.
+	Type FieldType
+
+	// Tags are the sorted names of the tags seen on the measures of the
+	// metric.
+	Tags []string
+
+	// Count is the number of values reported for the metric.
+	Count uint64
+
+	// LastReport is the time of the last measure of the metric.
+	LastReport time.Time
+}
+
+// Snapshot returns the metrics produced by the engine, and the engines derived
+// from it, since TrackMetrics was enabled, sorted by name. It answers the
+// question of what a program is emitting without looking at the handlers,
+// the debugstats package exposes it on an HTTP endpoint.
+//
+// It returns nil if TrackMetrics is not enabled.
+func (e *Engine) Snapshot() []MetricSnapshot {
+	if !e.TrackMetrics {
+		return nil
+	}
+	return e.metrics.load().snapshot()
+}
+
+// trackMetrics records the metrics of measures when TrackMetrics is enabled.
+func (e *Engine) trackMetrics(t time.Time, measures []Measure) {
+	if e.TrackMetrics {
+		e.metrics.load().track(t, measures)
+	}
+}
+
+type trackedMetric struct {
+	ftype FieldType
+	tags  map[string]struct{}
+	count uint64
+	last  time.Time
+}
+
+type metricTracker struct {
+	mutex   sync.Mutex
+	metrics map[Key]*trackedMetric
+}
+
+func (m *metricTracker) track(t time.Time, measures []Measure) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.metrics == nil {
+		m.metrics = make(map[Key]*trackedMetric)
+	}
+
+	for i := range measures {
+		measure := &measures[i]
+
+		for _, f := range measure.Fields {
+			k := Key{Measure: measure.Name, Field: f.Name}
+			tm := m.metrics[k]
+
+			if tm == nil {
+				// The names may be backed by buffers reused by the caller.
+				k = Key{Measure: Intern(k.Measure), Field: Intern(k.Field)}
+				tm = &trackedMetric{tags: make(map[string]struct{})}
+				m.metrics[k] = tm
+			}
+
+			for _, tag := range measure.Tags {
+				if _, ok := tm.tags[tag.Name]; !ok {
+					tm.tags[Intern(tag.Name)] = struct{}{}
+				}
+			}
+
+			tm.ftype = f.Type()
+			tm.count++
+			if t.After(tm.last) {
+				tm.last = t
+			}
+		}
+	}
+}
+
+func (m *metricTracker) snapshot() []MetricSnapshot {
+	m.mutex.Lock()
+	snapshot := make([]MetricSnapshot, 0, len(m.metrics))
+
+	for k, tm := range m.metrics {
+		tags := make([]string, 0, len(tm.tags))
+		for name := range tm.tags {
+			tags = append(tags, name)
+		}
+		sort.Strings(tags)
+
+		snapshot = append(snapshot, MetricSnapshot{
+			Key:        k,
+			Type:       tm.ftype,
+			Tags:       tags,
+			Count:      tm.count,
+			LastReport: tm.last,
+		})
+	}
+
+	m.mutex.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		k1, k2 := snapshot[i].Key, snapshot[j].Key
+		if c := strings.Compare(k1.Measure, k2.Measure); c != 0 {
+			return c < 0
+		}
+		return k1.Field < k2.Field
+	})
+	return snapshot
+}
+
+// lazyMetricTracker is embedded in engines, which may be constructed as struct
+// literals, to create their tracker on first use.
+type lazyMetricTracker struct {
+	ptr atomic.Pointer[metricTracker]
+}
+
+func (l *lazyMetricTracker) load() *metricTracker {
+	if m := l.ptr.Load(); m != nil {
+		return m
+	}
+	l.ptr.CompareAndSwap(nil, new(metricTracker))
+	return l.ptr.Load()
+}
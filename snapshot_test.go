@@ -0,0 +1,60 @@
+package stats_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestEngineSnapshot(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("app", h, stats.T("region", "us-west-2"))
+
+	e.Incr("ignored")
+	if snapshot := e.Snapshot(); snapshot != nil {
+		t.Fatalf("metrics were tracked without TrackMetrics: %v", snapshot)
+	}
+
+	e.TrackMetrics = true
+	sub := e.WithPrefix("db", stats.T("table", "users"))
+
+	t0 := time.Now()
+	t1 := t0.Add(time.Second)
+
+	e.IncrAt(t0, "requests.count", stats.T("status", "200"))
+	e.IncrAt(t1, "requests.count", stats.T("method", "GET"))
+	sub.ObserveAt(t0, "query.rtt", time.Millisecond)
+
+	snapshot := e.Snapshot()
+	expect := []stats.MetricSnapshot{
+		{
+			Key:        stats.Key{Measure: "app.db.query", Field: "rtt"},
+			Type:       stats.Histogram,
+			Tags:       []string{"region", "table"},
+			Count:      1,
+			LastReport: t0,
+		},
+		{
+			Key:        stats.Key{Measure: "app.requests", Field: "count"},
+			Type:       stats.Counter,
+			Tags:       []string{"method", "region", "status"},
+			Count:      2,
+			LastReport: t1,
+		},
+	}
+
+	if !reflect.DeepEqual(snapshot, expect) {
+		t.Errorf("bad snapshot:\nwant: %+v\ngot:  %+v", expect, snapshot)
+	}
+
+	if !reflect.DeepEqual(sub.Snapshot(), snapshot) {
+		t.Error("derived engines must share the snapshot of their parent")
+	}
+}
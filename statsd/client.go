@@ -0,0 +1,194 @@
+// Package statsd implements a stats handler sending metrics with the statsd
+// protocol, with tags formatted in the dialect of the aggregator receiving
+// them.
+package statsd
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+const (
+	// DefaultAddress is the default address to which the statsd client tries
+	// to connect to.
+	DefaultAddress = "localhost:8125"
+
+	// DefaultBufferSize is the default size for batches of metrics sent to
+	// statsd, it fits in the MTU of ethernet networks.
+	DefaultBufferSize = 1432
+
+	// MaxBufferSize is a hard-limit on the max size of the datagram buffer.
+	MaxBufferSize = 65507
+)
+
+// The ClientConfig type is used to configure statsd clients.
+type ClientConfig struct {
+	// Address of the statsd server to send metrics to, "host:port".
+	Address string
+
+	// Dialect of the tags understood by the server, the default is Plain
+	// which drops tags.
+	Dialect Dialect
+
+	// Maximum size of batch of metrics sent to statsd, which is the maximum
+	// size of the datagrams. The default is DefaultBufferSize.
+	BufferSize int
+
+	// FlushInterval is the interval at which the client flushes batches of
+	// metrics that were not filled yet. By default batches are only sent
+	// when they are full or when the client is flushed.
+	FlushInterval time.Duration
+}
+
+// Client represents a statsd client that implements the stats.Handler
+// interface.
+type Client struct {
+	serializer
+	err    error
+	buffer stats.Buffer
+
+	once sync.Once
+	stop chan struct{}
+	join chan struct{}
+}
+
+// NewClient creates and returns a new statsd client publishing metrics to the
+// server running at addr, in the plain statsd protocol.
+func NewClient(addr string) *Client {
+	return NewClientWith(ClientConfig{
+		Address: addr,
+	})
+}
+
+// NewClientWith creates and returns a new statsd client configured with the
+// given config.
+func NewClientWith(config ClientConfig) *Client {
+	if len(config.Address) == 0 {
+		config.Address = DefaultAddress
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+
+	if config.BufferSize > MaxBufferSize {
+		config.BufferSize = MaxBufferSize
+	}
+
+	c := &Client{
+		serializer: serializer{
+			dialect:    config.Dialect,
+			bufferSize: config.BufferSize,
+		},
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	if c.conn, c.err = net.Dial("udp", config.Address); c.err != nil {
+		log.Printf("stats/statsd: %s", c.err)
+	}
+
+	c.buffer.BufferSize = config.BufferSize
+	c.buffer.Serializer = &c.serializer
+
+	if config.FlushInterval > 0 {
+		go c.run(config.FlushInterval)
+	} else {
+		close(c.join)
+	}
+
+	return c
+}
+
+func (c *Client) run(interval time.Duration) {
+	defer close(c.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (c *Client) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	c.buffer.HandleMeasures(time, measures...)
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (c *Client) Flush() {
+	c.buffer.Flush()
+}
+
+// Close flushes and closes the client, satisfies the io.Closer interface.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.join
+	})
+	c.Flush()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	return c.err
+}
+
+type serializer struct {
+	conn       net.Conn
+	dialect    Dialect
+	bufferSize int
+}
+
+func (s *serializer) AppendMeasures(b []byte, _ time.Time, measures ...stats.Measure) []byte {
+	for _, m := range measures {
+		b = AppendMeasure(b, m, s.dialect)
+	}
+	return b
+}
+
+// Write satisfies the io.Writer interface. Batches larger than the buffer size
+// are split on line boundaries, lines which do not fit in a datagram are
+// dropped.
+func (s *serializer) Write(b []byte) (int, error) {
+	if s.conn == nil {
+		return len(b), nil
+	}
+
+	n := len(b)
+
+	for len(b) != 0 {
+		chunk := b
+		if len(chunk) > s.bufferSize {
+			i := bytes.LastIndexByte(chunk[:s.bufferSize], '\n')
+			if i < 0 {
+				end := bytes.IndexByte(b, '\n') + 1
+				if end == 0 {
+					end = len(b)
+				}
+				log.Printf("stats/statsd: metric of length %d B doesn't fit in the buffer of size %d B", end, s.bufferSize)
+				b = b[end:]
+				continue
+			}
+			chunk = chunk[:i+1]
+		}
+
+		if _, err := s.conn.Write(chunk); err != nil {
+			return n - len(b), err
+		}
+
+		b = b[len(chunk):]
+	}
+
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestClient(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewClientWith(ClientConfig{
+		Address:    conn.LocalAddr().String(),
+		Dialect:    SignalFx,
+		BufferSize: 64,
+	})
+
+	for i := 0; i != 5; i++ {
+		client.HandleMeasures(time.Now(), stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("count", 1, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("service", "api")},
+		})
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	const line = "request.count[service=api]:1|c\n"
+	lines := 0
+	b := make([]byte, 65536)
+
+	for lines < 5 {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 64 {
+			t.Errorf("datagram of %d B exceeds the buffer size", n)
+		}
+		for p := b[:n]; len(p) != 0; p = p[len(line):] {
+			if string(p[:len(line)]) != line {
+				t.Fatalf("bad datagram: %q", b[:n])
+			}
+			lines++
+		}
+	}
+}
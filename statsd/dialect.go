@@ -0,0 +1,79 @@
+package statsd
+
+import "fmt"
+
+// Dialect is an enumeration of the extensions of the statsd protocol which
+// carry tags, each aggregator understands a different one.
+type Dialect int
+
+const (
+	// Plain is the original statsd protocol, which has no tags. Tags are
+	// dropped from the metrics.
+	Plain Dialect = iota
+
+	// InfluxDB appends the tags to the metric names with the syntax of the
+	// InfluxDB line protocol, "name,k1=v1,k2=v2:1|c".
+	InfluxDB
+
+	// Librato appends the tags to the metric names after a '#',
+	// "name#k1=v1,k2=v2:1|c".
+	Librato
+
+	// SignalFx appends the tags to the metric names between brackets,
+	// "name[k1=v1,k2=v2]:1|c".
+	SignalFx
+
+	// DogStatsD appends the tags to the metric lines after a '#',
+	// "name:1|c|#k1:v1,k2:v2".
+	DogStatsD
+)
+
+// Telegraf is the dialect understood by the statsd input of Telegraf, which
+// parses the InfluxDB syntax.
+const Telegraf = InfluxDB
+
+var dialectNames = [...]string{
+	Plain:     "plain",
+	InfluxDB:  "influxdb",
+	Librato:   "librato",
+	SignalFx:  "signalfx",
+	DogStatsD: "dogstatsd",
+}
+
+// ParseDialect returns the dialect with the given name, one of "plain",
+// "influxdb", "telegraf", "librato", "signalfx", or "dogstatsd".
+func ParseDialect(name string) (Dialect, error) {
+	if name == "telegraf" {
+		return Telegraf, nil
+	}
+	for d, n := range dialectNames {
+		if n == name {
+			return Dialect(d), nil
+		}
+	}
+	return Plain, fmt.Errorf("stats/statsd: unknown dialect: %q", name)
+}
+
+// String satisfies the fmt.Stringer interface.
+func (d Dialect) String() string {
+	if d >= 0 && int(d) < len(dialectNames) {
+		return dialectNames[d]
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface.
+func (d Dialect) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface, which lets
+// programs select the dialect from their configuration files.
+func (d *Dialect) UnmarshalText(b []byte) error {
+	dialect, err := ParseDialect(string(b))
+	if err != nil {
+		return err
+	}
+	*d = dialect
+	return nil
+}
@@ -0,0 +1,144 @@
+package statsd
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// AppendMeasure is a formatting routine to append the statsd representation
+// of a measure to a memory buffer, with tags formatted for the given dialect.
+//
+// Each field of the measure is written on its own line, named after the
+// measure and the field. Histograms are sent as timers, and durations in
+// milliseconds which is the unit of statsd timers. Distributions are sent as
+// distributions in the DogStatsD dialect, and as timers in the others.
+func AppendMeasure(b []byte, m stats.Measure, dialect Dialect) []byte {
+	for _, field := range m.Fields {
+		b = appendName(b, m.Name, field.Name)
+
+		switch dialect {
+		case InfluxDB:
+			for _, tag := range m.Tags {
+				b = append(b, ',')
+				b = appendTag(b, tag, '=')
+			}
+		case Librato:
+			b = appendTags(b, m.Tags, '#', 0, '=')
+		case SignalFx:
+			b = appendTags(b, m.Tags, '[', ']', '=')
+		}
+
+		b = append(b, ':')
+		b = appendValue(b, field.Value)
+
+		switch field.Type() {
+		case stats.Counter:
+			b = append(b, '|', 'c')
+		case stats.Gauge:
+			b = append(b, '|', 'g')
+		case stats.Distribution:
+			if dialect == DogStatsD {
+				b = append(b, '|', 'd')
+			} else {
+				b = append(b, '|', 'm', 's')
+			}
+		default:
+			b = append(b, '|', 'm', 's')
+		}
+
+		if dialect == DogStatsD {
+			b = appendTags(b, m.Tags, '|', 0, ':')
+		}
+
+		b = append(b, '\n')
+	}
+	return b
+}
+
+func appendName(b []byte, measure, field string) []byte {
+	b = appendSanitized(b, measure)
+	if len(field) != 0 {
+		if len(measure) != 0 {
+			b = append(b, '.')
+		}
+		b = appendSanitized(b, field)
+	}
+	return b
+}
+
+// appendTags appends tags between open and close, close is omitted when it is
+// zero. The DogStatsD dialect uses '|' to open the tag section, which is then
+// followed by a '#'.
+func appendTags(b []byte, tags []stats.Tag, open, close, sep byte) []byte {
+	if len(tags) == 0 {
+		return b
+	}
+
+	b = append(b, open)
+	if open == '|' {
+		b = append(b, '#')
+	}
+
+	for i, tag := range tags {
+		if i != 0 {
+			b = append(b, ',')
+		}
+		b = appendTag(b, tag, sep)
+	}
+
+	if close != 0 {
+		b = append(b, close)
+	}
+	return b
+}
+
+func appendTag(b []byte, tag stats.Tag, sep byte) []byte {
+	b = appendSanitized(b, tag.Name)
+	b = append(b, sep)
+	return appendSanitized(b, tag.Value)
+}
+
+// appendSanitized appends s to b, replacing the characters which have a
+// meaning in one of the dialects with underscores.
+func appendSanitized(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ':', '|', '@', '#', ',', '=', '[', ']':
+			b = append(b, '_')
+		default:
+			if c <= ' ' || c == 0x7f {
+				b = append(b, '_')
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return b
+}
+
+func appendValue(b []byte, v stats.Value) []byte {
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return append(b, '1')
+		}
+		return append(b, '0')
+	case stats.Int:
+		return strconv.AppendInt(b, v.Int(), 10)
+	case stats.Uint:
+		return strconv.AppendUint(b, v.Uint(), 10)
+	case stats.Float:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return append(b, '0')
+		}
+		return strconv.AppendFloat(b, f, 'g', -1, 64)
+	case stats.Duration:
+		return strconv.AppendFloat(b, float64(v.Duration())/float64(time.Millisecond), 'g', -1, 64)
+	default:
+		return append(b, '0')
+	}
+}
@@ -0,0 +1,92 @@
+package statsd
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+func TestAppendMeasure(t *testing.T) {
+	m := stats.Measure{
+		Name: "request",
+		Fields: []stats.Field{
+			stats.MakeField("count", 5, stats.Counter),
+			stats.MakeField("rtt", 100*time.Millisecond, stats.Histogram),
+			stats.MakeField("size", 1.5, stats.Gauge),
+			stats.MakeField("bytes", 512, stats.Distribution),
+		},
+		Tags: []stats.Tag{
+			stats.T("answer", "42"),
+			stats.T("hello", "world,=:|"),
+		},
+	}
+
+	tests := []struct {
+		dialect Dialect
+		expect  string
+	}{
+		{
+			dialect: Plain,
+			expect: "request.count:5|c\n" +
+				"request.rtt:100|ms\n" +
+				"request.size:1.5|g\n" +
+				"request.bytes:512|ms\n",
+		},
+		{
+			dialect: InfluxDB,
+			expect: "request.count,answer=42,hello=world____:5|c\n" +
+				"request.rtt,answer=42,hello=world____:100|ms\n" +
+				"request.size,answer=42,hello=world____:1.5|g\n" +
+				"request.bytes,answer=42,hello=world____:512|ms\n",
+		},
+		{
+			dialect: Librato,
+			expect: "request.count#answer=42,hello=world____:5|c\n" +
+				"request.rtt#answer=42,hello=world____:100|ms\n" +
+				"request.size#answer=42,hello=world____:1.5|g\n" +
+				"request.bytes#answer=42,hello=world____:512|ms\n",
+		},
+		{
+			dialect: SignalFx,
+			expect: "request.count[answer=42,hello=world____]:5|c\n" +
+				"request.rtt[answer=42,hello=world____]:100|ms\n" +
+				"request.size[answer=42,hello=world____]:1.5|g\n" +
+				"request.bytes[answer=42,hello=world____]:512|ms\n",
+		},
+		{
+			dialect: DogStatsD,
+			expect: "request.count:5|c|#answer:42,hello:world____\n" +
+				"request.rtt:100|ms|#answer:42,hello:world____\n" +
+				"request.size:1.5|g|#answer:42,hello:world____\n" +
+				"request.bytes:512|d|#answer:42,hello:world____\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dialect.String(), func(t *testing.T) {
+			if s := string(AppendMeasure(nil, m, test.dialect)); s != test.expect {
+				t.Errorf("bad metric representation:\n- expected: %q\n- found:    %q", test.expect, s)
+			}
+		})
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	for _, name := range []string{"plain", "influxdb", "librato", "signalfx", "dogstatsd"} {
+		var d Dialect
+		if err := d.UnmarshalText([]byte(name)); err != nil {
+			t.Error(err)
+		} else if d.String() != name {
+			t.Errorf("bad dialect: expected %s, got %s", name, d)
+		}
+	}
+
+	if d, err := ParseDialect("telegraf"); err != nil || d != InfluxDB {
+		t.Error("bad telegraf dialect:", d, err)
+	}
+
+	if _, err := ParseDialect("carbon"); err == nil {
+		t.Error("expected an error for an unknown dialect")
+	}
+}
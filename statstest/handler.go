@@ -1,6 +1,8 @@
 package statstest
 
 import (
+	"context"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,17 +16,27 @@ var (
 )
 
 // Handler is a stats handler that can record measures for inspection.
+//
+// The methods querying the measures identify metrics by their full name, the
+// name of the measure, including the prefix of the engine, and the name of the
+// field joined by a dot, for example "test.requests.count" for a counter
+// reported as "requests.count" by an engine with the "test" prefix. They match
+// the measures carrying all the given tags, and possibly others.
 type Handler struct {
 	sync.Mutex
 	measures []stats.Measure
 	flush    int32
+	updated  chan struct{}
+	counters map[string]float64
 }
 
 // HandleMeasures process a variadic list of stats.Measure.
 func (h *Handler) HandleMeasures(_ time.Time, measures ...stats.Measure) {
 	h.Lock()
-	for _, m := range measures {
-		h.measures = append(h.measures, m.Clone())
+	h.measures = append(h.measures, stats.CloneMeasures(measures)...)
+	if h.updated != nil {
+		close(h.updated)
+		h.updated = nil
 	}
 	h.Unlock()
 }
@@ -52,5 +64,147 @@ func (h *Handler) FlushCalls() int {
 func (h *Handler) Clear() {
 	h.Lock()
 	h.measures = h.measures[:0]
+	h.counters = nil
 	h.Unlock()
 }
+
+// Value returns the value of the last measure of the metric with the given
+// name and tags, and a boolean indicating whether the metric was reported.
+func (h *Handler) Value(name string, tags ...stats.Tag) (stats.Value, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i := len(h.measures) - 1; i >= 0; i-- {
+		if f, ok := findField(&h.measures[i], name, tags); ok {
+			return f.Value, true
+		}
+	}
+	return stats.Value{}, false
+}
+
+// CounterDelta returns the sum of the values of the counter with the given
+// name and tags reported since the previous call to CounterDelta with the same
+// arguments, or since the handler was created or cleared. Durations are
+// counted in seconds.
+//
+// It lets tests check the effect of an operation on counters which are also
+// incremented by other parts of the program:
+//
+//	h.CounterDelta("test.requests.count")
+//	client.Get(url)
+//	if n := h.CounterDelta("test.requests.count"); n != 1 {
+//		t.Errorf("bad number of requests: %g", n)
+//	}
+func (h *Handler) CounterDelta(name string, tags ...stats.Tag) float64 {
+	h.Lock()
+	defer h.Unlock()
+
+	total := 0.0
+	for i := range h.measures {
+		if f, ok := findField(&h.measures[i], name, tags); ok && f.Type() == stats.Counter {
+			total += floatOf(f.Value)
+		}
+	}
+
+	key := counterKey(name, tags)
+	delta := total - h.counters[key]
+
+	if h.counters == nil {
+		h.counters = make(map[string]float64)
+	}
+	h.counters[key] = total
+	return delta
+}
+
+// WaitForMeasure waits until a measure of the metric with the given name and
+// tags is handled, and returns it. If the metric was already reported, it
+// returns its last measure immediately. It returns the error of ctx if ctx is
+// canceled first.
+//
+// Use it to test code reporting metrics from other goroutines, instead of
+// sleeping before inspecting the measures.
+func (h *Handler) WaitForMeasure(ctx context.Context, name string, tags ...stats.Tag) (stats.Measure, error) {
+	for {
+		h.Lock()
+		for i := len(h.measures) - 1; i >= 0; i-- {
+			if _, ok := findField(&h.measures[i], name, tags); ok {
+				m := h.measures[i]
+				h.Unlock()
+				return m, nil
+			}
+		}
+		if h.updated == nil {
+			h.updated = make(chan struct{})
+		}
+		updated := h.updated
+		h.Unlock()
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return stats.Measure{}, ctx.Err()
+		}
+	}
+}
+
+// findField returns the field of m with the metric name if m has all the tags.
+func findField(m *stats.Measure, name string, tags []stats.Tag) (stats.Field, bool) {
+	measure, field := "", name
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		measure, field = name[:i], name[i+1:]
+	}
+
+	if m.Name != measure || !hasTags(m.Tags, tags) {
+		return stats.Field{}, false
+	}
+
+	for _, f := range m.Fields {
+		if f.Name == field {
+			return f, true
+		}
+	}
+	return stats.Field{}, false
+}
+
+func hasTags(tags, subset []stats.Tag) bool {
+search:
+	for _, s := range subset {
+		for _, t := range tags {
+			if t == s {
+				continue search
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func counterKey(name string, tags []stats.Tag) string {
+	tags = stats.SortTags(append([]stats.Tag(nil), tags...))
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, t := range tags {
+		b.WriteByte(0)
+		b.WriteString(t.String())
+	}
+	return b.String()
+}
+
+func floatOf(v stats.Value) float64 {
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return 1.0
+		}
+	case stats.Int:
+		return float64(v.Int())
+	case stats.Uint:
+		return float64(v.Uint())
+	case stats.Float:
+		return v.Float()
+	case stats.Duration:
+		return v.Duration().Seconds()
+	}
+	return 0.0
+}
@@ -0,0 +1,178 @@
+package statstest_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestMain(m *testing.M) {
+	stats.GoVersionReportingEnabled = false
+	os.Exit(m.Run())
+}
+
+func newEngine(h stats.Handler) *stats.Engine {
+	return stats.NewEngine("test", h, stats.T("service", "api"))
+}
+
+func TestHandlerValue(t *testing.T) {
+	h := &statstest.Handler{}
+	e := newEngine(h)
+
+	e.Set("queue.size", 1, stats.T("queue", "a"))
+	e.Set("queue.size", 2, stats.T("queue", "b"))
+	e.Set("queue.size", 3, stats.T("queue", "a"))
+
+	if v, ok := h.Value("test.queue.size", stats.T("queue", "a")); !ok || v.Int() != 3 {
+		t.Errorf("bad value of queue a: %v, %t", v, ok)
+	}
+	if v, ok := h.Value("test.queue.size"); !ok || v.Int() != 3 {
+		t.Errorf("bad last value: %v, %t", v, ok)
+	}
+	if _, ok := h.Value("test.queue.size", stats.T("queue", "c")); ok {
+		t.Error("found the value of a queue which was not reported")
+	}
+	if _, ok := h.Value("queue.size"); ok {
+		t.Error("found a metric without the prefix of the engine")
+	}
+}
+
+func TestHandlerCounterDelta(t *testing.T) {
+	h := &statstest.Handler{}
+	e := newEngine(h)
+
+	e.Incr("requests.count", stats.T("method", "GET"))
+	e.Add("requests.count", 2, stats.T("method", "POST"))
+
+	if n := h.CounterDelta("test.requests.count"); n != 3 {
+		t.Errorf("bad initial delta: %g", n)
+	}
+	if n := h.CounterDelta("test.requests.count", stats.T("method", "GET")); n != 1 {
+		t.Errorf("bad initial delta of GET requests: %g", n)
+	}
+
+	e.Incr("requests.count", stats.T("method", "GET"))
+
+	if n := h.CounterDelta("test.requests.count"); n != 1 {
+		t.Errorf("bad delta: %g", n)
+	}
+	if n := h.CounterDelta("test.requests.count"); n != 0 {
+		t.Errorf("bad delta without new measures: %g", n)
+	}
+
+	h.Clear()
+	e.Incr("requests.count", stats.T("method", "GET"))
+
+	if n := h.CounterDelta("test.requests.count", stats.T("method", "GET")); n != 1 {
+		t.Errorf("bad delta after clearing the handler: %g", n)
+	}
+}
+
+func TestHandlerWaitForMeasure(t *testing.T) {
+	h := &statstest.Handler{}
+	e := newEngine(h)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		e.Incr("other.count")
+		e.Incr("jobs.count", stats.T("kind", "email"))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m, err := h.WaitForMeasure(ctx, "test.jobs.count", stats.T("kind", "email"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "test.jobs" {
+		t.Errorf("bad measure: %v", m)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := h.WaitForMeasure(ctx, "test.missing.count"); err != context.DeadlineExceeded {
+		t.Errorf("bad error waiting for a missing measure: %v", err)
+	}
+}
+
+type fakeT struct {
+	testing.TB
+	failure string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.failure = fmt.Sprintf(format, args...)
+}
+
+func TestRequire(t *testing.T) {
+	h := &statstest.Handler{}
+	e := newEngine(h)
+
+	e.Incr("requests.count", stats.T("method", "GET"))
+	e.Observe("requests.rtt", 1500*time.Millisecond)
+
+	statstest.RequireMetric(t, h, "test.requests.count", stats.T("method", "GET"))
+	statstest.RequireNoMetric(t, h, "test.requests.count", stats.T("method", "POST"))
+	statstest.RequireValue(t, h, "test.requests.rtt", 1.5)
+	statstest.RequireCounterDelta(t, h, "test.requests.count", 1)
+	statstest.RequireCounterDelta(t, h, "test.requests.count", 0)
+
+	tests := []struct {
+		name    string
+		require func(testing.TB)
+		failure string
+	}{
+		{
+			name: "missing metric",
+			require: func(t testing.TB) {
+				statstest.RequireMetric(t, h, "test.requests.size")
+			},
+			failure: "metric test.requests.size was not reported\nreported metrics:\n\ttest.requests.count [method=GET service=api]\n\ttest.requests.rtt [service=api]",
+		},
+		{
+			name: "unexpected metric",
+			require: func(t testing.TB) {
+				statstest.RequireNoMetric(t, h, "test.requests.count")
+			},
+			failure: "metric test.requests.count was reported with value 1",
+		},
+		{
+			name: "bad value",
+			require: func(t testing.TB) {
+				statstest.RequireValue(t, h, "test.requests.rtt", 1)
+			},
+			failure: "metric test.requests.rtt has value 1.5, want 1",
+		},
+		{
+			name: "bad counter delta",
+			require: func(t testing.TB) {
+				statstest.RequireCounterDelta(t, h, "test.requests.count", 1, stats.T("method", "GET"))
+			},
+			failure: "counter test.requests.count [method=GET] increased by 0, want 1",
+		},
+	}
+
+	// The deltas of the counter with the method tag start from the first call.
+	h.CounterDelta("test.requests.count", stats.T("method", "GET"))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ft := &fakeT{TB: t}
+			test.require(ft)
+
+			if !strings.HasPrefix(ft.failure, test.failure) {
+				t.Errorf("bad failure:\n%s\nwant:\n%s", ft.failure, test.failure)
+			}
+		})
+	}
+}
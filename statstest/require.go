@@ -0,0 +1,96 @@
+package statstest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// RequireMetric fails the test immediately if the metric with the given name
+// and tags was not reported to h, and returns the value of its last measure
+// otherwise. The failure message lists the metrics which were reported. See
+// Handler for how metrics are matched.
+func RequireMetric(t testing.TB, h *Handler, name string, tags ...stats.Tag) stats.Value {
+	t.Helper()
+
+	v, ok := h.Value(name, tags...)
+	if !ok {
+		t.Fatalf("metric %s was not reported\n%s", describe(name, tags), h.reported())
+	}
+	return v
+}
+
+// RequireNoMetric fails the test immediately if the metric with the given name
+// and tags was reported to h.
+func RequireNoMetric(t testing.TB, h *Handler, name string, tags ...stats.Tag) {
+	t.Helper()
+
+	if v, ok := h.Value(name, tags...); ok {
+		t.Fatalf("metric %s was reported with value %v", describe(name, tags), v)
+	}
+}
+
+// RequireValue fails the test immediately if the last value of the metric with
+// the given name and tags is not want, or if the metric was not reported.
+// Values of any type are compared as float64, durations in seconds.
+func RequireValue(t testing.TB, h *Handler, name string, want float64, tags ...stats.Tag) {
+	t.Helper()
+
+	if v := floatOf(RequireMetric(t, h, name, tags...)); v != want {
+		t.Fatalf("metric %s has value %g, want %g", describe(name, tags), v, want)
+	}
+}
+
+// RequireCounterDelta fails the test immediately if the sum of the values of
+// the counter with the given name and tags, since the previous call to
+// Handler.CounterDelta with the same arguments, is not want.
+func RequireCounterDelta(t testing.TB, h *Handler, name string, want float64, tags ...stats.Tag) {
+	t.Helper()
+
+	if delta := h.CounterDelta(name, tags...); delta != want {
+		t.Fatalf("counter %s increased by %g, want %g", describe(name, tags), delta, want)
+	}
+}
+
+func describe(name string, tags []stats.Tag) string {
+	if len(tags) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s %v", name, tags)
+}
+
+// reported returns a description of the metrics reported to h, for failure
+// messages.
+func (h *Handler) reported() string {
+	h.Lock()
+	defer h.Unlock()
+
+	if len(h.measures) == 0 {
+		return "no metrics were reported"
+	}
+
+	var b strings.Builder
+	b.WriteString("reported metrics:")
+
+	seen := make(map[string]bool)
+	for _, m := range h.measures {
+		for _, f := range m.Fields {
+			s := describe(metricName(m.Name, f.Name), m.Tags)
+			if !seen[s] {
+				seen[s] = true
+				b.WriteString("\n\t")
+				b.WriteString(s)
+			}
+		}
+	}
+	return b.String()
+}
+
+func metricName(measure, field string) string {
+	if measure == "" {
+		return field
+	}
+	return measure + "." + field
+}
@@ -9,8 +9,8 @@ import (
 // A Tag is a pair of a string key and value set on measures to define the
 // dimensions of the metrics.
 type Tag struct {
-	Name  string
-	Value string
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // T is shorthand for `stats.Tag{Name: "blah", Value: "foo"}`  It returns
@@ -124,14 +124,14 @@ type tagsBuffer struct {
 }
 
 func (b *tagsBuffer) reset() {
-	for i := range b.tags {
-		b.tags[i] = Tag{}
-	}
+	// sort may have shortened the slice when removing duplicates, the whole
+	// backing array is cleared so it does not retain the removed tags.
+	clear(b.tags[:cap(b.tags)])
 	b.tags = b.tags[:0]
 }
 
 func (b *tagsBuffer) sort() {
-	SortTags(b.tags)
+	b.tags = SortTags(b.tags)
 }
 
 func (b *tagsBuffer) append(tags ...Tag) {
@@ -0,0 +1,84 @@
+package stats
+
+import "slices"
+
+// TagSet is a set of tags, with unique names, built once and updated in place
+// so the same tags can be passed to many report calls without building a
+// slice of tags on each call:
+//
+//	tags := stats.NewTagSet(stats.T("queue", name))
+//	for job := range jobs {
+//		tags.Set("kind", job.Kind)
+//		stats.Incr("jobs.count", tags.Tags()...)
+//	}
+//
+// The tags are kept sorted by name, which is the order engines expect. The
+// zero value is an empty set ready to use. Sets must not be updated
+// concurrently with other uses.
+type TagSet struct {
+	tags []Tag
+}
+
+// NewTagSet returns a set of the given tags. Later tags replace the earlier
+// ones with the same name.
+func NewTagSet(tags ...Tag) *TagSet {
+	return &TagSet{tags: SortTags(copyTags(tags))}
+}
+
+// Set sets the value of the tag with the given name, adding the tag to the set
+// if it had none. It returns s so calls can be chained.
+func (s *TagSet) Set(name, value string) *TagSet {
+	if i, found := s.search(name); found {
+		s.tags[i].Value = value
+	} else {
+		s.tags = slices.Insert(s.tags, i, T(name, value))
+	}
+	return s
+}
+
+// Remove removes the tag with the given name from the set, if it has one. It
+// returns s so calls can be chained.
+func (s *TagSet) Remove(name string) *TagSet {
+	if i, found := s.search(name); found {
+		s.tags = slices.Delete(s.tags, i, i+1)
+	}
+	return s
+}
+
+// Get returns the value of the tag with the given name, and a boolean
+// indicating whether the set has it.
+func (s *TagSet) Get(name string) (string, bool) {
+	if i, found := s.search(name); found {
+		return s.tags[i].Value, true
+	}
+	return "", false
+}
+
+// Len returns the number of tags in the set.
+func (s *TagSet) Len() int {
+	return len(s.tags)
+}
+
+// Tags returns the tags of the set, sorted by name. The slice is shared with
+// the set, it must not be modified, and is only valid until the next update
+// of the set.
+func (s *TagSet) Tags() []Tag {
+	return s.tags
+}
+
+// Reset removes all the tags from the set, retaining its capacity.
+func (s *TagSet) Reset() {
+	clear(s.tags)
+	s.tags = s.tags[:0]
+}
+
+// Clone returns a copy of the set, which can be updated independently.
+func (s *TagSet) Clone() *TagSet {
+	return &TagSet{tags: copyTags(s.tags)}
+}
+
+func (s *TagSet) search(name string) (int, bool) {
+	return slices.BinarySearchFunc(s.tags, name, func(t Tag, name string) int {
+		return tagCompare(t, Tag{Name: name})
+	})
+}
@@ -0,0 +1,93 @@
+package stats_test
+
+import (
+	"reflect"
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestTagSet(t *testing.T) {
+	s := stats.NewTagSet(stats.T("b", "1"), stats.T("a", "1"), stats.T("b", "2"))
+
+	if tags := s.Tags(); !reflect.DeepEqual(tags, []stats.Tag{stats.T("a", "1"), stats.T("b", "2")}) {
+		t.Errorf("bad initial tags: %v", tags)
+	}
+
+	s.Set("c", "3").Set("a", "4").Set("0", "5").Remove("b").Remove("missing")
+
+	if tags := s.Tags(); !reflect.DeepEqual(tags, []stats.Tag{stats.T("0", "5"), stats.T("a", "4"), stats.T("c", "3")}) {
+		t.Errorf("bad tags after updates: %v", tags)
+	}
+
+	if v, ok := s.Get("a"); !ok || v != "4" {
+		t.Errorf("bad value of a: %q, %t", v, ok)
+	}
+	if _, ok := s.Get("b"); ok {
+		t.Error("the removed tag was found")
+	}
+
+	c := s.Clone()
+	c.Set("a", "cloned")
+	if v, _ := s.Get("a"); v != "4" {
+		t.Error("updating a clone modified the original set")
+	}
+
+	s.Reset()
+	if s.Len() != 0 || c.Len() != 3 {
+		t.Errorf("bad lengths after reset: %d, %d", s.Len(), c.Len())
+	}
+
+	var zero stats.TagSet
+	if tags := zero.Set("x", "y").Tags(); !reflect.DeepEqual(tags, []stats.Tag{stats.T("x", "y")}) {
+		t.Errorf("bad tags of the zero value: %v", tags)
+	}
+}
+
+func TestTagSetReport(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h, stats.T("service", "api"))
+	s := stats.NewTagSet(stats.T("queue", "jobs"))
+
+	for _, kind := range []string{"email", "sms"} {
+		s.Set("kind", kind)
+		e.Incr("jobs.count", s.Tags()...)
+	}
+
+	measures := h.Measures()
+	if len(measures) != 2 {
+		t.Fatalf("bad number of measures: %d", len(measures))
+	}
+
+	expect := []stats.Tag{stats.T("kind", "sms"), stats.T("queue", "jobs"), stats.T("service", "api")}
+	if tags := measures[1].Tags; !reflect.DeepEqual(tags, expect) {
+		t.Errorf("bad tags: %v", tags)
+	}
+
+	e = stats.NewEngine("test", stats.Discard)
+	e.Incr("jobs.count", s.Tags()...) // warm up the measure pool
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Set("kind", "email")
+		e.Incr("jobs.count", s.Tags()...)
+	})
+	if allocs != 0 {
+		t.Errorf("reporting with a tag set allocated %g times", allocs)
+	}
+}
+
+func BenchmarkTagSet(b *testing.B) {
+	e := stats.NewEngine("test", stats.Discard)
+	s := stats.NewTagSet(stats.T("queue", "jobs"), stats.T("region", "us-west-2"))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s.Set("kind", "email")
+		e.Incr("jobs.count", s.Tags()...)
+	}
+}
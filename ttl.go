@@ -0,0 +1,229 @@
+package stats
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExpireMode defines what happens to a gauge when it expires.
+type ExpireMode int
+
+const (
+	// ExpireZero reports expired gauges as zero, which is what push-based
+	// backends keep displaying until the gauge is set again.
+	ExpireZero ExpireMode = iota
+
+	// ExpireRemove asks the handlers implementing the Remover interface to
+	// stop exposing the series of expired gauges, the other handlers are not
+	// notified.
+	ExpireRemove
+)
+
+// GaugeTTL configures the expiration of a gauge.
+type GaugeTTL struct {
+	// TTL is how long a gauge keeps its value after it was last set.
+	TTL time.Duration
+
+	// Mode is what happens to the gauge once it expired.
+	Mode ExpireMode
+}
+
+// MetricTTLs is a registry storing the expiration of gauges. It is safe to use
+// concurrently from multiple goroutines, expirations can be changed while the
+// program reports measures. The zero value is an empty registry.
+type MetricTTLs struct {
+	mutex sync.Mutex // serializes updates
+	ttls  atomic.Pointer[map[Key]GaugeTTL]
+}
+
+// Set configures the gauge identified by key, which has the form
+// "measure.field", to expire when it was not set for longer than ttl.
+func (r *MetricTTLs) Set(key string, ttl time.Duration, mode ExpireMode) {
+	r.update(func(ttls map[Key]GaugeTTL) { ttls[makeKey(key)] = GaugeTTL{TTL: ttl, Mode: mode} })
+}
+
+// Delete removes the expiration of the gauge identified by key, the series of
+// the gauge which are already tracked still expire.
+func (r *MetricTTLs) Delete(key string) {
+	r.update(func(ttls map[Key]GaugeTTL) { delete(ttls, makeKey(key)) })
+}
+
+// Get returns the expiration of the gauge identified by key, and a boolean
+// indicating whether the registry has one.
+func (r *MetricTTLs) Get(key string) (GaugeTTL, bool) {
+	ttl, ok := r.load()[makeKey(key)]
+	return ttl, ok
+}
+
+// load returns the current expirations, the map must not be modified.
+func (r *MetricTTLs) load() map[Key]GaugeTTL {
+	if ttls := r.ttls.Load(); ttls != nil {
+		return *ttls
+	}
+	return nil
+}
+
+// update applies f to a copy of the expirations and publishes it, readers
+// never see the map being modified.
+func (r *MetricTTLs) update(f func(map[Key]GaugeTTL)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ttls := maps.Clone(r.load())
+	if ttls == nil {
+		ttls = make(map[Key]GaugeTTL)
+	}
+	f(ttls)
+	r.ttls.Store(&ttls)
+}
+
+// GaugeTTLs is a registry where the expiration of gauges is configured, so the
+// values of gauges that are not refreshed anymore, for example because the
+// goroutine producing them crashed, do not remain visible forever. Keys are the
+// full names of metrics, including the engine prefix.
+//
+// Engines keep track of the last time each series of the configured gauges
+// was set, and expire them when they are flushed, so expiration requires the
+// engine to be flushed periodically (see Engine.StartFlusher). The TTL starts
+// when the engine receives the gauge, not at the time the measure carries, so
+// gauges reported with a past time (for example when backfilling) are not
+// expired right away:
+//
+//	func init() {
+//		stats.GaugeTTLs.Set("worker.healthy", time.Minute, stats.ExpireZero)
+//	}
+//
+// Expired gauges are reported (or removed) once, and tracked again the next
+// time they are set.
+var GaugeTTLs MetricTTLs
+
+// Remover is implemented by handlers which can stop exposing the series of
+// measures, like the prometheus handler. The engine calls RemoveMeasures with
+// the gauges that expired in ExpireRemove mode, the values of the fields are
+// irrelevant.
+type Remover interface {
+	RemoveMeasures(measures ...Measure)
+}
+
+func remove(h Handler, measures ...Measure) {
+	switch r := h.(type) {
+	case Remover:
+		r.RemoveMeasures(measures...)
+	case *multiHandler:
+		for _, h := range r.handlers {
+			remove(h, measures...)
+		}
+	case *filteredHandler:
+		remove(r.handler, measures...)
+	}
+}
+
+// gaugeTracker records the last time that the series of gauges configured in
+// GaugeTTLs were set, it is shared by the engines created by WithPrefix and
+// WithTags.
+type gaugeTracker struct {
+	mutex  sync.Mutex
+	gauges map[string]*trackedGauge
+}
+
+type trackedGauge struct {
+	measure Measure // single field, holding the last value
+	handler Handler
+	expires time.Time
+	mode    ExpireMode
+}
+
+// track records the gauges of m which have a TTL, now is the time the gauges
+// were received, which their expiration is computed from.
+func (g *gaugeTracker) track(now time.Time, ttls map[Key]GaugeTTL, h Handler, m *Measure) {
+	for i, f := range m.Fields {
+		if f.Type() != Gauge {
+			continue
+		}
+
+		ttl, ok := ttls[Key{Measure: m.Name, Field: f.Name}]
+		if !ok {
+			continue
+		}
+
+		key := seriesKey(m.Name, f.Name, m.Tags)
+		g.mutex.Lock()
+
+		if g.gauges == nil {
+			g.gauges = make(map[string]*trackedGauge)
+		}
+
+		tg := g.gauges[key]
+		if tg == nil {
+			tg = &trackedGauge{
+				measure: Measure{
+					Name:   m.Name,
+					Fields: copyFields(m.Fields[i : i+1]),
+					Tags:   copyTags(m.Tags),
+				},
+			}
+			g.gauges[key] = tg
+		}
+		tg.measure.Fields[0].Value = f.Value
+		tg.handler = h
+		tg.expires = now.Add(ttl.TTL)
+		tg.mode = ttl.Mode
+
+		g.mutex.Unlock()
+	}
+}
+
+// expire stops tracking the gauges which expired at now, reporting them as
+// zero with handle or removing them from the handlers.
+func (g *gaugeTracker) expire(now time.Time, handle func(Handler, time.Time, []Measure)) {
+	var expired []*trackedGauge
+
+	g.mutex.Lock()
+	for key, tg := range g.gauges {
+		if !now.Before(tg.expires) {
+			expired = append(expired, tg)
+			delete(g.gauges, key)
+		}
+	}
+	g.mutex.Unlock()
+
+	for _, tg := range expired {
+		m := tg.measure
+		switch tg.mode {
+		case ExpireRemove:
+			remove(tg.handler, m)
+		default:
+			m.Fields[0].Value.bits = 0 // zero for all types of values
+			handle(tg.handler, now, []Measure{m})
+		}
+	}
+}
+
+// lazyGaugeTracker is embedded in engines, which may be constructed as struct
+// literals, to create their tracker on first use.
+type lazyGaugeTracker struct {
+	ptr atomic.Pointer[gaugeTracker]
+}
+
+func (l *lazyGaugeTracker) load() *gaugeTracker {
+	if g := l.ptr.Load(); g != nil {
+		return g
+	}
+	l.ptr.CompareAndSwap(nil, new(gaugeTracker))
+	return l.ptr.Load()
+}
+
+// trackGauges records the gauges of measures which have a TTL.
+func (e *Engine) trackGauges(measures []Measure) {
+	ttls := GaugeTTLs.load()
+	if len(ttls) == 0 {
+		return
+	}
+	now := time.Now()
+	g := e.gauges.load()
+	for i := range measures {
+		g.track(now, ttls, e.Handler, &measures[i])
+	}
+}
@@ -0,0 +1,137 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+)
+
+func TestGaugeTTL(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	const ttl = 20 * time.Millisecond
+	stats.GaugeTTLs.Set("test.worker.healthy", ttl, stats.ExpireZero)
+	defer stats.GaugeTTLs.Delete("test.worker.healthy")
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+
+	// The first series is stale, the second one was refreshed recently.
+	e.Set("worker.healthy", 1, stats.T("worker", "A"))
+	time.Sleep(2 * ttl)
+	e.Set("worker.healthy", 1, stats.T("worker", "B"))
+	e.Set("worker.busy", 1, stats.T("worker", "A"))
+	h.Clear()
+
+	e.WithTags(stats.T("other", "tag")).Flush()
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatal("bad measures:", measures)
+	}
+
+	m := measures[0]
+	if m.Name != "test.worker" || len(m.Tags) != 1 || m.Tags[0] != stats.T("worker", "A") {
+		t.Error("bad measure:", m)
+	}
+	if f := m.Fields[0]; f.Name != "healthy" || f.Type() != stats.Gauge || f.Value.Int() != 0 {
+		t.Error("bad field:", f)
+	}
+
+	// Expired gauges are only reported once.
+	h.Clear()
+	e.Flush()
+
+	if measures := h.Measures(); len(measures) != 0 {
+		t.Error("expired gauges reported again:", measures)
+	}
+}
+
+type removeHandler struct {
+	statstest.Handler
+	removed []stats.Measure
+}
+
+func (h *removeHandler) RemoveMeasures(measures ...stats.Measure) {
+	h.removed = append(h.removed, stats.CloneMeasures(measures)...)
+}
+
+func TestGaugeTTLRemove(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	type metrics struct {
+		queue struct {
+			size int `metric:"size" type:"gauge"`
+		} `metric:"queue"`
+	}
+
+	const ttl = 20 * time.Millisecond
+	stats.GaugeTTLs.Set("test.queue.size", ttl, stats.ExpireRemove)
+	defer stats.GaugeTTLs.Delete("test.queue.size")
+
+	r := &removeHandler{}
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", stats.MultiHandler(r, h))
+
+	e.Report(&metrics{})
+	h.Clear()
+	time.Sleep(2 * ttl)
+	e.Flush()
+
+	if measures := h.Measures(); len(measures) != 0 {
+		t.Error("removed gauges were reported:", measures)
+	}
+
+	if len(r.removed) != 1 || r.removed[0].Name != "test.queue" || r.removed[0].Fields[0].Name != "size" {
+		t.Error("bad removed measures:", r.removed)
+	}
+}
+
+func TestGaugeTTLBackfill(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	stats.GaugeTTLs.Set("test.worker.healthy", time.Minute, stats.ExpireZero)
+	defer stats.GaugeTTLs.Delete("test.worker.healthy")
+
+	h := &statstest.Handler{}
+	e := stats.NewEngine("test", h)
+
+	// The TTL starts when the gauge is received, not at the time it carries.
+	e.SetAt(time.Now().Add(-time.Hour), "worker.healthy", 1)
+	h.Clear()
+	e.Flush()
+
+	if measures := h.Measures(); len(measures) != 0 {
+		t.Error("backfilled gauges were expired:", measures)
+	}
+}
+
+func TestGaugeTTLsConcurrentUpdates(t *testing.T) {
+	e := stats.NewEngine("test", stats.Discard)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for i := 0; i != 100; i++ {
+			stats.GaugeTTLs.Set("test.concurrent.value", time.Minute, stats.ExpireZero)
+			stats.GaugeTTLs.Delete("test.concurrent.value")
+		}
+	}()
+
+	for i := 0; i != 100; i++ {
+		e.Set("concurrent.value", i)
+	}
+	<-done
+
+	if _, ok := stats.GaugeTTLs.Get("test.concurrent.value"); ok {
+		t.Error("the expiration was not deleted")
+	}
+}
@@ -0,0 +1,208 @@
+// Package v4compat exposes the API of version 4 of the stats package on top of
+// the version 5 engine, so programs can adopt the handlers of version 5 (otlp,
+// prometheus native histograms, ...) before finishing the migration of their
+// code.
+//
+// Version 5 kept the API of version 4, the breaking changes are the import
+// path and the names of a few tags produced by httpstats. Importing this
+// package under the stats name is enough to migrate the import path:
+//
+//	import stats "github.com/segmentio/stats/v5/v4compat"
+//
+// The types of this package are aliases of the version 5 types, so engines,
+// handlers, and measures can be mixed freely with code using version 5
+// directly. Dashboards relying on the tag names of version 4 can keep working
+// by wrapping the handlers with the LegacyTagNames middleware:
+//
+//	stats.Register(stats.LegacyTagNames()(prometheus.DefaultHandler))
+package v4compat
+
+import (
+	"context"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Aliases of the types of the stats package.
+type (
+	Engine           = stats.Engine
+	Handler          = stats.Handler
+	HandlerFunc      = stats.HandlerFunc
+	Flusher          = stats.Flusher
+	Measure          = stats.Measure
+	Field            = stats.Field
+	FieldType        = stats.FieldType
+	Value            = stats.Value
+	Type             = stats.Type
+	Tag              = stats.Tag
+	Clock            = stats.Clock
+	Key              = stats.Key
+	HistogramBuckets = stats.HistogramBuckets
+)
+
+// Field types.
+const (
+	Counter   = stats.Counter
+	Gauge     = stats.Gauge
+	Histogram = stats.Histogram
+)
+
+// Value types.
+const (
+	Null     = stats.Null
+	Bool     = stats.Bool
+	Int      = stats.Int
+	Uint     = stats.Uint
+	Float    = stats.Float
+	Duration = stats.Duration
+)
+
+var (
+	// DefaultEngine is the engine used by the functions of this package. It
+	// is a snapshot of stats.DefaultEngine taken when the package is
+	// initialized: both variables point to the same engine, so handlers
+	// registered on either are shared, but assigning a new engine to one of
+	// them does not update the other. Programs replacing the default engine
+	// must assign both variables.
+	//
+	// It remains a variable, rather than a function returning
+	// stats.DefaultEngine, so the version 4 code assigning it keeps compiling.
+	DefaultEngine = stats.DefaultEngine
+
+	// Buckets is the registry of histogram buckets, shared with the stats
+	// package.
+	Buckets = stats.Buckets
+
+	// Discard is a handler which discards all measures.
+	Discard = stats.Discard
+)
+
+// NewEngine creates and returns a new engine configured with prefix, handler,
+// and tags.
+func NewEngine(prefix string, handler Handler, tags ...Tag) *Engine {
+	return stats.NewEngine(prefix, handler, tags...)
+}
+
+// T is shorthand for `stats.Tag{Name: "blah", Value: "foo"}`.
+func T(k, v string) Tag { return stats.T(k, v) }
+
+// M allows for creating a tag list from a map.
+func M(m map[string]string) []Tag { return stats.M(m) }
+
+// MakeField constructs and returns a new Field from name, value, and ftype.
+func MakeField(name string, value interface{}, ftype FieldType) Field {
+	return stats.MakeField(name, value, ftype)
+}
+
+// MakeMeasures takes a struct value or a pointer to a struct value as argument
+// and extracts and returns the list of measures that it represented.
+func MakeMeasures(prefix string, value interface{}, tags ...Tag) []Measure {
+	return stats.MakeMeasures(prefix, value, tags...)
+}
+
+// ValueOf inspects v's dynamic type and returns a Value that encapsulates it.
+func ValueOf(v interface{}) Value { return stats.ValueOf(v) }
+
+// MultiHandler constructs a handler which dispatches measures to all given
+// handlers.
+func MultiHandler(handlers ...Handler) Handler { return stats.MultiHandler(handlers...) }
+
+// FilteredHandler constructs a handler that processes measures with filter
+// before passing them to h.
+func FilteredHandler(h Handler, filter func([]Measure) []Measure) Handler {
+	return stats.FilteredHandler(h, filter)
+}
+
+// SortTags sorts and deduplicates tags in-place, favoring later elements
+// whenever a tag name duplicate occurs.
+func SortTags(tags []Tag) []Tag { return stats.SortTags(tags) }
+
+// TagsAreSorted returns true if the given list of tags is sorted by tag name.
+func TagsAreSorted(tags []Tag) bool { return stats.TagsAreSorted(tags) }
+
+// ContextWithTags returns a new child context with the given tags.
+func ContextWithTags(ctx context.Context, tags ...Tag) context.Context {
+	return stats.ContextWithTags(ctx, tags...)
+}
+
+// ContextAddTags adds the given tags to the given context, if the tags have
+// been set on any of the ancestor contexts.
+func ContextAddTags(ctx context.Context, tags ...Tag) bool {
+	return stats.ContextAddTags(ctx, tags...)
+}
+
+// ContextTags returns a copy of the tags on the context if they exist and nil
+// if they don't exist.
+func ContextTags(ctx context.Context) []Tag { return stats.ContextTags(ctx) }
+
+// Register adds handler to the default engine.
+func Register(handler Handler) { DefaultEngine.Register(handler) }
+
+// Flush flushes the default engine.
+func Flush() { DefaultEngine.Flush() }
+
+// WithPrefix returns a copy of the engine with prefix appended to default
+// engine's current prefix and tags set to the merge of engine's current tags
+// and those passed as argument. Both the default engine and the returned engine
+// share the same handler.
+func WithPrefix(prefix string, tags ...Tag) *Engine {
+	return DefaultEngine.WithPrefix(prefix, tags...)
+}
+
+// WithTags returns a copy of the engine with tags set to the merge of the
+// default engine's current tags and those passed as arguments. Both the default
+// engine and the returned engine share the same handler.
+func WithTags(tags ...Tag) *Engine { return DefaultEngine.WithTags(tags...) }
+
+// Incr increments by one the counter identified by name and tags.
+func Incr(name string, tags ...Tag) { DefaultEngine.Incr(name, tags...) }
+
+// IncrAt increments by one the counter identified by name and tags.
+func IncrAt(time time.Time, name string, tags ...Tag) { DefaultEngine.IncrAt(time, name, tags...) }
+
+// Add increments by value the counter identified by name and tags.
+func Add(name string, value interface{}, tags ...Tag) { DefaultEngine.Add(name, value, tags...) }
+
+// AddAt increments by value the counter identified by name and tags.
+func AddAt(time time.Time, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.AddAt(time, name, value, tags...)
+}
+
+// Set sets to value the gauge identified by name and tags.
+func Set(name string, value interface{}, tags ...Tag) { DefaultEngine.Set(name, value, tags...) }
+
+// SetAt sets to value the gauge identified by name and tags.
+func SetAt(time time.Time, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.SetAt(time, name, value, tags...)
+}
+
+// Observe reports value for the histogram identified by name and tags.
+func Observe(name string, value interface{}, tags ...Tag) {
+	DefaultEngine.Observe(name, value, tags...)
+}
+
+// ObserveAt reports value for the histogram identified by name and tags.
+func ObserveAt(time time.Time, name string, value interface{}, tags ...Tag) {
+	DefaultEngine.ObserveAt(time, name, value, tags...)
+}
+
+// Report is a helper function that delegates to DefaultEngine.
+func Report(metrics interface{}, tags ...Tag) { DefaultEngine.Report(metrics, tags...) }
+
+// ReportAt is a helper function that delegates to DefaultEngine.
+func ReportAt(time time.Time, metrics interface{}, tags ...Tag) {
+	DefaultEngine.ReportAt(time, metrics, tags...)
+}
+
+// LegacyTagNames returns a middleware renaming the tags which were renamed in
+// version 5 back to their version 4 names:
+//
+//	http_req_content_encoding -> http_req_content_endoing
+//	http_res_content_encoding -> http_res_content_endoing
+func LegacyTagNames() stats.HandlerMiddleware {
+	return stats.Relabel(
+		stats.RelabelRule{Action: stats.RenameTag, Tag: "http_req_content_encoding", Replacement: "http_req_content_endoing"},
+		stats.RelabelRule{Action: stats.RenameTag, Tag: "http_res_content_encoding", Replacement: "http_res_content_endoing"},
+	)
+}
@@ -0,0 +1,66 @@
+package v4compat_test
+
+import (
+	"testing"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/statstest"
+	"github.com/segmentio/stats/v5/v4compat"
+)
+
+func TestDefaultEngine(t *testing.T) {
+	if v4compat.DefaultEngine != stats.DefaultEngine {
+		t.Error("the default engine is not shared with the stats package")
+	}
+}
+
+func TestEngine(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+
+	// Engines created by the package are version 5 engines, which accept the
+	// version 5 handlers.
+	var eng *stats.Engine = v4compat.NewEngine("test", h, v4compat.T("a", "1"))
+	eng.Incr("calls.count")
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatalf("bad number of measures: %d", len(measures))
+	}
+
+	m := measures[0]
+	if m.Name != "test.calls" || m.Fields[0].Name != "count" || m.Fields[0].Value.Int() != 1 {
+		t.Errorf("bad measure: %v", m)
+	}
+	if len(m.Tags) != 1 || m.Tags[0] != stats.T("a", "1") {
+		t.Errorf("bad tags: %v", m.Tags)
+	}
+}
+
+func TestLegacyTagNames(t *testing.T) {
+	initValue := stats.GoVersionReportingEnabled
+	stats.GoVersionReportingEnabled = false
+	defer func() { stats.GoVersionReportingEnabled = initValue }()
+
+	h := &statstest.Handler{}
+	eng := stats.NewEngine("", v4compat.LegacyTagNames()(h))
+	eng.Incr("http.message.count",
+		stats.T("http_req_content_encoding", "gzip"),
+		stats.T("http_res_content_encoding", "br"),
+	)
+
+	measures := h.Measures()
+	if len(measures) != 1 {
+		t.Fatalf("bad number of measures: %d", len(measures))
+	}
+
+	tags := stats.SortTags(measures[0].Tags)
+	if len(tags) != 2 ||
+		tags[0] != stats.T("http_req_content_endoing", "gzip") ||
+		tags[1] != stats.T("http_res_content_endoing", "br") {
+		t.Errorf("bad tags: %v", tags)
+	}
+}
@@ -94,10 +94,11 @@ func (c *Client) HandleMeasures(time time.Time, measures ...stats.Measure) {
 		return
 	}
 
-	finalMeasures := make([]stats.Measure, len(measures))
-	for i := range measures {
-		finalMeasures[i] = measures[i].Clone()
-		finalMeasures[i].Tags = append(measures[i].Tags, c.tags...)
+	// The tags are appended to clones of the measures, appending to the tags
+	// of the original measures could overwrite memory owned by the engine.
+	finalMeasures := stats.CloneMeasures(measures)
+	for i := range finalMeasures {
+		finalMeasures[i].Tags = append(finalMeasures[i].Tags, c.tags...)
 	}
 
 	c.Client.HandleMeasures(time, finalMeasures...)
@@ -0,0 +1,176 @@
+package veneur
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+)
+
+// Field numbers and enum values of the SSFSpan and SSFSample messages of the
+// SSF protocol (https://github.com/stripe/veneur/blob/master/ssf/sample.proto).
+const (
+	spanService = 8
+	spanMetrics = 10
+
+	sampleMetric     = 1
+	sampleName       = 2
+	sampleValue      = 3
+	sampleTimestamp  = 4
+	sampleSampleRate = 7
+	sampleTags       = 8
+	sampleScope      = 9
+
+	ssfCounter   = 0
+	ssfGauge     = 1
+	ssfHistogram = 2
+
+	ssfScopeDefault = 0
+	ssfScopeLocal   = 1
+	ssfScopeGlobal  = 2
+
+	protoVarint  = 0
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// appendSample appends the SSFSample of field f of measure m to b, as an
+// element of the metrics of a span. The veneurglobalonly and veneurlocalonly
+// tags of the measure are sent as the scope of the sample instead of tags,
+// distributions are sent as histograms of the global scope unless the scope is
+// set otherwise.
+func (s *ssfSerializer) appendSample(b []byte, t time.Time, m *stats.Measure, f stats.Field) []byte {
+	return appendProtoMessage(b, spanMetrics, func(b []byte) []byte {
+		scope := s.scope
+
+		switch f.Type() {
+		case stats.Gauge:
+			b = appendProtoVarint(b, sampleMetric, ssfGauge)
+		case stats.Histogram:
+			b = appendProtoVarint(b, sampleMetric, ssfHistogram)
+		case stats.Distribution:
+			// Distributions are aggregated across all hosts, which veneur does
+			// for histograms of the global scope.
+			b = appendProtoVarint(b, sampleMetric, ssfHistogram)
+			if scope == ssfScopeDefault {
+				scope = ssfScopeGlobal
+			}
+		}
+
+		b = appendProtoTag(b, sampleName, protoBytes)
+		if len(m.Name) == 0 {
+			b = binary.AppendUvarint(b, uint64(len(f.Name)))
+		} else {
+			b = binary.AppendUvarint(b, uint64(len(m.Name)+1+len(f.Name)))
+			b = append(b, m.Name...)
+			b = append(b, '.')
+		}
+		b = append(b, f.Name...)
+
+		b = appendProtoFloat(b, sampleValue, valueOf(f.Value))
+
+		if !t.IsZero() {
+			b = appendProtoVarint(b, sampleTimestamp, uint64(t.UnixNano()))
+		}
+
+		rate := float64(1)
+		if m.SampleRate > 0 && m.SampleRate < 1 {
+			rate = m.SampleRate
+		}
+		b = appendProtoFloat(b, sampleSampleRate, rate)
+
+		for _, tag := range m.Tags {
+			switch tag.Name {
+			case GlobalOnly:
+				scope = ssfScopeGlobal
+				continue
+			case LocalOnly:
+				scope = ssfScopeLocal
+				continue
+			}
+			if _, filtered := s.filters[tag.Name]; filtered {
+				continue
+			}
+			b = appendProtoMessage(b, sampleTags, func(b []byte) []byte {
+				b = appendProtoString(b, 1, tag.Name)
+				return appendProtoString(b, 2, tag.Value)
+			})
+		}
+
+		if scope != ssfScopeDefault {
+			b = appendProtoVarint(b, sampleScope, uint64(scope))
+		}
+		return b
+	})
+}
+
+// valueOf converts v to the value of a sample, durations are sent in seconds.
+func valueOf(v stats.Value) float64 {
+	switch v.Type() {
+	case stats.Bool:
+		if v.Bool() {
+			return 1
+		}
+	case stats.Int:
+		return float64(v.Int())
+	case stats.Uint:
+		return float64(v.Uint())
+	case stats.Float:
+		return v.Float()
+	case stats.Duration:
+		return v.Duration().Seconds()
+	}
+	return 0
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = appendProtoTag(b, field, protoVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendProtoFloat appends v as a 32 bits float, which is the type of the
+// values of samples.
+func appendProtoFloat(b []byte, field int, v float64) []byte {
+	b = appendProtoTag(b, field, protoFixed32)
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(v)))
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = appendProtoTag(b, field, protoBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendProtoMessage appends an embedded message produced by f, its length is
+// only known once written so it gets inserted in front of it afterwards.
+func appendProtoMessage(b []byte, field int, f func([]byte) []byte) []byte {
+	b = appendProtoTag(b, field, protoBytes)
+	start := len(b)
+	b = f(b)
+
+	var n [binary.MaxVarintLen64]byte
+	size := binary.PutUvarint(n[:], uint64(len(b)-start))
+	b = append(b, n[:size]...)
+	copy(b[start+size:], b[start:len(b)-size])
+	copy(b[start:], n[:size])
+	return b
+}
+
+// nextSample returns the length of the first sample appended to b by
+// appendSample, including its tag and length, or -1 if b is malformed.
+func nextSample(b []byte) int {
+	tag, n := binary.Uvarint(b)
+	if n <= 0 || tag != spanMetrics<<3|protoBytes {
+		return -1
+	}
+	size, m := binary.Uvarint(b[n:])
+	if m <= 0 || size > uint64(len(b)-n-m) {
+		return -1
+	}
+	return n + m + int(size)
+}
@@ -0,0 +1,294 @@
+package veneur
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	stats "github.com/segmentio/stats/v5"
+	"github.com/segmentio/stats/v5/datadog"
+)
+
+const (
+	// DefaultSSFAddress is the default address to which SSF clients send
+	// metrics, veneur listens for SSF on this port by default.
+	DefaultSSFAddress = "localhost:8128"
+
+	// DefaultSSFBufferSize is the default size of the packets sent by SSF
+	// clients, it fits in the MTU of ethernet networks.
+	DefaultSSFBufferSize = 1432
+
+	// MaxSSFBufferSize is a hard-limit on the size of the packets sent by SSF
+	// clients, it is the maximum size of the packets accepted by veneur.
+	MaxSSFBufferSize = 16384
+)
+
+// The SSFConfig type is used to configure SSF clients.
+type SSFConfig struct {
+	// Address of the veneur server to send metrics to.
+	// UDP: host:port or udp://host:port (default)
+	// UDS: unix:///dir/file.ext, veneur listens for SSF in stream mode
+	Address string
+
+	// Service is the name of the service sent with the metrics, which veneur
+	// reports in the metrics that it derives from spans.
+	Service string
+
+	// Maximum size of the packets of metrics sent to veneur. The default is
+	// DefaultSSFBufferSize.
+	BufferSize int
+
+	// FlushInterval is the interval at which the client flushes batches of
+	// metrics that were not filled yet. By default batches are only sent
+	// when they are full or when the client is flushed.
+	FlushInterval time.Duration
+
+	// If set true, all metrics are sent with the global scope, they are only
+	// aggregated by the global veneur.
+	GlobalOnly bool
+
+	// If set true, all metrics are sent with the local scope, they are only
+	// aggregated by the local veneur. Cannot be set in conjunction with
+	// GlobalOnly.
+	LocalOnly bool
+
+	// List of tags to filter. If left nil is set to datadog.DefaultFilters.
+	Filters []string
+}
+
+// SSFClient is a stats.Handler sending metrics to veneur with its native
+// protocol, the Sensor Sensibility Format (SSF). Measures are sent as the
+// metrics of SSF spans, which are protobuf messages sent in UDP datagrams or
+// over unix sockets.
+//
+// Unlike Client, which sends metrics in the dogstatsd protocol, the client
+// sends the scope of metrics with them, so veneur knows which metrics are
+// aggregated globally, like the percentiles of histograms, without parsing
+// tags. The scope of all metrics is set by the GlobalOnly and LocalOnly
+// fields of SSFConfig, and the scope of individual measures by the
+// veneurglobalonly and veneurlocalonly tags.
+type SSFClient struct {
+	ssfSerializer
+	err    error
+	buffer stats.Buffer
+
+	once sync.Once
+	stop chan struct{}
+	join chan struct{}
+}
+
+// NewSSFClient creates and returns a new SSF client publishing metrics to the
+// veneur server running at addr.
+func NewSSFClient(addr string) *SSFClient {
+	return NewSSFClientWith(SSFConfig{
+		Address: addr,
+	})
+}
+
+// NewSSFClientWith creates and returns a new SSF client configured with the
+// given config.
+func NewSSFClientWith(config SSFConfig) *SSFClient {
+	if len(config.Address) == 0 {
+		config.Address = DefaultSSFAddress
+	}
+
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultSSFBufferSize
+	}
+
+	if config.BufferSize > MaxSSFBufferSize {
+		config.BufferSize = MaxSSFBufferSize
+	}
+
+	if config.Filters == nil {
+		config.Filters = datadog.DefaultFilters
+	}
+
+	filters := make(map[string]struct{}, len(config.Filters))
+	for _, f := range config.Filters {
+		filters[f] = struct{}{}
+	}
+
+	c := &SSFClient{
+		ssfSerializer: ssfSerializer{
+			filters:    filters,
+			bufferSize: config.BufferSize,
+		},
+		stop: make(chan struct{}),
+		join: make(chan struct{}),
+	}
+
+	if config.GlobalOnly {
+		c.scope = ssfScopeGlobal
+	} else if config.LocalOnly {
+		c.scope = ssfScopeLocal
+	}
+
+	if len(config.Service) != 0 {
+		c.header = appendProtoString(nil, spanService, config.Service)
+	}
+
+	c.network, c.address = ssfNetworkAddress(config.Address)
+	if c.conn, c.err = net.Dial(c.network, c.address); c.err != nil {
+		log.Printf("stats/veneur: %s", c.err)
+	}
+
+	c.buffer.BufferSize = config.BufferSize - len(c.header)
+	c.buffer.Serializer = &c.ssfSerializer
+
+	if config.FlushInterval > 0 {
+		go c.run(config.FlushInterval)
+	} else {
+		close(c.join)
+	}
+
+	return c
+}
+
+func ssfNetworkAddress(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		return "unix", path
+	}
+	return "udp", strings.TrimPrefix(addr, "udp://")
+}
+
+func (c *SSFClient) run(interval time.Duration) {
+	defer close(c.join)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// HandleMeasures satisfies the stats.Handler interface.
+func (c *SSFClient) HandleMeasures(time time.Time, measures ...stats.Measure) {
+	c.buffer.HandleMeasures(time, measures...)
+}
+
+// Flush satisfies the stats.Flusher interface.
+func (c *SSFClient) Flush() {
+	c.buffer.Flush()
+}
+
+// Close flushes and closes the client, satisfies the io.Closer interface.
+func (c *SSFClient) Close() error {
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.join
+	})
+	c.Flush()
+
+	c.mutex.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.closed = true
+	c.mutex.Unlock()
+	return c.err
+}
+
+type ssfSerializer struct {
+	filters    map[string]struct{}
+	scope      int
+	header     []byte // fields of the spans carrying the samples
+	bufferSize int
+
+	mutex   sync.Mutex
+	network string
+	address string
+	conn    net.Conn
+	closed  bool
+	packet  []byte
+}
+
+func (s *ssfSerializer) AppendMeasures(b []byte, t time.Time, measures ...stats.Measure) []byte {
+	for i := range measures {
+		m := &measures[i]
+		for _, f := range m.Fields {
+			b = s.appendSample(b, t, m, f)
+		}
+	}
+	return b
+}
+
+// Write satisfies the io.Writer interface. Batches larger than the buffer size
+// are split on sample boundaries, samples which do not fit in a packet are
+// dropped.
+func (s *ssfSerializer) Write(b []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := len(b)
+	limit := s.bufferSize - len(s.header)
+
+	for len(b) != 0 {
+		size := 0
+		for size < len(b) {
+			next := nextSample(b[size:])
+			if next < 0 {
+				log.Printf("stats/veneur: dropping %d B of malformed samples", len(b)-size)
+				return n, nil
+			}
+			if size != 0 && size+next > limit {
+				break
+			}
+			size += next
+		}
+
+		if size > limit {
+			log.Printf("stats/veneur: metric of length %d B doesn't fit in the buffer of size %d B", size, s.bufferSize)
+		} else if err := s.send(b[:size]); err != nil {
+			return n - len(b), err
+		}
+
+		b = b[size:]
+	}
+
+	return n, nil
+}
+
+// send writes a span carrying samples to the connection, which is dialed
+// again if the client could not dial it before, or after errors on unix
+// sockets since veneur may have restarted. The mutex must be held.
+func (s *ssfSerializer) send(samples []byte) error {
+	if s.conn == nil {
+		if s.closed {
+			return nil
+		}
+		conn, err := net.Dial(s.network, s.address)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	p := s.packet[:0]
+	if s.network == "unix" {
+		// Spans sent over streams are framed by a version byte and their
+		// length, as 32 bits big-endian integer.
+		p = append(p, 0)
+		p = binary.BigEndian.AppendUint32(p, uint32(len(s.header)+len(samples)))
+	}
+	p = append(p, s.header...)
+	p = append(p, samples...)
+	s.packet = p
+
+	_, err := s.conn.Write(p)
+	if err != nil && s.network == "unix" {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
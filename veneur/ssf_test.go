@@ -0,0 +1,360 @@
+package veneur
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/stats/v5"
+)
+
+func TestSSFClientUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewSSFClientWith(SSFConfig{
+		Address: "udp://" + conn.LocalAddr().String(),
+		Service: "api",
+	})
+	defer client.Close()
+
+	now := time.Unix(1700000000, 0)
+	client.HandleMeasures(now, stats.Measure{
+		Name: "request",
+		Fields: []stats.Field{
+			stats.MakeField("count", 5, stats.Counter),
+			stats.MakeField("rtt", 100*time.Millisecond, stats.Histogram),
+		},
+		Tags: []stats.Tag{
+			stats.T("http_req_path", "/users/1"),
+			stats.T("method", "GET"),
+			{Name: GlobalOnly},
+		},
+		SampleRate: 0.5,
+	})
+	client.Flush()
+
+	b := make([]byte, MaxSSFBufferSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := decodeProto(t, b[:n])
+	if len(span) != 3 {
+		t.Fatalf("bad number of span fields: %d", len(span))
+	}
+	if f := span[0]; f.num != spanService || string(f.bytes) != "api" {
+		t.Errorf("bad service: %d %q", f.num, f.bytes)
+	}
+
+	count := decodeSample(t, span[1])
+	expect := ssfSample{
+		name:       "request.count",
+		value:      5,
+		timestamp:  now.UnixNano(),
+		sampleRate: 0.5,
+		tags:       map[string]string{"method": "GET"},
+		scope:      ssfScopeGlobal,
+	}
+	if !reflect.DeepEqual(count, expect) {
+		t.Errorf("bad counter sample:\n%+v\nexpected:\n%+v", count, expect)
+	}
+
+	rtt := decodeSample(t, span[2])
+	expect.metric, expect.name, expect.value = ssfHistogram, "request.rtt", float32(0.1)
+	if !reflect.DeepEqual(rtt, expect) {
+		t.Errorf("bad histogram sample:\n%+v\nexpected:\n%+v", rtt, expect)
+	}
+}
+
+func TestSSFClientUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssf.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client := NewSSFClientWith(SSFConfig{Address: "unix://" + path, LocalOnly: true})
+	defer client.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client.HandleMeasures(time.Time{}, stats.Measure{
+		Name:   "queue",
+		Fields: []stats.Field{stats.MakeField("size", 3, stats.Gauge)},
+	})
+	client.Flush()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame [5]byte
+	if _, err := io.ReadFull(conn, frame[:]); err != nil {
+		t.Fatal(err)
+	}
+	if frame[0] != 0 {
+		t.Errorf("bad frame version: %d", frame[0])
+	}
+
+	b := make([]byte, binary.BigEndian.Uint32(frame[1:]))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+
+	span := decodeProto(t, b)
+	if len(span) != 1 {
+		t.Fatalf("bad number of span fields: %d", len(span))
+	}
+
+	expect := ssfSample{
+		metric:     ssfGauge,
+		name:       "queue.size",
+		value:      3,
+		sampleRate: 1,
+		scope:      ssfScopeLocal,
+	}
+	if s := decodeSample(t, span[0]); !reflect.DeepEqual(s, expect) {
+		t.Errorf("bad gauge sample:\n%+v\nexpected:\n%+v", s, expect)
+	}
+}
+
+func TestSSFClientDistribution(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewSSFClient(conn.LocalAddr().String())
+	defer client.Close()
+
+	client.HandleMeasures(time.Time{},
+		stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("size", 512, stats.Distribution)},
+		},
+		stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("size", 256, stats.Distribution)},
+			Tags:   []stats.Tag{{Name: LocalOnly}},
+		},
+	)
+	client.Flush()
+
+	b := make([]byte, MaxSSFBufferSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := decodeProto(t, b[:n])
+	if len(span) != 2 {
+		t.Fatalf("bad number of span fields: %d", len(span))
+	}
+
+	expect := ssfSample{
+		metric:     ssfHistogram,
+		name:       "request.size",
+		value:      512,
+		sampleRate: 1,
+		scope:      ssfScopeGlobal,
+	}
+	if s := decodeSample(t, span[0]); !reflect.DeepEqual(s, expect) {
+		t.Errorf("bad distribution sample:\n%+v\nexpected:\n%+v", s, expect)
+	}
+
+	expect.value, expect.scope = 256, ssfScopeLocal
+	if s := decodeSample(t, span[1]); !reflect.DeepEqual(s, expect) {
+		t.Errorf("bad local distribution sample:\n%+v\nexpected:\n%+v", s, expect)
+	}
+}
+
+func TestSSFClientRedial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssf.sock")
+
+	// The client is created before veneur listens, the connection is dialed
+	// when the first batch of metrics is sent.
+	client := NewSSFClient("unix://" + path)
+	defer client.Close()
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client.HandleMeasures(time.Time{}, stats.Measure{
+		Name:   "queue",
+		Fields: []stats.Field{stats.MakeField("size", 3, stats.Gauge)},
+	})
+	client.Flush()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame [5]byte
+	if _, err := io.ReadFull(conn, frame[:]); err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.BigEndian.Uint32(frame[1:]); size == 0 {
+		t.Error("received an empty span")
+	}
+}
+
+func TestSSFClientBatches(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const bufferSize = 200
+
+	client := NewSSFClientWith(SSFConfig{
+		Address:    conn.LocalAddr().String(),
+		Service:    "api",
+		BufferSize: bufferSize,
+	})
+	defer client.Close()
+
+	measures := make([]stats.Measure, 20)
+	for i := range measures {
+		measures[i] = stats.Measure{
+			Name:   "request",
+			Fields: []stats.Field{stats.MakeField("count", i, stats.Counter)},
+			Tags:   []stats.Tag{stats.T("method", "GET")},
+		}
+	}
+	client.HandleMeasures(time.Now(), measures...)
+	client.Flush()
+
+	b := make([]byte, MaxSSFBufferSize)
+	samples, packets := 0, 0
+
+	for samples < len(measures) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("received %d samples: %s", samples, err)
+		}
+		if n > bufferSize {
+			t.Errorf("packet of %d B exceeds the buffer size", n)
+		}
+
+		span := decodeProto(t, b[:n])
+		if f := span[0]; f.num != spanService || string(f.bytes) != "api" {
+			t.Errorf("bad service: %d %q", f.num, f.bytes)
+		}
+		for _, f := range span[1:] {
+			if s := decodeSample(t, f); s.value != float32(samples) {
+				t.Errorf("bad value of sample %d: %g", samples, s.value)
+			}
+			samples++
+		}
+		packets++
+	}
+
+	if packets < 2 {
+		t.Errorf("samples were not split across packets")
+	}
+}
+
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+
+	for len(b) != 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		f := protoField{num: int(tag >> 3)}
+
+		switch tag & 7 {
+		case protoVarint:
+			f.varint, n = binary.Uvarint(b)
+			b = b[n:]
+		case protoFixed32:
+			f.bytes, b = b[:4], b[4:]
+		case protoBytes:
+			size, n := binary.Uvarint(b)
+			f.bytes, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatal("unexpected wire type:", tag&7)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+type ssfSample struct {
+	metric     uint64
+	name       string
+	value      float32
+	timestamp  int64
+	sampleRate float32
+	tags       map[string]string
+	scope      uint64
+}
+
+func decodeSample(t *testing.T, f protoField) ssfSample {
+	t.Helper()
+
+	if f.num != spanMetrics {
+		t.Fatal("unexpected span field:", f.num)
+	}
+
+	var s ssfSample
+	for _, f := range decodeProto(t, f.bytes) {
+		switch f.num {
+		case sampleMetric:
+			s.metric = f.varint
+		case sampleName:
+			s.name = string(f.bytes)
+		case sampleValue:
+			s.value = math.Float32frombits(binary.LittleEndian.Uint32(f.bytes))
+		case sampleTimestamp:
+			s.timestamp = int64(f.varint)
+		case sampleSampleRate:
+			s.sampleRate = math.Float32frombits(binary.LittleEndian.Uint32(f.bytes))
+		case sampleTags:
+			tag := decodeProto(t, f.bytes)
+			if s.tags == nil {
+				s.tags = make(map[string]string)
+			}
+			s.tags[string(tag[0].bytes)] = string(tag[1].bytes)
+		case sampleScope:
+			s.scope = f.varint
+		default:
+			t.Error("unexpected sample field:", f.num)
+		}
+	}
+	return s
+}